@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is the first file descriptor the service manager passes
+// sockets on
+const listenFDsStart = 3
+
+// activationListener returns the socket passed in by systemd socket
+// activation, or nil if the daemon wasn't started that way
+func activationListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+
+	// Processes the daemon starts mustn't take the sockets for theirs
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if count != 1 {
+		return nil, fmt.Errorf("expected one socket, got %d", count)
+	}
+	file := os.NewFile(listenFDsStart, "activation socket")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("passed in socket unusable: %w", err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestActivationListenerWithoutActivation(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "")
+	if listener, err := activationListener(); listener != nil || err != nil {
+		t.Errorf("Expected no listener without socket activation, got %v, %v", listener, err)
+	}
+
+	// Sockets passed to another process aren't ours to take
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	if listener, err := activationListener(); listener != nil || err != nil {
+		t.Errorf("Expected no listener for another process's sockets, got %v, %v", listener, err)
+	}
+	if os.Getenv("LISTEN_FDS") != "1" {
+		t.Error("Expected another process's variables left alone")
+	}
+}
+
+func TestActivationListenerRejectsSeveralSockets(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	if _, err := activationListener(); err == nil {
+		t.Error("Expected an error for more than one socket")
+	}
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Error("Expected the activation variables cleared")
+	}
+}
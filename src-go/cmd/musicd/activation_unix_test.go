@@ -0,0 +1,79 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// activatedEnv marks the test binary as started by TestSocketActivation
+const activatedEnv = "MUSICD_TEST_ACTIVATED"
+
+// TestActivatedProcess stands in for a daemon started by socket activation
+// when the test binary is started again by TestSocketActivation. It answers
+// one connection on the socket it was passed.
+func TestActivatedProcess(t *testing.T) {
+	if os.Getenv(activatedEnv) == "" {
+		t.Skip("Only run as a helper process")
+	}
+	// The service manager sets this to the process it starts, which the
+	// test can't know in advance
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	listener, err := activationListener()
+	if err != nil || listener == nil {
+		os.Exit(2)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		os.Exit(3)
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		os.Exit(4)
+	}
+	conn.Write([]byte("activated\n"))
+	conn.Close()
+	os.Exit(0)
+}
+
+func TestSocketActivation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "musicd.sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	file, err := listener.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// The first extra file is the child's descriptor 3
+	daemon := exec.Command(os.Args[0], "-test.run=^TestActivatedProcess$")
+	daemon.Env = append(os.Environ(), activatedEnv+"=1", "LISTEN_FDS=1")
+	daemon.ExtraFiles = []*os.File{file}
+	if err := daemon.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer daemon.Process.Kill()
+
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "activated\n" {
+		t.Errorf("Expected the daemon to answer on the passed socket, got %q, %v", line, err)
+	}
+	if err := daemon.Wait(); err != nil {
+		t.Errorf("Helper failed: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+)
+
+// otherAudioCheckInterval is how often the daemon looks for other
+// applications playing audio while audio.autoDuck is on
+const otherAudioCheckInterval = time.Second
+
+// watchOtherAudio ducks the player while another application plays audio,
+// for as long as audio.autoDuck is on. The setting is read on every check,
+// so turning it on or off applies without a restart.
+func watchOtherAudio(ctx context.Context, player *audio.Player, configMgr *config.Manager) {
+	ticker := time.NewTicker(otherAudioCheckInterval)
+	defer ticker.Stop()
+
+	ducked, warned := false, false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cfg := configMgr.Get().Audio
+			playing := false
+			if cfg.AutoDuck {
+				var err error
+				if playing, err = audio.OtherAudioPlaying(); err != nil && !warned {
+					log.Printf("[AUDIO] Auto-duck unavailable: %v", err)
+					warned = true
+				}
+			}
+			if playing {
+				// Also picks up changes to the duck level
+				player.Duck(audio.DuckOtherAudio, cfg.DuckLevel, 0)
+			} else if ducked {
+				player.Duck(audio.DuckOtherAudio, 1, 0)
+			}
+			if playing != ducked {
+				log.Printf("[AUDIO] Other audio playing: %v", playing)
+				ducked = playing
+			}
+		}
+	}
+}
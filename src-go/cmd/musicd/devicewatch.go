@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+	"github.com/austinkregel/local-media/musicd/internal/ipc"
+)
+
+// deviceCheckInterval is how often outputs are looked at besides when the
+// audio server reports a change, in case a report was missed
+const deviceCheckInterval = 5 * time.Second
+
+// deviceWatch pauses playback when the output device it plays on goes
+// away, and resumes it when the device comes back
+type deviceWatch struct {
+	player    *audio.Player
+	configMgr *config.Manager
+	server    *ipc.Server
+
+	device audio.OutputDevice // The device audio was last going to
+	lost   audio.OutputDevice // A device that went away, until it returns
+	paused bool               // Playback was paused when lost went away
+	warned bool
+}
+
+// watchOutputDevice watches for the output device going away until ctx is
+// done. Changes reported by the audio server are acted on straight away.
+func watchOutputDevice(ctx context.Context, player *audio.Player, configMgr *config.Manager, server *ipc.Server) {
+	w := &deviceWatch{player: player, configMgr: configMgr, server: server}
+	w.check()
+
+	ticker := time.NewTicker(deviceCheckInterval)
+	defer ticker.Stop()
+
+	events, _ := audio.OutputDeviceEvents(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-events:
+			if !ok {
+				// The audio server went away; subscribe again on the next tick
+				events = nil
+				continue
+			}
+			w.check()
+		case <-ticker.C:
+			if events == nil {
+				events, _ = audio.OutputDeviceEvents(ctx)
+			}
+			w.check()
+		}
+	}
+}
+
+// check looks at the outputs, acting on the device going or coming back
+func (w *deviceWatch) check() {
+	current, present, err := audio.OutputDevices()
+	if err != nil {
+		if !w.warned {
+			log.Printf("[AUDIO] Output device detection unavailable: %v", err)
+			w.warned = true
+		}
+		return
+	}
+	w.warned = false
+	cfg := w.configMgr.Get().Audio
+
+	if !w.lost.IsZero() && current.Same(w.lost) {
+		resumed := false
+		if w.paused && cfg.ResumeOnDeviceReturn && w.player.Status().State == audio.StatePaused {
+			if err := w.player.Resume(); err != nil {
+				log.Printf("[AUDIO] Failed to resume on %s: %v", current.Description, err)
+			} else {
+				resumed = true
+			}
+		}
+		log.Printf("[AUDIO] Output device back: %s (resumed: %v)", current.Description, resumed)
+		w.server.NotifyDeviceReturned(current.Description, resumed)
+		w.lost, w.paused = audio.OutputDevice{}, false
+	}
+
+	if w.device.IsZero() || current.Same(w.device) || slices.ContainsFunc(present, w.device.Same) {
+		// First look, no change, or switched to another device on purpose
+		w.device = current
+		return
+	}
+
+	paused := false
+	if cfg.PauseOnDeviceLoss && w.player.PlayingLocally() && w.player.Status().State == audio.StatePlaying {
+		if err := w.player.Pause(); err != nil {
+			log.Printf("[AUDIO] Failed to pause after losing %s: %v", w.device.Description, err)
+		} else {
+			paused = true
+		}
+	}
+	log.Printf("[AUDIO] Output device lost: %s, now %s (paused: %v)", w.device.Description, current.Description, paused)
+	w.server.NotifyDeviceLost(w.device.Description, paused)
+	w.lost, w.paused = w.device, paused
+	w.device = current
+}
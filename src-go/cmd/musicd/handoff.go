@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+// handoffRequested is set when a newer instance started with --replace asks
+// this one to exit
+var handoffRequested atomic.Bool
+
+func handoffPath(configDir string) string {
+	return filepath.Join(configDir, "handoff.json")
+}
+
+// writeHandoff saves the queue and playback state for the instance taking
+// over. Must be called before the player is stopped.
+func writeHandoff(configDir string, player *audio.Player, queueMgr *queue.Manager) {
+	status := player.Status()
+
+	// Never leave a stale file behind for the new instance if saving fails
+	os.Remove(handoffPath(configDir))
+
+	store := queue.NewStoreAt(handoffPath(configDir), queueMgr)
+	if status.Path != "" {
+		store.SetPosition(status.Path, status.Position)
+	}
+	store.SetPlaying(status.State == audio.StatePlaying)
+
+	if err := store.Save(); err != nil {
+		log.Printf("[QUEUE] Warning: failed to save handoff state: %v", err)
+		return
+	}
+	log.Printf("[QUEUE] Saved handoff state for replacing instance")
+}
+
+// takeOverHandoff loads the state left by a replaced instance and continues
+// playback where it stopped. Returns false if there was nothing to take over.
+func takeOverHandoff(ctx context.Context, configDir string, player *audio.Player, queueMgr *queue.Manager) bool {
+	path := handoffPath(configDir)
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	defer os.Remove(path)
+
+	store := queue.NewStoreAt(path, queueMgr)
+	if err := store.Load(); err != nil {
+		log.Printf("[QUEUE] Warning: failed to load handoff state: %v", err)
+		return false
+	}
+
+	idx, size := queueMgr.Position()
+	log.Printf("[QUEUE] Took over queue from previous instance: %d items, position %d", size, idx)
+
+	mode := "paused"
+	if store.WasPlaying() {
+		mode = "playing"
+	}
+	resumeLastSession(ctx, player, queueMgr, store, mode)
+	return true
+}
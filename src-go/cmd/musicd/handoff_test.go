@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+func newHandoffPlayer(t *testing.T) *audio.Player {
+	t.Helper()
+	player, err := audio.NewSimulatedPlayer(nil, audio.NewSimDecoder(time.Minute), audio.NewManualClock(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { player.Close() })
+	return player
+}
+
+func TestHandoffContinuesPlayback(t *testing.T) {
+	dir := t.TempDir()
+	var tracks []string
+	for _, name := range []string{"a.flac", "b.flac", "c.flac"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		tracks = append(tracks, path)
+	}
+
+	// The running instance is part way through the second track
+	oldQueue := queue.NewManager()
+	oldQueue.Set(tracks)
+	oldQueue.SetIndex(1)
+	oldPlayer := newHandoffPlayer(t)
+	if err := oldPlayer.PlayFrom(context.Background(), tracks[1], nil, 5000); err != nil {
+		t.Fatal(err)
+	}
+	writeHandoff(dir, oldPlayer, oldQueue)
+	oldPlayer.Stop()
+
+	newQueue := queue.NewManager()
+	newPlayer := newHandoffPlayer(t)
+	if !takeOverHandoff(context.Background(), dir, newPlayer, newQueue) {
+		t.Fatal("Expected the handoff taken over")
+	}
+	if index, size := newQueue.Position(); index != 1 || size != 3 {
+		t.Errorf("Expected the queue at 1 of 3, got %d of %d", index, size)
+	}
+	status := newPlayer.Status()
+	if status.Path != tracks[1] || status.State != audio.StatePlaying || status.Position != 5000 {
+		t.Errorf("Expected the second track playing from 5s, got %s %s at %dms", status.Path, status.State, status.Position)
+	}
+	if _, err := os.Stat(handoffPath(dir)); !os.IsNotExist(err) {
+		t.Errorf("Expected the handoff file removed once taken over, got %v", err)
+	}
+
+	// Without a handoff file there's nothing to take over
+	if takeOverHandoff(context.Background(), dir, newHandoffPlayer(t), queue.NewManager()) {
+		t.Error("Expected nothing to take over the second time")
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+	"github.com/austinkregel/local-media/musicd/internal/media"
+	"github.com/austinkregel/local-media/musicd/internal/mqtt"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+const (
+	// mqttStateInterval is how often the player is checked for changes to
+	// publish
+	mqttStateInterval = time.Second
+
+	// mqttPositionInterval is how often state is republished while playing,
+	// so the position doesn't go stale
+	mqttPositionInterval = 30 * time.Second
+
+	// Reconnect delays after the broker connection fails
+	mqttMinBackoff = 5 * time.Second
+	mqttMaxBackoff = 5 * time.Minute
+)
+
+// mqttState is the JSON published to the state topic
+type mqttState struct {
+	State         string `json:"state"`
+	Path          string `json:"path,omitempty"`
+	Title         string `json:"title,omitempty"`
+	Artist        string `json:"artist,omitempty"`
+	Album         string `json:"album,omitempty"`
+	Duration      int64  `json:"duration"` // milliseconds
+	Position      int64  `json:"position"` // milliseconds
+	Volume        int    `json:"volume"`   // 0 - 100
+	QueuePosition int    `json:"queuePosition"`
+	QueueSize     int    `json:"queueSize"`
+}
+
+// homeAutomation publishes player state to an MQTT broker while the config
+// enables it, along with Home Assistant discovery topics, and takes play,
+// pause, next and volume commands back. Commands act like the OS media
+// controls.
+type homeAutomation struct {
+	ctx      context.Context
+	player   *audio.Player
+	queueMgr *queue.Manager
+
+	mu      sync.Mutex
+	current config.MQTTConfig
+	stop    context.CancelFunc
+	done    chan struct{}
+}
+
+// set applies new MQTT settings, reconnecting if they changed
+func (h *homeAutomation) set(cfg config.MQTTConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if cfg == h.current && h.stop != nil {
+		return
+	}
+	h.current = cfg
+
+	h.closeLocked()
+	if !cfg.Enabled {
+		return
+	}
+	ctx, stop := context.WithCancel(h.ctx)
+	h.stop = stop
+	h.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		h.run(ctx, cfg)
+	}(h.done)
+}
+
+// active reports whether the broker is connected to, or being retried
+func (h *homeAutomation) active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stop != nil
+}
+
+// Close disconnects from the broker
+func (h *homeAutomation) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closeLocked()
+}
+
+func (h *homeAutomation) closeLocked() {
+	if h.stop == nil {
+		return
+	}
+	h.stop()
+	<-h.done
+	h.stop = nil
+}
+
+// run keeps a connection to the broker until ctx is done, retrying with
+// backoff while the broker can't be reached
+func (h *homeAutomation) run(ctx context.Context, cfg config.MQTTConfig) {
+	node := cfg.NodeID
+	if node == "" {
+		node = hostNodeID()
+	}
+	base := cfg.TopicPrefix + "/" + node
+	backoff := mqttMinBackoff
+
+	for {
+		connected := time.Now()
+		err := h.serve(ctx, cfg, node, base)
+		if ctx.Err() != nil {
+			return
+		}
+		// A connection that lasted a while starts the backoff over
+		if time.Since(connected) > mqttMaxBackoff {
+			backoff = mqttMinBackoff
+		}
+		log.Printf("[MQTT] Connection to %s failed: %v; retrying in %s", cfg.Broker, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, mqttMaxBackoff)
+	}
+}
+
+// serve connects, announces the player and publishes its state until ctx
+// is done or the connection is lost
+func (h *homeAutomation) serve(ctx context.Context, cfg config.MQTTConfig, node, base string) error {
+	availability := base + "/availability"
+	client, err := mqtt.Dial(ctx, mqtt.Options{
+		Addr:     cfg.Broker,
+		TLS:      cfg.TLS,
+		ClientID: "musicd-" + node,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		Will:     &mqtt.Message{Topic: availability, Payload: []byte("offline"), Retain: true},
+	}, func(msg mqtt.Message) { h.handle(base, msg) })
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Subscribe(base+"/command", base+"/volume/set"); err != nil {
+		return err
+	}
+	if cfg.Discovery {
+		for _, msg := range discoveryMessages(cfg.DiscoveryPrefix, node, base) {
+			if err := client.Publish(msg); err != nil {
+				return err
+			}
+		}
+	}
+	if err := client.Publish(mqtt.Message{Topic: availability, Payload: []byte("online"), Retain: true}); err != nil {
+		return err
+	}
+	log.Printf("[MQTT] Connected to %s, publishing to %s", cfg.Broker, base)
+
+	ticker := time.NewTicker(mqttStateInterval)
+	defer ticker.Stop()
+	var last mqttState
+	var lastPublished time.Time
+	for {
+		state := h.state()
+		// The position changes all the time, so it alone only republishes
+		// now and then
+		moved := state.State == string(audio.StatePlaying) && time.Since(lastPublished) >= mqttPositionInterval
+		withoutPosition := state
+		withoutPosition.Position = last.Position
+		if lastPublished.IsZero() || withoutPosition != last || moved {
+			payload, _ := json.Marshal(state)
+			if err := client.Publish(mqtt.Message{Topic: base + "/state", Payload: payload, Retain: true}); err != nil {
+				return err
+			}
+			last, lastPublished = state, time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			client.Publish(mqtt.Message{Topic: availability, Payload: []byte("offline"), Retain: true})
+			return nil
+		case <-client.Done():
+			return client.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// state returns the player's state as published
+func (h *homeAutomation) state() mqttState {
+	status := h.player.Status()
+	index, size := h.queueMgr.Position()
+	state := mqttState{
+		State:     string(status.State),
+		Path:      status.Path,
+		Duration:  status.Duration,
+		Position:  status.Position,
+		Volume:    int(math.Round(status.Volume * 100)),
+		QueueSize: size,
+	}
+	if size > 0 {
+		state.QueuePosition = index + 1
+	}
+	if meta := status.Metadata; meta != nil {
+		state.Title, state.Artist, state.Album = meta.Title, meta.Artist, meta.Album
+	}
+	if status.StreamTitle != "" {
+		state.Title = status.StreamTitle
+	}
+	return state
+}
+
+// handle runs a command published to one of the command topics
+func (h *homeAutomation) handle(base string, msg mqtt.Message) {
+	// A retained command would replay on every reconnect
+	if msg.Retain {
+		return
+	}
+	payload := strings.TrimSpace(string(msg.Payload))
+
+	var err error
+	switch msg.Topic {
+	case base + "/command":
+		switch strings.ToLower(payload) {
+		case "play":
+			err = h.player.OnCommand(media.CmdPlay, nil)
+		case "pause":
+			err = h.player.OnCommand(media.CmdPause, nil)
+		case "toggle", "play_pause":
+			err = h.player.OnCommand(media.CmdPlayPause, nil)
+		case "stop":
+			err = h.player.OnCommand(media.CmdStop, nil)
+		case "next":
+			err = h.player.OnCommand(media.CmdNext, nil)
+		case "previous":
+			err = h.player.OnCommand(media.CmdPrevious, nil)
+		default:
+			log.Printf("[MQTT] Ignoring unknown command %q", payload)
+			return
+		}
+	case base + "/volume/set":
+		level, parseErr := strconv.ParseFloat(payload, 64)
+		if parseErr != nil || math.IsNaN(level) || level < 0 || level > 100 {
+			log.Printf("[MQTT] Ignoring invalid volume %q", payload)
+			return
+		}
+		err = h.player.OnCommand(media.CmdSetVolume, level/100)
+	}
+	if err != nil {
+		log.Printf("[MQTT] Failed to handle %s %q: %v", msg.Topic, payload, err)
+	}
+}
+
+// discoveryMessages returns the retained Home Assistant discovery configs
+// for the player's entities: sensors for the state, track and queue
+// position, a volume slider and transport buttons
+func discoveryMessages(prefix, node, base string) []mqtt.Message {
+	device := map[string]interface{}{
+		"identifiers":  []string{"musicd_" + node},
+		"name":         "musicd " + node,
+		"manufacturer": "musicd",
+		"model":        "musicd",
+		"sw_version":   Version,
+	}
+	entity := func(component, object, name string, fields map[string]interface{}) mqtt.Message {
+		config := map[string]interface{}{
+			"name":               name,
+			"unique_id":          "musicd_" + node + "_" + object,
+			"object_id":          "musicd_" + node + "_" + object,
+			"availability_topic": base + "/availability",
+			"device":             device,
+		}
+		for k, v := range fields {
+			config[k] = v
+		}
+		payload, _ := json.Marshal(config)
+		return mqtt.Message{
+			Topic:   fmt.Sprintf("%s/%s/musicd_%s/%s/config", prefix, component, node, object),
+			Payload: payload,
+			Retain:  true,
+		}
+	}
+	sensor := func(object, name, icon, template string) mqtt.Message {
+		return entity("sensor", object, name, map[string]interface{}{
+			"state_topic":    base + "/state",
+			"value_template": template,
+			"icon":           icon,
+		})
+	}
+	button := func(command, name, icon string) mqtt.Message {
+		return entity("button", command, name, map[string]interface{}{
+			"command_topic": base + "/command",
+			"payload_press": command,
+			"icon":          icon,
+		})
+	}
+
+	return []mqtt.Message{
+		sensor("state", "State", "mdi:music", "{{ value_json.state }}"),
+		sensor("title", "Title", "mdi:music-note", "{{ value_json.title }}"),
+		sensor("artist", "Artist", "mdi:account-music", "{{ value_json.artist }}"),
+		sensor("album", "Album", "mdi:album", "{{ value_json.album }}"),
+		sensor("queue_position", "Queue position", "mdi:playlist-music", "{{ value_json.queuePosition }}"),
+		entity("number", "volume", "Volume", map[string]interface{}{
+			"state_topic":         base + "/state",
+			"value_template":      "{{ value_json.volume }}",
+			"command_topic":       base + "/volume/set",
+			"min":                 0,
+			"max":                 100,
+			"step":                1,
+			"unit_of_measurement": "%",
+			"icon":                "mdi:volume-high",
+		}),
+		button("play", "Play", "mdi:play"),
+		button("pause", "Pause", "mdi:pause"),
+		button("toggle", "Play/Pause", "mdi:play-pause"),
+		button("next", "Next", "mdi:skip-next"),
+		button("previous", "Previous", "mdi:skip-previous"),
+	}
+}
+
+// hostNodeID returns the host name as a node ID, with characters topics
+// and entity IDs can't hold replaced
+func hostNodeID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "musicd"
+	}
+	host, _, _ = strings.Cut(host, ".")
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, host)
+}
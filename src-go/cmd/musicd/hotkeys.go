@@ -0,0 +1,112 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+	"github.com/austinkregel/local-media/musicd/internal/hotkey"
+	"github.com/austinkregel/local-media/musicd/internal/media"
+)
+
+// hotkeyVolumeStep is how much the volume hotkeys change the volume by
+const hotkeyVolumeStep = 0.05
+
+// hotkeys runs the global hotkey listener while the config enables it.
+// Hotkeys act like the OS media controls.
+type hotkeys struct {
+	player *audio.Player
+
+	wantMu sync.Mutex
+	want   config.HotkeysConfig // Latest settings, applied in the background
+
+	mu       sync.Mutex
+	current  config.HotkeysConfig
+	listener hotkey.Listener
+}
+
+// set applies new hotkey settings in the background, as binding them can
+// wait on the user confirming them in a desktop dialog
+func (h *hotkeys) set(cfg config.HotkeysConfig) {
+	h.wantMu.Lock()
+	h.want = cfg
+	h.wantMu.Unlock()
+	go h.sync()
+}
+
+// active reports whether the config turns hotkeys on. It doesn't wait for
+// them to be bound.
+func (h *hotkeys) active() bool {
+	h.wantMu.Lock()
+	defer h.wantMu.Unlock()
+	return h.want.Enabled
+}
+
+func (h *hotkeys) sync() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.wantMu.Lock()
+	cfg := h.want
+	h.wantMu.Unlock()
+	if cfg == h.current {
+		return
+	}
+	h.current = cfg
+
+	if h.listener != nil {
+		h.listener.Close()
+		h.listener = nil
+	}
+	if !cfg.Enabled {
+		return
+	}
+
+	var bindings []hotkey.Binding
+	for action, combo := range cfg.Bindings() {
+		parsed, err := hotkey.ParseCombo(combo)
+		if err != nil {
+			continue // Unbound when the config was loaded
+		}
+		bindings = append(bindings, hotkey.Binding{Action: action, Combo: parsed})
+	}
+	listener, err := hotkey.Listen(bindings, h.handle)
+	if err != nil {
+		log.Printf("[HOTKEY] Warning: global hotkeys unavailable: %v", err)
+		return
+	}
+	h.listener = listener
+	log.Printf("[HOTKEY] Listening for %d global hotkeys", len(bindings))
+}
+
+func (h *hotkeys) handle(action hotkey.Action) {
+	var err error
+	switch action {
+	case hotkey.ActionPlayPause:
+		err = h.player.OnCommand(media.CmdPlayPause, nil)
+	case hotkey.ActionNext:
+		err = h.player.OnCommand(media.CmdNext, nil)
+	case hotkey.ActionPrevious:
+		err = h.player.OnCommand(media.CmdPrevious, nil)
+	case hotkey.ActionVolumeUp, hotkey.ActionVolumeDown:
+		step := hotkeyVolumeStep
+		if action == hotkey.ActionVolumeDown {
+			step = -step
+		}
+		volume := min(max(h.player.Status().Volume+step, 0), 1)
+		err = h.player.OnCommand(media.CmdSetVolume, volume)
+	}
+	if err != nil {
+		log.Printf("[HOTKEY] Failed to handle %s: %v", action, err)
+	}
+}
+
+// Close stops listening
+func (h *hotkeys) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.listener != nil {
+		h.listener.Close()
+		h.listener = nil
+	}
+}
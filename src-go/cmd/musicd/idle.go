@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+)
+
+// idleCheckInterval is how often the daemon checks whether it is idle
+const idleCheckInterval = 30 * time.Second
+
+// watchIdle calls exit once idle has reported true for the configured idle
+// timeout. The timeout is read on every check, so changes to it apply
+// without a restart.
+func watchIdle(ctx context.Context, clock audio.Clock, idle func() bool, configMgr *config.Manager, exit func()) {
+	ticker := clock.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	var idleSince time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C():
+			timeout := time.Duration(configMgr.Get().Behavior.IdleTimeoutMinutes) * time.Minute
+			if timeout == 0 || !idle() {
+				idleSince = time.Time{}
+				continue
+			}
+			if idleSince.IsZero() {
+				idleSince = now
+			}
+			if now.Sub(idleSince) >= timeout {
+				log.Printf("Idle for %v, exiting", timeout)
+				exit()
+				return
+			}
+		}
+	}
+}
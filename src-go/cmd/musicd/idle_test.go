@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+)
+
+func newIdleConfig(t *testing.T, timeoutMinutes int) *config.Manager {
+	t.Helper()
+	configMgr := config.NewManager(t.TempDir())
+	cfg := config.DefaultConfig()
+	cfg.Behavior.IdleTimeoutMinutes = timeoutMinutes
+	if err := configMgr.Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return configMgr
+}
+
+// startIdleWatch runs watchIdle on a manual clock, returning the clock and
+// a channel closed when it exits the daemon
+func startIdleWatch(t *testing.T, idle func() bool, configMgr *config.Manager) (*audio.ManualClock, chan struct{}) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	clock := audio.NewManualClock(time.Now())
+	exited := make(chan struct{})
+	go watchIdle(ctx, clock, idle, configMgr, func() { close(exited) })
+	if err := clock.WaitFor(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	return clock, exited
+}
+
+func hasExited(exited chan struct{}) bool {
+	select {
+	case <-exited:
+		return true
+	case <-time.After(50 * time.Millisecond):
+		return false
+	}
+}
+
+// idleAnswers answers watchIdle's checks one at a time, so a test knows
+// which check saw which answer
+type idleAnswers chan bool
+
+func (a idleAnswers) idle() bool { return <-a }
+
+// check advances the clock to the next check and answers it
+func (a idleAnswers) check(clock *audio.ManualClock, idle bool) {
+	go clock.Advance(idleCheckInterval)
+	a <- idle
+}
+
+func TestWatchIdleExitsAfterTimeout(t *testing.T) {
+	answers := make(idleAnswers)
+	clock, exited := startIdleWatch(t, answers.idle, newIdleConfig(t, 1))
+
+	// Idle is first seen at the first check, a minute must pass from there
+	answers.check(clock, true)
+	answers.check(clock, true)
+	if hasExited(exited) {
+		t.Fatal("Expected the daemon kept running before the timeout")
+	}
+	answers.check(clock, true)
+	if !hasExited(exited) {
+		t.Error("Expected the daemon exited once idle for the timeout")
+	}
+}
+
+func TestWatchIdleRestartsWhenBusy(t *testing.T) {
+	answers := make(idleAnswers)
+	clock, exited := startIdleWatch(t, answers.idle, newIdleConfig(t, 1))
+
+	answers.check(clock, true)
+	answers.check(clock, true)
+
+	// Activity in between starts the wait over
+	answers.check(clock, false)
+	answers.check(clock, true)
+	answers.check(clock, true)
+	if hasExited(exited) {
+		t.Fatal("Expected the wait started over after activity")
+	}
+	answers.check(clock, true)
+	if !hasExited(exited) {
+		t.Error("Expected the daemon exited a minute after activity stopped")
+	}
+}
+
+func TestWatchIdleDisabled(t *testing.T) {
+	clock, exited := startIdleWatch(t, func() bool { return true }, newIdleConfig(t, 0))
+
+	clock.Advance(time.Hour)
+	if hasExited(exited) {
+		t.Error("Expected no exit with an idle timeout of 0")
+	}
+}
+
+func TestHotkeysAndHomeAutomationKeepDaemonRunning(t *testing.T) {
+	keys := &hotkeys{}
+	if keys.active() {
+		t.Error("Expected hotkeys inactive before being turned on")
+	}
+	keys.wantMu.Lock()
+	keys.want = config.HotkeysConfig{Enabled: true}
+	keys.wantMu.Unlock()
+	if !keys.active() {
+		t.Error("Expected hotkeys active once turned on")
+	}
+
+	// An unreachable broker is still retried, so the daemon stays up for it
+	home := &homeAutomation{ctx: context.Background()}
+	if home.active() {
+		t.Error("Expected home automation inactive before being turned on")
+	}
+	home.set(config.MQTTConfig{Enabled: true, Broker: "127.0.0.1:1", TopicPrefix: "musicd", NodeID: "test"})
+	if !home.active() {
+		t.Error("Expected home automation active while the broker is retried")
+	}
+	home.Close()
+	if home.active() {
+		t.Error("Expected home automation inactive once closed")
+	}
+}
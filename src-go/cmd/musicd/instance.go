@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/filelock"
+)
+
+const (
+	// takeoverTimeout is how long --replace waits for the old instance to exit
+	takeoverTimeout = 10 * time.Second
+
+	// takeoverPollInterval is how often the lock is retried during a takeover
+	takeoverPollInterval = 100 * time.Millisecond
+)
+
+// alreadyRunningError reports that another daemon owns the socket
+type alreadyRunningError struct {
+	pid int
+}
+
+func (e *alreadyRunningError) Error() string {
+	if e.pid > 0 {
+		return fmt.Sprintf("musicd is already running (pid %d)", e.pid)
+	}
+	return "musicd is already running"
+}
+
+// instanceLockPath returns the lock file for the daemon on socketPath. It is
+// named after the socket, so daemons on different sockets can run side by
+// side.
+func instanceLockPath(configDir, socketPath string) string {
+	h := fnv.New64a()
+	h.Write([]byte(filepath.Clean(socketPath)))
+	return filepath.Join(configDir, fmt.Sprintf("instance-%016x.lock", h.Sum64()))
+}
+
+// instanceLock is an exclusive lock on the file from instanceLockPath held
+// for the lifetime of the daemon. The file contains the owner's PID so a
+// second instance can ask it to hand over.
+type instanceLock struct {
+	file *os.File
+}
+
+// acquireInstanceLock takes the single-instance lock. If another daemon holds
+// it and replace is set, that daemon is asked to hand off its state and exit.
+// tookOver reports whether an old instance was replaced.
+func acquireInstanceLock(path string, replace bool) (lock *instanceLock, tookOver bool, err error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	err = filelock.TryLock(file)
+	if errors.Is(err, filelock.ErrLocked) {
+		pid := readLockPID(file)
+		if !replace {
+			file.Close()
+			return nil, false, &alreadyRunningError{pid: pid}
+		}
+
+		log.Printf("Replacing running instance (pid %d)", pid)
+		if err := requestHandoff(pid); err != nil {
+			file.Close()
+			return nil, false, fmt.Errorf("failed to signal running instance: %w", err)
+		}
+		err = waitForLock(file)
+		tookOver = err == nil
+	}
+	if err != nil {
+		file.Close()
+		return nil, false, err
+	}
+
+	if err := writeLockPID(file); err != nil {
+		file.Close()
+		return nil, false, err
+	}
+
+	return &instanceLock{file: file}, tookOver, nil
+}
+
+// Release drops the lock. The lock file itself is left in place; removing it
+// would let a racing instance lock a file that is about to disappear.
+func (l *instanceLock) Release() {
+	l.file.Truncate(0)
+	l.file.Close()
+}
+
+// waitForLock retries the lock until the old instance has exited
+func waitForLock(file *os.File) error {
+	deadline := time.Now().Add(takeoverTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(takeoverPollInterval)
+		err := filelock.TryLock(file)
+		if !errors.Is(err, filelock.ErrLocked) {
+			return err
+		}
+	}
+	return fmt.Errorf("running instance did not exit within %v", takeoverTimeout)
+}
+
+func readLockPID(file *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := file.ReadAt(buf, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+func writeLockPID(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return nil
+}
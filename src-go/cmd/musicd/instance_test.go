@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstanceLockIsExclusive(t *testing.T) {
+	path := instanceLockPath(t.TempDir(), "/tmp/musicd-test.sock")
+
+	lock, tookOver, err := acquireInstanceLock(path, false)
+	if err != nil || tookOver {
+		t.Fatalf("Expected the lock, got %v (took over: %v)", err, tookOver)
+	}
+
+	var running *alreadyRunningError
+	if _, _, err := acquireInstanceLock(path, false); !errors.As(err, &running) || running.pid != os.Getpid() {
+		t.Fatalf("Expected the second instance told our pid is running, got %v", err)
+	}
+
+	lock.Release()
+	lock, _, err = acquireInstanceLock(path, false)
+	if err != nil {
+		t.Fatalf("Expected the lock once released, got %v", err)
+	}
+	lock.Release()
+}
+
+func TestInstanceLockPath(t *testing.T) {
+	dir := t.TempDir()
+	a := instanceLockPath(dir, "/tmp/musicd-1000.sock")
+	if filepath.Dir(a) != dir {
+		t.Errorf("Expected the lock in the config directory, got %s", a)
+	}
+	if a != instanceLockPath(dir, "/tmp/./musicd-1000.sock") {
+		t.Error("Expected the same socket to give the same lock")
+	}
+	if a == instanceLockPath(dir, "/tmp/musicd-other.sock") {
+		t.Error("Expected daemons on other sockets to get their own lock")
+	}
+}
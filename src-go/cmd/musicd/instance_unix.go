@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// handoffSignals ask a running daemon to save its state for a successor and exit
+var handoffSignals = []os.Signal{syscall.SIGUSR1}
+
+func requestHandoff(pid int) error {
+	if pid <= 0 {
+		return errors.New("lock file does not contain a PID")
+	}
+	return syscall.Kill(pid, syscall.SIGUSR1)
+}
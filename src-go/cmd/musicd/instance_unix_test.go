@@ -0,0 +1,80 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// lockHolderEnv names the lock file TestLockHolderProcess holds
+const lockHolderEnv = "MUSICD_TEST_LOCK_HOLDER"
+
+// TestLockHolderProcess stands in for a running daemon when the test binary
+// is started again by TestReplaceTakesOver. It holds the lock until asked to
+// hand off.
+func TestLockHolderProcess(t *testing.T) {
+	path := os.Getenv(lockHolderEnv)
+	if path == "" {
+		t.Skip("Only run as a helper process")
+	}
+	handoff := make(chan os.Signal, 1)
+	signal.Notify(handoff, handoffSignals...)
+	lock, _, err := acquireInstanceLock(path, false)
+	if err != nil {
+		os.Exit(2)
+	}
+	os.Stdout.WriteString("locked\n")
+	<-handoff
+	lock.Release()
+	os.Exit(0)
+}
+
+func TestReplaceTakesOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instance.lock")
+	holder := exec.Command(os.Args[0], "-test.run=^TestLockHolderProcess$")
+	holder.Env = append(os.Environ(), lockHolderEnv+"="+path)
+	stdout, err := holder.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Process.Kill()
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "locked\n" {
+		t.Fatalf("Helper didn't take the lock: %q, %v", line, err)
+	}
+
+	var running *alreadyRunningError
+	if _, _, err := acquireInstanceLock(path, false); !errors.As(err, &running) || running.pid != holder.Process.Pid {
+		t.Fatalf("Expected the helper reported running, got %v", err)
+	}
+
+	lock, tookOver, err := acquireInstanceLock(path, true)
+	if err != nil || !tookOver {
+		t.Fatalf("Expected to take over from the helper, got %v (took over: %v)", err, tookOver)
+	}
+	defer lock.Release()
+
+	exited := make(chan error, 1)
+	go func() { exited <- holder.Wait() }()
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Errorf("Expected the helper to exit cleanly on %v, got %v", syscall.SIGUSR1, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Helper didn't exit after handing off")
+	}
+	if pid := readLockPID(lock.file); pid != os.Getpid() {
+		t.Errorf("Expected our pid in the lock file, got %d", pid)
+	}
+}
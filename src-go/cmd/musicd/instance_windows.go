@@ -0,0 +1,15 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// handoffSignals is empty: Windows has no signal to request a handoff
+var handoffSignals []os.Signal
+
+func requestHandoff(pid int) error {
+	return errors.New("--replace is not supported on Windows; stop the running instance first")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+	"github.com/austinkregel/local-media/musicd/internal/ipc"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+// loadState restores a snapshot written by dumpState, for reproducing a bug
+// report: its config, its queue, and playback where it was. Credentials the
+// snapshot leaves out keep their current values. The config is saved, so
+// this is best run with --config pointing at a scratch directory. Returns
+// false if the snapshot couldn't be read.
+func loadState(ctx context.Context, path string, configMgr *config.Manager, player *audio.Player, queueMgr *queue.Manager, queueStore *queue.Store) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("[QUEUE] Warning: failed to read state snapshot: %v", err)
+		return false
+	}
+	// Settings missing from the snapshot take their defaults
+	state := ipc.DumpStateResponse{Config: config.DefaultConfig()}
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("[QUEUE] Warning: failed to parse state snapshot: %v", err)
+		return false
+	}
+
+	if state.Config != nil {
+		current := configMgr.Get()
+		if state.Config.Identify.AcoustIDKey == "" {
+			state.Config.Identify.AcoustIDKey = current.Identify.AcoustIDKey
+		}
+		if state.Config.MQTT.Password == "" {
+			state.Config.MQTT.Password = current.MQTT.Password
+		}
+		if err := configMgr.Update(state.Config); err != nil {
+			log.Printf("[CONFIG] Warning: keeping the current config, the snapshot's is invalid: %v", err)
+		}
+	}
+
+	queueStore.Restore(state.Queue)
+	idx, size := queueMgr.Position()
+	log.Printf("[QUEUE] Loaded state snapshot from %s: %d items, position %d", path, size, idx)
+
+	if err := player.SetVolume(state.Status.Volume); err != nil {
+		log.Printf("[AUDIO] Warning: failed to apply the snapshot's volume: %v", err)
+	}
+	mode := "paused"
+	if state.Queue.Playing {
+		mode = "playing"
+	}
+	resumeLastSession(ctx, player, queueMgr, queueStore, mode)
+	return true
+}
@@ -5,19 +5,34 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
 	"syscall"
+	"time"
 
 	"github.com/austinkregel/local-media/musicd/internal/audio"
 	"github.com/austinkregel/local-media/musicd/internal/auth"
+	"github.com/austinkregel/local-media/musicd/internal/cache"
 	"github.com/austinkregel/local-media/musicd/internal/config"
 	"github.com/austinkregel/local-media/musicd/internal/ipc"
+	"github.com/austinkregel/local-media/musicd/internal/library"
+	"github.com/austinkregel/local-media/musicd/internal/logging"
+	"github.com/austinkregel/local-media/musicd/internal/loudness"
 	"github.com/austinkregel/local-media/musicd/internal/media"
+	"github.com/austinkregel/local-media/musicd/internal/metrics"
+	"github.com/austinkregel/local-media/musicd/internal/overlay"
+	"github.com/austinkregel/local-media/musicd/internal/podcast"
 	"github.com/austinkregel/local-media/musicd/internal/queue"
+	"github.com/austinkregel/local-media/musicd/internal/transcode"
 )
 
 // Version is set at build time via ldflags
@@ -29,31 +44,88 @@ type Config struct {
 	ConfigDir  string
 	TestMode   bool
 	Verbose    bool
+	Replace    bool
+	LoadState  string
+
+	// Simulated playback for headless integration tests
+	Simulate       bool
+	SimTrackLength time.Duration
 }
 
 func main() {
+	// Subcommands that talk to or set up for a running daemon
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "open":
+			if err := runOpen(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "musicd open: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "register-scheme":
+			if err := runRegisterScheme(); err != nil {
+				fmt.Fprintf(os.Stderr, "musicd register-scheme: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	cfg := parseFlags()
+	os.Exit(runDaemon(cfg))
+}
 
+// runDaemon runs the daemon until it is stopped and returns the exit code.
+// Exiting is left to the caller so that the deferred cleanup here, such as
+// releasing the instance lock, always runs.
+func runDaemon(cfg *Config) int {
 	if cfg.Verbose {
 		log.Printf("musicd version %s starting...", Version)
 	}
 
+	// Only one daemon may own a socket; a second one either exits or, with
+	// --replace, takes over from the running instance. The lock is kept in
+	// the config directory rather than beside the socket, which may be in
+	// a world-writable /tmp.
+	if err := os.MkdirAll(cfg.ConfigDir, 0700); err != nil {
+		log.Printf("Failed to create config directory: %v", err)
+		return 1
+	}
+	lock, tookOver, err := acquireInstanceLock(instanceLockPath(cfg.ConfigDir, cfg.SocketPath), cfg.Replace)
+	if err != nil {
+		var running *alreadyRunningError
+		if errors.As(err, &running) {
+			log.Printf("%v on %s; use --replace to take over", err, cfg.SocketPath)
+			return 0
+		}
+		log.Printf("Failed to acquire instance lock: %v", err)
+		return 1
+	}
+	defer lock.Release()
+
 	// Create context that cancels on interrupt signals
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Handle shutdown signals
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM}, handoffSignals...)...)
 	go func() {
 		sig := <-sigChan
-		log.Printf("Received signal %v, shutting down...", sig)
+		if sig != syscall.SIGINT && sig != syscall.SIGTERM {
+			log.Printf("Received signal %v, handing off to new instance...", sig)
+			handoffRequested.Store(true)
+		} else {
+			log.Printf("Received signal %v, shutting down...", sig)
+		}
 		cancel()
 	}()
 
-	if err := run(ctx, cfg); err != nil {
-		log.Fatalf("Fatal error: %v", err)
+	if err := run(ctx, cfg, tookOver); err != nil {
+		log.Printf("Fatal error: %v", err)
+		return 1
 	}
+	return 0
 }
 
 func parseFlags() *Config {
@@ -63,25 +135,55 @@ func parseFlags() *Config {
 	flag.StringVar(&cfg.ConfigDir, "config", "", "Configuration directory (default: ~/.config/musicd)")
 	flag.BoolVar(&cfg.TestMode, "test-mode", false, "Run in test mode (auto-approve pairing)")
 	flag.BoolVar(&cfg.Verbose, "verbose", false, "Enable verbose logging")
+	flag.BoolVar(&cfg.Replace, "replace", false, "Take over from an already running instance, keeping its queue")
+	flag.StringVar(&cfg.LoadState, "load-state", "", "Restore a dumpState snapshot at startup, to reproduce a bug report (saves its config)")
+	flag.BoolVar(&cfg.Simulate, "simulate", false, "Test mode with simulated tracks and no audio device; playback time only passes on advanceClock (implies --test-mode)")
+	flag.DurationVar(&cfg.SimTrackLength, "sim-track-length", audio.DefaultSimTrackLength, "How long simulated tracks are, with --simulate")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println(Version)
+		os.Exit(0)
+	}
+
+	if cfg.Simulate {
+		cfg.TestMode = true
+	}
+
 	// Set defaults
 	if cfg.ConfigDir == "" {
-		homeDir, err := os.UserHomeDir()
+		configDir, err := defaultConfigDir()
 		if err != nil {
 			log.Fatalf("Failed to get home directory: %v", err)
 		}
-		cfg.ConfigDir = homeDir + "/.config/musicd"
+		cfg.ConfigDir = configDir
 	}
 
 	if cfg.SocketPath == "" {
-		cfg.SocketPath = fmt.Sprintf("/tmp/musicd-%d.sock", os.Getuid())
+		cfg.SocketPath = defaultSocketPath()
 	}
 
 	return cfg
 }
 
-func run(ctx context.Context, cfg *Config) error {
+func defaultConfigDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return homeDir + "/.config/musicd", nil
+}
+
+func defaultSocketPath() string {
+	return fmt.Sprintf("/tmp/musicd-%d.sock", os.Getuid())
+}
+
+func run(ctx context.Context, cfg *Config, tookOver bool) error {
+	// Cancelled early when the daemon exits for being idle
+	ctx, exitIdle := context.WithCancel(ctx)
+	defer exitIdle()
+
 	// Ensure config directory exists
 	if err := os.MkdirAll(cfg.ConfigDir, 0700); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
@@ -93,6 +195,25 @@ func run(ctx context.Context, cfg *Config) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	applyMemoryBudget(configMgr.Get().Memory)
+
+	// Structured logs go to ConfigDir/logs and are kept for IPC clients
+	logCfg := configMgr.Get().Logging
+	if cfg.Verbose {
+		logCfg.Level = "debug"
+	}
+	logger, err := logging.Setup(filepath.Join(cfg.ConfigDir, "logs"), logging.Options{
+		Level:     logCfg.Level,
+		MaxSizeMB: logCfg.MaxSizeMB,
+		MaxFiles:  logCfg.MaxFiles,
+		Stderr:    os.Stderr,
+	})
+	if err != nil {
+		log.Printf("Warning: failed to set up log files, logging to stderr only: %v", err)
+	} else {
+		defer logger.Close()
+	}
+
 	// Initialize components
 	authStore, err := auth.NewStore(cfg.ConfigDir + "/clients.json")
 	if err != nil {
@@ -100,24 +221,48 @@ func run(ctx context.Context, cfg *Config) error {
 	}
 
 	authManager := auth.NewManager(authStore, cfg.TestMode)
+	authManager.SetTokenTTL(time.Duration(configMgr.Get().Auth.TokenTTLHours) * time.Hour)
 
-	// Initialize media session (platform-specific)
-	mediaSession, err := media.NewSession()
-	if err != nil {
+	// Local admin token for managing client approvals without pairing
+	if err := authManager.CreateAdminToken(cfg.ConfigDir + "/admin.token"); err != nil {
+		log.Printf("[AUTH] Warning: failed to create admin token: %v", err)
+	}
+
+	// Initialize media session (platform-specific). It reconnects on its
+	// own if the OS side drops, e.g. when the D-Bus session restarts.
+	mediaSession := media.NewResilientSession(media.NewSession)
+	defer mediaSession.Close()
+	if available, err := mediaSession.Available(); !available {
 		log.Printf("[MEDIA] Warning: failed to initialize media session: %v", err)
 		log.Printf("[MEDIA] Continuing without OS media integration")
-		// Continue without media session - not fatal
-		mediaSession = media.NewNoOpSession()
 	} else {
 		log.Printf("[MEDIA] Media session initialized successfully")
 	}
 
-	// Initialize audio player
-	player, err := audio.NewPlayer(mediaSession)
+	daemonCfg := configMgr.Get()
+
+	// Initialize audio player. A simulated one plays sine sweeps to nowhere,
+	// timed by a clock that clients move with advanceClock.
+	var player *audio.Player
+	var simClock *audio.ManualClock
+	if cfg.Simulate {
+		simClock = audio.NewManualClock(time.Now())
+		player, err = audio.NewSimulatedPlayer(mediaSession, audio.NewSimDecoder(cfg.SimTrackLength), simClock)
+		log.Printf("[AUDIO] Simulating playback: tracks are %v long, time passes on advanceClock", cfg.SimTrackLength)
+	} else {
+		player, err = audio.NewPlayerWithConfig(mediaSession, audio.OutputConfig{
+			SampleRate: daemonCfg.Audio.SampleRate,
+			BitDepth:   daemonCfg.Audio.BitDepth,
+			Resampler:  daemonCfg.Audio.Resampler,
+		})
+	}
 	if err != nil {
 		return fmt.Errorf("failed to initialize audio player: %w", err)
 	}
 	defer player.Close()
+	outputFormat := player.OutputFormat()
+	log.Printf("[AUDIO] Output opened at %d Hz, %d-bit, %d channels (%s resampler)",
+		outputFormat.SampleRate, outputFormat.BitDepth, outputFormat.Channels, outputFormat.Resampler)
 
 	// Connect media session commands to the player
 	mediaSession.SetCommandHandler(player)
@@ -125,13 +270,77 @@ func run(ctx context.Context, cfg *Config) error {
 
 	// Initialize queue manager
 	queueMgr := queue.NewManager()
+	queueMgr.SetFairQueue(daemonCfg.Party.FairQueue)
 
-	// Initialize queue persistence if configured
-	daemonCfg := configMgr.Get()
-	var queueStore *queue.Store
-	if daemonCfg.Behavior.RememberQueue {
-		queueStore = queue.NewStore(cfg.ConfigDir, queueMgr)
+	if err := player.SetVolume(daemonCfg.Audio.DefaultVolume); err != nil {
+		log.Printf("[AUDIO] Warning: failed to apply default volume: %v", err)
+	}
+	player.SetFade(time.Duration(daemonCfg.Audio.FadeMs) * time.Millisecond)
+	player.SetStallTimeout(time.Duration(daemonCfg.Audio.StallTimeoutMs) * time.Millisecond)
+	player.SetTrackEndingLead(time.Duration(daemonCfg.Behavior.TrackEndingSeconds) * time.Second)
+	player.SetZones(outputZones(daemonCfg.Audio.Zones))
+	player.SetChannelMix(channelMix(daemonCfg.Audio))
+	player.SetVolumeCurve(daemonCfg.Audio.VolumeCurve)
+	if preview := player.Preview(); preview != nil {
+		if err := preview.SetVolume(daemonCfg.Audio.PreviewVolume); err != nil {
+			log.Printf("[AUDIO] Warning: failed to apply preview volume: %v", err)
+		}
+	}
+	if err := player.SetDSPChain(dspStages(daemonCfg.Audio.DSP)); err != nil {
+		log.Printf("[AUDIO] Warning: failed to apply DSP chain: %v", err)
+	}
 
+	// Per-track gain offsets, kept with the other per-track library data
+	trackGains := library.NewTrackGains(daemonCfg.DataPath())
+	if err := trackGains.Load(); err != nil {
+		log.Printf("[AUDIO] Warning: failed to load track gains: %v", err)
+	}
+
+	// Volume levelling. Tracks coming up in the queue are measured ahead of
+	// time so their gain is ready when they start.
+	leveler := loudness.New()
+	leveler.SetTarget(daemonCfg.Audio.LevelVolume, daemonCfg.Audio.TargetLufs)
+	leveler.SetOnMeasured(player.RefreshTrackGain)
+	go leveler.Run(ctx)
+	player.SetGainProvider(func(path string) float64 {
+		return trackGains.Get(path) + leveler.Gain(path)
+	})
+
+	// Bookmarks within tracks
+	bookmarkStore := queue.NewBookmarkStore(cfg.ConfigDir)
+	if err := bookmarkStore.Load(); err != nil {
+		log.Printf("[QUEUE] Warning: failed to load bookmarks: %v", err)
+	}
+
+	// Play counts for smart shuffle
+	playCounts := queue.NewPlayCountStore(cfg.ConfigDir)
+	if err := playCounts.Load(); err != nil {
+		log.Printf("[QUEUE] Warning: failed to load play counts: %v", err)
+	}
+
+	// Buffering and local copies for tracks on network shares
+	player.SetNetworkBuffering(
+		time.Duration(daemonCfg.Network.PreBufferMs)*time.Millisecond,
+		time.Duration(daemonCfg.Network.ReadAheadMs)*time.Millisecond,
+	)
+	trackCache, err := cache.New(cache.DefaultDir(), int64(daemonCfg.Network.CacheMaxMB)<<20)
+	if err != nil {
+		log.Printf("[AUDIO] Warning: track cache unavailable: %v", err)
+	} else {
+		defer trackCache.Clear()
+		player.SetSourceResolver(trackCache.Resolve)
+	}
+
+	// Conversions of tracks for renderers on slow links, kept across restarts
+	transcoder, err := transcode.New(transcode.DefaultDir(), int64(daemonCfg.Transcode.CacheMaxMB)<<20)
+	if err != nil {
+		log.Printf("[RENDER] Warning: transcoding unavailable: %v", err)
+	}
+
+	// Queue persistence. The store always exists so rememberQueue can be
+	// switched on and off while the daemon runs.
+	queueStore := queue.NewStore(cfg.ConfigDir, queueMgr)
+	if daemonCfg.Behavior.RememberQueue {
 		// Load saved queue
 		if err := queueStore.Load(); err != nil {
 			log.Printf("[QUEUE] Warning: failed to load saved queue: %v", err)
@@ -141,43 +350,380 @@ func run(ctx context.Context, cfg *Config) error {
 				log.Printf("[QUEUE] Loaded saved queue: %d items, position %d", size, idx)
 			}
 		}
+	}
+
+	// Set up auto-save and loudness measuring on queue changes
+	queueMgr.SetOnChange(func() {
+		prefetchLevels(leveler, queueMgr)
+		if configMgr.Get().Behavior.RememberQueue {
+			queueStore.SaveSoon()
+		}
+	})
 
-		// Set up auto-save on queue changes
-		queueMgr.SetOnChange(func() {
-			if err := queueStore.Save(); err != nil {
-				log.Printf("[QUEUE] Warning: failed to save queue: %v", err)
-			}
-		})
+	// Initialize per-track position memory for long tracks
+	threshold := time.Duration(daemonCfg.Behavior.ResumeThresholdMinutes) * time.Minute
+	positionStore := queue.NewPositionStore(cfg.ConfigDir, threshold)
+	if err := positionStore.Load(); err != nil {
+		log.Printf("[QUEUE] Warning: failed to load saved positions: %v", err)
+	}
+
+	// Podcast subscriptions, refreshed in the background
+	podcastDir := filepath.Join(daemonCfg.DataPath(), "podcasts")
+	podcasts := podcast.NewManager(cfg.ConfigDir, podcastDir)
+	if err := podcasts.Load(); err != nil {
+		log.Printf("[PODCAST] Warning: failed to load podcasts: %v", err)
 	}
+	podcasts.SetRefreshInterval(time.Duration(daemonCfg.Podcasts.RefreshMinutes) * time.Minute)
+	go podcasts.Run(ctx)
+
+	// Episodes always resume where they were left, however long they are
+	player.SetResumeProvider(func(path string) int64 {
+		if pos, ok := podcasts.Position(path); ok {
+			return pos
+		}
+		if !configMgr.Get().Behavior.RememberPosition {
+			return 0
+		}
+		return positionStore.Get(path)
+	})
+
+	// Route position updates to whichever stores are enabled
+	player.SetOnPosition(func(path string, positionMs, durationMs int64) {
+		isEpisode := podcasts.SetPosition(path, positionMs, durationMs)
+		behavior := configMgr.Get().Behavior
+		if behavior.RememberPosition && !isEpisode {
+			positionStore.Set(path, positionMs, durationMs)
+		}
+		if behavior.RememberQueue {
+			queueStore.SetPosition(path, positionMs)
+		}
+	})
 
 	// Initialize IPC server
 	server, err := ipc.NewServer(cfg.SocketPath, authManager, configMgr, player, queueMgr, mediaSession)
 	if err != nil {
 		return fmt.Errorf("failed to initialize IPC server: %w", err)
 	}
+	if logger != nil {
+		server.SetLogger(logger)
+	}
+	mediaSession.OnStatusChange(server.NotifyMediaSession)
+	if preview := player.Preview(); preview != nil {
+		preview.SetOnEnd(server.NotifyPreviewEnded)
+	}
+	if simClock != nil {
+		server.SetSimulationClock(simClock)
+	}
 
-	// Start the IPC server
-	log.Printf("Starting IPC server on %s", cfg.SocketPath)
-	if err := server.Start(ctx); err != nil {
-		// Save queue before exiting if persistence is enabled
-		if queueStore != nil {
-			if saveErr := queueStore.Save(); saveErr != nil {
-				log.Printf("[QUEUE] Warning: failed to save queue on shutdown: %v", saveErr)
-			} else {
-				log.Printf("[QUEUE] Queue saved on shutdown")
+	// Under socket activation the service manager keeps the socket open
+	// while the daemon is stopped, and starts it when a client connects
+	if listener, err := activationListener(); err != nil {
+		log.Printf("Warning: not using socket activation: %v", err)
+	} else if listener != nil {
+		server.SetListener(listener)
+	}
+	server.SetTrackGains(trackGains)
+	server.SetCacheBytes(int64(daemonCfg.Memory.CacheMB) << 20)
+	leveler.SetAnalyzed(server.TrackLoudness)
+	prefetchLevels(leveler, queueMgr)
+
+	// Focus sessions can level the volume while the setting is off
+	applyLevelling := func(audioCfg config.AudioConfig) {
+		leveler.SetTarget(audioCfg.LevelVolume || server.FocusLevelling(), audioCfg.TargetLufs)
+		prefetchLevels(leveler, queueMgr)
+		player.RefreshTrackGain(player.Status().Path)
+	}
+	server.SetOnFocusLevelling(func() { applyLevelling(configMgr.Get().Audio) })
+
+	// Intros set for a track or its album are skipped as it starts
+	player.SetIntroProvider(server.IntroSkip)
+
+	// Silence found by analysis is skipped while trimming is on
+	player.SetSilenceProvider(func(path string) (time.Duration, time.Duration) {
+		behavior := configMgr.Get().Behavior
+		if !behavior.TrimSilence {
+			return 0, 0
+		}
+		return server.TrackSilence(path, float64(behavior.SilenceThresholdDb))
+	})
+	server.SetBookmarkStore(bookmarkStore)
+	server.SetPlayCountStore(playCounts)
+	if trackCache != nil {
+		server.SetTrackCache(trackCache)
+	}
+	if transcoder != nil {
+		server.SetTranscoder(transcoder)
+	}
+	server.SetPodcasts(podcasts)
+	server.SetSandboxDirs(cache.DefaultDir(), transcode.DefaultDir(), podcastDir)
+	player.SetPathCheck(server.CheckOpen)
+	if daemonCfg.Auth.Sandbox {
+		log.Printf("[AUTH] Sandbox mode: files are limited to the library folders and caches, streams to %d allowed hosts", len(daemonCfg.Auth.StreamHosts))
+	}
+
+	// Global hotkeys for desktops where media keys don't reach the daemon
+	globalHotkeys := &hotkeys{player: player}
+	globalHotkeys.set(daemonCfg.Hotkeys)
+	defer globalHotkeys.Close()
+
+	// Player state for home automation, over MQTT
+	homeAssistant := &homeAutomation{ctx: ctx, player: player, queueMgr: queueMgr}
+	homeAssistant.set(daemonCfg.MQTT)
+	defer homeAssistant.Close()
+
+	// Now playing for stream overlays, as a file and an HTML page
+	go writeNowPlaying(ctx, player, configMgr)
+	if addr := daemonCfg.Overlay.ListenAddr; addr != "" {
+		handler := overlay.Handler(overlay.Source{
+			NowPlaying: func() overlay.NowPlaying { return nowPlaying(player) },
+			ArtPath:    func() string { return currentArt(player) },
+			Theme:      daemonCfg.Overlay.Theme,
+			CSSFile:    daemonCfg.Overlay.CSSFile,
+		})
+		go func() {
+			if err := overlay.Serve(ctx, addr, handler); err != nil {
+				log.Printf("[OVERLAY] Warning: overlay server stopped: %v", err)
+			}
+		}()
+	}
+
+	// Desktop notifications are posted while the setting is on, so the
+	// notifier is kept around even when it starts out off
+	if notifier, err := media.NewNotifier(); err != nil {
+		if daemonCfg.Notifications.EnabledOn(runtime.GOOS) {
+			log.Printf("[MEDIA] Warning: desktop notifications unavailable: %v", err)
+		}
+	} else {
+		defer notifier.Close()
+		server.SetNotifier(notifier)
+	}
+	server.AddRelocatable("positions", positionStore)
+	server.AddRelocatable("session", queueStore)
+
+	// Apply config changes from setConfig and from edits to the file on disk
+	configMgr.SetOnChange(func(old, new *config.Config) {
+		if new.Audio.DefaultVolume != old.Audio.DefaultVolume {
+			if err := player.SetVolume(new.Audio.DefaultVolume); err != nil {
+				log.Printf("[AUDIO] Warning: failed to apply default volume: %v", err)
+			}
+		}
+		if new.Audio.FadeMs != old.Audio.FadeMs {
+			player.SetFade(time.Duration(new.Audio.FadeMs) * time.Millisecond)
+		}
+		player.SetChannelMix(channelMix(new.Audio))
+		player.SetVolumeCurve(new.Audio.VolumeCurve)
+		if preview := player.Preview(); preview != nil && new.Audio.PreviewVolume != old.Audio.PreviewVolume {
+			if err := preview.SetVolume(new.Audio.PreviewVolume); err != nil {
+				log.Printf("[AUDIO] Warning: failed to apply preview volume: %v", err)
+			}
+		}
+		if new.Audio.LevelVolume != old.Audio.LevelVolume || new.Audio.TargetLufs != old.Audio.TargetLufs {
+			applyLevelling(new.Audio)
+		}
+		if !reflect.DeepEqual(new.Audio.Zones, old.Audio.Zones) {
+			player.SetZones(outputZones(new.Audio.Zones))
+		}
+		if !reflect.DeepEqual(new.Audio.DSP, old.Audio.DSP) {
+			if err := player.SetDSPChain(dspStages(new.Audio.DSP)); err != nil {
+				log.Printf("[CONFIG] Warning: failed to apply DSP chain: %v", err)
+			}
+		}
+		player.SetStallTimeout(time.Duration(new.Audio.StallTimeoutMs) * time.Millisecond)
+		player.SetTrackEndingLead(time.Duration(new.Behavior.TrackEndingSeconds) * time.Second)
+		if new.Audio.Resampler != old.Audio.Resampler {
+			if err := player.SetResampler(new.Audio.Resampler); err != nil {
+				log.Printf("[CONFIG] Warning: failed to apply resampler: %v", err)
 			}
 		}
-		return fmt.Errorf("IPC server error: %w", err)
+		if new.Audio.SampleRate != old.Audio.SampleRate || new.Audio.BitDepth != old.Audio.BitDepth ||
+			new.Audio.BufferSizeMs != old.Audio.BufferSizeMs {
+			log.Printf("[CONFIG] Audio output settings take effect after a restart")
+		}
+		if new.Memory != old.Memory {
+			applyMemoryBudget(new.Memory)
+			server.SetCacheBytes(int64(new.Memory.CacheMB) << 20)
+		}
+		if new.Hotkeys != old.Hotkeys {
+			globalHotkeys.set(new.Hotkeys)
+		}
+		if new.MQTT != old.MQTT {
+			homeAssistant.set(new.MQTT)
+		}
+		if new.Overlay.ListenAddr != old.Overlay.ListenAddr || new.Overlay.Theme != old.Overlay.Theme ||
+			new.Overlay.CSSFile != old.Overlay.CSSFile {
+			log.Printf("[CONFIG] Overlay server settings take effect after a restart")
+		}
+		podcasts.SetRefreshInterval(time.Duration(new.Podcasts.RefreshMinutes) * time.Minute)
+		positionStore.SetThreshold(time.Duration(new.Behavior.ResumeThresholdMinutes) * time.Minute)
+		queueMgr.SetFairQueue(new.Party.FairQueue)
+		player.SetNetworkBuffering(
+			time.Duration(new.Network.PreBufferMs)*time.Millisecond,
+			time.Duration(new.Network.ReadAheadMs)*time.Millisecond,
+		)
+		if trackCache != nil {
+			trackCache.SetMaxBytes(int64(new.Network.CacheMaxMB) << 20)
+		}
+		if transcoder != nil {
+			transcoder.SetMaxBytes(int64(new.Transcode.CacheMaxMB) << 20)
+		}
+		authManager.SetTokenTTL(time.Duration(new.Auth.TokenTTLHours) * time.Hour)
+		if logger != nil && !cfg.Verbose {
+			logger.SetLevel(new.Logging.Level)
+		}
+		server.NotifyConfigChanged()
+	})
+	go configMgr.Watch(ctx, config.DefaultWatchInterval)
+
+	resumed := tookOver && takeOverHandoff(ctx, cfg.ConfigDir, player, queueMgr)
+	if !resumed && cfg.LoadState != "" {
+		resumed = loadState(ctx, cfg.LoadState, configMgr, player, queueMgr, queueStore)
+	}
+	if !resumed && daemonCfg.Behavior.ResumeOnStart && daemonCfg.Behavior.RememberQueue {
+		resumeLastSession(ctx, player, queueMgr, queueStore, daemonCfg.Behavior.ResumePlayback)
+	}
+
+	// Pick up analysis interrupted by the last shutdown
+	server.ResumeAnalysisJob(ctx)
+
+	// Optional Prometheus endpoint for long-running installs
+	if addr := daemonCfg.Metrics.ListenAddr; addr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, addr); err != nil {
+				log.Printf("[METRICS] Warning: metrics endpoint stopped: %v", err)
+			}
+		}()
 	}
 
-	// Save queue on clean shutdown
-	if queueStore != nil {
-		if saveErr := queueStore.Save(); saveErr != nil {
+	// Hotkeys and home automation are answered by the daemon, so it has to
+	// keep running while they're turned on
+	daemonIdle := func() bool {
+		return server.Idle() && !globalHotkeys.active() && !homeAssistant.active()
+	}
+	go watchIdle(ctx, audio.SystemClock{}, daemonIdle, configMgr, exitIdle)
+	go watchOtherAudio(ctx, player, configMgr)
+	go watchOutputDevice(ctx, player, configMgr, server)
+
+	// Start the IPC server
+	log.Printf("Starting IPC server on %s", cfg.SocketPath)
+	serverErr := server.Start(ctx)
+
+	if handoffRequested.Load() {
+		writeHandoff(cfg.ConfigDir, player, queueMgr)
+	}
+
+	// Stop playback first so the final position of the current track is recorded
+	player.Stop()
+
+	// Save queue on shutdown if persistence is enabled
+	behavior := configMgr.Get().Behavior
+	if behavior.RememberQueue {
+		if saveErr := queueStore.Flush(); saveErr != nil {
 			log.Printf("[QUEUE] Warning: failed to save queue on shutdown: %v", saveErr)
 		} else {
 			log.Printf("[QUEUE] Queue saved on shutdown")
 		}
 	}
+	if behavior.RememberPosition {
+		if err := positionStore.Flush(); err != nil {
+			log.Printf("[QUEUE] Warning: failed to save positions on shutdown: %v", err)
+		}
+	}
+
+	if err := podcasts.Flush(); err != nil {
+		log.Printf("[PODCAST] Warning: failed to save podcasts on shutdown: %v", err)
+	}
+
+	if serverErr != nil {
+		return fmt.Errorf("IPC server error: %w", serverErr)
+	}
 
 	return nil
 }
+
+// applyMemoryBudget sets the garbage collector's soft memory limit
+func applyMemoryBudget(m config.MemoryConfig) {
+	limit := int64(math.MaxInt64) // The runtime's default, no limit
+	if m.BudgetMB > 0 {
+		limit = int64(m.BudgetMB) << 20
+	}
+	debug.SetMemoryLimit(limit)
+}
+
+// outputZones converts the configured zones for the player
+func outputZones(zones []config.ZoneConfig) []audio.ZoneConfig {
+	result := make([]audio.ZoneConfig, len(zones))
+	for i, z := range zones {
+		result[i] = audio.ZoneConfig{
+			Name:     z.Name,
+			Command:  z.Command,
+			Snapcast: z.Snapcast,
+			Enabled:  z.Enabled,
+			Volume:   z.VolumeLevel(),
+		}
+	}
+	return result
+}
+
+// channelMix returns the configured mono, balance and swap options
+func channelMix(a config.AudioConfig) audio.ChannelMix {
+	return audio.ChannelMix{Mono: a.Mono, Balance: a.Balance, Swap: a.SwapChannels}
+}
+
+// levelPrefetchTracks is how many tracks after the current one have their
+// loudness measured ahead of time
+const levelPrefetchTracks = 5
+
+// prefetchLevels measures the loudness of the current and upcoming queue
+// tracks for volume levelling
+func prefetchLevels(leveler *loudness.Leveler, queueMgr *queue.Manager) {
+	var paths []string
+	if path, _ := queueMgr.Current(); path != "" {
+		paths = append(paths, path)
+	}
+	for _, item := range queueMgr.Upcoming(levelPrefetchTracks) {
+		paths = append(paths, item.Path)
+	}
+	leveler.Prefetch(paths)
+}
+
+// dspStages converts the configured DSP chain for the player
+func dspStages(stages []config.DSPStageConfig) []audio.DSPStageConfig {
+	result := make([]audio.DSPStageConfig, len(stages))
+	for i, s := range stages {
+		result[i] = audio.DSPStageConfig{Name: s.Name, Enabled: s.Enabled, Params: s.Params}
+	}
+	return result
+}
+
+// resumeLastSession reloads the current queue track at its saved position,
+// either paused or playing depending on the resumePlayback setting
+func resumeLastSession(ctx context.Context, player *audio.Player, queueMgr *queue.Manager, queueStore *queue.Store, mode string) {
+	path, metadata := queueMgr.Current()
+	if path == "" {
+		return
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("[QUEUE] Not resuming missing track %s: %v", path, err)
+		return
+	}
+
+	var audioMeta *audio.TrackMetadata
+	if metadata != nil {
+		audioMeta = (*audio.TrackMetadata)(metadata)
+	}
+
+	position := queueStore.LastPosition(path)
+	var err error
+	if mode == "playing" {
+		err = player.PlayFrom(ctx, path, audioMeta, position)
+	} else {
+		err = player.Cue(ctx, path, audioMeta, position)
+	}
+	if err != nil {
+		log.Printf("[QUEUE] Warning: failed to resume %s: %v", path, err)
+		return
+	}
+
+	log.Printf("[QUEUE] Resumed %s at %dms (%s)", path, position, mode)
+}
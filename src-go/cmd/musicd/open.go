@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/ipc"
+)
+
+// uriScheme is the scheme of the deep links handled by musicd open
+const uriScheme = "musicd"
+
+const (
+	// openDialTimeout bounds how long open waits for the daemon socket
+	openDialTimeout = 2 * time.Second
+
+	// openPlaylistLimit is the most tracks getSmartPlaylist returns at once
+	openPlaylistLimit = 500
+)
+
+// openTarget is what a musicd:// URI asks the daemon to play. One of the
+// fields is set.
+type openTarget struct {
+	path     string // musicd://play?path=<file, folder or stream URL>
+	playlist string // musicd://playlist/<daily mix or mood>
+}
+
+// parseOpenURI reads a musicd:// URI
+func parseOpenURI(raw string) (openTarget, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return openTarget{}, fmt.Errorf("invalid URI: %w", err)
+	}
+	if u.Scheme != uriScheme {
+		return openTarget{}, fmt.Errorf("not a %s:// URI: %s", uriScheme, raw)
+	}
+
+	switch u.Host {
+	case "play":
+		path := u.Query().Get("path")
+		if path == "" {
+			return openTarget{}, fmt.Errorf("no path in %s", raw)
+		}
+		return openTarget{path: path}, nil
+	case "playlist":
+		name := strings.Trim(u.Path, "/")
+		if name == "" {
+			return openTarget{}, fmt.Errorf("no playlist name in %s", raw)
+		}
+		return openTarget{playlist: name}, nil
+	default:
+		return openTarget{}, fmt.Errorf("unknown action %q (play or playlist)", u.Host)
+	}
+}
+
+// runOpen plays what a musicd:// URI points at on the running daemon
+func runOpen(args []string) error {
+	set := flag.NewFlagSet("open", flag.ContinueOnError)
+	socketPath := set.String("socket", defaultSocketPath(), "IPC socket path")
+	configDir := set.String("config", "", "Configuration directory (default: ~/.config/musicd)")
+	set.Usage = func() {
+		fmt.Fprintln(set.Output(), "Usage: musicd open [flags] <musicd://play?path=...|musicd://playlist/name>")
+		set.PrintDefaults()
+	}
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if set.NArg() != 1 {
+		set.Usage()
+		return errors.New("expected one URI")
+	}
+
+	target, err := parseOpenURI(set.Arg(0))
+	if err != nil {
+		return err
+	}
+	token, err := openToken(*configDir)
+	if err != nil {
+		return err
+	}
+	c, err := dialOpen(*socketPath, token)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if target.playlist != "" {
+		return openPlaylist(c, target.playlist)
+	}
+	return openPath(c, target.path)
+}
+
+// openToken returns $MUSICD_TOKEN, or the admin token the daemon writes to
+// its config dir
+func openToken(configDir string) (string, error) {
+	if env := os.Getenv("MUSICD_TOKEN"); env != "" {
+		return env, nil
+	}
+	if configDir == "" {
+		dir, err := defaultConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		configDir = dir
+	}
+
+	data, err := os.ReadFile(filepath.Join(configDir, "admin.token"))
+	if err != nil {
+		return "", fmt.Errorf("admin token unreadable: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// openPath plays a file or stream, or a folder's tracks in album order
+func openPath(c *openClient, path string) error {
+	if audio.IsStreamURL(path) {
+		return c.call(ipc.CmdPlay, ipc.PlayRequest{Path: path}, nil)
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("path must be absolute: %s", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return c.call(ipc.CmdPlayPath, ipc.PlayPathRequest{Path: path, Recursive: true}, nil)
+	}
+	return c.call(ipc.CmdPlay, ipc.PlayRequest{Path: path}, nil)
+}
+
+// openPlaylist plays the daily mix called name, or failing that the smart
+// playlist for the mood called name. Playlists saved by clients live with
+// them, so those are out of reach here.
+func openPlaylist(c *openClient, name string) error {
+	var mixes ipc.GetDailyMixesResponse
+	if err := c.call(ipc.CmdGetDailyMixes, nil, &mixes); err == nil {
+		for _, mix := range mixes.Mixes {
+			if strings.EqualFold(mix.Name, name) {
+				return playTracks(c, mix.Tracks)
+			}
+		}
+	}
+
+	var smart ipc.GetSmartPlaylistResponse
+	if err := c.call(ipc.CmdGetSmartPlaylist, ipc.GetSmartPlaylistRequest{Mood: name, Limit: openPlaylistLimit}, &smart); err != nil {
+		return fmt.Errorf("no daily mix or mood called %q", name)
+	}
+	tracks := make([]ipc.LibraryTrack, len(smart.Tracks))
+	for i, t := range smart.Tracks {
+		tracks[i] = t.LibraryTrack
+	}
+	return playTracks(c, tracks)
+}
+
+// playTracks replaces the queue with tracks and plays the first
+func playTracks(c *openClient, tracks []ipc.LibraryTrack) error {
+	if len(tracks) == 0 {
+		return errors.New("playlist is empty")
+	}
+	items := make([]ipc.QueueItem, len(tracks))
+	for i, t := range tracks {
+		items[i] = ipc.QueueItem{
+			Path: t.Path,
+			Metadata: &ipc.TrackMetadata{
+				Title:    t.Title,
+				Artist:   t.Artist,
+				Album:    t.Album,
+				Duration: t.Duration,
+			},
+		}
+	}
+	if err := c.call(ipc.CmdQueue, ipc.QueueRequest{Items: items}, nil); err != nil {
+		return err
+	}
+	return c.call(ipc.CmdQueueJump, ipc.QueueJumpRequest{Index: 0}, nil)
+}
+
+// openClient is a connection to the daemon for musicd open
+type openClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	token  string
+}
+
+func dialOpen(socketPath, token string) (*openClient, error) {
+	conn, err := net.DialTimeout("unix", socketPath, openDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to musicd at %s (is it running?): %w", socketPath, err)
+	}
+	return &openClient{conn: conn, reader: bufio.NewReader(conn), token: token}, nil
+}
+
+func (c *openClient) Close() error {
+	return c.conn.Close()
+}
+
+// call sends a command and decodes the response data into out (if non-nil),
+// skipping push messages
+func (c *openClient) call(cmd ipc.CommandType, data interface{}, out interface{}) error {
+	req := &ipc.Request{Cmd: cmd, Token: c.token}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		req.Data = raw
+	}
+	encoded, err := ipc.EncodeRequest(req)
+	if err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(append(encoded, '\n')); err != nil {
+		return fmt.Errorf("failed to send %s request: %w", cmd, err)
+	}
+
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read %s response: %w", cmd, err)
+		}
+		var probe struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(line, &probe) == nil && probe.Type != "" {
+			continue
+		}
+
+		resp, err := ipc.DecodeResponse(line)
+		if err != nil {
+			return fmt.Errorf("failed to read %s response: %w", cmd, err)
+		}
+		if !resp.Success {
+			return fmt.Errorf("%s: %s", cmd, resp.Error)
+		}
+		if out != nil && len(resp.Data) > 0 {
+			return json.Unmarshal(resp.Data, out)
+		}
+		return nil
+	}
+}
+
+// runRegisterScheme makes this binary the handler for musicd:// links
+func runRegisterScheme() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if err := registerScheme(exe); err != nil {
+		return err
+	}
+	fmt.Printf("registered %s:// links with %s\n", uriScheme, exe)
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+	"github.com/austinkregel/local-media/musicd/internal/overlay"
+)
+
+// overlayInterval is how often the now playing file is brought up to date
+const overlayInterval = time.Second
+
+// nowPlaying returns what the stream overlay shows
+func nowPlaying(player *audio.Player) overlay.NowPlaying {
+	status := player.Status()
+	np := overlay.NowPlaying{
+		State:    string(status.State),
+		Duration: status.Duration,
+		Position: status.Position,
+	}
+	if meta := status.Metadata; meta != nil {
+		np.Title, np.Artist, np.Album = meta.Title, meta.Artist, meta.Album
+	}
+	np.HasArt = trackArt(status.Path) != ""
+	if status.StreamTitle != "" {
+		np.Title = status.StreamTitle
+	}
+	return np
+}
+
+// currentArt returns the album art of the current track, or ""
+func currentArt(player *audio.Player) string {
+	return trackArt(player.Status().Path)
+}
+
+// trackArt returns the art the daemon finds next to path itself. The art
+// path a client sends with play is not served: the overlay has no login,
+// so anyone who can reach it would be able to read any file by naming it.
+func trackArt(path string) string {
+	if path == "" || audio.IsStreamURL(path) {
+		return ""
+	}
+	return audio.FindAlbumArt(path)
+}
+
+// writeNowPlaying keeps the overlay file up to date while the config names
+// one. The text is only rewritten when it changes; JSON, which carries the
+// position, is rewritten every second while playing.
+func writeNowPlaying(ctx context.Context, player *audio.Player, configMgr *config.Manager) {
+	ticker := time.NewTicker(overlayInterval)
+	defer ticker.Stop()
+
+	var last config.OverlayConfig
+	var lastNP overlay.NowPlaying
+	failed := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cfg := configMgr.Get().Overlay
+		if cfg.File == "" {
+			last = cfg
+			continue
+		}
+		np := nowPlaying(player)
+		unmoved := np
+		unmoved.Position = lastNP.Position
+		playing := np.State == string(audio.StatePlaying)
+		if cfg == last && unmoved == lastNP && !(cfg.Format == overlay.FormatJSON && playing) {
+			continue
+		}
+
+		if err := overlay.WriteFile(cfg.File, cfg.Format, cfg.Template, np); err != nil {
+			// Logged once until it works again, rather than every second
+			if !failed {
+				log.Printf("[OVERLAY] Warning: %v", err)
+			}
+			failed = true
+			continue
+		}
+		failed = false
+		last, lastNP = cfg, np
+	}
+}
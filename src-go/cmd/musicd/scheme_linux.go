@@ -0,0 +1,62 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// schemeDesktopFile is the desktop entry that hands musicd:// links to
+// musicd open
+const schemeDesktopFile = "musicd-open.desktop"
+
+// registerScheme installs a desktop entry for musicd:// links and makes it
+// the default handler through xdg-mime
+func registerScheme(exe string) error {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dataHome = filepath.Join(homeDir, ".local", "share")
+	}
+	dir := filepath.Join(dataHome, "applications")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	entry := fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=musicd
+Comment=Play %[1]s:// links
+Exec=%[2]s open %%u
+Terminal=false
+NoDisplay=true
+MimeType=x-scheme-handler/%[1]s;
+`, uriScheme, desktopExecQuote(exe))
+	path := filepath.Join(dir, schemeDesktopFile)
+	if err := os.WriteFile(path, []byte(entry), 0644); err != nil {
+		return err
+	}
+
+	mime := "x-scheme-handler/" + uriScheme
+	if err := exec.Command("xdg-mime", "default", schemeDesktopFile, mime).Run(); err != nil {
+		return fmt.Errorf("wrote %s but xdg-mime failed: %w", path, err)
+	}
+	return nil
+}
+
+// desktopExecQuote quotes a path for the Exec key of a desktop entry
+func desktopExecQuote(path string) string {
+	path = strings.ReplaceAll(path, "%", "%%")
+	if !strings.ContainsAny(path, " \t\"'\\`$") {
+		return path
+	}
+	escaped := strings.NewReplacer(`\`, `\\\\`, `"`, `\\"`, "`", "\\\\`", `$`, `\\$`).Replace(path)
+	return `"` + escaped + `"`
+}
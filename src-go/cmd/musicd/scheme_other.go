@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+
+package main
+
+import "errors"
+
+// registerScheme is unsupported here: macOS only takes URL schemes from the
+// Info.plist of an app bundle
+func registerScheme(exe string) error {
+	return errors.New("registering URL schemes isn't supported on this platform")
+}
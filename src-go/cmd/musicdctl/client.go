@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/ipc"
+)
+
+// dialTimeout bounds how long we wait for the daemon socket to accept
+const dialTimeout = 2 * time.Second
+
+// client is a single connection to the daemon
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	token  string
+}
+
+// dial connects to the daemon's IPC socket
+func dial(socketPath, token string) (*client, error) {
+	conn, err := net.DialTimeout("unix", socketPath, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to musicd at %s (is it running?): %w", socketPath, err)
+	}
+	return &client{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		token:  token,
+	}, nil
+}
+
+// Close closes the connection
+func (c *client) Close() error {
+	return c.conn.Close()
+}
+
+// call sends a command and decodes the response data into out (if non-nil).
+// Push messages that arrive while waiting are skipped.
+func (c *client) call(cmd ipc.CommandType, data interface{}, out interface{}) error {
+	req := &ipc.Request{Cmd: cmd, Token: c.token}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s request: %w", cmd, err)
+		}
+		req.Data = raw
+	}
+
+	encoded, err := ipc.EncodeRequest(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", cmd, err)
+	}
+	if _, err := c.conn.Write(append(encoded, '\n')); err != nil {
+		return fmt.Errorf("failed to send %s request: %w", cmd, err)
+	}
+
+	resp, err := c.readResponse()
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", cmd, err)
+	}
+	if !resp.Success {
+		return fmt.Errorf("%s: %s", cmd, resp.Error)
+	}
+
+	if out != nil && len(resp.Data) > 0 {
+		if err := json.Unmarshal(resp.Data, out); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", cmd, err)
+		}
+	}
+	return nil
+}
+
+// readResponse reads lines until one is a response rather than a push message
+func (c *client) readResponse() (*ipc.Response, error) {
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		var probe struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(line, &probe); err == nil && probe.Type != "" {
+			continue
+		}
+
+		return ipc.DecodeResponse(line)
+	}
+}
@@ -0,0 +1,487 @@
+// Package main is the entry point for musicdctl, a command line client for
+// the musicd daemon. It speaks the same IPC protocol as the VS Code extension
+// and is meant for scripting, window manager keybinds and debugging.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/austinkregel/local-media/musicd/internal/ipc"
+	"github.com/austinkregel/local-media/musicd/internal/library"
+	"github.com/austinkregel/local-media/musicd/internal/scanner"
+)
+
+// Version is set at build time via ldflags
+var Version = "dev"
+
+const usage = `Usage: musicdctl [flags] <command> [args]
+
+Commands:
+  play <file>                Play a file immediately
+  pause | resume | toggle    Pause or resume playback
+  stop | next | prev         Transport controls
+  seek <seconds>             Seek within the current track
+  volume <0-100|+N|-N>       Set the volume, or turn it up or down N points
+  status [--json]            Show the current playback status
+  queue [list] [--json]      Show the queue
+  queue add <dir|file>...    Append files (directories are walked) to the queue
+  queue set <dir|file>...    Replace the queue
+  queue clear                Empty the queue
+  scan                       Start a library scan
+  do <request...>            Run a loosely worded request, e.g. "play something calmer"
+  clients list [--json]      List paired clients
+  clients approve <id>       Approve a pending client
+  clients revoke <id>        Revoke a client's access
+  clients max-volume <id> <0-100>  Limit how loud a client may set the volume, 0 for no limit
+  metrics                    Print daemon health and runtime metrics as JSON
+  dump-state [file]          Snapshot the daemon's state for a bug report (musicd --load-state restores it)
+  sync export [file]         Write ratings, play counts and bookmarks for another machine
+  sync import <file>         Merge in what another machine's sync export wrote
+  version                    Print the musicdctl version
+
+Flags:
+`
+
+func main() {
+	socketPath := flag.String("socket", "", "IPC socket path (default: auto-generated based on UID)")
+	configDir := flag.String("config", "", "Configuration directory (default: ~/.config/musicd)")
+	token := flag.String("token", "", "Auth token (default: $MUSICD_TOKEN, then the daemon's admin token)")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if args[0] == "version" {
+		fmt.Println(Version)
+		return
+	}
+
+	if *socketPath == "" {
+		*socketPath = fmt.Sprintf("/tmp/musicd-%d.sock", os.Getuid())
+	}
+
+	tok, err := resolveToken(*token, *configDir)
+	if err != nil {
+		fatal(err)
+	}
+
+	c, err := dial(*socketPath, tok)
+	if err != nil {
+		fatal(err)
+	}
+	defer c.Close()
+
+	if err := run(c, args[0], args[1:]); err != nil {
+		c.Close()
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "musicdctl: %v\n", err)
+	os.Exit(1)
+}
+
+// resolveToken picks the token to authenticate with: the -token flag, then
+// $MUSICD_TOKEN, then the admin token the daemon writes to its config dir
+func resolveToken(flagToken, configDir string) (string, error) {
+	if flagToken != "" {
+		return flagToken, nil
+	}
+	if env := os.Getenv("MUSICD_TOKEN"); env != "" {
+		return env, nil
+	}
+
+	if configDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		configDir = homeDir + "/.config/musicd"
+	}
+
+	data, err := os.ReadFile(filepath.Join(configDir, "admin.token"))
+	if err != nil {
+		return "", fmt.Errorf("no token given and admin token unreadable: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// run dispatches a single command
+func run(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "play":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: play <file>")
+		}
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			return err
+		}
+		return printStatus(c, ipc.CmdPlay, ipc.PlayRequest{Path: path}, false)
+	case "pause":
+		return c.call(ipc.CmdPause, nil, nil)
+	case "resume":
+		return c.call(ipc.CmdResume, nil, nil)
+	case "toggle":
+		var status ipc.StatusResponse
+		if err := c.call(ipc.CmdStatus, nil, &status); err != nil {
+			return err
+		}
+		if status.State == "playing" {
+			return c.call(ipc.CmdPause, nil, nil)
+		}
+		return c.call(ipc.CmdResume, nil, nil)
+	case "stop":
+		return c.call(ipc.CmdStop, nil, nil)
+	case "next":
+		return c.call(ipc.CmdNext, nil, nil)
+	case "prev":
+		return c.call(ipc.CmdPrev, nil, nil)
+	case "seek":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: seek <seconds>")
+		}
+		secs, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || secs < 0 {
+			return fmt.Errorf("invalid position %q", args[0])
+		}
+		return c.call(ipc.CmdSeek, ipc.SeekRequest{Position: int64(secs * 1000)}, nil)
+	case "volume":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: volume <0-100|+N|-N>")
+		}
+		if strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-") {
+			delta, err := strconv.ParseFloat(args[0], 64)
+			if err != nil {
+				return fmt.Errorf("invalid volume change %q", args[0])
+			}
+			return c.call(ipc.CmdAdjustVolume, ipc.AdjustVolumeRequest{DeltaPercent: delta}, nil)
+		}
+		level, err := strconv.Atoi(args[0])
+		if err != nil || level < 0 || level > 100 {
+			return fmt.Errorf("invalid volume %q", args[0])
+		}
+		return c.call(ipc.CmdVolume, ipc.VolumeRequest{Level: float64(level) / 100}, nil)
+	case "status":
+		asJSON, _, err := parseJSONFlag("status", args)
+		if err != nil {
+			return err
+		}
+		return printStatus(c, ipc.CmdStatus, nil, asJSON)
+	case "queue":
+		return runQueue(c, args)
+	case "scan":
+		var status ipc.ScanStatusResponse
+		if err := c.call(ipc.CmdScanLibrary, nil, &status); err != nil {
+			return err
+		}
+		fmt.Printf("scan %s (%d%%)\n", status.Status, status.Progress)
+		return nil
+	case "do":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: do <request...>")
+		}
+		var result ipc.InterpretResponse
+		if err := c.call(ipc.CmdInterpret, ipc.InterpretRequest{Text: strings.Join(args, " ")}, &result); err != nil {
+			return err
+		}
+		fmt.Println(result.Description)
+		return nil
+	case "clients":
+		return runClients(c, args)
+	case "sync":
+		return runSync(c, args)
+	case "metrics":
+		var m ipc.GetMetricsResponse
+		if err := c.call(ipc.CmdGetMetrics, nil, &m); err != nil {
+			return err
+		}
+		return printJSON(m)
+	case "dump-state":
+		return dumpState(c, args)
+	default:
+		return fmt.Errorf("unknown command %q (run musicdctl -h for help)", cmd)
+	}
+}
+
+// dumpState prints the daemon's state, or writes it to a file
+func dumpState(c *client, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: dump-state [file]")
+	}
+	var state ipc.DumpStateResponse
+	if err := c.call(ipc.CmdDumpState, nil, &state); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return printJSON(state)
+	}
+	raw, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(args[0], raw, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("wrote state with %d queue items and %d errors\n", len(state.Queue.Items), len(state.Errors))
+	return nil
+}
+
+func runQueue(c *client, args []string) error {
+	sub := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+
+	switch sub {
+	case "list":
+		asJSON, _, err := parseJSONFlag("queue list", args)
+		if err != nil {
+			return err
+		}
+		var q ipc.GetQueueResponse
+		if err := c.call(ipc.CmdGetQueue, nil, &q); err != nil {
+			return err
+		}
+		if asJSON {
+			return printJSON(q)
+		}
+		for i, item := range q.Items {
+			marker := "  "
+			if i == q.Index {
+				marker = "> "
+			}
+			fmt.Printf("%s%3d  %s\n", marker, i+1, describe(item.Path, item.Metadata))
+		}
+		return nil
+	case "add", "set":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: queue %s <dir|file>...", sub)
+		}
+		items, err := collectItems(args)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return fmt.Errorf("no supported audio files found")
+		}
+		if err := c.call(ipc.CmdQueue, ipc.QueueRequest{Items: items, Append: sub == "add"}, nil); err != nil {
+			return err
+		}
+		fmt.Printf("queued %d tracks\n", len(items))
+		return nil
+	case "clear":
+		return c.call(ipc.CmdQueue, ipc.QueueRequest{Items: []ipc.QueueItem{}}, nil)
+	default:
+		return fmt.Errorf("unknown queue command %q", sub)
+	}
+}
+
+func runClients(c *client, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch args[0] {
+	case "list":
+		asJSON, _, err := parseJSONFlag("clients list", args[1:])
+		if err != nil {
+			return err
+		}
+		var resp ipc.ListClientsResponse
+		if err := c.call(ipc.CmdListClients, nil, &resp); err != nil {
+			return err
+		}
+		if asJSON {
+			return printJSON(resp)
+		}
+		for _, cl := range resp.Clients {
+			fmt.Printf("%s  %-8s  %s  [%s]\n", cl.ID, cl.Status, cl.Name, strings.Join(cl.Scopes, ","))
+		}
+		return nil
+	case "approve", "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: clients %s <id>", args[0])
+		}
+		cmd := ipc.CmdApproveClient
+		if args[0] == "revoke" {
+			cmd = ipc.CmdRevokeClient
+		}
+		return c.call(cmd, ipc.ClientRequest{ClientID: args[1]}, nil)
+	case "max-volume":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: clients max-volume <id> <0-100>")
+		}
+		limit, err := strconv.Atoi(args[2])
+		if err != nil || limit < 0 || limit > 100 {
+			return fmt.Errorf("invalid max volume %q", args[2])
+		}
+		return c.call(ipc.CmdSetClientMaxVolume, ipc.SetClientMaxVolumeRequest{ClientID: args[1], MaxVolume: float64(limit) / 100}, nil)
+	default:
+		return fmt.Errorf("unknown clients command %q", args[0])
+	}
+}
+
+func runSync(c *client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: sync export [file] | sync import <file>")
+	}
+
+	switch args[0] {
+	case "export":
+		if len(args) > 2 {
+			return fmt.Errorf("usage: sync export [file]")
+		}
+		var data ipc.SyncData
+		if err := c.call(ipc.CmdExportSync, nil, &data); err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			return printJSON(data)
+		}
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(args[1], raw, 0600); err != nil {
+			return err
+		}
+		fmt.Printf("exported %d tracks\n", len(data.Tracks))
+		return nil
+	case "import":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: sync import <file>")
+		}
+		raw, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		var data ipc.SyncData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return fmt.Errorf("invalid sync file: %w", err)
+		}
+		var result ipc.ImportSyncResponse
+		if err := c.call(ipc.CmdImportSync, data, &result); err != nil {
+			return err
+		}
+		fmt.Printf("imported %d ratings, %d play counts, %d bookmarks (%d tracks not in the library)\n",
+			result.Ratings, result.PlayCounts, result.Bookmarks, result.Unmatched)
+		return nil
+	default:
+		return fmt.Errorf("unknown sync command %q", args[0])
+	}
+}
+
+// parseJSONFlag parses the --json flag shared by the read-only commands
+func parseJSONFlag(name string, args []string) (bool, []string, error) {
+	set := flag.NewFlagSet(name, flag.ContinueOnError)
+	asJSON := set.Bool("json", false, "Print raw JSON")
+	if err := set.Parse(args); err != nil {
+		return false, nil, err
+	}
+	return *asJSON, set.Args(), nil
+}
+
+// printStatus sends a command that answers with a StatusResponse and prints it
+func printStatus(c *client, cmd ipc.CommandType, data interface{}, asJSON bool) error {
+	var status ipc.StatusResponse
+	if err := c.call(cmd, data, &status); err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(status)
+	}
+
+	if status.State == "stopped" && status.Path == "" {
+		fmt.Println("stopped")
+		return nil
+	}
+	fmt.Printf("%s: %s\n", status.State, describe(status.Path, status.Metadata))
+	fmt.Printf("  %s / %s  volume %d%%  queue %d/%d  repeat %s  shuffle %v\n",
+		formatMs(status.Position), formatMs(status.Duration),
+		int(status.Volume*100+0.5), status.QueueIndex+1, status.QueueSize,
+		status.RepeatMode, status.Shuffle)
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// describe renders "Artist - Title" when metadata is known, else the file name
+func describe(path string, meta *ipc.TrackMetadata) string {
+	if meta != nil && meta.Title != "" {
+		if meta.Artist != "" {
+			return meta.Artist + " - " + meta.Title
+		}
+		return meta.Title
+	}
+	return filepath.Base(path)
+}
+
+func formatMs(ms int64) string {
+	secs := ms / 1000
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
+
+// collectItems expands the arguments into queue items. Directories are walked
+// recursively and their audio files added in path order, with numbers in
+// names compared by value so "Track 2" comes before "Track 10".
+func collectItems(args []string) ([]ipc.QueueItem, error) {
+	var items []ipc.QueueItem
+	for _, arg := range args {
+		root, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			items = append(items, ipc.QueueItem{Path: root})
+			continue
+		}
+
+		var paths []string
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil // Skip unreadable entries
+			}
+			if d.IsDir() && strings.HasPrefix(d.Name(), ".") && path != root {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && scanner.SupportedExtensions[strings.ToLower(filepath.Ext(path))] {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(paths, func(i, j int) bool {
+			return library.NaturalLess(strings.ToLower(paths[i]), strings.ToLower(paths[j]))
+		})
+		for _, p := range paths {
+			items = append(items, ipc.QueueItem{Path: p})
+		}
+	}
+	return items, nil
+}
@@ -7,10 +7,8 @@ toolchain go1.24.12
 require (
 	github.com/godbus/dbus/v5 v5.2.2
 	github.com/hajimehoshi/oto/v2 v2.4.3
+	golang.org/x/sys v0.27.0
+	gonum.org/v1/gonum v0.17.0
 )
 
-require (
-	github.com/ebitengine/purego v0.4.1 // indirect
-	golang.org/x/sys v0.27.0 // indirect
-	gonum.org/v1/gonum v0.17.0 // indirect
-)
+require github.com/ebitengine/purego v0.4.1 // indirect
@@ -0,0 +1,261 @@
+// Package alarm keeps scheduled playback, such as a sunrise alarm that
+// starts a playlist at a time of day and slowly brings the volume up.
+package alarm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+// MaxRampSeconds is the longest a schedule can take to bring the volume up
+const MaxRampSeconds = 60 * 60
+
+// Days are the names of the days a schedule can repeat on, indexed by
+// time.Weekday
+var Days = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Schedule starts playback at a time of day
+type Schedule struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name,omitempty"`
+
+	// Time is the local "HH:MM" it starts at
+	Time string `json:"time"`
+
+	// Days it starts on, from Days; empty for every day
+	Days []string `json:"days,omitempty"`
+
+	// What it plays; exactly one is set. Playlist is a daily mix or mood and
+	// SimilarTo a track to start a radio of similar tracks from.
+	Playlist  string   `json:"playlist,omitempty"`
+	Tracks    []string `json:"tracks,omitempty"`
+	SimilarTo string   `json:"similarTo,omitempty"`
+
+	// Volume is brought up from silence to this over RampSeconds
+	Volume      float64 `json:"volume"`
+	RampSeconds int     `json:"rampSeconds"`
+
+	Enabled bool  `json:"enabled"`
+	LastRun int64 `json:"lastRun,omitempty"` // Unix ms
+}
+
+// Validate checks the schedule and fills in defaults
+func (s *Schedule) Validate() error {
+	if _, err := time.Parse("15:04", s.Time); err != nil {
+		return errors.New(`time must be a time of day like "07:30"`)
+	}
+	for i, day := range s.Days {
+		day = strings.ToLower(day)
+		if !slices.Contains(Days, day) {
+			return fmt.Errorf("unknown day %q (one of %s)", s.Days[i], strings.Join(Days, ", "))
+		}
+		s.Days[i] = day
+	}
+
+	sources := 0
+	for _, set := range []bool{s.Playlist != "", len(s.Tracks) > 0, s.SimilarTo != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("exactly one of playlist, tracks or similarTo is required")
+	}
+
+	if s.Volume == 0 {
+		s.Volume = 1
+	}
+	if s.Volume < 0 || s.Volume > 1 {
+		return errors.New("volume must be between 0.0 and 1.0")
+	}
+	if s.RampSeconds < 0 || s.RampSeconds > MaxRampSeconds {
+		return fmt.Errorf("rampSeconds must be between 0 and %d", MaxRampSeconds)
+	}
+	return nil
+}
+
+// Next returns the first time after t the schedule starts
+func (s Schedule) Next(t time.Time) time.Time {
+	clock, err := time.Parse("15:04", s.Time)
+	if err != nil {
+		return time.Time{}
+	}
+	// A week ahead covers schedules that only run on one day
+	for i := 0; i <= 7; i++ {
+		day := t.AddDate(0, 0, i)
+		start := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, t.Location())
+		if start.After(t) && s.runsOn(start.Weekday()) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+func (s Schedule) runsOn(day time.Weekday) bool {
+	return len(s.Days) == 0 || slices.Contains(s.Days, Days[day])
+}
+
+// schedulesFile is the on-disk form of the store
+type schedulesFile struct {
+	NextID    int64      `json:"nextId"`
+	Schedules []Schedule `json:"schedules"`
+}
+
+// Store keeps the schedules on disk. It is safe for concurrent use.
+type Store struct {
+	mu        sync.Mutex
+	filePath  string
+	nextID    int64
+	schedules []Schedule
+}
+
+// NewStore creates a schedule store kept in dir
+func NewStore(dir string) *Store {
+	return &Store{
+		filePath: filepath.Join(dir, "schedules.json"),
+		nextID:   1,
+	}
+}
+
+// Load loads saved schedules from disk
+func (s *Store) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read schedules file: %w", err)
+	}
+
+	var file schedulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse schedules file: %w", err)
+	}
+	s.schedules = file.Schedules
+	s.nextID = max(file.NextID, 1)
+	for _, sch := range s.schedules {
+		s.nextID = max(s.nextID, sch.ID+1)
+	}
+	return nil
+}
+
+// List returns the schedules in the order they start in the day
+func (s *Store) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := append([]Schedule{}, s.schedules...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Time < list[j].Time })
+	return list
+}
+
+// Set adds sch, or replaces the schedule with its ID, and saves the change.
+// It returns the schedule as saved.
+func (s *Store) Set(sch Schedule) (Schedule, error) {
+	if err := sch.Validate(); err != nil {
+		return Schedule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sch.ID == 0 {
+		sch.ID = s.nextID
+		s.nextID++
+		s.schedules = append(s.schedules, sch)
+		return sch, s.saveLocked()
+	}
+	for i, existing := range s.schedules {
+		if existing.ID == sch.ID {
+			sch.LastRun = existing.LastRun
+			s.schedules[i] = sch
+			return sch, s.saveLocked()
+		}
+	}
+	return Schedule{}, fmt.Errorf("unknown schedule %d", sch.ID)
+}
+
+// Delete removes a schedule and saves the change. Returns false if there is
+// no such schedule.
+func (s *Store) Delete(id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, sch := range s.schedules {
+		if sch.ID == id {
+			s.schedules = append(s.schedules[:i:i], s.schedules[i+1:]...)
+			return true, s.saveLocked()
+		}
+	}
+	return false, nil
+}
+
+// Next returns the first time after t an enabled schedule starts, or the
+// zero time if none will
+func (s *Store) Next(t time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var first time.Time
+	for _, sch := range s.schedules {
+		if !sch.Enabled {
+			continue
+		}
+		if next := sch.Next(t); !next.IsZero() && (first.IsZero() || next.Before(first)) {
+			first = next
+		}
+	}
+	return first
+}
+
+// Due returns the enabled schedules that start after from and at or before
+// to, recording to as when they last ran
+func (s *Store) Due(from, to time.Time) ([]Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Schedule
+	for i, sch := range s.schedules {
+		if !sch.Enabled {
+			continue
+		}
+		if next := sch.Next(from); !next.IsZero() && !next.After(to) {
+			s.schedules[i].LastRun = to.UnixMilli()
+			due = append(due, s.schedules[i])
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	return due, s.saveLocked()
+}
+
+// saveLocked writes the schedules to disk (must be called with lock held)
+func (s *Store) saveLocked() error {
+	data, err := json.MarshalIndent(schedulesFile{NextID: s.nextID, Schedules: s.schedules}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedules: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create schedules directory: %w", err)
+	}
+
+	if err := atomicfile.Write(s.filePath, data); err != nil {
+		return fmt.Errorf("failed to write schedules file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package alarm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2024, 5, 15, 8, 0, 0, 0, time.Local)
+
+	daily := Schedule{Time: "07:30"}
+	if got, want := daily.Next(now), time.Date(2024, 5, 16, 7, 30, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("Expected daily schedule to next start %v, got %v", want, got)
+	}
+	later := Schedule{Time: "08:15"}
+	if got, want := later.Next(now), time.Date(2024, 5, 15, 8, 15, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("Expected schedule to start later today at %v, got %v", want, got)
+	}
+	weekdays := Schedule{Time: "07:30", Days: []string{"mon", "tue", "wed", "thu", "fri"}}
+	friday := time.Date(2024, 5, 17, 9, 0, 0, 0, time.Local)
+	if got, want := weekdays.Next(friday), time.Date(2024, 5, 20, 7, 30, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("Expected weekday schedule to skip the weekend to %v, got %v", want, got)
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	sch := Schedule{Time: "06:45", Days: []string{"Sat"}, Playlist: "chill"}
+	if err := sch.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if sch.Volume != 1 || sch.Days[0] != "sat" {
+		t.Errorf("Expected defaults to be filled in, got %+v", sch)
+	}
+
+	for _, bad := range []Schedule{
+		{Time: "6am", Playlist: "chill"},
+		{Time: "06:45"},
+		{Time: "06:45", Playlist: "chill", SimilarTo: "/music/a.flac"},
+		{Time: "06:45", Playlist: "chill", Days: []string{"someday"}},
+		{Time: "06:45", Playlist: "chill", RampSeconds: MaxRampSeconds + 1},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestStoreDueAndPersistence(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir)
+
+	alarm, err := store.Set(Schedule{Time: "07:00", Playlist: "chill", RampSeconds: 300, Enabled: true})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := store.Set(Schedule{Time: "07:00", Playlist: "hype"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	from := time.Date(2024, 5, 15, 6, 59, 30, 0, time.Local)
+	to := from.Add(time.Minute)
+	due, err := store.Due(from, to)
+	if err != nil {
+		t.Fatalf("Due failed: %v", err)
+	}
+	if len(due) != 1 || due[0].ID != alarm.ID {
+		t.Fatalf("Expected only the enabled schedule to be due, got %+v", due)
+	}
+	if due, _ := store.Due(to, to.Add(time.Minute)); len(due) != 0 {
+		t.Errorf("Expected nothing due after it ran, got %+v", due)
+	}
+
+	reloaded := NewStore(dir)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	list := reloaded.List()
+	if len(list) != 2 || list[0].LastRun != to.UnixMilli() {
+		t.Fatalf("Expected schedules and last run to be saved, got %+v", list)
+	}
+
+	if deleted, err := reloaded.Delete(alarm.ID); err != nil || !deleted {
+		t.Fatalf("Delete failed: %v, %v", deleted, err)
+	}
+	if next, _ := reloaded.Set(Schedule{Time: "08:00", Tracks: []string{"/music/a.flac"}}); next.ID <= alarm.ID+1 {
+		t.Errorf("Expected IDs not to be reused, got %d", next.ID)
+	}
+}
+
+func TestStoreNext(t *testing.T) {
+	store := NewStore(t.TempDir())
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.Local)
+	if next := store.Next(now); !next.IsZero() {
+		t.Errorf("Expected no start without schedules, got %v", next)
+	}
+
+	store.Set(Schedule{Time: "07:00", Playlist: "chill", Enabled: true})
+	store.Set(Schedule{Time: "18:00", Playlist: "hype", Enabled: true})
+	store.Set(Schedule{Time: "13:00", Playlist: "off"})
+	if want := time.Date(2024, 5, 15, 18, 0, 0, 0, time.Local); !store.Next(now).Equal(want) {
+		t.Errorf("Expected the next enabled start at %v, got %v", want, store.Next(now))
+	}
+}
@@ -1,32 +1,63 @@
 package analysis
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/kv"
 )
 
-// FeatureStore stores audio features and similarity data
+// edgesKind is the kind of per-track file similar track lists are kept in
+const edgesKind = "similar"
+
+// FeatureStore stores audio features and similarity data. Each track's
+// features are a record in an embedded database, so saving only writes the
+// tracks that changed.
 type FeatureStore struct {
-	mu       sync.RWMutex
-	dataPath string
+	mu      sync.RWMutex
+	dataDir string
+	db      *kv.DB
+	dirty   map[string]bool // Keys of records changed since the last save
 
 	// In-memory cache
 	features    map[string]*StoredFeatures
-	edges       map[string][]SimilarityEdge
 	communities map[string]*TrackCommunity
 	communityInfo []CommunityInfo
+
+	// Similar track lists take far more memory than the features, so they
+	// are read from their own files when needed and only the recently used
+	// ones are kept
+	edgeMu sync.Mutex
+	edges  *edgeCache
 }
 
 // StoredFeatures contains features with metadata
 type StoredFeatures struct {
-	Features   *AudioFeatures `json:"features"`
-	Version    int            `json:"version"`
-	AnalyzedAt int64          `json:"analyzedAt"`
-	FileHash   string         `json:"fileHash"`
+	Features    *AudioFeatures `json:"features"`
+	Version     int            `json:"version"`
+	AnalyzedAt  int64          `json:"analyzedAt"`
+	FileHash    string         `json:"fileHash"`
+	Groups      map[string]int `json:"groups,omitempty"` // Feature group -> version
+	Descriptors *Descriptors   `json:"descriptors,omitempty"`
+}
+
+// updateDescriptors derives the descriptors from the features
+func (f *StoredFeatures) updateDescriptors() {
+	if f.Features == nil {
+		f.Descriptors = nil
+		return
+	}
+	d := ComputeDescriptors(f.Features)
+	f.Descriptors = &d
 }
 
 // SimilarityEdge represents a similarity connection
@@ -50,97 +81,200 @@ type CommunityInfo struct {
 	TopFeatures []string `json:"topFeatures"`
 }
 
-// NewFeatureStore creates a new feature store
+// Keys of the records in the database
+const (
+	featuresPrefix    = "features/"
+	communitiesPrefix = "communities/"
+	communityInfoKey  = "communityInfo"
+)
+
+// NewFeatureStore opens the feature store in dataDir, importing the JSON file
+// analysis was kept in before
 func NewFeatureStore(dataDir string) (*FeatureStore, error) {
-	dataPath := filepath.Join(dataDir, "audio_analysis.json")
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("mkdir: %w", err)
+	}
+	db, err := kv.Open(filepath.Join(dataDir, "audio_analysis.db"))
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
 
 	store := &FeatureStore{
-		dataPath:    dataPath,
+		dataDir:     dataDir,
+		db:          db,
+		dirty:       make(map[string]bool),
 		features:    make(map[string]*StoredFeatures),
-		edges:       make(map[string][]SimilarityEdge),
 		communities: make(map[string]*TrackCommunity),
+		edges:       newEdgeCache(DefaultCacheBytes),
 	}
 
-	// Load existing data
 	if err := store.load(); err != nil {
-		// Not an error if file doesn't exist
-		if !os.IsNotExist(err) {
-			return nil, fmt.Errorf("load store: %w", err)
-		}
+		db.Close()
+		return nil, fmt.Errorf("load store: %w", err)
+	}
+	if err := store.importJSON(filepath.Join(dataDir, "audio_analysis.json")); err != nil && !os.IsNotExist(err) {
+		db.Close()
+		return nil, fmt.Errorf("import store: %w", err)
 	}
 
 	return store, nil
 }
 
-// load reads stored data from disk
+// load reads the stored records into memory
 func (s *FeatureStore) load() error {
-	data, err := os.ReadFile(s.dataPath)
+	err := s.db.ForEach(featuresPrefix, func(key string, value []byte) error {
+		var f StoredFeatures
+		if err := json.Unmarshal(value, &f); err != nil {
+			return fmt.Errorf("unmarshal %s: %w", key, err)
+		}
+		s.features[strings.TrimPrefix(key, featuresPrefix)] = &f
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	var stored struct {
-		Features    map[string]*StoredFeatures   `json:"features"`
-		Edges       map[string][]SimilarityEdge  `json:"edges"`
-		Communities map[string]*TrackCommunity   `json:"communities"`
-		CommunityInfo []CommunityInfo            `json:"communityInfo"`
+	err = s.db.ForEach(communitiesPrefix, func(key string, value []byte) error {
+		var c TrackCommunity
+		if err := json.Unmarshal(value, &c); err != nil {
+			return fmt.Errorf("unmarshal %s: %w", key, err)
+		}
+		s.communities[strings.TrimPrefix(key, communitiesPrefix)] = &c
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
+	value, ok, err := s.db.Get(communityInfoKey)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if err := json.Unmarshal(value, &s.communityInfo); err != nil {
+			return fmt.Errorf("unmarshal %s: %w", communityInfoKey, err)
+		}
+	}
+
+	prepareLoaded(s.features)
+	return nil
+}
+
+// prepareLoaded fills in what isn't stored with loaded features
+func prepareLoaded(features map[string]*StoredFeatures) {
+	for _, f := range features {
+		// Features stored before groups were versioned
+		if f.Groups == nil {
+			f.Groups = legacyGroupVersions(f.Version)
+		}
+		// Descriptors are cheap to derive, so they always follow the
+		// current formulas
+		f.updateDescriptors()
+	}
+}
+
+// importJSON adds the data in the JSON file the store used to be saved as,
+// then renames the file so it is only imported once. Importing again after
+// an interrupted import is harmless.
+func (s *FeatureStore) importJSON(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var stored struct {
+		Features      map[string]*StoredFeatures  `json:"features"`
+		Edges         map[string][]SimilarityEdge `json:"edges"`
+		Communities   map[string]*TrackCommunity  `json:"communities"`
+		CommunityInfo []CommunityInfo             `json:"communityInfo"`
+	}
 	if err := json.Unmarshal(data, &stored); err != nil {
 		return fmt.Errorf("unmarshal: %w", err)
 	}
 
-	s.features = stored.Features
-	s.edges = stored.Edges
-	s.communities = stored.Communities
-	s.communityInfo = stored.CommunityInfo
+	// Similar track lists were kept in the file too
+	for trackPath, edges := range stored.Edges {
+		if err := s.writeTrackFile(edgesKind, trackPath, edges); err != nil {
+			return fmt.Errorf("move similar tracks: %w", err)
+		}
+	}
 
-	if s.features == nil {
-		s.features = make(map[string]*StoredFeatures)
+	prepareLoaded(stored.Features)
+	s.mu.Lock()
+	for trackPath, f := range stored.Features {
+		if f != nil {
+			s.features[trackPath] = f
+			s.dirty[featuresPrefix+trackPath] = true
+		}
 	}
-	if s.edges == nil {
-		s.edges = make(map[string][]SimilarityEdge)
+	for trackPath, c := range stored.Communities {
+		if c != nil {
+			s.communities[trackPath] = c
+			s.dirty[communitiesPrefix+trackPath] = true
+		}
 	}
-	if s.communities == nil {
-		s.communities = make(map[string]*TrackCommunity)
+	if stored.CommunityInfo != nil {
+		s.communityInfo = stored.CommunityInfo
+		s.dirty[communityInfoKey] = true
 	}
+	s.mu.Unlock()
 
-	return nil
+	if err := s.Save(); err != nil {
+		return err
+	}
+	log.Printf("[ANALYSIS] Imported %d analyzed tracks from %s", len(stored.Features), path)
+	return os.Rename(path, path+".imported")
 }
 
-// Save writes data to disk
+// Save writes the records changed since the last save in one batch
 func (s *FeatureStore) Save() error {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	stored := struct {
-		Features    map[string]*StoredFeatures   `json:"features"`
-		Edges       map[string][]SimilarityEdge  `json:"edges"`
-		Communities map[string]*TrackCommunity   `json:"communities"`
-		CommunityInfo []CommunityInfo            `json:"communityInfo"`
-	}{
-		Features:    s.features,
-		Edges:       s.edges,
-		Communities: s.communities,
-		CommunityInfo: s.communityInfo,
+	var batch kv.Batch
+	for key := range s.dirty {
+		value, ok := s.recordLocked(key)
+		if !ok {
+			batch.Delete(key)
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+		batch.Put(key, data)
 	}
 
-	data, err := json.MarshalIndent(stored, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshal: %w", err)
+	if err := s.db.Write(&batch); err != nil {
+		return fmt.Errorf("write: %w", err)
 	}
+	clear(s.dirty)
+	return nil
+}
 
-	// Ensure directory exists
-	dir := filepath.Dir(s.dataPath)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("mkdir: %w", err)
+// recordLocked returns the data stored under key, and false if it was
+// removed (must be called with lock held)
+func (s *FeatureStore) recordLocked(key string) (interface{}, bool) {
+	switch {
+	case key == communityInfoKey:
+		return s.communityInfo, true
+	case strings.HasPrefix(key, featuresPrefix):
+		f, ok := s.features[strings.TrimPrefix(key, featuresPrefix)]
+		return f, ok
+	case strings.HasPrefix(key, communitiesPrefix):
+		c, ok := s.communities[strings.TrimPrefix(key, communitiesPrefix)]
+		return c, ok
 	}
+	return nil, false
+}
 
-	if err := os.WriteFile(s.dataPath, data, 0600); err != nil {
-		return fmt.Errorf("write: %w", err)
+// Close saves any unsaved changes and closes the database
+func (s *FeatureStore) Close() error {
+	err := s.Save()
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
 	}
-
-	return nil
+	return err
 }
 
 // StoreFeatures stores features for a track
@@ -148,12 +282,89 @@ func (s *FeatureStore) StoreFeatures(trackPath string, features *AudioFeatures,
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.features[trackPath] = &StoredFeatures{
+	stored := &StoredFeatures{
 		Features:   features,
 		Version:    version,
 		AnalyzedAt: unixNow(),
 		FileHash:   fileHash,
+		Groups:     currentGroupVersions(FeatureGroups),
+	}
+	stored.updateDescriptors()
+	s.features[trackPath] = stored
+	s.dirty[featuresPrefix+trackPath] = true
+}
+
+// StoreFeatureGroups updates only the given feature groups of a track,
+// keeping the rest of its stored features. A track without features, or
+// whose file changed, gets just those groups and is re-analyzed in full
+// later.
+func (s *FeatureStore) StoreFeatureGroups(trackPath string, features *AudioFeatures, groups []string, fileHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.features[trackPath]
+	if !ok || existing.Features == nil || existing.FileHash != fileHash {
+		stored := &StoredFeatures{
+			Features:   features,
+			Version:    FeatureVersion,
+			AnalyzedAt: unixNow(),
+			FileHash:   fileHash,
+			Groups:     currentGroupVersions(groups),
+		}
+		stored.updateDescriptors()
+		s.features[trackPath] = stored
+		s.dirty[featuresPrefix+trackPath] = true
+		return
+	}
+
+	// Copy on write so readers holding the old entry aren't affected
+	merged := *existing.Features
+	mergeGroups(&merged, features, groups)
+	updated := &StoredFeatures{
+		Features:   &merged,
+		Version:    existing.Version,
+		AnalyzedAt: unixNow(),
+		FileHash:   fileHash,
+		Groups:     make(map[string]int, len(FeatureGroups)),
+	}
+	for group, version := range existing.Groups {
+		updated.Groups[group] = version
+	}
+	for group, version := range currentGroupVersions(groups) {
+		updated.Groups[group] = version
+	}
+	updated.updateDescriptors()
+	s.features[trackPath] = updated
+	s.dirty[featuresPrefix+trackPath] = true
+}
+
+// FindByDescriptors returns the analyzed tracks whose descriptors satisfy
+// every rule, sorted by path
+func (s *FeatureStore) FindByDescriptors(rules []DescriptorRule) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var paths []string
+	for path, f := range s.features {
+		if f.Descriptors != nil && f.Descriptors.Matches(rules) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// StaleGroups returns the feature groups of a track that are out of date,
+// and false if the track has no features at all
+func (s *FeatureStore) StaleGroups(trackPath string) ([]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.features[trackPath]
+	if !ok {
+		return nil, false
 	}
+	return f.StaleGroups(), true
 }
 
 // GetFeatures retrieves features for a track
@@ -193,21 +404,32 @@ func (s *FeatureStore) GetAnalyzedCount() int {
 	return len(s.features)
 }
 
-// StoreSimilarityEdges stores similarity edges for a track
-func (s *FeatureStore) StoreSimilarityEdges(trackPath string, edges []SimilarityEdge) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.edges[trackPath] = edges
+// StoreSimilarityEdges writes the similar tracks of a track
+func (s *FeatureStore) StoreSimilarityEdges(trackPath string, edges []SimilarityEdge) error {
+	s.edgeMu.Lock()
+	defer s.edgeMu.Unlock()
+
+	// Dropped rather than updated, so building the graph doesn't push out
+	// the lists in use
+	s.edges.remove(trackPath)
+	return s.writeTrackFile(edgesKind, trackPath, edges)
 }
 
-// GetSimilarTracks returns similar tracks
+// GetSimilarTracks returns similar tracks, reading them from disk if they
+// aren't cached
 func (s *FeatureStore) GetSimilarTracks(trackPath string, limit int) []SimilarityEdge {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.edgeMu.Lock()
+	defer s.edgeMu.Unlock()
 
-	edges, ok := s.edges[trackPath]
+	edges, ok := s.edges.get(trackPath)
 	if !ok {
-		return nil
+		if err := s.readTrackFile(edgesKind, trackPath, &edges); err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("[ANALYSIS] Warning: failed to read similar tracks of %s: %v", trackPath, err)
+			}
+			edges = nil
+		}
+		s.edges.put(trackPath, edges)
 	}
 
 	if len(edges) <= limit {
@@ -216,11 +438,27 @@ func (s *FeatureStore) GetSimilarTracks(trackPath string, limit int) []Similarit
 	return edges[:limit]
 }
 
+// SetCacheBytes sets how much memory the similar track lists read from disk
+// may take, dropping the least recently used ones that no longer fit
+func (s *FeatureStore) SetCacheBytes(maxBytes int64) {
+	s.edgeMu.Lock()
+	defer s.edgeMu.Unlock()
+	s.edges.setMaxBytes(maxBytes)
+}
+
+// CacheStats reports on the similar track lists held in memory
+func (s *FeatureStore) CacheStats() CacheStats {
+	s.edgeMu.Lock()
+	defer s.edgeMu.Unlock()
+	return s.edges.stats()
+}
+
 // StoreCommunity stores community assignment for a track
 func (s *FeatureStore) StoreCommunity(trackPath string, community *TrackCommunity) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.communities[trackPath] = community
+	s.dirty[communitiesPrefix+trackPath] = true
 }
 
 // GetCommunity returns community assignment for a track
@@ -236,6 +474,7 @@ func (s *FeatureStore) StoreCommunityInfo(info []CommunityInfo) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.communityInfo = info
+	s.dirty[communityInfoKey] = true
 }
 
 // GetCommunities returns all community information
@@ -273,15 +512,212 @@ func (s *FeatureStore) GetBridgeTracks(minScore float32) []string {
 	return tracks
 }
 
+// trackFilePath returns where per-track data of the given kind is kept.
+// Waveforms and fingerprints live in their own files so they are only loaded
+// when a client asks for one.
+func (s *FeatureStore) trackFilePath(kind, trackPath string) string {
+	sum := sha256.Sum256([]byte(trackPath))
+	return filepath.Join(s.dataDir, kind, hex.EncodeToString(sum[:])[:16]+".json")
+}
+
+func (s *FeatureStore) writeTrackFile(kind, trackPath string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	path := s.trackFilePath(kind, trackPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+func (s *FeatureStore) readTrackFile(kind, trackPath string, v interface{}) error {
+	data, err := os.ReadFile(s.trackFilePath(kind, trackPath))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unmarshal: %w", err)
+	}
+	return nil
+}
+
+func (s *FeatureStore) hasTrackFile(kind, trackPath string) bool {
+	_, err := os.Stat(s.trackFilePath(kind, trackPath))
+	return err == nil
+}
+
+// StoreWaveform writes the waveform for a track
+func (s *FeatureStore) StoreWaveform(trackPath string, waveform *Waveform) error {
+	return s.writeTrackFile("waveforms", trackPath, waveform)
+}
+
+// GetWaveform reads the waveform for a track. Returns an error satisfying
+// os.IsNotExist if the track has none.
+func (s *FeatureStore) GetWaveform(trackPath string) (*Waveform, error) {
+	var waveform Waveform
+	if err := s.readTrackFile("waveforms", trackPath, &waveform); err != nil {
+		return nil, err
+	}
+	return &waveform, nil
+}
+
+// HasWaveform checks if a track has a stored waveform
+func (s *FeatureStore) HasWaveform(trackPath string) bool {
+	return s.hasTrackFile("waveforms", trackPath)
+}
+
+// StoreFingerprint writes the acoustic fingerprint for a track
+func (s *FeatureStore) StoreFingerprint(trackPath string, fp *Fingerprint) error {
+	return s.writeTrackFile("fingerprints", trackPath, fp)
+}
+
+// GetFingerprint reads the acoustic fingerprint for a track. Returns an
+// error satisfying os.IsNotExist if the track has none.
+func (s *FeatureStore) GetFingerprint(trackPath string) (*Fingerprint, error) {
+	var fp Fingerprint
+	if err := s.readTrackFile("fingerprints", trackPath, &fp); err != nil {
+		return nil, err
+	}
+	return &fp, nil
+}
+
+// HasFingerprint checks if a track has a stored fingerprint
+func (s *FeatureStore) HasFingerprint(trackPath string) bool {
+	return s.hasTrackFile("fingerprints", trackPath)
+}
+
+// FileHashes returns the stored content hash of every analyzed track
+func (s *FeatureStore) FileHashes() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hashes := make(map[string]string, len(s.features))
+	for path, f := range s.features {
+		hashes[path] = f.FileHash
+	}
+	return hashes
+}
+
+// SetFileHash replaces the stored hash of an analyzed track
+func (s *FeatureStore) SetFileHash(trackPath, fileHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.features[trackPath]; ok {
+		f.FileHash = fileHash
+		s.dirty[featuresPrefix+trackPath] = true
+	}
+}
+
+// RelocatePaths moves stored data to new track paths. rename returns the new
+// path for a track and false if it should stay where it is. Returns the
+// number of tracks moved.
+func (s *FeatureStore) RelocatePaths(rename func(path string) (string, bool)) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	moved := 0
+	features := make(map[string]*StoredFeatures, len(s.features))
+	renamed := make(map[string]string, len(s.features)) // Old path -> new path of every track
+	for path, f := range s.features {
+		newPath, ok := rename(path)
+		if !ok || newPath == path {
+			features[path] = f
+			renamed[path] = path
+			continue
+		}
+		renamed[path] = newPath
+		features[newPath] = f
+		s.dirty[featuresPrefix+path] = true
+		s.dirty[featuresPrefix+newPath] = true
+		moved++
+
+		for _, kind := range []string{"waveforms", "fingerprints"} {
+			oldFile := s.trackFilePath(kind, path)
+			if _, err := os.Stat(oldFile); err == nil {
+				os.Rename(oldFile, s.trackFilePath(kind, newPath))
+			}
+		}
+	}
+	s.features = features
+
+	// Lists name other tracks, so any of them may need rewriting
+	s.edgeMu.Lock()
+	for path, newPath := range renamed {
+		s.relocateEdges(path, newPath, rename)
+	}
+	s.edges.clear()
+	s.edgeMu.Unlock()
+
+	communities := make(map[string]*TrackCommunity, len(s.communities))
+	for path, c := range s.communities {
+		if newPath, ok := rename(path); ok && newPath != path {
+			s.dirty[communitiesPrefix+path] = true
+			s.dirty[communitiesPrefix+newPath] = true
+			path = newPath
+		}
+		communities[path] = c
+	}
+	s.communities = communities
+
+	return moved
+}
+
+// relocateEdges moves the similar track list of path to newPath, renaming
+// the tracks in it (must be called with edgeMu held)
+func (s *FeatureStore) relocateEdges(path, newPath string, rename func(path string) (string, bool)) {
+	var edges []SimilarityEdge
+	if err := s.readTrackFile(edgesKind, path, &edges); err != nil {
+		return
+	}
+
+	changed := newPath != path
+	for i := range edges {
+		if target, ok := rename(edges[i].TargetPath); ok && target != edges[i].TargetPath {
+			edges[i].TargetPath = target
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if err := s.writeTrackFile(edgesKind, newPath, edges); err != nil {
+		log.Printf("[ANALYSIS] Warning: failed to relocate similar tracks of %s: %v", path, err)
+		return
+	}
+	if newPath != path {
+		os.Remove(s.trackFilePath(edgesKind, path))
+	}
+}
+
 // ClearAll clears all stored data
 func (s *FeatureStore) ClearAll() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	for path := range s.features {
+		s.dirty[featuresPrefix+path] = true
+	}
+	for path := range s.communities {
+		s.dirty[communitiesPrefix+path] = true
+	}
+	s.dirty[communityInfoKey] = true
+
 	s.features = make(map[string]*StoredFeatures)
-	s.edges = make(map[string][]SimilarityEdge)
 	s.communities = make(map[string]*TrackCommunity)
 	s.communityInfo = nil
+
+	s.edgeMu.Lock()
+	defer s.edgeMu.Unlock()
+	s.edges.clear()
+	os.RemoveAll(filepath.Join(s.dataDir, edgesKind))
 }
 
 func unixNow() int64 {
@@ -0,0 +1,143 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSimilarTracksCachedWithinLimit(t *testing.T) {
+	store, err := NewFeatureStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFeatureStore failed: %v", err)
+	}
+	defer store.Close()
+
+	edges := []SimilarityEdge{{TargetPath: "/music/b.flac", Weight: 0.9}, {TargetPath: "/music/c.flac", Weight: 0.5}}
+	for _, path := range []string{"/music/a.flac", "/music/b.flac", "/music/c.flac"} {
+		if err := store.StoreSimilarityEdges(path, edges); err != nil {
+			t.Fatalf("StoreSimilarityEdges failed: %v", err)
+		}
+	}
+
+	// Room for two of the lists
+	store.SetCacheBytes(2 * edgeListSize("/music/a.flac", edges))
+	for _, path := range []string{"/music/a.flac", "/music/b.flac", "/music/c.flac", "/music/c.flac"} {
+		if got := store.GetSimilarTracks(path, 1); len(got) != 1 || got[0] != edges[0] {
+			t.Fatalf("GetSimilarTracks(%s) = %+v, want the first edge", path, got)
+		}
+	}
+
+	stats := store.CacheStats()
+	if stats.Entries != 2 || stats.Bytes > stats.MaxBytes || stats.Hits != 1 || stats.Misses != 3 {
+		t.Errorf("Expected the oldest list to be dropped and one hit, got %+v", stats)
+	}
+	if got := store.GetSimilarTracks("/music/a.flac", 10); len(got) != 2 {
+		t.Errorf("Expected a dropped list to be read again, got %+v", got)
+	}
+	if got := store.GetSimilarTracks("/music/none.flac", 10); got != nil {
+		t.Errorf("Expected no similar tracks for an unknown track, got %+v", got)
+	}
+}
+
+func TestImportsJSONStore(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{
+		"features": {"/music/a.flac": {"features": {"Tempo": 120}, "version": 1, "fileHash": "a"}},
+		"edges": {"/music/a.flac": [{"targetPath": "/music/b.flac", "weight": 0.8}]},
+		"communities": {"/music/a.flac": {"communityId": 2}},
+		"communityInfo": [{"id": 2, "name": "Upbeat", "trackCount": 1}]
+	}`
+	jsonPath := filepath.Join(dir, "audio_analysis.json")
+	if err := os.WriteFile(jsonPath, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFeatureStore(dir)
+	if err != nil {
+		t.Fatalf("NewFeatureStore failed: %v", err)
+	}
+	if got := store.GetSimilarTracks("/music/a.flac", 10); len(got) != 1 || got[0].TargetPath != "/music/b.flac" {
+		t.Errorf("Expected the similar tracks to be kept, got %+v", got)
+	}
+	if _, err := os.Stat(jsonPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the JSON file to be renamed once imported, got %v", err)
+	}
+	store.Close()
+
+	// The imported data is in the database
+	store, err = NewFeatureStore(dir)
+	if err != nil {
+		t.Fatalf("NewFeatureStore failed: %v", err)
+	}
+	defer store.Close()
+	if f, ok := store.GetFeatures("/music/a.flac"); !ok || f.Features.Tempo != 120 || f.Groups == nil {
+		t.Errorf("Expected the imported features, got %+v", f)
+	}
+	if c, ok := store.GetCommunity("/music/a.flac"); !ok || c.CommunityID != 2 {
+		t.Errorf("Expected the imported community, got %+v", c)
+	}
+	if info := store.GetCommunities(); len(info) != 1 || info[0].Name != "Upbeat" {
+		t.Errorf("Expected the imported community info, got %+v", info)
+	}
+}
+
+func TestSaveWritesChangedTracks(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFeatureStore(dir)
+	if err != nil {
+		t.Fatalf("NewFeatureStore failed: %v", err)
+	}
+	store.StoreFeatures("/music/a.flac", &AudioFeatures{Tempo: 90}, FeatureVersion, "a")
+	store.StoreFeatures("/music/b.flac", &AudioFeatures{Tempo: 100}, FeatureVersion, "b")
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	store.SetFileHash("/music/a.flac", "a2")
+	store.ClearAll()
+	store.StoreFeatures("/music/c.flac", &AudioFeatures{Tempo: 110}, FeatureVersion, "c")
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	store, err = NewFeatureStore(dir)
+	if err != nil {
+		t.Fatalf("NewFeatureStore failed: %v", err)
+	}
+	defer store.Close()
+	if store.GetAnalyzedCount() != 1 || !store.HasFeatures("/music/c.flac", FeatureVersion) {
+		t.Errorf("Expected only the track stored after clearing, got %v", store.FileHashes())
+	}
+}
+
+func TestRelocateRewritesSimilarTracks(t *testing.T) {
+	store, err := NewFeatureStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFeatureStore failed: %v", err)
+	}
+	defer store.Close()
+	store.StoreFeatures("/old/a.flac", &AudioFeatures{}, FeatureVersion, "a")
+	store.StoreFeatures("/music/b.flac", &AudioFeatures{}, FeatureVersion, "b")
+	store.StoreSimilarityEdges("/old/a.flac", []SimilarityEdge{{TargetPath: "/music/b.flac", Weight: 0.7}})
+	store.StoreSimilarityEdges("/music/b.flac", []SimilarityEdge{{TargetPath: "/old/a.flac", Weight: 0.7}})
+	store.GetSimilarTracks("/music/b.flac", 10)
+
+	store.RelocatePaths(func(path string) (string, bool) {
+		if rest, ok := strings.CutPrefix(path, "/old/"); ok {
+			return "/music/" + rest, true
+		}
+		return "", false
+	})
+
+	if got := store.GetSimilarTracks("/music/a.flac", 10); len(got) != 1 || got[0].TargetPath != "/music/b.flac" {
+		t.Errorf("Expected the moved track's list under its new path, got %+v", got)
+	}
+	if got := store.GetSimilarTracks("/music/b.flac", 10); len(got) != 1 || got[0].TargetPath != "/music/a.flac" {
+		t.Errorf("Expected the moved track renamed in other lists, got %+v", got)
+	}
+	if got := store.GetSimilarTracks("/old/a.flac", 10); got != nil {
+		t.Errorf("Expected nothing left under the old path, got %+v", got)
+	}
+}
@@ -0,0 +1,160 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Descriptors are high-level, listener-facing scores derived from the
+// low-level features. All are 0-1.
+type Descriptors struct {
+	Energy       float32 `json:"energy"`       // Calm to intense
+	Danceability float32 `json:"danceability"` // Steady, mid-tempo beat with a strong pulse
+	Acousticness float32 `json:"acousticness"` // Acoustic instruments and natural dynamics
+	Valence      float32 `json:"valence"`      // Sad/dark to happy/bright (a rough proxy)
+}
+
+// Descriptor names used in rules
+const (
+	DescriptorEnergy       = "energy"
+	DescriptorDanceability = "danceability"
+	DescriptorAcousticness = "acousticness"
+	DescriptorValence      = "valence"
+)
+
+// DescriptorNames lists the descriptors rules can use
+var DescriptorNames = []string{DescriptorEnergy, DescriptorDanceability, DescriptorAcousticness, DescriptorValence}
+
+// ComputeDescriptors derives descriptors from a track's features
+func ComputeDescriptors(f *AudioFeatures) Descriptors {
+	loudness := clamp01(f.RMSEnergy / 0.3)
+	// Flux is an unnormalized magnitude sum; compress it to 0-1
+	flux := clamp01(float32(math.Log10(1+float64(f.SpectralFlux))) / 3)
+	brightness := clamp01(f.SpectralCentroid * 4) // Most music sits under 5kHz
+	noisiness := clamp01(f.ZeroCrossing * 5)
+
+	energy := clamp01(0.35*loudness + 0.2*flux + 0.2*f.Instruments.PlayingIntensity +
+		0.15*f.AttackSharpness + 0.1*brightness)
+
+	danceability := clamp01(0.35*danceTempo(f.Tempo) + 0.25*f.Instruments.Percussive +
+		0.25*(1-f.RhythmComplexity) + 0.15*clamp01(f.BassRatio*3))
+
+	acoustic := max(f.Instruments.StringLike, f.Instruments.WoodwindLike, f.Instruments.BrassLike)
+	acousticness := clamp01(0.3*(1-f.Instruments.SynthPad) + 0.25*acoustic +
+		0.25*f.DynamicRange + 0.2*(1-noisiness))
+
+	// Major keys read as happier; an unknown key counts as neutral
+	mode := float32(0.5)
+	if f.KeyStrength > 0 {
+		if f.Mode == KeyMajor {
+			mode = 0.5 + f.KeyStrength/2
+		} else {
+			mode = 0.5 - f.KeyStrength/2
+		}
+	}
+	tempo := clamp01((f.Tempo - 60) / 120)
+	valence := clamp01(0.3*mode + 0.25*brightness + 0.25*tempo + 0.2*energy)
+
+	return Descriptors{
+		Energy:       energy,
+		Danceability: danceability,
+		Acousticness: acousticness,
+		Valence:      valence,
+	}
+}
+
+// danceTempo scores how danceable a tempo is, peaking around 120 BPM and
+// falling off towards 70 and 180
+func danceTempo(bpm float32) float32 {
+	if bpm <= 0 {
+		return 0
+	}
+	return clamp01(1 - abs32(bpm-120)/60)
+}
+
+// Get returns a descriptor by name
+func (d Descriptors) Get(name string) (float32, bool) {
+	switch name {
+	case DescriptorEnergy:
+		return d.Energy, true
+	case DescriptorDanceability:
+		return d.Danceability, true
+	case DescriptorAcousticness:
+		return d.Acousticness, true
+	case DescriptorValence:
+		return d.Valence, true
+	}
+	return 0, false
+}
+
+// DescriptorRule limits a descriptor to an inclusive range
+type DescriptorRule struct {
+	Descriptor string
+	Min, Max   float32
+}
+
+// Validate checks that the rule names a descriptor and has a usable range
+func (r DescriptorRule) Validate() error {
+	if _, ok := (Descriptors{}).Get(r.Descriptor); !ok {
+		return fmt.Errorf("unknown descriptor %q", r.Descriptor)
+	}
+	if r.Min < 0 || r.Max > 1 || r.Min > r.Max {
+		return fmt.Errorf("invalid range %.2f-%.2f for %s", r.Min, r.Max, r.Descriptor)
+	}
+	return nil
+}
+
+// Moods are named rule sets for smart playlists
+var Moods = map[string][]DescriptorRule{
+	"chill": {
+		{Descriptor: DescriptorEnergy, Min: 0, Max: 0.4},
+	},
+	"hype": {
+		{Descriptor: DescriptorEnergy, Min: 0.7, Max: 1},
+		{Descriptor: DescriptorDanceability, Min: 0.5, Max: 1},
+	},
+	"party": {
+		{Descriptor: DescriptorDanceability, Min: 0.7, Max: 1},
+		{Descriptor: DescriptorEnergy, Min: 0.5, Max: 1},
+	},
+	"happy": {
+		{Descriptor: DescriptorValence, Min: 0.6, Max: 1},
+	},
+	"melancholy": {
+		{Descriptor: DescriptorValence, Min: 0, Max: 0.35},
+		{Descriptor: DescriptorEnergy, Min: 0, Max: 0.6},
+	},
+	"acoustic": {
+		{Descriptor: DescriptorAcousticness, Min: 0.6, Max: 1},
+	},
+	"focus": {
+		{Descriptor: DescriptorEnergy, Min: 0, Max: 0.5},
+		{Descriptor: DescriptorDanceability, Min: 0, Max: 0.5},
+	},
+}
+
+// MoodNames returns the mood names in alphabetical order
+func MoodNames() []string {
+	names := make([]string, 0, len(Moods))
+	for name := range Moods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Matches reports whether the descriptors satisfy every rule
+func (d Descriptors) Matches(rules []DescriptorRule) bool {
+	for _, r := range rules {
+		v, ok := d.Get(r.Descriptor)
+		if !ok || v < r.Min || v > r.Max {
+			return false
+		}
+	}
+	return true
+}
+
+func clamp01(x float32) float32 {
+	return min(max(x, 0), 1)
+}
@@ -0,0 +1,143 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+const descriptorSampleRate = 22050
+
+// sineSignal returns seconds of a sine wave
+func sineSignal(freq, amplitude, seconds float64) []float64 {
+	samples := make([]float64, int(seconds*descriptorSampleRate))
+	for i := range samples {
+		samples[i] = amplitude * math.Sin(2*math.Pi*freq*float64(i)/descriptorSampleRate)
+	}
+	return samples
+}
+
+// noiseSignal returns seconds of white noise
+func noiseSignal(amplitude, seconds float64) []float64 {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]float64, int(seconds*descriptorSampleRate))
+	for i := range samples {
+		samples[i] = amplitude * (rng.Float64()*2 - 1)
+	}
+	return samples
+}
+
+// beatSignal returns seconds of loud kick drums at bpm, each a decaying low
+// thump with a burst of noise on the attack
+func beatSignal(bpm, seconds float64) []float64 {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]float64, int(seconds*descriptorSampleRate))
+	beat := int(60 / bpm * descriptorSampleRate)
+	for i := range samples {
+		t := float64(i%beat) / descriptorSampleRate
+		decay := math.Exp(-t * 12)
+		thump := math.Sin(2 * math.Pi * 60 * t)
+		click := (rng.Float64()*2 - 1) * math.Exp(-t*80)
+		samples[i] = 0.9 * decay * (0.7*thump + 0.3*click)
+	}
+	return samples
+}
+
+func descriptorsOf(samples []float64) Descriptors {
+	return ComputeDescriptors(NewFeatureExtractor(descriptorSampleRate).ProcessAudio(samples))
+}
+
+func TestDescriptorsOfSyntheticSignals(t *testing.T) {
+	quiet := descriptorsOf(sineSignal(440, 0.05, 10))
+	beat := descriptorsOf(beatSignal(120, 10))
+	noise := descriptorsOf(noiseSignal(0.5, 10))
+
+	for name, d := range map[string]Descriptors{"sine": quiet, "beat": beat, "noise": noise} {
+		for _, descriptor := range DescriptorNames {
+			if v, _ := d.Get(descriptor); v < 0 || v > 1 {
+				t.Errorf("%s: expected %s within 0-1, got %v", name, descriptor, v)
+			}
+		}
+	}
+
+	if beat.Energy <= quiet.Energy {
+		t.Errorf("Expected loud drums more energetic than a quiet tone, got %v and %v", beat.Energy, quiet.Energy)
+	}
+	if beat.Danceability <= quiet.Danceability {
+		t.Errorf("Expected a 120 BPM beat more danceable than a tone, got %v and %v", beat.Danceability, quiet.Danceability)
+	}
+	if quiet.Acousticness <= noise.Acousticness {
+		t.Errorf("Expected a pure tone more acoustic than noise, got %v and %v", quiet.Acousticness, noise.Acousticness)
+	}
+}
+
+func TestDescriptorsTempo(t *testing.T) {
+	slow := descriptorsOf(beatSignal(70, 10))
+	mid := descriptorsOf(beatSignal(120, 10))
+	if mid.Danceability <= slow.Danceability {
+		t.Errorf("Expected 120 BPM more danceable than 70 BPM, got %v and %v", mid.Danceability, slow.Danceability)
+	}
+
+	tests := []struct {
+		bpm  float32
+		want float32
+	}{
+		{0, 0}, // Tempo unknown
+		{60, 0},
+		{90, 0.5},
+		{120, 1},
+		{150, 0.5},
+		{180, 0},
+		{200, 0},
+	}
+	for _, tt := range tests {
+		if got := danceTempo(tt.bpm); math.Abs(float64(got-tt.want)) > 1e-6 {
+			t.Errorf("danceTempo(%v) = %v, want %v", tt.bpm, got, tt.want)
+		}
+	}
+}
+
+func TestDescriptorsMode(t *testing.T) {
+	f := &AudioFeatures{Tempo: 120, RMSEnergy: 0.1, SpectralCentroid: 0.1, KeyStrength: 0.8}
+
+	f.Mode = KeyMajor
+	major := ComputeDescriptors(f).Valence
+	f.Mode = KeyMinor
+	minor := ComputeDescriptors(f).Valence
+	f.KeyStrength = 0
+	unknown := ComputeDescriptors(f).Valence
+
+	if !(major > unknown && unknown > minor) {
+		t.Errorf("Expected major > unknown key > minor valence, got %v, %v, %v", major, unknown, minor)
+	}
+}
+
+func TestDescriptorRules(t *testing.T) {
+	d := Descriptors{Energy: 0.8, Danceability: 0.6, Acousticness: 0.1, Valence: 0.5}
+	if !d.Matches(Moods["hype"]) {
+		t.Error("Expected energetic, danceable descriptors to match hype")
+	}
+	if d.Matches(Moods["chill"]) {
+		t.Error("Expected energetic descriptors not to match chill")
+	}
+	if d.Matches([]DescriptorRule{{Descriptor: "tempo", Min: 0, Max: 1}}) {
+		t.Error("Expected an unknown descriptor not to match")
+	}
+
+	tests := []struct {
+		rule DescriptorRule
+		ok   bool
+	}{
+		{DescriptorRule{Descriptor: DescriptorEnergy, Min: 0.2, Max: 0.8}, true},
+		{DescriptorRule{Descriptor: DescriptorEnergy, Min: 0.5, Max: 0.5}, true},
+		{DescriptorRule{Descriptor: "loudness", Min: 0, Max: 1}, false},
+		{DescriptorRule{Descriptor: DescriptorValence, Min: 0.8, Max: 0.2}, false},
+		{DescriptorRule{Descriptor: DescriptorValence, Min: -0.1, Max: 0.5}, false},
+		{DescriptorRule{Descriptor: DescriptorValence, Min: 0, Max: 1.5}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.rule.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v, want ok %v", tt.rule, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package analysis
+
+// Histogram counts a feature's values in equal-width bins between Min and Max
+type Histogram struct {
+	Feature string
+	Min     float32
+	Max     float32
+	Mean    float32
+	Counts  []int
+	Tracks  int // Tracks with a known value
+}
+
+// Distribution is the spread of features across the library
+type Distribution struct {
+	Tracks     int
+	Histograms []Histogram
+	Keys       map[string]int // Key name -> tracks in that key
+}
+
+// distributionFeature reads one scalar from stored features; false means the
+// value is unknown for that track
+type distributionFeature struct {
+	name  string
+	value func(f *StoredFeatures) (float32, bool)
+}
+
+func known(v float32) (float32, bool) { return v, true }
+
+// distributionFeatures are the scalar features histograms are built for
+var distributionFeatures = []distributionFeature{
+	{"tempo", func(f *StoredFeatures) (float32, bool) { return f.Features.Tempo, f.Features.Tempo > 0 }},
+	{"rmsEnergy", func(f *StoredFeatures) (float32, bool) { return known(f.Features.RMSEnergy) }},
+	{"spectralCentroid", func(f *StoredFeatures) (float32, bool) { return known(f.Features.SpectralCentroid) }},
+	{"spectralRolloff", func(f *StoredFeatures) (float32, bool) { return known(f.Features.SpectralRolloff) }},
+	{"spectralFlux", func(f *StoredFeatures) (float32, bool) { return known(f.Features.SpectralFlux) }},
+	{"zeroCrossing", func(f *StoredFeatures) (float32, bool) { return known(f.Features.ZeroCrossing) }},
+	{"bassRatio", func(f *StoredFeatures) (float32, bool) { return known(f.Features.BassRatio) }},
+	{"midRatio", func(f *StoredFeatures) (float32, bool) { return known(f.Features.MidRatio) }},
+	{"trebleRatio", func(f *StoredFeatures) (float32, bool) { return known(f.Features.TrebleRatio) }},
+	{"attackSharpness", func(f *StoredFeatures) (float32, bool) { return known(f.Features.AttackSharpness) }},
+	{"harmonicDensity", func(f *StoredFeatures) (float32, bool) { return known(f.Features.HarmonicDensity) }},
+	{"rhythmComplexity", func(f *StoredFeatures) (float32, bool) { return known(f.Features.RhythmComplexity) }},
+	{"dynamicRange", func(f *StoredFeatures) (float32, bool) { return known(f.Features.DynamicRange) }},
+	{"brassLike", func(f *StoredFeatures) (float32, bool) { return known(f.Features.Instruments.BrassLike) }},
+	{"stringLike", func(f *StoredFeatures) (float32, bool) { return known(f.Features.Instruments.StringLike) }},
+	{"woodwindLike", func(f *StoredFeatures) (float32, bool) { return known(f.Features.Instruments.WoodwindLike) }},
+	{"percussive", func(f *StoredFeatures) (float32, bool) { return known(f.Features.Instruments.Percussive) }},
+	{"synthPad", func(f *StoredFeatures) (float32, bool) { return known(f.Features.Instruments.SynthPad) }},
+	{"vocalPresence", func(f *StoredFeatures) (float32, bool) { return known(f.Features.Instruments.VocalPresence) }},
+	{"keyStrength", func(f *StoredFeatures) (float32, bool) { return f.Features.KeyStrength, f.Features.KeyStrength > 0 }},
+	{"energy", func(f *StoredFeatures) (float32, bool) { return descriptor(f, DescriptorEnergy) }},
+	{"danceability", func(f *StoredFeatures) (float32, bool) { return descriptor(f, DescriptorDanceability) }},
+	{"acousticness", func(f *StoredFeatures) (float32, bool) { return descriptor(f, DescriptorAcousticness) }},
+	{"valence", func(f *StoredFeatures) (float32, bool) { return descriptor(f, DescriptorValence) }},
+}
+
+func descriptor(f *StoredFeatures, name string) (float32, bool) {
+	if f.Descriptors == nil {
+		return 0, false
+	}
+	return f.Descriptors.Get(name)
+}
+
+// DistributionFeatureNames lists the features FeatureDistribution covers
+func DistributionFeatureNames() []string {
+	names := make([]string, len(distributionFeatures))
+	for i, df := range distributionFeatures {
+		names[i] = df.name
+	}
+	return names
+}
+
+// FeatureDistribution builds a histogram with the given number of bins for
+// each feature, over the tracks include accepts (all tracks if include is
+// nil). features limits which histograms are built; empty means all.
+func (s *FeatureStore) FeatureDistribution(bins int, features []string, include func(path string) bool) Distribution {
+	var wanted map[string]bool
+	if len(features) > 0 {
+		wanted = make(map[string]bool, len(features))
+		for _, name := range features {
+			wanted[name] = true
+		}
+	}
+
+	var tracks []*StoredFeatures
+	for path, f := range s.GetAllFeatures() {
+		if f.Features != nil && (include == nil || include(path)) {
+			tracks = append(tracks, f)
+		}
+	}
+
+	dist := Distribution{
+		Tracks: len(tracks),
+		Keys:   make(map[string]int),
+	}
+	for _, f := range tracks {
+		if f.Features.KeyStrength > 0 {
+			dist.Keys[KeyName(f.Features.Key, f.Features.Mode)]++
+		}
+	}
+
+	values := make([]float32, 0, len(tracks))
+	for _, df := range distributionFeatures {
+		if wanted != nil && !wanted[df.name] {
+			continue
+		}
+
+		values = values[:0]
+		for _, f := range tracks {
+			if v, ok := df.value(f); ok {
+				values = append(values, v)
+			}
+		}
+		dist.Histograms = append(dist.Histograms, buildHistogram(df.name, values, bins))
+	}
+
+	return dist
+}
+
+// buildHistogram bins values between their minimum and maximum
+func buildHistogram(name string, values []float32, bins int) Histogram {
+	h := Histogram{
+		Feature: name,
+		Counts:  make([]int, bins),
+		Tracks:  len(values),
+	}
+	if len(values) == 0 {
+		return h
+	}
+
+	h.Min, h.Max = values[0], values[0]
+	var sum float64
+	for _, v := range values {
+		h.Min = min(h.Min, v)
+		h.Max = max(h.Max, v)
+		sum += float64(v)
+	}
+	h.Mean = float32(sum / float64(len(values)))
+
+	width := (h.Max - h.Min) / float32(bins)
+	for _, v := range values {
+		bin := 0
+		if width > 0 {
+			// The maximum lands in the last bin rather than one past it
+			bin = min(int((v-h.Min)/width), bins-1)
+		}
+		h.Counts[bin]++
+	}
+	return h
+}
@@ -0,0 +1,62 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildHistogram(t *testing.T) {
+	h := buildHistogram("tempo", []float32{60, 90, 90, 120, 180}, 4)
+	if h.Min != 60 || h.Max != 180 || h.Mean != 108 || h.Tracks != 5 {
+		t.Errorf("Expected 60-180 with a mean of 108 over 5 tracks, got %+v", h)
+	}
+	// Bins of 30 BPM, with the maximum in the last one
+	if want := []int{1, 2, 1, 1}; !reflect.DeepEqual(h.Counts, want) {
+		t.Errorf("Expected counts %v, got %v", want, h.Counts)
+	}
+
+	// The same value everywhere goes in the first bin
+	if h := buildHistogram("tempo", []float32{100, 100}, 3); !reflect.DeepEqual(h.Counts, []int{2, 0, 0}) {
+		t.Errorf("Expected a single value in the first bin, got %v", h.Counts)
+	}
+	if h := buildHistogram("tempo", nil, 3); h.Tracks != 0 || !reflect.DeepEqual(h.Counts, []int{0, 0, 0}) {
+		t.Errorf("Expected empty bins without values, got %+v", h)
+	}
+}
+
+func TestFeatureDistribution(t *testing.T) {
+	store, err := NewFeatureStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFeatureStore failed: %v", err)
+	}
+	defer store.Close()
+
+	store.StoreFeatures("/music/a.flac", &AudioFeatures{Tempo: 100, Key: 9, Mode: KeyMinor, KeyStrength: 0.8}, FeatureVersion, "a")
+	store.StoreFeatures("/music/b.flac", &AudioFeatures{Tempo: 140, Key: 9, Mode: KeyMinor, KeyStrength: 0.6}, FeatureVersion, "b")
+	store.StoreFeatures("/music/c.flac", &AudioFeatures{}, FeatureVersion, "c") // Tempo and key unknown
+	store.StoreFeatures("/music/gone.flac", &AudioFeatures{Tempo: 200}, FeatureVersion, "d")
+
+	inLibrary := func(path string) bool { return path != "/music/gone.flac" }
+	dist := store.FeatureDistribution(2, []string{"tempo", "rmsEnergy"}, inLibrary)
+	if dist.Tracks != 3 {
+		t.Errorf("Expected the 3 tracks in the library, got %d", dist.Tracks)
+	}
+	if !reflect.DeepEqual(dist.Keys, map[string]int{"A minor": 2}) {
+		t.Errorf("Expected 2 tracks in A minor, got %v", dist.Keys)
+	}
+	if len(dist.Histograms) != 2 || dist.Histograms[0].Feature != "tempo" || dist.Histograms[1].Feature != "rmsEnergy" {
+		t.Fatalf("Expected tempo and rmsEnergy histograms, got %+v", dist.Histograms)
+	}
+	// Unknown tempos aren't counted, unlike a measured level of 0
+	if tempo := dist.Histograms[0]; tempo.Tracks != 2 || tempo.Min != 100 || tempo.Max != 140 {
+		t.Errorf("Expected the 2 known tempos, got %+v", tempo)
+	}
+	if rms := dist.Histograms[1]; rms.Tracks != 3 {
+		t.Errorf("Expected every track's level, got %+v", rms)
+	}
+
+	all := store.FeatureDistribution(5, nil, nil)
+	if all.Tracks != 4 || len(all.Histograms) != len(DistributionFeatureNames()) {
+		t.Errorf("Expected every feature of every track, got %d tracks and %d histograms", all.Tracks, len(all.Histograms))
+	}
+}
@@ -0,0 +1,118 @@
+package analysis
+
+import "container/list"
+
+// DefaultCacheBytes is the memory kept for similar track lists loaded from
+// disk until SetCacheBytes is called
+const DefaultCacheBytes = 32 << 20
+
+// Approximate memory held besides the path strings: list and map entries for
+// each cached list, and the string header and weight of each edge
+const (
+	edgeListOverhead = 128
+	edgeOverhead     = 24
+)
+
+// CacheStats describes an in-memory cache of data loaded from disk
+type CacheStats struct {
+	Entries  int
+	Bytes    int64
+	MaxBytes int64
+	Hits     uint64
+	Misses   uint64
+}
+
+// edgeCache keeps the similar track lists read most recently, dropping the
+// least recently used once they take more than maxBytes. Lists of tracks
+// without any are kept too, so they aren't looked for on disk again. It is
+// not safe for concurrent use.
+type edgeCache struct {
+	maxBytes int64
+	bytes    int64
+	order    *list.List // Of *cachedEdges, most recently used first
+	entries  map[string]*list.Element
+	hits     uint64
+	misses   uint64
+}
+
+type cachedEdges struct {
+	path  string
+	edges []SimilarityEdge
+	size  int64
+}
+
+func newEdgeCache(maxBytes int64) *edgeCache {
+	return &edgeCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached list for path and whether there was one
+func (c *edgeCache) get(path string) ([]SimilarityEdge, bool) {
+	elem, ok := c.entries[path]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedEdges).edges, true
+}
+
+// put caches the list for path, replacing any cached before
+func (c *edgeCache) put(path string, edges []SimilarityEdge) {
+	c.remove(path)
+	entry := &cachedEdges{path: path, edges: edges, size: edgeListSize(path, edges)}
+	c.entries[path] = c.order.PushFront(entry)
+	c.bytes += entry.size
+	c.evict()
+}
+
+func (c *edgeCache) remove(path string) {
+	if elem, ok := c.entries[path]; ok {
+		c.bytes -= elem.Value.(*cachedEdges).size
+		c.order.Remove(elem)
+		delete(c.entries, path)
+	}
+}
+
+// clear drops every list, keeping the hit and miss counts
+func (c *edgeCache) clear() {
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.bytes = 0
+}
+
+func (c *edgeCache) setMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	c.evict()
+}
+
+// evict drops the least recently used lists until the cache fits its limit
+func (c *edgeCache) evict() {
+	for c.bytes > c.maxBytes && c.order.Len() > 0 {
+		entry := c.order.Back().Value.(*cachedEdges)
+		c.remove(entry.path)
+	}
+}
+
+func (c *edgeCache) stats() CacheStats {
+	return CacheStats{
+		Entries:  c.order.Len(),
+		Bytes:    c.bytes,
+		MaxBytes: c.maxBytes,
+		Hits:     c.hits,
+		Misses:   c.misses,
+	}
+}
+
+// edgeListSize estimates the memory held by the cached list for path
+func edgeListSize(path string, edges []SimilarityEdge) int64 {
+	size := int64(edgeListOverhead + len(path))
+	for _, e := range edges {
+		size += int64(edgeOverhead + len(e.TargetPath))
+	}
+	return size
+}
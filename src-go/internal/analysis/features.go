@@ -44,6 +44,17 @@ type AudioFeatures struct {
 	HarmonicDensity  float32 // Sparse vs full arrangement (0-1)
 	RhythmComplexity float32 // Syncopation level (0-1)
 	DynamicRange     float32 // Compression vs dynamics (0-1)
+
+	// Tonal features
+	Key         int     // Pitch class of the tonic (0=C, 11=B)
+	Mode        int     // KeyMajor or KeyMinor
+	KeyStrength float32 // Confidence in the key (0-1); 0 if unknown
+
+	// Silence at the start and end, for trimming on playback
+	Silence Silence
+
+	// Integrated loudness in LUFS, for levelling volume; 0 if unknown
+	Loudness float32
 }
 
 // InstrumentProfile contains instrument family presence scores
@@ -59,7 +70,10 @@ type InstrumentProfile struct {
 	PlayingIntensity  float32 // 0=soft, 1=aggressive
 }
 
-// FeatureExtractor extracts audio features from PCM data
+// FeatureExtractor extracts audio features from PCM data. Audio can be fed in
+// chunks as it is decoded; only running totals are kept between frames, so
+// memory use doesn't grow with the length of the track. An extractor handles
+// one track at a time.
 type FeatureExtractor struct {
 	mu sync.Mutex
 
@@ -67,20 +81,42 @@ type FeatureExtractor struct {
 	window             []float64
 	melFilters         [][]float64
 	instrumentDetector *InstrumentDetector
-
-	// Accumulator for windowed analysis
-	frameCount         int
-	mfccAccum          [][]float64
-	centroidAccum      []float64
-	rolloffAccum       []float64
-	fluxAccum          []float64
-	zcrAccum           []float64
-	rmsAccum           []float64
-	bandEnergyAccum    [][]float64 // [frame][3] for bass/mid/treble
-	attackAccum        []float64
-	prevSpectrum       []float64
-	onsetStrengths     []float64
-	instrumentAccum    []InstrumentProfile
+	chromaBins         []int // Spectrum bin -> pitch class, or -1
+
+	// Buffers reused for every frame
+	windowed []float64
+	spectrum []float64
+
+	// Groups left out of the current track, to save work on a partial
+	// re-analysis
+	skipTimbre      bool
+	skipInstruments bool
+	skipKey         bool
+	skipSilence     bool
+	skipLoudness    bool
+
+	// Streaming input
+	partial []byte    // Bytes of an incomplete sample frame from the last chunk
+	pending []float64 // Mono samples not yet consumed by a hop
+
+	// Running totals for windowed analysis
+	frameCount    int
+	mfccSum       [numMFCC]float64
+	mfccSumSq     [numMFCC]float64
+	centroidSum   float64
+	rolloffSum    float64
+	fluxSum       float64
+	zcrSum        float64
+	rmsSum        float64
+	bandEnergySum [3]float64 // bass/mid/treble
+	attackSum     float64
+	instrumentSum InstrumentProfile
+	chroma        [12]float64 // Pitch class energy for key detection
+	rmsLevels     levelHistogram // For the dynamic range percentiles
+	onsets        onsetStats
+	silence       *silenceTracker
+	loudness      *loudnessMeter
+	prevSpectrum  []float64
 
 	sampleRate int
 }
@@ -97,12 +133,23 @@ func NewFeatureExtractor(sampleRate int) *FeatureExtractor {
 		window[i] = 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/float64(analysisFFTSize-1)))
 	}
 
+	// Tempo is searched between 60 and 200 BPM
+	hopDuration := float64(hopSize) / float64(sampleRate)
+	minLag := int(60.0 / 200.0 / hopDuration)
+	maxLag := int(60.0 / 60.0 / hopDuration)
+
 	fe := &FeatureExtractor{
 		fft:                fourier.NewFFT(analysisFFTSize),
 		window:             window,
 		melFilters:         createMelFilterbank(numMelFilters, analysisFFTSize, sampleRate),
 		instrumentDetector: NewInstrumentDetector(sampleRate, analysisFFTSize),
+		chromaBins:         chromaBinMap(analysisFFTSize, sampleRate),
+		windowed:           make([]float64, analysisFFTSize),
+		spectrum:           make([]float64, analysisFFTSize/2),
 		prevSpectrum:       make([]float64, analysisFFTSize/2),
+		onsets:             newOnsetStats(max(minLag, 1), maxLag),
+		silence:            newSilenceTracker(),
+		loudness:           newLoudnessMeter(sampleRate),
 		sampleRate:         sampleRate,
 	}
 
@@ -110,19 +157,61 @@ func NewFeatureExtractor(sampleRate int) *FeatureExtractor {
 	return fe
 }
 
+// Reset clears the extractor for a new track
+func (fe *FeatureExtractor) Reset() {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	fe.reset()
+}
+
+// SetGroups limits the following tracks to the given feature groups, or all
+// of them for nil. Features outside the groups are left zero.
+func (fe *FeatureExtractor) SetGroups(groups []string) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+
+	groups = normalizeGroups(groups)
+	fe.skipTimbre = groups != nil
+	fe.skipInstruments = groups != nil
+	fe.skipKey = groups != nil
+	fe.skipSilence = groups != nil
+	fe.skipLoudness = groups != nil
+	for _, group := range groups {
+		switch group {
+		case GroupTimbre:
+			fe.skipTimbre = false
+		case GroupInstruments:
+			fe.skipInstruments = false
+		case GroupKey:
+			fe.skipKey = false
+		case GroupSilence:
+			fe.skipSilence = false
+		case GroupLoudness:
+			fe.skipLoudness = false
+		}
+	}
+}
+
 // reset clears accumulators for a new track
 func (fe *FeatureExtractor) reset() {
+	fe.partial = fe.partial[:0]
+	fe.pending = fe.pending[:0]
 	fe.frameCount = 0
-	fe.mfccAccum = nil
-	fe.centroidAccum = nil
-	fe.rolloffAccum = nil
-	fe.fluxAccum = nil
-	fe.zcrAccum = nil
-	fe.rmsAccum = nil
-	fe.bandEnergyAccum = nil
-	fe.attackAccum = nil
-	fe.onsetStrengths = nil
-	fe.instrumentAccum = nil
+	fe.mfccSum = [numMFCC]float64{}
+	fe.mfccSumSq = [numMFCC]float64{}
+	fe.centroidSum = 0
+	fe.rolloffSum = 0
+	fe.fluxSum = 0
+	fe.zcrSum = 0
+	fe.rmsSum = 0
+	fe.bandEnergySum = [3]float64{}
+	fe.attackSum = 0
+	fe.instrumentSum = InstrumentProfile{}
+	fe.chroma = [12]float64{}
+	fe.rmsLevels = levelHistogram{}
+	fe.onsets.reset()
+	fe.silence.reset()
+	fe.loudness.reset()
 	for i := range fe.prevSpectrum {
 		fe.prevSpectrum[i] = 0
 	}
@@ -134,30 +223,116 @@ func (fe *FeatureExtractor) ProcessAudio(samples []float64) *AudioFeatures {
 	defer fe.mu.Unlock()
 
 	fe.reset()
+	for _, sample := range samples {
+		if !fe.skipLoudness {
+			fe.loudness.add(0, sample)
+			fe.loudness.endFrame()
+		}
+		fe.addSample(sample)
+	}
+	fe.processPending()
+	return fe.computeFinalFeatures()
+}
 
-	// Process in overlapping windows
-	numFrames := (len(samples) - analysisFFTSize) / hopSize
-	if numFrames < 1 {
-		return &AudioFeatures{}
+// ProcessPCM extracts features from 16-bit stereo PCM data
+func (fe *FeatureExtractor) ProcessPCM(data []byte, channels int) *AudioFeatures {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+
+	fe.reset()
+	fe.processChunk(data, channels)
+	return fe.computeFinalFeatures()
+}
+
+// ProcessChunk analyzes the next chunk of a track as 16-bit PCM with the
+// given number of interleaved channels. Chunks may split sample frames.
+// Call Reset before the first chunk of a track and Features after the last.
+func (fe *FeatureExtractor) ProcessChunk(data []byte, channels int) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	fe.processChunk(data, channels)
+}
+
+// Features returns the features of the audio passed to ProcessChunk since
+// the last Reset
+func (fe *FeatureExtractor) Features() *AudioFeatures {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	return fe.computeFinalFeatures()
+}
+
+// processChunk downmixes PCM to mono and analyzes every complete frame
+func (fe *FeatureExtractor) processChunk(data []byte, channels int) {
+	if channels < 1 {
+		channels = 1
 	}
+	frameBytes := 2 * channels
 
-	for i := 0; i < numFrames; i++ {
-		start := i * hopSize
-		end := start + analysisFFTSize
-		if end > len(samples) {
-			break
+	// Complete a sample frame split across chunks
+	if len(fe.partial) > 0 {
+		n := min(frameBytes-len(fe.partial), len(data))
+		fe.partial = append(fe.partial, data[:n]...)
+		data = data[n:]
+		if len(fe.partial) < frameBytes {
+			return
 		}
-		fe.processFrame(samples[start:end])
+		fe.addFrame(fe.partial, channels)
+		fe.partial = fe.partial[:0]
 	}
 
-	return fe.computeFinalFeatures()
+	whole := len(data) - len(data)%frameBytes
+	for offset := 0; offset < whole; offset += frameBytes {
+		fe.addFrame(data[offset:offset+frameBytes], channels)
+	}
+	fe.partial = append(fe.partial, data[whole:]...)
+
+	fe.processPending()
 }
 
-// ProcessPCM extracts features from 16-bit stereo PCM data
-func (fe *FeatureExtractor) ProcessPCM(data []byte, channels int) *AudioFeatures {
-	// Convert to mono float64
-	samples := pcmToMono(data, channels)
-	return fe.ProcessAudio(samples)
+// addFrame measures the loudness of a 16-bit sample frame and queues its
+// downmix
+func (fe *FeatureExtractor) addFrame(frame []byte, channels int) {
+	if !fe.skipLoudness {
+		for ch := 0; ch < channels; ch++ {
+			sample := int16(frame[ch*2]) | int16(frame[ch*2+1])<<8
+			fe.loudness.add(ch, float64(sample)/32768.0)
+		}
+		fe.loudness.endFrame()
+	}
+	fe.addSample(downmix(frame, channels))
+}
+
+// addSample queues a mono sample for the next frame, measuring silence as
+// it goes
+func (fe *FeatureExtractor) addSample(sample float64) {
+	fe.pending = append(fe.pending, sample)
+	if !fe.skipSilence {
+		fe.silence.add(sample)
+	}
+}
+
+// processPending analyzes frames from the pending samples. A frame is only
+// analyzed once a full hop follows it, matching how a complete track is
+// split into frames.
+func (fe *FeatureExtractor) processPending() {
+	start := 0
+	for start+analysisFFTSize+hopSize <= len(fe.pending) {
+		fe.processFrame(fe.pending[start : start+analysisFFTSize])
+		start += hopSize
+	}
+	if start > 0 {
+		fe.pending = append(fe.pending[:0], fe.pending[start:]...)
+	}
+}
+
+// downmix averages one 16-bit sample frame to a mono sample
+func downmix(frame []byte, channels int) float64 {
+	var sum float64
+	for ch := 0; ch < channels; ch++ {
+		sample := int16(frame[ch*2]) | int16(frame[ch*2+1])<<8
+		sum += float64(sample) / 32768.0
+	}
+	return sum / float64(channels)
 }
 
 // processFrame analyzes a single FFT frame
@@ -167,7 +342,7 @@ func (fe *FeatureExtractor) processFrame(frame []float64) {
 	}
 
 	// Apply window
-	windowed := make([]float64, analysisFFTSize)
+	windowed := fe.windowed
 	for i := 0; i < analysisFFTSize; i++ {
 		windowed[i] = frame[i] * fe.window[i]
 	}
@@ -176,7 +351,7 @@ func (fe *FeatureExtractor) processFrame(frame []float64) {
 	coeffs := fe.fft.Coefficients(nil, windowed)
 
 	// Compute magnitude spectrum
-	spectrum := make([]float64, analysisFFTSize/2)
+	spectrum := fe.spectrum
 	for i := 0; i < len(spectrum); i++ {
 		real := real(coeffs[i])
 		imag := imag(coeffs[i])
@@ -191,44 +366,64 @@ func (fe *FeatureExtractor) processFrame(frame []float64) {
 // computeFrameFeatures extracts features from a single frame
 func (fe *FeatureExtractor) computeFrameFeatures(frame, spectrum []float64) {
 	// 1. MFCCs
-	mfcc := fe.computeMFCC(spectrum)
-	fe.mfccAccum = append(fe.mfccAccum, mfcc)
+	if !fe.skipTimbre {
+		mfcc := fe.computeMFCC(spectrum)
+		for i, c := range mfcc {
+			fe.mfccSum[i] += c
+			fe.mfccSumSq[i] += c * c
+		}
+	}
 
 	// 2. Spectral Centroid
-	centroid := fe.computeSpectralCentroid(spectrum)
-	fe.centroidAccum = append(fe.centroidAccum, centroid)
+	fe.centroidSum += fe.computeSpectralCentroid(spectrum)
 
 	// 3. Spectral Rolloff
-	rolloff := fe.computeSpectralRolloff(spectrum, 0.85)
-	fe.rolloffAccum = append(fe.rolloffAccum, rolloff)
+	fe.rolloffSum += fe.computeSpectralRolloff(spectrum, 0.85)
 
 	// 4. Spectral Flux
 	flux := fe.computeSpectralFlux(spectrum)
-	fe.fluxAccum = append(fe.fluxAccum, flux)
+	fe.fluxSum += flux
 
 	// 5. Zero Crossing Rate
 	zcr := fe.computeZCR(frame)
-	fe.zcrAccum = append(fe.zcrAccum, zcr)
+	fe.zcrSum += zcr
 
 	// 6. RMS Energy
 	rms := fe.computeRMS(frame)
-	fe.rmsAccum = append(fe.rmsAccum, rms)
+	fe.rmsSum += rms
+	fe.rmsLevels.add(rms)
 
 	// 7. Band Energy Ratios
 	bandEnergies := fe.computeBandEnergies(spectrum)
-	fe.bandEnergyAccum = append(fe.bandEnergyAccum, bandEnergies)
+	for i := range fe.bandEnergySum {
+		fe.bandEnergySum[i] += bandEnergies[i]
+	}
 
 	// 8. Attack Sharpness (transient detection)
-	attack := fe.computeAttackSharpness(spectrum)
-	fe.attackAccum = append(fe.attackAccum, attack)
+	fe.attackSum += fe.computeAttackSharpness(spectrum)
 
 	// 9. Instrument Detection
-	instrumentProfile := fe.instrumentDetector.DetectInstruments(spectrum, fe.prevSpectrum, zcr, rms)
-	fe.instrumentAccum = append(fe.instrumentAccum, instrumentProfile)
+	if !fe.skipInstruments {
+		p := fe.instrumentDetector.DetectInstruments(spectrum, fe.prevSpectrum, zcr, rms)
+		fe.instrumentSum.BrassLike += p.BrassLike
+		fe.instrumentSum.StringLike += p.StringLike
+		fe.instrumentSum.WoodwindLike += p.WoodwindLike
+		fe.instrumentSum.Percussive += p.Percussive
+		fe.instrumentSum.SynthPad += p.SynthPad
+		fe.instrumentSum.VocalPresence += p.VocalPresence
+		fe.instrumentSum.ArticulationStyle += p.ArticulationStyle
+		fe.instrumentSum.EnsembleSize += p.EnsembleSize
+		fe.instrumentSum.PlayingIntensity += p.PlayingIntensity
+	}
+
+	// 10. Chroma for key detection
+	if !fe.skipKey {
+		fe.addChroma(spectrum)
+	}
 
 	// Track onset strength for tempo detection
 	if flux > 0 {
-		fe.onsetStrengths = append(fe.onsetStrengths, flux)
+		fe.onsets.add(flux)
 	}
 
 	// Update previous spectrum for next frame's flux calculation
@@ -391,18 +586,12 @@ func (fe *FeatureExtractor) computeFinalFeatures() *AudioFeatures {
 	}
 
 	features := &AudioFeatures{}
+	n := float64(fe.frameCount)
 
 	// Average MFCCs and compute std dev
 	for i := 0; i < numMFCC; i++ {
-		var sum, sumSq float64
-		for _, mfcc := range fe.mfccAccum {
-			if i < len(mfcc) {
-				sum += mfcc[i]
-				sumSq += mfcc[i] * mfcc[i]
-			}
-		}
-		mean := sum / float64(len(fe.mfccAccum))
-		variance := sumSq/float64(len(fe.mfccAccum)) - mean*mean
+		mean := fe.mfccSum[i] / n
+		variance := fe.mfccSumSq[i]/n - mean*mean
 		features.MFCC[i] = float32(mean)
 		if variance > 0 {
 			features.MFCCStdDev[i] = float32(math.Sqrt(variance))
@@ -410,32 +599,21 @@ func (fe *FeatureExtractor) computeFinalFeatures() *AudioFeatures {
 	}
 
 	// Average other features
-	features.SpectralCentroid = float32(average(fe.centroidAccum) / 20000.0) // Normalize to 0-1
-	features.SpectralRolloff = float32(average(fe.rolloffAccum) / 20000.0)
-	features.SpectralFlux = float32(average(fe.fluxAccum))
-	features.ZeroCrossing = float32(average(fe.zcrAccum))
-	features.RMSEnergy = float32(average(fe.rmsAccum))
+	features.SpectralCentroid = float32(fe.centroidSum / n / 20000.0) // Normalize to 0-1
+	features.SpectralRolloff = float32(fe.rolloffSum / n / 20000.0)
+	features.SpectralFlux = float32(fe.fluxSum / n)
+	features.ZeroCrossing = float32(fe.zcrSum / n)
+	features.RMSEnergy = float32(fe.rmsSum / n)
 
 	// Band energies
-	var bassSum, midSum, trebleSum float64
-	for _, be := range fe.bandEnergyAccum {
-		if len(be) >= 3 {
-			bassSum += be[0]
-			midSum += be[1]
-			trebleSum += be[2]
-		}
-	}
-	n := float64(len(fe.bandEnergyAccum))
-	if n > 0 {
-		features.BassRatio = float32(bassSum / n)
-		features.MidRatio = float32(midSum / n)
-		features.TrebleRatio = float32(trebleSum / n)
-	}
+	features.BassRatio = float32(fe.bandEnergySum[0] / n)
+	features.MidRatio = float32(fe.bandEnergySum[1] / n)
+	features.TrebleRatio = float32(fe.bandEnergySum[2] / n)
 
 	// Contextual features
-	features.AttackSharpness = float32(average(fe.attackAccum))
-	features.DynamicRange = float32(computeDynamicRange(fe.rmsAccum))
-	features.RhythmComplexity = float32(computeRhythmComplexity(fe.onsetStrengths))
+	features.AttackSharpness = float32(fe.attackSum / n)
+	features.DynamicRange = float32(fe.rmsLevels.dynamicRange())
+	features.RhythmComplexity = float32(fe.onsets.rhythmComplexity())
 
 	// Tempo estimation
 	features.Tempo = float32(fe.estimateTempo())
@@ -447,9 +625,17 @@ func (fe *FeatureExtractor) computeFinalFeatures() *AudioFeatures {
 	}
 	features.HarmonicDensity = float32(math.Min(mfccVarSum/10.0, 1.0))
 
-	// Aggregate instrument profiles
-	if len(fe.instrumentAccum) > 0 {
-		features.Instruments = fe.aggregateInstrumentProfiles()
+	// Average instrument profiles
+	features.Instruments = fe.aggregateInstrumentProfiles()
+
+	// Musical key
+	features.Key, features.Mode, features.KeyStrength = estimateKey(fe.chroma)
+
+	if !fe.skipSilence {
+		features.Silence = fe.silence.silence(fe.sampleRate)
+	}
+	if !fe.skipLoudness {
+		features.Loudness = float32(fe.loudness.loudness())
 	}
 
 	return features
@@ -457,24 +643,12 @@ func (fe *FeatureExtractor) computeFinalFeatures() *AudioFeatures {
 
 // aggregateInstrumentProfiles averages instrument profiles across all frames
 func (fe *FeatureExtractor) aggregateInstrumentProfiles() InstrumentProfile {
-	if len(fe.instrumentAccum) == 0 {
+	if fe.frameCount == 0 {
 		return InstrumentProfile{}
 	}
 
-	n := float32(len(fe.instrumentAccum))
-	var result InstrumentProfile
-
-	for _, p := range fe.instrumentAccum {
-		result.BrassLike += p.BrassLike
-		result.StringLike += p.StringLike
-		result.WoodwindLike += p.WoodwindLike
-		result.Percussive += p.Percussive
-		result.SynthPad += p.SynthPad
-		result.VocalPresence += p.VocalPresence
-		result.ArticulationStyle += p.ArticulationStyle
-		result.EnsembleSize += p.EnsembleSize
-		result.PlayingIntensity += p.PlayingIntensity
-	}
+	n := float32(fe.frameCount)
+	result := fe.instrumentSum
 
 	result.BrassLike /= n
 	result.StringLike /= n
@@ -489,39 +663,27 @@ func (fe *FeatureExtractor) aggregateInstrumentProfiles() InstrumentProfile {
 	return result
 }
 
-// estimateTempo estimates BPM from onset strengths
+// estimateTempo estimates BPM from the autocorrelation of onset strengths
 func (fe *FeatureExtractor) estimateTempo() float64 {
-	if len(fe.onsetStrengths) < 10 {
+	if fe.onsets.count < 10 {
 		return 120.0 // Default
 	}
 
-	// Simple autocorrelation-based tempo estimation
-	hopDuration := float64(hopSize) / float64(fe.sampleRate)
-	minLag := int(60.0 / 200.0 / hopDuration) // 200 BPM max
-	maxLag := int(60.0 / 60.0 / hopDuration)  // 60 BPM min
-
-	if maxLag >= len(fe.onsetStrengths) {
-		maxLag = len(fe.onsetStrengths) - 1
-	}
-	if minLag < 1 {
-		minLag = 1
-	}
+	minLag := fe.onsets.minLag
+	maxLag := min(fe.onsets.maxLag, fe.onsets.count-1)
 
 	bestLag := minLag
 	bestCorr := 0.0
 
 	for lag := minLag; lag <= maxLag; lag++ {
-		var corr float64
-		for i := 0; i < len(fe.onsetStrengths)-lag; i++ {
-			corr += fe.onsetStrengths[i] * fe.onsetStrengths[i+lag]
-		}
-		if corr > bestCorr {
+		if corr := fe.onsets.corr[lag]; corr > bestCorr {
 			bestCorr = corr
 			bestLag = lag
 		}
 	}
 
 	// Convert lag to BPM
+	hopDuration := float64(hopSize) / float64(fe.sampleRate)
 	bpm := 60.0 / (float64(bestLag) * hopDuration)
 	// Constrain to reasonable range
 	if bpm < 60 {
@@ -570,12 +732,22 @@ func (f *AudioFeatures) ToBytes() []byte {
 		offset += 4
 	}
 
+	// Write key
+	buf[offset] = byte(f.Key)
+	buf[offset+1] = byte(f.Mode)
+	offset += 2
+	binary.LittleEndian.PutUint32(buf[offset:], math.Float32bits(f.KeyStrength))
+	offset += 4
+
 	return buf[:offset]
 }
 
 // FromBytes deserializes features from binary format
 func (f *AudioFeatures) FromBytes(data []byte) error {
-	if len(data) < 200 {
+	// 192 bytes is everything up to the end of the instrument profile, where
+	// records written before key detection stop. (The old minimum of 200 was
+	// more than ToBytes ever wrote, so nothing stored was ever read back.)
+	if len(data) < 192 {
 		return nil // Not enough data
 	}
 	offset := 0
@@ -636,6 +808,14 @@ func (f *AudioFeatures) FromBytes(data []byte) error {
 	f.Instruments.EnsembleSize = math.Float32frombits(binary.LittleEndian.Uint32(data[offset:]))
 	offset += 4
 	f.Instruments.PlayingIntensity = math.Float32frombits(binary.LittleEndian.Uint32(data[offset:]))
+	offset += 4
+
+	// Read key, missing from data written before key detection
+	if len(data) >= offset+6 {
+		f.Key = int(data[offset])
+		f.Mode = int(data[offset+1])
+		f.KeyStrength = math.Float32frombits(binary.LittleEndian.Uint32(data[offset+2:]))
+	}
 
 	return nil
 }
@@ -693,79 +873,118 @@ func createMelFilterbank(numFilters, fftSize, sampleRate int) [][]float64 {
 	return filters
 }
 
-func pcmToMono(data []byte, channels int) []float64 {
-	bytesPerSample := 2
-	samplesPerFrame := channels
-	numSamples := len(data) / (bytesPerSample * samplesPerFrame)
+// Level histogram resolution: levelsPerDecade bins per factor of ten between
+// minLevel and 1
+const (
+	minLevel        = 1e-6
+	levelsPerDecade = 100
+	levelBins       = 6 * levelsPerDecade
+)
 
-	samples := make([]float64, numSamples)
-	for i := 0; i < numSamples; i++ {
-		offset := i * bytesPerSample * samplesPerFrame
-		var sum float64
-		for ch := 0; ch < samplesPerFrame; ch++ {
-			chOffset := offset + ch*bytesPerSample
-			sample := int16(data[chOffset]) | int16(data[chOffset+1])<<8
-			sum += float64(sample) / 32768.0
-		}
-		samples[i] = sum / float64(samplesPerFrame)
+// levelHistogram counts RMS levels on a log scale so percentiles can be read
+// without keeping every frame. Levels are resolved to within about 2.3%.
+type levelHistogram struct {
+	silent int // Frames with an RMS of exactly 0
+	bins   [levelBins]int
+	total  int
+}
+
+func (h *levelHistogram) add(level float64) {
+	h.total++
+	if level <= 0 {
+		h.silent++
+		return
 	}
-	return samples
+	bin := int(math.Log10(level/minLevel) * levelsPerDecade)
+	h.bins[min(max(bin, 0), levelBins-1)]++
 }
 
-func average(values []float64) float64 {
-	if len(values) == 0 {
+// percentile returns the level at rank index (0-based) in sorted order
+func (h *levelHistogram) percentile(rank int) float64 {
+	if rank < h.silent {
 		return 0
 	}
-	var sum float64
-	for _, v := range values {
-		sum += v
+	seen := h.silent
+	for bin, count := range h.bins {
+		seen += count
+		if rank < seen {
+			return minLevel * math.Pow(10, (float64(bin)+0.5)/levelsPerDecade)
+		}
 	}
-	return sum / float64(len(values))
+	return 1
 }
 
-func computeDynamicRange(rmsValues []float64) float64 {
-	if len(rmsValues) < 2 {
+// dynamicRange compares loud (90th percentile) and quiet (10th percentile)
+// frames
+func (h *levelHistogram) dynamicRange() float64 {
+	if h.total < 2 {
 		return 0
 	}
-	// Find 10th and 90th percentile
-	sorted := make([]float64, len(rmsValues))
-	copy(sorted, rmsValues)
-	// Simple bubble sort for small arrays
-	for i := 0; i < len(sorted); i++ {
-		for j := i + 1; j < len(sorted); j++ {
-			if sorted[j] < sorted[i] {
-				sorted[i], sorted[j] = sorted[j], sorted[i]
-			}
-		}
-	}
-	p10 := sorted[len(sorted)/10]
-	p90 := sorted[len(sorted)*9/10]
+	p10 := h.percentile(h.total / 10)
+	p90 := h.percentile(h.total * 9 / 10)
 	if p10 == 0 {
 		return 0
 	}
 	return math.Min((p90-p10)/p10, 1.0)
 }
 
-func computeRhythmComplexity(onsets []float64) float64 {
-	if len(onsets) < 4 {
-		return 0
+// onsetStats accumulates what tempo and rhythm estimation need from the
+// sequence of onset strengths: autocorrelation at each candidate lag and the
+// spread of ratios between consecutive onsets
+type onsetStats struct {
+	minLag, maxLag int
+	recent         []float64 // Ring of the last maxLag onsets
+	corr           []float64 // Autocorrelation by lag
+	count          int
+
+	ratioCount int
+	ratioSum   float64
+	ratioSumSq float64
+}
+
+func newOnsetStats(minLag, maxLag int) onsetStats {
+	return onsetStats{
+		minLag: minLag,
+		maxLag: maxLag,
+		recent: make([]float64, max(maxLag, 1)),
+		corr:   make([]float64, max(maxLag, 1)+1),
 	}
-	// Measure irregularity of onset intervals
-	var intervals []float64
-	for i := 1; i < len(onsets); i++ {
-		if onsets[i] > 0 && onsets[i-1] > 0 {
-			intervals = append(intervals, onsets[i]/onsets[i-1])
-		}
+}
+
+func (o *onsetStats) reset() {
+	o.count = 0
+	for i := range o.corr {
+		o.corr[i] = 0
 	}
-	if len(intervals) < 2 {
-		return 0
+	o.ratioCount = 0
+	o.ratioSum = 0
+	o.ratioSumSq = 0
+}
+
+// add records the next onset strength (always positive)
+func (o *onsetStats) add(onset float64) {
+	size := len(o.recent)
+	for lag := 1; lag <= o.maxLag && lag <= o.count; lag++ {
+		o.corr[lag] += onset * o.recent[(o.count-lag)%size]
+	}
+	if o.count > 0 {
+		ratio := onset / o.recent[(o.count-1)%size]
+		o.ratioCount++
+		o.ratioSum += ratio
+		o.ratioSumSq += ratio * ratio
 	}
-	// Higher variance = more complex rhythm
-	avg := average(intervals)
-	var variance float64
-	for _, v := range intervals {
-		variance += (v - avg) * (v - avg)
+	o.recent[o.count%size] = onset
+	o.count++
+}
+
+// rhythmComplexity measures how irregular the onsets are: a higher variance
+// in the ratio between consecutive onsets means a more complex rhythm
+func (o *onsetStats) rhythmComplexity() float64 {
+	if o.count < 4 || o.ratioCount < 2 {
+		return 0
 	}
-	variance /= float64(len(intervals))
-	return math.Min(variance, 1.0)
+	n := float64(o.ratioCount)
+	mean := o.ratioSum / n
+	variance := o.ratioSumSq/n - mean*mean
+	return math.Min(math.Max(variance, 0), 1.0)
 }
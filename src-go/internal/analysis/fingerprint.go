@@ -0,0 +1,190 @@
+package analysis
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Fingerprint is a Chromaprint acoustic fingerprint, as used by AcoustID
+type Fingerprint struct {
+	Duration    int    `json:"duration"` // seconds
+	Fingerprint string `json:"fingerprint"`
+}
+
+// FindFpcalc returns the path of Chromaprint's fpcalc tool, or "" if it
+// isn't installed
+func FindFpcalc() string {
+	path, _ := exec.LookPath("fpcalc")
+	return path
+}
+
+// ComputeFingerprint runs fpcalc on a file
+func ComputeFingerprint(ctx context.Context, fpcalcPath, path string) (*Fingerprint, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, fpcalcPath, "-json", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("fpcalc: %w", err)
+	}
+
+	var result struct {
+		Duration    float64 `json:"duration"`
+		Fingerprint string  `json:"fingerprint"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("fpcalc output: %w", err)
+	}
+	if result.Fingerprint == "" {
+		return nil, fmt.Errorf("fpcalc returned no fingerprint")
+	}
+	return &Fingerprint{Duration: int(result.Duration), Fingerprint: result.Fingerprint}, nil
+}
+
+const (
+	// fingerprintMaxShift is how many fingerprint items (about 0.12s each)
+	// two encodes may be out of step by, from encoder delay and padding
+	fingerprintMaxShift = 16
+
+	// fingerprintMatchThreshold is the share of bits two fingerprints must
+	// agree on to be the same recording. Encodes of one recording agree on
+	// well over 90%, unrelated audio on about half.
+	fingerprintMatchThreshold = 0.85
+
+	// fingerprintDurationSlack is how far apart in seconds the lengths of
+	// two encodes of a recording may be
+	fingerprintDurationSlack = 2
+)
+
+// SameRecording reports whether two fingerprints are of the same audio,
+// such as a track and its re-encode in another format
+func SameRecording(a, b *Fingerprint) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if !a.Spans(b.Duration) {
+		return false
+	}
+	if a.Fingerprint == b.Fingerprint {
+		return true
+	}
+	rawA, err := DecodeFingerprint(a.Fingerprint)
+	if err != nil {
+		return false
+	}
+	rawB, err := DecodeFingerprint(b.Fingerprint)
+	if err != nil {
+		return false
+	}
+	return fingerprintSimilarity(rawA, rawB) >= fingerprintMatchThreshold
+}
+
+// Spans reports whether a track of the given length in seconds could be the
+// recording the fingerprint was taken from
+func (fp *Fingerprint) Spans(seconds int) bool {
+	diff := fp.Duration - seconds
+	return diff <= fingerprintDurationSlack && diff >= -fingerprintDurationSlack
+}
+
+// fingerprintSimilarity returns the share of bits two raw fingerprints agree
+// on, at the offset where they line up best
+func fingerprintSimilarity(a, b []uint32) float64 {
+	best := 0.0
+	for shift := -fingerprintMaxShift; shift <= fingerprintMaxShift; shift++ {
+		i, j := max(shift, 0), max(-shift, 0)
+		n := min(len(a)-i, len(b)-j)
+		// Too little overlap says nothing
+		if n <= 0 || n < min(len(a), len(b))/2 {
+			continue
+		}
+		differing := 0
+		for k := 0; k < n; k++ {
+			differing += bits.OnesCount32(a[i+k] ^ b[j+k])
+		}
+		best = max(best, 1-float64(differing)/float64(32*n))
+	}
+	return best
+}
+
+// DecodeFingerprint unpacks a fingerprint as fpcalc prints it into the raw
+// 32-bit items Chromaprint computes. The compressed form stores each item
+// XORed with the one before as the gaps between its set bits, three bits a
+// gap with larger gaps continued in a second run of five-bit values.
+func DecodeFingerprint(encoded string) ([]uint32, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, fmt.Errorf("decode fingerprint: %w", err)
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("fingerprint too short")
+	}
+	size := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	packed := data[4:]
+
+	// Gaps run until each of the items has ended with a zero
+	var gaps []int
+	exceptions := 0
+	for ended := 0; ended < size; {
+		if (len(gaps)+1)*3 > len(packed)*8 {
+			return nil, fmt.Errorf("fingerprint truncated")
+		}
+		gap := unpackBits(packed, len(gaps)*3, 3)
+		switch gap {
+		case 0:
+			ended++
+		case 7:
+			exceptions++
+		}
+		gaps = append(gaps, gap)
+	}
+
+	extra := packed[(len(gaps)*3+7)/8:]
+	if exceptions*5 > len(extra)*8 {
+		return nil, fmt.Errorf("fingerprint truncated")
+	}
+	for i, e := 0, 0; i < len(gaps); i++ {
+		if gaps[i] == 7 {
+			gaps[i] += unpackBits(extra, e*5, 5)
+			e++
+		}
+	}
+
+	raw := make([]uint32, 0, size)
+	var item uint32
+	bit := 0
+	for _, gap := range gaps {
+		if gap == 0 {
+			if len(raw) > 0 {
+				item ^= raw[len(raw)-1]
+			}
+			raw = append(raw, item)
+			item, bit = 0, 0
+			continue
+		}
+		bit += gap
+		if bit > 32 {
+			return nil, fmt.Errorf("fingerprint corrupt")
+		}
+		item |= 1 << (bit - 1)
+	}
+	return raw, nil
+}
+
+// unpackBits reads the width-bit value starting offset bits into data, with
+// bits packed least significant first
+func unpackBits(data []byte, offset, width int) int {
+	value := 0
+	for i := 0; i < width; i++ {
+		pos := offset + i
+		if data[pos/8]&(1<<(pos%8)) != 0 {
+			value |= 1 << i
+		}
+	}
+	return value
+}
@@ -0,0 +1,112 @@
+package analysis
+
+import (
+	"encoding/base64"
+	"math/rand"
+	"testing"
+)
+
+// encodeFingerprint compresses raw items the way Chromaprint does
+func encodeFingerprint(raw []uint32) string {
+	var gaps []int
+	for i, item := range raw {
+		if i > 0 {
+			item ^= raw[i-1]
+		}
+		last := 0
+		for bit := 1; item != 0; bit++ {
+			if item&1 != 0 {
+				gaps = append(gaps, bit-last)
+				last = bit
+			}
+			item >>= 1
+		}
+		gaps = append(gaps, 0)
+	}
+
+	var normal, extra []int
+	for _, gap := range gaps {
+		normal = append(normal, min(gap, 7))
+		if gap >= 7 {
+			extra = append(extra, gap-7)
+		}
+	}
+
+	data := []byte{1, byte(len(raw) >> 16), byte(len(raw) >> 8), byte(len(raw))}
+	data = append(data, packBits(normal, 3)...)
+	data = append(data, packBits(extra, 5)...)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func packBits(values []int, width int) []byte {
+	data := make([]byte, (len(values)*width+7)/8)
+	for i, v := range values {
+		for b := 0; b < width; b++ {
+			if v&(1<<b) != 0 {
+				pos := i*width + b
+				data[pos/8] |= 1 << (pos % 8)
+			}
+		}
+	}
+	return data
+}
+
+func randomFingerprint(rng *rand.Rand, n int) []uint32 {
+	raw := make([]uint32, n)
+	for i := range raw {
+		raw[i] = rng.Uint32()
+	}
+	return raw
+}
+
+func TestDecodeFingerprint(t *testing.T) {
+	raw := randomFingerprint(rand.New(rand.NewSource(1)), 200)
+	raw[10] = 0
+	raw[11] = 1 << 31 // A gap long enough to need the second run
+
+	decoded, err := DecodeFingerprint(encodeFingerprint(raw))
+	if err != nil {
+		t.Fatalf("DecodeFingerprint: %v", err)
+	}
+	if len(decoded) != len(raw) {
+		t.Fatalf("expected %d items, got %d", len(raw), len(decoded))
+	}
+	for i := range raw {
+		if decoded[i] != raw[i] {
+			t.Fatalf("item %d: expected %08x, got %08x", i, raw[i], decoded[i])
+		}
+	}
+
+	if _, err := DecodeFingerprint(encodeFingerprint(raw)[:40]); err == nil {
+		t.Error("expected a truncated fingerprint to fail")
+	}
+}
+
+func TestSameRecording(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	original := randomFingerprint(rng, 1000)
+
+	// A re-encode starts a few items late and differs in some bits
+	reencoded := append([]uint32(nil), original[3:]...)
+	for i := range reencoded {
+		if rng.Intn(4) == 0 {
+			reencoded[i] ^= 1 << rng.Intn(32)
+		}
+	}
+
+	a := &Fingerprint{Duration: 120, Fingerprint: encodeFingerprint(original)}
+	b := &Fingerprint{Duration: 119, Fingerprint: encodeFingerprint(reencoded)}
+	if !SameRecording(a, b) {
+		t.Error("expected a re-encode to match")
+	}
+
+	other := &Fingerprint{Duration: 120, Fingerprint: encodeFingerprint(randomFingerprint(rng, 1000))}
+	if SameRecording(a, other) {
+		t.Error("expected different audio not to match")
+	}
+
+	b.Duration = 130
+	if SameRecording(a, b) {
+		t.Error("expected tracks of different lengths not to match")
+	}
+}
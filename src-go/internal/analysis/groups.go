@@ -0,0 +1,122 @@
+package analysis
+
+// Feature groups. Each group is versioned on its own, so changing how one is
+// computed only re-analyzes that group.
+const (
+	GroupTimbre      = "timbre"      // MFCCs, spectral shape, band ratios, harmonic density
+	GroupRhythm      = "rhythm"      // Tempo, rhythm complexity
+	GroupDynamics    = "dynamics"    // Attack sharpness, dynamic range
+	GroupInstruments = "instruments" // Instrument profile
+	GroupKey         = "key"         // Musical key and mode
+	GroupSilence     = "silence"     // Silence at the start and end
+	GroupLoudness    = "loudness"    // Integrated loudness
+)
+
+// FeatureGroups lists every feature group
+var FeatureGroups = []string{GroupTimbre, GroupRhythm, GroupDynamics, GroupInstruments, GroupKey, GroupSilence, GroupLoudness}
+
+// FeatureGroupVersions is the current version of each feature group. Bump a
+// group when its features change; tracks analyzed with an older version get
+// just that group recomputed.
+var FeatureGroupVersions = map[string]int{
+	GroupTimbre:      1,
+	GroupRhythm:      1,
+	GroupDynamics:    1,
+	GroupInstruments: 1,
+	GroupKey:         1,
+	GroupSilence:     1,
+	GroupLoudness:    1,
+}
+
+// currentGroupVersions returns the versions to record for groups
+func currentGroupVersions(groups []string) map[string]int {
+	versions := make(map[string]int, len(groups))
+	for _, group := range groups {
+		versions[group] = FeatureGroupVersions[group]
+	}
+	return versions
+}
+
+// legacyGroups are the groups that existed before groups were versioned
+var legacyGroups = []string{GroupTimbre, GroupRhythm, GroupDynamics, GroupInstruments}
+
+// legacyGroupVersions gives features stored before groups were versioned a
+// version for each group they have. Those groups started out at version 1,
+// which was FeatureVersion at the time.
+func legacyGroupVersions(version int) map[string]int {
+	versions := make(map[string]int, len(legacyGroups))
+	for _, group := range legacyGroups {
+		versions[group] = min(version, 1)
+	}
+	return versions
+}
+
+// StaleGroups returns the groups stored at an older version than the current
+// one, in FeatureGroups order
+func (f *StoredFeatures) StaleGroups() []string {
+	var stale []string
+	for _, group := range FeatureGroups {
+		if f.Groups[group] < FeatureGroupVersions[group] {
+			stale = append(stale, group)
+		}
+	}
+	return stale
+}
+
+// normalizeGroups returns the known groups in FeatureGroups order, or nil if
+// groups covers all of them
+func normalizeGroups(groups []string) []string {
+	if len(groups) == 0 {
+		return nil
+	}
+	want := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		want[group] = true
+	}
+	var result []string
+	for _, group := range FeatureGroups {
+		if want[group] {
+			result = append(result, group)
+		}
+	}
+	if len(result) == len(FeatureGroups) {
+		return nil
+	}
+	return result
+}
+
+// mergeGroups copies the features of groups from src into dst
+func mergeGroups(dst, src *AudioFeatures, groups []string) {
+	for _, group := range groups {
+		switch group {
+		case GroupTimbre:
+			dst.MFCC = src.MFCC
+			dst.MFCCStdDev = src.MFCCStdDev
+			dst.SpectralCentroid = src.SpectralCentroid
+			dst.SpectralRolloff = src.SpectralRolloff
+			dst.SpectralFlux = src.SpectralFlux
+			dst.ZeroCrossing = src.ZeroCrossing
+			dst.RMSEnergy = src.RMSEnergy
+			dst.BassRatio = src.BassRatio
+			dst.MidRatio = src.MidRatio
+			dst.TrebleRatio = src.TrebleRatio
+			dst.HarmonicDensity = src.HarmonicDensity
+		case GroupRhythm:
+			dst.Tempo = src.Tempo
+			dst.RhythmComplexity = src.RhythmComplexity
+		case GroupDynamics:
+			dst.AttackSharpness = src.AttackSharpness
+			dst.DynamicRange = src.DynamicRange
+		case GroupInstruments:
+			dst.Instruments = src.Instruments
+		case GroupKey:
+			dst.Key = src.Key
+			dst.Mode = src.Mode
+			dst.KeyStrength = src.KeyStrength
+		case GroupSilence:
+			dst.Silence = src.Silence
+		case GroupLoudness:
+			dst.Loudness = src.Loudness
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// bumpGroupVersion raises a group's current version for the rest of the test,
+// as a release that changes how the group is computed would
+func bumpGroupVersion(t *testing.T, group string) int {
+	t.Helper()
+	old := FeatureGroupVersions[group]
+	FeatureGroupVersions[group] = old + 1
+	t.Cleanup(func() { FeatureGroupVersions[group] = old })
+	return old + 1
+}
+
+func TestNormalizeGroups(t *testing.T) {
+	tests := []struct {
+		groups []string
+		want   []string
+	}{
+		{nil, nil},
+		{FeatureGroups, nil}, // All of them
+		{[]string{GroupKey, "unknown", GroupTimbre, GroupKey}, []string{GroupTimbre, GroupKey}},
+	}
+	for _, tt := range tests {
+		if got := normalizeGroups(tt.groups); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeGroups(%v) = %v, want %v", tt.groups, got, tt.want)
+		}
+	}
+}
+
+func TestStoreFeatureGroupsKeepsOtherGroups(t *testing.T) {
+	store, err := NewFeatureStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFeatureStore failed: %v", err)
+	}
+	defer store.Close()
+
+	const path = "/music/a.flac"
+	store.StoreFeatures(path, &AudioFeatures{Tempo: 120, Key: 9, Mode: KeyMinor, KeyStrength: 0.8}, FeatureVersion, "hash")
+	if stale, ok := store.StaleGroups(path); !ok || len(stale) != 0 {
+		t.Fatalf("Expected a fresh analysis up to date, got %v, %v", stale, ok)
+	}
+	if _, ok := store.StaleGroups("/music/none.flac"); ok {
+		t.Error("Expected no groups for a track never analyzed")
+	}
+
+	keyVersion := bumpGroupVersion(t, GroupKey)
+	if stale, _ := store.StaleGroups(path); !reflect.DeepEqual(stale, []string{GroupKey}) {
+		t.Fatalf("Expected only the key group stale, got %v", stale)
+	}
+
+	before, _ := store.GetFeatures(path)
+	store.StoreFeatureGroups(path, &AudioFeatures{Tempo: 60, Key: 0, Mode: KeyMajor, KeyStrength: 0.9}, []string{GroupKey}, "hash")
+	after, _ := store.GetFeatures(path)
+	if after.Features.Key != 0 || after.Features.Mode != KeyMajor || after.Features.Tempo != 120 {
+		t.Errorf("Expected the new key and the old tempo, got %+v", after.Features)
+	}
+	if after.Groups[GroupKey] != keyVersion || after.Version != FeatureVersion {
+		t.Errorf("Expected the key group at version %d, got %v", keyVersion, after.Groups)
+	}
+	if before.Features.Key != 9 {
+		t.Error("Expected features already handed out left alone")
+	}
+	if stale, _ := store.StaleGroups(path); len(stale) != 0 {
+		t.Errorf("Expected nothing stale after re-analysis, got %v", stale)
+	}
+
+	// A changed file keeps nothing of its old analysis
+	store.StoreFeatureGroups(path, &AudioFeatures{Tempo: 60, Key: 2, KeyStrength: 0.9}, []string{GroupKey}, "changed")
+	after, _ = store.GetFeatures(path)
+	if after.Features.Tempo != 60 || after.Features.Key != 2 {
+		t.Errorf("Expected only the new features, got %+v", after.Features)
+	}
+	if stale, _ := store.StaleGroups(path); len(stale) != len(FeatureGroups)-1 {
+		t.Errorf("Expected every other group stale, got %v", stale)
+	}
+}
+
+func TestLegacyFeaturesHaveOldGroups(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"features": {"/music/a.flac": {"features": {"Tempo": 120}, "version": 1, "fileHash": "a"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "audio_analysis.json"), []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewFeatureStore(dir)
+	if err != nil {
+		t.Fatalf("NewFeatureStore failed: %v", err)
+	}
+	defer store.Close()
+
+	// Groups added since then are all that's left to compute
+	want := []string{GroupKey, GroupSilence, GroupLoudness}
+	if stale, _ := store.StaleGroups("/music/a.flac"); !reflect.DeepEqual(stale, want) {
+		t.Errorf("Expected %v stale, got %v", want, stale)
+	}
+}
+
+func TestExtractorSetGroups(t *testing.T) {
+	samples := sineSignal(440, 0.5, 2)
+	extractor := NewFeatureExtractor(descriptorSampleRate)
+
+	extractor.SetGroups([]string{GroupKey})
+	partial := extractor.ProcessAudio(samples)
+	if partial.MFCC != [numMFCC]float32{} || partial.Instruments != (InstrumentProfile{}) {
+		t.Errorf("Expected groups left out not computed, got MFCC %v and %+v", partial.MFCC, partial.Instruments)
+	}
+	if partial.KeyStrength == 0 {
+		t.Error("Expected the key group computed")
+	}
+
+	extractor.SetGroups(nil)
+	full := extractor.ProcessAudio(samples)
+	if full.MFCC == [numMFCC]float32{} || full.Instruments == (InstrumentProfile{}) {
+		t.Error("Expected every group computed again")
+	}
+}
+
+func TestJobKeepsGroups(t *testing.T) {
+	dir := t.TempDir()
+	jobs := NewJobStore(dir)
+	tracks := []TrackInfo{
+		{Path: "/music/a.flac"},
+		{Path: "/music/b.flac", Groups: []string{GroupKey}},
+	}
+	if err := jobs.Begin(tracks); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+
+	// An interrupted run picks up the same partial re-analysis
+	resumed := NewJobStore(dir)
+	if err := resumed.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := resumed.Pending(); !reflect.DeepEqual(got, tracks) {
+		t.Errorf("Expected %+v pending, got %+v", tracks, got)
+	}
+}
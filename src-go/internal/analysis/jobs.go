@@ -0,0 +1,229 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+// Job track states
+const (
+	JobPending = "pending"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// JobTrack is a track in a persisted analysis run
+type JobTrack struct {
+	Path        string   `json:"path"`
+	Fingerprint bool     `json:"fingerprint,omitempty"`
+	Groups      []string `json:"groups,omitempty"` // Feature groups to recompute; empty means all
+	Status      string   `json:"status"`           // "pending", "done", "failed"
+	Error       string   `json:"error,omitempty"`
+}
+
+// Job is an analysis run saved to disk
+type Job struct {
+	StartedAt int64      `json:"startedAt"`
+	Paused    bool       `json:"paused"`
+	Tracks    []JobTrack `json:"tracks"`
+}
+
+// JobStore keeps the track list of the current analysis run on disk so an
+// interrupted run can pick up where it left off after a restart
+type JobStore struct {
+	mu       sync.Mutex
+	filePath string
+	job      *Job
+	index    map[string]int // Path -> position in job.Tracks
+	dirty    bool
+}
+
+// NewJobStore creates a job store in dataDir
+func NewJobStore(dataDir string) *JobStore {
+	return &JobStore{
+		filePath: filepath.Join(dataDir, "analysis_job.json"),
+	}
+}
+
+// Load reads a saved run from disk. A missing file means no run is pending.
+func (s *JobStore) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read job: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return fmt.Errorf("unmarshal job: %w", err)
+	}
+	s.setJobLocked(&job)
+	return nil
+}
+
+// Begin records a new run over tracks, replacing any previous one
+func (s *JobStore) Begin(tracks []TrackInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := &Job{
+		StartedAt: time.Now().Unix(),
+		Tracks:    make([]JobTrack, len(tracks)),
+	}
+	for i, track := range tracks {
+		job.Tracks[i] = JobTrack{Path: track.Path, Fingerprint: track.Fingerprint, Groups: track.Groups, Status: JobPending}
+	}
+	s.setJobLocked(job)
+	return s.saveLocked()
+}
+
+// Pending returns the tracks of the saved run that haven't been analyzed
+func (s *JobStore) Pending() []TrackInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.job == nil {
+		return nil
+	}
+	var tracks []TrackInfo
+	for _, t := range s.job.Tracks {
+		if t.Status == JobPending {
+			tracks = append(tracks, TrackInfo{Path: t.Path, Fingerprint: t.Fingerprint, Groups: t.Groups})
+		}
+	}
+	return tracks
+}
+
+// Counts returns the number of tracks in the saved run and how many of them
+// finished or failed
+func (s *JobStore) Counts() (total, done, failed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.job == nil {
+		return 0, 0, 0
+	}
+	for _, t := range s.job.Tracks {
+		switch t.Status {
+		case JobDone:
+			done++
+		case JobFailed:
+			failed++
+		}
+	}
+	return len(s.job.Tracks), done, failed
+}
+
+// StartedAt returns when the saved run began, or 0 without one
+func (s *JobStore) StartedAt() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.job == nil {
+		return 0
+	}
+	return s.job.StartedAt
+}
+
+// Paused reports whether the saved run was paused
+func (s *JobStore) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.job != nil && s.job.Paused
+}
+
+// SetPaused records whether the run is paused and saves it right away
+func (s *JobStore) SetPaused(paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.job == nil || s.job.Paused == paused {
+		return nil
+	}
+	s.job.Paused = paused
+	return s.saveLocked()
+}
+
+// Finish records the outcome of a track. It is written by the next Save.
+func (s *JobStore) Finish(path string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.index[path]
+	if !ok {
+		return
+	}
+	if err != nil {
+		s.job.Tracks[i].Status = JobFailed
+		s.job.Tracks[i].Error = err.Error()
+	} else {
+		s.job.Tracks[i].Status = JobDone
+		s.job.Tracks[i].Error = ""
+	}
+	s.dirty = true
+}
+
+// Save writes the run to disk if it changed since the last save
+func (s *JobStore) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.job == nil || !s.dirty {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// Clear forgets the run and removes it from disk
+func (s *JobStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.job = nil
+	s.index = nil
+	s.dirty = false
+	if err := os.Remove(s.filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove job: %w", err)
+	}
+	return nil
+}
+
+// setJobLocked replaces the run (must be called with lock held)
+func (s *JobStore) setJobLocked(job *Job) {
+	s.job = job
+	s.index = make(map[string]int, len(job.Tracks))
+	for i, t := range job.Tracks {
+		s.index[t.Path] = i
+	}
+	s.dirty = false
+}
+
+// saveLocked writes the run to disk (must be called with lock held)
+func (s *JobStore) saveLocked() error {
+	data, err := json.Marshal(s.job)
+	if err != nil {
+		return fmt.Errorf("marshal job: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0700); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+
+	if err := atomicfile.Write(s.filePath, data); err != nil {
+		return fmt.Errorf("write job: %w", err)
+	}
+
+	s.dirty = false
+	return nil
+}
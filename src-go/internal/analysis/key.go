@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+)
+
+// Key modes
+const (
+	KeyMinor = 0
+	KeyMajor = 1
+)
+
+const (
+	// Frequency range used for the chroma: below it the FFT bins are wider
+	// than a semitone, above it harmonics blur the pitch classes
+	chromaMinHz = 65.0
+	chromaMaxHz = 4200.0
+)
+
+var pitchClassNames = [12]string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+
+// Krumhansl-Kessler key profiles, starting at the tonic
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// chromaBinMap returns the pitch class (0=C) of each spectrum bin, or -1 for
+// bins outside the chroma range
+func chromaBinMap(fftSize, sampleRate int) []int {
+	bins := make([]int, fftSize/2)
+	freqPerBin := float64(sampleRate) / float64(fftSize)
+	for i := range bins {
+		freq := float64(i) * freqPerBin
+		if freq < chromaMinHz || freq > chromaMaxHz {
+			bins[i] = -1
+			continue
+		}
+		// MIDI note 69 is A440
+		note := int(math.Round(69 + 12*math.Log2(freq/440)))
+		bins[i] = note % 12
+	}
+	return bins
+}
+
+// addChroma folds a frame's spectrum into pitch classes and adds it to the
+// running chroma. Each frame is normalized so loud passages don't outweigh
+// quiet ones.
+func (fe *FeatureExtractor) addChroma(spectrum []float64) {
+	var frame [12]float64
+	for i, pc := range fe.chromaBins {
+		if pc >= 0 {
+			frame[pc] += spectrum[i] * spectrum[i]
+		}
+	}
+
+	var peak float64
+	for _, v := range frame {
+		peak = math.Max(peak, v)
+	}
+	if peak == 0 {
+		return
+	}
+	for pc, v := range frame {
+		fe.chroma[pc] += v / peak
+	}
+}
+
+// estimateKey picks the key whose profile correlates best with the chroma.
+// It returns the tonic pitch class, the mode and the correlation (0-1) as a
+// confidence; a confidence of 0 means no key could be estimated.
+func estimateKey(chroma [12]float64) (int, int, float32) {
+	bestKey, bestMode := 0, KeyMajor
+	bestCorr := 0.0
+
+	for tonic := 0; tonic < 12; tonic++ {
+		var rotated [12]float64
+		for i := range rotated {
+			rotated[i] = chroma[(tonic+i)%12]
+		}
+		if corr := pearson(rotated, majorProfile); corr > bestCorr {
+			bestKey, bestMode, bestCorr = tonic, KeyMajor, corr
+		}
+		if corr := pearson(rotated, minorProfile); corr > bestCorr {
+			bestKey, bestMode, bestCorr = tonic, KeyMinor, corr
+		}
+	}
+
+	return bestKey, bestMode, float32(math.Min(bestCorr, 1))
+}
+
+// pearson returns the correlation coefficient of a and b
+func pearson(a, b [12]float64) float64 {
+	var meanA, meanB float64
+	for i := range a {
+		meanA += a[i]
+		meanB += b[i]
+	}
+	meanA /= 12
+	meanB /= 12
+
+	var cov, varA, varB float64
+	for i := range a {
+		da, db := a[i]-meanA, b[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+// PitchClassName returns the note name of a pitch class, such as "Eb"
+func PitchClassName(key int) string {
+	return pitchClassNames[((key%12)+12)%12]
+}
+
+// ModeName returns "major" or "minor"
+func ModeName(mode int) string {
+	if mode == KeyMajor {
+		return "major"
+	}
+	return "minor"
+}
+
+// KeyName returns a readable key such as "A minor"
+func KeyName(key, mode int) string {
+	return PitchClassName(key) + " " + ModeName(mode)
+}
+
+// camelotNumber returns the position of a key on the Camelot wheel (1-12).
+// Neighbouring numbers are a fifth apart and a minor key shares its number
+// with its relative major.
+func camelotNumber(key, mode int) int {
+	if mode == KeyMinor {
+		key += 3 // Relative major
+	}
+	return (((key%12)+12)%12*7+7)%12 + 1
+}
+
+// CamelotKey returns the Camelot notation DJs use for harmonic mixing, such
+// as "8B" for C major and "8A" for A minor
+func CamelotKey(key, mode int) string {
+	letter := "A"
+	if mode == KeyMajor {
+		letter = "B"
+	}
+	return fmt.Sprintf("%d%s", camelotNumber(key, mode), letter)
+}
@@ -0,0 +1,153 @@
+package analysis
+
+import "testing"
+
+// scaleChroma returns a chroma with the tonic triad of key strongest, then
+// the rest of its scale
+func scaleChroma(tonic int, mode int) [12]float64 {
+	steps := []int{0, 2, 4, 5, 7, 9, 11} // Major scale
+	if mode == KeyMinor {
+		steps = []int{0, 2, 3, 5, 7, 8, 10} // Natural minor
+	}
+	var chroma [12]float64
+	for _, step := range steps {
+		chroma[(tonic+step)%12] = 0.4
+	}
+	chroma[tonic] = 1
+	chroma[(tonic+steps[2])%12] = 0.8 // Third
+	chroma[(tonic+7)%12] = 0.9        // Fifth
+	return chroma
+}
+
+func TestEstimateKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		chroma      [12]float64
+		key, mode   int
+		wantCamelot string
+	}{
+		{"C major", scaleChroma(0, KeyMajor), 0, KeyMajor, "8B"},
+		{"A minor", scaleChroma(9, KeyMinor), 9, KeyMinor, "8A"},
+		{"G major", scaleChroma(7, KeyMajor), 7, KeyMajor, "9B"},
+		{"Eb minor", scaleChroma(3, KeyMinor), 3, KeyMinor, "2A"},
+	}
+	for _, tt := range tests {
+		key, mode, strength := estimateKey(tt.chroma)
+		if key != tt.key || mode != tt.mode {
+			t.Errorf("%s: estimated %s", tt.name, KeyName(key, mode))
+		}
+		if strength < 0.5 || strength > 1 {
+			t.Errorf("%s: expected a confident estimate, got %v", tt.name, strength)
+		}
+		if got := CamelotKey(key, mode); got != tt.wantCamelot {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.wantCamelot, got)
+		}
+	}
+
+	// A flat chroma has no key
+	if _, _, strength := estimateKey([12]float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}); strength != 0 {
+		t.Errorf("Expected no key for a flat chroma, got strength %v", strength)
+	}
+}
+
+func TestCamelotKey(t *testing.T) {
+	tests := []struct {
+		key, mode int
+		want      string
+	}{
+		{0, KeyMajor, "8B"},  // C
+		{9, KeyMinor, "8A"},  // Am
+		{7, KeyMajor, "9B"},  // G
+		{4, KeyMinor, "9A"},  // Em
+		{5, KeyMajor, "7B"},  // F
+		{2, KeyMinor, "7A"},  // Dm
+		{11, KeyMajor, "1B"}, // B
+		{8, KeyMinor, "1A"},  // Abm
+		{4, KeyMajor, "12B"}, // E
+		{1, KeyMinor, "12A"}, // C#m
+		{6, KeyMajor, "2B"},  // F#
+		{3, KeyMinor, "2A"},  // Ebm
+	}
+	for _, tt := range tests {
+		if got := CamelotKey(tt.key, tt.mode); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", KeyName(tt.key, tt.mode), tt.want, got)
+		}
+	}
+}
+
+func TestKeyDistance(t *testing.T) {
+	e := NewSimilarityEngine(nil)
+	key := func(k, mode int) *AudioFeatures {
+		return &AudioFeatures{Key: k, Mode: mode, KeyStrength: 0.8}
+	}
+	tests := []struct {
+		name  string
+		a, b  *AudioFeatures
+		steps int
+	}{
+		{"same key", key(0, KeyMajor), key(0, KeyMajor), 0},
+		{"relative minor", key(0, KeyMajor), key(9, KeyMinor), 1},
+		{"a fifth up", key(0, KeyMajor), key(7, KeyMajor), 1},
+		{"a fifth down", key(0, KeyMajor), key(5, KeyMajor), 1},
+		{"across 12 to 1", key(4, KeyMajor), key(11, KeyMajor), 1},
+		{"across 1 to 12, minor", key(8, KeyMinor), key(1, KeyMinor), 1},
+		{"two round the wheel", key(4, KeyMajor), key(6, KeyMajor), 2},
+		{"opposite", key(0, KeyMajor), key(6, KeyMajor), 6},
+		{"opposite and other mode", key(0, KeyMajor), key(3, KeyMinor), 6},
+	}
+	for _, tt := range tests {
+		dist, ok := e.keyDistance(tt.a, tt.b)
+		if !ok || dist != float32(tt.steps)/6 {
+			t.Errorf("%s: expected %d steps, got %v (%v)", tt.name, tt.steps, dist*6, ok)
+		}
+		if back, _ := e.keyDistance(tt.b, tt.a); back != dist {
+			t.Errorf("%s: expected the same distance both ways, got %v and %v", tt.name, dist, back)
+		}
+	}
+
+	if _, ok := e.keyDistance(key(0, KeyMajor), &AudioFeatures{}); ok {
+		t.Error("Expected no distance to a track without a key")
+	}
+}
+
+func TestChromaBinMap(t *testing.T) {
+	const fftSize, sampleRate = 8192, 44100
+	bins := chromaBinMap(fftSize, sampleRate)
+	bin := func(hz float64) int { return int(hz*fftSize/sampleRate + 0.5) }
+	for hz, want := range map[float64]int{440: 9, 261.63: 0, 392: 7, 155.56: 3} {
+		if got := bins[bin(hz)]; got != want {
+			t.Errorf("%vHz: expected %s, got %d", hz, PitchClassName(want), got)
+		}
+	}
+	if bins[bin(40)] != -1 || bins[bin(8000)] != -1 {
+		t.Error("Expected bins outside the chroma range left out")
+	}
+}
+
+func TestFeaturesBytesRoundTrip(t *testing.T) {
+	var f AudioFeatures
+	for i := range f.MFCC {
+		f.MFCC[i] = float32(i) + 0.5
+	}
+	f.Tempo = 128
+	f.Instruments.PlayingIntensity = 0.75
+	f.Key, f.Mode, f.KeyStrength = 9, KeyMinor, 0.82
+
+	data := f.ToBytes()
+	var got AudioFeatures
+	if err := got.FromBytes(data); err != nil {
+		t.Fatal(err)
+	}
+	if got != f {
+		t.Errorf("Expected %+v back, got %+v", f, got)
+	}
+
+	// Records from before key detection end after the instrument profile
+	var old AudioFeatures
+	if err := old.FromBytes(data[:192]); err != nil {
+		t.Fatal(err)
+	}
+	if old.Tempo != 128 || old.Instruments.PlayingIntensity != 0.75 || old.KeyStrength != 0 {
+		t.Errorf("Expected an old record read without a key, got %+v", old)
+	}
+}
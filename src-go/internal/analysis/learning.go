@@ -0,0 +1,297 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+const (
+	// How far one play or skip moves a weight, relative to how much the
+	// group stood out for that pair
+	learningRate = 0.02
+
+	// Weights never drop below this, so a feature group can't be switched
+	// off by a run of skips
+	minLearnedWeight = 0.02
+
+	// maxStoredTransitions caps how many track pairs keep their counts
+	maxStoredTransitions = 2000
+)
+
+// TransitionStats counts how often a track was played through or skipped
+// right after another one
+type TransitionStats struct {
+	Plays  int   `json:"plays"`
+	Skips  int   `json:"skips"`
+	LastAt int64 `json:"lastAt"`
+}
+
+// learnedState is what WeightLearner keeps on disk
+type learnedState struct {
+	Weights     FeatureWeights              `json:"weights"`
+	Plays       int                         `json:"plays"`
+	Skips       int                         `json:"skips"`
+	UpdatedAt   int64                       `json:"updatedAt"`
+	Transitions map[string]*TransitionStats `json:"transitions"` // "from\nto" -> counts
+}
+
+// Transition is a track pair with its counts
+type Transition struct {
+	From string
+	To   string
+	TransitionStats
+}
+
+// WeightLearner tunes the similarity weights from listening behaviour. A
+// track played through after another nudges the weights towards the feature
+// groups that rated the pair similar; a skip nudges them away. The weights
+// are kept in the data directory, so each user of the machine learns their
+// own.
+type WeightLearner struct {
+	mu       sync.Mutex
+	filePath string
+	state    learnedState
+}
+
+// NewWeightLearner creates a learner starting from DefaultWeights
+func NewWeightLearner(dataDir string) *WeightLearner {
+	return &WeightLearner{
+		filePath: filepath.Join(dataDir, "learned_weights.json"),
+		state:    newLearnedState(),
+	}
+}
+
+func newLearnedState() learnedState {
+	return learnedState{
+		Weights:     DefaultWeights(),
+		Transitions: make(map[string]*TransitionStats),
+	}
+}
+
+// Load reads learned weights from disk. A missing file means nothing was
+// learned yet.
+func (l *WeightLearner) Load() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := os.ReadFile(l.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read learned weights: %w", err)
+	}
+
+	state := newLearnedState()
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("unmarshal learned weights: %w", err)
+	}
+	if state.Transitions == nil {
+		state.Transitions = make(map[string]*TransitionStats)
+	}
+	l.state = state
+	return nil
+}
+
+// Weights returns the learned weights
+func (l *WeightLearner) Weights() FeatureWeights {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state.Weights
+}
+
+// Counts returns how many plays and skips have been learned from
+func (l *WeightLearner) Counts() (plays, skips int, updatedAt int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state.Plays, l.state.Skips, l.state.UpdatedAt
+}
+
+// Record learns from to having been played through (skipped false) or
+// skipped right after from. c compares the two tracks. Returns the updated
+// weights.
+func (l *WeightLearner) Record(from, to string, skipped bool, c SimilarityComponents) (FeatureWeights, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().Unix()
+	key := from + "\n" + to
+	stats, ok := l.state.Transitions[key]
+	if !ok {
+		stats = &TransitionStats{LastAt: now}
+		l.state.Transitions[key] = stats
+		l.trimLocked()
+	}
+	stats.LastAt = now
+	signal := float32(1)
+	if skipped {
+		stats.Skips++
+		l.state.Skips++
+		signal = -1
+	} else {
+		stats.Plays++
+		l.state.Plays++
+	}
+
+	l.state.Weights = adjustWeights(l.state.Weights, c, signal)
+	l.state.UpdatedAt = now
+	return l.state.Weights, l.saveLocked()
+}
+
+// Transitions returns up to limit track pairs, most skipped first
+func (l *WeightLearner) Transitions(limit int) []Transition {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make([]Transition, 0, len(l.state.Transitions))
+	for key, stats := range l.state.Transitions {
+		from, to := splitTransitionKey(key)
+		result = append(result, Transition{From: from, To: to, TransitionStats: *stats})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Skips != result[j].Skips {
+			return result[i].Skips > result[j].Skips
+		}
+		return result[i].LastAt > result[j].LastAt
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// Reset forgets everything learned and goes back to DefaultWeights
+func (l *WeightLearner) Reset() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.state = newLearnedState()
+	if err := os.Remove(l.filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove learned weights: %w", err)
+	}
+	return nil
+}
+
+// RelocatePaths rewrites the paths of moved tracks in the transition counts
+func (l *WeightLearner) RelocatePaths(rename func(path string) (string, bool)) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	moved := 0
+	transitions := make(map[string]*TransitionStats, len(l.state.Transitions))
+	for key, stats := range l.state.Transitions {
+		from, to := splitTransitionKey(key)
+		if newPath, ok := rename(from); ok && newPath != from {
+			from = newPath
+			moved++
+		}
+		if newPath, ok := rename(to); ok && newPath != to {
+			to = newPath
+			moved++
+		}
+		transitions[from+"\n"+to] = stats
+	}
+	l.state.Transitions = transitions
+
+	if moved > 0 {
+		if err := l.saveLocked(); err != nil {
+			log.Printf("[ANALYSIS] Failed to save relocated transitions: %v", err)
+		}
+	}
+	return moved
+}
+
+// adjustWeights moves each weight by how far its group's similarity sits from
+// the pair's average, in the direction of signal (+1 played, -1 skipped). The
+// total weight is kept the same so similarity scores stay comparable.
+func adjustWeights(w FeatureWeights, c SimilarityComponents, signal float32) FeatureWeights {
+	type component struct {
+		weight *float32
+		sim    float32
+	}
+	components := []component{
+		{&w.MFCC, c.MFCC},
+		{&w.Tempo, c.Tempo},
+		{&w.Spectral, c.Spectral},
+		{&w.Energy, c.Energy},
+		{&w.Bands, c.Bands},
+		{&w.Instruments, c.Instruments},
+		{&w.Context, c.Context},
+	}
+	if c.HasKey {
+		components = append(components, component{&w.Key, c.Key})
+	}
+
+	// Groups that can't be compared (such as an unknown tempo) are left alone
+	var usable []component
+	var mean float32
+	for _, comp := range components {
+		if math.IsNaN(float64(comp.sim)) || math.IsInf(float64(comp.sim), 0) {
+			continue
+		}
+		usable = append(usable, comp)
+		mean += comp.sim
+	}
+	if len(usable) < 2 {
+		return w
+	}
+	mean /= float32(len(usable))
+
+	var before, after float32
+	for _, comp := range usable {
+		before += *comp.weight
+		*comp.weight = max(*comp.weight+learningRate*signal*(comp.sim-mean), minLearnedWeight)
+		after += *comp.weight
+	}
+	for _, comp := range usable {
+		*comp.weight *= before / after
+	}
+	return w
+}
+
+func splitTransitionKey(key string) (from, to string) {
+	from, to, _ = strings.Cut(key, "\n")
+	return from, to
+}
+
+// trimLocked drops the least recently seen pairs beyond the cap (must be
+// called with lock held)
+func (l *WeightLearner) trimLocked() {
+	for len(l.state.Transitions) > maxStoredTransitions {
+		var oldestKey string
+		var oldest int64
+		for key, stats := range l.state.Transitions {
+			if oldestKey == "" || stats.LastAt < oldest {
+				oldestKey, oldest = key, stats.LastAt
+			}
+		}
+		delete(l.state.Transitions, oldestKey)
+	}
+}
+
+// saveLocked writes the learned state to disk (must be called with lock held)
+func (l *WeightLearner) saveLocked() error {
+	data, err := json.Marshal(l.state)
+	if err != nil {
+		return fmt.Errorf("marshal learned weights: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.filePath), 0700); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+
+	if err := atomicfile.Write(l.filePath, data); err != nil {
+		return fmt.Errorf("write learned weights: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package analysis
+
+import "math"
+
+// Gating of the integrated loudness, per ITU-R BS.1770-4
+const (
+	loudnessAbsoluteGate = -70.0 // LUFS
+	loudnessRelativeGate = -10.0 // LU below the ungated loudness
+	loudnessHops         = 4     // 100ms hops in each 400ms block
+	loudnessBinsPerLU    = 10
+	loudnessMaxLUFS      = 5.0
+)
+
+const loudnessBins = int((loudnessMaxLUFS - loudnessAbsoluteGate) * loudnessBinsPerLU)
+
+// kFilter is one stage of the K-weighting applied before loudness is
+// measured, with state for each channel
+type kFilter struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     []float64
+}
+
+func (f *kFilter) filter(ch int, x float64) float64 {
+	for ch >= len(f.x1) {
+		f.x1, f.x2 = append(f.x1, 0), append(f.x2, 0)
+		f.y1, f.y2 = append(f.y1, 0), append(f.y2, 0)
+	}
+	y := f.b0*x + f.b1*f.x1[ch] + f.b2*f.x2[ch] - f.a1*f.y1[ch] - f.a2*f.y2[ch]
+	f.x2[ch], f.x1[ch] = f.x1[ch], x
+	f.y2[ch], f.y1[ch] = f.y1[ch], y
+	return y
+}
+
+func (f *kFilter) reset() {
+	clear(f.x1)
+	clear(f.x2)
+	clear(f.y1)
+	clear(f.y2)
+}
+
+// newKWeighting returns the high shelf and high-pass filters of the
+// K-weighting curve for sampleRate
+func newKWeighting(sampleRate int) (shelf, highpass *kFilter) {
+	fs := float64(sampleRate)
+
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf = &kFilter{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / fs)
+	a0 = 1 + k/q + k*k
+	highpass = &kFilter{
+		b0: 1, b1: -2, b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highpass
+}
+
+// loudnessMeter measures the integrated loudness of a track in LUFS from
+// overlapping 400ms blocks. Block loudness is counted in a histogram, so
+// gating needs no memory per block.
+type loudnessMeter struct {
+	shelf, highpass *kFilter
+	hopFrames       int
+
+	hopEnergy  [loudnessHops]float64 // Weighted sums of squares of recent hops
+	hopFill    int                   // Frames in the current hop
+	hops       int
+	blocks     [loudnessBins]int
+	blockPower [loudnessBins]float64
+}
+
+func newLoudnessMeter(sampleRate int) *loudnessMeter {
+	shelf, highpass := newKWeighting(sampleRate)
+	return &loudnessMeter{shelf: shelf, highpass: highpass, hopFrames: sampleRate / 10}
+}
+
+func (m *loudnessMeter) reset() {
+	m.shelf.reset()
+	m.highpass.reset()
+	m.hopEnergy = [loudnessHops]float64{}
+	m.hopFill = 0
+	m.hops = 0
+	m.blocks = [loudnessBins]int{}
+	m.blockPower = [loudnessBins]float64{}
+}
+
+// add takes the next sample of channel ch, scaled to -1..1. Call endFrame
+// once every channel of a frame is added.
+func (m *loudnessMeter) add(ch int, sample float64) {
+	y := m.highpass.filter(ch, m.shelf.filter(ch, sample))
+	m.hopEnergy[m.hops%loudnessHops] += y * y
+}
+
+// endFrame finishes a sample frame, closing a block every 100ms once the
+// first 400ms are in
+func (m *loudnessMeter) endFrame() {
+	m.hopFill++
+	if m.hopFill < m.hopFrames {
+		return
+	}
+	m.hopFill = 0
+	m.hops++
+	if m.hops >= loudnessHops {
+		var sum float64
+		for _, e := range m.hopEnergy {
+			sum += e
+		}
+		m.addBlock(sum / float64(loudnessHops*m.hopFrames))
+	}
+	m.hopEnergy[m.hops%loudnessHops] = 0
+}
+
+// addBlock counts a block by its mean square power, summed over channels
+func (m *loudnessMeter) addBlock(power float64) {
+	lufs := powerToLUFS(power)
+	if lufs <= loudnessAbsoluteGate {
+		return
+	}
+	bin := min(int((lufs-loudnessAbsoluteGate)*loudnessBinsPerLU), loudnessBins-1)
+	m.blocks[bin]++
+	m.blockPower[bin] += power
+}
+
+// loudness returns the gated loudness in LUFS, or 0 if the track has no
+// blocks above the absolute gate
+func (m *loudnessMeter) loudness() float64 {
+	gated := func(fromBin int) (float64, bool) {
+		var power float64
+		count := 0
+		for bin := max(fromBin, 0); bin < loudnessBins; bin++ {
+			power += m.blockPower[bin]
+			count += m.blocks[bin]
+		}
+		if count == 0 {
+			return 0, false
+		}
+		return powerToLUFS(power / float64(count)), true
+	}
+
+	ungated, ok := gated(0)
+	if !ok {
+		return 0
+	}
+	threshold := ungated + loudnessRelativeGate
+	integrated, ok := gated(int(math.Ceil((threshold - loudnessAbsoluteGate) * loudnessBinsPerLU)))
+	if !ok {
+		return ungated
+	}
+	return integrated
+}
+
+func powerToLUFS(power float64) float64 {
+	if power <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(power)
+}
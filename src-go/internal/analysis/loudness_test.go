@@ -0,0 +1,44 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+)
+
+// addSine feeds seconds of a 1kHz sine at amplitude to both channels
+func addSine(m *loudnessMeter, sampleRate int, seconds, amplitude float64) {
+	for i := 0; i < int(seconds*float64(sampleRate)); i++ {
+		v := amplitude * math.Sin(2*math.Pi*1000*float64(i)/float64(sampleRate))
+		m.add(0, v)
+		m.add(1, v)
+		m.endFrame()
+	}
+}
+
+func TestLoudnessOfSine(t *testing.T) {
+	// EBU Tech 3341 case 1: a stereo 1kHz sine at -23 dBFS reads -23 LUFS
+	m := newLoudnessMeter(48000)
+	addSine(m, 48000, 20, math.Pow(10, -23.0/20))
+	if got := m.loudness(); math.Abs(got+23) > 0.1 {
+		t.Errorf("Expected -23 LUFS, got %.2f", got)
+	}
+}
+
+func TestLoudnessGating(t *testing.T) {
+	// EBU Tech 3341 case 3: -36, -23 and -36 dBFS parts read -23 LUFS,
+	// the quiet parts falling under the relative gate
+	m := newLoudnessMeter(48000)
+	addSine(m, 48000, 10, math.Pow(10, -36.0/20))
+	addSine(m, 48000, 60, math.Pow(10, -23.0/20))
+	addSine(m, 48000, 10, math.Pow(10, -36.0/20))
+	if got := m.loudness(); math.Abs(got+23) > 0.1 {
+		t.Errorf("Expected -23 LUFS, got %.2f", got)
+	}
+
+	// Silence falls under the absolute gate
+	m.reset()
+	addSine(m, 48000, 5, 0)
+	if got := m.loudness(); got != 0 {
+		t.Errorf("Expected silence to have no loudness, got %.2f", got)
+	}
+}
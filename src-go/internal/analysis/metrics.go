@@ -0,0 +1,12 @@
+package analysis
+
+import "github.com/austinkregel/local-media/musicd/internal/metrics"
+
+var (
+	tracksAnalyzed = metrics.NewCounter("musicd_analysis_tracks_total",
+		"Tracks successfully analyzed")
+	analysisFailures = metrics.NewCounter("musicd_analysis_failures_total",
+		"Tracks whose analysis failed")
+	analysisDuration = metrics.NewHistogram("musicd_analysis_track_duration_seconds",
+		"Time spent analyzing a single track", metrics.DefaultBuckets)
+)
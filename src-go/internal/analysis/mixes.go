@@ -0,0 +1,329 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+// Daily mix defaults
+const (
+	DefaultDailyMixCount = 6
+	DefaultDailyMixSize  = 50
+
+	// DailyMixInterval is how long a set of mixes is served before it is
+	// regenerated
+	DailyMixInterval = 24 * time.Hour
+
+	// Communities with fewer usable tracks than this don't make a mix
+	minMixTracks = 5
+
+	// Seeds are picked at random among this many of a community's most
+	// central tracks, so each day's mix starts somewhere different
+	mixSeedCandidates = 5
+
+	// Added to the edge weight of candidates in the mix's own community so a
+	// mix stays on its theme and only spills over when it runs out
+	mixCommunityBonus = 0.5
+)
+
+// DailyMix is a generated playlist grown from a seed track in one community
+type DailyMix struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"` // Name of the community
+	CommunityID int      `json:"communityId"`
+	Mood        string   `json:"mood,omitempty"` // Mood most of the tracks match, if any
+	Seed        string   `json:"seed"`
+	Tracks      []string `json:"tracks"`
+}
+
+// DailyMixes is a generated set of mixes
+type DailyMixes struct {
+	GeneratedAt int64      `json:"generatedAt"`
+	Mixes       []DailyMix `json:"mixes"`
+}
+
+// MixGenerator builds daily mixes from the communities and similarity edges
+type MixGenerator struct {
+	store *FeatureStore
+}
+
+// NewMixGenerator creates a mix generator
+func NewMixGenerator(store *FeatureStore) *MixGenerator {
+	return &MixGenerator{store: store}
+}
+
+// Generate builds up to count mixes of up to size tracks, one per community,
+// largest communities first. Tracks in exclude, such as recently played ones,
+// are left out and no track appears in more than one mix. seed picks where
+// each mix starts.
+func (g *MixGenerator) Generate(count, size int, exclude []string, seed int64) []DailyMix {
+	rng := rand.New(rand.NewSource(seed))
+
+	used := make(map[string]bool, len(exclude))
+	for _, path := range exclude {
+		used[path] = true
+	}
+
+	communities := append([]CommunityInfo(nil), g.store.GetCommunities()...)
+	sort.SliceStable(communities, func(i, j int) bool {
+		return communities[i].TrackCount > communities[j].TrackCount
+	})
+
+	var mixes []DailyMix
+	for _, comm := range communities {
+		if len(mixes) >= count {
+			break
+		}
+
+		members := g.rankMembers(comm.ID, used)
+		if len(members) < minMixTracks {
+			continue
+		}
+
+		seedPath := members[rng.Intn(min(len(members), mixSeedCandidates))]
+		tracks := g.grow(seedPath, comm.ID, members, size, used)
+		if len(tracks) < minMixTracks {
+			continue
+		}
+		for _, path := range tracks {
+			used[path] = true
+		}
+
+		mixes = append(mixes, DailyMix{
+			ID:          len(mixes) + 1,
+			Name:        fmt.Sprintf("Daily Mix %d", len(mixes)+1),
+			Description: comm.Name,
+			CommunityID: comm.ID,
+			Mood:        g.dominantMood(tracks),
+			Seed:        seedPath,
+			Tracks:      tracks,
+		})
+	}
+
+	return mixes
+}
+
+// rankMembers returns the unused tracks of a community, most central first
+func (g *MixGenerator) rankMembers(communityID int, used map[string]bool) []string {
+	type member struct {
+		path       string
+		centrality float32
+	}
+
+	var members []member
+	for _, path := range g.store.GetTracksInCommunity(communityID) {
+		if used[path] {
+			continue
+		}
+		c, _ := g.store.GetCommunity(path)
+		members = append(members, member{path: path, centrality: c.Centrality})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].centrality != members[j].centrality {
+			return members[i].centrality > members[j].centrality
+		}
+		return members[i].path < members[j].path
+	})
+
+	paths := make([]string, len(members))
+	for i, m := range members {
+		paths[i] = m.path
+	}
+	return paths
+}
+
+// grow builds a mix outwards from seed along the similarity edges. Each step
+// takes the candidate most similar to any track already in the mix, with
+// community members preferred. If the edges run dry, the rest of the
+// community fills the mix in order of centrality.
+func (g *MixGenerator) grow(seed string, communityID int, members []string, size int, used map[string]bool) []string {
+	inMix := map[string]bool{seed: true}
+	tracks := []string{seed}
+	scores := make(map[string]float32)
+
+	addNeighbours := func(path string) {
+		for _, edge := range g.store.GetSimilarTracks(path, DefaultTopK) {
+			target := edge.TargetPath
+			if used[target] || inMix[target] {
+				continue
+			}
+			score := edge.Weight
+			if c, ok := g.store.GetCommunity(target); ok && c.CommunityID == communityID {
+				score += mixCommunityBonus
+			}
+			if score > scores[target] {
+				scores[target] = score
+			}
+		}
+	}
+	addNeighbours(seed)
+
+	for len(tracks) < size && len(scores) > 0 {
+		best := ""
+		var bestScore float32
+		for path, score := range scores {
+			if best == "" || score > bestScore || (score == bestScore && path < best) {
+				best, bestScore = path, score
+			}
+		}
+		delete(scores, best)
+
+		inMix[best] = true
+		tracks = append(tracks, best)
+		addNeighbours(best)
+	}
+
+	for _, path := range members {
+		if len(tracks) >= size {
+			break
+		}
+		if !inMix[path] {
+			inMix[path] = true
+			tracks = append(tracks, path)
+		}
+	}
+
+	return tracks
+}
+
+// dominantMood returns the mood that at least half the tracks match, picking
+// the most common one, or "" if none does
+func (g *MixGenerator) dominantMood(tracks []string) string {
+	best, bestCount := "", 0
+	for _, mood := range MoodNames() {
+		count := 0
+		for _, path := range tracks {
+			f, ok := g.store.GetFeatures(path)
+			if ok && f.Descriptors != nil && f.Descriptors.Matches(Moods[mood]) {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = mood, count
+		}
+	}
+	if bestCount*2 < len(tracks) {
+		return ""
+	}
+	return best
+}
+
+// MixStore keeps the current daily mixes on disk so they survive restarts and
+// stay the same for the whole day
+type MixStore struct {
+	mu       sync.Mutex
+	filePath string
+	mixes    DailyMixes
+}
+
+// NewMixStore creates a mix store in dataDir
+func NewMixStore(dataDir string) *MixStore {
+	return &MixStore{
+		filePath: filepath.Join(dataDir, "daily_mixes.json"),
+	}
+}
+
+// Load reads saved mixes from disk. A missing file means none were generated.
+func (s *MixStore) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read mixes: %w", err)
+	}
+
+	var mixes DailyMixes
+	if err := json.Unmarshal(data, &mixes); err != nil {
+		return fmt.Errorf("unmarshal mixes: %w", err)
+	}
+	s.mixes = mixes
+	return nil
+}
+
+// Get returns the current mixes
+func (s *MixStore) Get() DailyMixes {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mixes
+}
+
+// Due reports whether the mixes are older than DailyMixInterval
+func (s *MixStore) Due(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Sub(time.Unix(s.mixes.GeneratedAt, 0)) >= DailyMixInterval
+}
+
+// Set replaces the mixes and saves them
+func (s *MixStore) Set(mixes []DailyMix, generatedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mixes = DailyMixes{GeneratedAt: generatedAt.Unix(), Mixes: mixes}
+	return s.saveLocked()
+}
+
+// RelocatePaths rewrites the paths of moved tracks
+func (s *MixStore) RelocatePaths(rename func(path string) (string, bool)) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Copy rather than edit in place, callers of Get may still hold the
+	// old slices
+	moved := 0
+	mixes := make([]DailyMix, len(s.mixes.Mixes))
+	for i, mix := range s.mixes.Mixes {
+		if newPath, ok := rename(mix.Seed); ok {
+			mix.Seed = newPath
+		}
+		tracks := make([]string, len(mix.Tracks))
+		for j, path := range mix.Tracks {
+			if newPath, ok := rename(path); ok && newPath != path {
+				path = newPath
+				moved++
+			}
+			tracks[j] = path
+		}
+		mix.Tracks = tracks
+		mixes[i] = mix
+	}
+	s.mixes.Mixes = mixes
+
+	if moved > 0 {
+		if err := s.saveLocked(); err != nil {
+			log.Printf("[ANALYSIS] Failed to save relocated mixes: %v", err)
+		}
+	}
+	return moved
+}
+
+// saveLocked writes the mixes to disk (must be called with lock held)
+func (s *MixStore) saveLocked() error {
+	data, err := json.Marshal(s.mixes)
+	if err != nil {
+		return fmt.Errorf("marshal mixes: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0700); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+
+	if err := atomicfile.Write(s.filePath, data); err != nil {
+		return fmt.Errorf("write mixes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newMixLibrary returns a store with a community per entry of sizes, largest
+// first if sizes is. Tracks of a community are all similar to each other and
+// the first is the most central.
+func newMixLibrary(t *testing.T, sizes ...int) (*FeatureStore, [][]string) {
+	t.Helper()
+	store, err := NewFeatureStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFeatureStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	var communities [][]string
+	var info []CommunityInfo
+	for id, size := range sizes {
+		var paths []string
+		for i := 0; i < size; i++ {
+			paths = append(paths, fmt.Sprintf("/music/%d/%02d.flac", id, i))
+		}
+		for i, path := range paths {
+			var edges []SimilarityEdge
+			for j, other := range paths {
+				if j != i {
+					edges = append(edges, SimilarityEdge{TargetPath: other, Weight: 0.9 - float32(j)*0.01})
+				}
+			}
+			if err := store.StoreSimilarityEdges(path, edges); err != nil {
+				t.Fatalf("StoreSimilarityEdges failed: %v", err)
+			}
+			store.StoreCommunity(path, &TrackCommunity{CommunityID: id, Centrality: 1 - float32(i)*0.05})
+		}
+		communities = append(communities, paths)
+		info = append(info, CommunityInfo{ID: id, Name: fmt.Sprintf("Community %d", id), TrackCount: size})
+	}
+	store.StoreCommunityInfo(info)
+	return store, communities
+}
+
+func TestGenerateDailyMixes(t *testing.T) {
+	store, communities := newMixLibrary(t, 6, 8, 3)
+	mixes := NewMixGenerator(store).Generate(DefaultDailyMixCount, DefaultDailyMixSize, nil, 1)
+
+	// The largest community comes first and the one too small for a mix is
+	// left out
+	if len(mixes) != 2 {
+		t.Fatalf("Expected 2 mixes, got %d", len(mixes))
+	}
+	for i, want := range []int{1, 0} {
+		mix := mixes[i]
+		if mix.ID != i+1 || mix.CommunityID != want || mix.Name != fmt.Sprintf("Daily Mix %d", i+1) {
+			t.Errorf("Mix %d: expected community %d, got %+v", i, want, mix)
+		}
+		if len(mix.Tracks) != len(communities[want]) {
+			t.Errorf("Mix %d: expected the whole community, got %d tracks", i, len(mix.Tracks))
+		}
+		if mix.Tracks[0] != mix.Seed {
+			t.Errorf("Mix %d: expected to start with its seed, got %s", i, mix.Tracks[0])
+		}
+		seeds := communities[want][:mixSeedCandidates]
+		found := false
+		for _, path := range seeds {
+			found = found || path == mix.Seed
+		}
+		if !found {
+			t.Errorf("Mix %d: expected a seed among the most central tracks, got %s", i, mix.Seed)
+		}
+		for _, path := range mix.Tracks {
+			if c, _ := store.GetCommunity(path); c.CommunityID != want {
+				t.Errorf("Mix %d: expected only tracks of community %d, got %s", i, want, path)
+			}
+		}
+	}
+
+	// The same seed gives the same mixes
+	again := NewMixGenerator(store).Generate(DefaultDailyMixCount, DefaultDailyMixSize, nil, 1)
+	if !reflect.DeepEqual(mixes, again) {
+		t.Error("Expected the same mixes for the same seed")
+	}
+}
+
+func TestGenerateDailyMixesLimits(t *testing.T) {
+	store, communities := newMixLibrary(t, 8, 7)
+	generator := NewMixGenerator(store)
+
+	if mixes := generator.Generate(1, DefaultDailyMixSize, nil, 1); len(mixes) != 1 {
+		t.Errorf("Expected 1 mix, got %d", len(mixes))
+	}
+	for _, mix := range generator.Generate(DefaultDailyMixCount, minMixTracks, nil, 1) {
+		if len(mix.Tracks) != minMixTracks {
+			t.Errorf("Expected mixes of %d tracks, got %d", minMixTracks, len(mix.Tracks))
+		}
+	}
+
+	// Recently played tracks are left out, and a community left with too
+	// few tracks makes no mix
+	exclude := append([]string{communities[0][0]}, communities[1][:3]...)
+	mixes := generator.Generate(DefaultDailyMixCount, DefaultDailyMixSize, exclude, 1)
+	if len(mixes) != 1 || mixes[0].CommunityID != 0 {
+		t.Fatalf("Expected one mix from community 0, got %+v", mixes)
+	}
+	for _, path := range mixes[0].Tracks {
+		if path == communities[0][0] {
+			t.Errorf("Expected the excluded track left out, got %v", mixes[0].Tracks)
+		}
+	}
+}
+
+func TestMixStoreDue(t *testing.T) {
+	dir := t.TempDir()
+	store := NewMixStore(dir)
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	now := time.Now()
+	if !store.Due(now) {
+		t.Error("Expected mixes due when none were generated")
+	}
+
+	mixes := []DailyMix{{ID: 1, Name: "Daily Mix 1", Tracks: []string{"/music/a.flac"}}}
+	if err := store.Set(mixes, now); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if store.Due(now.Add(DailyMixInterval - time.Minute)) {
+		t.Error("Expected mixes not due within a day")
+	}
+	if !store.Due(now.Add(DailyMixInterval)) {
+		t.Error("Expected mixes due after a day")
+	}
+
+	// Saved mixes survive a restart
+	reloaded := NewMixStore(dir)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := reloaded.Get(); got.GeneratedAt != now.Unix() || !reflect.DeepEqual(got.Mixes, mixes) {
+		t.Errorf("Expected the saved mixes, got %+v", got)
+	}
+}
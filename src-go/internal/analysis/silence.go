@@ -0,0 +1,96 @@
+package analysis
+
+import (
+	"math"
+	"time"
+)
+
+// numSilenceLevels is the number of levels silence is measured against
+const numSilenceLevels = 11
+
+// SilenceLevels are the levels in dBFS below which audio counts as silence,
+// quietest first. Silence is measured against each so the threshold can be
+// changed without analyzing again.
+var SilenceLevels = [numSilenceLevels]float64{-80, -75, -70, -65, -60, -55, -50, -45, -40, -35, -30}
+
+// Silence is how long a track starts and ends below each of SilenceLevels
+type Silence struct {
+	LeadMs  [numSilenceLevels]int32 // Before the first sample above the level
+	TrailMs [numSilenceLevels]int32 // After the last sample above the level
+}
+
+// Trim returns the silence at the start and end of the track for a
+// threshold in dBFS, measured at the loudest of SilenceLevels not above it
+func (s Silence) Trim(thresholdDB float64) (lead, trail time.Duration) {
+	level := -1
+	for i, l := range SilenceLevels {
+		if l <= thresholdDB {
+			level = i
+		}
+	}
+	if level < 0 {
+		return 0, 0
+	}
+	return time.Duration(s.LeadMs[level]) * time.Millisecond, time.Duration(s.TrailMs[level]) * time.Millisecond
+}
+
+// silenceTracker measures the silence at either end of a track from its
+// mono samples
+type silenceTracker struct {
+	amplitudes [numSilenceLevels]float64 // SilenceLevels as sample amplitudes
+	first      [numSilenceLevels]int64   // Sample index, -1 until the level is passed
+	last       [numSilenceLevels]int64   // Index after the last sample above the level
+	samples    int64
+}
+
+func newSilenceTracker() *silenceTracker {
+	t := &silenceTracker{}
+	for i, db := range SilenceLevels {
+		t.amplitudes[i] = math.Pow(10, db/20)
+	}
+	t.reset()
+	return t
+}
+
+func (t *silenceTracker) reset() {
+	for i := range t.first {
+		t.first[i] = -1
+		t.last[i] = 0
+	}
+	t.samples = 0
+}
+
+// add takes the next sample, scaled to -1..1
+func (t *silenceTracker) add(sample float64) {
+	sample = math.Abs(sample)
+	for i, amplitude := range t.amplitudes {
+		// Levels get louder, so a sample below one is below the rest
+		if sample <= amplitude {
+			break
+		}
+		if t.first[i] < 0 {
+			t.first[i] = t.samples
+		}
+		t.last[i] = t.samples + 1
+	}
+	t.samples++
+}
+
+// silence returns the silence measured so far. A track that never passes a
+// level is silent from start to end at it.
+func (t *silenceTracker) silence(sampleRate int) Silence {
+	toMs := func(samples int64) int32 {
+		return int32(samples * 1000 / int64(sampleRate))
+	}
+	var s Silence
+	for i := range t.first {
+		if t.first[i] < 0 {
+			s.LeadMs[i] = toMs(t.samples)
+			s.TrailMs[i] = toMs(t.samples)
+			continue
+		}
+		s.LeadMs[i] = toMs(t.first[i])
+		s.TrailMs[i] = toMs(t.samples - t.last[i])
+	}
+	return s
+}
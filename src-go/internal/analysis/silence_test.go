@@ -0,0 +1,59 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSilenceTracker(t *testing.T) {
+	tracker := newSilenceTracker()
+
+	// 1s of digital silence, 0.5s of -66 dB hiss, 2s of music, then 1s of
+	// -66 dB hiss, at 1kHz
+	add := func(n int, level float64) {
+		for i := 0; i < n; i++ {
+			tracker.add(level)
+		}
+	}
+	add(1000, 0)
+	add(500, 0.0005) // About -66 dBFS
+	add(2000, 0.5)
+	add(1000, -0.0005)
+
+	s := tracker.silence(1000)
+	if lead, trail := s.Trim(-60); lead != 1500*time.Millisecond || trail != time.Second {
+		t.Errorf("At -60 dB expected the hiss to count as silence, got %v and %v", lead, trail)
+	}
+	if lead, trail := s.Trim(-80); lead != time.Second || trail != 0 {
+		t.Errorf("At -80 dB expected only the digital silence, got %v and %v", lead, trail)
+	}
+	// Levels between steps use the quieter step
+	if lead, _ := s.Trim(-67); lead != time.Second {
+		t.Errorf("Expected -67 dB to measure at -70, got %v", lead)
+	}
+	if lead, trail := s.Trim(-90); lead != 0 || trail != 0 {
+		t.Errorf("Expected nothing below the quietest level, got %v and %v", lead, trail)
+	}
+}
+
+func TestSilentTrackIsSilentThroughout(t *testing.T) {
+	tracker := newSilenceTracker()
+	for i := 0; i < 3000; i++ {
+		tracker.add(0)
+	}
+	if lead, trail := tracker.silence(1000).Trim(-60); lead != 3*time.Second || trail != 3*time.Second {
+		t.Errorf("Expected the whole track as silence, got %v and %v", lead, trail)
+	}
+}
+
+func TestPartialAnalysisKeepsSilence(t *testing.T) {
+	stored := &AudioFeatures{Silence: Silence{LeadMs: [numSilenceLevels]int32{4: 5000}}}
+	mergeGroups(stored, &AudioFeatures{Key: 3}, []string{GroupKey})
+	if stored.Silence.LeadMs[4] != 5000 {
+		t.Errorf("Expected re-analyzing the key to keep the silence, got %+v", stored.Silence)
+	}
+	mergeGroups(stored, &AudioFeatures{}, []string{GroupSilence})
+	if stored.Silence.LeadMs[4] != 0 {
+		t.Errorf("Expected the silence to be replaced, got %+v", stored.Silence)
+	}
+}
@@ -1,8 +1,10 @@
 package analysis
 
 import (
+	"fmt"
 	"math"
 	"sort"
+	"sync"
 )
 
 const (
@@ -16,15 +18,23 @@ const (
 	MinSimilarityThreshold = 0.3
 )
 
+// Weights for scoring back-to-back transitions
+const (
+	transitionTempoWeight  = 0.4
+	transitionKeyWeight    = 0.3
+	transitionEnergyWeight = 0.3
+)
+
 // FeatureWeights defines the importance of each feature group
 type FeatureWeights struct {
-	MFCC        float32 // Timbre (most important for "vibe")
-	Tempo       float32 // Rhythm feel
-	Spectral    float32 // Brightness/dynamics
-	Energy      float32 // Loudness profile
-	Bands       float32 // Bass/mid/treble balance
-	Instruments float32 // Instrument presence
-	Context     float32 // Playing style
+	MFCC        float32 `json:"mfcc"`        // Timbre (most important for "vibe")
+	Tempo       float32 `json:"tempo"`       // Rhythm feel
+	Spectral    float32 `json:"spectral"`    // Brightness/dynamics
+	Energy      float32 `json:"energy"`      // Loudness profile
+	Bands       float32 `json:"bands"`       // Bass/mid/treble balance
+	Instruments float32 `json:"instruments"` // Instrument presence
+	Context     float32 `json:"context"`     // Playing style
+	Key         float32 `json:"key"`         // Harmonic compatibility; skipped when a key is unknown
 }
 
 // DefaultWeights returns the default feature weights
@@ -37,12 +47,14 @@ func DefaultWeights() FeatureWeights {
 		Bands:       0.10,
 		Instruments: 0.15,
 		Context:     0.10,
+		Key:         0.10,
 	}
 }
 
 // SimilarityEngine computes and queries track similarity
 type SimilarityEngine struct {
 	store   *FeatureStore
+	mu      sync.RWMutex // Guards weights
 	weights FeatureWeights
 	topK    int
 }
@@ -58,9 +70,18 @@ func NewSimilarityEngine(store *FeatureStore) *SimilarityEngine {
 
 // SetWeights updates the feature weights
 func (e *SimilarityEngine) SetWeights(w FeatureWeights) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.weights = w
 }
 
+// Weights returns the feature weights in use
+func (e *SimilarityEngine) Weights() FeatureWeights {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.weights
+}
+
 // ComputeSimilarity computes similarity between two feature sets
 // Returns a value between 0 (different) and 1 (identical)
 func (e *SimilarityEngine) ComputeSimilarity(a, b *AudioFeatures) float32 {
@@ -68,43 +89,50 @@ func (e *SimilarityEngine) ComputeSimilarity(a, b *AudioFeatures) float32 {
 		return 0
 	}
 
+	w := e.Weights()
 	var totalDistance float32
 	var totalWeight float32
 
 	// 1. MFCC distance (normalized euclidean)
 	mfccDist := e.mfccDistance(a, b)
-	totalDistance += mfccDist * e.weights.MFCC
-	totalWeight += e.weights.MFCC
+	totalDistance += mfccDist * w.MFCC
+	totalWeight += w.MFCC
 
 	// 2. Tempo distance (normalized)
 	tempoDist := e.tempoDistance(a.Tempo, b.Tempo)
-	totalDistance += tempoDist * e.weights.Tempo
-	totalWeight += e.weights.Tempo
+	totalDistance += tempoDist * w.Tempo
+	totalWeight += w.Tempo
 
 	// 3. Spectral features distance
 	spectralDist := e.spectralDistance(a, b)
-	totalDistance += spectralDist * e.weights.Spectral
-	totalWeight += e.weights.Spectral
+	totalDistance += spectralDist * w.Spectral
+	totalWeight += w.Spectral
 
 	// 4. Energy distance
 	energyDist := abs32(a.RMSEnergy - b.RMSEnergy)
-	totalDistance += energyDist * e.weights.Energy
-	totalWeight += e.weights.Energy
+	totalDistance += energyDist * w.Energy
+	totalWeight += w.Energy
 
 	// 5. Band ratio distance
 	bandsDist := e.bandsDistance(a, b)
-	totalDistance += bandsDist * e.weights.Bands
-	totalWeight += e.weights.Bands
+	totalDistance += bandsDist * w.Bands
+	totalWeight += w.Bands
 
 	// 6. Instrument profile distance
 	instrDist := e.instrumentDistance(a, b)
-	totalDistance += instrDist * e.weights.Instruments
-	totalWeight += e.weights.Instruments
+	totalDistance += instrDist * w.Instruments
+	totalWeight += w.Instruments
 
 	// 7. Context distance
 	contextDist := e.contextDistance(a, b)
-	totalDistance += contextDist * e.weights.Context
-	totalWeight += e.weights.Context
+	totalDistance += contextDist * w.Context
+	totalWeight += w.Context
+
+	// 8. Key distance
+	if keyDist, ok := e.keyDistance(a, b); ok {
+		totalDistance += keyDist * w.Key
+		totalWeight += w.Key
+	}
 
 	// Convert distance to similarity
 	if totalWeight == 0 {
@@ -123,6 +151,37 @@ func (e *SimilarityEngine) ComputeSimilarity(a, b *AudioFeatures) float32 {
 	return similarity
 }
 
+// SimilarityComponents are the similarities (0-1) of two tracks per feature
+// group. Key is only set when both keys are known.
+type SimilarityComponents struct {
+	MFCC        float32
+	Tempo       float32
+	Spectral    float32
+	Energy      float32
+	Bands       float32
+	Instruments float32
+	Context     float32
+	Key         float32
+	HasKey      bool
+}
+
+// Components compares two feature sets group by group, before weighting
+func (e *SimilarityEngine) Components(a, b *AudioFeatures) SimilarityComponents {
+	c := SimilarityComponents{
+		MFCC:        1 - e.mfccDistance(a, b),
+		Tempo:       1 - e.tempoDistance(a.Tempo, b.Tempo),
+		Spectral:    1 - e.spectralDistance(a, b),
+		Energy:      1 - abs32(a.RMSEnergy-b.RMSEnergy),
+		Bands:       1 - e.bandsDistance(a, b),
+		Instruments: 1 - e.instrumentDistance(a, b),
+		Context:     1 - e.contextDistance(a, b),
+	}
+	if keyDist, ok := e.keyDistance(a, b); ok {
+		c.Key, c.HasKey = 1-keyDist, true
+	}
+	return c
+}
+
 // mfccDistance computes normalized distance between MFCC vectors
 func (e *SimilarityEngine) mfccDistance(a, b *AudioFeatures) float32 {
 	var sumSq float32
@@ -213,6 +272,48 @@ func (e *SimilarityEngine) contextDistance(a, b *AudioFeatures) float32 {
 	return sumDiff / 7
 }
 
+// keyDistance computes distance between keys as steps around the Camelot
+// wheel, counting a switch between major and minor as a step. Keys a DJ
+// would mix between (same key, relative key, a fifth apart) are one step
+// apart at most. Returns false if either key is unknown.
+func (e *SimilarityEngine) keyDistance(a, b *AudioFeatures) (float32, bool) {
+	if a.KeyStrength == 0 || b.KeyStrength == 0 {
+		return 0, false
+	}
+
+	steps := camelotNumber(a.Key, a.Mode) - camelotNumber(b.Key, b.Mode)
+	if steps < 0 {
+		steps = -steps
+	}
+	steps = min(steps, 12-steps)
+	if a.Mode != b.Mode {
+		steps++
+	}
+	return float32(min(steps, 6)) / 6, true
+}
+
+// TransitionDistance scores how jarring it is to play b right after a, from
+// 0 (seamless) to 1, by tempo, key and energy. An unknown tempo or key counts
+// as halfway.
+func (e *SimilarityEngine) TransitionDistance(a, b *StoredFeatures) float32 {
+	tempoDist := float32(0.5)
+	if a.Features.Tempo > 0 && b.Features.Tempo > 0 {
+		tempoDist = e.tempoDistance(a.Features.Tempo, b.Features.Tempo)
+	}
+
+	keyDist, ok := e.keyDistance(a.Features, b.Features)
+	if !ok {
+		keyDist = 0.5
+	}
+
+	energyDist := float32(0.5)
+	if a.Descriptors != nil && b.Descriptors != nil {
+		energyDist = abs32(a.Descriptors.Energy - b.Descriptors.Energy)
+	}
+
+	return transitionTempoWeight*tempoDist + transitionKeyWeight*keyDist + transitionEnergyWeight*energyDist
+}
+
 // FindSimilar finds the most similar tracks to a given track
 func (e *SimilarityEngine) FindSimilar(trackPath string, count int, exclude []string) []SimilarityEdge {
 	// Check cached edges first
@@ -237,8 +338,9 @@ func (e *SimilarityEngine) FindSimilar(trackPath string, count int, exclude []st
 	return result
 }
 
-// BuildGraph builds the similarity graph for all analyzed tracks
-func (e *SimilarityEngine) BuildGraph() {
+// BuildGraph builds the similarity graph for all analyzed tracks, stopping
+// at the first list that can't be stored
+func (e *SimilarityEngine) BuildGraph() error {
 	allFeatures := e.store.GetAllFeatures()
 
 	// Get all paths
@@ -278,8 +380,11 @@ func (e *SimilarityEngine) BuildGraph() {
 			edges = edges[:e.topK]
 		}
 
-		e.store.StoreSimilarityEdges(pathA, edges)
+		if err := e.store.StoreSimilarityEdges(pathA, edges); err != nil {
+			return fmt.Errorf("store similar tracks of %s: %w", pathA, err)
+		}
 	}
+	return nil
 }
 
 // ExplainSimilarity returns a breakdown of why two tracks are similar
@@ -294,7 +399,7 @@ func (e *SimilarityEngine) ExplainSimilarity(trackA, trackB string) map[string]f
 	a := fa.Features
 	b := fb.Features
 
-	return map[string]float32{
+	breakdown := map[string]float32{
 		"overall":     e.ComputeSimilarity(a, b),
 		"mfcc":        1 - e.mfccDistance(a, b),
 		"tempo":       1 - e.tempoDistance(a.Tempo, b.Tempo),
@@ -304,6 +409,10 @@ func (e *SimilarityEngine) ExplainSimilarity(trackA, trackB string) map[string]f
 		"instruments": 1 - e.instrumentDistance(a, b),
 		"context":     1 - e.contextDistance(a, b),
 	}
+	if keyDist, ok := e.keyDistance(a, b); ok {
+		breakdown["key"] = 1 - keyDist
+	}
+	return breakdown
 }
 
 func abs32(x float32) float32 {
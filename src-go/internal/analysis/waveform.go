@@ -0,0 +1,189 @@
+package analysis
+
+import (
+	"math"
+	"time"
+)
+
+// WaveformBuckets is the number of min/max pairs stored per track
+const WaveformBuckets = 2000
+
+// waveformResolution is how many frames are folded into each intermediate
+// bucket while decoding. The track length isn't known up front, so peaks are
+// gathered at this fixed resolution (10ms at 44.1kHz) and reduced to
+// WaveformBuckets once decoding finishes.
+const waveformResolution = 441
+
+// Waveform holds the peak envelope of a track for drawing a seek bar
+type Waveform struct {
+	DurationMs int64  `json:"durationMs"`
+	Peaks      []int8 `json:"peaks"` // min,max pair per bucket of the mono mix, scaled to -127..127
+}
+
+// Buckets returns the number of min/max pairs in the waveform
+func (w *Waveform) Buckets() int {
+	return len(w.Peaks) / 2
+}
+
+// Downsample merges buckets so the waveform has at most n of them
+func (w *Waveform) Downsample(n int) *Waveform {
+	have := w.Buckets()
+	if n <= 0 || n >= have {
+		return w
+	}
+
+	peaks := make([]int8, 0, n*2)
+	for i := 0; i < n; i++ {
+		start, end := i*have/n, (i+1)*have/n
+		lo, hi := w.Peaks[start*2], w.Peaks[start*2+1]
+		for j := start + 1; j < end; j++ {
+			lo = min(lo, w.Peaks[j*2])
+			hi = max(hi, w.Peaks[j*2+1])
+		}
+		peaks = append(peaks, lo, hi)
+	}
+	return &Waveform{DurationMs: w.DurationMs, Peaks: peaks}
+}
+
+// PreviewStart returns where the stretch of the track of the given length
+// that makes the best preview starts: the loudest and busiest one, where the
+// envelope is high and swings the most between buckets, as it does around
+// strong onsets. Returns 0 if the track is no longer than length.
+func (w *Waveform) PreviewStart(length time.Duration) time.Duration {
+	n := w.Buckets()
+	if n == 0 || w.DurationMs <= 0 {
+		return 0
+	}
+	window := int(int64(n) * length.Milliseconds() / w.DurationMs)
+	if window <= 0 || window >= n {
+		return 0
+	}
+
+	score := make([]float64, n)
+	prev := 0.0
+	for i := range score {
+		amp := float64(int(w.Peaks[i*2+1])-int(w.Peaks[i*2])) / 254
+		score[i] = amp + math.Abs(amp-prev)
+		prev = amp
+	}
+
+	sum := 0.0
+	for i := 0; i < window; i++ {
+		sum += score[i]
+	}
+	best, bestSum := 0, sum
+	for i := window; i < n; i++ {
+		sum += score[i] - score[i-window]
+		if sum > bestSum {
+			best, bestSum = i-window+1, sum
+		}
+	}
+	return time.Duration(int64(best)*w.DurationMs/int64(n)) * time.Millisecond
+}
+
+// waveformBuilder collects peaks from interleaved 16-bit PCM as it streams
+// past. It implements io.Writer so it can sit alongside the feature buffer.
+type waveformBuilder struct {
+	sampleRate int
+	channels   int
+
+	mins, maxs []int16 // Intermediate buckets
+	lo, hi     int16   // Current bucket
+	inBucket   int     // Frames in the current bucket
+	frames     int64   // Total frames seen
+
+	pending []byte // Partial frame carried between writes
+}
+
+func newWaveformBuilder(sampleRate, channels int) *waveformBuilder {
+	return &waveformBuilder{sampleRate: sampleRate, channels: channels}
+}
+
+// Write consumes PCM data
+func (b *waveformBuilder) Write(p []byte) (int, error) {
+	n := len(p)
+	frameBytes := b.channels * 2
+
+	if len(b.pending) > 0 {
+		need := frameBytes - len(b.pending)
+		if len(p) < need {
+			b.pending = append(b.pending, p...)
+			return n, nil
+		}
+		b.pending = append(b.pending, p[:need]...)
+		b.addFrame(b.pending)
+		b.pending = b.pending[:0]
+		p = p[need:]
+	}
+
+	for len(p) >= frameBytes {
+		b.addFrame(p[:frameBytes])
+		p = p[frameBytes:]
+	}
+	b.pending = append(b.pending, p...)
+	return n, nil
+}
+
+// addFrame folds one frame, mixed down to mono, into the current bucket
+func (b *waveformBuilder) addFrame(frame []byte) {
+	var sum int32
+	for ch := 0; ch < b.channels; ch++ {
+		sum += int32(int16(frame[ch*2]) | int16(frame[ch*2+1])<<8)
+	}
+	sample := int16(sum / int32(b.channels))
+
+	if b.inBucket == 0 || sample < b.lo {
+		b.lo = sample
+	}
+	if b.inBucket == 0 || sample > b.hi {
+		b.hi = sample
+	}
+	b.inBucket++
+	b.frames++
+
+	if b.inBucket == waveformResolution {
+		b.flushBucket()
+	}
+}
+
+func (b *waveformBuilder) flushBucket() {
+	b.mins = append(b.mins, b.lo)
+	b.maxs = append(b.maxs, b.hi)
+	b.inBucket = 0
+}
+
+// Waveform reduces the collected peaks to at most buckets min/max pairs.
+// Returns nil if no audio was seen.
+func (b *waveformBuilder) Waveform(buckets int) *Waveform {
+	if b.inBucket > 0 {
+		b.flushBucket()
+	}
+	have := len(b.mins)
+	if have == 0 {
+		return nil
+	}
+	if buckets > have {
+		buckets = have
+	}
+
+	peaks := make([]int8, 0, buckets*2)
+	for i := 0; i < buckets; i++ {
+		start, end := i*have/buckets, (i+1)*have/buckets
+		lo, hi := b.mins[start], b.maxs[start]
+		for j := start + 1; j < end; j++ {
+			lo = min(lo, b.mins[j])
+			hi = max(hi, b.maxs[j])
+		}
+		peaks = append(peaks, scalePeak(lo), scalePeak(hi))
+	}
+
+	return &Waveform{
+		DurationMs: b.frames * 1000 / int64(b.sampleRate),
+		Peaks:      peaks,
+	}
+}
+
+// scalePeak maps a 16-bit sample to -127..127
+func scalePeak(sample int16) int8 {
+	return int8(int32(sample) * 127 / 32768)
+}
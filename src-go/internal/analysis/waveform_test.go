@@ -0,0 +1,28 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPreviewStart(t *testing.T) {
+	// A minute long: quiet, then a loud stretch from 30s to 45s, then quiet
+	w := &Waveform{DurationMs: 60000}
+	for i := 0; i < 60; i++ {
+		peak := int8(10)
+		if i >= 30 && i < 45 {
+			peak = 100
+		}
+		w.Peaks = append(w.Peaks, -peak, peak)
+	}
+
+	if got := w.PreviewStart(15 * time.Second); got != 30*time.Second {
+		t.Errorf("Expected the preview to start at the loud stretch, got %v", got)
+	}
+	if got := w.PreviewStart(2 * time.Minute); got != 0 {
+		t.Errorf("Expected a preview longer than the track to start at 0, got %v", got)
+	}
+	if got := (&Waveform{}).PreviewStart(15 * time.Second); got != 0 {
+		t.Errorf("Expected an empty waveform to start at 0, got %v", got)
+	}
+}
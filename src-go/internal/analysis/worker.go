@@ -1,7 +1,6 @@
 package analysis
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -30,16 +29,21 @@ type AnalysisStatus struct {
 
 // AnalysisResult contains the result of analyzing a single track
 type AnalysisResult struct {
-	TrackPath string
-	Features  *AudioFeatures
-	FileHash  string
-	Error     error
+	TrackPath   string
+	Features    *AudioFeatures
+	Groups      []string // Feature groups in Features; nil means all
+	Waveform    *Waveform
+	Fingerprint *Fingerprint // Only for tracks marked Fingerprint
+	FileHash    string
+	Error       error
 }
 
 // TrackInfo contains information needed to analyze a track
 type TrackInfo struct {
-	Path     string
-	FileHash string // Used to detect if file changed
+	Path        string
+	FileHash    string   // Used to detect if file changed
+	Fingerprint bool     // Fingerprint the track so it can be identified and followed when re-encoded
+	Groups      []string // Feature groups to recompute; nil means all
 }
 
 // Worker performs background audio analysis
@@ -66,13 +70,16 @@ type Worker struct {
 	// FFmpeg path
 	ffmpegPath string
 	nicePath   string
-
-	// Feature extractor
-	extractor *FeatureExtractor
+	fpcalcPath string // Optional; fingerprinting is skipped without it
 
 	// Results callback
 	onResult func(AnalysisResult)
 
+	// Persisted run, so analysis survives a restart
+	jobs           *JobStore
+	onCheckpoint   func()
+	lastCheckpoint time.Time
+
 	// Counts
 	analyzedCount  int64
 	failedCount    int64
@@ -86,8 +93,19 @@ type WorkerConfig struct {
 	IdleThrottle  int64         // Sleep ms between tracks when idle
 	IsPlayingFunc func() bool   // Function to check playback state
 	OnResult      func(AnalysisResult) // Callback when analysis completes
+	Jobs          *JobStore     // Optional; records progress so a run can resume
+	OnCheckpoint  func()        // Called before progress is saved, to persist results
 }
 
+const (
+	// checkpointInterval is how often progress of a run is saved
+	checkpointInterval = 30 * time.Second
+
+	// playbackCheckInterval is how often workers held back during playback
+	// look again
+	playbackCheckInterval = time.Second
+)
+
 // NewWorker creates a new background analysis worker
 func NewWorker(cfg WorkerConfig) (*Worker, error) {
 	// Find FFmpeg
@@ -125,16 +143,72 @@ func NewWorker(cfg WorkerConfig) (*Worker, error) {
 		isPlayingFunc: cfg.IsPlayingFunc,
 		ffmpegPath:    ffmpegPath,
 		nicePath:      nicePath,
-		extractor:     NewFeatureExtractor(44100),
+		fpcalcPath:    FindFpcalc(),
 		onResult:      cfg.OnResult,
+		jobs:          cfg.Jobs,
+		onCheckpoint:  cfg.OnCheckpoint,
 		status:        AnalysisStatus{Status: "idle"},
 		pauseChan:     make(chan struct{}),
 		resumeChan:    make(chan struct{}),
 	}, nil
 }
 
+// CanFingerprint reports whether fpcalc is available to fingerprint tracks
+func (w *Worker) CanFingerprint() bool {
+	return w.fpcalcPath != ""
+}
+
 // Start begins background analysis of the given tracks
 func (w *Worker) Start(ctx context.Context, tracks []TrackInfo) error {
+	if w.IsRunning() {
+		return fmt.Errorf("analysis already running")
+	}
+	if w.jobs != nil {
+		if err := w.jobs.Begin(tracks); err != nil {
+			log.Printf("[ANALYSIS] Warning: failed to save analysis job: %v", err)
+		}
+	}
+	return w.start(ctx, tracks, analysisProgress{total: len(tracks), startedAt: time.Now().Unix()})
+}
+
+// ResumeJob continues a run interrupted by a restart, starting paused if it
+// was paused. It returns the number of tracks left, and 0 without a run.
+func (w *Worker) ResumeJob(ctx context.Context) (int, error) {
+	if w.jobs == nil {
+		return 0, nil
+	}
+	tracks := w.jobs.Pending()
+	if len(tracks) == 0 {
+		if err := w.jobs.Clear(); err != nil {
+			log.Printf("[ANALYSIS] Warning: %v", err)
+		}
+		return 0, nil
+	}
+
+	total, done, failed := w.jobs.Counts()
+	progress := analysisProgress{
+		total:     total,
+		analyzed:  done,
+		failed:    failed,
+		startedAt: w.jobs.StartedAt(),
+		paused:    w.jobs.Paused(),
+	}
+	if err := w.start(ctx, tracks, progress); err != nil {
+		return 0, err
+	}
+	return len(tracks), nil
+}
+
+// analysisProgress is where a run starts from
+type analysisProgress struct {
+	total     int
+	analyzed  int
+	failed    int
+	startedAt int64
+	paused    bool
+}
+
+func (w *Worker) start(ctx context.Context, tracks []TrackInfo, progress analysisProgress) error {
 	w.mu.Lock()
 	if w.isRunning {
 		w.mu.Unlock()
@@ -143,15 +217,19 @@ func (w *Worker) Start(ctx context.Context, tracks []TrackInfo) error {
 
 	w.ctx, w.cancel = context.WithCancel(ctx)
 	w.isRunning = true
-	w.isPaused = false
-	atomic.StoreInt64(&w.analyzedCount, 0)
-	atomic.StoreInt64(&w.failedCount, 0)
+	w.isPaused = progress.paused
+	w.lastCheckpoint = time.Now()
+	atomic.StoreInt64(&w.analyzedCount, int64(progress.analyzed))
+	atomic.StoreInt64(&w.failedCount, int64(progress.failed))
 	atomic.StoreInt64(&w.inProgressCount, 0)
 
 	w.status = AnalysisStatus{
 		Status:      "running",
-		TotalTracks: len(tracks),
-		StartedAt:   time.Now().Unix(),
+		TotalTracks: progress.total,
+		StartedAt:   progress.startedAt,
+	}
+	if progress.paused {
+		w.status.Status = "paused"
 	}
 	w.mu.Unlock()
 
@@ -159,11 +237,10 @@ func (w *Worker) Start(ctx context.Context, tracks []TrackInfo) error {
 	return nil
 }
 
-// Stop stops the background analysis
+// Stop stops the background analysis. Progress is saved so the run
+// resumes on the next start.
 func (w *Worker) Stop() {
 	w.mu.Lock()
-	defer w.mu.Unlock()
-
 	if w.cancel != nil {
 		w.cancel()
 		w.cancel = nil
@@ -171,6 +248,33 @@ func (w *Worker) Stop() {
 	w.isRunning = false
 	w.status.Status = "idle"
 	w.status.Message = "Analysis stopped"
+	w.mu.Unlock()
+
+	w.checkpoint()
+}
+
+// Cancel stops the background analysis and discards the rest of the run
+func (w *Worker) Cancel() {
+	w.mu.Lock()
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+	w.isRunning = false
+	w.isPaused = false
+	w.status.Status = "idle"
+	w.status.Message = "Analysis cancelled"
+	w.mu.Unlock()
+
+	// Results already stored are kept
+	if w.onCheckpoint != nil {
+		w.onCheckpoint()
+	}
+	if w.jobs != nil {
+		if err := w.jobs.Clear(); err != nil {
+			log.Printf("[ANALYSIS] Warning: %v", err)
+		}
+	}
 }
 
 // Pause pauses the background analysis
@@ -186,6 +290,7 @@ func (w *Worker) Pause() {
 	w.status.Status = "paused"
 	close(w.pauseChan)
 	w.pauseChan = make(chan struct{})
+	w.savePaused(true)
 }
 
 // Resume resumes paused analysis
@@ -201,6 +306,17 @@ func (w *Worker) Resume() {
 	w.status.Status = "running"
 	close(w.resumeChan)
 	w.resumeChan = make(chan struct{})
+	w.savePaused(false)
+}
+
+// savePaused records the pause state of the run
+func (w *Worker) savePaused(paused bool) {
+	if w.jobs == nil {
+		return
+	}
+	if err := w.jobs.SetPaused(paused); err != nil {
+		log.Printf("[ANALYSIS] Warning: failed to save analysis job: %v", err)
+	}
 }
 
 // GetStatus returns the current analysis status
@@ -225,15 +341,30 @@ func (w *Worker) IsRunning() bool {
 
 // run executes the background analysis
 func (w *Worker) run(tracks []TrackInfo) {
+	ctx := w.ctx
 	defer func() {
 		w.mu.Lock()
-		w.isRunning = false
-		if w.status.Status == "running" {
+		complete := w.status.Status == "running" && ctx.Err() == nil
+		if complete {
+			w.isRunning = false
 			w.status.Status = "complete"
 			w.status.Message = fmt.Sprintf("Analysis complete: %d tracks analyzed, %d failed",
 				atomic.LoadInt64(&w.analyzedCount), atomic.LoadInt64(&w.failedCount))
+		} else if w.ctx == ctx {
+			w.isRunning = false
 		}
 		w.mu.Unlock()
+
+		if complete {
+			if w.onCheckpoint != nil {
+				w.onCheckpoint()
+			}
+			if w.jobs != nil {
+				if err := w.jobs.Clear(); err != nil {
+					log.Printf("[ANALYSIS] Warning: %v", err)
+				}
+			}
+		}
 		log.Printf("[ANALYSIS] Worker finished: %d analyzed, %d failed",
 			atomic.LoadInt64(&w.analyzedCount), atomic.LoadInt64(&w.failedCount))
 	}()
@@ -247,12 +378,9 @@ func (w *Worker) run(tracks []TrackInfo) {
 	}
 	close(jobs)
 
-	// Determine active workers based on playback state
-	activeWorkers := w.getActiveWorkerCount()
-
-	// Start workers
+	// Start workers. Those beyond the active count wait while audio plays.
 	var wg sync.WaitGroup
-	for i := 0; i < activeWorkers; i++ {
+	for i := 0; i < w.maxWorkers; i++ {
 		wg.Add(1)
 		go func(workerID int) {
 			defer wg.Done()
@@ -282,6 +410,9 @@ func (w *Worker) getThrottle() time.Duration {
 
 // worker processes tracks from the job channel
 func (w *Worker) worker(id int, jobs <-chan TrackInfo) {
+	// Each worker streams one track at a time into its own extractor
+	extractor := NewFeatureExtractor(44100)
+
 	for {
 		select {
 		case <-w.ctx.Done():
@@ -304,6 +435,16 @@ func (w *Worker) worker(id int, jobs <-chan TrackInfo) {
 			}
 		}
 
+		// Leave the CPU to playback
+		if id >= w.getActiveWorkerCount() {
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-time.After(playbackCheckInterval):
+			}
+			continue
+		}
+
 		// Get next job
 		track, ok := <-jobs
 		if !ok {
@@ -313,14 +454,18 @@ func (w *Worker) worker(id int, jobs <-chan TrackInfo) {
 		atomic.AddInt64(&w.inProgressCount, 1)
 
 		// Analyze the track
-		result := w.analyzeTrack(track)
+		start := time.Now()
+		result := w.analyzeTrack(track, extractor)
+		analysisDuration.ObserveDuration(start)
 
 		atomic.AddInt64(&w.inProgressCount, -1)
 		if result.Error != nil {
 			atomic.AddInt64(&w.failedCount, 1)
+			analysisFailures.Inc()
 			log.Printf("[ANALYSIS] Worker %d: Failed %s: %v", id, track.Path, result.Error)
 		} else {
 			atomic.AddInt64(&w.analyzedCount, 1)
+			tracksAnalyzed.Inc()
 		}
 
 		// Call result callback
@@ -328,6 +473,14 @@ func (w *Worker) worker(id int, jobs <-chan TrackInfo) {
 			w.onResult(result)
 		}
 
+		// A track cut short by Stop stays pending for the next run
+		if w.jobs != nil && w.ctx.Err() == nil {
+			w.jobs.Finish(track.Path, result.Error)
+			if w.checkpointDue() {
+				w.checkpoint()
+			}
+		}
+
 		// Throttle
 		throttle := w.getThrottle()
 		if throttle > 0 {
@@ -336,8 +489,35 @@ func (w *Worker) worker(id int, jobs <-chan TrackInfo) {
 	}
 }
 
+// checkpointDue reports whether progress should be saved, claiming the
+// checkpoint if so
+func (w *Worker) checkpointDue() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if time.Since(w.lastCheckpoint) < checkpointInterval {
+		return false
+	}
+	w.lastCheckpoint = time.Now()
+	return true
+}
+
+// checkpoint saves the results so far and then the run, so a track is never
+// marked done before its results are on disk
+func (w *Worker) checkpoint() {
+	if w.jobs == nil {
+		return
+	}
+	if w.onCheckpoint != nil {
+		w.onCheckpoint()
+	}
+	if err := w.jobs.Save(); err != nil {
+		log.Printf("[ANALYSIS] Warning: failed to save analysis job: %v", err)
+	}
+}
+
 // analyzeTrack analyzes a single audio track
-func (w *Worker) analyzeTrack(track TrackInfo) AnalysisResult {
+func (w *Worker) analyzeTrack(track TrackInfo, extractor *FeatureExtractor) AnalysisResult {
 	result := AnalysisResult{
 		TrackPath: track.Path,
 	}
@@ -352,29 +532,49 @@ func (w *Worker) analyzeTrack(track TrackInfo) AnalysisResult {
 	// Compute file hash for change detection
 	result.FileHash = computeFileHash(track.Path, fileInfo.Size())
 
-	// Decode audio to PCM using FFmpeg
-	pcmData, err := w.decodeAudioToPCM(track.Path)
+	// Decode audio with FFmpeg, extracting features as it streams in
+	extractor.Reset()
+	extractor.SetGroups(track.Groups)
+	result.Groups = normalizeGroups(track.Groups)
+	decoded, waveform, err := w.decodeAudio(track.Path, extractor)
 	if err != nil {
 		result.Error = fmt.Errorf("decode failed: %w", err)
 		return result
 	}
 
-	if len(pcmData) < 4096 {
+	if decoded < 4096 {
 		result.Error = fmt.Errorf("audio too short")
 		return result
 	}
 
-	// Extract features
-	features := w.extractor.ProcessPCM(pcmData, 2) // Stereo
-	result.Features = features
+	result.Features = extractor.Features()
+	result.Waveform = waveform
+
+	// A missing fingerprint doesn't fail the analysis
+	if track.Fingerprint && w.fpcalcPath != "" {
+		fp, err := ComputeFingerprint(w.ctx, w.fpcalcPath, track.Path)
+		if err != nil {
+			log.Printf("[ANALYSIS] Warning: failed to fingerprint %s: %v", track.Path, err)
+		}
+		result.Fingerprint = fp
+	}
 
 	return result
 }
 
-// decodeAudioToPCM decodes audio file to raw PCM data
-func (w *Worker) decodeAudioToPCM(path string) ([]byte, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+// decodeStallTimeout aborts a decode that stops producing audio, such as a
+// read hanging on a dropped network mount. Long tracks take as long as they
+// need.
+const decodeStallTimeout = 2 * time.Minute
+
+// decodeAudio decodes an audio file with FFmpeg and streams the PCM into the
+// feature extractor and waveform builder, so memory use stays flat however
+// long the track is. It returns the number of PCM bytes decoded.
+func (w *Worker) decodeAudio(path string, extractor *FeatureExtractor) (int64, *Waveform, error) {
+	ctx, cancel := context.WithCancel(w.ctx)
 	defer cancel()
+	stall := time.AfterFunc(decodeStallTimeout, cancel)
+	defer stall.Stop()
 
 	// Build FFmpeg command
 	// Output: signed 16-bit little-endian, stereo, 44100Hz
@@ -398,11 +598,11 @@ func (w *Worker) decodeAudioToPCM(path string) ([]byte, error) {
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, fmt.Errorf("stdout pipe: %w", err)
+		return 0, nil, fmt.Errorf("stdout pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("start ffmpeg: %w", err)
+		return 0, nil, fmt.Errorf("start ffmpeg: %w", err)
 	}
 
 	defer func() {
@@ -412,31 +612,53 @@ func (w *Worker) decodeAudioToPCM(path string) ([]byte, error) {
 		}
 	}()
 
-	// Read all output (limit to ~10 minutes of audio = ~500MB max)
-	// For analysis, we only need a representative sample
-	maxBytes := 44100 * 2 * 2 * 600 // 10 minutes of stereo 16-bit @ 44100Hz
-	var buf bytes.Buffer
-	buf.Grow(1024 * 1024) // Pre-allocate 1MB
-
-	limited := io.LimitReader(stdout, int64(maxBytes))
-	_, err = io.Copy(&buf, limited)
+	peaks := newWaveformBuilder(44100, 2)
+	sink := &extractorWriter{extractor: extractor, channels: 2, stall: stall}
+	_, err = io.Copy(io.MultiWriter(sink, peaks), stdout)
 	if err != nil && err != io.EOF {
-		return nil, fmt.Errorf("read output: %w", err)
+		return 0, nil, fmt.Errorf("read output: %w", err)
+	}
+	if ctx.Err() != nil {
+		if w.ctx.Err() != nil {
+			return 0, nil, w.ctx.Err()
+		}
+		return 0, nil, fmt.Errorf("no audio decoded for %v", decodeStallTimeout)
 	}
 
 	cmd.Wait()
-	return buf.Bytes(), nil
+	return sink.written, peaks.Waveform(WaveformBuckets), nil
 }
 
+// extractorWriter feeds decoded PCM to a feature extractor, pushing back the
+// stall timer on every chunk
+type extractorWriter struct {
+	extractor *FeatureExtractor
+	channels  int
+	stall     *time.Timer
+	written   int64
+}
+
+func (e *extractorWriter) Write(p []byte) (int, error) {
+	e.stall.Reset(decodeStallTimeout)
+	e.extractor.ProcessChunk(p, e.channels)
+	e.written += int64(len(p))
+	return len(p), nil
+}
+
+// contentHashLen is the length of hashes produced by computeFileHash. Older
+// stores hold 16 character hashes that also covered the path.
+const contentHashLen = 32
+
 // computeFileHash computes a hash for change detection
-// Uses size + first and last 64KB of file
+// Uses size + first and last 64KB of file. The path is deliberately left out
+// so a moved file keeps its hash.
 func computeFileHash(path string, size int64) string {
 	hasher := sha256.New()
-	hasher.Write([]byte(fmt.Sprintf("%s:%d", path, size)))
+	hasher.Write([]byte(fmt.Sprintf("%d", size)))
 
 	f, err := os.Open(path)
 	if err != nil {
-		return hex.EncodeToString(hasher.Sum(nil))[:16]
+		return hex.EncodeToString(hasher.Sum(nil))[:contentHashLen]
 	}
 	defer f.Close()
 
@@ -452,5 +674,20 @@ func computeFileHash(path string, size int64) string {
 		hasher.Write(buf[:n])
 	}
 
-	return hex.EncodeToString(hasher.Sum(nil))[:16]
+	return hex.EncodeToString(hasher.Sum(nil))[:contentHashLen]
+}
+
+// FileHash returns the content hash of a file, as stored with its features
+func FileHash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return computeFileHash(path, info.Size()), nil
+}
+
+// IsContentHash reports whether a stored hash was computed by FileHash and
+// can be used to recognise the file at another path
+func IsContentHash(hash string) bool {
+	return len(hash) == contentHashLen
 }
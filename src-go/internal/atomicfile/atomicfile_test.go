@@ -0,0 +1,35 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteReplacesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.json")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Write(path, []byte("new")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("Expected the new contents, got %q (%v)", data, err)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0600 && runtime.GOOS != "windows" {
+		t.Errorf("Expected the file readable only by the user, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected no temporary files left behind, got %d entries", len(entries))
+	}
+
+	// A folder that doesn't exist fails without touching anything
+	if err := Write(filepath.Join(dir, "missing", "store.json"), []byte("x")); err == nil {
+		t.Error("Expected writing into a missing folder to fail")
+	}
+}
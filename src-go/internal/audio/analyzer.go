@@ -20,8 +20,19 @@ const (
 	smoothingFactor = 0.5
 )
 
+// AudioFrame is the analysis result for one FFT window
+type AudioFrame struct {
+	// Bands is the default view: 128 bands, 0-255
+	Bands []uint8
+	// Spectrum holds the normalized magnitude of each FFT bin, for callers
+	// that build their own BandView
+	Spectrum []float64
+	// SampleRate of the analyzed audio
+	SampleRate int
+}
+
 // AudioDataCallback is called when new audio analysis data is ready
-type AudioDataCallback func(bands []uint8)
+type AudioDataCallback func(frame AudioFrame)
 
 // AudioAnalyzer performs real-time FFT analysis on audio samples
 type AudioAnalyzer struct {
@@ -37,13 +48,16 @@ type AudioAnalyzer struct {
 	// Window function (Hanning)
 	window []float64
 
+	// Magnitude per FFT bin from the latest window
+	spectrum []float64
+
 	// Output: frequency bands (0-255 like Web Audio API getByteFrequencyData)
-	bands         []float64
-	smoothedBands []float64
+	view *BandView
 
 	// Sample rate for frequency calculations
 	sampleRate int
 	channels   int
+	format     SampleFormat
 
 	// Whether we have enough data for valid output
 	ready bool
@@ -53,7 +67,7 @@ type AudioAnalyzer struct {
 }
 
 // NewAudioAnalyzer creates a new audio analyzer
-func NewAudioAnalyzer(sampleRate, channels int) *AudioAnalyzer {
+func NewAudioAnalyzer(sampleRate, channels int, format SampleFormat) *AudioAnalyzer {
 	// Create Hanning window
 	window := make([]float64, fftSize)
 	for i := range window {
@@ -61,36 +75,33 @@ func NewAudioAnalyzer(sampleRate, channels int) *AudioAnalyzer {
 	}
 
 	return &AudioAnalyzer{
-		fft:           fourier.NewFFT(fftSize),
-		sampleBuffer:  make([]float64, fftSize),
-		window:        window,
-		bands:         make([]float64, numBands),
-		smoothedBands: make([]float64, numBands),
-		sampleRate:    sampleRate,
-		channels:      channels,
+		fft:          fourier.NewFFT(fftSize),
+		sampleBuffer: make([]float64, fftSize),
+		window:       window,
+		spectrum:     make([]float64, fftSize/2),
+		view:         NewBandView(DefaultVisualizerSettings(), sampleRate),
+		sampleRate:   sampleRate,
+		channels:     channels,
+		format:       format,
 	}
 }
 
-// ProcessSamples processes 16-bit PCM samples and updates frequency bands
+// ProcessSamples processes PCM samples and updates frequency bands
 func (a *AudioAnalyzer) ProcessSamples(data []byte) {
-	var shouldNotify bool
-	var bands []uint8
+	var frames []AudioFrame
 
 	a.mu.Lock()
 
-	// Convert 16-bit PCM to float64 samples
+	// Convert PCM to float64 samples
 	// Mix stereo to mono by averaging channels
-	bytesPerSample := 2 // 16-bit
+	bytesPerSample := a.format.Size()
 	samplesPerFrame := a.channels
 
 	for i := 0; i+bytesPerSample*samplesPerFrame <= len(data); i += bytesPerSample * samplesPerFrame {
 		var sum float64
 		for ch := 0; ch < samplesPerFrame; ch++ {
-			offset := i + ch*bytesPerSample
-			// Read 16-bit little-endian sample
-			sample := int16(data[offset]) | int16(data[offset+1])<<8
-			// Normalize to -1.0 to 1.0
-			sum += float64(sample) / 32768.0
+			// Read a sample normalized to -1.0 to 1.0
+			sum += a.format.sample(data[i+ch*bytesPerSample:])
 		}
 		// Average channels
 		monoSample := sum / float64(samplesPerFrame)
@@ -103,19 +114,13 @@ func (a *AudioAnalyzer) ProcessSamples(data []byte) {
 		if a.bufferIndex == 0 {
 			a.computeFFT()
 			a.ready = true
-			shouldNotify = a.callback != nil
-			if shouldNotify {
-				// Copy bands while holding lock
-				bands = make([]uint8, numBands)
-				for i, v := range a.smoothedBands {
-					if v > 255 {
-						bands[i] = 255
-					} else if v < 0 {
-						bands[i] = 0
-					} else {
-						bands[i] = uint8(v)
-					}
-				}
+			if a.callback != nil {
+				// Copy results while holding lock
+				frames = append(frames, AudioFrame{
+					Bands:      a.view.Bands(),
+					Spectrum:   append([]float64(nil), a.spectrum...),
+					SampleRate: a.sampleRate,
+				})
 			}
 		}
 	}
@@ -124,8 +129,10 @@ func (a *AudioAnalyzer) ProcessSamples(data []byte) {
 	a.mu.Unlock()
 
 	// Call callback OUTSIDE of lock for true real-time push
-	if shouldNotify && callback != nil {
-		callback(bands)
+	if callback != nil {
+		for _, frame := range frames {
+			callback(frame)
+		}
 	}
 }
 
@@ -143,98 +150,13 @@ func (a *AudioAnalyzer) computeFFT() {
 	coeffs := a.fft.Coefficients(nil, windowed)
 
 	// Compute magnitude spectrum (only use first half - Nyquist)
-	// Group into logarithmically-spaced frequency bands
-	nyquist := fftSize / 2
-	freqPerBin := float64(a.sampleRate) / float64(fftSize)
-
-	// Clear bands
-	for i := range a.bands {
-		a.bands[i] = 0
-	}
-
-	// Map FFT bins to frequency bands using logarithmic scale
-	// This gives better resolution for lower frequencies (bass/mids)
-	// which is more perceptually relevant
-	minFreq := 20.0   // 20 Hz
-	maxFreq := 20000.0 // 20 kHz (or Nyquist, whichever is lower)
-	if float64(a.sampleRate)/2 < maxFreq {
-		maxFreq = float64(a.sampleRate) / 2
-	}
-
-	logMin := math.Log10(minFreq)
-	logMax := math.Log10(maxFreq)
-	logRange := logMax - logMin
-
-	// For each band, find the frequency range and sum magnitudes
-	bandCounts := make([]int, numBands)
-
-	for bin := 1; bin < nyquist; bin++ {
-		freq := float64(bin) * freqPerBin
-		if freq < minFreq || freq > maxFreq {
-			continue
-		}
-
-		// Map frequency to band index (logarithmic)
-		logFreq := math.Log10(freq)
-		bandFloat := (logFreq - logMin) / logRange * float64(numBands)
-		band := int(bandFloat)
-		if band >= numBands {
-			band = numBands - 1
-		}
-		if band < 0 {
-			band = 0
-		}
-
-		// Compute magnitude
+	for bin := range a.spectrum {
 		real := real(coeffs[bin])
 		imag := imag(coeffs[bin])
-		magnitude := math.Sqrt(real*real + imag*imag)
-
-		// Convert to dB scale with better dynamic range for music
-		// Use -60dB to 0dB range (more sensitive than -100dB)
-		db := 20 * math.Log10(magnitude/float64(fftSize)+1e-10)
-		// Normalize to 0-255 (using -60dB to 0dB range for better sensitivity)
-		normalized := (db + 60) / 60 * 255
-		if normalized < 0 {
-			normalized = 0
-		}
-		if normalized > 255 {
-			normalized = 255
-		}
-
-		a.bands[band] += normalized
-		bandCounts[band]++
-	}
-
-	// Average each band
-	for i := range a.bands {
-		if bandCounts[i] > 0 {
-			a.bands[i] /= float64(bandCounts[i])
-		}
+		a.spectrum[bin] = math.Sqrt(real*real+imag*imag) / float64(fftSize)
 	}
 
-	// Spread energy to adjacent bands for smoother visualization
-	// This helps fill in gaps where no FFT bins map directly
-	spreadBands := make([]float64, numBands)
-	for i := range a.bands {
-		spreadBands[i] = a.bands[i]
-		// Add 30% of adjacent bands
-		if i > 0 {
-			spreadBands[i] += a.bands[i-1] * 0.3
-		}
-		if i < numBands-1 {
-			spreadBands[i] += a.bands[i+1] * 0.3
-		}
-		// Normalize back
-		if spreadBands[i] > 255 {
-			spreadBands[i] = 255
-		}
-	}
-
-	// Apply temporal smoothing
-	for i := range a.smoothedBands {
-		a.smoothedBands[i] = smoothingFactor*a.smoothedBands[i] + (1-smoothingFactor)*spreadBands[i]
-	}
+	a.view.Update(a.spectrum)
 }
 
 // GetBands returns the current frequency bands (0-255 values, similar to Web Audio API)
@@ -242,17 +164,7 @@ func (a *AudioAnalyzer) GetBands() []uint8 {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	result := make([]uint8, numBands)
-	for i, v := range a.smoothedBands {
-		if v > 255 {
-			result[i] = 255
-		} else if v < 0 {
-			result[i] = 0
-		} else {
-			result[i] = uint8(v)
-		}
-	}
-	return result
+	return a.view.Bands()
 }
 
 // SetCallback registers a callback that is called immediately when new audio data is ready
@@ -280,10 +192,8 @@ func (a *AudioAnalyzer) Reset() {
 	for i := range a.sampleBuffer {
 		a.sampleBuffer[i] = 0
 	}
-	for i := range a.bands {
-		a.bands[i] = 0
-	}
-	for i := range a.smoothedBands {
-		a.smoothedBands[i] = 0
+	for i := range a.spectrum {
+		a.spectrum[i] = 0
 	}
+	a.view.Reset()
 }
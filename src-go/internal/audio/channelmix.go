@@ -0,0 +1,43 @@
+package audio
+
+import "math"
+
+// ChannelMix changes how the left and right channels reach the device, for
+// listeners who hear on one side only or better on one side. It applies to
+// stereo output only.
+type ChannelMix struct {
+	Mono    bool    // Play both channels mixed together on each side
+	Balance float64 // -1.0 (left only) to 1.0 (right only), 0 for centred
+	Swap    bool    // Exchange the left and right channels
+}
+
+// identity reports whether the mix leaves audio as it is
+func (m ChannelMix) identity() bool {
+	return !m.Mono && !m.Swap && m.Balance == 0
+}
+
+// apply mixes interleaved stereo frames in place. The channels are swapped
+// first, then mixed down, then balanced, so a mono mix can be moved towards
+// the side that hears.
+func (m ChannelMix) apply(data []byte, format SampleFormat) {
+	left, right := 1.0, 1.0
+	if m.Balance > 0 {
+		left = 1 - math.Min(m.Balance, 1)
+	} else if m.Balance < 0 {
+		right = 1 + math.Max(m.Balance, -1)
+	}
+
+	size := format.Size()
+	for i := 0; i+2*size <= len(data); i += 2 * size {
+		l, r := format.sample(data[i:]), format.sample(data[i+size:])
+		if m.Swap {
+			l, r = r, l
+		}
+		if m.Mono {
+			l = (l + r) / 2
+			r = l
+		}
+		format.putSample(data[i:], l*left)
+		format.putSample(data[i+size:], r*right)
+	}
+}
@@ -0,0 +1,32 @@
+package audio
+
+import "testing"
+
+func TestChannelMix(t *testing.T) {
+	cases := []struct {
+		name string
+		mix  ChannelMix
+		want []int16
+	}{
+		{"swap", ChannelMix{Swap: true}, []int16{-2000, 1000}},
+		{"mono", ChannelMix{Mono: true}, []int16{-500, -500}},
+		{"balance right", ChannelMix{Balance: 0.5}, []int16{500, -2000}},
+		{"left only", ChannelMix{Balance: -1}, []int16{1000, 0}},
+		{"mono to the left", ChannelMix{Mono: true, Balance: -1}, []int16{-500, 0}},
+		{"swapped then balanced", ChannelMix{Swap: true, Balance: 1}, []int16{0, 1000}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data := pcm(1000, -2000)
+			c.mix.apply(data, FormatS16)
+			got := samplesOf(data)
+			if got[0] != c.want[0] || got[1] != c.want[1] {
+				t.Errorf("Expected %v, got %v", c.want, got)
+			}
+		})
+	}
+
+	if !(ChannelMix{}).identity() || (ChannelMix{Balance: 0.1}).identity() {
+		t.Error("Expected only the zero mix to leave audio alone")
+	}
+}
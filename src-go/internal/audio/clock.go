@@ -0,0 +1,192 @@
+package audio
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// manualHandoffTimeout is how long ManualClock.Advance waits for a tick or
+// timer to be taken before dropping it, as time.Ticker drops ticks nobody
+// reads
+const manualHandoffTimeout = 100 * time.Millisecond
+
+// Clock is the time source playback is timed by: the system clock, or a
+// ManualClock when the player runs as a simulation
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Timer
+}
+
+// Timer delivers a timer's time, or a ticker's ticks, from a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the real time
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time                  { return time.Now() }
+func (SystemClock) NewTimer(d time.Duration) Timer  { return systemTimer{time.NewTimer(d)} }
+func (SystemClock) NewTicker(d time.Duration) Timer { return systemTicker{time.NewTicker(d)} }
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.timer.C }
+func (t systemTimer) Stop()               { t.timer.Stop() }
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.ticker.C }
+func (t systemTicker) Stop()               { t.ticker.Stop() }
+
+// ManualClock only moves when Advance is called, so tests decide how much
+// playback time passes and see the same thing happen on every run
+type ManualClock struct {
+	advanceMu sync.Mutex // One Advance at a time
+
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*manualTimer
+	changed chan struct{} // Closed and replaced whenever a timer is added
+}
+
+// manualTimer is a pending timer or a ticker of a ManualClock
+type manualTimer struct {
+	at      time.Time
+	period  time.Duration // 0 for a timer
+	c       chan time.Time
+	clock   *ManualClock
+	stopped bool
+}
+
+// NewManualClock creates a clock standing at start
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start, changed: make(chan struct{})}
+}
+
+// Now returns the clock's current time
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a timer that fires once the clock has been advanced by d
+func (c *ManualClock) NewTimer(d time.Duration) Timer {
+	return c.add(d, 0)
+}
+
+// NewTicker returns a ticker that ticks every d the clock is advanced by
+func (c *ManualClock) NewTicker(d time.Duration) Timer {
+	if d <= 0 {
+		panic("non-positive interval for ManualClock.NewTicker")
+	}
+	return c.add(d, d)
+}
+
+func (c *ManualClock) add(d, period time.Duration) *manualTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTimer{at: c.now.Add(d), period: period, c: make(chan time.Time), clock: c}
+	c.timers = append(c.timers, t)
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return t
+}
+
+// Waiting returns how many timers and tickers are waiting on the clock
+func (c *ManualClock) Waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// WaitFor returns once at least n timers and tickers are waiting on the
+// clock, so a test can advance it knowing playback has got that far
+func (c *ManualClock) WaitFor(ctx context.Context, n int) error {
+	for {
+		c.mu.Lock()
+		waiting, changed := len(c.timers), c.changed
+		c.mu.Unlock()
+		if waiting >= n {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Advance moves the clock forward by d, firing what falls due on the way in
+// order. Each tick is handed to its reader before the clock moves on, so
+// what reacts to it sees the time it was due.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.advanceMu.Lock()
+	defer c.advanceMu.Unlock()
+
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		t := c.nextDueLocked(target)
+		if t == nil {
+			break
+		}
+		c.now = t.at
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+		} else {
+			c.removeLocked(t)
+		}
+		now := c.now
+		c.mu.Unlock()
+
+		select {
+		case t.c <- now:
+		case <-time.After(manualHandoffTimeout):
+		}
+
+		c.mu.Lock()
+	}
+	c.now = target
+	c.mu.Unlock()
+}
+
+// nextDueLocked returns the earliest timer due by target, or nil
+func (c *ManualClock) nextDueLocked(target time.Time) *manualTimer {
+	var next *manualTimer
+	for _, t := range c.timers {
+		if !t.at.After(target) && (next == nil || t.at.Before(next.at)) {
+			next = t
+		}
+	}
+	return next
+}
+
+func (c *ManualClock) removeLocked(t *manualTimer) {
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *manualTimer) C() <-chan time.Time { return t.c }
+
+func (t *manualTimer) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	if !t.stopped {
+		t.stopped = true
+		t.clock.removeLocked(t)
+	}
+}
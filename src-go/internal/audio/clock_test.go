@@ -0,0 +1,64 @@
+package audio
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewManualClock(start)
+	timer := c.NewTimer(time.Second)
+	ticker := c.NewTicker(300 * time.Millisecond)
+	defer ticker.Stop()
+
+	var ticks []time.Duration
+	fired := make(chan time.Duration, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for len(ticks) < 3 || len(fired) == 0 {
+			select {
+			case now := <-ticker.C():
+				ticks = append(ticks, now.Sub(start))
+			case now := <-timer.C():
+				fired <- now.Sub(start)
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.WaitFor(ctx, 2); err != nil {
+		t.Fatalf("Expected a timer and a ticker waiting, got %d", c.Waiting())
+	}
+
+	c.Advance(500 * time.Millisecond)
+	select {
+	case <-fired:
+		t.Fatal("Expected the timer not to fire early")
+	default:
+	}
+	c.Advance(500 * time.Millisecond)
+	<-done
+
+	if got := c.Now().Sub(start); got != time.Second {
+		t.Errorf("Expected the clock at 1s, got %v", got)
+	}
+	want := []time.Duration{300 * time.Millisecond, 600 * time.Millisecond, 900 * time.Millisecond}
+	if len(ticks) != len(want) {
+		t.Fatalf("Expected ticks at %v, got %v", want, ticks)
+	}
+	for i := range want {
+		if ticks[i] != want[i] {
+			t.Errorf("Expected ticks at %v, got %v", want, ticks)
+		}
+	}
+	if at := <-fired; at != time.Second {
+		t.Errorf("Expected the timer at 1s, got %v", at)
+	}
+	if c.Waiting() != 1 {
+		t.Errorf("Expected only the ticker left waiting, got %d", c.Waiting())
+	}
+}
@@ -0,0 +1,100 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/cue"
+)
+
+// trackFile returns the file a track's audio is read from: the album image
+// for tracks of a CUE sheet, or path itself
+func trackFile(path string) string {
+	if _, track, ok, err := cue.LoadTrack(path); ok && err == nil {
+		return track.File
+	}
+	return path
+}
+
+// trackDuration returns how long a track plays for. A track of a CUE sheet
+// runs until the next one starts, or the last one to the end of the image.
+func (p *Player) trackDuration(path string) (time.Duration, error) {
+	_, track, ok, err := cue.LoadTrack(path)
+	if !ok {
+		return p.decoder.Duration(path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if track.End > 0 {
+		return track.End - track.Start, nil
+	}
+	imageLength, err := p.decoder.Duration(track.File)
+	if err != nil {
+		return 0, err
+	}
+	return max(imageLength-track.Start, 0), nil
+}
+
+// decode decodes a track read from source into out, starting startMs into
+// the track. A track of a CUE sheet is cut from its range of the image, and
+// other tracks of durationMs end before any trailing silence the silence
+// provider reports.
+func (p *Player) decode(ctx context.Context, path, source string, out Output, startMs, durationMs int64) error {
+	ranged, ok := p.decoder.(RangeDecoder)
+	if !ok {
+		// Other decoders can only start from the beginning
+		return p.decoder.Decode(ctx, source, out)
+	}
+
+	_, track, isCue, err := cue.LoadTrack(path)
+	if !isCue {
+		// Stop where the trailing silence starts
+		if _, trail := p.trackSilence(path); trail > 0 && durationMs > 0 {
+			lengthMs := durationMs - trail.Milliseconds() - startMs
+			if lengthMs <= 0 {
+				return nil
+			}
+			return ranged.DecodeRange(ctx, source, out, startMs, lengthMs)
+		}
+		return ranged.DecodeRange(ctx, source, out, startMs, 0)
+	}
+	if err != nil {
+		return err
+	}
+	var lengthMs int64
+	if track.End > 0 {
+		if lengthMs = (track.End - track.Start).Milliseconds() - startMs; lengthMs <= 0 {
+			return nil // Seeked to the end
+		}
+	}
+	return ranged.DecodeRange(ctx, source, out, track.Start.Milliseconds()+startMs, lengthMs)
+}
+
+// withCueTags fills in the tags of a track of a CUE sheet from the sheet
+// when none were given, as the image's own tags describe the whole album
+func withCueTags(path string, metadata *TrackMetadata) *TrackMetadata {
+	if metadata != nil && (metadata.Title != "" || metadata.Artist != "") {
+		return metadata
+	}
+	sheet, track, ok, err := cue.LoadTrack(path)
+	if !ok || err != nil {
+		return metadata
+	}
+
+	tagged := &TrackMetadata{}
+	if metadata != nil {
+		*tagged = *metadata
+	}
+	tagged.Title = track.Title
+	if tagged.Title == "" {
+		tagged.Title = fmt.Sprintf("Track %02d", track.Number)
+	}
+	tagged.Artist = track.Performer
+	if tagged.Artist == "" {
+		tagged.Artist = sheet.Performer
+	}
+	tagged.Album = sheet.Title
+	return tagged
+}
@@ -3,14 +3,38 @@ package audio
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// DefaultResampler is the resampler used when none is configured
+const DefaultResampler = "standard"
+
+// DefaultStallTimeout is how long FFmpeg may go without producing audio
+// before it is given up on
+const DefaultStallTimeout = 10 * time.Second
+
+// ErrDecoderStalled is returned when FFmpeg stops producing audio and is
+// killed by the stall timeout
+var ErrDecoderStalled = errors.New("decoder stalled")
+
+// resamplers are the FFmpeg filters that convert tracks to the output sample
+// rate, by quality. "soxr" needs an FFmpeg built with libsoxr.
+var resamplers = map[string]string{
+	"fast":     "aresample=filter_size=8:phase_shift=6",
+	"standard": "", // FFmpeg's own defaults
+	"high":     "aresample=filter_size=64:phase_shift=14:linear_interp=1",
+	"soxr":     "aresample=resampler=soxr:precision=28",
+}
+
 // FileMetadata contains metadata extracted from an audio file
 type FileMetadata struct {
 	Title    string
@@ -23,6 +47,10 @@ type FileMetadata struct {
 type FFmpegDecoder struct {
 	ffmpegPath  string
 	ffprobePath string
+
+	mu           sync.Mutex
+	resampler    string
+	stallTimeout time.Duration
 }
 
 // NewFFmpegDecoder creates a new FFmpeg-based decoder
@@ -39,11 +67,47 @@ func NewFFmpegDecoder() (*FFmpegDecoder, error) {
 	}
 
 	return &FFmpegDecoder{
-		ffmpegPath:  ffmpegPath,
-		ffprobePath: ffprobePath,
+		ffmpegPath:   ffmpegPath,
+		ffprobePath:  ffprobePath,
+		resampler:    DefaultResampler,
+		stallTimeout: DefaultStallTimeout,
 	}, nil
 }
 
+// SetResampler sets the resampler used from the next decode: "fast",
+// "standard", "high" or "soxr"
+func (d *FFmpegDecoder) SetResampler(name string) error {
+	if _, ok := resamplers[name]; !ok {
+		return fmt.Errorf("unknown resampler %q", name)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.resampler = name
+	return nil
+}
+
+// Resampler returns the name of the resampler in use
+func (d *FFmpegDecoder) Resampler() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.resampler
+}
+
+// SetStallTimeout sets how long FFmpeg may go without producing audio before
+// it is killed, 0 to wait for it indefinitely
+func (d *FFmpegDecoder) SetStallTimeout(timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stallTimeout = timeout
+}
+
+// StallTimeout returns how long FFmpeg may go without producing audio
+func (d *FFmpegDecoder) StallTimeout() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stallTimeout
+}
+
 // Decode decodes an audio file and writes PCM data to the output
 func (d *FFmpegDecoder) Decode(ctx context.Context, path string, output Output) error {
 	return d.DecodeFrom(ctx, path, output, 0)
@@ -51,8 +115,13 @@ func (d *FFmpegDecoder) Decode(ctx context.Context, path string, output Output)
 
 // DecodeFrom decodes an audio file starting from the specified position
 func (d *FFmpegDecoder) DecodeFrom(ctx context.Context, path string, output Output, startMs int64) error {
-	// Build ffmpeg command to decode to raw PCM
-	// Output format: signed 16-bit little-endian, stereo, 44100Hz
+	return d.DecodeRange(ctx, path, output, startMs, 0)
+}
+
+// DecodeRange decodes lengthMs of an audio file from startMs, or the rest of
+// the file if lengthMs is 0
+func (d *FFmpegDecoder) DecodeRange(ctx context.Context, path string, output Output, startMs, lengthMs int64) error {
+	// Build ffmpeg command to decode to raw PCM in the output's format
 	args := []string{}
 
 	// Add seek position if not starting from beginning
@@ -60,11 +129,31 @@ func (d *FFmpegDecoder) DecodeFrom(ctx context.Context, path string, output Outp
 		startSec := float64(startMs) / 1000.0
 		args = append(args, "-ss", fmt.Sprintf("%.3f", startSec))
 	}
+	if lengthMs > 0 {
+		args = append(args, "-t", fmt.Sprintf("%.3f", float64(lengthMs)/1000.0))
+	}
+
+	args = append(args, "-i", path)
+	return d.run(ctx, args, nil, output)
+}
 
+// DecodeStream decodes a network stream. input is "pipe:0" to decode what is
+// read from r, or a URL ffmpeg fetches itself (HLS playlists).
+func (d *FFmpegDecoder) DecodeStream(ctx context.Context, input string, r io.Reader, output Output) error {
+	return d.run(ctx, []string{"-i", input}, r, output)
+}
+
+// run starts ffmpeg with the given input arguments, feeding it r if set, and
+// writes the decoded PCM to the output
+func (d *FFmpegDecoder) run(ctx context.Context, inputArgs []string, r io.Reader, output Output) error {
+	args := inputArgs
+	if filter := resamplers[d.Resampler()]; filter != "" {
+		args = append(args, "-af", filter)
+	}
+	muxer, codec := output.Format().ffmpegArgs()
 	args = append(args,
-		"-i", path,
-		"-f", "s16le",
-		"-acodec", "pcm_s16le",
+		"-f", muxer,
+		"-acodec", codec,
 		"-ac", fmt.Sprintf("%d", output.Channels()),
 		"-ar", fmt.Sprintf("%d", output.SampleRate()),
 		"-",
@@ -75,10 +164,24 @@ func (d *FFmpegDecoder) DecodeFrom(ctx context.Context, path string, output Outp
 	if err != nil {
 		return fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
+	// Fed by hand rather than through cmd.Stdin so Wait doesn't block on a
+	// stalled read once ffmpeg has exited
+	var stdin io.WriteCloser
+	if r != nil {
+		if stdin, err = cmd.StdinPipe(); err != nil {
+			return fmt.Errorf("failed to get stdin pipe: %w", err)
+		}
+	}
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start ffmpeg: %w", err)
 	}
+	if stdin != nil {
+		go func() {
+			io.Copy(stdin, r)
+			stdin.Close()
+		}()
+	}
 
 	// Ensure process is killed and reaped on any exit path
 	defer func() {
@@ -88,6 +191,19 @@ func (d *FFmpegDecoder) DecodeFrom(ctx context.Context, path string, output Outp
 		}
 	}()
 
+	// Kill ffmpeg if a read waits on it too long. Time spent blocked writing
+	// to a paused or full output isn't counted.
+	var stalled atomic.Bool
+	timeout := d.StallTimeout()
+	var watchdog *time.Timer
+	if timeout > 0 {
+		watchdog = time.AfterFunc(timeout, func() {
+			stalled.Store(true)
+			cmd.Process.Kill()
+		})
+		defer watchdog.Stop()
+	}
+
 	// Read decoded audio and write to output
 	buf := make([]byte, 4096)
 	for {
@@ -98,6 +214,9 @@ func (d *FFmpegDecoder) DecodeFrom(ctx context.Context, path string, output Outp
 		}
 
 		n, err := stdout.Read(buf)
+		if watchdog != nil {
+			watchdog.Stop()
+		}
 		if n > 0 {
 			if _, writeErr := output.Write(buf[:n]); writeErr != nil {
 				return fmt.Errorf("failed to write to output: %w", writeErr)
@@ -106,8 +225,14 @@ func (d *FFmpegDecoder) DecodeFrom(ctx context.Context, path string, output Outp
 		if err != nil {
 			break
 		}
+		if watchdog != nil {
+			watchdog.Reset(timeout)
+		}
 	}
 
+	if stalled.Load() {
+		return fmt.Errorf("%w: no audio for %v", ErrDecoderStalled, timeout)
+	}
 	return cmd.Wait()
 }
 
@@ -0,0 +1,252 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// DSPStage is a step of the DSP chain between the decoder and the output. It
+// gets interleaved samples scaled to -1..1 in whole frames, may change them
+// in place, and returns the samples to pass on. Samples beyond full scale are
+// clipped once they leave the chain.
+type DSPStage interface {
+	Process(samples []float64) []float64
+}
+
+// TrackAwareStage is a stage that adapts to the track being played, such as
+// one applying its ReplayGain tags. StartTrack is called before the track's
+// first samples reach the stage.
+type TrackAwareStage interface {
+	DSPStage
+	StartTrack(path string)
+}
+
+// DSPStageFactory builds a stage from its parameters for the output's sample
+// rate and channel count, returning an error for parameters it doesn't take
+// or that are out of range
+type DSPStageFactory func(params map[string]float64, sampleRate, channels int) (DSPStage, error)
+
+// DSPStageConfig places a stage in a DSP chain
+type DSPStageConfig struct {
+	Name    string             `json:"name"`
+	Enabled bool               `json:"enabled"`
+	Params  map[string]float64 `json:"params,omitempty"`
+}
+
+// DSPStageInfo describes a stage that can be put in a DSP chain
+type DSPStageInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Params      []string `json:"params,omitempty"`
+}
+
+type registeredStage struct {
+	info    DSPStageInfo
+	factory DSPStageFactory
+}
+
+var (
+	dspStagesMu sync.RWMutex
+	dspStages   = make(map[string]registeredStage)
+)
+
+// RegisterDSPStage makes a stage available to DSP chains under name, taking
+// the named parameters. Registering a name again replaces the stage for
+// chains set after that.
+func RegisterDSPStage(name, description string, params []string, factory DSPStageFactory) {
+	dspStagesMu.Lock()
+	defer dspStagesMu.Unlock()
+	dspStages[name] = registeredStage{
+		info:    DSPStageInfo{Name: name, Description: description, Params: params},
+		factory: factory,
+	}
+}
+
+// DSPStages returns the stages that can be put in a DSP chain, sorted by name
+func DSPStages() []DSPStageInfo {
+	dspStagesMu.RLock()
+	defer dspStagesMu.RUnlock()
+
+	stages := make([]DSPStageInfo, 0, len(dspStages))
+	for _, s := range dspStages {
+		stages = append(stages, s.info)
+	}
+	sort.Slice(stages, func(i, j int) bool { return stages[i].Name < stages[j].Name })
+	return stages
+}
+
+// newDSPStage builds a registered stage
+func newDSPStage(cfg DSPStageConfig, sampleRate, channels int) (DSPStage, error) {
+	dspStagesMu.RLock()
+	s, ok := dspStages[cfg.Name]
+	dspStagesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown DSP stage %q", cfg.Name)
+	}
+	for name := range cfg.Params {
+		if !slices.Contains(s.info.Params, name) {
+			return nil, fmt.Errorf("DSP stage %q has no parameter %q", cfg.Name, name)
+		}
+	}
+	stage, err := s.factory(cfg.Params, sampleRate, channels)
+	if err != nil {
+		return nil, fmt.Errorf("DSP stage %q: %w", cfg.Name, err)
+	}
+	return stage, nil
+}
+
+// dspChain runs audio through the configured stages in order. Disabled
+// stages are built too, so a chain is checked in full when it's set.
+type dspChain struct {
+	sampleRate int
+	channels   int
+	format     SampleFormat
+
+	mu      sync.Mutex
+	configs []DSPStageConfig
+	stages  []DSPStage // Parallel to configs
+	track   string
+	samples []float64 // Reused between writes
+}
+
+func newDSPChain(sampleRate, channels int, format SampleFormat) *dspChain {
+	return &dspChain{sampleRate: sampleRate, channels: max(channels, 1), format: format}
+}
+
+// set replaces the chain. An unchanged chain keeps its stages, and with them
+// their filter state.
+func (c *dspChain) set(configs []DSPStageConfig) error {
+	c.mu.Lock()
+	same := reflect.DeepEqual(configs, c.configs)
+	track := c.track
+	c.mu.Unlock()
+	if same {
+		return nil
+	}
+
+	stages := make([]DSPStage, len(configs))
+	for i, cfg := range configs {
+		stage, err := newDSPStage(cfg, c.sampleRate, c.channels)
+		if err != nil {
+			return err
+		}
+		if ta, ok := stage.(TrackAwareStage); ok && track != "" {
+			ta.StartTrack(track)
+		}
+		stages[i] = stage
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.configs = append([]DSPStageConfig(nil), configs...)
+	c.stages = stages
+	return nil
+}
+
+// get returns the stages of the chain in order
+func (c *dspChain) get() []DSPStageConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]DSPStageConfig{}, c.configs...)
+}
+
+// startTrack tells the stages a new track is about to play
+func (c *dspChain) startTrack(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.track = path
+	for _, stage := range c.stages {
+		if ta, ok := stage.(TrackAwareStage); ok {
+			ta.StartTrack(path)
+		}
+	}
+}
+
+// process runs whole frames of PCM through the enabled stages. data is
+// returned untouched when none are enabled.
+func (c *dspChain) process(data []byte) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	enabled := false
+	for _, cfg := range c.configs {
+		enabled = enabled || cfg.Enabled
+	}
+	if !enabled {
+		return data
+	}
+
+	size := c.format.Size()
+	n := len(data) / size
+	if cap(c.samples) < n {
+		c.samples = make([]float64, n)
+	}
+	samples := c.samples[:n]
+	for i := range samples {
+		samples[i] = c.format.sample(data[i*size:])
+	}
+	for i, stage := range c.stages {
+		if c.configs[i].Enabled {
+			samples = stage.Process(samples)
+		}
+	}
+
+	out := make([]byte, size*len(samples))
+	for i, s := range samples {
+		c.format.putSample(out[i*size:], s)
+	}
+	return out
+}
+
+// dspOutput passes what a decoder writes through the DSP chain to the device
+// output. It holds back a partial frame until the rest of it arrives, so one
+// is made for each stream.
+type dspOutput struct {
+	Output
+	chain   *dspChain
+	partial []byte
+}
+
+func newDSPOutput(out Output, chain *dspChain) *dspOutput {
+	return &dspOutput{Output: out, chain: chain}
+}
+
+func (o *dspOutput) Write(data []byte) (int, error) {
+	frameSize := o.Channels() * o.Format().Size()
+	buf := data
+	if len(o.partial) > 0 {
+		buf = append(o.partial, data...)
+	}
+	whole := len(buf) - len(buf)%frameSize
+	o.partial = append(o.partial[:0:0], buf[whole:]...)
+	if whole == 0 {
+		return len(data), nil
+	}
+
+	if _, err := o.Output.Write(o.chain.process(buf[:whole])); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Close drops any partial frame left over. It does not close the device
+// output.
+func (o *dspOutput) Close() error {
+	o.partial = nil
+	return nil
+}
+
+// clampSample converts a sample scaled to 16 bits to an int16, clipping it
+func clampSample(v float64) int16 {
+	switch {
+	case v > math.MaxInt16:
+		return math.MaxInt16
+	case v < math.MinInt16:
+		return math.MinInt16
+	}
+	return int16(math.Round(v))
+}
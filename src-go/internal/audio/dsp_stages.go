@@ -0,0 +1,375 @@
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// eqBands are the centre frequencies of the graphic equalizer, keyed by the
+// name of their parameter
+var eqBands = []struct {
+	name string
+	freq float64
+}{
+	{"31", 31}, {"62", 62}, {"125", 125}, {"250", 250}, {"500", 500},
+	{"1k", 1000}, {"2k", 2000}, {"4k", 4000}, {"8k", 8000}, {"16k", 16000},
+}
+
+// maxEQGain is the most a band or the preamp can boost or cut, in dB
+const maxEQGain = 12
+
+// replayGainReference is how far the ReplayGain reference level (89 dB SPL)
+// sits above the EBU R128 one (-23 LUFS) that Opus gain tags use
+const replayGainReference = 5
+
+func init() {
+	eqParams := []string{"preamp"}
+	for _, band := range eqBands {
+		eqParams = append(eqParams, band.name)
+	}
+	RegisterDSPStage("eq", "Ten band graphic equalizer, gains in dB", eqParams, newEQStage)
+	RegisterDSPStage("replaygain", "Levels tracks by their ReplayGain tags; album is 1 to use album gain", []string{"preamp", "album", "fallback"}, newReplayGainStage)
+	RegisterDSPStage("mono", "Mixes all channels down to mono", nil, newMonoStage)
+	RegisterDSPStage("widener", "Widens or narrows the stereo image; width 1 leaves it as it is", []string{"width"}, newWidenerStage)
+	RegisterDSPStage("limiter", "Holds peaks under threshold dB, recovering over release ms", []string{"threshold", "release"}, newLimiterStage)
+}
+
+// dspParam returns a stage parameter, or def if it isn't set, checking that
+// it lies within [lo, hi]
+func dspParam(params map[string]float64, name string, def, lo, hi float64) (float64, error) {
+	v, ok := params[name]
+	if !ok {
+		return def, nil
+	}
+	if math.IsNaN(v) || v < lo || v > hi {
+		return 0, fmt.Errorf("%s must be between %g and %g", name, lo, hi)
+	}
+	return v, nil
+}
+
+func dbToScale(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// biquad is a second-order filter with per-channel state
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     []float64
+}
+
+// newPeakingFilter returns an RBJ peaking filter boosting or cutting gainDB
+// around freq
+func newPeakingFilter(freq, gainDB, q float64, sampleRate, channels int) *biquad {
+	a := math.Pow(10, gainDB/40)
+	w0 := 2 * math.Pi * freq / float64(sampleRate)
+	alpha := math.Sin(w0) / (2 * q)
+	a0 := 1 + alpha/a
+	return &biquad{
+		b0: (1 + alpha*a) / a0,
+		b1: -2 * math.Cos(w0) / a0,
+		b2: (1 - alpha*a) / a0,
+		a1: -2 * math.Cos(w0) / a0,
+		a2: (1 - alpha/a) / a0,
+		x1: make([]float64, channels), x2: make([]float64, channels),
+		y1: make([]float64, channels), y2: make([]float64, channels),
+	}
+}
+
+func (f *biquad) filter(ch int, x float64) float64 {
+	y := f.b0*x + f.b1*f.x1[ch] + f.b2*f.x2[ch] - f.a1*f.y1[ch] - f.a2*f.y2[ch]
+	f.x2[ch], f.x1[ch] = f.x1[ch], x
+	f.y2[ch], f.y1[ch] = f.y1[ch], y
+	return y
+}
+
+// eqStage is a graphic equalizer of peaking filters an octave apart
+type eqStage struct {
+	channels int
+	preamp   float64
+	filters  []*biquad
+}
+
+func newEQStage(params map[string]float64, sampleRate, channels int) (DSPStage, error) {
+	preamp, err := dspParam(params, "preamp", 0, -maxEQGain, maxEQGain)
+	if err != nil {
+		return nil, err
+	}
+	s := &eqStage{channels: channels, preamp: dbToScale(preamp)}
+	for _, band := range eqBands {
+		gain, err := dspParam(params, band.name, 0, -maxEQGain, maxEQGain)
+		if err != nil {
+			return nil, err
+		}
+		// Bands above Nyquist can't be filtered, and flat ones needn't be
+		if gain == 0 || band.freq >= float64(sampleRate)/2 {
+			continue
+		}
+		s.filters = append(s.filters, newPeakingFilter(band.freq, gain, math.Sqrt2, sampleRate, channels))
+	}
+	return s, nil
+}
+
+func (s *eqStage) Process(samples []float64) []float64 {
+	for i, sample := range samples {
+		ch := i % s.channels
+		v := sample * s.preamp
+		for _, f := range s.filters {
+			v = f.filter(ch, v)
+		}
+		samples[i] = v
+	}
+	return samples
+}
+
+// replayGainStage scales each track by its ReplayGain tags, read when the
+// track starts. Peak tags keep the gain from clipping.
+type replayGainStage struct {
+	preamp   float64 // dB
+	album    bool
+	fallback float64 // dB for tracks without tags
+
+	mu    sync.Mutex
+	track string
+	scale float64
+}
+
+func newReplayGainStage(params map[string]float64, sampleRate, channels int) (DSPStage, error) {
+	preamp, err := dspParam(params, "preamp", 0, -15, 15)
+	if err != nil {
+		return nil, err
+	}
+	album, err := dspParam(params, "album", 0, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	fallback, err := dspParam(params, "fallback", 0, -15, 15)
+	if err != nil {
+		return nil, err
+	}
+	return &replayGainStage{preamp: preamp, album: album != 0, fallback: fallback, scale: 1}, nil
+}
+
+// StartTrack looks up the track's gain in the background; the fallback gain
+// applies until it's known
+func (s *replayGainStage) StartTrack(path string) {
+	s.mu.Lock()
+	s.track = path
+	s.scale = dbToScale(s.preamp + s.fallback)
+	s.mu.Unlock()
+	if IsStreamURL(path) {
+		return
+	}
+
+	go func() {
+		gain, ok := readReplayGain(trackFile(path), s.album)
+		if !ok {
+			return
+		}
+		scale := dbToScale(s.preamp + gain.db)
+		if gain.peak > 0 {
+			scale = math.Min(scale, 1/gain.peak)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.track == path {
+			s.scale = scale
+		}
+	}()
+}
+
+func (s *replayGainStage) Process(samples []float64) []float64 {
+	s.mu.Lock()
+	scale := s.scale
+	s.mu.Unlock()
+	if scale == 1 {
+		return samples
+	}
+	for i := range samples {
+		samples[i] *= scale
+	}
+	return samples
+}
+
+// replayGain is the gain a track's tags ask for
+type replayGain struct {
+	db   float64
+	peak float64 // Linear sample peak, 0 if not tagged
+}
+
+// readReplayGain reads the track or album gain of a file from its tags,
+// falling back to the other when only one is tagged. Opus files carry
+// R128 gains, which are converted to the ReplayGain reference.
+func readReplayGain(path string, album bool) (replayGain, bool) {
+	ffprobePath, err := exec.LookPath("ffprobe")
+	if err != nil {
+		return replayGain{}, false
+	}
+	output, err := exec.Command(ffprobePath,
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_entries", "format_tags:stream_tags",
+		path,
+	).Output()
+	if err != nil {
+		return replayGain{}, false
+	}
+
+	var probe struct {
+		Format struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"format"`
+		Streams []struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"streams"`
+	}
+	if json.Unmarshal(output, &probe) != nil {
+		return replayGain{}, false
+	}
+	tags := make(map[string]string)
+	for _, stream := range probe.Streams {
+		for k, v := range stream.Tags {
+			tags[strings.ToLower(k)] = v
+		}
+	}
+	for k, v := range probe.Format.Tags {
+		tags[strings.ToLower(k)] = v
+	}
+	return parseReplayGain(tags, album)
+}
+
+// parseReplayGain picks the gain from lowercased tags
+func parseReplayGain(tags map[string]string, album bool) (replayGain, bool) {
+	order := []string{"track", "album"}
+	if album {
+		order = []string{"album", "track"}
+	}
+	for _, kind := range order {
+		if db, ok := parseGainDB(tags["replaygain_"+kind+"_gain"]); ok {
+			peak, _ := strconv.ParseFloat(strings.TrimSpace(tags["replaygain_"+kind+"_peak"]), 64)
+			return replayGain{db: db, peak: peak}, true
+		}
+	}
+	for _, kind := range order {
+		// Q7.8 fixed point dB
+		if q, err := strconv.Atoi(strings.TrimSpace(tags["r128_"+kind+"_gain"])); err == nil {
+			return replayGain{db: float64(q)/256 + replayGainReference}, true
+		}
+	}
+	return replayGain{}, false
+}
+
+// parseGainDB parses a gain such as "-6.54 dB"
+func parseGainDB(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(s, "dB"), "db"))
+	if s == "" {
+		return 0, false
+	}
+	db, err := strconv.ParseFloat(s, 64)
+	return db, err == nil
+}
+
+// monoStage replaces every channel with the average of all of them
+type monoStage struct {
+	channels int
+}
+
+func newMonoStage(params map[string]float64, sampleRate, channels int) (DSPStage, error) {
+	return &monoStage{channels: channels}, nil
+}
+
+func (s *monoStage) Process(samples []float64) []float64 {
+	if s.channels < 2 {
+		return samples
+	}
+	for i := 0; i+s.channels <= len(samples); i += s.channels {
+		sum := 0.0
+		for _, v := range samples[i : i+s.channels] {
+			sum += v
+		}
+		mixed := sum / float64(s.channels)
+		for ch := 0; ch < s.channels; ch++ {
+			samples[i+ch] = mixed
+		}
+	}
+	return samples
+}
+
+// widenerStage scales the difference between the left and right channels
+type widenerStage struct {
+	channels int
+	width    float64
+}
+
+func newWidenerStage(params map[string]float64, sampleRate, channels int) (DSPStage, error) {
+	width, err := dspParam(params, "width", 1.5, 0, 3)
+	if err != nil {
+		return nil, err
+	}
+	return &widenerStage{channels: channels, width: width}, nil
+}
+
+func (s *widenerStage) Process(samples []float64) []float64 {
+	if s.channels != 2 || s.width == 1 {
+		return samples
+	}
+	for i := 0; i+1 < len(samples); i += 2 {
+		l, r := samples[i], samples[i+1]
+		mid, side := (l+r)/2, (l-r)/2*s.width
+		samples[i] = mid + side
+		samples[i+1] = mid - side
+	}
+	return samples
+}
+
+// limiterStage turns frames above the threshold down at once and lets the
+// gain recover gradually, so loud passages don't clip
+type limiterStage struct {
+	channels  int
+	threshold float64 // Linear sample level, 1 for full scale
+	recovery  float64 // Share of the remaining gain recovered each frame
+	gain      float64
+}
+
+func newLimiterStage(params map[string]float64, sampleRate, channels int) (DSPStage, error) {
+	threshold, err := dspParam(params, "threshold", -1, -24, 0)
+	if err != nil {
+		return nil, err
+	}
+	release, err := dspParam(params, "release", 100, 1, 2000)
+	if err != nil {
+		return nil, err
+	}
+	return &limiterStage{
+		channels:  channels,
+		threshold: dbToScale(threshold),
+		recovery:  1 - math.Exp(-1000/(release*float64(sampleRate))),
+		gain:      1,
+	}, nil
+}
+
+func (s *limiterStage) Process(samples []float64) []float64 {
+	for i := 0; i+s.channels <= len(samples); i += s.channels {
+		frame := samples[i : i+s.channels]
+		peak := 0.0
+		for _, v := range frame {
+			peak = math.Max(peak, math.Abs(v))
+		}
+		if target := s.threshold / peak; peak > 0 && target < s.gain {
+			s.gain = target
+		} else {
+			s.gain += (1 - s.gain) * s.recovery
+		}
+		if s.gain < 1 {
+			for ch, v := range frame {
+				frame[ch] = v * s.gain
+			}
+		}
+	}
+	return samples
+}
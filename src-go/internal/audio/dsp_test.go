@@ -0,0 +1,196 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func pcm(samples ...int16) []byte {
+	data := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(s))
+	}
+	return data
+}
+
+func samplesOf(data []byte) []int16 {
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	return samples
+}
+
+// scaleStage multiplies samples by a factor, to tell stage order apart
+type scaleStage struct {
+	factor float64
+}
+
+func (s *scaleStage) Process(samples []float64) []float64 {
+	for i := range samples {
+		samples[i] *= s.factor
+	}
+	return samples
+}
+
+// offsetStage adds to samples
+type offsetStage struct {
+	offset float64
+}
+
+func (s *offsetStage) Process(samples []float64) []float64 {
+	for i := range samples {
+		samples[i] += s.offset
+	}
+	return samples
+}
+
+func init() {
+	RegisterDSPStage("test-double", "", nil, func(map[string]float64, int, int) (DSPStage, error) {
+		return &scaleStage{factor: 2}, nil
+	})
+	RegisterDSPStage("test-add", "", nil, func(map[string]float64, int, int) (DSPStage, error) {
+		return &offsetStage{offset: 1.0 / 32768}, nil
+	})
+}
+
+func TestDSPChainOrderAndToggle(t *testing.T) {
+	chain := newDSPChain(1000, 2, FormatS16)
+	if out := chain.process(pcm(3, 3)); samplesOf(out)[0] != 3 {
+		t.Errorf("Expected an empty chain to pass audio through, got %v", samplesOf(out))
+	}
+
+	if err := chain.set([]DSPStageConfig{{Name: "test-double", Enabled: true}, {Name: "test-add", Enabled: true}}); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if got := samplesOf(chain.process(pcm(3, 3)))[0]; got != 7 {
+		t.Errorf("Expected (3*2)+1 = 7, got %d", got)
+	}
+
+	if err := chain.set([]DSPStageConfig{{Name: "test-add", Enabled: true}, {Name: "test-double", Enabled: true}}); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if got := samplesOf(chain.process(pcm(3, 3)))[0]; got != 8 {
+		t.Errorf("Expected (3+1)*2 = 8 after reordering, got %d", got)
+	}
+
+	if err := chain.set([]DSPStageConfig{{Name: "test-add", Enabled: false}, {Name: "test-double", Enabled: true}}); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if got := samplesOf(chain.process(pcm(3, 3)))[0]; got != 6 {
+		t.Errorf("Expected only the enabled stage to run, got %d", got)
+	}
+}
+
+func TestDSPChainRejectsBadStages(t *testing.T) {
+	chain := newDSPChain(44100, 2, FormatS16)
+	good := []DSPStageConfig{{Name: "limiter", Enabled: true}}
+	if err := chain.set(good); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+
+	for _, bad := range [][]DSPStageConfig{
+		{{Name: "reverb", Enabled: true}},
+		{{Name: "eq", Params: map[string]float64{"3k": 2}}},
+		{{Name: "eq", Params: map[string]float64{"1k": 30}}},
+		{{Name: "mono"}, {Name: "widener", Params: map[string]float64{"width": -1}}},
+	} {
+		if err := chain.set(bad); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+	if got := chain.get(); len(got) != 1 || got[0].Name != "limiter" {
+		t.Errorf("Expected a rejected chain to leave the old one, got %+v", got)
+	}
+}
+
+func TestDSPOutputCarriesPartialFrames(t *testing.T) {
+	out := &memoryOutput{}
+	chain := newDSPChain(out.SampleRate(), out.Channels(), out.Format())
+	if err := chain.set([]DSPStageConfig{{Name: "test-double", Enabled: true}}); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	dsp := newDSPOutput(out, chain)
+
+	data := pcm(1, 2, 3, 4)
+	for _, part := range [][]byte{data[:3], data[3:5], data[5:]} {
+		if n, err := dsp.Write(part); err != nil || n != len(part) {
+			t.Fatalf("Write returned %d, %v", n, err)
+		}
+	}
+	got := samplesOf(out.buf.Bytes())
+	want := []int16{2, 4, 6, 8}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Sample %d: expected %d, got %d", i, want[i], got[i])
+		}
+	}
+}
+
+func TestMonoAndWidener(t *testing.T) {
+	mono, _ := newMonoStage(nil, 44100, 2)
+	if got := mono.Process([]float64{0.5, -0.25}); got[0] != 0.125 || got[1] != 0.125 {
+		t.Errorf("Expected both channels at 0.125, got %v", got)
+	}
+
+	narrow, _ := newWidenerStage(map[string]float64{"width": 0}, 44100, 2)
+	if got := narrow.Process([]float64{0.5, -0.25}); got[0] != 0.125 || got[1] != 0.125 {
+		t.Errorf("Expected width 0 to collapse to mono, got %v", got)
+	}
+}
+
+func TestLimiterHoldsPeaks(t *testing.T) {
+	limiter, err := newLimiterStage(map[string]float64{"threshold": -6}, 44100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ceiling := dbToScale(-6) + 1e-9
+
+	samples := make([]float64, 4410)
+	for i := range samples {
+		samples[i] = 0.9
+		if i%2 == 1 {
+			samples[i] = -1
+		}
+	}
+	for i, s := range limiter.Process(samples) {
+		if s > ceiling || s < -ceiling {
+			t.Fatalf("Sample %d is %v, over the %v ceiling", i, s, ceiling)
+		}
+	}
+
+	// The gain recovers once the audio gets quiet
+	quiet := make([]float64, 44100)
+	for i := range quiet {
+		quiet[i] = 0.03
+	}
+	if got := limiter.Process(quiet); math.Abs(got[len(got)-1]-0.03) > 1e-6 {
+		t.Errorf("Expected quiet audio to be left alone after the release, got %v", got[len(got)-1])
+	}
+}
+
+func TestParseReplayGain(t *testing.T) {
+	tags := map[string]string{
+		"replaygain_track_gain": "-6.50 dB",
+		"replaygain_track_peak": "0.98",
+		"replaygain_album_gain": "-4 dB",
+	}
+	if g, ok := parseReplayGain(tags, false); !ok || g.db != -6.5 || g.peak != 0.98 {
+		t.Errorf("Expected the track gain, got %+v %v", g, ok)
+	}
+	if g, ok := parseReplayGain(tags, true); !ok || g.db != -4 {
+		t.Errorf("Expected the album gain, got %+v %v", g, ok)
+	}
+
+	// Opus R128 gains are Q7.8 relative to -23 LUFS
+	if g, ok := parseReplayGain(map[string]string{"r128_track_gain": "-512"}, true); !ok || g.db != 3 {
+		t.Errorf("Expected -2 dB R128 to be +3 dB ReplayGain, got %+v %v", g, ok)
+	}
+	if _, ok := parseReplayGain(map[string]string{"title": "x"}, false); ok {
+		t.Error("Expected untagged tracks to have no gain")
+	}
+}
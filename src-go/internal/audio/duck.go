@@ -0,0 +1,85 @@
+package audio
+
+import (
+	"errors"
+	"time"
+)
+
+// Sources that duck the player
+const (
+	DuckManual     = "duck"       // The duck command
+	DuckOtherAudio = "otherAudio" // Another application playing audio
+)
+
+// duckHold is one source's hold on the volume
+type duckHold struct {
+	level float64
+	timer *time.Timer // Releases the hold, nil if it lasts until released
+}
+
+// Duck lowers playback to level (0.0 - 1.0) of the volume on behalf of
+// source, e.g. while an announcement plays. The hold lasts for d, or until
+// source ducks again with a level of 1 if d is 0. While several sources
+// hold the volume down the lowest level wins.
+func (p *Player) Duck(source string, level float64, d time.Duration) error {
+	if level < 0 || level > 1 {
+		return errors.New("duck level must be between 0.0 and 1.0")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if hold, ok := p.ducks[source]; ok {
+		if hold.timer != nil {
+			hold.timer.Stop()
+		}
+		delete(p.ducks, source)
+	}
+	if level < 1 {
+		hold := &duckHold{level: level}
+		if d > 0 {
+			hold.timer = time.AfterFunc(d, func() { p.releaseDuck(source, hold) })
+		}
+		if p.ducks == nil {
+			p.ducks = make(map[string]*duckHold)
+		}
+		p.ducks[source] = hold
+	}
+	p.applyDuckLocked()
+	return nil
+}
+
+// releaseDuck ends hold once its time is up, unless source has ducked again
+func (p *Player) releaseDuck(source string, hold *duckHold) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ducks[source] == hold {
+		delete(p.ducks, source)
+		p.applyDuckLocked()
+	}
+}
+
+// DuckLevel returns the share of the volume playback is ducked to, 1 when
+// nothing is ducking it
+func (p *Player) DuckLevel() float64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.duckLevelLocked()
+}
+
+func (p *Player) duckLevelLocked() float64 {
+	level := 1.0
+	for _, hold := range p.ducks {
+		level = min(level, hold.level)
+	}
+	return level
+}
+
+// applyDuckLocked ducks the output to the lowest level held (must be called
+// with lock held)
+func (p *Player) applyDuckLocked() {
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		otoOutput.SetDuck(p.duckLevelLocked())
+	}
+}
@@ -0,0 +1,98 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/hajimehoshi/oto/v2"
+)
+
+// SampleFormat is how samples are encoded on their way from the decoder to
+// the device
+type SampleFormat int
+
+const (
+	// FormatS16 is signed 16-bit little-endian, enough for CD audio
+	FormatS16 SampleFormat = iota
+	// FormatF32 is 32-bit float little-endian. It carries 24-bit sources
+	// intact and doesn't lose resolution to volume, gain or DSP.
+	FormatF32
+)
+
+// FormatForBitDepth returns the format that carries bitDepth bits
+func FormatForBitDepth(bitDepth int) SampleFormat {
+	if bitDepth > 16 {
+		return FormatF32
+	}
+	return FormatS16
+}
+
+// BitDepth returns the resolution the format carries
+func (f SampleFormat) BitDepth() int {
+	if f == FormatF32 {
+		return 24
+	}
+	return 16
+}
+
+// Size returns the bytes in one sample
+func (f SampleFormat) Size() int {
+	if f == FormatF32 {
+		return 4
+	}
+	return 2
+}
+
+// ffmpegArgs returns the FFmpeg muxer and codec that decode to the format
+func (f SampleFormat) ffmpegArgs() (muxer, codec string) {
+	if f == FormatF32 {
+		return "f32le", "pcm_f32le"
+	}
+	return "s16le", "pcm_s16le"
+}
+
+func (f SampleFormat) otoFormat() int {
+	if f == FormatF32 {
+		return oto.FormatFloat32LE
+	}
+	return oto.FormatSignedInt16LE
+}
+
+// sample reads the sample at the start of data, scaled to -1..1
+func (f SampleFormat) sample(data []byte) float64 {
+	if f == FormatF32 {
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+	}
+	return float64(int16(binary.LittleEndian.Uint16(data))) / 32768
+}
+
+// putSample writes a sample scaled to -1..1 at the start of data, clipping
+// it to full scale
+func (f SampleFormat) putSample(data []byte, v float64) {
+	if f == FormatF32 {
+		binary.LittleEndian.PutUint32(data, math.Float32bits(float32(math.Max(-1, math.Min(v, 1)))))
+		return
+	}
+	binary.LittleEndian.PutUint16(data, uint16(clampSample(v*32768)))
+}
+
+// toS16 returns data converted to 16-bit samples, or data itself if it
+// already is
+func (f SampleFormat) toS16(data []byte) []byte {
+	if f == FormatS16 {
+		return data
+	}
+	out := make([]byte, len(data)/f.Size()*2)
+	for i := 0; i < len(out); i += 2 {
+		FormatS16.putSample(out[i:], f.sample(data[i/2*f.Size():]))
+	}
+	return out
+}
+
+// OutputFormat is the format the output device was opened with
+type OutputFormat struct {
+	SampleRate int
+	Channels   int
+	BitDepth   int
+	Resampler  string
+}
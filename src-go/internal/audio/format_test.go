@@ -0,0 +1,79 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func f32pcm(samples ...float32) []byte {
+	data := make([]byte, 4*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(s))
+	}
+	return data
+}
+
+func TestFormatForBitDepth(t *testing.T) {
+	if FormatForBitDepth(16) != FormatS16 || FormatForBitDepth(24) != FormatF32 {
+		t.Error("Expected 16-bit to use s16 and 24-bit to use f32")
+	}
+	if FormatF32.BitDepth() != 24 || FormatF32.Size() != 4 {
+		t.Errorf("Expected f32 to carry 24 bits in 4 bytes, got %d in %d", FormatF32.BitDepth(), FormatF32.Size())
+	}
+}
+
+func TestSampleFormatClips(t *testing.T) {
+	data := make([]byte, 4)
+	FormatF32.putSample(data, 1.5)
+	if got := FormatF32.sample(data); got != 1 {
+		t.Errorf("Expected f32 to clip to 1, got %v", got)
+	}
+	FormatS16.putSample(data, -1.5)
+	if got := samplesOf(data[:2])[0]; got != -32768 {
+		t.Errorf("Expected s16 to clip to -32768, got %d", got)
+	}
+}
+
+func TestToS16(t *testing.T) {
+	got := samplesOf(FormatF32.toS16(f32pcm(0.5, -0.25, 0)))
+	want := []int16{16384, -8192, 0}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, got)
+		}
+	}
+
+	data := pcm(1, 2)
+	if out := FormatS16.toS16(data); &out[0] != &data[0] {
+		t.Error("Expected s16 data to be passed through")
+	}
+}
+
+func TestApplyVolumeFloat(t *testing.T) {
+	o := &OtoOutput{volume: 0.5, format: FormatF32}
+	data := f32pcm(0.8, -0.5)
+	o.applyVolume(data)
+	if got := FormatF32.sample(data); math.Abs(got-0.4) > 1e-6 {
+		t.Errorf("Expected 0.4, got %v", got)
+	}
+	if got := FormatF32.sample(data[4:]); got != -0.25 {
+		t.Errorf("Expected -0.25, got %v", got)
+	}
+}
+
+func TestSetResampler(t *testing.T) {
+	d := &FFmpegDecoder{}
+	if err := d.SetResampler("soxr"); err != nil {
+		t.Fatalf("Expected soxr to be accepted: %v", err)
+	}
+	if d.Resampler() != "soxr" {
+		t.Errorf("Expected soxr, got %q", d.Resampler())
+	}
+	if err := d.SetResampler("cubic"); err == nil {
+		t.Error("Expected an unknown resampler to be rejected")
+	}
+	if d.Resampler() != "soxr" {
+		t.Errorf("Expected a rejected resampler to leave soxr in place, got %q", d.Resampler())
+	}
+}
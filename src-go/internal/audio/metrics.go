@@ -0,0 +1,12 @@
+package audio
+
+import "github.com/austinkregel/local-media/musicd/internal/metrics"
+
+var (
+	decodeErrors = metrics.NewCounter("musicd_decode_errors_total",
+		"Tracks whose decoding failed during playback")
+	decoderRestarts = metrics.NewCounter("musicd_decoder_restarts_total",
+		"Times the decoder was restarted after stalling or failing part way through a track")
+	bufferUnderruns = metrics.NewCounter("musicd_buffer_underruns_total",
+		"Times the output buffer ran dry while a track was still being decoded")
+)
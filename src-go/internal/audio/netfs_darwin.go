@@ -0,0 +1,18 @@
+//go:build darwin
+
+package audio
+
+import "golang.org/x/sys/unix"
+
+// IsNetworkPath reports whether path is on a network filesystem
+func IsNetworkPath(path string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false
+	}
+	switch unix.ByteSliceToString(st.Fstypename[:]) {
+	case "smbfs", "nfs", "afpfs", "webdav":
+		return true
+	}
+	return false
+}
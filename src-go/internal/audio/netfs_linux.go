@@ -0,0 +1,19 @@
+//go:build linux
+
+package audio
+
+import "golang.org/x/sys/unix"
+
+// IsNetworkPath reports whether path is on a network filesystem
+func IsNetworkPath(path string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false
+	}
+	switch uint32(st.Type) {
+	case unix.NFS_SUPER_MAGIC, unix.SMB_SUPER_MAGIC, unix.SMB2_SUPER_MAGIC, unix.CIFS_SUPER_MAGIC,
+		unix.AFS_SUPER_MAGIC, unix.CEPH_SUPER_MAGIC, unix.V9FS_MAGIC:
+		return true
+	}
+	return false
+}
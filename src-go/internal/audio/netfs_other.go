@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package audio
+
+// IsNetworkPath reports whether path is on a network filesystem. Detection
+// isn't supported on this platform.
+func IsNetworkPath(path string) bool {
+	return false
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package audio
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// IsNetworkPath reports whether path is on a network share, either as a UNC
+// path or on a mapped drive
+func IsNetworkPath(path string) bool {
+	volume := filepath.VolumeName(path)
+	if volume == "" {
+		return false
+	}
+	root, err := windows.UTF16PtrFromString(volume + `\`)
+	if err != nil {
+		return false
+	}
+	return windows.GetDriveType(root) == windows.DRIVE_REMOTE
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// sinkInput is a playback stream as pactl lists it
+type sinkInput struct {
+	Corked     bool              `json:"corked"`
+	Properties map[string]string `json:"properties"`
+}
+
+// OtherAudioPlaying reports whether another application is playing audio,
+// going by the streams PulseAudio, or PipeWire in its place, is playing
+func OtherAudioPlaying() (bool, error) {
+	out, err := exec.Command("pactl", "-f", "json", "list", "sink-inputs").Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to list audio streams: %w", err)
+	}
+	var inputs []sinkInput
+	if err := json.Unmarshal(out, &inputs); err != nil {
+		return false, fmt.Errorf("failed to parse audio streams: %w", err)
+	}
+	return othersPlaying(inputs, os.Getpid(), parentPID), nil
+}
+
+// othersPlaying reports whether any uncorked stream belongs to a process
+// other than self or one self started, such as a zone's command
+func othersPlaying(inputs []sinkInput, self int, parent func(pid int) int) bool {
+	for _, input := range inputs {
+		if input.Corked {
+			continue
+		}
+		pid, err := strconv.Atoi(input.Properties["application.process.id"])
+		if err == nil && (pid == self || parent(pid) == self) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// parentPID returns the parent of process pid, or 0 if it can't be read
+func parentPID(pid int) int {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0
+	}
+	// The command name in brackets may itself contain spaces
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	if len(fields) < 2 {
+		return 0
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	return ppid
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+package audio
+
+import "testing"
+
+func TestOthersPlaying(t *testing.T) {
+	parents := map[int]int{200: 100}
+	parent := func(pid int) int { return parents[pid] }
+	stream := func(pid string, corked bool) sinkInput {
+		return sinkInput{Corked: corked, Properties: map[string]string{"application.process.id": pid}}
+	}
+
+	tests := []struct {
+		name   string
+		inputs []sinkInput
+		want   bool
+	}{
+		{"nothing playing", nil, false},
+		{"only ourselves", []sinkInput{stream("100", false)}, false},
+		{"our zone command", []sinkInput{stream("200", false)}, false},
+		{"another application", []sinkInput{stream("100", false), stream("300", false)}, true},
+		{"another application paused", []sinkInput{stream("300", true)}, false},
+		{"unknown process", []sinkInput{{Properties: map[string]string{}}}, true},
+	}
+	for _, tt := range tests {
+		if got := othersPlaying(tt.inputs, 100, parent); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestOutputDevices(t *testing.T) {
+	sinks := []sink{
+		{
+			Name:        "alsa_output.pci.analog-stereo",
+			Description: "Built-in Audio",
+			ActivePort:  "analog-output-speaker",
+			Ports: []sinkPort{
+				{Name: "analog-output-speaker", Description: "Speakers", Availability: "availability unknown"},
+				{Name: "analog-output-headphones", Description: "Headphones", Availability: "not available"},
+			},
+		},
+		{Name: "bluez_output.00_11_22", Description: "Earbuds"},
+	}
+
+	current, present := outputDevices(sinks, "alsa_output.pci.analog-stereo")
+	if current.Port != "analog-output-speaker" || current.Description != "Built-in Audio (Speakers)" {
+		t.Errorf("Expected the speakers to be current, got %+v", current)
+	}
+	if len(present) != 2 {
+		t.Fatalf("Expected the unplugged headphones left out, got %+v", present)
+	}
+	earbuds := OutputDevice{Sink: "bluez_output.00_11_22"}
+	if !present[1].Same(earbuds) {
+		t.Errorf("Expected the earbuds present, got %+v", present[1])
+	}
+
+	if current, _ := outputDevices(sinks, "bluez_output.00_11_22"); !current.Same(earbuds) {
+		t.Errorf("Expected the earbuds to be current, got %+v", current)
+	}
+}
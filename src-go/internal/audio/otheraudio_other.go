@@ -0,0 +1,11 @@
+//go:build !linux
+
+package audio
+
+import "errors"
+
+// OtherAudioPlaying reports whether another application is playing audio.
+// This platform doesn't report it.
+func OtherAudioPlaying() (bool, error) {
+	return false, errors.New("detecting other audio isn't supported on this platform")
+}
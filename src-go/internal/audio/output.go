@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"sync"
 	"time"
 
@@ -13,38 +14,76 @@ import (
 const (
 	defaultSampleRate = 44100
 	defaultChannels   = 2
-	defaultBitDepth   = 2 // 16-bit = 2 bytes
+	defaultBitDepth   = 16
 	
-	// Maximum buffer size to prevent visualization getting ahead of audio
-	// 100ms at 44100Hz stereo 16-bit = 17640 bytes
+	// Maximum audio buffered to prevent visualization getting ahead of audio
 	// This keeps visualization in sync with what the user hears
-	maxBufferSize = 17640
+	maxBufferTime = 100 * time.Millisecond
+
+	// DefaultFade is the ramp applied on pause/stop and resume/play
+	DefaultFade = 150 * time.Millisecond
+
+	// duckRamp is how long the output takes to duck or come back up
+	duckRamp = 300 * time.Millisecond
+)
+
+// Volume curves, how the playback volume maps onto the scale applied to
+// the samples
+const (
+	CurveLinear      = "linear"
+	CurveLogarithmic = "logarithmic"
+
+	// logCurveRangeDb is how far below full volume the logarithmic curve
+	// reaches just above zero
+	logCurveRangeDb = 60
 )
 
+// curveGain returns the factor samples are scaled by at volume on curve
+func curveGain(volume float64, curve string) float64 {
+	if curve != CurveLogarithmic || volume <= 0 || volume >= 1 {
+		return volume
+	}
+	return math.Pow(10, (volume-1)*logCurveRangeDb/20)
+}
+
 // OtoOutput is an audio output using the Oto library
 type OtoOutput struct {
 	context    *oto.Context
 	player     oto.Player // oto.Player is an interface, not a pointer
 	sampleRate int
 	channels   int
+	format     SampleFormat
+	maxBuffer  int // Bytes of maxBufferTime
 	mu         sync.Mutex
 	cond       *sync.Cond // Condition variable for pause/resume synchronization
 	buffer     *bytes.Buffer
 	volume     float64 // 0.0 - 1.0
+	curve      string  // Volume curve, "" for linear
+	trackGain  float64 // Per-track gain in dB, 0 for none
+	trackScale float64 // trackGain as a linear factor
+	fadeFrames int     // Length of the fade ramp in frames, 0 to disable
+	fade       float64 // Current fade factor, moves towards fadeTarget
+	fadeTarget float64
+	duck       float64 // How far the volume is ducked, 0 for not at all; moves towards duckTarget
+	duckTarget float64
 	paused     bool    // True when explicitly paused - prevents auto-resume on Write
 	closed     bool    // True when output is closed - unblocks waiting goroutines
+	streaming  bool    // True while a decoder is still writing the current track
+	starved    bool    // True once an underrun has been counted for the current gap
 	analyzer   *AudioAnalyzer // Real-time FFT analyzer for visualization
+	zones      *zoneSet       // Other outputs fed a copy of what the device reads
+	channelMix ChannelMix     // Mono, balance and swap for the device only
 }
 
 // NewOtoOutput creates a new Oto-based audio output
 func NewOtoOutput() (*OtoOutput, error) {
-	return NewOtoOutputWithConfig(defaultSampleRate, defaultChannels)
+	return NewOtoOutputWithConfig(defaultSampleRate, defaultChannels, FormatS16)
 }
 
 // NewOtoOutputWithConfig creates a new Oto-based audio output with custom config
-func NewOtoOutputWithConfig(sampleRate, channels int) (*OtoOutput, error) {
+func NewOtoOutputWithConfig(sampleRate, channels int, format SampleFormat) (*OtoOutput, error) {
 	// Create Oto context
-	ctx, ready, err := oto.NewContext(sampleRate, channels, defaultBitDepth)
+	ctx, ready, err := oto.NewContext(sampleRate, channels, format.otoFormat())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create oto context: %w", err)
 	}
@@ -59,11 +98,18 @@ func NewOtoOutputWithConfig(sampleRate, channels int) (*OtoOutput, error) {
 		context:    ctx,
 		sampleRate: sampleRate,
 		channels:   channels,
+		format:     format,
+		maxBuffer:  int(maxBufferTime.Seconds()*float64(sampleRate)) * channels * format.Size(),
 		buffer:     buffer,
 		volume:     1.0,
-		analyzer:   NewAudioAnalyzer(sampleRate, channels),
+		trackScale: 1.0,
+		fade:       1.0,
+		fadeTarget: 1.0,
+		analyzer:   NewAudioAnalyzer(sampleRate, channels, format),
+		zones:      newZoneSet(sampleRate, channels, format),
 	}
 	output.cond = sync.NewCond(&output.mu)
+	output.SetFade(DefaultFade)
 
 	// Create player with the buffer as source
 	output.player = ctx.NewPlayer(output)
@@ -88,9 +134,21 @@ func (o *OtoOutput) Read(p []byte) (n int, err error) {
 
 	// If buffer is empty but not paused, return silence to keep stream alive
 	if o.buffer.Len() == 0 {
+		// Nothing audible is left to fade out
+		if o.fadeTarget < o.fade {
+			o.fade = o.fadeTarget
+		}
+		if o.streaming && !o.starved {
+			o.starved = true
+			bufferUnderruns.Inc()
+		}
 		for i := range p {
 			p[i] = 0
 		}
+		// Other zones get the silence too so they stay in step with the device
+		if o.zones != nil {
+			o.zones.tee(p)
+		}
 		return len(p), nil
 	}
 
@@ -104,32 +162,164 @@ func (o *OtoOutput) Read(p []byte) (n int, err error) {
 		o.analyzer.ProcessSamples(p[:n])
 	}
 
-	// Apply volume scaling to 16-bit PCM samples
-	if o.volume < 1.0 && n > 0 {
+	// Apply volume, track gain and fade to the PCM samples
+	if n > 0 && o.needsScalingLocked() {
 		o.applyVolume(p[:n])
 	}
 
+	// Copy to the other zones, then apply the local zone's own volume
+	if n > 0 && o.zones != nil {
+		o.zones.tee(p[:n])
+	}
+
+	// Other zones are in other rooms, so only the device gets the channel mix
+	if n > 0 && o.channels == 2 && !o.channelMix.identity() {
+		o.channelMix.apply(p[:n], o.format)
+	}
+
 	return n, nil
 }
 
-// applyVolume scales 16-bit PCM samples by the current volume
+// gainLocked returns the combined volume and track gain factor
+func (o *OtoOutput) gainLocked() float64 {
+	volume := curveGain(o.volume, o.curve)
+	if o.trackGain != 0 {
+		return volume * o.trackScale
+	}
+	return volume
+}
+
+// needsScalingLocked reports whether samples must be modified on their way out
+func (o *OtoOutput) needsScalingLocked() bool {
+	if o.fadeFrames > 0 && (o.fade != 1 || o.fadeTarget != 1) {
+		return true
+	}
+	if o.duck != 0 || o.duckTarget != 0 {
+		return true
+	}
+	return o.gainLocked() != 1
+}
+
+// applyVolume scales PCM samples by the current volume, track gain and
+// duck, advancing the fade and duck ramps once per frame
 func (o *OtoOutput) applyVolume(data []byte) {
-	vol := o.volume
-	if vol >= 1.0 {
+	if !o.needsScalingLocked() {
 		return
 	}
+	gain := o.gainLocked()
+	fading := o.fadeFrames > 0 && o.fade != o.fadeTarget
+	ducking := o.duck != o.duckTarget
+
+	channels := o.channels
+	if channels < 1 {
+		channels = 1
+	}
+	step := 0.0
+	if o.fadeFrames > 0 {
+		step = 1 / float64(o.fadeFrames)
+	}
+	duckStep := 1.0
+	if o.sampleRate > 0 {
+		duckStep = 1 / (duckRamp.Seconds() * float64(o.sampleRate))
+	}
+	factor := gain * (1 - o.duck)
+	if o.fadeFrames > 0 {
+		factor *= o.fade
+	}
+
+	size := o.format.Size()
+	for i, ch := 0, 0; i+size <= len(data); i += size {
+		// Scale, clipping if the track gain pushes it out of range
+		o.format.putSample(data[i:], o.format.sample(data[i:])*factor)
+
+		// Step the fade and duck after each full frame
+		if ch++; ch == channels {
+			ch = 0
+			if fading || ducking {
+				if fading {
+					o.fade = approach(o.fade, o.fadeTarget, step)
+					fading = o.fade != o.fadeTarget
+				}
+				if ducking {
+					o.duck = approach(o.duck, o.duckTarget, duckStep)
+					ducking = o.duck != o.duckTarget
+				}
+				factor = gain * (1 - o.duck)
+				if o.fadeFrames > 0 {
+					factor *= o.fade
+				}
+			}
+		}
+	}
+}
+
+// approach moves v towards target by at most step
+func approach(v, target, step float64) float64 {
+	if v < target {
+		return math.Min(v+step, target)
+	}
+	return math.Max(v-step, target)
+}
+
+// SetFade sets the length of the fade applied on pause/stop and resume/play.
+// Zero disables fading.
+func (o *OtoOutput) SetFade(d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if d < 0 {
+		d = 0
+	}
+	o.fadeFrames = int(d.Seconds() * float64(o.sampleRate))
+	if o.fadeFrames == 0 {
+		o.fade, o.fadeTarget = 1, 1
+	}
+}
 
-	// Process 16-bit samples (2 bytes per sample, little-endian)
-	for i := 0; i < len(data)-1; i += 2 {
-		// Read 16-bit little-endian sample
-		sample := int16(data[i]) | int16(data[i+1])<<8
+// SetTrackGain sets the gain offset in dB for the current track
+func (o *OtoOutput) SetTrackGain(db float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 
-		// Scale by volume
-		scaled := int16(float64(sample) * vol)
+	o.trackGain = db
+	o.trackScale = math.Pow(10, db/20)
+}
 
-		// Write back
-		data[i] = byte(scaled)
-		data[i+1] = byte(scaled >> 8)
+// SetDuck lowers the output to level (0.0 - 1.0) of its volume, ramping
+// there over duckRamp. A level of 1 brings it back up.
+func (o *OtoOutput) SetDuck(level float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.duckTarget = 1 - math.Max(0, math.Min(level, 1))
+	if o.player == nil || !o.player.IsPlaying() || o.paused {
+		// Nothing is being read to ramp on
+		o.duck = o.duckTarget
+	}
+}
+
+// SetChannelMix sets the mono, balance and swap options for the device
+func (o *OtoOutput) SetChannelMix(m ChannelMix) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.channelMix = m
+}
+
+// fadeOutLocked ramps the output to silence before it is paused or cleared,
+// then arms a fade-in for the next audio (must be called with lock held)
+func (o *OtoOutput) fadeOutLocked() {
+	if o.fadeFrames > 0 && !o.paused && o.player != nil && o.player.IsPlaying() && o.buffer.Len() > 0 {
+		o.fadeTarget = 0
+		fadeTime := time.Duration(o.fadeFrames) * time.Second / time.Duration(o.sampleRate)
+		deadline := time.Now().Add(fadeTime + 100*time.Millisecond)
+		for o.fade > 0 && !o.closed && time.Now().Before(deadline) {
+			o.mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			o.mu.Lock()
+		}
+	}
+	if o.fadeFrames > 0 {
+		o.fade, o.fadeTarget = 0, 1
 	}
 }
 
@@ -147,6 +337,14 @@ func (o *OtoOutput) SetVolume(v float64) {
 	o.volume = v
 }
 
+// SetVolumeCurve sets how the volume maps onto loudness, CurveLinear or
+// CurveLogarithmic
+func (o *OtoOutput) SetVolumeCurve(curve string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.curve = curve
+}
+
 // GetVolume returns the current volume
 func (o *OtoOutput) GetVolume() float64 {
 	o.mu.Lock()
@@ -155,12 +353,12 @@ func (o *OtoOutput) GetVolume() float64 {
 }
 
 // Write writes PCM audio data to the output buffer
-// Blocks if buffer exceeds maxBufferSize to keep visualization in sync with audio
+// Blocks if buffer exceeds maxBufferTime to keep visualization in sync with audio
 func (o *OtoOutput) Write(data []byte) (int, error) {
 	// Wait until buffer has room - this throttles decoding to match playback
 	for {
 		o.mu.Lock()
-		if o.buffer.Len() < maxBufferSize {
+		if o.buffer.Len() < o.maxBuffer {
 			break
 		}
 		o.mu.Unlock()
@@ -173,6 +371,8 @@ func (o *OtoOutput) Write(data []byte) (int, error) {
 	if err != nil {
 		return n, err
 	}
+	o.streaming = true
+	o.starved = false
 
 	// Only auto-start player if not explicitly paused
 	if o.player != nil && !o.player.IsPlaying() && !o.paused {
@@ -187,6 +387,7 @@ func (o *OtoOutput) Pause() {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
+	o.fadeOutLocked()
 	o.paused = true // Set flag BEFORE pausing to prevent race with Write
 	if o.player != nil && o.player.IsPlaying() {
 		o.player.Pause()
@@ -210,12 +411,23 @@ func (o *OtoOutput) Stop() {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
+	o.fadeOutLocked()
 	o.paused = false // Reset paused flag so new playback can start
 	if o.player != nil {
 		o.player.Pause()
 	}
 	// Clear the buffer so old audio doesn't play when we start again
 	o.buffer.Reset()
+	o.streaming = false
+}
+
+// EndStream marks the current track as fully written so draining the buffer
+// is not counted as an underrun
+func (o *OtoOutput) EndStream() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.streaming = false
 }
 
 // IsPlaying returns whether audio is currently playing
@@ -233,6 +445,9 @@ func (o *OtoOutput) Close() error {
 
 	o.closed = true
 	o.cond.Broadcast() // Wake up any blocked Read() goroutines so they can exit
+	if o.zones != nil {
+		o.zones.close()
+	}
 
 	if o.player != nil {
 		if err := o.player.Close(); err != nil {
@@ -252,6 +467,11 @@ func (o *OtoOutput) Channels() int {
 	return o.channels
 }
 
+// Format returns the sample format the device takes
+func (o *OtoOutput) Format() SampleFormat {
+	return o.format
+}
+
 // GetAudioBands returns the current frequency bands for visualization
 func (o *OtoOutput) GetAudioBands() []uint8 {
 	if o.analyzer != nil {
@@ -275,5 +495,37 @@ func (o *OtoOutput) SetAudioCallback(cb AudioDataCallback) {
 	}
 }
 
+// ConfigureZones replaces the additional output zones
+func (o *OtoOutput) ConfigureZones(zones []ZoneConfig) {
+	if o.zones != nil {
+		o.zones.configure(zones)
+	}
+}
+
+// Zones returns the state of every output zone, the local device first
+func (o *OtoOutput) Zones() []ZoneInfo {
+	if o.zones != nil {
+		return o.zones.list()
+	}
+	return nil
+}
+
+// EnableZone turns an output zone on or off
+func (o *OtoOutput) EnableZone(name string, enabled bool) error {
+	if o.zones == nil {
+		return ErrUnknownZone
+	}
+	return o.zones.enable(name, enabled)
+}
+
+// SetZoneVolume sets an output zone's volume (0.0 - 1.0), applied on top of
+// the playback volume
+func (o *OtoOutput) SetZoneVolume(name string, v float64) error {
+	if o.zones == nil {
+		return ErrUnknownZone
+	}
+	return o.zones.setVolume(name, v)
+}
+
 // Ensure OtoOutput implements io.Reader
 var _ io.Reader = (*OtoOutput)(nil)
@@ -1,7 +1,9 @@
 package audio
 
 import (
+	"math"
 	"testing"
+	"time"
 )
 
 func TestApplyVolume(t *testing.T) {
@@ -96,3 +98,66 @@ func TestGetVolume(t *testing.T) {
 		t.Errorf("Expected volume 0.5, got %f", o.GetVolume())
 	}
 }
+
+func TestApplyVolumeTrackGainClips(t *testing.T) {
+	o := &OtoOutput{volume: 1.0, channels: 1}
+	o.SetTrackGain(6) // roughly doubles the amplitude
+
+	data := []byte{0x00, 0x10, 0x00, 0x70} // 4096, 28672
+	o.applyVolume(data)
+
+	first := int16(data[0]) | int16(data[1])<<8
+	second := int16(data[2]) | int16(data[3])<<8
+	if first < 8000 || first > 8300 {
+		t.Errorf("Expected +6dB to double 4096, got %d", first)
+	}
+	if second != 32767 {
+		t.Errorf("Expected loud sample to clip at 32767, got %d", second)
+	}
+}
+
+func TestApplyVolumeFadeIn(t *testing.T) {
+	o := &OtoOutput{volume: 1.0, channels: 2, sampleRate: 1000}
+	o.SetFade(4 * time.Millisecond) // 4 frames
+	o.fade, o.fadeTarget = 0, 1
+
+	// 6 stereo frames of a constant 1000
+	data := make([]byte, 6*2*2)
+	for i := 0; i < len(data); i += 2 {
+		data[i], data[i+1] = 0xE8, 0x03
+	}
+	o.applyVolume(data)
+
+	want := []int16{0, 250, 500, 750, 1000, 1000}
+	for frame, w := range want {
+		for ch := 0; ch < 2; ch++ {
+			i := (frame*2 + ch) * 2
+			got := int16(data[i]) | int16(data[i+1])<<8
+			if got != w {
+				t.Errorf("Frame %d channel %d: expected %d, got %d", frame, ch, w, got)
+			}
+		}
+	}
+	if o.fade != 1 {
+		t.Errorf("Expected fade to finish, got %f", o.fade)
+	}
+}
+
+func TestCurveGain(t *testing.T) {
+	if got := curveGain(0.5, CurveLinear); got != 0.5 {
+		t.Errorf("Expected the linear curve to pass the volume through, got %f", got)
+	}
+	if got := curveGain(0.5, ""); got != 0.5 {
+		t.Errorf("Expected no curve to be linear, got %f", got)
+	}
+
+	// Half volume on the logarithmic curve is 30 dB down
+	if got := curveGain(0.5, CurveLogarithmic); math.Abs(got-0.0316) > 0.001 {
+		t.Errorf("Expected half volume at -30 dB, got %f", got)
+	}
+	for _, v := range []float64{0, 1} {
+		if got := curveGain(v, CurveLogarithmic); got != v {
+			t.Errorf("Expected %v to stay %v on the logarithmic curve, got %f", v, v, got)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package audio
+
+// OutputDevice is where the system sends audio: an output, and the port on
+// it such as headphones or speakers
+type OutputDevice struct {
+	Sink        string
+	Port        string // "" for outputs without ports
+	Description string // For people, e.g. "Built-in Audio (Headphones)"
+}
+
+// Same reports whether d and other are the same device
+func (d OutputDevice) Same(other OutputDevice) bool {
+	return d.Sink == other.Sink && d.Port == other.Port
+}
+
+// IsZero reports whether d is no device
+func (d OutputDevice) IsZero() bool {
+	return d.Sink == ""
+}
@@ -0,0 +1,111 @@
+//go:build linux
+
+package audio
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// sink is an output as pactl lists it
+type sink struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	ActivePort  string     `json:"active_port"`
+	Ports       []sinkPort `json:"ports"`
+}
+
+// sinkPort is a connector of a sink, such as headphones or speakers
+type sinkPort struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Availability string `json:"availability"`
+}
+
+// OutputDevices returns the device the system plays audio on and every
+// device that's plugged in, going by PulseAudio, or PipeWire in its place
+func OutputDevices() (OutputDevice, []OutputDevice, error) {
+	out, err := exec.Command("pactl", "get-default-sink").Output()
+	if err != nil {
+		return OutputDevice{}, nil, fmt.Errorf("failed to get the default output: %w", err)
+	}
+	defaultSink := strings.TrimSpace(string(out))
+
+	out, err = exec.Command("pactl", "-f", "json", "list", "sinks").Output()
+	if err != nil {
+		return OutputDevice{}, nil, fmt.Errorf("failed to list outputs: %w", err)
+	}
+	var sinks []sink
+	if err := json.Unmarshal(out, &sinks); err != nil {
+		return OutputDevice{}, nil, fmt.Errorf("failed to parse outputs: %w", err)
+	}
+	current, present := outputDevices(sinks, defaultSink)
+	return current, present, nil
+}
+
+// outputDevices picks the default sink's active port out of sinks, and
+// lists the ports that aren't reported unplugged
+func outputDevices(sinks []sink, defaultSink string) (OutputDevice, []OutputDevice) {
+	var current OutputDevice
+	var present []OutputDevice
+	for _, s := range sinks {
+		if len(s.Ports) == 0 {
+			present = append(present, OutputDevice{Sink: s.Name, Description: s.Description})
+			if s.Name == defaultSink {
+				current = present[len(present)-1]
+			}
+			continue
+		}
+		for _, port := range s.Ports {
+			if port.Availability == "not available" {
+				continue
+			}
+			device := OutputDevice{
+				Sink:        s.Name,
+				Port:        port.Name,
+				Description: s.Description + " (" + port.Description + ")",
+			}
+			present = append(present, device)
+			if s.Name == defaultSink && port.Name == s.ActivePort {
+				current = device
+			}
+		}
+	}
+	return current, present
+}
+
+// OutputDeviceEvents signals whenever outputs may have come or gone, until
+// ctx is done. The channel is closed if the audio server goes away.
+func OutputDeviceEvents(ctx context.Context) (<-chan struct{}, error) {
+	cmd := exec.CommandContext(ctx, "pactl", "subscribe")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to watch outputs: %w", err)
+	}
+
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		defer cmd.Wait()
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			// e.g. "Event 'change' on sink #52" or "... on card #47"
+			line := scanner.Text()
+			if !strings.Contains(line, " on sink #") && !strings.Contains(line, " on card #") && !strings.Contains(line, " on server") {
+				continue
+			}
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package audio
+
+import (
+	"context"
+	"errors"
+)
+
+// OutputDevices returns the device the system plays audio on and every
+// device that's plugged in. This platform doesn't report them.
+func OutputDevices() (OutputDevice, []OutputDevice, error) {
+	return OutputDevice{}, nil, errors.New("detecting output devices isn't supported on this platform")
+}
+
+// OutputDeviceEvents signals whenever outputs may have come or gone. This
+// platform doesn't report them.
+func OutputDeviceEvents(ctx context.Context) (<-chan struct{}, error) {
+	return nil, errors.New("detecting output devices isn't supported on this platform")
+}
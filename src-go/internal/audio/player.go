@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"sync"
@@ -75,17 +76,27 @@ type TrackMetadata struct {
 
 // Status represents the current playback status
 type Status struct {
-	State      PlaybackState  `json:"state"`
-	Path       string         `json:"path,omitempty"`
-	Position   int64          `json:"position"`   // milliseconds
-	Duration   int64          `json:"duration"`   // milliseconds
-	Volume     float64        `json:"volume"`     // 0.0 - 1.0
-	Metadata   *TrackMetadata `json:"metadata,omitempty"`
+	State       PlaybackState  `json:"state"`
+	Path        string         `json:"path,omitempty"`
+	Position    int64          `json:"position"` // milliseconds
+	Duration    int64          `json:"duration"` // milliseconds
+	Volume      float64        `json:"volume"`   // 0.0 - 1.0
+	Metadata    *TrackMetadata `json:"metadata,omitempty"`
+	Buffering   bool           `json:"buffering,omitempty"`   // A stream is waiting for audio
+	StreamTitle string         `json:"streamTitle,omitempty"` // Now playing on an internet radio station
 }
 
 // TrackEndCallback is called when a track finishes playing naturally
 type TrackEndCallback func(path string)
 
+// TrackEndingCallback is called once per track when it has the track ending
+// lead or less left to play
+type TrackEndingCallback func(path string, remainingMs int64)
+
+// DecodeErrorCallback is called when a local file fails to decode part way
+// through and restarting the decoder hasn't helped, before the track ends
+type DecodeErrorCallback func(path string, err error)
+
 // QueueCallback is called for next/previous track requests (from OS media controls)
 type QueueCallback func()
 
@@ -95,6 +106,39 @@ type ShuffleCallback func(enabled bool)
 // LoopCallback is called when loop/repeat mode changes from OS media controls
 type LoopCallback func(status media.LoopStatus)
 
+// PositionCallback receives the playback position of the current track
+// periodically, on pause/stop, and once more when the track ends
+type PositionCallback func(path string, positionMs, durationMs int64)
+
+// ResumeProvider returns a saved offset in milliseconds to resume a track
+// from, or 0 to start from the beginning
+type ResumeProvider func(path string) int64
+
+// GainProvider returns the gain offset in dB for a track, or 0 for none
+type GainProvider func(path string) float64
+
+// IntroProvider returns how many milliseconds at the start of a track to
+// skip, or 0 to play it from the beginning
+type IntroProvider func(path string) int64
+
+// SilenceProvider returns how long a track starts and ends in silence, or
+// zero where it doesn't or isn't known
+type SilenceProvider func(path string) (lead, trail time.Duration)
+
+// minSilenceTrim is the shortest silence worth skipping
+const minSilenceTrim = 500 * time.Millisecond
+
+// SourceResolver returns the file to read a track from, e.g. a local copy of
+// a track on a network share, or path itself
+type SourceResolver func(path string) string
+
+// PathCheck returns an error if the track or album art at path may not be
+// opened
+type PathCheck func(path string) error
+
+// positionReportInterval is how often PositionCallback fires during playback
+const positionReportInterval = 15 * time.Second
+
 // Player handles audio playback
 type Player struct {
 	mu           sync.RWMutex
@@ -103,6 +147,8 @@ type Player struct {
 	currentPath  string
 	position     int64
 	duration     int64
+	buffering    bool
+	streamTitle  string
 	volume       float64
 	metadata     *TrackMetadata
 	mediaSession media.Session
@@ -119,17 +165,62 @@ type Player struct {
 	wasManualStop bool              // True if playback was stopped manually (not track end)
 
 	// Callbacks
-	onTrackEnd TrackEndCallback
-	onNext     QueueCallback
-	onPrevious QueueCallback
-	onShuffle  ShuffleCallback
-	onLoop     LoopCallback
+	onTrackEnd    TrackEndCallback
+	onTrackEnding TrackEndingCallback
+	onDecodeError DecodeErrorCallback
+	onNext        QueueCallback
+	onPrevious    QueueCallback
+	onShuffle     ShuffleCallback
+	onLoop        LoopCallback
+	onPosition    PositionCallback
+
+	// How long before the end of a track onTrackEnding is called
+	trackEndingLead time.Duration
+
+	// Resume support for long tracks
+	resumeProvider ResumeProvider
+
+	// Intros skipped when tracks start
+	introProvider IntroProvider
+
+	// Per-track gain lookup
+	gainProvider GainProvider
+
+	// What is holding the volume down, by source
+	ducks map[string]*duckHold
+
+	// Silence skipped at either end of tracks
+	silenceProvider SilenceProvider
+
+	// The track expected next, got ready before it plays
+	nextTrack NextTrackProvider
+	preload   *preloadedTrack
+
+	// Local copies of tracks and buffering for network mounts
+	sourceResolver SourceResolver
+	netPreBuffer   time.Duration
+	netReadAhead   time.Duration
+
+	// Where tracks and album art may be opened from; nil for anywhere
+	pathCheck PathCheck
 
 	// Audio output
 	output Output
 
+	// Effects applied between the decoder and the output
+	dsp *dspChain
+
 	// Decoder
 	decoder Decoder
+
+	// What playback is timed by, nil for the system clock
+	clock Clock
+
+	// Remote device playing in place of the local output, nil for local
+	renderer   Renderer
+	remoteWake chan struct{}
+	// Second channel for pre-listening, nil without a local device
+	preview *Preview
 }
 
 // Output is the interface for audio output backends
@@ -137,6 +228,7 @@ type Output interface {
 	io.WriteCloser
 	SampleRate() int
 	Channels() int
+	Format() SampleFormat
 }
 
 // Decoder is the interface for audio decoders
@@ -146,31 +238,75 @@ type Decoder interface {
 	Close() error
 }
 
+// RangeDecoder is a Decoder that can decode part of a track, which seeking
+// needs. lengthMs of 0 decodes the rest of the track.
+type RangeDecoder interface {
+	Decoder
+	DecodeRange(ctx context.Context, path string, output Output, startMs, lengthMs int64) error
+}
+
+// OutputConfig is the format the output device is opened with. Zero fields
+// take the defaults of 44.1kHz, 16-bit and the standard resampler.
+type OutputConfig struct {
+	SampleRate int
+	BitDepth   int    // 16, or 24 for 32-bit float output
+	Resampler  string // "fast", "standard", "high" or "soxr"
+}
+
 // NewPlayer creates a new audio player
 func NewPlayer(mediaSession media.Session) (*Player, error) {
-	output, err := NewOtoOutput()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create audio output: %w", err)
+	return NewPlayerWithConfig(mediaSession, OutputConfig{})
+}
+
+// NewPlayerWithConfig creates a new audio player with the output opened in
+// the given format
+func NewPlayerWithConfig(mediaSession media.Session, cfg OutputConfig) (*Player, error) {
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = defaultSampleRate
+	}
+	if cfg.BitDepth == 0 {
+		cfg.BitDepth = defaultBitDepth
+	}
+	if cfg.Resampler == "" {
+		cfg.Resampler = DefaultResampler
 	}
 
 	decoder, err := NewFFmpegDecoder()
 	if err != nil {
-		output.Close()
 		return nil, fmt.Errorf("failed to create decoder: %w", err)
 	}
+	if err := decoder.SetResampler(cfg.Resampler); err != nil {
+		return nil, err
+	}
+
+	output, err := NewOtoOutputWithConfig(cfg.SampleRate, defaultChannels, FormatForBitDepth(cfg.BitDepth))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audio output: %w", err)
+	}
 
 	return &Player{
 		state:        StateStopped,
 		volume:       1.0,
 		mediaSession: mediaSession,
 		output:       output,
+		dsp:          newDSPChain(output.SampleRate(), output.Channels(), output.Format()),
 		decoder:      decoder,
 		stopChan:     make(chan struct{}),
 		pauseChan:    make(chan struct{}),
 		resumeChan:   make(chan struct{}),
+		remoteWake:   make(chan struct{}, 1),
+		preview:      newPreview(output, decoder),
 	}, nil
 }
 
+// timeSource returns the clock playback is timed by
+func (p *Player) timeSource() Clock {
+	if p.clock == nil {
+		return SystemClock{}
+	}
+	return p.clock
+}
+
 // SetOnTrackEnd sets a callback to be called when a track finishes playing naturally
 func (p *Player) SetOnTrackEnd(callback TrackEndCallback) {
 	p.mu.Lock()
@@ -178,6 +314,40 @@ func (p *Player) SetOnTrackEnd(callback TrackEndCallback) {
 	p.onTrackEnd = callback
 }
 
+// SetOnTrackEnding sets a callback to be called when a track nears its end
+func (p *Player) SetOnTrackEnding(callback TrackEndingCallback) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onTrackEnding = callback
+}
+
+// SetTrackEndingLead sets how long before the end of a track the track
+// ending callback is called, 0 to disable it
+func (p *Player) SetTrackEndingLead(lead time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trackEndingLead = lead
+}
+
+// trackEndingLocked calls the track ending callback if path is within the
+// lead of its end, and reports whether it did (must be called with lock held)
+func (p *Player) trackEndingLocked(path string) bool {
+	remaining := p.duration - p.position
+	if p.onTrackEnding == nil || p.trackEndingLead <= 0 || p.duration <= 0 ||
+		remaining > p.trackEndingLead.Milliseconds() {
+		return false
+	}
+	go p.onTrackEnding(path, remaining)
+	return true
+}
+
+// SetOnDecodeError sets a callback to be called when a file fails to decode
+func (p *Player) SetOnDecodeError(callback DecodeErrorCallback) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onDecodeError = callback
+}
+
 // SetOnNext sets a callback for next track requests (from OS media controls)
 func (p *Player) SetOnNext(callback QueueCallback) {
 	p.mu.Lock()
@@ -206,8 +376,242 @@ func (p *Player) SetOnLoop(callback LoopCallback) {
 	p.onLoop = callback
 }
 
-// Play starts playback of the specified file
+// SetOnPosition sets a callback that receives playback position updates
+func (p *Player) SetOnPosition(callback PositionCallback) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onPosition = callback
+}
+
+// SetResumeProvider sets the lookup used by Play to resume tracks from a saved offset
+func (p *Player) SetResumeProvider(provider ResumeProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resumeProvider = provider
+}
+
+// SetIntroProvider sets the lookup used by Play to skip the start of tracks
+func (p *Player) SetIntroProvider(provider IntroProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.introProvider = provider
+}
+
+// SetGainProvider sets the lookup used to apply a per-track gain offset
+func (p *Player) SetGainProvider(provider GainProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gainProvider = provider
+}
+
+// SetSilenceProvider sets the lookup used to skip silence at the start and
+// end of tracks
+func (p *Player) SetSilenceProvider(provider SilenceProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.silenceProvider = provider
+}
+
+// trackSilence returns the silence to skip at either end of path
+func (p *Player) trackSilence(path string) (lead, trail time.Duration) {
+	p.mu.RLock()
+	provider := p.silenceProvider
+	p.mu.RUnlock()
+	if provider == nil || IsStreamURL(path) {
+		return 0, 0
+	}
+	lead, trail = provider(path)
+	if lead < minSilenceTrim {
+		lead = 0
+	}
+	if trail < minSilenceTrim {
+		trail = 0
+	}
+	return lead, trail
+}
+
+// SetSourceResolver sets the lookup used to read tracks from a local copy
+func (p *Player) SetSourceResolver(resolver SourceResolver) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sourceResolver = resolver
+}
+
+// SetPathCheck sets the check every track, preview and piece of album art
+// is put to before it's opened
+func (p *Player) SetPathCheck(check PathCheck) {
+	p.mu.Lock()
+	p.pathCheck = check
+	p.mu.Unlock()
+	if p.preview != nil {
+		p.preview.setPathCheck(check)
+	}
+}
+
+// checkOpen returns an error if the path check turns the track at path
+// away. Art it turns away is dropped from the metadata returned, rather
+// than failing the track.
+func (p *Player) checkOpen(path string, metadata *TrackMetadata) (*TrackMetadata, error) {
+	p.mu.RLock()
+	check := p.pathCheck
+	p.mu.RUnlock()
+	if check == nil {
+		return metadata, nil
+	}
+	if err := check(path); err != nil {
+		return nil, err
+	}
+	if metadata != nil && metadata.ArtPath != "" {
+		if err := check(metadata.ArtPath); err != nil {
+			log.Printf("[PLAYER] Ignoring album art: %v", err)
+			withoutArt := *metadata
+			withoutArt.ArtPath = ""
+			metadata = &withoutArt
+		}
+	}
+	return metadata, nil
+}
+
+// SetNetworkBuffering sets how much decoded audio is buffered before and
+// during playback of tracks on network mounts. A zero readAhead disables it.
+func (p *Player) SetNetworkBuffering(preBuffer, readAhead time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.netPreBuffer = preBuffer
+	p.netReadAhead = readAhead
+}
+
+// openStream returns the file to decode for path and the output to decode
+// it into. Tracks on network mounts get a read-ahead buffer; the returned
+// channel is closed once their audio reaches the device, and is nil for
+// tracks that start playing straight away.
+func (p *Player) openStream(ctx context.Context, path string) (string, Output, <-chan struct{}) {
+	p.mu.RLock()
+	resolver := p.sourceResolver
+	preBuffer, readAhead := p.netPreBuffer, p.netReadAhead
+	p.mu.RUnlock()
+
+	file := trackFile(path)
+	source := file
+	if resolver != nil {
+		source = resolver(file)
+	}
+	if source != file {
+		log.Printf("[PLAYER] Playing cached copy: %s", source)
+	}
+
+	out := newDSPOutput(p.output, p.dsp)
+	if readAhead <= 0 || !(IsNetworkPath(source) || IsStreamURL(source)) {
+		return source, out, nil
+	}
+	log.Printf("[PLAYER] Network track, buffering %v ahead: %s", readAhead, source)
+	ra := newReadAheadOutput(ctx, out, preBuffer, readAhead)
+	return source, ra, ra.Ready()
+}
+
+// closeStream waits for a read-ahead output to hand over its audio
+func closeStream(out Output, decodeErr error) error {
+	ra, ok := out.(*readAheadOutput)
+	if !ok {
+		return decodeErr
+	}
+	if err := ra.Close(); decodeErr == nil {
+		return err
+	}
+	return decodeErr
+}
+
+// SetResampler sets how tracks are converted to the output sample rate,
+// from the next track or seek
+func (p *Player) SetResampler(name string) error {
+	if decoder, ok := p.decoder.(*FFmpegDecoder); ok {
+		return decoder.SetResampler(name)
+	}
+	return nil
+}
+
+// OutputFormat returns the format the output device was opened with
+func (p *Player) OutputFormat() OutputFormat {
+	format := OutputFormat{
+		SampleRate: p.output.SampleRate(),
+		Channels:   p.output.Channels(),
+		BitDepth:   p.output.Format().BitDepth(),
+	}
+	if decoder, ok := p.decoder.(*FFmpegDecoder); ok {
+		format.Resampler = decoder.Resampler()
+	}
+	return format
+}
+
+// SetFade sets the fade applied on pause/stop and resume/play (0 disables it)
+func (p *Player) SetFade(d time.Duration) {
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		otoOutput.SetFade(d)
+	}
+}
+
+// SetTrackGain applies a new gain offset if path is the current track
+func (p *Player) SetTrackGain(path string, db float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if path != p.currentPath {
+		return
+	}
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		otoOutput.SetTrackGain(db)
+	}
+}
+
+// RefreshTrackGain looks up the gain offset of path again if it is the
+// current track, for when what the gain provider returns has changed
+func (p *Player) RefreshTrackGain(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if path != "" && path == p.currentPath {
+		p.applyTrackGainLocked(path)
+	}
+}
+
+// applyTrackGainLocked looks up and applies the gain offset for path
+// (must be called with lock held)
+func (p *Player) applyTrackGainLocked(path string) {
+	var db float64
+	if p.gainProvider != nil {
+		db = p.gainProvider(path)
+	}
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		otoOutput.SetTrackGain(db)
+	}
+}
+
+// reportPositionLocked passes the current position to the position callback
+// (must be called with lock held)
+func (p *Player) reportPositionLocked() {
+	if p.onPosition != nil && p.currentPath != "" {
+		p.onPosition(p.currentPath, p.position, p.duration)
+	}
+}
+
+// Play starts playback of the specified file, resuming from a saved
+// offset if the resume provider has one
 func (p *Player) Play(ctx context.Context, path string, metadata *TrackMetadata) error {
+	if startMs, resumed := p.startPosition(path); startMs > 0 {
+		if resumed {
+			log.Printf("[PLAYER] Resuming from saved position %dms: %s", startMs, path)
+		} else {
+			log.Printf("[PLAYER] Skipping the first %v: %s", time.Duration(startMs)*time.Millisecond, path)
+		}
+		// playFrom checks the path
+		return p.PlayFrom(ctx, path, metadata, startMs)
+	}
+	metadata, err := p.checkOpen(path, metadata)
+	if err != nil {
+		return err
+	}
+	metadata = withCueTags(path, metadata)
+
 	// Serialize all play operations - only one Play() can run at a time
 	p.playbackMu.Lock()
 	defer p.playbackMu.Unlock()
@@ -235,6 +639,8 @@ func (p *Player) Play(ctx context.Context, path string, metadata *TrackMetadata)
 	doneChan := p.sessionDone
 
 	p.currentPath = path
+	p.applyTrackGainLocked(path)
+	p.dsp.startTrack(path)
 	p.position = 0
 	p.state = StatePlaying
 	p.metadata = metadata
@@ -244,18 +650,20 @@ func (p *Player) Play(ctx context.Context, path string, metadata *TrackMetadata)
 	var duration time.Duration
 	if metadata != nil && metadata.Duration > 0 {
 		duration = time.Duration(metadata.Duration) * time.Millisecond
-	} else {
+	} else if !IsStreamURL(path) {
 		var err error
-		duration, err = p.decoder.Duration(path)
+		duration, err = p.durationLocked(path)
 		if err != nil {
+			p.abandonSessionLocked(doneChan)
 			p.mu.Unlock()
 			return fmt.Errorf("failed to get duration: %w", err)
 		}
 	}
 	p.duration = duration.Milliseconds()
 
-	// Extract full metadata asynchronously if not provided
-	if metadata == nil || (metadata.Title == "" && metadata.Artist == "") {
+	// Extract full metadata asynchronously if not provided; streams get
+	// theirs from the station as they play
+	if !IsStreamURL(path) && (metadata == nil || (metadata.Title == "" && metadata.Artist == "")) {
 		go func(playerPath string, sessID uint64) {
 			if ffmpegDecoder, ok := p.decoder.(*FFmpegDecoder); ok {
 				if fileMeta, err := ffmpegDecoder.Metadata(playerPath); err == nil {
@@ -356,18 +764,53 @@ func (p *Player) playbackLoop(ctx context.Context, path string, sessionID uint64
 	}
 	p.mu.RUnlock()
 
+	if r := p.activeRenderer(); r != nil {
+		p.remotePlaybackLoop(ctx, r, path, 0, sessionID)
+		return
+	}
+	if p.isLiveStream(path) {
+		p.streamPlaybackLoop(ctx, path, sessionID)
+		return
+	}
+
 	// Track elapsed time accounting for pauses
+	clock := p.timeSource()
 	var elapsedBeforePause time.Duration
-	playStartTime := time.Now()
+	playStartTime := clock.Now()
+
+	source, out, ready := p.openStream(ctx, path)
 
-	// Start a goroutine to update position while playing
+	// Start a goroutine to update position while playing. It has exited by
+	// the time the session ends, so it leaves no ticker on the clock.
 	positionDone := make(chan struct{})
+	positionExited := make(chan struct{})
+	stopPosition := func() {
+		close(positionDone)
+		<-positionExited
+	}
 	go func() {
-		ticker := time.NewTicker(250 * time.Millisecond)
+		defer close(positionExited)
+
+		// Pre-buffering holds the audio back, so start the clock once it plays
+		if ready != nil {
+			select {
+			case <-ready:
+				playStartTime = clock.Now()
+			case <-positionDone:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		ticker := clock.NewTicker(250 * time.Millisecond)
 		defer ticker.Stop()
 
 		wasPlaying := true
-		lastMediaUpdate := time.Now()
+		lastMediaUpdate := clock.Now()
+		lastPositionReport := clock.Now()
+		preloading := false
+		endingNotified := false
 
 		for {
 			select {
@@ -375,7 +818,7 @@ func (p *Player) playbackLoop(ctx context.Context, path string, sessionID uint64
 				return
 			case <-ctx.Done():
 				return
-			case <-ticker.C:
+			case <-ticker.C():
 				p.mu.Lock()
 				// Check if we're still the active session
 				if p.sessionID != sessionID {
@@ -385,29 +828,41 @@ func (p *Player) playbackLoop(ctx context.Context, path string, sessionID uint64
 				if p.state == StatePlaying {
 					if !wasPlaying {
 						// Just resumed - reset start time
-						playStartTime = time.Now()
+						playStartTime = clock.Now()
 						wasPlaying = true
 						// Update media session on state change
 						if p.mediaSession != nil {
 							p.mediaSession.UpdatePlaybackState(media.StatePlaying, time.Duration(p.position)*time.Millisecond)
 						}
-						lastMediaUpdate = time.Now()
+						lastMediaUpdate = clock.Now()
 					}
-					p.position = (elapsedBeforePause + time.Since(playStartTime)).Milliseconds()
+					p.position = (elapsedBeforePause + clock.Now().Sub(playStartTime)).Milliseconds()
 					// Check if we've reached the end
 					if p.position >= p.duration {
 						p.position = p.duration
 					}
+					// Get the next track decoding as this one nears its end
+					if !preloading && p.duration-p.position <= preloadLead.Milliseconds() {
+						preloading = true
+						go p.preloadNext(sessionID, true)
+					}
+					if !endingNotified {
+						endingNotified = p.trackEndingLocked(path)
+					}
 					// Only update media session every 5 seconds (for Rate-based tracking)
-					if time.Since(lastMediaUpdate) >= 5*time.Second {
+					if clock.Now().Sub(lastMediaUpdate) >= 5*time.Second {
 						if p.mediaSession != nil {
 							p.mediaSession.UpdatePlaybackState(media.StatePlaying, time.Duration(p.position)*time.Millisecond)
 						}
-						lastMediaUpdate = time.Now()
+						lastMediaUpdate = clock.Now()
+					}
+					if clock.Now().Sub(lastPositionReport) >= positionReportInterval {
+						p.reportPositionLocked()
+						lastPositionReport = clock.Now()
 					}
 				} else if p.state == StatePaused && wasPlaying {
 					// Just paused - save elapsed time
-					elapsedBeforePause += time.Since(playStartTime)
+					elapsedBeforePause += clock.Now().Sub(playStartTime)
 					wasPlaying = false
 				}
 				p.mu.Unlock()
@@ -415,9 +870,16 @@ func (p *Player) playbackLoop(ctx context.Context, path string, sessionID uint64
 		}
 	}()
 
-	err := p.decoder.Decode(ctx, path, p.output)
+	err := closeStream(out, p.decodeTrack(ctx, sessionID, path, source, out, 0))
 	if err != nil && !errors.Is(err, context.Canceled) {
 		log.Printf("[PLAYER] Decode error: %v", err)
+		decodeErrors.Inc()
+		p.mu.RLock()
+		callback, current := p.onDecodeError, p.sessionID == sessionID
+		p.mu.RUnlock()
+		if callback != nil && current {
+			callback(path, err)
+		}
 	} else {
 		log.Printf("[PLAYER] Decode complete, audio buffered: %s", path)
 	}
@@ -426,26 +888,34 @@ func (p *Player) playbackLoop(ctx context.Context, path string, sessionID uint64
 	p.mu.RLock()
 	if p.sessionID != sessionID {
 		p.mu.RUnlock()
-		close(positionDone)
+		stopPosition()
 		log.Printf("[PLAYER] Session %d superseded after decode, exiting", sessionID)
 		return
 	}
 	remainingMs := p.duration - p.position
 	p.mu.RUnlock()
 
+	// Nothing more will be written; an empty buffer from here on is the end
+	// of the track, not an underrun
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		otoOutput.EndStream()
+	}
+
 	// Wait for the audio to actually finish playing
 	// The buffer needs time to drain through the audio output
 	if remainingMs > 0 && err == nil {
 		log.Printf("[PLAYER] Waiting for audio playback to complete (%dms remaining)", remainingMs)
+		timer := clock.NewTimer(time.Duration(remainingMs+500) * time.Millisecond)
 		select {
 		case <-ctx.Done():
 			log.Printf("[PLAYER] Playback cancelled")
-		case <-time.After(time.Duration(remainingMs+500) * time.Millisecond):
+		case <-timer.C():
 			log.Printf("[PLAYER] Playback finished: %s", path)
 		}
+		timer.Stop()
 	}
 
-	close(positionDone)
+	stopPosition()
 
 	p.mu.Lock()
 
@@ -454,6 +924,12 @@ func (p *Player) playbackLoop(ctx context.Context, path string, sessionID uint64
 		wasManual := p.wasManualStop
 		callback := p.onTrackEnd
 
+		if !wasManual {
+			// Played to the end - let the position tracker forget this track
+			p.position = p.duration
+			p.reportPositionLocked()
+		}
+
 		p.state = StateStopped
 		p.currentPath = ""
 		p.position = 0
@@ -487,18 +963,59 @@ func (p *Player) playbackLoopFrom(ctx context.Context, path string, startMs int6
 	}
 	p.mu.RUnlock()
 
+	if r := p.activeRenderer(); r != nil {
+		p.remotePlaybackLoop(ctx, r, path, startMs, sessionID)
+		return
+	}
+	// Live streams can't seek, so they always start from now
+	if p.isLiveStream(path) {
+		p.streamPlaybackLoop(ctx, path, sessionID)
+		return
+	}
+
+	// A cued track starts out paused
+	p.mu.RLock()
+	startedPlaying := p.state == StatePlaying
+	p.mu.RUnlock()
+
 	// Track elapsed time accounting for pauses, starting from seek position
+	clock := p.timeSource()
 	elapsedBeforePause := time.Duration(startMs) * time.Millisecond
-	playStartTime := time.Now()
+	playStartTime := clock.Now()
 
-	// Start a goroutine to update position while playing
+	source, out, ready := p.openStream(ctx, path)
+
+	// Start a goroutine to update position while playing. It has exited by
+	// the time the session ends, so it leaves no ticker on the clock.
 	positionDone := make(chan struct{})
+	positionExited := make(chan struct{})
+	stopPosition := func() {
+		close(positionDone)
+		<-positionExited
+	}
 	go func() {
-		ticker := time.NewTicker(250 * time.Millisecond)
+		defer close(positionExited)
+
+		// Pre-buffering holds the audio back, so start the clock once it plays
+		if ready != nil {
+			select {
+			case <-ready:
+				playStartTime = clock.Now()
+			case <-positionDone:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		ticker := clock.NewTicker(250 * time.Millisecond)
 		defer ticker.Stop()
 
-		wasPlaying := true
-		lastMediaUpdate := time.Now()
+		wasPlaying := startedPlaying
+		lastMediaUpdate := clock.Now()
+		lastPositionReport := clock.Now()
+		preloading := false
+		endingNotified := false
 
 		for {
 			select {
@@ -506,7 +1023,7 @@ func (p *Player) playbackLoopFrom(ctx context.Context, path string, startMs int6
 				return
 			case <-ctx.Done():
 				return
-			case <-ticker.C:
+			case <-ticker.C():
 				p.mu.Lock()
 				// Check if we're still the active session
 				if p.sessionID != sessionID {
@@ -515,25 +1032,37 @@ func (p *Player) playbackLoopFrom(ctx context.Context, path string, startMs int6
 				}
 				if p.state == StatePlaying {
 					if !wasPlaying {
-						playStartTime = time.Now()
+						playStartTime = clock.Now()
 						wasPlaying = true
 						if p.mediaSession != nil {
 							p.mediaSession.UpdatePlaybackState(media.StatePlaying, time.Duration(p.position)*time.Millisecond)
 						}
-						lastMediaUpdate = time.Now()
+						lastMediaUpdate = clock.Now()
 					}
-					p.position = (elapsedBeforePause + time.Since(playStartTime)).Milliseconds()
+					p.position = (elapsedBeforePause + clock.Now().Sub(playStartTime)).Milliseconds()
 					if p.position >= p.duration {
 						p.position = p.duration
 					}
-					if time.Since(lastMediaUpdate) >= 5*time.Second {
+					// Get the next track decoding as this one nears its end
+					if !preloading && p.duration-p.position <= preloadLead.Milliseconds() {
+						preloading = true
+						go p.preloadNext(sessionID, true)
+					}
+					if !endingNotified {
+						endingNotified = p.trackEndingLocked(path)
+					}
+					if clock.Now().Sub(lastMediaUpdate) >= 5*time.Second {
 						if p.mediaSession != nil {
 							p.mediaSession.UpdatePlaybackState(media.StatePlaying, time.Duration(p.position)*time.Millisecond)
 						}
-						lastMediaUpdate = time.Now()
+						lastMediaUpdate = clock.Now()
+					}
+					if clock.Now().Sub(lastPositionReport) >= positionReportInterval {
+						p.reportPositionLocked()
+						lastPositionReport = clock.Now()
 					}
 				} else if p.state == StatePaused && wasPlaying {
-					elapsedBeforePause += time.Since(playStartTime)
+					elapsedBeforePause += clock.Now().Sub(playStartTime)
 					wasPlaying = false
 				}
 				p.mu.Unlock()
@@ -542,17 +1071,17 @@ func (p *Player) playbackLoopFrom(ctx context.Context, path string, startMs int6
 	}()
 
 	// Decode from the specified start position
-	ffmpegDecoder, ok := p.decoder.(*FFmpegDecoder)
-	var err error
-	if ok {
-		err = ffmpegDecoder.DecodeFrom(ctx, path, p.output, startMs)
-	} else {
-		// Fallback to regular decode (loses seek position)
-		err = p.decoder.Decode(ctx, path, p.output)
-	}
+	err := closeStream(out, p.decodeTrack(ctx, sessionID, path, source, out, startMs))
 
 	if err != nil && !errors.Is(err, context.Canceled) {
 		log.Printf("[PLAYER] Decode error: %v", err)
+		decodeErrors.Inc()
+		p.mu.RLock()
+		callback, current := p.onDecodeError, p.sessionID == sessionID
+		p.mu.RUnlock()
+		if callback != nil && current {
+			callback(path, err)
+		}
 	} else {
 		log.Printf("[PLAYER] Decode complete, audio buffered: %s", path)
 	}
@@ -561,25 +1090,33 @@ func (p *Player) playbackLoopFrom(ctx context.Context, path string, startMs int6
 	p.mu.RLock()
 	if p.sessionID != sessionID {
 		p.mu.RUnlock()
-		close(positionDone)
+		stopPosition()
 		log.Printf("[PLAYER] Session %d superseded after decode, exiting", sessionID)
 		return
 	}
 	remainingMs := p.duration - p.position
 	p.mu.RUnlock()
 
+	// Nothing more will be written; an empty buffer from here on is the end
+	// of the track, not an underrun
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		otoOutput.EndStream()
+	}
+
 	// Wait for the audio to actually finish playing
 	if remainingMs > 0 && err == nil {
 		log.Printf("[PLAYER] Waiting for audio playback to complete (%dms remaining)", remainingMs)
+		timer := clock.NewTimer(time.Duration(remainingMs+500) * time.Millisecond)
 		select {
 		case <-ctx.Done():
 			log.Printf("[PLAYER] Playback cancelled")
-		case <-time.After(time.Duration(remainingMs+500) * time.Millisecond):
+		case <-timer.C():
 			log.Printf("[PLAYER] Playback finished: %s", path)
 		}
+		timer.Stop()
 	}
 
-	close(positionDone)
+	stopPosition()
 
 	p.mu.Lock()
 
@@ -588,6 +1125,12 @@ func (p *Player) playbackLoopFrom(ctx context.Context, path string, startMs int6
 		wasManual := p.wasManualStop
 		callback := p.onTrackEnd
 
+		if !wasManual {
+			// Played to the end - let the position tracker forget this track
+			p.position = p.duration
+			p.reportPositionLocked()
+		}
+
 		p.state = StateStopped
 		p.currentPath = ""
 		p.position = 0
@@ -622,11 +1165,13 @@ func (p *Player) Pause() error {
 	}
 
 	p.state = StatePaused
+	p.reportPositionLocked()
 
 	// Actually pause the audio output
 	if otoOutput, ok := p.output.(*OtoOutput); ok {
 		otoOutput.Pause()
 	}
+	p.wakeRemote()
 
 	if p.mediaSession != nil {
 		p.mediaSession.UpdatePlaybackState(media.StatePaused, time.Duration(p.position)*time.Millisecond)
@@ -662,6 +1207,7 @@ func (p *Player) Resume() error {
 	if otoOutput, ok := p.output.(*OtoOutput); ok {
 		otoOutput.Resume()
 	}
+	p.wakeRemote()
 
 	if p.mediaSession != nil {
 		p.mediaSession.UpdatePlaybackState(media.StatePlaying, time.Duration(p.position)*time.Millisecond)
@@ -677,6 +1223,7 @@ func (p *Player) Stop() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	p.discardPreloadLocked()
 	if p.state == StateStopped {
 		return nil
 	}
@@ -685,7 +1232,18 @@ func (p *Player) Stop() error {
 	return nil
 }
 
+// abandonSessionLocked ends a session that failed before its playback
+// goroutine started, so the next Play doesn't wait on it (must be called
+// with lock held)
+func (p *Player) abandonSessionLocked(done chan struct{}) {
+	p.state = StateStopped
+	p.currentPath = ""
+	p.metadata = nil
+	close(done)
+}
+
 func (p *Player) stopPlaybackLocked() {
+	p.reportPositionLocked()
 	p.state = StateStopped
 	p.wasManualStop = true // Mark this as a manual stop
 
@@ -717,17 +1275,24 @@ func (p *Player) stopPlaybackLocked() {
 
 	p.currentPath = ""
 	p.position = 0
+	p.buffering = false
+	p.streamTitle = ""
 	p.metadata = nil
 }
 
-// Seek seeks to the specified position in milliseconds
-func (p *Player) Seek(positionMs int64) error {
+// SeekTo seeks to the specified position in milliseconds. A paused track
+// stays paused at the new position.
+func (p *Player) SeekTo(positionMs int64) error {
 	p.mu.Lock()
 	
 	if p.state == StateStopped {
 		p.mu.Unlock()
 		return errors.New("not playing")
 	}
+	if IsStreamURL(p.currentPath) && p.duration <= 0 {
+		p.mu.Unlock()
+		return errors.New("can't seek a live stream")
+	}
 
 	// Clamp to valid range
 	if positionMs < 0 {
@@ -752,12 +1317,27 @@ func (p *Player) Seek(positionMs int64) error {
 	if wasPlaying {
 		return p.PlayFrom(context.Background(), path, metadata, positionMs)
 	}
-	
-	return nil
+	return p.Cue(context.Background(), path, metadata, positionMs)
 }
 
 // PlayFrom starts playback from a specific position (for seeking)
 func (p *Player) PlayFrom(ctx context.Context, path string, metadata *TrackMetadata, startMs int64) error {
+	return p.playFrom(ctx, path, metadata, startMs, false)
+}
+
+// Cue loads a track paused at the given position so a later Resume starts
+// playback from there (used to restore the last session on startup)
+func (p *Player) Cue(ctx context.Context, path string, metadata *TrackMetadata, startMs int64) error {
+	return p.playFrom(ctx, path, metadata, startMs, true)
+}
+
+func (p *Player) playFrom(ctx context.Context, path string, metadata *TrackMetadata, startMs int64, startPaused bool) error {
+	metadata, err := p.checkOpen(path, metadata)
+	if err != nil {
+		return err
+	}
+	metadata = withCueTags(path, metadata)
+
 	// Serialize all play operations - only one Play() can run at a time
 	p.playbackMu.Lock()
 	defer p.playbackMu.Unlock()
@@ -785,8 +1365,13 @@ func (p *Player) PlayFrom(ctx context.Context, path string, metadata *TrackMetad
 	doneChan := p.sessionDone
 
 	p.currentPath = path
+	p.applyTrackGainLocked(path)
+	p.dsp.startTrack(path)
 	p.position = startMs
 	p.state = StatePlaying
+	if startPaused {
+		p.state = StatePaused
+	}
 	p.metadata = metadata
 	p.wasManualStop = false
 
@@ -794,10 +1379,11 @@ func (p *Player) PlayFrom(ctx context.Context, path string, metadata *TrackMetad
 	var duration time.Duration
 	if metadata != nil && metadata.Duration > 0 {
 		duration = time.Duration(metadata.Duration) * time.Millisecond
-	} else {
+	} else if !IsStreamURL(path) {
 		var err error
-		duration, err = p.decoder.Duration(path)
+		duration, err = p.durationLocked(path)
 		if err != nil {
+			p.abandonSessionLocked(doneChan)
 			p.mu.Unlock()
 			return fmt.Errorf("failed to get duration: %w", err)
 		}
@@ -813,7 +1399,18 @@ func (p *Player) PlayFrom(ctx context.Context, path string, metadata *TrackMetad
 			Duration: duration,
 			ArtPath:  metadata.ArtPath,
 		})
-		p.mediaSession.UpdatePlaybackState(media.StatePlaying, time.Duration(startMs)*time.Millisecond)
+		mediaState := media.StatePlaying
+		if startPaused {
+			mediaState = media.StatePaused
+		}
+		p.mediaSession.UpdatePlaybackState(mediaState, time.Duration(startMs)*time.Millisecond)
+	}
+
+	// Hold the output before any audio is decoded into it
+	if startPaused {
+		if otoOutput, ok := p.output.(*OtoOutput); ok {
+			otoOutput.Pause()
+		}
 	}
 
 	p.stopChan = make(chan struct{})
@@ -834,7 +1431,7 @@ func (p *Player) PlayFrom(ctx context.Context, path string, metadata *TrackMetad
 
 // SetVolume sets the playback volume (0.0 - 1.0)
 func (p *Player) SetVolume(volume float64) error {
-	if volume < 0 || volume > 1 {
+	if !validVolume(volume) {
 		return errors.New("volume must be between 0.0 and 1.0")
 	}
 
@@ -845,24 +1442,45 @@ func (p *Player) SetVolume(volume float64) error {
 	if otoOutput, ok := p.output.(*OtoOutput); ok {
 		otoOutput.SetVolume(volume)
 	}
+	p.wakeRemote()
 
 	p.mu.Unlock()
 
+	if p.mediaSession != nil {
+		p.mediaSession.UpdateVolume(volume)
+	}
+
 	return nil
 }
 
+// Position returns the live playback position (implements media.StatusProvider)
+func (p *Player) Position() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return time.Duration(p.position) * time.Millisecond
+}
+
+// Volume returns the playback volume (implements media.StatusProvider)
+func (p *Player) Volume() float64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.volume
+}
+
 // Status returns the current playback status
 func (p *Player) Status() Status {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
 	return Status{
-		State:    p.state,
-		Path:     p.currentPath,
-		Position: p.position,
-		Duration: p.duration,
-		Volume:   p.volume,
-		Metadata: p.metadata,
+		State:       p.state,
+		Path:        p.currentPath,
+		Position:    p.position,
+		Duration:    p.duration,
+		Volume:      p.volume,
+		Metadata:    p.metadata,
+		Buffering:   p.buffering,
+		StreamTitle: p.streamTitle,
 	}
 }
 
@@ -877,6 +1495,71 @@ func (p *Player) GetAudioBands() []uint8 {
 	return make([]uint8, 64)
 }
 
+// SetChannelMix sets the mono, balance and swap options of the local output
+func (p *Player) SetChannelMix(m ChannelMix) {
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		otoOutput.SetChannelMix(m)
+	}
+}
+
+// validVolume reports whether volume is a number between 0.0 and 1.0
+func validVolume(volume float64) bool {
+	return !math.IsNaN(volume) && volume >= 0 && volume <= 1
+}
+
+// SetVolumeCurve sets how the volume maps onto loudness at the output
+func (p *Player) SetVolumeCurve(curve string) {
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		otoOutput.SetVolumeCurve(curve)
+	}
+}
+
+// SetDSPChain replaces the effects applied to the audio, in order. The
+// chain is left as it was if any stage is unknown or misconfigured.
+func (p *Player) SetDSPChain(stages []DSPStageConfig) error {
+	return p.dsp.set(stages)
+}
+
+// DSPChain returns the effects applied to the audio, in order
+func (p *Player) DSPChain() []DSPStageConfig {
+	return p.dsp.get()
+}
+
+// SetZones replaces the additional output zones that play alongside the
+// local device
+func (p *Player) SetZones(zones []ZoneConfig) {
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		otoOutput.ConfigureZones(zones)
+	}
+}
+
+// Zones returns the state of every output zone, the local device first
+func (p *Player) Zones() []ZoneInfo {
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		return otoOutput.Zones()
+	}
+	return nil
+}
+
+// EnableZone turns an output zone on or off
+func (p *Player) EnableZone(name string, enabled bool) error {
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		return otoOutput.EnableZone(name, enabled)
+	}
+	return ErrUnknownZone
+}
+
+// SetZoneVolume sets an output zone's volume (0.0 - 1.0)
+func (p *Player) SetZoneVolume(name string, volume float64) error {
+	if !validVolume(volume) {
+		return errors.New("volume must be between 0.0 and 1.0")
+	}
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		return otoOutput.SetZoneVolume(name, volume)
+	}
+	return ErrUnknownZone
+}
+
 // SetAudioCallback registers a callback for real-time audio data push
 // The callback is called immediately when new audio analysis is ready (no polling)
 func (p *Player) SetAudioCallback(cb AudioDataCallback) {
@@ -896,6 +1579,10 @@ func (p *Player) Close() error {
 	if p.state != StateStopped {
 		p.stopPlaybackLocked()
 	}
+	p.discardPreloadLocked()
+	if p.preview != nil {
+		p.preview.Stop()
+	}
 
 	var errs []error
 
@@ -911,6 +1598,12 @@ func (p *Player) Close() error {
 		}
 	}
 
+	if p.renderer != nil {
+		if err := p.renderer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if len(errs) > 0 {
 		return fmt.Errorf("errors during close: %v", errs)
 	}
@@ -918,6 +1611,12 @@ func (p *Player) Close() error {
 	return nil
 }
 
+// Preview returns the channel for pre-listening to tracks alongside the
+// main playback, nil if the player has no local device
+func (p *Player) Preview() *Preview {
+	return p.preview
+}
+
 // UpdateShuffle updates the shuffle state in the OS media session
 func (p *Player) UpdateShuffle(enabled bool) error {
 	p.mu.RLock()
@@ -1009,7 +1708,7 @@ func (p *Player) OnCommand(cmd media.Command, data interface{}) error {
 	case media.CmdSeek:
 		if pos, ok := data.(time.Duration); ok {
 			log.Printf("[PLAYER] Seeking to %v", pos)
-			return p.Seek(pos.Milliseconds())
+			return p.SeekTo(pos.Milliseconds())
 		}
 		return nil
 
@@ -1025,6 +1724,13 @@ func (p *Player) OnCommand(cmd media.Command, data interface{}) error {
 		}
 		return nil
 
+	case media.CmdSetVolume:
+		if volume, ok := data.(float64); ok {
+			log.Printf("[PLAYER] Volume changed from OS: %.2f", volume)
+			return p.SetVolume(volume)
+		}
+		return nil
+
 	case media.CmdSetLoopStatus:
 		if status, ok := data.(media.LoopStatus); ok {
 			log.Printf("[PLAYER] Loop status changed from OS: %s", status)
@@ -0,0 +1,105 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTrackEndingLead(t *testing.T) {
+	ended := make(chan int64, 1)
+	p := &Player{duration: 30000, position: 15000}
+	p.SetTrackEndingLead(10 * time.Second)
+	p.SetOnTrackEnding(func(path string, remainingMs int64) {
+		ended <- remainingMs
+	})
+
+	if p.trackEndingLocked("track.flac") {
+		t.Error("Expected no call with 15s left")
+	}
+	p.position = 21000
+	if !p.trackEndingLocked("track.flac") {
+		t.Fatal("Expected a call with 9s left")
+	}
+	select {
+	case remaining := <-ended:
+		if remaining != 9000 {
+			t.Errorf("Expected 9000ms remaining, got %d", remaining)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Callback not called")
+	}
+
+	p.SetTrackEndingLead(0)
+	if p.trackEndingLocked("track.flac") {
+		t.Error("Expected a zero lead to disable the callback")
+	}
+}
+
+func TestSetVolumeRejectsNonFinite(t *testing.T) {
+	player, err := NewSimulatedPlayer(nil, NewSimDecoder(0), NewManualClock(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, volume := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), -0.1, 1.1} {
+		if err := player.SetVolume(volume); err == nil {
+			t.Errorf("Expected volume %v to be rejected", volume)
+		}
+	}
+	if err := player.SetVolume(0.5); err != nil || player.Status().Volume != 0.5 {
+		t.Errorf("Expected volume 0.5 to be set, got %v (%v)", player.Status().Volume, err)
+	}
+}
+
+func TestPathCheckRefusesTracksAndArt(t *testing.T) {
+	player, err := NewSimulatedPlayer(nil, NewSimDecoder(0), NewManualClock(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+	player.SetPathCheck(func(path string) error {
+		if path != "/music/a.flac" {
+			return errors.New("not allowed: " + path)
+		}
+		return nil
+	})
+
+	ctx := context.Background()
+	if err := player.Play(ctx, "/etc/passwd", nil); err == nil {
+		t.Error("Expected a track the check refuses not to play")
+	}
+	if err := player.PlayFrom(ctx, "/etc/passwd", nil, 1000); err == nil {
+		t.Error("Expected a track the check refuses not to play from a position")
+	}
+	if err := player.Play(ctx, "/music/a.flac", &TrackMetadata{Title: "A", ArtPath: "/etc/shadow"}); err != nil {
+		t.Fatalf("Expected an allowed track to play, got %v", err)
+	}
+	if meta := player.Status().Metadata; meta == nil || meta.Title != "A" || meta.ArtPath != "" {
+		t.Errorf("Expected the track's metadata without the refused art, got %+v", meta)
+	}
+}
+
+func TestPathCheckRunsOncePerPlay(t *testing.T) {
+	player, err := NewSimulatedPlayer(nil, NewSimDecoder(0), NewManualClock(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+	var checked []string
+	player.SetPathCheck(func(path string) error {
+		checked = append(checked, path)
+		return nil
+	})
+
+	ctx := context.Background()
+	player.Play(ctx, "/music/a.flac", nil)
+	// A resumed track goes on to play from its position
+	player.SetResumeProvider(func(string) int64 { return 5000 })
+	player.Play(ctx, "/music/b.flac", nil)
+	player.Stop()
+	if len(checked) != 2 || checked[0] != "/music/a.flac" || checked[1] != "/music/b.flac" {
+		t.Errorf("Expected each track checked once, got %v", checked)
+	}
+}
@@ -0,0 +1,288 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// preloadLead is how long before the end of a track the next one starts
+// decoding
+const preloadLead = 20 * time.Second
+
+// preloadBuffer is how much of the next track is decoded before it plays
+const preloadBuffer = 2 * time.Second
+
+// errPreloadDiscarded is returned to a preloaded decoder whose track didn't
+// play after all
+var errPreloadDiscarded = errors.New("preloaded track discarded")
+
+// NextTrackProvider returns the track expected to play after the current
+// one, or "" if there isn't one
+type NextTrackProvider func() (path string, metadata *TrackMetadata)
+
+// preloadedTrack is the next track, got ready while the current one plays
+// so skipping to it doesn't wait on ffprobe and FFmpeg starting up
+type preloadedTrack struct {
+	path     string
+	duration time.Duration  // 0 until probed
+	decode   *pendingDecode // nil until the current track nears its end
+}
+
+// discard stops the preloaded decoder, if there is one
+func (t *preloadedTrack) discard() {
+	if t != nil && t.decode != nil {
+		t.decode.discard()
+	}
+}
+
+// pendingDecode is a decoder started ahead of its track
+type pendingDecode struct {
+	source  string
+	startMs int64
+	out     *pendingOutput
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+}
+
+// wait hands the decoded audio on to out and waits for the track to finish
+// decoding, or for ctx to be cancelled
+func (d *pendingDecode) wait(ctx context.Context, out Output) error {
+	stop := context.AfterFunc(ctx, d.cancel)
+	defer stop()
+	d.out.attach(out)
+	<-d.done
+	return d.err
+}
+
+func (d *pendingDecode) discard() {
+	d.cancel()
+	d.out.discard()
+}
+
+// pendingOutput holds the start of a track decoded ahead of time, up to a
+// limit, then passes audio straight on once attached to the track's output
+type pendingOutput struct {
+	sampleRate int
+	channels   int
+	format     SampleFormat
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	buf       []byte
+	limit     int
+	target    Output
+	discarded bool
+}
+
+func newPendingOutput(device Output, buffer time.Duration) *pendingOutput {
+	o := &pendingOutput{
+		sampleRate: device.SampleRate(),
+		channels:   device.Channels(),
+		format:     device.Format(),
+	}
+	o.limit = int(buffer.Seconds() * float64(o.sampleRate*o.channels*o.format.Size()))
+	o.cond = sync.NewCond(&o.mu)
+	return o
+}
+
+func (o *pendingOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	for o.target == nil && !o.discarded && len(o.buf) >= o.limit {
+		o.cond.Wait()
+	}
+	if o.discarded {
+		o.mu.Unlock()
+		return 0, errPreloadDiscarded
+	}
+	if target := o.target; target != nil {
+		o.mu.Unlock()
+		return target.Write(p)
+	}
+	o.buf = append(o.buf, p...)
+	o.mu.Unlock()
+	return len(p), nil
+}
+
+// attach writes the held audio to target, which gets everything written
+// from then on. Writes wait while the held audio is handed over, so the
+// track stays in order.
+func (o *pendingOutput) attach(target Output) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.buf) > 0 {
+		target.Write(o.buf)
+		o.buf = nil
+	}
+	o.target = target
+	o.cond.Broadcast()
+}
+
+func (o *pendingOutput) discard() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.discarded = true
+	o.buf = nil
+	o.cond.Broadcast()
+}
+
+func (o *pendingOutput) Close() error         { return nil }
+func (o *pendingOutput) SampleRate() int      { return o.sampleRate }
+func (o *pendingOutput) Channels() int        { return o.channels }
+func (o *pendingOutput) Format() SampleFormat { return o.format }
+
+// SetNextTrackProvider sets the lookup of the track that plays next, which
+// is probed when a track starts and starts decoding as it nears its end
+func (p *Player) SetNextTrackProvider(provider NextTrackProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nextTrack = provider
+}
+
+// startPosition returns where playing path starts from: a saved resume
+// position, or else past its intro or leading silence, whichever ends later
+func (p *Player) startPosition(path string) (startMs int64, resumed bool) {
+	p.mu.RLock()
+	resume, intro := p.resumeProvider, p.introProvider
+	p.mu.RUnlock()
+	if resume != nil {
+		if startMs := resume(path); startMs > 0 {
+			return startMs, true
+		}
+	}
+	lead, _ := p.trackSilence(path)
+	startMs = lead.Milliseconds()
+	if intro != nil && !IsStreamURL(path) {
+		startMs = max(startMs, intro(path))
+	}
+	return startMs, false
+}
+
+// preloadNext gets the next track ready while session sessionID plays. Its
+// duration is probed straight away, and with decode its decoder is started
+// too, holding back the first few seconds of audio until the track plays.
+func (p *Player) preloadNext(sessionID uint64, decode bool) {
+	p.mu.RLock()
+	provider := p.nextTrack
+	current := p.sessionID == sessionID && p.renderer == nil
+	p.mu.RUnlock()
+	if provider == nil || !current {
+		return
+	}
+	path, metadata := provider()
+	if path == "" || IsStreamURL(path) {
+		return
+	}
+	if _, err := p.checkOpen(path, nil); err != nil {
+		// Playing the track reports the error
+		return
+	}
+
+	p.mu.Lock()
+	track := p.preload
+	if track != nil && track.path == p.currentPath && track.path != path {
+		// The current track hasn't picked up its own preload yet
+		p.mu.Unlock()
+		return
+	}
+	if track == nil || track.path != path {
+		track.discard()
+		track = &preloadedTrack{path: path}
+		p.preload = track
+	}
+	if metadata != nil && metadata.Duration > 0 {
+		track.duration = time.Duration(metadata.Duration) * time.Millisecond
+	}
+	probed := track.duration > 0
+	p.mu.Unlock()
+
+	if !probed {
+		duration, err := p.trackDuration(path)
+		if err != nil {
+			// Playing the track reports the error
+			return
+		}
+		p.mu.Lock()
+		track.duration = duration
+		p.mu.Unlock()
+	}
+	if !decode {
+		return
+	}
+
+	startMs, _ := p.startPosition(path)
+	source := trackFile(path)
+	p.mu.RLock()
+	resolver := p.sourceResolver
+	p.mu.RUnlock()
+	if resolver != nil {
+		source = resolver(source)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.preload != track || track.decode != nil || p.sessionID != sessionID {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	pending := &pendingDecode{
+		source:  source,
+		startMs: startMs,
+		out:     newPendingOutput(p.output, preloadBuffer),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	track.decode = pending
+	durationMs := track.duration.Milliseconds()
+	log.Printf("[PLAYER] Preloading next track: %s", path)
+	go func() {
+		defer close(pending.done)
+		pending.err = p.decodeWithRecovery(ctx, path, source, pending.out, startMs, durationMs)
+	}()
+}
+
+// durationLocked returns the duration of path, probed ahead of time if it
+// is the preloaded track. A preloaded track that isn't path is dropped.
+// Must be called with lock held.
+func (p *Player) durationLocked(path string) (time.Duration, error) {
+	if track := p.preload; track != nil {
+		if track.path == path && track.duration > 0 {
+			return track.duration, nil
+		}
+		if track.path != path {
+			track.discard()
+			p.preload = nil
+		}
+	}
+	return p.trackDuration(path)
+}
+
+// discardPreloadLocked drops the preloaded track (must be called with lock
+// held)
+func (p *Player) discardPreloadLocked() {
+	p.preload.discard()
+	p.preload = nil
+}
+
+// decodeTrack decodes the track session sessionID plays, carrying on from
+// the preloaded decoder when it was started for the same source and
+// position, and starts getting the track after it ready
+func (p *Player) decodeTrack(ctx context.Context, sessionID uint64, path, source string, out Output, startMs int64) error {
+	p.mu.Lock()
+	durationMs := p.duration
+	track := p.preload
+	p.preload = nil
+	p.mu.Unlock()
+	go p.preloadNext(sessionID, false)
+
+	if track != nil && track.path == path && track.decode != nil &&
+		track.decode.source == source && track.decode.startMs == startMs {
+		log.Printf("[PLAYER] Playing preloaded track: %s", path)
+		return track.decode.wait(ctx, out)
+	}
+	track.discard()
+	return p.decodeWithRecovery(ctx, path, source, out, startMs, durationMs)
+}
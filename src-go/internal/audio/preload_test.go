@@ -0,0 +1,85 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPendingOutputHandsOverInOrder(t *testing.T) {
+	// 100ms of memoryOutput audio is 400 bytes
+	o := newPendingOutput(&memoryOutput{}, 100*time.Millisecond)
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for i := byte(1); i <= 4; i++ {
+			o.Write(bytes.Repeat([]byte{i}, 200))
+		}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-written:
+		t.Fatal("Expected writes to wait once the buffer is full")
+	default:
+	}
+
+	target := &memoryOutput{}
+	o.attach(target)
+	<-written
+	got := target.buf.Bytes()
+	if len(got) != 800 {
+		t.Fatalf("Expected all 800 bytes, got %d", len(got))
+	}
+	for i := 0; i < 4; i++ {
+		if got[i*200] != byte(i+1) {
+			t.Fatalf("Expected chunk %d in order, got %d", i+1, got[i*200])
+		}
+	}
+}
+
+func TestDecodeTrackUsesPreload(t *testing.T) {
+	d, runs := fakeDecoder(t, "printf '%0400d' 0\n")
+	p := &Player{decoder: d, output: &memoryOutput{}, sessionID: 1}
+	p.SetNextTrackProvider(func() (string, *TrackMetadata) {
+		return "next.flac", &TrackMetadata{Duration: 1000}
+	})
+
+	p.preloadNext(1, true)
+	p.mu.Lock()
+	duration, err := p.durationLocked("next.flac")
+	p.mu.Unlock()
+	if err != nil || duration != time.Second {
+		t.Errorf("Expected the duration from the queue, got %v (%v)", duration, err)
+	}
+
+	out := &memoryOutput{}
+	if err := p.decodeTrack(context.Background(), 1, "next.flac", "next.flac", out, 0); err != nil {
+		t.Fatalf("Expected the preloaded track to play, got %v", err)
+	}
+	if out.Len() != 400 {
+		t.Errorf("Expected the preloaded audio, got %d bytes", out.Len())
+	}
+	if lines := readRuns(t, runs); len(lines) != 1 {
+		t.Errorf("Expected the preloaded decoder to be used, got %d runs", len(lines))
+	}
+
+	// A preload started from another position isn't used
+	p.preloadNext(1, true)
+	out = &memoryOutput{}
+	if err := p.decodeTrack(context.Background(), 1, "next.flac", "next.flac", out, 500); err != nil {
+		t.Fatal(err)
+	}
+	runsFrom500 := 0
+	for _, line := range readRuns(t, runs) {
+		if strings.HasPrefix(line, "-ss 0.500 ") {
+			runsFrom500++
+		}
+	}
+	if runsFrom500 != 1 || out.Len() != 400 {
+		t.Errorf("Expected a fresh decoder from 500ms, got %d runs and %d bytes", runsFrom500, out.Len())
+	}
+}
@@ -0,0 +1,266 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/oto/v2"
+)
+
+const (
+	// DefaultPreviewVolume is the preview channel's volume until one is set,
+	// low so it sits under the main playback
+	DefaultPreviewVolume = 0.3
+
+	// previewBufferTime is how far decoding may get ahead of the preview
+	previewBufferTime = 500 * time.Millisecond
+
+	// previewPollInterval is how often a preview that has finished decoding
+	// is checked for having finished playing
+	previewPollInterval = 50 * time.Millisecond
+)
+
+// errPreviewStopped is returned to the decoder when its preview is stopped
+var errPreviewStopped = errors.New("preview stopped")
+
+// Preview is a second, lightweight playback channel for pre-listening to
+// tracks while the main playback carries on. It plays straight to the local
+// device at its own volume, without the DSP chain, zones or the OS media
+// session. One track previews at a time; playing another replaces it.
+type Preview struct {
+	context    *oto.Context
+	decoder    *FFmpegDecoder
+	sampleRate int
+	channels   int
+	format     SampleFormat
+
+	mu      sync.Mutex
+	volume  float64
+	path    string // "" when nothing is previewing
+	player  oto.Player
+	output  *previewOutput
+	cancel  context.CancelFunc
+	session uint64 // Incremented on each Play, so a stopped preview's end is ignored
+	onEnd   func(path string)
+	check   PathCheck // Where tracks may be previewed from; nil for anywhere
+}
+
+func newPreview(output *OtoOutput, decoder *FFmpegDecoder) *Preview {
+	return &Preview{
+		context:    output.context,
+		decoder:    decoder,
+		sampleRate: output.SampleRate(),
+		channels:   output.Channels(),
+		format:     output.Format(),
+		volume:     DefaultPreviewVolume,
+	}
+}
+
+// SetOnEnd sets a callback for when a preview plays to its end. It isn't
+// called for previews that are stopped or replaced.
+func (p *Preview) SetOnEnd(callback func(path string)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onEnd = callback
+}
+
+// SetVolume sets the preview channel's volume (0.0 - 1.0), including for a
+// preview that is playing
+func (p *Preview) SetVolume(volume float64) error {
+	if !validVolume(volume) {
+		return errors.New("volume must be between 0.0 and 1.0")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.volume = volume
+	if p.player != nil {
+		p.player.SetVolume(volume)
+	}
+	return nil
+}
+
+// Volume returns the preview channel's volume
+func (p *Preview) Volume() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.volume
+}
+
+// Playing returns the path of the track previewing, or "" if none is
+func (p *Preview) Playing() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.path
+}
+
+// Play previews lengthMs of the track at path from startMs, or the rest of
+// the track if lengthMs is 0, replacing any preview already playing
+func (p *Preview) Play(path string, startMs, lengthMs int64) error {
+	if IsStreamURL(path) {
+		return errors.New("streams can't be previewed")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.check != nil {
+		if err := p.check(path); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	p.stopLocked()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	output := newPreviewOutput(p.sampleRate, p.channels, p.format)
+	player := p.context.NewPlayer(output)
+	player.SetVolume(p.volume)
+	player.Play()
+
+	p.session++
+	p.path, p.player, p.output, p.cancel = path, player, output, cancel
+	go p.run(ctx, p.session, player, output, path, startMs, lengthMs)
+	return nil
+}
+
+// setPathCheck sets the check tracks are put to before they're previewed
+func (p *Preview) setPathCheck(check PathCheck) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.check = check
+}
+
+// Stop stops the preview, if one is playing
+func (p *Preview) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopLocked()
+}
+
+func (p *Preview) stopLocked() {
+	if p.player == nil {
+		return
+	}
+	p.cancel()
+	p.output.stop()
+	p.player.Close()
+	p.path, p.player, p.output, p.cancel = "", nil, nil, nil
+}
+
+// run decodes a preview and waits for it to finish playing
+func (p *Preview) run(ctx context.Context, session uint64, player oto.Player, output *previewOutput, path string, startMs, lengthMs int64) {
+	err := p.decoder.DecodeRange(ctx, path, output, startMs, lengthMs)
+	if ctx.Err() != nil || errors.Is(err, errPreviewStopped) {
+		return
+	}
+	if err != nil {
+		log.Printf("[AUDIO] Preview of %s failed: %v", path, err)
+	}
+	output.finish()
+
+	ticker := time.NewTicker(previewPollInterval)
+	defer ticker.Stop()
+	for player.IsPlaying() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+
+	p.mu.Lock()
+	if p.session != session {
+		p.mu.Unlock()
+		return
+	}
+	p.stopLocked()
+	onEnd := p.onEnd
+	p.mu.Unlock()
+
+	if onEnd != nil {
+		onEnd(path)
+	}
+}
+
+// previewOutput buffers a preview's decoded audio for its oto player. The
+// device's players are all read from one goroutine, so reads never block:
+// silence is returned while the decoder catches up.
+type previewOutput struct {
+	sampleRate int
+	channels   int
+	format     SampleFormat
+	maxBuffer  int
+
+	mu       sync.Mutex
+	buffer   bytes.Buffer
+	finished bool // Nothing more will be written
+	stopped  bool
+}
+
+func newPreviewOutput(sampleRate, channels int, format SampleFormat) *previewOutput {
+	return &previewOutput{
+		sampleRate: sampleRate,
+		channels:   channels,
+		format:     format,
+		maxBuffer:  int(previewBufferTime.Seconds()*float64(sampleRate)) * channels * format.Size(),
+	}
+}
+
+// Write buffers decoded audio, waiting while the buffer is full
+func (o *previewOutput) Write(data []byte) (int, error) {
+	for {
+		o.mu.Lock()
+		if o.stopped {
+			o.mu.Unlock()
+			return 0, errPreviewStopped
+		}
+		if o.buffer.Len() < o.maxBuffer {
+			break
+		}
+		o.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer o.mu.Unlock()
+	return o.buffer.Write(data)
+}
+
+// Read implements io.Reader for the oto player
+func (o *previewOutput) Read(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.buffer.Len() == 0 {
+		if o.finished || o.stopped {
+			return 0, io.EOF
+		}
+		clear(p)
+		return len(p), nil
+	}
+	return o.buffer.Read(p)
+}
+
+// finish marks the preview fully decoded, so it ends once drained
+func (o *previewOutput) finish() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished = true
+}
+
+// stop drops what's buffered and fails further writes
+func (o *previewOutput) stop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stopped = true
+	o.buffer.Reset()
+}
+
+func (o *previewOutput) Close() error         { return nil }
+func (o *previewOutput) SampleRate() int      { return o.sampleRate }
+func (o *previewOutput) Channels() int        { return o.channels }
+func (o *previewOutput) Format() SampleFormat { return o.format }
@@ -0,0 +1,37 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestPreviewOutput(t *testing.T) {
+	o := newPreviewOutput(1000, 2, FormatS16)
+
+	// Silence keeps the device fed until the decoder catches up
+	buf := bytes.Repeat([]byte{1}, 8)
+	if n, err := o.Read(buf); n != 8 || err != nil || !bytes.Equal(buf, make([]byte, 8)) {
+		t.Fatalf("Expected silence while waiting, got %v (%d, %v)", buf, n, err)
+	}
+
+	o.Write([]byte{1, 2, 3, 4})
+	o.finish()
+	if n, _ := o.Read(buf); n != 4 || !bytes.Equal(buf[:4], []byte{1, 2, 3, 4}) {
+		t.Fatalf("Expected the decoded audio, got %v", buf[:n])
+	}
+	if _, err := o.Read(buf); err != io.EOF {
+		t.Errorf("Expected EOF once drained, got %v", err)
+	}
+
+	o = newPreviewOutput(1000, 2, FormatS16)
+	o.Write([]byte{1, 2, 3, 4})
+	o.stop()
+	if _, err := o.Write([]byte{5, 6}); !errors.Is(err, errPreviewStopped) {
+		t.Errorf("Expected writes to fail once stopped, got %v", err)
+	}
+	if _, err := o.Read(buf); err != io.EOF {
+		t.Errorf("Expected buffered audio dropped once stopped, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// readAheadOutput sits between the decoder and the device output and holds
+// decoded audio that hasn't been played yet. A track on a slow network mount
+// decodes well ahead of playback, so a stalled read drains the read-ahead
+// instead of leaving the device buffer empty.
+type readAheadOutput struct {
+	out       Output
+	ctx       context.Context
+	mu        sync.Mutex
+	cond      *sync.Cond
+	buf       bytes.Buffer
+	capacity  int // Bytes of decoded audio held at most
+	preBuffer int // Bytes held back before the first write to out
+	started   bool
+	closed    bool // No more data will be written
+	err       error
+	ready     chan struct{} // Closed once audio reaches out
+	done      chan struct{} // Closed when pump exits
+	stopWake  func() bool
+}
+
+// newReadAheadOutput starts buffering in front of out. preBuffer is clamped
+// to readAhead.
+func newReadAheadOutput(ctx context.Context, out Output, preBuffer, readAhead time.Duration) *readAheadOutput {
+	frameSize := out.Channels() * out.Format().Size()
+	bytesPerSec := float64(out.SampleRate() * frameSize)
+	toBytes := func(d time.Duration) int {
+		n := int(d.Seconds() * bytesPerSec)
+		return n - n%frameSize
+	}
+
+	r := &readAheadOutput{
+		out:       out,
+		ctx:       ctx,
+		capacity:  max(toBytes(readAhead), frameSize),
+		preBuffer: toBytes(min(preBuffer, readAhead)),
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	r.cond = sync.NewCond(&r.mu)
+	r.stopWake = context.AfterFunc(ctx, func() {
+		r.mu.Lock()
+		r.cond.Broadcast()
+		r.mu.Unlock()
+	})
+
+	go r.pump()
+	return r
+}
+
+// Write queues decoded audio, blocking while the read-ahead is full
+func (r *readAheadOutput) Write(data []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for r.buf.Len() > 0 && r.buf.Len()+len(data) > r.capacity && r.err == nil && r.ctx.Err() == nil {
+		r.cond.Wait()
+	}
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	r.buf.Write(data)
+	r.cond.Broadcast()
+	return len(data), nil
+}
+
+// Close marks the end of the track and waits until all buffered audio has
+// been passed to the device output. It does not close the device output.
+func (r *readAheadOutput) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.cond.Broadcast()
+	r.mu.Unlock()
+
+	<-r.done
+	r.stopWake()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Ready is closed when the first audio reaches the device output
+func (r *readAheadOutput) Ready() <-chan struct{} {
+	return r.ready
+}
+
+// buffering reports whether playback is waiting for audio: before the
+// pre-buffer first fills, or after the read-ahead has run dry
+func (r *readAheadOutput) buffering() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.closed && (!r.started || r.buf.Len() == 0)
+}
+
+// SampleRate returns the sample rate of the device output
+func (r *readAheadOutput) SampleRate() int {
+	return r.out.SampleRate()
+}
+
+// Channels returns the channel count of the device output
+func (r *readAheadOutput) Channels() int {
+	return r.out.Channels()
+}
+
+// Format returns the sample format of the device output
+func (r *readAheadOutput) Format() SampleFormat {
+	return r.out.Format()
+}
+
+// pump moves buffered audio to the device output once the pre-buffer is
+// filled or the track ended
+func (r *readAheadOutput) pump() {
+	defer close(r.done)
+
+	chunk := make([]byte, 4096)
+	for {
+		r.mu.Lock()
+		for r.ctx.Err() == nil && !r.closed && (r.buf.Len() == 0 || (!r.started && r.buf.Len() < r.preBuffer)) {
+			r.cond.Wait()
+		}
+		if r.ctx.Err() != nil || (r.closed && r.buf.Len() == 0) {
+			r.mu.Unlock()
+			return
+		}
+		if !r.started {
+			r.started = true
+			close(r.ready)
+		}
+		n, _ := r.buf.Read(chunk)
+		r.cond.Broadcast()
+		r.mu.Unlock()
+
+		if _, err := r.out.Write(chunk[:n]); err != nil {
+			r.mu.Lock()
+			r.err = err
+			r.cond.Broadcast()
+			r.mu.Unlock()
+			return
+		}
+	}
+}
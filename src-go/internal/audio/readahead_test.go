@@ -0,0 +1,112 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryOutput records everything written to it. Writes wait for block to
+// be closed if it is set, like a device that stopped playing.
+type memoryOutput struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	block chan struct{}
+}
+
+func (m *memoryOutput) Write(p []byte) (int, error) {
+	if m.block != nil {
+		<-m.block
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.buf.Write(p)
+}
+
+func (m *memoryOutput) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.buf.Len()
+}
+
+func (m *memoryOutput) Close() error    { return nil }
+func (m *memoryOutput) SampleRate() int { return 1000 }
+func (m *memoryOutput) Channels() int   { return 2 }
+
+func (m *memoryOutput) Format() SampleFormat { return FormatS16 }
+
+func TestReadAheadHoldsBackPreBuffer(t *testing.T) {
+	out := &memoryOutput{}
+	// 1000Hz stereo 16-bit: 4 bytes per millisecond
+	ra := newReadAheadOutput(context.Background(), out, 100*time.Millisecond, time.Second)
+
+	ra.Write(make([]byte, 200))
+	time.Sleep(20 * time.Millisecond)
+	if n := out.Len(); n != 0 {
+		t.Errorf("Expected nothing written before the pre-buffer filled, got %d bytes", n)
+	}
+	select {
+	case <-ra.Ready():
+		t.Error("Expected Ready to stay open during pre-buffering")
+	default:
+	}
+
+	ra.Write(make([]byte, 300))
+	select {
+	case <-ra.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("Expected Ready once the pre-buffer filled")
+	}
+
+	if err := ra.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if n := out.Len(); n != 500 {
+		t.Errorf("Expected all 500 bytes flushed on Close, got %d", n)
+	}
+}
+
+func TestReadAheadShortTrack(t *testing.T) {
+	out := &memoryOutput{}
+	ra := newReadAheadOutput(context.Background(), out, time.Second, time.Second)
+
+	// A track shorter than the pre-buffer still plays when it ends
+	ra.Write(make([]byte, 40))
+	if err := ra.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if n := out.Len(); n != 40 {
+		t.Errorf("Expected 40 bytes flushed, got %d", n)
+	}
+}
+
+func TestReadAheadCancel(t *testing.T) {
+	out := &memoryOutput{block: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	ra := newReadAheadOutput(ctx, out, time.Second, time.Second)
+
+	// The pump takes the first write and waits on the device; the second
+	// fills the read-ahead so the next write blocks
+	ra.Write(make([]byte, 4000))
+	ra.Write(make([]byte, 4000))
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := ra.Write(make([]byte, 400))
+		errCh <- err
+	}()
+
+	cancel()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("Expected blocked write to fail after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected blocked write to return after cancel")
+	}
+	close(out.block)
+	ra.Close()
+}
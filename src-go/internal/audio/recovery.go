@@ -0,0 +1,69 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// maxDecodeRestarts is how many times the decoder is restarted for one
+// track before the track is given up on
+const maxDecodeRestarts = 3
+
+// countingOutput counts the bytes written through it, so a restarted decoder
+// knows where the last one got to
+type countingOutput struct {
+	Output
+	written atomic.Int64
+}
+
+func (c *countingOutput) Write(p []byte) (int, error) {
+	n, err := c.Output.Write(p)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+// SetStallTimeout sets how long the decoder may go without producing audio
+// before it is restarted, 0 to wait for it indefinitely
+func (p *Player) SetStallTimeout(timeout time.Duration) {
+	if decoder, ok := p.decoder.(*FFmpegDecoder); ok {
+		decoder.SetStallTimeout(timeout)
+	}
+}
+
+// decodeWithRecovery decodes like decode, restarting FFmpeg from where it
+// got to if it stalls or exits with an error part way through. A decoder
+// that fails without producing any audio isn't restarted, as the file is
+// most likely unreadable.
+func (p *Player) decodeWithRecovery(ctx context.Context, path, source string, out Output, startMs, durationMs int64) error {
+	if _, ok := p.decoder.(*FFmpegDecoder); !ok {
+		return p.decode(ctx, path, source, out, startMs, durationMs)
+	}
+	bytesPerMs := float64(out.SampleRate()*out.Channels()*out.Format().Size()) / 1000
+
+	for restarts := 0; ; restarts++ {
+		counter := &countingOutput{Output: out}
+		err := p.decode(ctx, path, source, counter, startMs, durationMs)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		decodedMs := int64(float64(counter.written.Load()) / bytesPerMs)
+		if decodedMs == 0 && !errors.Is(err, ErrDecoderStalled) {
+			if restarts > 0 {
+				return fmt.Errorf("restarted decoder failed at %dms: %w", startMs, err)
+			}
+			return err
+		}
+		if restarts == maxDecodeRestarts {
+			return fmt.Errorf("decoder failed %d times, last at %dms: %w", restarts+1, startMs+decodedMs, err)
+		}
+
+		startMs += decodedMs
+		log.Printf("[PLAYER] Decoder failed at %dms, restarting: %v", startMs, err)
+		decoderRestarts.Inc()
+	}
+}
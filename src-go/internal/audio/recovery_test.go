@@ -0,0 +1,106 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDecoder returns a decoder running script in place of ffmpeg. Each run
+// appends its arguments to the returned file.
+func fakeDecoder(t *testing.T, script string) (*FFmpegDecoder, string) {
+	t.Helper()
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	script = "#!/bin/sh\necho \"$*\" >> " + runs + "\n" + script
+	if err := os.WriteFile(ffmpeg, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &FFmpegDecoder{ffmpegPath: ffmpeg, resampler: DefaultResampler, stallTimeout: DefaultStallTimeout}, runs
+}
+
+func readRuns(t *testing.T, runs string) []string {
+	t.Helper()
+	data, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestDecoderStallTimeout(t *testing.T) {
+	d, _ := fakeDecoder(t, "printf '%0400d' 0\nexec sleep 10\n")
+	d.SetStallTimeout(100 * time.Millisecond)
+
+	out := &memoryOutput{}
+	start := time.Now()
+	err := d.Decode(context.Background(), "track.flac", out)
+	if !errors.Is(err, ErrDecoderStalled) {
+		t.Fatalf("Expected the decoder to stall, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the stall to be caught quickly, took %v", elapsed)
+	}
+	if out.Len() != 400 {
+		t.Errorf("Expected the audio before the stall to be written, got %d bytes", out.Len())
+	}
+}
+
+func TestDecoderStallIgnoresBlockedOutput(t *testing.T) {
+	d, _ := fakeDecoder(t, "printf '%0400d' 0\n")
+	d.SetStallTimeout(50 * time.Millisecond)
+
+	// A paused device holds up the write for longer than the timeout
+	out := &memoryOutput{block: make(chan struct{})}
+	time.AfterFunc(200*time.Millisecond, func() { close(out.block) })
+	if err := d.Decode(context.Background(), "track.flac", out); err != nil {
+		t.Fatalf("Expected a blocked output not to count as a stall, got %v", err)
+	}
+}
+
+func TestDecodeWithRecoveryRestartsWhereItStopped(t *testing.T) {
+	// 400 bytes is 100ms of memoryOutput audio
+	d, runs := fakeDecoder(t, "printf '%0400d' 0\ncase \"$*\" in *-ss*) exit 0 ;; esac\nexit 1\n")
+	p := &Player{decoder: d}
+
+	out := &memoryOutput{}
+	if err := p.decodeWithRecovery(context.Background(), "track.flac", "track.flac", out, 0, 0); err != nil {
+		t.Fatalf("Expected the restarted decoder to finish the track, got %v", err)
+	}
+	if out.Len() != 800 {
+		t.Errorf("Expected audio from both runs, got %d bytes", out.Len())
+	}
+	lines := readRuns(t, runs)
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "-ss 0.100 ") {
+		t.Errorf("Expected one restart from 100ms, got %q", lines)
+	}
+}
+
+func TestDecodeWithRecoveryGivesUp(t *testing.T) {
+	t.Run("no audio", func(t *testing.T) {
+		d, runs := fakeDecoder(t, "exit 1\n")
+		p := &Player{decoder: d}
+		if err := p.decodeWithRecovery(context.Background(), "track.flac", "track.flac", &memoryOutput{}, 0, 0); err == nil {
+			t.Fatal("Expected an error")
+		}
+		if lines := readRuns(t, runs); len(lines) != 1 {
+			t.Errorf("Expected a decoder that produced nothing not to be restarted, got %d runs", len(lines))
+		}
+	})
+
+	t.Run("keeps failing", func(t *testing.T) {
+		d, runs := fakeDecoder(t, "printf '%0400d' 0\nexit 1\n")
+		p := &Player{decoder: d}
+		if err := p.decodeWithRecovery(context.Background(), "track.flac", "track.flac", &memoryOutput{}, 0, 0); err == nil {
+			t.Fatal("Expected an error")
+		}
+		if lines := readRuns(t, runs); len(lines) != maxDecodeRestarts+1 {
+			t.Errorf("Expected %d runs, got %d", maxDecodeRestarts+1, len(lines))
+		}
+	})
+}
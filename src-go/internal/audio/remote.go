@@ -0,0 +1,280 @@
+package audio
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/media"
+)
+
+const (
+	// How often a renderer is asked for its position and state
+	remotePollInterval = time.Second
+
+	// Limits for a single request to a renderer
+	remoteLoadTimeout    = 15 * time.Second
+	remoteCommandTimeout = 5 * time.Second
+
+	// How long a renderer may take to start playing a loaded track
+	remoteStartTimeout = 30 * time.Second
+
+	// Consecutive failed status requests before playback is given up
+	maxRemoteFailures = 5
+)
+
+// Renderer plays tracks on another device, such as a Chromecast or a UPnP
+// MediaRenderer, in place of the local output
+type Renderer interface {
+	// Load starts path on the device at startMs, held paused if paused is set
+	Load(ctx context.Context, path string, metadata *TrackMetadata, startMs int64, paused bool) error
+	Play(ctx context.Context) error
+	Pause(ctx context.Context) error
+	Stop(ctx context.Context) error
+	SetVolume(ctx context.Context, volume float64) error
+	Status(ctx context.Context) (RemoteStatus, error)
+	Close() error
+}
+
+// RemoteStatus is what a renderer reports about the loaded track. State is
+// StateStopped once the track has finished or was stopped on the device.
+type RemoteStatus struct {
+	State    PlaybackState
+	Position int64 // milliseconds
+	Duration int64 // milliseconds, 0 if unknown
+}
+
+// SetRenderer redirects playback to r, or back to the local output if r is
+// nil. The current track carries on from its position on the new target.
+func (p *Player) SetRenderer(r Renderer) {
+	p.playbackMu.Lock()
+
+	p.mu.Lock()
+	old := p.renderer
+	path, metadata, position, state := p.currentPath, p.metadata, p.position, p.state
+	if state != StateStopped {
+		p.stopPlaybackLocked()
+	}
+	oldDone := p.sessionDone
+	p.renderer = r
+	p.mu.Unlock()
+
+	// The old target must be stopped before it is released
+	if oldDone != nil {
+		<-oldDone
+	}
+	if old != nil {
+		if err := old.Close(); err != nil {
+			log.Printf("[PLAYER] Failed to close renderer: %v", err)
+		}
+	}
+	p.playbackMu.Unlock()
+
+	if path == "" || state == StateStopped {
+		return
+	}
+	var err error
+	if state == StatePlaying {
+		err = p.PlayFrom(context.Background(), path, metadata, position)
+	} else {
+		err = p.Cue(context.Background(), path, metadata, position)
+	}
+	if err != nil {
+		log.Printf("[PLAYER] Failed to continue %s on new target: %v", path, err)
+	}
+}
+
+// activeRenderer returns the renderer playback goes to, nil for the local
+// output
+func (p *Player) activeRenderer() Renderer {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.renderer
+}
+
+// PlayingLocally reports whether playback goes to the local output rather
+// than a renderer
+func (p *Player) PlayingLocally() bool {
+	return p.activeRenderer() == nil
+}
+
+// wakeRemote makes the remote playback loop pass on a state or volume change
+// straight away instead of at its next poll
+func (p *Player) wakeRemote() {
+	select {
+	case p.remoteWake <- struct{}{}:
+	default:
+	}
+}
+
+// remotePlaybackLoop plays path on a renderer. It relays pause, resume and
+// volume changes to the device and takes the position from it until the
+// track finishes or the session is stopped.
+func (p *Player) remotePlaybackLoop(ctx context.Context, r Renderer, path string, startMs int64, sessionID uint64) {
+	p.mu.RLock()
+	sent := p.state
+	metadata := p.metadata
+	volume := p.volume
+	p.mu.RUnlock()
+
+	log.Printf("[PLAYER] Starting remote playback from %dms (session %d): %s", startMs, sessionID, path)
+	loadCtx, cancel := context.WithTimeout(ctx, remoteLoadTimeout)
+	err := r.Load(loadCtx, path, metadata, startMs, sent == StatePaused)
+	cancel()
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[PLAYER] Renderer failed to load %s: %v", path, err)
+			p.abandonRemote(path, sessionID)
+		}
+		return
+	}
+	p.remoteCommand(ctx, "set volume", func(ctx context.Context) error { return r.SetVolume(ctx, volume) })
+
+	ticker := time.NewTicker(remotePollInterval)
+	defer ticker.Stop()
+
+	started := false
+	failures := 0
+	loadedAt := time.Now()
+	lastMediaUpdate := time.Now()
+	lastPositionReport := time.Now()
+	endingNotified := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Stopped or superseded; the next target may be this same device
+			stopCtx, cancel := context.WithTimeout(context.Background(), remoteCommandTimeout)
+			if err := r.Stop(stopCtx); err != nil {
+				log.Printf("[PLAYER] Renderer failed to stop: %v", err)
+			}
+			cancel()
+			return
+		case <-p.remoteWake:
+		case <-ticker.C:
+		}
+
+		p.mu.RLock()
+		if p.sessionID != sessionID {
+			p.mu.RUnlock()
+			return
+		}
+		want, wantVolume := p.state, p.volume
+		p.mu.RUnlock()
+
+		if want != sent {
+			if want == StatePaused {
+				p.remoteCommand(ctx, "pause", r.Pause)
+			} else {
+				p.remoteCommand(ctx, "play", r.Play)
+			}
+			sent = want
+		}
+		if wantVolume != volume {
+			volume = wantVolume
+			p.remoteCommand(ctx, "set volume", func(ctx context.Context) error { return r.SetVolume(ctx, volume) })
+		}
+
+		statusCtx, cancel := context.WithTimeout(ctx, remoteCommandTimeout)
+		status, err := r.Status(statusCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			if failures++; failures >= maxRemoteFailures {
+				log.Printf("[PLAYER] Lost contact with renderer: %v", err)
+				p.abandonRemote(path, sessionID)
+				return
+			}
+			continue
+		}
+		failures = 0
+
+		// Renderers report stopped while a new track is still loading
+		if status.State != StateStopped {
+			started = true
+		} else if started {
+			break
+		} else if time.Since(loadedAt) > remoteStartTimeout {
+			log.Printf("[PLAYER] Renderer did not start playing %s", path)
+			p.abandonRemote(path, sessionID)
+			return
+		}
+
+		p.mu.Lock()
+		if p.sessionID != sessionID {
+			p.mu.Unlock()
+			return
+		}
+		p.position = status.Position
+		if status.Duration > 0 {
+			p.duration = status.Duration
+		}
+		if !endingNotified {
+			endingNotified = p.trackEndingLocked(path)
+		}
+		if time.Since(lastMediaUpdate) >= 5*time.Second {
+			if p.mediaSession != nil {
+				p.mediaSession.UpdatePlaybackState(stateToMediaState(p.state), time.Duration(p.position)*time.Millisecond)
+			}
+			lastMediaUpdate = time.Now()
+		}
+		if time.Since(lastPositionReport) >= positionReportInterval {
+			p.reportPositionLocked()
+			lastPositionReport = time.Now()
+		}
+		p.mu.Unlock()
+	}
+
+	log.Printf("[PLAYER] Remote playback finished: %s", path)
+	p.mu.Lock()
+	if p.sessionID != sessionID || p.currentPath != path {
+		p.mu.Unlock()
+		return
+	}
+	p.position = p.duration
+	p.reportPositionLocked()
+	p.state = StateStopped
+	p.currentPath = ""
+	p.position = 0
+	callback := p.onTrackEnd
+	if p.mediaSession != nil {
+		p.mediaSession.UpdatePlaybackState(media.StateStopped, 0)
+	}
+	p.mu.Unlock()
+
+	if callback != nil {
+		log.Printf("[PLAYER] Track ended naturally, calling onTrackEnd callback")
+		callback(path)
+	}
+}
+
+// remoteCommand sends a transport command to the renderer, logging failures
+func (p *Player) remoteCommand(ctx context.Context, name string, command func(ctx context.Context) error) {
+	cmdCtx, cancel := context.WithTimeout(ctx, remoteCommandTimeout)
+	defer cancel()
+	if err := command(cmdCtx); err != nil && ctx.Err() == nil {
+		log.Printf("[PLAYER] Renderer failed to %s: %v", name, err)
+	}
+}
+
+// abandonRemote stops the session after the renderer failed. It counts as a
+// manual stop so the queue doesn't race through tracks the device can't play.
+func (p *Player) abandonRemote(path string, sessionID uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sessionID != sessionID || p.currentPath != path {
+		return
+	}
+	p.reportPositionLocked()
+	p.state = StateStopped
+	p.wasManualStop = true
+	p.currentPath = ""
+	p.position = 0
+	p.metadata = nil
+	if p.mediaSession != nil {
+		p.mediaSession.UpdatePlaybackState(media.StateStopped, 0)
+	}
+}
@@ -0,0 +1,163 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/media"
+)
+
+const (
+	// SimSampleRate is the rate simulated audio is generated at, low since
+	// nobody listens to it
+	SimSampleRate = 8000
+
+	// DefaultSimTrackLength is how long simulated tracks are unless set
+	DefaultSimTrackLength = 3 * time.Minute
+
+	// The sweep each simulated track plays, low to high over its length
+	simSweepLow  = 110.0
+	simSweepHigh = 1760.0
+
+	// simChunkFrames is how many frames are generated per write
+	simChunkFrames = 1024
+)
+
+// SimDecoder stands in for FFmpeg when the player runs as a simulation.
+// Every track is a sine sweep, so nothing is read from disk and any path
+// plays.
+type SimDecoder struct {
+	mu        sync.Mutex
+	length    time.Duration
+	durations map[string]time.Duration
+}
+
+// NewSimDecoder creates a decoder whose tracks are length long
+func NewSimDecoder(length time.Duration) *SimDecoder {
+	if length <= 0 {
+		length = DefaultSimTrackLength
+	}
+	return &SimDecoder{length: length, durations: make(map[string]time.Duration)}
+}
+
+// SetDuration sets how long the track at path is, overriding the default
+func (d *SimDecoder) SetDuration(path string, length time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.durations[path] = length
+}
+
+// Duration returns how long the track at path is
+func (d *SimDecoder) Duration(path string) (time.Duration, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if length, ok := d.durations[path]; ok {
+		return length, nil
+	}
+	return d.length, nil
+}
+
+// Decode generates the whole track at path
+func (d *SimDecoder) Decode(ctx context.Context, path string, output Output) error {
+	return d.DecodeRange(ctx, path, output, 0, 0)
+}
+
+// DecodeRange generates lengthMs of the track at path from startMs, or the
+// rest of it if lengthMs is 0. The sweep is a function of the position in
+// the track, so a seek picks it up where a full decode would be.
+func (d *SimDecoder) DecodeRange(ctx context.Context, path string, output Output, startMs, lengthMs int64) error {
+	length, _ := d.Duration(path)
+	rate, channels, format := output.SampleRate(), output.Channels(), output.Format()
+
+	total := int64(length.Seconds() * float64(rate))
+	frame := startMs * int64(rate) / 1000
+	end := total
+	if lengthMs > 0 {
+		end = min(end, frame+lengthMs*int64(rate)/1000)
+	}
+
+	// Exponential sweep, with its phase integrated so the tone is continuous
+	seconds := length.Seconds()
+	logRatio := math.Log(simSweepHigh / simSweepLow)
+	frameSize := channels * format.Size()
+	buf := make([]byte, simChunkFrames*frameSize)
+
+	for frame < end {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := int(min(end-frame, simChunkFrames))
+		for i := range n {
+			t := float64(frame+int64(i)) / float64(rate)
+			phase := 2 * math.Pi * simSweepLow * seconds * (math.Exp(logRatio*t/seconds) - 1) / logRatio
+			v := 0.5 * math.Sin(phase)
+			for c := range channels {
+				format.putSample(buf[i*frameSize+c*format.Size():], v)
+			}
+		}
+		if _, err := output.Write(buf[:n*frameSize]); err != nil {
+			return err
+		}
+		frame += int64(n)
+	}
+	return nil
+}
+
+func (d *SimDecoder) Close() error { return nil }
+
+// NullOutput discards everything written to it, for playing with no
+// device. It counts what it was given, for tests.
+type NullOutput struct {
+	sampleRate int
+	channels   int
+	format     SampleFormat
+	written    atomic.Int64
+}
+
+// NewNullOutput creates an output that claims the given format
+func NewNullOutput(sampleRate, channels int, format SampleFormat) *NullOutput {
+	return &NullOutput{sampleRate: sampleRate, channels: channels, format: format}
+}
+
+func (o *NullOutput) Write(data []byte) (int, error) {
+	o.written.Add(int64(len(data)))
+	return len(data), nil
+}
+
+// Written returns how many bytes have been written
+func (o *NullOutput) Written() int64 { return o.written.Load() }
+
+func (o *NullOutput) Close() error         { return nil }
+func (o *NullOutput) SampleRate() int      { return o.sampleRate }
+func (o *NullOutput) Channels() int        { return o.channels }
+func (o *NullOutput) Format() SampleFormat { return o.format }
+
+// NewSimulatedPlayer creates a player that decodes with decoder into a
+// NullOutput and is timed by clock, so it needs neither FFmpeg nor an audio
+// device. With a ManualClock, playback only moves when the clock is
+// advanced, so tests of track ends and seeking run the same way every time.
+// It has no preview channel.
+func NewSimulatedPlayer(mediaSession media.Session, decoder Decoder, clock Clock) (*Player, error) {
+	if decoder == nil || clock == nil {
+		return nil, errors.New("simulated player needs a decoder and a clock")
+	}
+	output := NewNullOutput(SimSampleRate, defaultChannels, FormatS16)
+
+	return &Player{
+		state:        StateStopped,
+		volume:       1.0,
+		mediaSession: mediaSession,
+		output:       output,
+		dsp:          newDSPChain(output.SampleRate(), output.Channels(), output.Format()),
+		decoder:      decoder,
+		clock:        clock,
+		stopChan:     make(chan struct{}),
+		pauseChan:    make(chan struct{}),
+		resumeChan:   make(chan struct{}),
+		remoteWake:   make(chan struct{}, 1),
+	}, nil
+}
@@ -0,0 +1,155 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+func TestSimDecoderRangeMatchesFullDecode(t *testing.T) {
+	d := NewSimDecoder(2 * time.Second)
+	full := &memoryOutput{}
+	if err := d.Decode(context.Background(), "track.flac", full); err != nil {
+		t.Fatal(err)
+	}
+	// memoryOutput is 1000 Hz stereo 16-bit
+	if full.Len() != 2000*4 {
+		t.Fatalf("Expected 2s of audio, got %d bytes", full.Len())
+	}
+
+	part := &memoryOutput{}
+	if err := d.DecodeRange(context.Background(), "track.flac", part, 500, 250); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(part.buf.Bytes(), full.buf.Bytes()[500*4:750*4]) {
+		t.Error("Expected a range to match the same stretch of a full decode")
+	}
+}
+
+// simulation is a simulated player with a queue that advances on track end,
+// as the daemon wires them
+type simulation struct {
+	t      *testing.T
+	clock  *ManualClock
+	player *Player
+	queue  *queue.Manager
+	ended  chan string
+}
+
+func newSimulation(t *testing.T, paths ...string) *simulation {
+	decoder := NewSimDecoder(10 * time.Second)
+	decoder.SetDuration("short.flac", 2*time.Second)
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	player, err := NewSimulatedPlayer(nil, decoder, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { player.Stop() })
+
+	s := &simulation{t: t, clock: clock, player: player, queue: queue.NewManager(), ended: make(chan string, 10)}
+	s.queue.Set(paths)
+	player.SetOnTrackEnd(func(path string) {
+		s.ended <- path
+		if next, _ := s.queue.Next(); next != "" {
+			player.Play(context.Background(), next, nil)
+		}
+	})
+	return s
+}
+
+// advance moves the clock on once the playback session has its ticker and
+// end timer waiting
+func (s *simulation) advance(d time.Duration) {
+	s.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.clock.WaitFor(ctx, 2); err != nil {
+		s.t.Fatalf("Playback never started waiting on the clock (%d waiting)", s.clock.Waiting())
+	}
+	s.clock.Advance(d)
+}
+
+// waitForStatus waits for the last tick's effect on the player to land
+func (s *simulation) waitForStatus(describe string, ok func(Status) bool) Status {
+	s.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := s.player.Status()
+		if ok(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("Expected %s, got %+v", describe, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s *simulation) expectEnded(path string) {
+	s.t.Helper()
+	select {
+	case ended := <-s.ended:
+		if ended != path {
+			s.t.Fatalf("Expected %s to end, got %s", path, ended)
+		}
+	case <-time.After(5 * time.Second):
+		s.t.Fatalf("Expected %s to end", path)
+	}
+}
+
+func TestSimulatedPlaybackAdvancesQueue(t *testing.T) {
+	s := newSimulation(t, "short.flac", "second.flac")
+	first, _ := s.queue.Next()
+	if err := s.player.Play(context.Background(), first, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s.advance(time.Second)
+	s.waitForStatus("1s into the first track", func(st Status) bool { return st.Position == 1000 })
+	select {
+	case path := <-s.ended:
+		t.Fatalf("Expected %s not to have ended yet", path)
+	default:
+	}
+
+	// The track plays out its length, plus the time allowed to drain
+	s.advance(1500 * time.Millisecond)
+	s.expectEnded("short.flac")
+	status := s.waitForStatus("the second track playing", func(st Status) bool {
+		return st.Path == "second.flac" && st.State == StatePlaying
+	})
+	if status.Duration != 10000 {
+		t.Errorf("Expected the second track's duration from the decoder, got %d", status.Duration)
+	}
+
+	s.advance(10500 * time.Millisecond)
+	s.expectEnded("second.flac")
+	s.waitForStatus("playback stopped at the end of the queue", func(st Status) bool { return st.State == StateStopped })
+}
+
+func TestSimulatedSeek(t *testing.T) {
+	s := newSimulation(t, "track.flac")
+	if err := s.player.Play(context.Background(), "track.flac", nil); err != nil {
+		t.Fatal(err)
+	}
+	s.advance(2 * time.Second)
+	s.waitForStatus("2s in", func(st Status) bool { return st.Position == 2000 })
+
+	if err := s.player.SeekTo(8000); err != nil {
+		t.Fatal(err)
+	}
+	s.waitForStatus("the seek position", func(st Status) bool { return st.Position == 8000 })
+	select {
+	case path := <-s.ended:
+		t.Fatalf("Expected a seek not to end %s", path)
+	default:
+	}
+
+	s.advance(time.Second)
+	s.waitForStatus("1s after the seek", func(st Status) bool { return st.Position == 9000 })
+	s.advance(1500 * time.Millisecond)
+	s.expectEnded("track.flac")
+}
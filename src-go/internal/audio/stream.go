@@ -0,0 +1,405 @@
+package audio
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/media"
+)
+
+const (
+	// Buffering for streams when network read-ahead is turned off
+	streamPreBuffer = 2 * time.Second
+	streamReadAhead = 10 * time.Second
+
+	// streamConnectTimeout bounds connecting to a stream and receiving its
+	// response headers
+	streamConnectTimeout = 15 * time.Second
+
+	// maxPlaylistSize limits how much of a .pls/.m3u playlist is read
+	maxPlaylistSize = 64 << 10
+
+	// maxPlaylistDepth limits playlists that point at other playlists
+	maxPlaylistDepth = 3
+)
+
+var streamClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: streamConnectTimeout,
+	},
+}
+
+// IsStreamURL reports whether path is an http(s) URL rather than a file
+func IsStreamURL(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// isLiveStream reports whether path is a stream with no end, such as internet
+// radio or HLS. A URL played with a known duration, such as a podcast
+// episode, decodes and seeks like a file instead.
+func (p *Player) isLiveStream(path string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return IsStreamURL(path) && p.duration <= 0
+}
+
+// streamSource is a stream ready to decode
+type streamSource struct {
+	input   string        // What ffmpeg reads: "pipe:0", or the URL for HLS
+	body    io.ReadCloser // The audio for pipe:0, nil for HLS
+	station string        // icy-name, if the server sent one
+}
+
+// openStreamSource connects to a stream. Shoutcast/Icecast streams are read
+// here so their ICY metadata can be stripped out and each new title passed to
+// onTitle; HLS playlists are left to ffmpeg, and .pls/.m3u playlists are
+// followed to the first stream they list.
+func openStreamSource(ctx context.Context, streamURL string, onTitle func(string), depth int) (*streamSource, error) {
+	if isHLSPath(streamURL) {
+		return &streamSource{input: streamURL}, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Icy-MetaData", "1")
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("stream: %s", resp.Status)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if isPlaylistType(contentType) || isPlaylistPath(streamURL) {
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize))
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read playlist: %w", err)
+		}
+		if strings.Contains(string(data), "#EXT-X-") {
+			return &streamSource{input: streamURL}, nil
+		}
+		if depth >= maxPlaylistDepth {
+			return nil, errors.New("too many nested playlists")
+		}
+		next, ok := firstPlaylistEntry(data, streamURL)
+		if !ok {
+			return nil, errors.New("playlist has no streams")
+		}
+		log.Printf("[PLAYER] Following playlist to %s", next)
+		return openStreamSource(ctx, next, onTitle, depth+1)
+	}
+
+	src := &streamSource{input: "pipe:0", body: resp.Body, station: resp.Header.Get("icy-name")}
+	if metaInt, err := strconv.Atoi(resp.Header.Get("icy-metaint")); err == nil && metaInt > 0 {
+		src.body = &icyReader{r: resp.Body, metaInt: metaInt, left: metaInt, onTitle: onTitle}
+	}
+	return src, nil
+}
+
+func isHLSPath(streamURL string) bool {
+	u, err := url.Parse(streamURL)
+	return err == nil && strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+func isPlaylistPath(streamURL string) bool {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return false
+	}
+	path := strings.ToLower(u.Path)
+	return strings.HasSuffix(path, ".pls") || strings.HasSuffix(path, ".m3u")
+}
+
+func isPlaylistType(contentType string) bool {
+	switch contentType {
+	case "audio/x-scpls", "audio/mpegurl", "audio/x-mpegurl",
+		"application/vnd.apple.mpegurl", "application/x-mpegurl":
+		return true
+	}
+	return false
+}
+
+// firstPlaylistEntry returns the first stream URL in a .pls or .m3u
+// playlist, resolved against the playlist's own URL
+func firstPlaylistEntry(data []byte, playlistURL string) (string, bool) {
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return "", false
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// .pls lines are key=value, with the streams under File1, File2...;
+		// an m3u line may have "=" in its query string instead
+		if key, value, ok := strings.Cut(line, "="); ok && !strings.ContainsAny(key, "/:?") {
+			if !strings.HasPrefix(strings.ToLower(key), "file") {
+				continue
+			}
+			line = strings.TrimSpace(value)
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		entry, err := base.Parse(line)
+		if err != nil || (entry.Scheme != "http" && entry.Scheme != "https") {
+			continue
+		}
+		return entry.String(), true
+	}
+	return "", false
+}
+
+// icyReader strips the metadata blocks a Shoutcast/Icecast server inserts
+// after every metaInt bytes of audio, and reports each new StreamTitle
+type icyReader struct {
+	r       io.ReadCloser
+	metaInt int
+	left    int // Audio bytes before the next metadata block
+	title   string
+	onTitle func(string)
+}
+
+func (r *icyReader) Read(p []byte) (int, error) {
+	if r.left == 0 {
+		if err := r.readMetadata(); err != nil {
+			return 0, err
+		}
+		r.left = r.metaInt
+	}
+	if len(p) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.r.Read(p)
+	r.left -= n
+	return n, err
+}
+
+func (r *icyReader) Close() error {
+	return r.r.Close()
+}
+
+// readMetadata reads one metadata block: a length byte counting 16-byte
+// units, then that much text, usually nothing
+func (r *icyReader) readMetadata() error {
+	var length [1]byte
+	if _, err := io.ReadFull(r.r, length[:]); err != nil {
+		return err
+	}
+	if length[0] == 0 {
+		return nil
+	}
+	meta := make([]byte, int(length[0])*16)
+	if _, err := io.ReadFull(r.r, meta); err != nil {
+		return err
+	}
+	if title, ok := parseStreamTitle(string(meta)); ok && title != r.title {
+		r.title = title
+		if r.onTitle != nil {
+			r.onTitle(title)
+		}
+	}
+	return nil
+}
+
+// parseStreamTitle reads StreamTitle from a metadata block such as
+// "StreamTitle='Artist - Title';StreamUrl='http://example.com';"
+func parseStreamTitle(meta string) (string, bool) {
+	_, rest, ok := strings.Cut(strings.TrimRight(meta, "\x00"), "StreamTitle='")
+	if !ok {
+		return "", false
+	}
+	// Titles may contain quotes, so only a quote before a semicolon ends one
+	title, _, ok := strings.Cut(rest, "';")
+	if !ok {
+		title = strings.TrimSuffix(rest, "'")
+	}
+	return strings.TrimSpace(title), true
+}
+
+// splitStreamTitle splits the usual "Artist - Title" form of a stream title
+func splitStreamTitle(streamTitle string) (artist, title string) {
+	if artist, title, ok := strings.Cut(streamTitle, " - "); ok {
+		return strings.TrimSpace(artist), strings.TrimSpace(title)
+	}
+	return "", streamTitle
+}
+
+// streamPlaybackLoop plays an internet radio or HLS stream until it ends,
+// fails or is stopped. A stream has no duration, so the position counts the
+// time it has been heard.
+func (p *Player) streamPlaybackLoop(ctx context.Context, streamURL string, sessionID uint64) {
+	p.mu.Lock()
+	if p.sessionID == sessionID {
+		p.buffering = true
+	}
+	preBuffer, readAhead := p.netPreBuffer, p.netReadAhead
+	p.mu.Unlock()
+	if readAhead <= 0 {
+		preBuffer, readAhead = streamPreBuffer, streamReadAhead
+	}
+
+	src, err := openStreamSource(ctx, streamURL, func(title string) {
+		p.setStreamTitle(sessionID, title)
+	}, 0)
+	if err == nil {
+		defer func() {
+			if src.body != nil {
+				src.body.Close()
+			}
+		}()
+		p.setStation(sessionID, src.station)
+
+		out := newReadAheadOutput(ctx, newDSPOutput(p.output, p.dsp), preBuffer, readAhead)
+		positionDone := make(chan struct{})
+		go p.trackStreamPosition(ctx, out, sessionID, positionDone)
+
+		if ffmpegDecoder, ok := p.decoder.(*FFmpegDecoder); ok {
+			err = ffmpegDecoder.DecodeStream(ctx, src.input, src.body, out)
+		} else {
+			err = errors.New("decoder can't play streams")
+		}
+		err = closeStream(out, err)
+		close(positionDone)
+	}
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("[PLAYER] Stream error: %v", err)
+		decodeErrors.Inc()
+	} else {
+		log.Printf("[PLAYER] Stream ended: %s", streamURL)
+	}
+
+	if otoOutput, ok := p.output.(*OtoOutput); ok {
+		otoOutput.EndStream()
+	}
+
+	p.mu.Lock()
+	if p.sessionID != sessionID || p.currentPath != streamURL {
+		p.mu.Unlock()
+		return
+	}
+	wasManual := p.wasManualStop
+	callback := p.onTrackEnd
+
+	p.state = StateStopped
+	p.currentPath = ""
+	p.position = 0
+	p.buffering = false
+	p.streamTitle = ""
+	if p.mediaSession != nil {
+		p.mediaSession.UpdatePlaybackState(media.StateStopped, 0)
+	}
+	p.mu.Unlock()
+
+	// A station going off the air moves on like the end of a track
+	if !wasManual && callback != nil {
+		callback(streamURL)
+	}
+}
+
+// trackStreamPosition keeps the position and buffering state of a stream up
+// to date until done is closed
+func (p *Player) trackStreamPosition(ctx context.Context, out *readAheadOutput, sessionID uint64, done <-chan struct{}) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	var heard time.Duration
+	last := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			if p.sessionID != sessionID {
+				p.mu.Unlock()
+				return
+			}
+			p.buffering = out.buffering()
+			if p.state == StatePlaying && !p.buffering {
+				heard += now.Sub(last)
+				p.position = heard.Milliseconds()
+			}
+			last = now
+			p.mu.Unlock()
+		}
+	}
+}
+
+// setStation names the stream after the station if the client didn't give
+// it a title
+func (p *Player) setStation(sessionID uint64, station string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sessionID != sessionID || station == "" {
+		return
+	}
+	meta := TrackMetadata{}
+	if p.metadata != nil {
+		meta = *p.metadata
+	}
+	if meta.Title != "" {
+		return
+	}
+	meta.Title = station
+	p.metadata = &meta
+	p.updateStreamSessionLocked()
+}
+
+// setStreamTitle records the now-playing title a station sent
+func (p *Player) setStreamTitle(sessionID uint64, streamTitle string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sessionID != sessionID {
+		return
+	}
+	log.Printf("[PLAYER] Now playing on stream: %s", streamTitle)
+	p.streamTitle = streamTitle
+	p.updateStreamSessionLocked()
+}
+
+// updateStreamSessionLocked shows the stream's now-playing title in the OS
+// media controls, with the station as the album (must be called with lock
+// held)
+func (p *Player) updateStreamSessionLocked() {
+	if p.mediaSession == nil {
+		return
+	}
+	var station, artPath string
+	if p.metadata != nil {
+		station, artPath = p.metadata.Title, p.metadata.ArtPath
+	}
+	artist, title := splitStreamTitle(p.streamTitle)
+	album := station
+	if title == "" {
+		title, album = station, ""
+	}
+	p.mediaSession.UpdateMetadata(media.Metadata{
+		Title:   title,
+		Artist:  artist,
+		Album:   album,
+		ArtPath: artPath,
+	})
+}
@@ -0,0 +1,122 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// icyBlock encodes a metadata block the way Shoutcast/Icecast send it
+func icyBlock(text string) []byte {
+	units := (len(text) + 15) / 16
+	block := make([]byte, 1+units*16)
+	block[0] = byte(units)
+	copy(block[1:], text)
+	return block
+}
+
+func TestICYReaderStripsMetadata(t *testing.T) {
+	var stream bytes.Buffer
+	stream.WriteString("abcd")
+	stream.Write(icyBlock("StreamTitle='Artist - It's Live';StreamUrl='';"))
+	stream.WriteString("efgh")
+	stream.Write([]byte{0}) // Empty block
+	stream.WriteString("ij")
+
+	var titles []string
+	r := &icyReader{
+		r:       io.NopCloser(&stream),
+		metaInt: 4,
+		left:    4,
+		onTitle: func(title string) { titles = append(titles, title) },
+	}
+
+	audio, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(audio) != "abcdefghij" {
+		t.Errorf("Expected metadata to be stripped, got %q", audio)
+	}
+	if len(titles) != 1 || titles[0] != "Artist - It's Live" {
+		t.Errorf("Expected one title, got %q", titles)
+	}
+	if artist, title := splitStreamTitle(titles[0]); artist != "Artist" || title != "It's Live" {
+		t.Errorf("Expected artist and title to be split, got %q / %q", artist, title)
+	}
+}
+
+func TestFirstPlaylistEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"pls", "[playlist]\nNumberOfEntries=1\nFile1=http://radio.example.com:8000/live\nTitle1=Live\n", "http://radio.example.com:8000/live"},
+		{"m3u", "#EXTM3U\n#EXTINF:-1,Live\nstream.mp3\n", "http://example.com/radio/stream.mp3"},
+		{"query", "http://radio.example.com/listen?type=mp3\n", "http://radio.example.com/listen?type=mp3"},
+		{"none", "#EXTM3U\n", ""},
+	}
+	for _, tt := range tests {
+		got, _ := firstPlaylistEntry([]byte(tt.data), "http://example.com/radio/list.m3u")
+		if got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestOpenStreamSourceFollowsPlaylist(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/listen.pls", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/x-scpls")
+		fmt.Fprintf(w, "[playlist]\nFile1=http://%s/live\n", r.Host)
+	})
+	mux.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Icy-MetaData") != "1" {
+			t.Error("Expected ICY metadata to be requested")
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("icy-name", "Test FM")
+		w.Header().Set("icy-metaint", "2")
+		w.Write([]byte("ab"))
+		w.Write(icyBlock("StreamTitle='Now';"))
+		w.Write([]byte("cd"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var title string
+	src, err := openStreamSource(context.Background(), server.URL+"/listen.pls", func(t string) { title = t }, 0)
+	if err != nil {
+		t.Fatalf("openStreamSource failed: %v", err)
+	}
+	defer src.body.Close()
+
+	if src.input != "pipe:0" || src.station != "Test FM" {
+		t.Errorf("Unexpected source: %+v", src)
+	}
+	audio, _ := io.ReadAll(src.body)
+	if string(audio) != "abcd" || title != "Now" {
+		t.Errorf("Expected audio abcd with title Now, got %q and %q", audio, title)
+	}
+}
+
+func TestOpenStreamSourceLeavesHLSToDecoder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\nsegment0.ts\n"))
+	}))
+	defer server.Close()
+
+	src, err := openStreamSource(context.Background(), server.URL+"/live", nil, 0)
+	if err != nil {
+		t.Fatalf("openStreamSource failed: %v", err)
+	}
+	if src.input != server.URL+"/live" || src.body != nil {
+		t.Errorf("Expected ffmpeg to read the HLS playlist itself, got %+v", src)
+	}
+}
@@ -0,0 +1,182 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+// Limits for visualizer settings
+const (
+	MinVisualizerBands = 1
+	MaxVisualizerBands = 256
+	MinVisualizerDb    = -120.0
+	MaxVisualizerFPS   = 60
+)
+
+// VisualizerSettings controls how the FFT spectrum is turned into bands
+type VisualizerSettings struct {
+	Bands     int     `json:"bands"`     // Number of logarithmically spaced bands
+	Smoothing float64 `json:"smoothing"` // Temporal smoothing, 0 (none) to <1
+	MinDb     float64 `json:"minDb"`     // Level mapped to 0
+	MaxDb     float64 `json:"maxDb"`     // Level mapped to 255
+	FPS       int     `json:"fps"`       // Maximum frames per second, 0 for every FFT frame
+}
+
+// DefaultVisualizerSettings returns the settings used by the built-in band output
+func DefaultVisualizerSettings() VisualizerSettings {
+	return VisualizerSettings{
+		Bands:     numBands,
+		Smoothing: smoothingFactor,
+		MinDb:     -60,
+		MaxDb:     0,
+	}
+}
+
+// Validate checks that the settings are usable
+func (s VisualizerSettings) Validate() error {
+	switch {
+	case s.Bands < MinVisualizerBands || s.Bands > MaxVisualizerBands:
+		return fmt.Errorf("bands must be between %d and %d", MinVisualizerBands, MaxVisualizerBands)
+	case s.Smoothing < 0 || s.Smoothing >= 1:
+		return fmt.Errorf("smoothing must be at least 0 and less than 1")
+	case s.MinDb < MinVisualizerDb || s.MaxDb > 0 || s.MinDb >= s.MaxDb:
+		return fmt.Errorf("dB range must satisfy %.0f <= minDb < maxDb <= 0", MinVisualizerDb)
+	case s.FPS < 0 || s.FPS > MaxVisualizerFPS:
+		return fmt.Errorf("fps must be between 0 and %d", MaxVisualizerFPS)
+	}
+	return nil
+}
+
+// BandView groups FFT magnitudes into bands and smooths them over time.
+// Each consumer with its own settings keeps its own view, since smoothing
+// depends on the frames that came before.
+type BandView struct {
+	settings VisualizerSettings
+	binBand  []int // FFT bin -> band index, -1 if outside 20Hz-20kHz
+	counts   []int // Bins per band
+	bands    []float64
+	smoothed []float64
+}
+
+// NewBandView creates a band view for an FFT of fftSize bins at sampleRate
+func NewBandView(settings VisualizerSettings, sampleRate int) *BandView {
+	n := settings.Bands
+	v := &BandView{
+		settings: settings,
+		binBand:  make([]int, fftSize/2),
+		counts:   make([]int, n),
+		bands:    make([]float64, n),
+		smoothed: make([]float64, n),
+	}
+
+	// Map FFT bins to frequency bands using logarithmic scale
+	// This gives better resolution for lower frequencies (bass/mids)
+	// which is more perceptually relevant
+	freqPerBin := float64(sampleRate) / float64(fftSize)
+	minFreq := 20.0    // 20 Hz
+	maxFreq := 20000.0 // 20 kHz (or Nyquist, whichever is lower)
+	if float64(sampleRate)/2 < maxFreq {
+		maxFreq = float64(sampleRate) / 2
+	}
+	logMin := math.Log10(minFreq)
+	logRange := math.Log10(maxFreq) - logMin
+
+	for bin := range v.binBand {
+		freq := float64(bin) * freqPerBin
+		if bin == 0 || freq < minFreq || freq > maxFreq {
+			v.binBand[bin] = -1
+			continue
+		}
+		band := int((math.Log10(freq) - logMin) / logRange * float64(n))
+		if band >= n {
+			band = n - 1
+		}
+		if band < 0 {
+			band = 0
+		}
+		v.binBand[bin] = band
+		v.counts[band]++
+	}
+
+	return v
+}
+
+// Settings returns the view's settings
+func (v *BandView) Settings() VisualizerSettings {
+	return v.settings
+}
+
+// Update folds a new magnitude spectrum (one value per FFT bin, normalized
+// to 0-1) into the view
+func (v *BandView) Update(spectrum []float64) {
+	n := len(v.bands)
+	for i := range v.bands {
+		v.bands[i] = 0
+	}
+
+	dbRange := v.settings.MaxDb - v.settings.MinDb
+	for bin, band := range v.binBand {
+		if band < 0 || bin >= len(spectrum) {
+			continue
+		}
+		// Convert to dB and normalize to 0-255 within the configured range
+		db := 20 * math.Log10(spectrum[bin]+1e-10)
+		normalized := (db - v.settings.MinDb) / dbRange * 255
+		if normalized < 0 {
+			normalized = 0
+		}
+		if normalized > 255 {
+			normalized = 255
+		}
+		v.bands[band] += normalized
+	}
+
+	// Average each band
+	for i := range v.bands {
+		if v.counts[i] > 0 {
+			v.bands[i] /= float64(v.counts[i])
+		}
+	}
+
+	// Spread energy to adjacent bands for smoother visualization
+	// This helps fill in gaps where no FFT bins map directly
+	smoothing := v.settings.Smoothing
+	for i := range v.bands {
+		spread := v.bands[i]
+		// Add 30% of adjacent bands
+		if i > 0 {
+			spread += v.bands[i-1] * 0.3
+		}
+		if i < n-1 {
+			spread += v.bands[i+1] * 0.3
+		}
+		if spread > 255 {
+			spread = 255
+		}
+
+		// Apply temporal smoothing
+		v.smoothed[i] = smoothing*v.smoothed[i] + (1-smoothing)*spread
+	}
+}
+
+// Bands returns the current band levels (0-255)
+func (v *BandView) Bands() []uint8 {
+	result := make([]uint8, len(v.smoothed))
+	for i, val := range v.smoothed {
+		if val > 255 {
+			result[i] = 255
+		} else if val < 0 {
+			result[i] = 0
+		} else {
+			result[i] = uint8(val)
+		}
+	}
+	return result
+}
+
+// Reset clears the smoothing history
+func (v *BandView) Reset() {
+	for i := range v.smoothed {
+		v.smoothed[i] = 0
+	}
+}
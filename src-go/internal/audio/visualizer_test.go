@@ -0,0 +1,55 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVisualizerSettingsValidate(t *testing.T) {
+	if err := DefaultVisualizerSettings().Validate(); err != nil {
+		t.Errorf("Expected defaults to be valid, got %v", err)
+	}
+
+	invalid := []VisualizerSettings{
+		{Bands: 0, MinDb: -60},
+		{Bands: 512, MinDb: -60},
+		{Bands: 30, Smoothing: 1, MinDb: -60},
+		{Bands: 30, MinDb: -20, MaxDb: -40},
+		{Bands: 30, MinDb: -60, FPS: 240},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", s)
+		}
+	}
+}
+
+func TestBandViewBandCount(t *testing.T) {
+	settings := DefaultVisualizerSettings()
+	settings.Bands = 30
+	settings.Smoothing = 0
+	view := NewBandView(settings, 44100)
+
+	// A full-scale tone around 1kHz lights up a band in the middle only
+	spectrum := make([]float64, fftSize/2)
+	bin := int(math.Round(1000 / (44100.0 / fftSize)))
+	spectrum[bin] = 1
+	view.Update(spectrum)
+
+	bands := view.Bands()
+	if len(bands) != 30 {
+		t.Fatalf("Expected 30 bands, got %d", len(bands))
+	}
+	loudest := 0
+	for i, b := range bands {
+		if b > bands[loudest] {
+			loudest = i
+		}
+	}
+	if bands[loudest] == 0 || loudest < 10 || loudest > 20 {
+		t.Errorf("Expected a 1kHz peak in the middle bands, got %v", bands)
+	}
+	if bands[0] != 0 || bands[29] != 0 {
+		t.Errorf("Expected silent bands at the edges, got %v", bands)
+	}
+}
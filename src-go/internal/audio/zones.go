@@ -0,0 +1,378 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LocalZone is the name of the zone for the default output device
+const LocalZone = "local"
+
+// zoneQueueChunks is how many device reads a zone's command may fall behind
+// before audio is dropped for it
+const zoneQueueChunks = 64
+
+// snapcastDialTimeout bounds connecting to a Snapcast server
+const snapcastDialTimeout = 5 * time.Second
+
+// ErrUnknownZone is returned for a zone name that isn't configured
+var ErrUnknownZone = errors.New("unknown zone")
+
+// ZoneConfig describes an additional output zone. Command is run with the
+// decoded audio (signed 16-bit little-endian, interleaved, whatever the
+// device's bit depth) on its stdin, e.g. aplay for a second sound card or
+// ffmpeg for a network stream. "{rate}" and "{channels}" in its arguments are
+// replaced with the output format.
+//
+// A zone with Snapcast set streams the same audio to a snapserver TCP source
+// in server mode (host:port) instead of running a command. Every snapclient
+// then plays in sync, so for synced multi-room playback the local zone is
+// usually disabled and a snapclient run on this machine too.
+type ZoneConfig struct {
+	Name     string
+	Command  []string
+	Snapcast string
+	Enabled  bool
+	Volume   float64
+}
+
+// ZoneInfo describes a zone's current state
+type ZoneInfo struct {
+	Name    string
+	Local   bool
+	Enabled bool
+	Volume  float64
+	Error   string // Why the zone's command stopped, if it failed
+}
+
+// zoneSink feeds one zone's command
+type zoneSink struct {
+	config  ZoneConfig
+	enabled bool
+	volume  float64
+	err     string
+	data    chan []byte // nil while the command isn't running
+	lagging bool        // True once audio has been dropped for the current run
+}
+
+// zoneSet copies the audio handed to the local device to the other zones and
+// applies the local zone's own volume. Every zone is fed from the local
+// device's reads, so they all follow its clock; a zone's command adds its
+// own buffering delay on top.
+type zoneSet struct {
+	mu           sync.Mutex
+	sampleRate   int
+	channels     int
+	format       SampleFormat // Of the device; zones always get 16-bit
+	localEnabled bool
+	localVolume  float64
+	sinks        []*zoneSink
+}
+
+func newZoneSet(sampleRate, channels int, format SampleFormat) *zoneSet {
+	return &zoneSet{
+		sampleRate:   sampleRate,
+		channels:     channels,
+		format:       format,
+		localEnabled: true,
+		localVolume:  1.0,
+	}
+}
+
+// tee sends a copy of p to every running zone, then applies the local zone's
+// volume to p
+func (z *zoneSet) tee(p []byte) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	var pcm16 []byte
+	for _, s := range z.sinks {
+		if s.data == nil {
+			continue
+		}
+		if pcm16 == nil {
+			pcm16 = z.format.toS16(p)
+		}
+		chunk := append([]byte(nil), pcm16...)
+		scalePCM16(chunk, s.volume)
+		select {
+		case s.data <- chunk:
+		default:
+			if !s.lagging {
+				s.lagging = true
+				log.Printf("[PLAYER] Zone %s can't keep up, dropping audio", s.config.Name)
+			}
+		}
+	}
+
+	if !z.localEnabled {
+		clear(p)
+	} else if z.localVolume != 1 {
+		scalePCM(p, z.format, z.localVolume)
+	}
+}
+
+// configure replaces the additional zones. Zones whose command is unchanged
+// keep running; the rest are stopped and started as their config says.
+func (z *zoneSet) configure(zones []ZoneConfig) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	old := make(map[string]*zoneSink, len(z.sinks))
+	for _, s := range z.sinks {
+		old[s.config.Name] = s
+	}
+
+	sinks := make([]*zoneSink, 0, len(zones))
+	for _, cfg := range zones {
+		s, ok := old[cfg.Name]
+		if ok && slices.Equal(s.config.Command, cfg.Command) && s.config.Snapcast == cfg.Snapcast {
+			delete(old, cfg.Name)
+		} else {
+			s = &zoneSink{}
+		}
+		s.config = cfg
+		s.volume = clampVolume(cfg.Volume)
+		sinks = append(sinks, s)
+		z.setEnabledLocked(s, cfg.Enabled)
+	}
+	for _, s := range old {
+		z.stopLocked(s)
+	}
+	z.sinks = sinks
+}
+
+// list returns the state of every zone, the local one first
+func (z *zoneSet) list() []ZoneInfo {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	zones := []ZoneInfo{{Name: LocalZone, Local: true, Enabled: z.localEnabled, Volume: z.localVolume}}
+	for _, s := range z.sinks {
+		zones = append(zones, ZoneInfo{
+			Name:    s.config.Name,
+			Enabled: s.enabled,
+			Volume:  s.volume,
+			Error:   s.err,
+		})
+	}
+	return zones
+}
+
+// enable turns a zone on or off
+func (z *zoneSet) enable(name string, enabled bool) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if name == LocalZone {
+		z.localEnabled = enabled
+		return nil
+	}
+	s := z.findLocked(name)
+	if s == nil {
+		return ErrUnknownZone
+	}
+	z.setEnabledLocked(s, enabled)
+	if enabled && !s.enabled {
+		return errors.New(s.err)
+	}
+	return nil
+}
+
+// setVolume sets a zone's volume (0.0 - 1.0)
+func (z *zoneSet) setVolume(name string, v float64) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if name == LocalZone {
+		z.localVolume = clampVolume(v)
+		return nil
+	}
+	s := z.findLocked(name)
+	if s == nil {
+		return ErrUnknownZone
+	}
+	s.volume = clampVolume(v)
+	return nil
+}
+
+// close stops every zone's command
+func (z *zoneSet) close() {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	for _, s := range z.sinks {
+		z.stopLocked(s)
+	}
+}
+
+// findLocked returns the zone called name (must be called with lock held)
+func (z *zoneSet) findLocked(name string) *zoneSink {
+	for _, s := range z.sinks {
+		if s.config.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// setEnabledLocked starts or stops a zone's command. A command that fails to
+// start leaves the zone disabled with the error recorded (must be called with
+// lock held).
+func (z *zoneSet) setEnabledLocked(s *zoneSink, enabled bool) {
+	if !enabled {
+		z.stopLocked(s)
+		s.enabled = false
+		return
+	}
+	if s.data != nil {
+		s.enabled = true
+		return
+	}
+
+	if err := z.startLocked(s); err != nil {
+		log.Printf("[PLAYER] Failed to start zone %s: %v", s.config.Name, err)
+		s.err = err.Error()
+		s.enabled = false
+		return
+	}
+	s.err = ""
+	s.enabled = true
+}
+
+// startLocked runs the zone's command or connects to its Snapcast server
+// (must be called with lock held)
+func (z *zoneSet) startLocked(s *zoneSink) error {
+	if s.config.Snapcast != "" {
+		return z.startSnapcastLocked(s)
+	}
+	if len(s.config.Command) == 0 {
+		return errors.New("no command configured")
+	}
+	args := make([]string, len(s.config.Command))
+	for i, arg := range s.config.Command {
+		arg = strings.ReplaceAll(arg, "{rate}", strconv.Itoa(z.sampleRate))
+		args[i] = strings.ReplaceAll(arg, "{channels}", strconv.Itoa(z.channels))
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("stdin pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start %s: %w", args[0], err)
+	}
+
+	z.feedLocked(s, stdin, cmd.Wait)
+	log.Printf("[PLAYER] Zone %s started: %s", s.config.Name, strings.Join(args, " "))
+	return nil
+}
+
+// startSnapcastLocked connects to the zone's snapserver TCP source (must be
+// called with lock held)
+func (z *zoneSet) startSnapcastLocked(s *zoneSink) error {
+	conn, err := net.DialTimeout("tcp", s.config.Snapcast, snapcastDialTimeout)
+	if err != nil {
+		return fmt.Errorf("connect to Snapcast: %w", err)
+	}
+
+	z.feedLocked(s, conn, func() error { return nil })
+	// The source's sampleformat has to match or every client plays garbage
+	log.Printf("[PLAYER] Zone %s streaming to Snapcast at %s (sampleformat=%d:16:%d)",
+		s.config.Name, s.config.Snapcast, z.sampleRate, z.channels)
+	return nil
+}
+
+// feedLocked starts writing the zone's audio to w (must be called with lock
+// held)
+func (z *zoneSet) feedLocked(s *zoneSink, w io.WriteCloser, wait func() error) {
+	data := make(chan []byte, zoneQueueChunks)
+	s.data = data
+	s.lagging = false
+	go z.run(s, s.config.Name, w, wait, data)
+}
+
+// run writes a zone's audio until the zone is stopped or the other end stops
+// reading, then closes w and calls wait
+func (z *zoneSet) run(s *zoneSink, name string, w io.WriteCloser, wait func() error, data chan []byte) {
+	var writeErr error
+	for chunk := range data {
+		if _, writeErr = w.Write(chunk); writeErr != nil {
+			break
+		}
+	}
+	w.Close()
+	waitErr := wait()
+	if writeErr == nil {
+		return
+	}
+
+	if waitErr != nil {
+		writeErr = waitErr
+	}
+	log.Printf("[PLAYER] Zone %s stopped: %v", name, writeErr)
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	// Only disable the zone if it hasn't been restarted in the meantime
+	if s.data == data {
+		s.data = nil
+		s.enabled = false
+		s.err = writeErr.Error()
+	}
+}
+
+// stopLocked ends the zone's command once it has written what it was sent
+// (must be called with lock held)
+func (z *zoneSet) stopLocked(s *zoneSink) {
+	if s.data != nil {
+		close(s.data)
+		s.data = nil
+	}
+}
+
+// scalePCM scales samples by factor (0.0 - 1.0)
+func scalePCM(data []byte, format SampleFormat, factor float64) {
+	if format == FormatS16 {
+		scalePCM16(data, factor)
+		return
+	}
+	if factor >= 1 {
+		return
+	}
+	for i := 0; i+format.Size() <= len(data); i += format.Size() {
+		format.putSample(data[i:], format.sample(data[i:])*factor)
+	}
+}
+
+// scalePCM16 scales 16-bit little-endian samples by factor (0.0 - 1.0)
+func scalePCM16(data []byte, factor float64) {
+	if factor >= 1 {
+		return
+	}
+	if factor <= 0 {
+		clear(data)
+		return
+	}
+	for i := 0; i < len(data)-1; i += 2 {
+		sample := int16(data[i]) | int16(data[i+1])<<8
+		out := int16(math.Round(float64(sample) * factor))
+		data[i] = byte(out)
+		data[i+1] = byte(out >> 8)
+	}
+}
+
+func clampVolume(v float64) float64 {
+	return math.Max(0, math.Min(v, 1))
+}
@@ -0,0 +1,155 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestZoneTeeAppliesZoneVolumes(t *testing.T) {
+	z := newZoneSet(44100, 2, FormatS16)
+	sink := &zoneSink{config: ZoneConfig{Name: "office"}, enabled: true, volume: 0.5, data: make(chan []byte, 1)}
+	z.sinks = []*zoneSink{sink}
+	z.localVolume = 0.25
+
+	p := []byte{0x00, 0x10, 0x00, 0xF0} // 4096, -4096
+	z.tee(p)
+
+	got := <-sink.data
+	if !bytes.Equal(got, []byte{0x00, 0x08, 0x00, 0xF8}) {
+		t.Errorf("Expected zone copy at half volume, got % X", got)
+	}
+	if !bytes.Equal(p, []byte{0x00, 0x04, 0x00, 0xFC}) {
+		t.Errorf("Expected local output at quarter volume, got % X", p)
+	}
+}
+
+func TestZoneTeeDisabledLocalIsSilent(t *testing.T) {
+	z := newZoneSet(44100, 2, FormatS16)
+	sink := &zoneSink{config: ZoneConfig{Name: "office"}, enabled: true, volume: 1, data: make(chan []byte, 1)}
+	z.sinks = []*zoneSink{sink}
+	if err := z.enable(LocalZone, false); err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+
+	p := []byte{0xFF, 0x7F, 0x00, 0x80}
+	z.tee(p)
+
+	if got := <-sink.data; !bytes.Equal(got, []byte{0xFF, 0x7F, 0x00, 0x80}) {
+		t.Errorf("Expected zone to get full audio, got % X", got)
+	}
+	if !bytes.Equal(p, []byte{0, 0, 0, 0}) {
+		t.Errorf("Expected local output silenced, got % X", p)
+	}
+}
+
+func TestZoneTeeDropsWhenBehind(t *testing.T) {
+	z := newZoneSet(44100, 2, FormatS16)
+	sink := &zoneSink{config: ZoneConfig{Name: "office"}, enabled: true, volume: 1, data: make(chan []byte, 1)}
+	z.sinks = []*zoneSink{sink}
+
+	// The second chunk has nowhere to go and must not block the device
+	z.tee([]byte{1, 0})
+	z.tee([]byte{2, 0})
+
+	if !sink.lagging {
+		t.Error("Expected zone to be marked as lagging")
+	}
+	if got := <-sink.data; got[0] != 1 {
+		t.Errorf("Expected first chunk to be kept, got % X", got)
+	}
+}
+
+func TestZoneCommandReceivesAudio(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "zone.pcm")
+	z := newZoneSet(48000, 2, FormatS16)
+	z.configure([]ZoneConfig{{
+		Name:    "file",
+		Command: []string{"sh", "-c", "echo {rate}/{channels} > " + out + ".fmt; cat > " + out},
+		Enabled: true,
+		Volume:  1,
+	}})
+
+	zones := z.list()
+	if len(zones) != 2 || zones[0].Name != LocalZone || !zones[1].Enabled {
+		t.Fatalf("Expected local zone and enabled file zone, got %+v", zones)
+	}
+
+	z.tee([]byte{1, 2, 3, 4})
+	z.close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(out)
+		if bytes.Equal(data, []byte{1, 2, 3, 4}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected command to receive the audio, got % X", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if format, _ := os.ReadFile(out + ".fmt"); string(format) != "48000/2\n" {
+		t.Errorf("Expected format placeholders to be replaced, got %q", format)
+	}
+}
+
+func TestSnapcastZoneStreamsToServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	z := newZoneSet(48000, 2, FormatS16)
+	z.configure([]ZoneConfig{{Name: "house", Snapcast: ln.Addr().String(), Enabled: true, Volume: 1}})
+	if zones := z.list(); !zones[1].Enabled {
+		t.Fatalf("Expected Snapcast zone to connect, got %+v", zones[1])
+	}
+
+	z.tee([]byte{1, 2, 3, 4})
+	z.close()
+
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, []byte{1, 2, 3, 4}) {
+			t.Errorf("Expected server to receive the audio, got % X", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the server to receive audio")
+	}
+}
+
+func TestZoneUnknownAndFailingCommands(t *testing.T) {
+	z := newZoneSet(44100, 2, FormatS16)
+	z.configure([]ZoneConfig{{Name: "broken", Command: []string{filepath.Join(t.TempDir(), "missing")}, Enabled: true, Volume: 1}})
+
+	zones := z.list()
+	if zones[1].Enabled || zones[1].Error == "" {
+		t.Errorf("Expected zone with a missing command to be disabled with an error, got %+v", zones[1])
+	}
+	if err := z.enable("broken", true); err == nil {
+		t.Error("Expected enabling a zone whose command fails to start to return an error")
+	}
+	if err := z.enable("nowhere", true); !errors.Is(err, ErrUnknownZone) {
+		t.Errorf("Expected ErrUnknownZone, got %v", err)
+	}
+	if err := z.setVolume("nowhere", 0.5); !errors.Is(err, ErrUnknownZone) {
+		t.Errorf("Expected ErrUnknownZone, got %v", err)
+	}
+}
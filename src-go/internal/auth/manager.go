@@ -8,6 +8,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
@@ -16,16 +18,31 @@ const (
 	tokenBytes      = 32 // 256-bit tokens
 	maxAuthFailures = 5
 	lockoutDuration = 60 * time.Second
+
+	// AdminClientID identifies requests made with the local admin token
+	AdminClientID = "admin"
+
+	// DefaultTokenTTL is how long a token stays valid before it must be refreshed
+	DefaultTokenTTL = 90 * 24 * time.Hour
 )
 
+// PairingCallback is called when a client pairs and is waiting for approval
+type PairingCallback func(client ClientInfo)
+
 // Manager handles client authentication
 type Manager struct {
 	store    *Store
 	testMode bool
+	tokenTTL time.Duration // 0 = tokens never expire
 
 	mu           sync.RWMutex
 	authFailures map[string]int       // IP -> failure count
 	lockouts     map[string]time.Time // IP -> lockout end time
+
+	// Local admin token (readable only by the daemon's user)
+	adminTokenHash string
+
+	onPairingRequest PairingCallback
 }
 
 // NewManager creates a new auth manager
@@ -33,15 +50,41 @@ func NewManager(store *Store, testMode bool) *Manager {
 	return &Manager{
 		store:        store,
 		testMode:     testMode,
+		tokenTTL:     DefaultTokenTTL,
 		authFailures: make(map[string]int),
 		lockouts:     make(map[string]time.Time),
 	}
 }
 
-// Pair initiates the pairing process for a client
+// SetTokenTTL sets how long newly issued tokens stay valid (0 = forever)
+func (m *Manager) SetTokenTTL(ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokenTTL = ttl
+}
+
+// newExpiry returns the expiry time for a token issued now
+func (m *Manager) newExpiry() *time.Time {
+	m.mu.RLock()
+	ttl := m.tokenTTL
+	m.mu.RUnlock()
+	if ttl <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(ttl)
+	return &expiresAt
+}
+
+// Pair initiates the pairing process for a client with full permissions
 // In test mode, pairing is auto-approved
 // Returns: token, clientID, requiresApproval, error
 func (m *Manager) Pair(clientName string) (string, string, bool, error) {
+	return m.PairWithScopes(clientName, nil)
+}
+
+// PairWithScopes pairs a client that only requests the given scopes
+// (nil requests all scopes)
+func (m *Manager) PairWithScopes(clientName string, scopes []Scope) (string, string, bool, error) {
 	// Generate client ID
 	clientID := generateClientID()
 
@@ -51,35 +94,173 @@ func (m *Manager) Pair(clientName string) (string, string, bool, error) {
 		return "", "", false, fmt.Errorf("failed to generate token: %w", err)
 	}
 
+	client := &StoredClient{
+		ID:        clientID,
+		Name:      clientName,
+		Status:    StatusPending,
+		ExpiresAt: m.newExpiry(),
+		Scopes:    scopes,
+	}
+
 	// In test mode, auto-approve
 	if m.testMode {
-		if err := m.store.AddClient(clientID, clientName, token); err != nil {
+		client.Status = StatusApproved
+		if err := m.store.AddClientRecord(client, token); err != nil {
 			return "", "", false, fmt.Errorf("failed to store client: %w", err)
 		}
 		return token, clientID, false, nil
 	}
 
+	// Store the client as pending - its token is rejected until an
+	// approved client or the local admin approves it
+	if err := m.store.AddClientRecord(client, token); err != nil {
+		return "", "", false, fmt.Errorf("failed to store client: %w", err)
+	}
+
 	// Show OS notification for pairing request
 	if err := ShowPairingNotification(clientName); err != nil {
 		// Log the error but continue - notification is not critical
 		log.Printf("[AUTH] Failed to show pairing notification: %v", err)
 	}
 
-	// Store the client (currently auto-approves after notification)
-	// Future: implement pending approval mechanism
-	if err := m.store.AddClient(clientID, clientName, token); err != nil {
-		return "", "", false, fmt.Errorf("failed to store client: %w", err)
+	m.mu.RLock()
+	callback := m.onPairingRequest
+	m.mu.RUnlock()
+	if callback != nil {
+		callback(client.info())
 	}
 
 	return token, clientID, true, nil
 }
 
+// SetOnPairingRequest sets a callback for clients that are waiting for approval
+func (m *Manager) SetOnPairingRequest(callback PairingCallback) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onPairingRequest = callback
+}
+
+// CheckToken identifies the client a token belongs to.
+// Returns ErrPendingApproval for clients that have not been approved yet,
+// ErrTokenExpired for expired tokens and ErrUnauthorized for unknown tokens.
+func (m *Manager) CheckToken(token string) (ClientInfo, error) {
+	if token == "" {
+		return ClientInfo{}, ErrUnauthorized
+	}
+
+	if m.isAdminToken(token) {
+		return ClientInfo{
+			ID:     AdminClientID,
+			Name:   "Local admin",
+			Status: StatusApproved,
+			Scopes: AllScopes,
+		}, nil
+	}
+
+	client, err := m.store.GetClientByToken(token)
+	if err != nil {
+		return ClientInfo{}, ErrUnauthorized
+	}
+	if !client.IsApproved() {
+		return ClientInfo{}, ErrPendingApproval
+	}
+	if client.IsExpired(time.Now()) {
+		return ClientInfo{}, ErrTokenExpired
+	}
+
+	return client.info(), nil
+}
+
+// RefreshToken rotates a valid token, returning a new token and its expiry.
+// The old token stops working immediately.
+func (m *Manager) RefreshToken(token string) (string, ClientInfo, error) {
+	info, err := m.CheckToken(token)
+	if err != nil {
+		return "", ClientInfo{}, err
+	}
+	if info.ID == AdminClientID {
+		return "", ClientInfo{}, fmt.Errorf("the admin token cannot be refreshed")
+	}
+
+	newToken, err := generateToken()
+	if err != nil {
+		return "", ClientInfo{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	expiresAt := m.newExpiry()
+	if err := m.store.RotateToken(info.ID, newToken, expiresAt); err != nil {
+		return "", ClientInfo{}, err
+	}
+
+	info.ExpiresAt = time.Time{}
+	if expiresAt != nil {
+		info.ExpiresAt = *expiresAt
+	}
+
+	return newToken, info, nil
+}
+
+// SetClientScopes replaces the permissions granted to a client
+func (m *Manager) SetClientScopes(clientID string, scopes []Scope) error {
+	return m.store.SetScopes(clientID, scopes)
+}
+
+// SetClientMaxVolume limits how far a client may turn the volume up,
+// 0.0 - 1.0; 0 removes the limit
+func (m *Manager) SetClientMaxVolume(clientID string, maxVolume float64) error {
+	if maxVolume < 0 || maxVolume > 1 {
+		return fmt.Errorf("max volume must be between 0.0 and 1.0")
+	}
+	if clientID == AdminClientID {
+		return fmt.Errorf("the admin token cannot be limited")
+	}
+	return m.store.SetMaxVolume(clientID, maxVolume)
+}
+
+// ApproveClient approves a pending client
+func (m *Manager) ApproveClient(clientID string) error {
+	return m.store.ApproveClient(clientID)
+}
+
+// CreateAdminToken generates a fresh admin token and writes it to path with
+// user-only permissions. Local tools that can read the file (e.g. a CLI run by
+// the same user) can use it to manage clients without pairing.
+func (m *Manager) CreateAdminToken(path string) error {
+	token, err := generateToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate admin token: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create admin token directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write admin token: %w", err)
+	}
+
+	m.mu.Lock()
+	m.adminTokenHash = HashToken(token)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *Manager) isAdminToken(token string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.adminTokenHash != "" && HashToken(token) == m.adminTokenHash
+}
+
 // ValidateToken checks if a token is valid
 func (m *Manager) ValidateToken(token string) bool {
 	if token == "" {
 		return false
 	}
 
+	if m.isAdminToken(token) {
+		return true
+	}
+
 	return m.store.ValidateToken(token)
 }
 
@@ -124,6 +305,11 @@ func (m *Manager) RevokeClient(clientID string) error {
 	return m.store.RemoveClient(clientID)
 }
 
+// GetClient returns information about a registered client
+func (m *Manager) GetClient(clientID string) (ClientInfo, error) {
+	return m.store.GetClient(clientID)
+}
+
 // ListClients returns all registered clients
 func (m *Manager) ListClients() ([]ClientInfo, error) {
 	return m.store.ListClients()
@@ -151,12 +337,33 @@ func HashToken(token string) string {
 
 // ClientInfo contains information about a registered client
 type ClientInfo struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Status    ClientStatus `json:"status"`
+	ExpiresAt time.Time    `json:"expiresAt,omitempty"` // zero = never expires
+	Scopes    []Scope      `json:"scopes"`
+	MaxVolume float64      `json:"maxVolume,omitempty"` // Loudest the client may set, 0 = no limit
+}
+
+// LimitVolume returns the volume the client gets when it asks for level
+// while the volume is at current. A client may always turn the volume down,
+// but not up past its MaxVolume.
+func (c ClientInfo) LimitVolume(level, current float64) float64 {
+	if c.MaxVolume <= 0 || level <= c.MaxVolume || level <= current {
+		return level
+	}
+	return max(c.MaxVolume, current)
+}
+
+// HasScope reports whether the client was granted scope
+func (c ClientInfo) HasScope(scope Scope) bool {
+	return hasScope(c.Scopes, scope)
 }
 
 var (
-	ErrClientNotFound = errors.New("client not found")
-	ErrUnauthorized   = errors.New("unauthorized")
+	ErrClientNotFound  = errors.New("client not found")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrPendingApproval = errors.New("pending approval")
+	ErrTokenExpired    = errors.New("token expired")
 )
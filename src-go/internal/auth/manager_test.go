@@ -3,6 +3,7 @@ package auth
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -175,3 +176,226 @@ func createTestStore(t *testing.T) *Store {
 
 	return store
 }
+
+func TestPendingClientRequiresApproval(t *testing.T) {
+	store := createTestStore(t)
+	manager := NewManager(store, false)
+
+	var notified ClientInfo
+	manager.SetOnPairingRequest(func(client ClientInfo) {
+		notified = client
+	})
+
+	token, clientID, _, err := manager.Pair("Pending Client")
+	if err != nil {
+		t.Fatalf("Pair failed: %v", err)
+	}
+
+	if notified.ID != clientID || notified.Status != StatusPending {
+		t.Errorf("Expected pairing callback for pending client %s, got %+v", clientID, notified)
+	}
+
+	if manager.ValidateToken(token) {
+		t.Error("Pending client token should not validate")
+	}
+	if _, err := manager.CheckToken(token); err != ErrPendingApproval {
+		t.Errorf("Expected ErrPendingApproval, got %v", err)
+	}
+
+	if err := manager.ApproveClient(clientID); err != nil {
+		t.Fatalf("ApproveClient failed: %v", err)
+	}
+
+	info, err := manager.CheckToken(token)
+	if err != nil {
+		t.Fatalf("Expected approved token to be accepted, got %v", err)
+	}
+	if info.ID != clientID {
+		t.Errorf("Expected client ID %s, got %s", clientID, info.ID)
+	}
+}
+
+func TestApproveUnknownClient(t *testing.T) {
+	store := createTestStore(t)
+	manager := NewManager(store, false)
+
+	if err := manager.ApproveClient("does-not-exist"); err != ErrClientNotFound {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	store := createTestStore(t)
+	manager := NewManager(store, false)
+
+	tokenPath := filepath.Join(t.TempDir(), "admin.token")
+	if err := manager.CreateAdminToken(tokenPath); err != nil {
+		t.Fatalf("CreateAdminToken failed: %v", err)
+	}
+
+	info, err := os.Stat(tokenPath)
+	if err != nil {
+		t.Fatalf("Admin token file not created: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected admin token permissions 0600, got %o", info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(tokenPath)
+	if err != nil {
+		t.Fatalf("Failed to read admin token: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+
+	client, err := manager.CheckToken(token)
+	if err != nil {
+		t.Fatalf("Expected admin token to be accepted, got %v", err)
+	}
+	if client.ID != AdminClientID {
+		t.Errorf("Expected admin client ID, got %s", client.ID)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	store := createTestStore(t)
+	manager := NewManager(store, true)
+	manager.SetTokenTTL(time.Millisecond)
+
+	token, _, _, err := manager.Pair("Short Lived")
+	if err != nil {
+		t.Fatalf("Pair failed: %v", err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if manager.ValidateToken(token) {
+		t.Error("Expired token should not validate")
+	}
+	if _, err := manager.CheckToken(token); err != ErrTokenExpired {
+		t.Errorf("Expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	store := createTestStore(t)
+	manager := NewManager(store, true)
+
+	oldToken, clientID, _, err := manager.Pair("Refreshing Client")
+	if err != nil {
+		t.Fatalf("Pair failed: %v", err)
+	}
+
+	newToken, info, err := manager.RefreshToken(oldToken)
+	if err != nil {
+		t.Fatalf("RefreshToken failed: %v", err)
+	}
+	if info.ID != clientID {
+		t.Errorf("Expected client ID %s, got %s", clientID, info.ID)
+	}
+	if info.ExpiresAt.IsZero() {
+		t.Error("Expected refreshed token to have an expiry")
+	}
+
+	if manager.ValidateToken(oldToken) {
+		t.Error("Old token should stop working after refresh")
+	}
+	if !manager.ValidateToken(newToken) {
+		t.Error("New token should be valid")
+	}
+}
+
+func TestClientScopes(t *testing.T) {
+	store := createTestStore(t)
+	manager := NewManager(store, true)
+
+	token, clientID, _, err := manager.PairWithScopes("Remote", []Scope{ScopePlayback})
+	if err != nil {
+		t.Fatalf("PairWithScopes failed: %v", err)
+	}
+
+	info, err := manager.CheckToken(token)
+	if err != nil {
+		t.Fatalf("CheckToken failed: %v", err)
+	}
+	if !info.HasScope(ScopePlayback) {
+		t.Error("Expected playback scope")
+	}
+	if info.HasScope(ScopeConfigWrite) {
+		t.Error("Did not expect config-write scope")
+	}
+	if !info.HasScope(ScopeParty) {
+		t.Error("Expected playback to include the party scope")
+	}
+	if info.HasScope(ScopeAnyPath) {
+		t.Error("Did not expect playback to include the any-path scope")
+	}
+
+	if err := manager.SetClientScopes(clientID, AllScopes); err != nil {
+		t.Fatalf("SetClientScopes failed: %v", err)
+	}
+	info, _ = manager.CheckToken(token)
+	if !info.HasScope(ScopeLibraryAdmin) {
+		t.Error("Expected library-admin scope after update")
+	}
+
+	if err := manager.SetClientScopes(clientID, []Scope{ScopeLibraryAdmin}); err != nil {
+		t.Fatalf("SetClientScopes failed: %v", err)
+	}
+	info, _ = manager.CheckToken(token)
+	if !info.HasScope(ScopeAnyPath) {
+		t.Error("Expected library-admin to include the any-path scope")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	if _, err := ParseScopes([]string{"playback", "bogus"}); err == nil {
+		t.Error("Expected error for unknown scope")
+	}
+	if _, err := ParseScopes(nil); err == nil {
+		t.Error("Expected error for empty scope list")
+	}
+	scopes, err := ParseScopes([]string{"playback", "playback", "config-write"})
+	if err != nil {
+		t.Fatalf("ParseScopes failed: %v", err)
+	}
+	if len(scopes) != 2 {
+		t.Errorf("Expected duplicates to be dropped, got %v", scopes)
+	}
+}
+
+func TestClientMaxVolume(t *testing.T) {
+	store := createTestStore(t)
+	manager := NewManager(store, true)
+
+	token, clientID, _, err := manager.Pair("Keyboard")
+	if err != nil {
+		t.Fatalf("Pair failed: %v", err)
+	}
+	if err := manager.SetClientMaxVolume(clientID, 1.5); err == nil {
+		t.Error("Expected a max volume above 1.0 to be rejected")
+	}
+	if err := manager.SetClientMaxVolume(clientID, 0.6); err != nil {
+		t.Fatalf("SetClientMaxVolume failed: %v", err)
+	}
+
+	info, _ := manager.CheckToken(token)
+	tests := []struct {
+		level, current, want float64
+	}{
+		{0.5, 0.3, 0.5}, // Under the limit
+		{0.9, 0.3, 0.6}, // Up to the limit
+		{0.9, 0.8, 0.8}, // Already past it from elsewhere; left alone
+		{0.7, 0.8, 0.7}, // Down is always allowed
+	}
+	for _, tt := range tests {
+		if got := info.LimitVolume(tt.level, tt.current); got != tt.want {
+			t.Errorf("LimitVolume(%v, %v): expected %v, got %v", tt.level, tt.current, tt.want, got)
+		}
+	}
+
+	manager.SetClientMaxVolume(clientID, 0)
+	info, _ = manager.CheckToken(token)
+	if got := info.LimitVolume(1, 0.2); got != 1 {
+		t.Errorf("Expected no limit once cleared, got %v", got)
+	}
+}
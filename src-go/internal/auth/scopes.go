@@ -0,0 +1,70 @@
+package auth
+
+import "fmt"
+
+// Scope is a permission granted to a client
+type Scope string
+
+const (
+	// ScopeParty allows reading state, appending to the queue and voting to
+	// skip, for guests at a party. ScopePlayback includes it.
+	ScopeParty Scope = "party"
+	// ScopePlayback allows controlling playback and the queue and reading state
+	ScopePlayback Scope = "playback"
+	// ScopeAnyPath allows naming files outside the library folders, e.g. to
+	// play a file opened from elsewhere. ScopeLibraryAdmin includes it.
+	ScopeAnyPath Scope = "any-path"
+	// ScopeConfigWrite allows changing the daemon configuration
+	ScopeConfigWrite Scope = "config-write"
+	// ScopeLibraryAdmin allows scanning/analysis and managing other clients
+	ScopeLibraryAdmin Scope = "library-admin"
+)
+
+// AllScopes lists every scope, in order of increasing privilege
+var AllScopes = []Scope{ScopeParty, ScopePlayback, ScopeAnyPath, ScopeConfigWrite, ScopeLibraryAdmin}
+
+// ParseScopes validates a list of scope names.
+// An empty list is rejected so a client never ends up with no permissions.
+func ParseScopes(names []string) ([]Scope, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+
+	scopes := make([]Scope, 0, len(names))
+	seen := make(map[Scope]bool, len(names))
+	for _, name := range names {
+		scope := Scope(name)
+		if !isKnownScope(scope) {
+			return nil, fmt.Errorf("unknown scope %q", name)
+		}
+		if seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+func isKnownScope(scope Scope) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// hasScope reports whether scope is in granted, or implied by a scope that
+// is. A nil list means the client predates scopes and keeps full access.
+func hasScope(granted []Scope, scope Scope) bool {
+	if granted == nil {
+		return true
+	}
+	for _, s := range granted {
+		if s == scope || (scope == ScopeParty && s == ScopePlayback) || (scope == ScopeAnyPath && s == ScopeLibraryAdmin) {
+			return true
+		}
+	}
+	return false
+}
@@ -8,12 +8,61 @@ import (
 	"time"
 )
 
+// ClientStatus is the approval state of a stored client
+type ClientStatus string
+
+const (
+	// StatusApproved clients may use the API. Clients stored before approval
+	// existed have an empty status and are treated as approved.
+	StatusApproved ClientStatus = "approved"
+	// StatusPending clients have paired but are waiting for approval
+	StatusPending ClientStatus = "pending"
+)
+
 // StoredClient represents a client stored on disk
 type StoredClient struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	TokenHash string    `json:"tokenHash"` // SHA-256 hash of token
-	CreatedAt time.Time `json:"createdAt"`
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	TokenHash string       `json:"tokenHash"` // SHA-256 hash of token
+	CreatedAt time.Time    `json:"createdAt"`
+	Status    ClientStatus `json:"status,omitempty"`
+	ExpiresAt *time.Time   `json:"expiresAt,omitempty"` // nil = never expires
+	Scopes    []Scope      `json:"scopes,omitempty"`    // nil = all scopes
+	MaxVolume float64      `json:"maxVolume,omitempty"` // 0 = no limit
+}
+
+// IsApproved reports whether the client may use the API
+func (c *StoredClient) IsApproved() bool {
+	return c.Status == "" || c.Status == StatusApproved
+}
+
+// IsExpired reports whether the client's token has expired
+func (c *StoredClient) IsExpired(now time.Time) bool {
+	return c.ExpiresAt != nil && now.After(*c.ExpiresAt)
+}
+
+// info converts the stored client into its public description
+func (c *StoredClient) info() ClientInfo {
+	status := c.Status
+	if status == "" {
+		status = StatusApproved
+	}
+	scopes := c.Scopes
+	if scopes == nil {
+		scopes = AllScopes
+	}
+	info := ClientInfo{
+		ID:        c.ID,
+		Name:      c.Name,
+		CreatedAt: c.CreatedAt,
+		Status:    status,
+		Scopes:    append([]Scope(nil), scopes...),
+		MaxVolume: c.MaxVolume,
+	}
+	if c.ExpiresAt != nil {
+		info.ExpiresAt = *c.ExpiresAt
+	}
+	return info
 }
 
 // Store persists client information to disk
@@ -41,19 +90,76 @@ func NewStore(path string) (*Store, error) {
 	return store, nil
 }
 
-// AddClient adds a new client to the store
+// AddClient adds a new, approved client with full access to the store
 func (s *Store) AddClient(clientID, name, token string) error {
+	return s.AddClientRecord(&StoredClient{ID: clientID, Name: name, Status: StatusApproved}, token)
+}
+
+// AddPendingClient adds a client that must be approved before its token is accepted
+func (s *Store) AddPendingClient(clientID, name, token string) error {
+	return s.AddClientRecord(&StoredClient{ID: clientID, Name: name, Status: StatusPending}, token)
+}
+
+// AddClientRecord adds a client with the given status, scopes and expiry.
+// The token hash and creation time are filled in by the store.
+func (s *Store) AddClientRecord(client *StoredClient, token string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	client := &StoredClient{
-		ID:        clientID,
-		Name:      name,
-		TokenHash: HashToken(token),
-		CreatedAt: time.Now(),
+	client.TokenHash = HashToken(token)
+	client.CreatedAt = time.Now()
+	if client.Scopes == nil {
+		client.Scopes = append([]Scope(nil), AllScopes...)
 	}
 
-	s.clients[clientID] = client
+	s.clients[client.ID] = client
+
+	return s.saveLocked()
+}
+
+// RotateToken replaces a client's token and expiry
+func (s *Store) RotateToken(clientID, token string, expiresAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, exists := s.clients[clientID]
+	if !exists {
+		return ErrClientNotFound
+	}
+
+	client.TokenHash = HashToken(token)
+	client.ExpiresAt = expiresAt
+
+	return s.saveLocked()
+}
+
+// SetScopes replaces the permissions granted to a client
+func (s *Store) SetScopes(clientID string, scopes []Scope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, exists := s.clients[clientID]
+	if !exists {
+		return ErrClientNotFound
+	}
+
+	client.Scopes = append([]Scope(nil), scopes...)
+
+	return s.saveLocked()
+}
+
+// SetMaxVolume sets the loudest a client may turn the volume up to, 0 for
+// no limit
+func (s *Store) SetMaxVolume(clientID string, maxVolume float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, exists := s.clients[clientID]
+	if !exists {
+		return ErrClientNotFound
+	}
+
+	client.MaxVolume = maxVolume
 
 	return s.saveLocked()
 }
@@ -72,7 +178,25 @@ func (s *Store) RemoveClient(clientID string) error {
 	return s.saveLocked()
 }
 
-// ValidateToken checks if a token is valid
+// ApproveClient marks a pending client as approved
+func (s *Store) ApproveClient(clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, exists := s.clients[clientID]
+	if !exists {
+		return ErrClientNotFound
+	}
+	if client.IsApproved() {
+		return nil
+	}
+
+	client.Status = StatusApproved
+
+	return s.saveLocked()
+}
+
+// ValidateToken checks if a token belongs to an approved client
 func (s *Store) ValidateToken(token string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -81,14 +205,14 @@ func (s *Store) ValidateToken(token string) bool {
 
 	for _, client := range s.clients {
 		if client.TokenHash == tokenHash {
-			return true
+			return client.IsApproved() && !client.IsExpired(time.Now())
 		}
 	}
 
 	return false
 }
 
-// GetClientByToken returns the client associated with a token
+// GetClientByToken returns a copy of the client associated with a token
 func (s *Store) GetClientByToken(token string) (*StoredClient, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -97,13 +221,26 @@ func (s *Store) GetClientByToken(token string) (*StoredClient, error) {
 
 	for _, client := range s.clients {
 		if client.TokenHash == tokenHash {
-			return client, nil
+			c := *client
+			return &c, nil
 		}
 	}
 
 	return nil, ErrClientNotFound
 }
 
+// GetClient returns the description of a single client
+func (s *Store) GetClient(clientID string) (ClientInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, exists := s.clients[clientID]
+	if !exists {
+		return ClientInfo{}, ErrClientNotFound
+	}
+	return client.info(), nil
+}
+
 // ListClients returns all registered clients
 func (s *Store) ListClients() ([]ClientInfo, error) {
 	s.mu.RLock()
@@ -111,11 +248,7 @@ func (s *Store) ListClients() ([]ClientInfo, error) {
 
 	clients := make([]ClientInfo, 0, len(s.clients))
 	for _, client := range s.clients {
-		clients = append(clients, ClientInfo{
-			ID:        client.ID,
-			Name:      client.Name,
-			CreatedAt: client.CreatedAt,
-		})
+		clients = append(clients, client.info())
 	}
 
 	return clients, nil
@@ -201,3 +201,44 @@ func createTestStoreForStore(t *testing.T) *Store {
 
 	return store
 }
+
+func TestLegacyClientWithoutStatusIsApproved(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	storePath := filepath.Join(tmpDir, "clients.json")
+	legacy := `{"clients":[{"id":"old","name":"Old Client","tokenHash":"` + HashToken("legacy-token") + `","createdAt":"2024-01-01T00:00:00Z"}]}`
+	if err := os.WriteFile(storePath, []byte(legacy), 0600); err != nil {
+		t.Fatalf("Failed to write legacy store: %v", err)
+	}
+
+	store, err := NewStore(storePath)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+
+	if !store.ValidateToken("legacy-token") {
+		t.Error("Clients stored before approval existed should remain valid")
+	}
+}
+
+func TestPendingClientApproval(t *testing.T) {
+	store := createTestStoreForStore(t)
+
+	if err := store.AddPendingClient("client1", "Pending", "pending-token"); err != nil {
+		t.Fatalf("AddPendingClient failed: %v", err)
+	}
+	if store.ValidateToken("pending-token") {
+		t.Error("Pending client token should not validate")
+	}
+
+	if err := store.ApproveClient("client1"); err != nil {
+		t.Fatalf("ApproveClient failed: %v", err)
+	}
+	if !store.ValidateToken("pending-token") {
+		t.Error("Approved client token should validate")
+	}
+}
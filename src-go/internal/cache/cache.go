@@ -0,0 +1,301 @@
+// Package cache keeps local copies of tracks from slow storage so they can be
+// played without reading from the network share.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/filelock"
+)
+
+// entry is a cached copy of a track
+type entry struct {
+	file     string // Path of the local copy
+	size     int64
+	modTime  time.Time // Modification time of the original when copied
+	lastUsed time.Time
+}
+
+// Cache is a size-limited set of local track copies. Each cache keeps its
+// copies in a directory of its own, so a daemon taking over from another
+// never removes copies the other is still playing, and they do not survive a
+// restart. It is safe for concurrent use.
+type Cache struct {
+	dir  string   // This cache's run directory
+	lock *os.File // Held locked while the cache is in use
+
+	mu       sync.Mutex
+	maxBytes int64
+	entries  map[string]*entry // Original path -> copy
+	copying  map[string]chan struct{}
+}
+
+// lockName is the file in a run directory that its cache holds locked
+const lockName = ".lock"
+
+// staleRunAge is how long a run directory without a lock file must go
+// unchanged before a new cache takes it for one left behind by a daemon that
+// crashed. Runs are only briefly without one, while their cache starts.
+const staleRunAge = 24 * time.Hour
+
+// New creates a cache in a new run directory under dir, removing run
+// directories left behind by daemons that are no longer running
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	removeStaleRuns(dir)
+	run, err := os.MkdirTemp(dir, "run-")
+	if err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	lock, err := os.OpenFile(filepath.Join(run, lockName), os.O_RDWR|os.O_CREATE, 0600)
+	if err == nil {
+		if err = filelock.TryLock(lock); err != nil {
+			lock.Close()
+		}
+	}
+	if err != nil {
+		os.RemoveAll(run)
+		return nil, fmt.Errorf("lock cache dir: %w", err)
+	}
+	return &Cache{
+		dir:      run,
+		lock:     lock,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*entry),
+		copying:  make(map[string]chan struct{}),
+	}, nil
+}
+
+// DefaultDir returns the cache directory in the user's cache directory, or
+// under the system temp directory in a folder of the user's own
+func DefaultDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "musicd", "tracks")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("musicd-%d", os.Getuid()), "tracks")
+}
+
+// removeStaleRuns removes the run directories in dir that no cache is using
+func removeStaleRuns(dir string) {
+	runs, _ := filepath.Glob(filepath.Join(dir, "run-*"))
+	for _, run := range runs {
+		if !runInUse(run) {
+			os.RemoveAll(run)
+		}
+	}
+}
+
+// runInUse reports whether a cache may still be using run: its lock is held,
+// however long the daemon has been quiet, or it has no lock yet and changed
+// within staleRunAge
+func runInUse(run string) bool {
+	lock, err := os.OpenFile(filepath.Join(run, lockName), os.O_RDWR, 0600)
+	if err != nil {
+		info, err := os.Stat(run)
+		return err != nil || time.Since(info.ModTime()) <= staleRunAge
+	}
+	defer lock.Close()
+	return filelock.TryLock(lock) != nil
+}
+
+// SetMaxBytes changes the size limit, evicting copies that no longer fit. A
+// limit of 0 disables the cache.
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	c.evictLocked()
+}
+
+// Resolve returns the local copy of path, or path itself if it isn't cached
+func (c *Cache) Resolve(path string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[path]
+	if !ok {
+		return path
+	}
+	// The system may have cleaned up the temp directory
+	if _, err := os.Stat(e.file); err != nil {
+		delete(c.entries, path)
+		return path
+	}
+	e.lastUsed = time.Now()
+	return e.file
+}
+
+// Has reports whether path has a local copy
+func (c *Cache) Has(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[path]
+	return ok
+}
+
+// Stats returns the number of cached tracks and their total size
+func (c *Cache) Stats() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries), c.totalLocked()
+}
+
+// Add copies path into the cache. A copy that is still current is kept, and
+// a copy already in progress is waited for rather than started again.
+func (c *Cache) Add(ctx context.Context, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a file", path)
+	}
+
+	c.mu.Lock()
+	if c.maxBytes <= 0 {
+		c.mu.Unlock()
+		return fmt.Errorf("track cache is disabled")
+	}
+	if info.Size() > c.maxBytes {
+		c.mu.Unlock()
+		return fmt.Errorf("track is larger than the cache")
+	}
+	if e, ok := c.entries[path]; ok && e.size == info.Size() && e.modTime.Equal(info.ModTime()) {
+		c.mu.Unlock()
+		return nil
+	}
+	if wait, ok := c.copying[path]; ok {
+		c.mu.Unlock()
+		select {
+		case <-wait:
+			if !c.Has(path) {
+				return fmt.Errorf("copy of %s failed", path)
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	done := make(chan struct{})
+	c.copying[path] = done
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.copying, path)
+		c.mu.Unlock()
+		close(done)
+	}()
+
+	sum := sha256.Sum256([]byte(path))
+	file := filepath.Join(c.dir, hex.EncodeToString(sum[:])[:16]+filepath.Ext(path))
+	size, err := copyFile(ctx, path, file)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[path] = &entry{file: file, size: size, modTime: info.ModTime(), lastUsed: time.Now()}
+	c.evictLocked()
+	return nil
+}
+
+// Clear removes every cached copy, along with the cache's run directory
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+	// Windows can't remove a file that is open
+	c.lock.Close()
+	os.RemoveAll(c.dir)
+}
+
+func (c *Cache) totalLocked() int64 {
+	var total int64
+	for _, e := range c.entries {
+		total += e.size
+	}
+	return total
+}
+
+// evictLocked removes the least recently used copies until the cache fits its
+// limit (must be called with lock held)
+func (c *Cache) evictLocked() {
+	total := c.totalLocked()
+	if total <= c.maxBytes {
+		return
+	}
+
+	paths := make([]string, 0, len(c.entries))
+	for path := range c.entries {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return c.entries[paths[i]].lastUsed.Before(c.entries[paths[j]].lastUsed)
+	})
+
+	for _, path := range paths {
+		if total <= c.maxBytes {
+			break
+		}
+		e := c.entries[path]
+		os.Remove(e.file)
+		delete(c.entries, path)
+		total -= e.size
+	}
+}
+
+// copyFile copies src to dst through a temporary file so a cancelled copy
+// never leaves a partial track behind
+func copyFile(ctx context.Context, src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".copy-*")
+	if err != nil {
+		return 0, fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, &contextReader{ctx: ctx, r: in})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("copy %s: %w", src, err)
+	}
+
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return 0, fmt.Errorf("rename: %w", err)
+	}
+	return n, nil
+}
+
+// contextReader stops a copy once its context is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
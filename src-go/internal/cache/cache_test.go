@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTestCache(t *testing.T, maxBytes int64) (*Cache, string) {
+	tmpDir, err := os.MkdirTemp("", "cache_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	c, err := New(filepath.Join(tmpDir, "cache"), maxBytes)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return c, tmpDir
+}
+
+func writeTrack(t *testing.T, dir, name string, size int) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0600); err != nil {
+		t.Fatalf("Failed to write track: %v", err)
+	}
+	return path
+}
+
+func TestAddAndResolve(t *testing.T) {
+	c, dir := createTestCache(t, 1000)
+	track := writeTrack(t, dir, "song.flac", 100)
+
+	if got := c.Resolve(track); got != track {
+		t.Errorf("Expected uncached track to resolve to itself, got %s", got)
+	}
+
+	if err := c.Add(context.Background(), track); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	local := c.Resolve(track)
+	if local == track || filepath.Ext(local) != ".flac" {
+		t.Errorf("Expected a .flac copy in the cache, got %s", local)
+	}
+	if data, err := os.ReadFile(local); err != nil || len(data) != 100 {
+		t.Errorf("Expected a 100 byte copy, got %d bytes (%v)", len(data), err)
+	}
+
+	// A copy that disappeared falls back to the original
+	os.Remove(local)
+	if got := c.Resolve(track); got != track {
+		t.Errorf("Expected missing copy to resolve to the original, got %s", got)
+	}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c, dir := createTestCache(t, 250)
+	a := writeTrack(t, dir, "a.mp3", 100)
+	b := writeTrack(t, dir, "b.mp3", 100)
+	d := writeTrack(t, dir, "d.mp3", 100)
+
+	for _, track := range []string{a, b} {
+		if err := c.Add(context.Background(), track); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Resolve(a)
+	if err := c.Add(context.Background(), d); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	if !c.Has(a) || c.Has(b) || !c.Has(d) {
+		t.Errorf("Expected b to be evicted, has a=%v b=%v d=%v", c.Has(a), c.Has(b), c.Has(d))
+	}
+	if files, size := c.Stats(); files != 2 || size != 200 {
+		t.Errorf("Expected 2 files of 200 bytes, got %d files of %d bytes", files, size)
+	}
+}
+
+func TestAddRejectsWhenDisabledOrTooLarge(t *testing.T) {
+	c, dir := createTestCache(t, 50)
+	track := writeTrack(t, dir, "long.flac", 100)
+
+	if err := c.Add(context.Background(), track); err == nil {
+		t.Error("Expected a track larger than the cache to be rejected")
+	}
+
+	c.SetMaxBytes(0)
+	small := writeTrack(t, dir, "short.flac", 10)
+	if err := c.Add(context.Background(), small); err == nil {
+		t.Error("Expected Add to fail with the cache disabled")
+	}
+}
+
+func TestCachesShareDirWithoutClearingEachOther(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "run-crashed")
+	if err := os.Mkdir(stale, 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleRunAge)
+	os.Chtimes(stale, old, old)
+
+	first, err := New(dir, 1000)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	track := writeTrack(t, t.TempDir(), "song.flac", 100)
+	if err := first.Add(context.Background(), track); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// A daemon taking over starts its own cache in the same place
+	second, err := New(dir, 1000)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, err := os.Stat(first.Resolve(track)); err != nil || first.Resolve(track) == track {
+		t.Errorf("Expected the first cache's copy to survive the second starting, got %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Expected the run left by a crashed daemon to be removed")
+	}
+
+	first.Clear()
+	if _, err := os.Stat(second.dir); err != nil {
+		t.Errorf("Expected clearing one cache to leave the other, got %v", err)
+	}
+}
+
+func TestQuietCacheKeptWhileInUse(t *testing.T) {
+	dir := t.TempDir()
+	quiet, err := New(dir, 1000)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	// A daemon that hasn't cached anything in days is still running
+	old := time.Now().Add(-2 * staleRunAge)
+	os.Chtimes(quiet.dir, old, old)
+
+	// One that crashed left its lock file, but nobody holds the lock
+	crashed := filepath.Join(dir, "run-crashed")
+	os.Mkdir(crashed, 0700)
+	os.WriteFile(filepath.Join(crashed, lockName), nil, 0600)
+
+	// One that is just starting hasn't locked its run yet
+	starting := filepath.Join(dir, "run-starting")
+	os.Mkdir(starting, 0700)
+
+	if _, err := New(dir, 1000); err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, err := os.Stat(quiet.dir); err != nil {
+		t.Errorf("Expected the quiet cache's run kept, got %v", err)
+	}
+	if _, err := os.Stat(crashed); !os.IsNotExist(err) {
+		t.Error("Expected the crashed daemon's run removed")
+	}
+	if _, err := os.Stat(starting); err != nil {
+		t.Errorf("Expected the starting cache's run kept, got %v", err)
+	}
+
+	// Once the quiet daemon exits its run can go
+	quiet.lock.Close()
+	if _, err := New(dir, 1000); err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, err := os.Stat(quiet.dir); !os.IsNotExist(err) {
+		t.Error("Expected the run removed once its cache is gone")
+	}
+}
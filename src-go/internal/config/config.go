@@ -2,17 +2,31 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+	"github.com/austinkregel/local-media/musicd/internal/hotkey"
 )
 
 // Config represents the daemon configuration
 type Config struct {
+	// Version is the schema version, used to migrate older files
+	Version int `json:"version"`
+
 	// LibraryPaths is a list of directories containing music files
 	LibraryPaths []string `json:"libraryPaths"`
 
+	// LibraryScan holds scan options for library paths, keyed by path
+	LibraryScan map[string]ScanOptions `json:"libraryScan,omitempty"`
+
 	// DataDir is where to store data files (analysis, cache, etc.)
 	DataDir string `json:"dataDir"`
 
@@ -21,6 +35,97 @@ type Config struct {
 
 	// Behavior settings
 	Behavior BehaviorConfig `json:"behavior"`
+
+	// Auth settings
+	Auth AuthConfig `json:"auth"`
+
+	// Logging settings
+	Logging LoggingConfig `json:"logging"`
+
+	// Metrics settings
+	Metrics MetricsConfig `json:"metrics"`
+
+	// Track identification settings
+	Identify IdentifyConfig `json:"identify"`
+
+	// Network share settings
+	Network NetworkConfig `json:"network"`
+
+	// Library scan performance settings
+	Scanner ScannerConfig `json:"scanner"`
+
+	// Favorite internet radio stations
+	Stations []StationConfig `json:"stations"`
+
+	// Named playback profiles, switched to with setProfile or at the time of
+	// day they start
+	Profiles []ProfileConfig `json:"profiles"`
+
+	// Podcast settings
+	Podcasts PodcastConfig `json:"podcasts"`
+
+	// Conversion of tracks streamed to renderers
+	Transcode TranscodeConfig `json:"transcode"`
+
+	// Desktop notification settings
+	Notifications NotificationsConfig `json:"notifications"`
+
+	// Global hotkey settings
+	Hotkeys HotkeysConfig `json:"hotkeys"`
+
+	// Home automation over MQTT
+	MQTT MQTTConfig `json:"mqtt"`
+
+	// Now playing output for stream overlays
+	Overlay OverlayConfig `json:"overlay"`
+
+	// Memory use limits
+	Memory MemoryConfig `json:"memory"`
+
+	// Guests with the party scope
+	Party PartyConfig `json:"party"`
+}
+
+// DataPath returns DataDir, or ~/.local-media if none is set
+func (c *Config) DataPath() string {
+	if c.DataDir != "" {
+		return c.DataDir
+	}
+	homeDir, _ := os.UserHomeDir()
+	return homeDir + "/.local-media"
+}
+
+// Redacted returns a copy of c with credentials blanked, fit to attach to a
+// bug report
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.Identify.AcoustIDKey = ""
+	redacted.MQTT.Password = ""
+	return &redacted
+}
+
+// ScanOptions narrows what a scan of one library path picks up
+type ScanOptions struct {
+	// Exclude - glob patterns of files and folders to skip, relative to the
+	// library path with "/" separators; "**" matches any number of folders,
+	// e.g. "**/Audiobooks/**" or "Samples/*.wav"
+	Exclude []string `json:"exclude,omitempty"`
+
+	// MinDurationMs - skip tracks shorter than this; 0 keeps everything
+	MinDurationMs int64 `json:"minDurationMs,omitempty"`
+
+	// FollowSymlinks - descend into symlinked folders, which are skipped by
+	// default
+	FollowSymlinks bool `json:"followSymlinks,omitempty"`
+
+	// MaxDepth - folder levels to scan; 1 scans only the files directly in
+	// the library path, 0 has no limit
+	MaxDepth int `json:"maxDepth,omitempty"`
+}
+
+// ScanOptionsFor returns the scan options of a library path
+func (c *Config) ScanOptionsFor(path string) ScanOptions {
+	return c.LibraryScan[path]
 }
 
 // AudioConfig contains audio-related settings
@@ -31,8 +136,117 @@ type AudioConfig struct {
 	// BufferSize in milliseconds (default: 100)
 	BufferSizeMs int `json:"bufferSizeMs"`
 
+	// BitDepth of the output, 16 or 24; 24 plays through 32-bit float (default: 16)
+	BitDepth int `json:"bitDepth"`
+
+	// Resampler converting tracks to SampleRate: "fast", "standard", "high"
+	// or "soxr", which needs an FFmpeg built with libsoxr (default: "standard")
+	Resampler string `json:"resampler"`
+
+	// StallTimeoutMs is how long the decoder may go without producing audio
+	// before it is restarted where it stopped, 0 to disable (default: 10000)
+	StallTimeoutMs int `json:"stallTimeoutMs"`
+
 	// Volume level 0.0 - 1.0 (default: 1.0)
 	DefaultVolume float64 `json:"defaultVolume"`
+
+	// VolumeCurve is how volume levels map onto loudness: "linear" scales
+	// the samples by the level, "logarithmic" steps evenly in decibels so
+	// volume keys sound even across the range (default: "linear")
+	VolumeCurve string `json:"volumeCurve"`
+
+	// FadeMs is the fade applied on pause/stop and resume/play, 0 to disable (default: 150)
+	FadeMs int `json:"fadeMs"`
+
+	// Mono - whether both channels are mixed together on each side of the device (default: false)
+	Mono bool `json:"mono"`
+
+	// Balance from -1.0 (left only) to 1.0 (right only) (default: 0)
+	Balance float64 `json:"balance"`
+
+	// SwapChannels - whether the left and right channels are exchanged (default: false)
+	SwapChannels bool `json:"swapChannels"`
+
+	// LevelVolume - whether tracks are brought to TargetLufs, measuring
+	// upcoming queue tracks ahead of time (default: false)
+	LevelVolume bool `json:"levelVolume"`
+
+	// TargetLufs is the loudness tracks are levelled to (default: -18)
+	TargetLufs float64 `json:"targetLufs"`
+
+	// DuckLevel is the share of the volume music drops to under an
+	// announcement or other audio, 0.0 - 1.0 (default: 0.2)
+	DuckLevel float64 `json:"duckLevel"`
+
+	// AutoDuck - whether music is ducked while another application plays
+	// audio, where the platform reports it (PulseAudio or PipeWire) (default: false)
+	AutoDuck bool `json:"autoDuck"`
+
+	// PauseOnDeviceLoss - whether playback pauses when the output device
+	// goes away, e.g. headphones unplugged or Bluetooth dropping out, rather
+	// than carrying on through whatever the system falls back to, where
+	// the platform reports it (PulseAudio or PipeWire) (default: true)
+	PauseOnDeviceLoss bool `json:"pauseOnDeviceLoss"`
+
+	// ResumeOnDeviceReturn - whether playback paused by a lost device
+	// resumes when the device comes back (default: true)
+	ResumeOnDeviceReturn bool `json:"resumeOnDeviceReturn"`
+
+	// PreviewVolume is the volume of the channel tracks are pre-listened on
+	// alongside the main playback, 0.0 - 1.0 (default: 0.3)
+	PreviewVolume float64 `json:"previewVolume"`
+
+	// Zones are additional outputs that play alongside the default device
+	Zones []ZoneConfig `json:"zones"`
+
+	// DSP is the chain of effects the audio passes through before the
+	// output, in order
+	DSP []DSPStageConfig `json:"dsp"`
+}
+
+// DSPStageConfig places a built-in effect in the DSP chain
+type DSPStageConfig struct {
+	// Name is the stage: "eq", "replaygain", "mono", "widener" or "limiter"
+	Name string `json:"name"`
+
+	// Enabled - whether the stage is applied; disabled stages keep their place
+	Enabled bool `json:"enabled"`
+
+	// Params are the stage's settings, e.g. {"1k": -3, "8k": 2} for "eq";
+	// unset ones take the stage's defaults
+	Params map[string]float64 `json:"params,omitempty"`
+}
+
+// ZoneConfig describes an output zone fed by an external command or a
+// Snapcast server
+type ZoneConfig struct {
+	// Name identifies the zone in listZones, enableZone and setZoneVolume
+	Name string `json:"name"`
+
+	// Command is run with signed 16-bit little-endian PCM on its stdin;
+	// "{rate}" and "{channels}" in its arguments are replaced with the output
+	// format, e.g. ["aplay", "-D", "hw:1", "-f", "S16_LE", "-r", "{rate}", "-c", "{channels}"]
+	Command []string `json:"command"`
+
+	// Snapcast is the host:port of a snapserver TCP source in server mode to
+	// stream to instead of running a command, e.g. with the source
+	// "tcp://0.0.0.0:4953?name=musicd&mode=server&sampleformat=44100:16:2"
+	// whose sampleformat matches the output sample rate
+	Snapcast string `json:"snapcast,omitempty"`
+
+	// Enabled - whether the zone plays when the daemon starts
+	Enabled bool `json:"enabled"`
+
+	// Volume level 0.0 - 1.0, applied on top of the playback volume (default: 1.0)
+	Volume *float64 `json:"volume,omitempty"`
+}
+
+// VolumeLevel returns the zone's volume, 1.0 if none is set
+func (z ZoneConfig) VolumeLevel() float64 {
+	if z.Volume == nil {
+		return 1.0
+	}
+	return *z.Volume
 }
 
 // BehaviorConfig contains behavior-related settings
@@ -45,21 +259,478 @@ type BehaviorConfig struct {
 
 	// RememberPosition - remember playback position
 	RememberPosition bool `json:"rememberPosition"`
+
+	// ResumeThresholdMinutes - tracks at least this long resume from their
+	// last position when played again (default: 20)
+	ResumeThresholdMinutes int `json:"resumeThresholdMinutes"`
+
+	// ResumePlayback - whether ResumeOnStart restores the last track
+	// "paused" (default) or starts "playing" it immediately
+	ResumePlayback string `json:"resumePlayback"`
+
+	// TrimSilence - skip silence at the start and end of analyzed tracks
+	TrimSilence bool `json:"trimSilence"`
+
+	// SilenceThresholdDb - level in dBFS below which audio counts as
+	// silence, measured in 5 dB steps (default: -60)
+	SilenceThresholdDb int `json:"silenceThresholdDb"`
+
+	// TrackEndingSeconds - how long before the end of a track clients are
+	// told what plays next, 0 to disable (default: 10)
+	TrackEndingSeconds int `json:"trackEndingSeconds"`
+
+	// IdleTimeoutMinutes - exit after this long with no clients connected,
+	// nothing playing, no scan, analysis or download running and no
+	// schedule enabled, 0 to keep running (default: 0). Pair it with socket
+	// activation so the next client starts the daemon again.
+	IdleTimeoutMinutes int `json:"idleTimeoutMinutes"`
+
+	// OnPlaybackError - what auto-advance does with a track that fails to
+	// play: "skip" it (default), "retry" it once before skipping, or "stop"
+	OnPlaybackError string `json:"onPlaybackError"`
+
+	// DiscoveryShuffle - have smart shuffle favor tracks that were never
+	// played while listening is stuck in a rut (default: false)
+	DiscoveryShuffle bool `json:"discoveryShuffle"`
+}
+
+// AuthConfig contains client authentication settings
+type AuthConfig struct {
+	// TokenTTLHours - how long a client token is valid before it must be
+	// refreshed; 0 disables expiry (default: 2160, i.e. 90 days)
+	TokenTTLHours int `json:"tokenTtlHours"`
+
+	// Sandbox - keep play, queue and scans to the library folders and
+	// musicd's own caches, for every client, following symlinks to check
+	// where they lead; library folders can then only be added by editing
+	// this file (default: false)
+	Sandbox bool `json:"sandbox"`
+
+	// StreamHosts - hosts that stream URLs may be played from in sandbox
+	// mode, e.g. "radio.example.com"; streams from anywhere else are refused
+	// (default: none)
+	StreamHosts []string `json:"streamHosts,omitempty"`
+}
+
+// LoggingConfig contains daemon log settings
+type LoggingConfig struct {
+	// Level - minimum level written: "debug", "info" (default), "warn", "error"
+	Level string `json:"level"`
+
+	// MaxSizeMB - rotate the log file once it reaches this size (default: 5)
+	MaxSizeMB int `json:"maxSizeMb"`
+
+	// MaxFiles - number of rotated log files to keep (default: 3)
+	MaxFiles int `json:"maxFiles"`
+}
+
+// MetricsConfig contains runtime metrics settings
+type MetricsConfig struct {
+	// ListenAddr - address for the Prometheus /metrics and /healthz HTTP
+	// endpoint, e.g. "127.0.0.1:9099"; empty disables it (default)
+	ListenAddr string `json:"listenAddr"`
+}
+
+// IdentifyConfig contains acoustic fingerprint lookup settings
+type IdentifyConfig struct {
+	// AcoustIDKey - application API key from https://acoustid.org/new-application;
+	// empty disables identifyTrack (default)
+	AcoustIDKey string `json:"acoustidKey"`
+}
+
+// NetworkConfig contains buffering settings for tracks on network mounts
+// (SMB/NFS), where reads can stall for longer than the output buffer lasts
+type NetworkConfig struct {
+	// PreBufferMs - decoded audio to buffer before playback starts (default: 2000)
+	PreBufferMs int `json:"preBufferMs"`
+
+	// ReadAheadMs - decoded audio to keep ahead of playback; 0 disables
+	// buffering (default: 30000)
+	ReadAheadMs int `json:"readAheadMs"`
+
+	// CacheMaxMB - size limit of the local copies made by cacheTrack; 0
+	// disables the cache (default: 1024)
+	CacheMaxMB int `json:"cacheMaxMb"`
+}
+
+// ScannerConfig contains library scan performance settings
+type ScannerConfig struct {
+	// Workers - folders listed and files probed at once while nothing is
+	// playing; 0 uses one per CPU (default: 0). Scans drop to a single
+	// worker during playback.
+	Workers int `json:"workers"`
+
+	// NiceLevel - CPU priority ffprobe runs at, from 0 (normal) to 19
+	// (lowest) (default: 19)
+	NiceLevel int `json:"niceLevel"`
+
+	// ProbeTimeoutMs - how long ffprobe may spend reading one file before
+	// the file is treated as unreadable (default: 5000)
+	ProbeTimeoutMs int `json:"probeTimeoutMs"`
+}
+
+// PodcastConfig contains podcast subscription settings
+type PodcastConfig struct {
+	// RefreshMinutes - how often subscribed feeds are checked for new
+	// episodes; 0 only refreshes on request (default: 60)
+	RefreshMinutes int `json:"refreshMinutes"`
+}
+
+// NotificationsConfig contains desktop notification settings, for running
+// musicd without a client in view
+type NotificationsConfig struct {
+	// Enabled - post a notification with the title, artist and album art
+	// when the track changes (default: false)
+	Enabled bool `json:"enabled"`
+
+	// Linux - notify through org.freedesktop.Notifications on Linux (default: true)
+	Linux bool `json:"linux"`
+
+	// MacOS - notify through the notification center on macOS (default: true)
+	MacOS bool `json:"macos"`
+
+	// TimeoutMs - how long a notification stays up on Linux; 0 leaves it to
+	// the notification server (default: 0)
+	TimeoutMs int `json:"timeoutMs"`
+}
+
+// EnabledOn reports whether notifications are posted on goos, as named by
+// runtime.GOOS
+func (n NotificationsConfig) EnabledOn(goos string) bool {
+	switch goos {
+	case "linux":
+		return n.Enabled && n.Linux
+	case "darwin":
+		return n.Enabled && n.MacOS
+	}
+	return false
+}
+
+// HotkeysConfig contains global hotkeys the daemon listens for itself, for
+// desktops where media keys don't reach it. Combos are written like
+// "Ctrl+Alt+P", with at least one of Ctrl, Alt, Shift and Super; an empty
+// combo leaves the action unbound.
+type HotkeysConfig struct {
+	// Enabled - listen for the hotkeys; on Linux they are bound through the
+	// desktop's GlobalShortcuts portal (default: false)
+	Enabled bool `json:"enabled"`
+
+	// PlayPause - toggle playback (default: "Ctrl+Alt+P")
+	PlayPause string `json:"playPause"`
+
+	// Next - skip to the next track (default: "Ctrl+Alt+Right")
+	Next string `json:"next"`
+
+	// Previous - go back to the previous track (default: "Ctrl+Alt+Left")
+	Previous string `json:"previous"`
+
+	// VolumeUp - raise the volume by 5% (default: "Ctrl+Alt+Up")
+	VolumeUp string `json:"volumeUp"`
+
+	// VolumeDown - lower the volume by 5% (default: "Ctrl+Alt+Down")
+	VolumeDown string `json:"volumeDown"`
+}
+
+// Bindings returns the combos that are set, by action
+func (h HotkeysConfig) Bindings() map[hotkey.Action]string {
+	bindings := make(map[hotkey.Action]string)
+	for action, combo := range map[hotkey.Action]string{
+		hotkey.ActionPlayPause:  h.PlayPause,
+		hotkey.ActionNext:       h.Next,
+		hotkey.ActionPrevious:   h.Previous,
+		hotkey.ActionVolumeUp:   h.VolumeUp,
+		hotkey.ActionVolumeDown: h.VolumeDown,
+	} {
+		if combo != "" {
+			bindings[action] = combo
+		}
+	}
+	return bindings
+}
+
+// MQTTConfig contains settings for publishing player state to an MQTT
+// broker and taking play, pause, next and volume commands back from it, for
+// home automation such as Home Assistant
+type MQTTConfig struct {
+	// Enabled - connect to the broker (default: false)
+	Enabled bool `json:"enabled"`
+
+	// Broker - the broker's "host:port" (default: "localhost:1883")
+	Broker string `json:"broker"`
+
+	// TLS - connect to the broker over TLS (default: false)
+	TLS bool `json:"tls"`
+
+	// Username and Password - broker credentials; empty to connect without
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// TopicPrefix - state and commands use topics under
+	// "<topicPrefix>/<nodeId>" (default: "musicd")
+	TopicPrefix string `json:"topicPrefix"`
+
+	// NodeID - names this player in topics and to Home Assistant, of
+	// letters, digits, "_" and "-"; empty for the host name
+	NodeID string `json:"nodeId,omitempty"`
+
+	// Discovery - publish Home Assistant discovery topics so the player's
+	// entities appear without setting them up by hand (default: true)
+	Discovery bool `json:"discovery"`
+
+	// DiscoveryPrefix - the topic prefix Home Assistant watches for
+	// discovery (default: "homeassistant")
+	DiscoveryPrefix string `json:"discoveryPrefix"`
+}
+
+// OverlayConfig contains settings for showing the current track on a
+// stream, through a file for an OBS text source or an HTML page for a
+// browser source
+type OverlayConfig struct {
+	// File - absolute path of a file rewritten whenever the track changes;
+	// empty writes none (default: "")
+	File string `json:"file"`
+
+	// Format - "text" for the template below or "json" for every field
+	// (default: "text")
+	Format string `json:"format"`
+
+	// Template - the text written, with {title}, {artist}, {album} and
+	// {state} filled in (default: "{artist} - {title}")
+	Template string `json:"template"`
+
+	// ListenAddr - address to serve the HTML overlay on at /overlay, e.g.
+	// "127.0.0.1:9098"; empty disables it (default: "")
+	ListenAddr string `json:"listenAddr"`
+
+	// Theme - "dark", "light" or "transparent"; the page's ?theme= query
+	// picks another (default: "dark")
+	Theme string `json:"theme"`
+
+	// CSSFile - a stylesheet added to the overlay after the theme, for
+	// styling it further (default: "")
+	CSSFile string `json:"cssFile,omitempty"`
+}
+
+// MemoryConfig contains memory use settings, for large libraries on machines
+// with little memory
+type MemoryConfig struct {
+	// BudgetMB - soft limit on the daemon's memory use; the garbage collector
+	// runs more often as it is approached. 0 for no limit (default: 0)
+	BudgetMB int `json:"budgetMb"`
+
+	// CacheMB - memory kept for data loaded from disk when needed, such as
+	// lists of similar tracks. The least recently used data is dropped
+	// first (default: 32)
+	CacheMB int `json:"cacheMb"`
+}
+
+// PartyConfig contains settings for party guests, clients paired with only
+// the party scope
+type PartyConfig struct {
+	// VoteSkipPercent - share of the connected clients that can vote who
+	// must voteSkip the current track before it is skipped (default: 50)
+	VoteSkipPercent int `json:"voteSkipPercent"`
+
+	// FairQueue - play appended tracks round-robin by the client that
+	// queued them rather than in the order they came (default: false)
+	FairQueue bool `json:"fairQueue"`
+}
+
+// TranscodeProfile says which tracks are converted before they are streamed
+// to a renderer, and to what
+type TranscodeProfile struct {
+	// Format - "opus", "mp3" or "aac" to convert tracks to; empty streams
+	// files as they are
+	Format string `json:"format"`
+
+	// BitrateKbps - bitrate of converted tracks
+	BitrateKbps int `json:"bitrateKbps"`
+
+	// Extensions - source formats that are converted, e.g. [".flac", ".wav"];
+	// empty converts the lossless formats
+	Extensions []string `json:"extensions,omitempty"`
+}
+
+// TranscodeConfig contains settings for converting tracks streamed to
+// renderers on slow links, or without a decoder for the library's formats.
+// The profile applies to every renderer without one of its own.
+type TranscodeConfig struct {
+	TranscodeProfile
+
+	// Renderers - profiles for particular renderers, keyed by the ID from
+	// listRenderers; a BitrateKbps of 0 uses the one above
+	Renderers map[string]TranscodeProfile `json:"renderers,omitempty"`
+
+	// CacheMaxMB - size limit of converted tracks kept on disk, across
+	// restarts and beyond the one being streamed (default: 512)
+	CacheMaxMB int `json:"cacheMaxMb"`
+}
+
+// ProfileFor returns the transcode profile of a renderer
+func (c TranscodeConfig) ProfileFor(rendererID string) TranscodeProfile {
+	profile, ok := c.Renderers[rendererID]
+	if !ok {
+		return c.TranscodeProfile
+	}
+	if profile.BitrateKbps == 0 {
+		profile.BitrateKbps = c.BitrateKbps
+	}
+	return profile
+}
+
+// StationConfig is a saved internet radio station or other stream
+type StationConfig struct {
+	// Name shown for the station, and the key for saveStation and removeStation
+	Name string `json:"name"`
+
+	// URL of the stream: Shoutcast/Icecast, HLS (.m3u8) or a .pls/.m3u playlist
+	URL string `json:"url"`
+}
+
+// ProfileConfig is a named set of playback settings, e.g. "morning" or
+// "deep work". Settings left unset are not changed by switching to it.
+type ProfileConfig struct {
+	// Name shown for the profile, and the key for setProfile
+	Name string `json:"name"`
+
+	// Volume level 0.0 - 1.0
+	Volume *float64 `json:"volume,omitempty"`
+
+	// EQ - gains in dB for the "eq" DSP stage, e.g. {"preamp": -2, "8k": 3},
+	// which is added to the chain if it isn't there
+	EQ map[string]float64 `json:"eq,omitempty"`
+
+	// ContinueMode - "off", "similar" or "random"
+	ContinueMode string `json:"continueMode,omitempty"`
+
+	// Seed - a daily mix or mood played when the profile is switched to
+	// with setProfile's play option
+	Seed string `json:"seed,omitempty"`
+
+	// SeedCommunity - a community played instead of Seed
+	SeedCommunity *int `json:"seedCommunity,omitempty"`
+
+	// Start - "HH:MM" time of day the profile is switched to each day; empty
+	// for switching to it by hand only
+	Start string `json:"start,omitempty"`
+}
+
+// ScheduledProfile returns the profile whose start time was passed last
+// before t, which may have been yesterday. It returns false if no profile
+// has a start time.
+func (c *Config) ScheduledProfile(t time.Time) (ProfileConfig, bool) {
+	now := t.Hour()*60 + t.Minute()
+	var best ProfileConfig
+	bestAgo := -1
+	for _, p := range c.Profiles {
+		start, ok := parseTimeOfDay(p.Start)
+		if !ok {
+			continue
+		}
+		// Minutes since it last started, counting back into yesterday
+		ago := (now - start + 24*60) % (24 * 60)
+		if bestAgo < 0 || ago < bestAgo {
+			best, bestAgo = p, ago
+		}
+	}
+	return best, bestAgo >= 0
+}
+
+// parseTimeOfDay parses "HH:MM" to minutes after midnight
+func parseTimeOfDay(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
 }
 
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
+		Version:      CurrentVersion,
 		LibraryPaths: []string{},
 		Audio: AudioConfig{
-			SampleRate:    44100,
-			BufferSizeMs:  100,
-			DefaultVolume: 1.0,
+			SampleRate:     44100,
+			BufferSizeMs:   100,
+			BitDepth:       16,
+			Resampler:      "standard",
+			StallTimeoutMs: 10000,
+			DefaultVolume:  1.0,
+			VolumeCurve:    "linear",
+			FadeMs:         150,
+			TargetLufs:     -18,
+			DuckLevel:      0.2,
+			PreviewVolume:  0.3,
+
+			PauseOnDeviceLoss:    true,
+			ResumeOnDeviceReturn: true,
 		},
 		Behavior: BehaviorConfig{
-			ResumeOnStart:    false,
-			RememberQueue:    true,
-			RememberPosition: true,
+			ResumeOnStart:          false,
+			RememberQueue:          true,
+			RememberPosition:       true,
+			ResumeThresholdMinutes: 20,
+			ResumePlayback:         "paused",
+			SilenceThresholdDb:     -60,
+			TrackEndingSeconds:     10,
+			OnPlaybackError:        "skip",
+		},
+		Auth: AuthConfig{
+			TokenTTLHours: 90 * 24,
+		},
+		Logging: LoggingConfig{
+			Level:     "info",
+			MaxSizeMB: 5,
+			MaxFiles:  3,
+		},
+		Network: NetworkConfig{
+			PreBufferMs: 2000,
+			ReadAheadMs: 30000,
+			CacheMaxMB:  1024,
+		},
+		Scanner: ScannerConfig{
+			NiceLevel:      19,
+			ProbeTimeoutMs: 5000,
+		},
+		Stations: []StationConfig{},
+		Profiles: []ProfileConfig{},
+		Podcasts: PodcastConfig{
+			RefreshMinutes: 60,
+		},
+		Transcode: TranscodeConfig{
+			TranscodeProfile: TranscodeProfile{
+				BitrateKbps: 128,
+			},
+			CacheMaxMB: 512,
+		},
+		Notifications: NotificationsConfig{
+			Linux: true,
+			MacOS: true,
+		},
+		Hotkeys: HotkeysConfig{
+			PlayPause:  "Ctrl+Alt+P",
+			Next:       "Ctrl+Alt+Right",
+			Previous:   "Ctrl+Alt+Left",
+			VolumeUp:   "Ctrl+Alt+Up",
+			VolumeDown: "Ctrl+Alt+Down",
+		},
+		MQTT: MQTTConfig{
+			Broker:          "localhost:1883",
+			TopicPrefix:     "musicd",
+			Discovery:       true,
+			DiscoveryPrefix: "homeassistant",
+		},
+		Overlay: OverlayConfig{
+			Format:   "text",
+			Template: "{artist} - {title}",
+			Theme:    "dark",
+		},
+		Memory: MemoryConfig{
+			CacheMB: 32,
+		},
+		Party: PartyConfig{
+			VoteSkipPercent: 50,
 		},
 	}
 }
@@ -68,9 +739,17 @@ func DefaultConfig() *Config {
 type Manager struct {
 	configDir  string
 	configPath string
-	config     *Config
+
+	mu       sync.RWMutex
+	config   *Config
+	lastData []byte // Contents of the file as last read or written
+	onChange ChangeCallback
 }
 
+// ChangeCallback is called after the configuration has been replaced, either
+// through Update or because the file was edited on disk
+type ChangeCallback func(old, new *Config)
+
 // NewManager creates a new configuration manager
 func NewManager(configDir string) *Manager {
 	return &Manager{
@@ -80,59 +759,145 @@ func NewManager(configDir string) *Manager {
 	}
 }
 
-// Load reads the configuration from disk
+// Load reads the configuration from disk. Older schema versions are
+// migrated, invalid values are reset to their defaults, and a config that
+// cannot be parsed is set aside and replaced by the backup (or defaults), so
+// a bad hand edit never prevents the daemon from starting.
 func (m *Manager) Load() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	// Ensure config directory exists
 	if err := os.MkdirAll(m.configDir, 0700); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	// Check if config file exists
-	if _, err := os.Stat(m.configPath); os.IsNotExist(err) {
+	data, err := os.ReadFile(m.configPath)
+	if os.IsNotExist(err) {
 		// Create default config
 		m.config = DefaultConfig()
-		return m.Save()
+		return m.write(true)
 	}
-
-	// Read existing config
-	data, err := os.ReadFile(m.configPath)
 	if err != nil {
 		return fmt.Errorf("failed to read config: %w", err)
 	}
 
-	// Parse JSON
-	config := DefaultConfig() // Start with defaults
-	if err := json.Unmarshal(data, config); err != nil {
-		return fmt.Errorf("failed to parse config: %w", err)
+	config, fromVersion, err := parseConfig(data)
+	if err != nil {
+		log.Printf("[CONFIG] Warning: %s is invalid: %v", m.configPath, err)
+		if err := atomicfile.Write(m.configPath+".invalid", data); err == nil {
+			log.Printf("[CONFIG] Saved the invalid file as %s.invalid", m.configPath)
+		}
+
+		config = m.loadBackup()
+		m.config = config
+		// Don't let the broken file replace the good backup
+		return m.write(false)
+	}
+
+	changed := false
+	if fromVersion < CurrentVersion {
+		log.Printf("[CONFIG] Migrated config from version %d to %d", fromVersion, CurrentVersion)
+		changed = true
+	} else if fromVersion > CurrentVersion {
+		log.Printf("[CONFIG] Warning: config version %d is newer than supported version %d; unknown settings are ignored",
+			fromVersion, CurrentVersion)
+	}
+
+	for _, fe := range config.repair() {
+		log.Printf("[CONFIG] Warning: %v; using default", fe)
+		changed = true
+	}
+	if err := ValidateLibraryPaths(config.LibraryPaths); err != nil {
+		log.Printf("[CONFIG] Warning: %v", err)
 	}
 
 	m.config = config
+	m.lastData = data
+	if changed {
+		return m.write(true)
+	}
 	return nil
 }
 
-// Save writes the configuration to disk
+// parseConfig migrates and decodes config JSON on top of the defaults.
+// Returns the config and the schema version it was stored in.
+func parseConfig(data []byte) (*Config, int, error) {
+	upgraded, fromVersion, err := migrate(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	config := DefaultConfig() // Start with defaults
+	if err := json.Unmarshal(upgraded, config); err != nil {
+		return nil, 0, err
+	}
+	return config, fromVersion, nil
+}
+
+// loadBackup returns the backed up config, or the defaults if there is no
+// usable backup
+func (m *Manager) loadBackup() *Config {
+	data, err := os.ReadFile(m.backupPath())
+	if err == nil {
+		if config, _, err := parseConfig(data); err == nil {
+			config.repair()
+			log.Printf("[CONFIG] Restored config from %s", m.backupPath())
+			return config
+		}
+	}
+	log.Printf("[CONFIG] No usable backup, using default config")
+	return DefaultConfig()
+}
+
+// Save writes the configuration to disk, keeping the previous file as a backup
 func (m *Manager) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.write(true)
+}
+
+// write atomically replaces the config file, optionally backing up the
+// current one first (must be called with lock held)
+func (m *Manager) write(backup bool) error {
 	// Ensure config directory exists
 	if err := os.MkdirAll(m.configDir, 0700); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
+	m.config.Version = CurrentVersion
+
 	// Marshal to JSON with indentation
 	data, err := json.MarshalIndent(m.config, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	// Write to file
-	if err := os.WriteFile(m.configPath, data, 0600); err != nil {
+	if backup {
+		if previous, err := os.ReadFile(m.configPath); err == nil && !bytes.Equal(previous, data) {
+			if err := atomicfile.Write(m.backupPath(), previous); err != nil {
+				log.Printf("[CONFIG] Warning: failed to back up config: %v", err)
+			}
+		}
+	}
+
+	if err := atomicfile.Write(m.configPath, data); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
+	m.lastData = data
 
 	return nil
 }
 
-// Get returns the current configuration
+func (m *Manager) backupPath() string {
+	return m.configPath + ".bak"
+}
+
+// Get returns the current configuration. The returned value must be treated
+// as read-only; use Update to change it.
 func (m *Manager) Get() *Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.config
 }
 
@@ -141,39 +906,73 @@ func (m *Manager) GetPath() string {
 	return m.configPath
 }
 
-// Update updates the configuration and saves it
+// SetOnChange sets the callback invoked whenever the configuration changes
+func (m *Manager) SetOnChange(cb ChangeCallback) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = cb
+}
+
+// Update validates and saves a new configuration. An invalid configuration
+// is rejected and the current one kept.
 func (m *Manager) Update(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	old := m.config
 	m.config = config
-	return m.Save()
+	if err := m.write(true); err != nil {
+		m.config = old
+		m.mu.Unlock()
+		return err
+	}
+	cb := m.onChange
+	m.mu.Unlock()
+
+	if cb != nil {
+		cb(old, config)
+	}
+	return nil
 }
 
 // SetLibraryPaths updates the library paths
 func (m *Manager) SetLibraryPaths(paths []string) error {
-	m.config.LibraryPaths = paths
-	return m.Save()
+	cfg := *m.Get()
+	cfg.LibraryPaths = paths
+	return m.Update(&cfg)
 }
 
 // AddLibraryPath adds a library path
 func (m *Manager) AddLibraryPath(path string) error {
+	cfg := *m.Get()
+
 	// Check if already exists
-	for _, p := range m.config.LibraryPaths {
+	for _, p := range cfg.LibraryPaths {
 		if p == path {
 			return nil // Already exists
 		}
 	}
 
-	m.config.LibraryPaths = append(m.config.LibraryPaths, path)
-	return m.Save()
+	cfg.LibraryPaths = append(append([]string(nil), cfg.LibraryPaths...), path)
+	return m.Update(&cfg)
 }
 
 // RemoveLibraryPath removes a library path
 func (m *Manager) RemoveLibraryPath(path string) error {
-	paths := make([]string, 0, len(m.config.LibraryPaths))
-	for _, p := range m.config.LibraryPaths {
+	cfg := *m.Get()
+
+	paths := make([]string, 0, len(cfg.LibraryPaths))
+	for _, p := range cfg.LibraryPaths {
 		if p != path {
 			paths = append(paths, p)
 		}
 	}
-	m.config.LibraryPaths = paths
-	return m.Save()
+	cfg.LibraryPaths = paths
+	if _, ok := cfg.LibraryScan[path]; ok {
+		cfg.LibraryScan = maps.Clone(cfg.LibraryScan)
+		delete(cfg.LibraryScan, path)
+	}
+	return m.Update(&cfg)
 }
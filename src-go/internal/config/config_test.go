@@ -0,0 +1,486 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTestManager(t *testing.T, contents string) (*Manager, string) {
+	tmpDir, err := os.MkdirTemp("", "config_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	if contents != "" {
+		if err := os.WriteFile(filepath.Join(tmpDir, "config.json"), []byte(contents), 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+	return NewManager(tmpDir), tmpDir
+}
+
+func TestLoadCreatesDefault(t *testing.T) {
+	m, tmpDir := createTestManager(t, "")
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if m.Get().Version != CurrentVersion {
+		t.Errorf("Expected version %d, got %d", CurrentVersion, m.Get().Version)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "config.json")); err != nil {
+		t.Errorf("Expected config file to be created: %v", err)
+	}
+}
+
+func TestLoadMigratesUnversionedConfig(t *testing.T) {
+	m, tmpDir := createTestManager(t, `{"libraryPaths": null, "audio": {"sampleRate": 48000}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	cfg := m.Get()
+	if cfg.Version != CurrentVersion {
+		t.Errorf("Expected version %d, got %d", CurrentVersion, cfg.Version)
+	}
+	if cfg.LibraryPaths == nil {
+		t.Error("Expected null libraryPaths to become an empty list")
+	}
+	if cfg.Audio.SampleRate != 48000 {
+		t.Errorf("Expected sample rate to be kept, got %d", cfg.Audio.SampleRate)
+	}
+	if cfg.Audio.BufferSizeMs != 100 {
+		t.Errorf("Expected missing values to use defaults, got bufferSizeMs %d", cfg.Audio.BufferSizeMs)
+	}
+
+	// The pre-migration file is kept as the backup
+	backup, err := os.ReadFile(filepath.Join(tmpDir, "config.json.bak"))
+	if err != nil || !strings.Contains(string(backup), `"libraryPaths": null`) {
+		t.Errorf("Expected original config in backup, got %q (%v)", backup, err)
+	}
+}
+
+func TestLoadRepairsInvalidValues(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "audio": {"sampleRate": 12345, "defaultVolume": 3, "balance": -2, "mono": true}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	cfg := m.Get()
+	if cfg.Audio.SampleRate != 44100 {
+		t.Errorf("Expected invalid sample rate to reset to 44100, got %d", cfg.Audio.SampleRate)
+	}
+	if cfg.Audio.DefaultVolume != 1.0 {
+		t.Errorf("Expected invalid volume to reset to 1.0, got %f", cfg.Audio.DefaultVolume)
+	}
+	if cfg.Audio.Balance != 0 || !cfg.Audio.Mono {
+		t.Errorf("Expected invalid balance to reset to 0 and mono to be kept, got %+v", cfg.Audio)
+	}
+}
+
+func TestLoadRepairsOutputFormat(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "audio": {"sampleRate": 48000, "bitDepth": 20, "resampler": "cubic"}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	audio := m.Get().Audio
+	if audio.SampleRate != 48000 || audio.BitDepth != 16 || audio.Resampler != "standard" {
+		t.Errorf("Expected 48kHz kept and bit depth and resampler reset, got %+v", audio)
+	}
+}
+
+func TestLoadRepairsPreBufferBeyondReadAhead(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "network": {"preBufferMs": 5000, "readAheadMs": 0}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	network := m.Get().Network
+	if network.ReadAheadMs != 0 || network.PreBufferMs != 0 {
+		t.Errorf("Expected pre-buffer to be clamped when read-ahead is off, got %+v", network)
+	}
+	if network.CacheMaxMB != 1024 {
+		t.Errorf("Expected missing cacheMaxMb to use default, got %d", network.CacheMaxMB)
+	}
+}
+
+func TestLoadRepairsScannerSettings(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "scanner": {"workers": 500, "niceLevel": 5}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	scanner := m.Get().Scanner
+	if scanner.Workers != 0 || scanner.NiceLevel != 5 || scanner.ProbeTimeoutMs != 5000 {
+		t.Errorf("Expected workers reset to auto, nice level kept and default probe timeout, got %+v", scanner)
+	}
+}
+
+func TestLoadNotificationSettings(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "notifications": {"enabled": true, "macos": false, "timeoutMs": -5}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	notifications := m.Get().Notifications
+	if notifications.TimeoutMs != 0 {
+		t.Errorf("Expected a negative timeout to be reset, got %d", notifications.TimeoutMs)
+	}
+	if !notifications.EnabledOn("linux") || notifications.EnabledOn("darwin") || notifications.EnabledOn("windows") {
+		t.Errorf("Expected notifications on Linux only, got %+v", notifications)
+	}
+}
+
+func TestLoadRepairsHotkeys(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "hotkeys": {"enabled": true, "playPause": "p", "previous": "ctrl+alt+b", "volumeUp": "ctrl+alt+right"}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	hotkeys := m.Get().Hotkeys
+	if hotkeys.PlayPause != "" || hotkeys.VolumeUp != "" {
+		t.Errorf("Expected the combo without a modifier and the one clashing with next to be unbound, got %+v", hotkeys)
+	}
+	if hotkeys.Next != "Ctrl+Alt+Right" || hotkeys.Previous != "ctrl+alt+b" {
+		t.Errorf("Expected valid combos to be kept, got %+v", hotkeys)
+	}
+}
+
+func TestLoadRepairsMQTT(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "mqtt": {"enabled": true, "broker": "broker.lan", "topicPrefix": "home/#", "nodeId": "living room"}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	mqtt := m.Get().MQTT
+	want := DefaultConfig().MQTT
+	want.Enabled = true
+	if mqtt != want {
+		t.Errorf("Expected invalid MQTT settings reset to defaults, got %+v", mqtt)
+	}
+}
+
+func TestLoadRepairsInvalidZones(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "audio": {"zones": [{"name": "local", "command": ["aplay"]}]}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if zones := m.Get().Audio.Zones; len(zones) != 0 {
+		t.Errorf("Expected zone using the reserved name to be dropped, got %+v", zones)
+	}
+
+	cfg := *m.Get()
+	cfg.Audio.Zones = []ZoneConfig{{Name: "office", Command: []string{"aplay", "-D", "hw:1"}}}
+	if err := m.Update(&cfg); err != nil {
+		t.Fatalf("Expected valid zone to be accepted, got %v", err)
+	}
+	if got := m.Get().Audio.Zones[0].VolumeLevel(); got != 1.0 {
+		t.Errorf("Expected zone volume to default to 1.0, got %f", got)
+	}
+
+	cfg.Audio.Zones = append(cfg.Audio.Zones, ZoneConfig{Name: "office", Command: []string{"pacat"}})
+	if err := m.Update(&cfg); err == nil || !strings.Contains(err.Error(), "audio.zones") {
+		t.Errorf("Expected duplicate zone names to be rejected, got %v", err)
+	}
+}
+
+func TestSnapcastZoneValidation(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1}`)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	cfg := *m.Get()
+	cfg.Audio.Zones = []ZoneConfig{{Name: "house", Snapcast: "snapserver.local:4953"}}
+	if err := m.Update(&cfg); err != nil {
+		t.Fatalf("Expected Snapcast zone without a command to be accepted, got %v", err)
+	}
+
+	for _, zone := range []ZoneConfig{
+		{Name: "house", Snapcast: "snapserver.local"},
+		{Name: "house", Snapcast: "snapserver.local:4953", Command: []string{"aplay"}},
+	} {
+		cfg.Audio.Zones = []ZoneConfig{zone}
+		if err := m.Update(&cfg); err == nil {
+			t.Errorf("Expected %+v to be rejected", zone)
+		}
+	}
+}
+
+func TestLoadRepairsInvalidStations(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "stations": [{"name": "Local", "url": "/music/radio.mp3"}]}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if stations := m.Get().Stations; len(stations) != 0 {
+		t.Errorf("Expected station without an http URL to be dropped, got %+v", stations)
+	}
+
+	cfg := *m.Get()
+	cfg.Stations = []StationConfig{{Name: "Jazz", URL: "https://radio.example.com/jazz.pls"}}
+	if err := m.Update(&cfg); err != nil {
+		t.Fatalf("Expected valid station to be accepted, got %v", err)
+	}
+
+	cfg.Stations = append(cfg.Stations, StationConfig{Name: "Jazz", URL: "http://other.example.com/"})
+	if err := m.Update(&cfg); err == nil || !strings.Contains(err.Error(), "stations") {
+		t.Errorf("Expected duplicate station names to be rejected, got %v", err)
+	}
+}
+
+func TestScheduledProfile(t *testing.T) {
+	cfg := DefaultConfig()
+	if _, ok := cfg.ScheduledProfile(time.Now()); ok {
+		t.Error("Expected no scheduled profile without start times")
+	}
+
+	cfg.Profiles = []ProfileConfig{
+		{Name: "morning", Start: "07:00"},
+		{Name: "deep work", Start: "09:30"},
+		{Name: "evening", Start: "18:00"},
+		{Name: "manual"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected profiles to be valid, got %v", err)
+	}
+	for clock, want := range map[string]string{
+		"07:00": "morning",
+		"09:29": "morning",
+		"12:00": "deep work",
+		"23:59": "evening",
+		"03:00": "evening", // Still last night's
+	} {
+		at, _ := time.Parse("15:04", clock)
+		if got, ok := cfg.ScheduledProfile(at); !ok || got.Name != want {
+			t.Errorf("At %s expected %q, got %q", clock, want, got.Name)
+		}
+	}
+
+	cfg.Profiles = append(cfg.Profiles, ProfileConfig{Name: "lunch", Start: "25:00"})
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "profiles") {
+		t.Errorf("Expected a bad start time to be rejected, got %v", err)
+	}
+}
+
+func TestScanOptionsValidation(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "libraryScan": {"/music": {"maxDepth": -1}}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(m.Get().LibraryScan) != 0 {
+		t.Errorf("Expected invalid scan options to be dropped, got %+v", m.Get().LibraryScan)
+	}
+
+	cfg := *m.Get()
+	cfg.LibraryScan = map[string]ScanOptions{"/music": {Exclude: []string{"**/Audiobooks/**", "Samples/*.wav"}, MinDurationMs: 30000}}
+	if err := m.Update(&cfg); err != nil {
+		t.Fatalf("Expected valid scan options to be accepted, got %v", err)
+	}
+
+	for _, pattern := range []string{"/abs/**", "[a-", ""} {
+		cfg.LibraryScan = map[string]ScanOptions{"/music": {Exclude: []string{pattern}}}
+		if err := m.Update(&cfg); err == nil || !strings.Contains(err.Error(), "libraryScan") {
+			t.Errorf("Expected exclude pattern %q to be rejected, got %v", pattern, err)
+		}
+	}
+}
+
+func TestTranscodeValidation(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "transcode": {"format": "vorbis", "bitrateKbps": 96, "cacheMaxMb": 64}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if tc := m.Get().Transcode; tc.Format != "" || tc.BitrateKbps != 128 || tc.CacheMaxMB != 64 {
+		t.Errorf("Expected the invalid profile reset and the cache size kept, got %+v", tc)
+	}
+
+	cfg := *m.Get()
+	cfg.Transcode.Format = "opus"
+	cfg.Transcode.Renderers = map[string]TranscodeProfile{"uuid:kitchen": {Format: "mp3"}, "uuid:den": {}}
+	if err := m.Update(&cfg); err != nil {
+		t.Fatalf("Expected valid profiles to be accepted, got %v", err)
+	}
+	if p := cfg.Transcode.ProfileFor("uuid:kitchen"); p.Format != "mp3" || p.BitrateKbps != 128 {
+		t.Errorf("Expected the kitchen to get mp3 at the shared bitrate, got %+v", p)
+	}
+	if p := cfg.Transcode.ProfileFor("uuid:den"); p.Format != "" {
+		t.Errorf("Expected the den to stream files as they are, got %+v", p)
+	}
+	if p := cfg.Transcode.ProfileFor("uuid:other"); p.Format != "opus" {
+		t.Errorf("Expected other renderers to get opus, got %+v", p)
+	}
+
+	cfg.Transcode.Renderers = map[string]TranscodeProfile{"uuid:kitchen": {Format: "mp3", Extensions: []string{"flac"}}}
+	if err := m.Update(&cfg); err == nil || !strings.Contains(err.Error(), "transcode.renderers") {
+		t.Errorf("Expected an extension without a dot to be rejected, got %v", err)
+	}
+}
+
+func TestLoadMalformedFallsBackToBackup(t *testing.T) {
+	m, tmpDir := createTestManager(t, `{"version": 1, "audio": {"sampleRate": 96000}}`)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// Save a change so the good file becomes the backup, then corrupt the config
+	cfg := *m.Get()
+	cfg.Audio.DefaultVolume = 0.5
+	if err := m.Update(&cfg); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	configPath := filepath.Join(tmpDir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"audio": {`), 0600); err != nil {
+		t.Fatalf("Failed to corrupt config: %v", err)
+	}
+
+	m2 := NewManager(tmpDir)
+	if err := m2.Load(); err != nil {
+		t.Fatalf("Expected malformed config not to fail Load, got %v", err)
+	}
+	if m2.Get().Audio.SampleRate != 96000 {
+		t.Errorf("Expected config restored from backup, got sample rate %d", m2.Get().Audio.SampleRate)
+	}
+	if _, err := os.Stat(configPath + ".invalid"); err != nil {
+		t.Errorf("Expected malformed file to be kept aside: %v", err)
+	}
+
+	// The backup must still be the good config, not the broken one
+	if _, _, err := parseConfig(mustRead(t, configPath+".bak")); err != nil {
+		t.Errorf("Backup was overwritten with an unparseable config: %v", err)
+	}
+}
+
+func TestUpdateRejectsInvalidConfig(t *testing.T) {
+	m, _ := createTestManager(t, "")
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	cfg := *m.Get()
+	cfg.Audio.SampleRate = 1000
+	cfg.Behavior.ResumePlayback = "sometimes"
+	err := m.Update(&cfg)
+	if err == nil {
+		t.Fatal("Expected invalid config to be rejected")
+	}
+	if !strings.Contains(err.Error(), "audio.sampleRate") || !strings.Contains(err.Error(), "behavior.resumePlayback") {
+		t.Errorf("Expected both fields to be reported, got %v", err)
+	}
+	if m.Get().Audio.SampleRate != 44100 {
+		t.Error("Expected the running config to be unchanged")
+	}
+}
+
+func TestValidateLibraryPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "song.mp3")
+	os.WriteFile(file, nil, 0600)
+
+	if err := ValidateLibraryPaths([]string{tmpDir}); err != nil {
+		t.Errorf("Expected existing directory to be valid, got %v", err)
+	}
+	if err := ValidateLibraryPaths([]string{filepath.Join(tmpDir, "missing")}); err == nil {
+		t.Error("Expected missing directory to be rejected")
+	}
+	if err := ValidateLibraryPaths([]string{file}); err == nil {
+		t.Error("Expected file to be rejected")
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return data
+}
+
+func TestReloadAppliesExternalEdit(t *testing.T) {
+	m, tmpDir := createTestManager(t, "")
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var calls int
+	var gotOld, gotNew *Config
+	m.SetOnChange(func(old, new *Config) {
+		calls++
+		gotOld, gotNew = old, new
+	})
+
+	// The daemon's own writes are not treated as edits
+	if m.reload() {
+		t.Error("Expected unchanged file not to reload")
+	}
+
+	configPath := filepath.Join(tmpDir, "config.json")
+	edited := `{"version": 1, "libraryPaths": ["/music"], "audio": {"defaultVolume": 0.25}}`
+	if err := os.WriteFile(configPath, []byte(edited), 0600); err != nil {
+		t.Fatalf("Failed to edit config: %v", err)
+	}
+	if !m.reload() {
+		t.Fatal("Expected edited file to reload")
+	}
+	if calls != 1 || gotOld.Audio.DefaultVolume != 1.0 || gotNew.Audio.DefaultVolume != 0.25 {
+		t.Errorf("Unexpected change callback: calls=%d old=%+v new=%+v", calls, gotOld, gotNew)
+	}
+	if m.Get().LibraryPaths[0] != "/music" {
+		t.Errorf("Expected library paths to be applied, got %v", m.Get().LibraryPaths)
+	}
+
+	// A broken edit keeps the running config
+	if err := os.WriteFile(configPath, []byte(`{"audio": `), 0600); err != nil {
+		t.Fatalf("Failed to edit config: %v", err)
+	}
+	if m.reload() {
+		t.Error("Expected malformed file to be ignored")
+	}
+	if m.Get().Audio.DefaultVolume != 0.25 {
+		t.Error("Expected the running config to be unchanged")
+	}
+}
+
+func TestLoadRepairsPlaybackErrorPolicy(t *testing.T) {
+	m, _ := createTestManager(t, `{"version": 1, "behavior": {"onPlaybackError": "ignore"}}`)
+
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := m.Get().Behavior.OnPlaybackError; got != "skip" {
+		t.Errorf("Expected onPlaybackError to reset to skip, got %q", got)
+	}
+}
+
+func TestRedactedBlanksCredentials(t *testing.T) {
+	c := DefaultConfig()
+	c.Identify.AcoustIDKey = "key"
+	c.MQTT.Username = "musicd"
+	c.MQTT.Password = "secret"
+
+	redacted := c.Redacted()
+	if redacted.Identify.AcoustIDKey != "" || redacted.MQTT.Password != "" {
+		t.Errorf("Expected credentials blanked, got %+v %+v", redacted.Identify, redacted.MQTT)
+	}
+	if redacted.MQTT.Username != "musicd" {
+		t.Errorf("Expected other settings kept, got %+v", redacted.MQTT)
+	}
+	if c.MQTT.Password != "secret" {
+		t.Error("Expected the original config unchanged")
+	}
+}
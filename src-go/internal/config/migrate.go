@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CurrentVersion is the schema version written by this build
+const CurrentVersion = 1
+
+// migrations[n] upgrades a raw config from version n to n+1. Migrations work
+// on the decoded JSON object so fields can be renamed or restructured before
+// the result is decoded into Config.
+var migrations = []func(raw map[string]interface{}) error{
+	migrateV0ToV1,
+}
+
+// migrate upgrades raw config JSON to CurrentVersion.
+// Returns the upgraded JSON and the version it started from.
+func migrate(data []byte) ([]byte, int, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, 0, err
+	}
+	if raw == nil {
+		return nil, 0, fmt.Errorf("config is not a JSON object")
+	}
+
+	version := 0
+	if v, ok := raw["version"].(float64); ok {
+		version = int(v)
+	}
+	if version >= CurrentVersion {
+		return data, version, nil
+	}
+
+	for v := version; v < CurrentVersion; v++ {
+		if err := migrations[v](raw); err != nil {
+			return nil, version, fmt.Errorf("migration from version %d failed: %w", v, err)
+		}
+	}
+	raw["version"] = CurrentVersion
+
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, version, err
+	}
+	return upgraded, version, nil
+}
+
+// migrateV0ToV1 upgrades configs written before the schema was versioned.
+// They share version 1's layout, so this only normalizes a null
+// libraryPaths to an empty list.
+func migrateV0ToV1(raw map[string]interface{}) error {
+	if paths, ok := raw["libraryPaths"]; ok && paths == nil {
+		raw["libraryPaths"] = []interface{}{}
+	}
+	return nil
+}
@@ -0,0 +1,604 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/austinkregel/local-media/musicd/internal/hotkey"
+	"github.com/austinkregel/local-media/musicd/internal/overlay"
+)
+
+// ValidSampleRates are the output sample rates the audio backend supports
+var ValidSampleRates = []int{22050, 32000, 44100, 48000, 88200, 96000, 192000}
+
+// Limits for numeric settings
+const (
+	MinBufferSizeMs  = 10
+	MaxBufferSizeMs  = 2000
+	MaxFadeMs        = 2000
+	MaxReadAheadMs   = 10 * 60 * 1000
+	MaxScanWorkers   = 64
+	MaxNiceLevel     = 19
+	MaxProbeTimeout  = 60 * 1000
+	MinTranscodeKbps = 8
+	MaxTranscodeKbps = 512
+
+	MinSilenceThresholdDb = -80
+	MaxSilenceThresholdDb = -30
+
+	MinTargetLufs = -30
+	MaxTargetLufs = -5
+
+	MaxTrackEndingSeconds = 120
+
+	MaxIdleTimeoutMinutes = 7 * 24 * 60
+
+	MinStallTimeoutMs = 1000
+	MaxStallTimeoutMs = 120 * 1000
+
+	MaxNotificationTimeoutMs = 60 * 1000
+
+	MinMemoryBudgetMB = 128
+	MaxMemoryCacheMB  = 4096
+)
+
+// ValidBitDepths are the output bit depths the audio backend supports
+var ValidBitDepths = []int{16, 24}
+
+// Resamplers are the resampler qualities, fastest first
+var Resamplers = []string{"fast", "standard", "high", "soxr"}
+
+// VolumeCurves are the ways volume levels map onto loudness
+var VolumeCurves = []string{"linear", "logarithmic"}
+
+// hotkeyActions are the actions hotkeys can be bound to, in the order their
+// combos are checked
+var hotkeyActions = []hotkey.Action{
+	hotkey.ActionPlayPause,
+	hotkey.ActionNext,
+	hotkey.ActionPrevious,
+	hotkey.ActionVolumeUp,
+	hotkey.ActionVolumeDown,
+}
+
+// TranscodeFormats are the formats tracks can be converted to for renderers
+var TranscodeFormats = []string{"opus", "mp3", "aac"}
+
+// LocalZoneName is the output zone of the default device, which can't be
+// configured as an additional zone
+const LocalZoneName = "local"
+
+// FieldError describes an invalid configuration value
+type FieldError struct {
+	Field   string // JSON path, e.g. "audio.sampleRate"
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Validate checks every setting except library paths, which may legitimately
+// point at an unmounted drive (see ValidateLibraryPaths).
+func (c *Config) Validate() error {
+	var errs []error
+	for _, fe := range c.fieldErrors() {
+		errs = append(errs, fe)
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateLibraryPaths checks that every path exists and is a directory
+func ValidateLibraryPaths(paths []string) error {
+	var errs []error
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		switch {
+		case err != nil:
+			errs = append(errs, &FieldError{Field: "libraryPaths", Message: fmt.Sprintf("%s does not exist", p)})
+		case !info.IsDir():
+			errs = append(errs, &FieldError{Field: "libraryPaths", Message: fmt.Sprintf("%s is not a directory", p)})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Config) fieldErrors() []*FieldError {
+	var errs []*FieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !isValidSampleRate(c.Audio.SampleRate) {
+		add("audio.sampleRate", "%d is not a supported sample rate %v", c.Audio.SampleRate, ValidSampleRates)
+	}
+	if c.Audio.BufferSizeMs < MinBufferSizeMs || c.Audio.BufferSizeMs > MaxBufferSizeMs {
+		add("audio.bufferSizeMs", "must be between %d and %d", MinBufferSizeMs, MaxBufferSizeMs)
+	}
+	if !slices.Contains(ValidBitDepths, c.Audio.BitDepth) {
+		add("audio.bitDepth", "must be 16 or 24")
+	}
+	if !slices.Contains(Resamplers, c.Audio.Resampler) {
+		add("audio.resampler", "must be one of %v", Resamplers)
+	}
+	if t := c.Audio.StallTimeoutMs; t != 0 && (t < MinStallTimeoutMs || t > MaxStallTimeoutMs) {
+		add("audio.stallTimeoutMs", "must be 0 or between %d and %d", MinStallTimeoutMs, MaxStallTimeoutMs)
+	}
+	if c.Audio.DefaultVolume < 0 || c.Audio.DefaultVolume > 1 {
+		add("audio.defaultVolume", "must be between 0.0 and 1.0")
+	}
+	if !slices.Contains(VolumeCurves, c.Audio.VolumeCurve) {
+		add("audio.volumeCurve", "must be one of %v", VolumeCurves)
+	}
+	if c.Audio.FadeMs < 0 || c.Audio.FadeMs > MaxFadeMs {
+		add("audio.fadeMs", "must be between 0 and %d", MaxFadeMs)
+	}
+	if c.Audio.Balance < -1 || c.Audio.Balance > 1 {
+		add("audio.balance", "must be between -1.0 and 1.0")
+	}
+	if c.Audio.TargetLufs < MinTargetLufs || c.Audio.TargetLufs > MaxTargetLufs {
+		add("audio.targetLufs", "must be between %d and %d", MinTargetLufs, MaxTargetLufs)
+	}
+	if c.Audio.DuckLevel < 0 || c.Audio.DuckLevel > 1 {
+		add("audio.duckLevel", "must be between 0.0 and 1.0")
+	}
+	if c.Audio.PreviewVolume < 0 || c.Audio.PreviewVolume > 1 {
+		add("audio.previewVolume", "must be between 0.0 and 1.0")
+	}
+	if msg := zonesError(c.Audio.Zones); msg != "" {
+		add("audio.zones", "%s", msg)
+	}
+	for i, stage := range c.Audio.DSP {
+		if stage.Name == "" {
+			add("audio.dsp", "stage %d has no name", i)
+			break
+		}
+	}
+
+	if c.Behavior.ResumeThresholdMinutes < 0 {
+		add("behavior.resumeThresholdMinutes", "must not be negative")
+	}
+	switch c.Behavior.ResumePlayback {
+	case "paused", "playing":
+	default:
+		add("behavior.resumePlayback", "must be \"paused\" or \"playing\"")
+	}
+	if c.Behavior.SilenceThresholdDb < MinSilenceThresholdDb || c.Behavior.SilenceThresholdDb > MaxSilenceThresholdDb {
+		add("behavior.silenceThresholdDb", "must be between %d and %d", MinSilenceThresholdDb, MaxSilenceThresholdDb)
+	}
+	if c.Behavior.TrackEndingSeconds < 0 || c.Behavior.TrackEndingSeconds > MaxTrackEndingSeconds {
+		add("behavior.trackEndingSeconds", "must be between 0 and %d", MaxTrackEndingSeconds)
+	}
+	if c.Behavior.IdleTimeoutMinutes < 0 || c.Behavior.IdleTimeoutMinutes > MaxIdleTimeoutMinutes {
+		add("behavior.idleTimeoutMinutes", "must be between 0 and %d", MaxIdleTimeoutMinutes)
+	}
+	switch c.Behavior.OnPlaybackError {
+	case "skip", "retry", "stop":
+	default:
+		add("behavior.onPlaybackError", "must be \"skip\", \"retry\" or \"stop\"")
+	}
+
+	if c.Auth.TokenTTLHours < 0 {
+		add("auth.tokenTtlHours", "must not be negative")
+	}
+
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		add("logging.level", "must be \"debug\", \"info\", \"warn\" or \"error\"")
+	}
+	if c.Logging.MaxSizeMB < 0 {
+		add("logging.maxSizeMb", "must not be negative")
+	}
+	if c.Logging.MaxFiles < 0 {
+		add("logging.maxFiles", "must not be negative")
+	}
+
+	if c.Network.ReadAheadMs < 0 || c.Network.ReadAheadMs > MaxReadAheadMs {
+		add("network.readAheadMs", "must be between 0 and %d", MaxReadAheadMs)
+	}
+	if c.Network.PreBufferMs < 0 || c.Network.PreBufferMs > max(c.Network.ReadAheadMs, 0) {
+		add("network.preBufferMs", "must be between 0 and network.readAheadMs")
+	}
+	if c.Network.CacheMaxMB < 0 {
+		add("network.cacheMaxMb", "must not be negative")
+	}
+
+	if c.Scanner.Workers < 0 || c.Scanner.Workers > MaxScanWorkers {
+		add("scanner.workers", "must be between 0 and %d", MaxScanWorkers)
+	}
+	if c.Scanner.NiceLevel < 0 || c.Scanner.NiceLevel > MaxNiceLevel {
+		add("scanner.niceLevel", "must be between 0 and %d", MaxNiceLevel)
+	}
+	if c.Scanner.ProbeTimeoutMs < 1 || c.Scanner.ProbeTimeoutMs > MaxProbeTimeout {
+		add("scanner.probeTimeoutMs", "must be between 1 and %d", MaxProbeTimeout)
+	}
+	if msg := scanOptionsError(c.LibraryScan); msg != "" {
+		add("libraryScan", "%s", msg)
+	}
+
+	if msg := stationsError(c.Stations); msg != "" {
+		add("stations", "%s", msg)
+	}
+	if msg := profilesError(c.Profiles); msg != "" {
+		add("profiles", "%s", msg)
+	}
+	if c.Podcasts.RefreshMinutes < 0 {
+		add("podcasts.refreshMinutes", "must not be negative")
+	}
+
+	if msg := transcodeProfileError(c.Transcode.TranscodeProfile, false); msg != "" {
+		add("transcode", "%s", msg)
+	}
+	for id, profile := range c.Transcode.Renderers {
+		if msg := transcodeProfileError(profile, true); msg != "" {
+			add("transcode.renderers", "%s %s", id, msg)
+			break
+		}
+	}
+	if c.Transcode.CacheMaxMB < 0 {
+		add("transcode.cacheMaxMb", "must not be negative")
+	}
+
+	if c.Notifications.TimeoutMs < 0 || c.Notifications.TimeoutMs > MaxNotificationTimeoutMs {
+		add("notifications.timeoutMs", "must be between 0 and %d", MaxNotificationTimeoutMs)
+	}
+
+	bindings := c.Hotkeys.Bindings()
+	seen := make(map[hotkey.Combo]hotkey.Action)
+	for _, action := range hotkeyActions {
+		combo, ok := bindings[action]
+		if !ok {
+			continue
+		}
+		parsed, err := hotkey.ParseCombo(combo)
+		if err != nil {
+			add("hotkeys."+string(action), "%v", err)
+			continue
+		}
+		if other, taken := seen[parsed]; taken {
+			add("hotkeys."+string(action), "%s is already bound to %s", parsed, other)
+			continue
+		}
+		seen[parsed] = action
+	}
+
+	if !isHostPort(c.MQTT.Broker) {
+		add("mqtt.broker", "must be host:port")
+	}
+	if msg := mqttTopicError(c.MQTT.TopicPrefix); msg != "" {
+		add("mqtt.topicPrefix", "%s", msg)
+	}
+	if msg := mqttTopicError(c.MQTT.DiscoveryPrefix); msg != "" {
+		add("mqtt.discoveryPrefix", "%s", msg)
+	}
+	if strings.Trim(c.MQTT.NodeID, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-") != "" {
+		add("mqtt.nodeId", "must only hold letters, digits, _ and -")
+	}
+
+	if c.Overlay.File != "" && !filepath.IsAbs(c.Overlay.File) {
+		add("overlay.file", "must be an absolute path")
+	}
+	if c.Overlay.Format != overlay.FormatText && c.Overlay.Format != overlay.FormatJSON {
+		add("overlay.format", `must be "text" or "json"`)
+	}
+	if c.Overlay.Template == "" {
+		add("overlay.template", "must not be empty")
+	}
+	if c.Overlay.ListenAddr != "" && !isHostPort(c.Overlay.ListenAddr) {
+		add("overlay.listenAddr", "must be host:port")
+	}
+	if !slices.Contains(overlay.Themes, c.Overlay.Theme) {
+		add("overlay.theme", "must be one of %s", strings.Join(overlay.Themes, ", "))
+	}
+
+	if c.Memory.BudgetMB != 0 && c.Memory.BudgetMB < MinMemoryBudgetMB {
+		add("memory.budgetMb", "must be 0 or at least %d", MinMemoryBudgetMB)
+	}
+	if c.Memory.CacheMB < 0 || c.Memory.CacheMB > MaxMemoryCacheMB {
+		add("memory.cacheMb", "must be between 0 and %d", MaxMemoryCacheMB)
+	} else if c.Memory.BudgetMB >= MinMemoryBudgetMB && c.Memory.CacheMB > c.Memory.BudgetMB/2 {
+		add("memory.cacheMb", "must be at most half of memory.budgetMb")
+	}
+
+	if c.Party.VoteSkipPercent < 1 || c.Party.VoteSkipPercent > 100 {
+		add("party.voteSkipPercent", "must be between 1 and 100")
+	}
+
+	return errs
+}
+
+// repair resets invalid values to their defaults so a bad hand edit does not
+// stop the daemon. Returns the problems that were fixed.
+func (c *Config) repair() []*FieldError {
+	def := DefaultConfig()
+	errs := c.fieldErrors()
+	for _, fe := range errs {
+		switch fe.Field {
+		case "audio.sampleRate":
+			c.Audio.SampleRate = def.Audio.SampleRate
+		case "audio.bufferSizeMs":
+			c.Audio.BufferSizeMs = def.Audio.BufferSizeMs
+		case "audio.bitDepth":
+			c.Audio.BitDepth = def.Audio.BitDepth
+		case "audio.resampler":
+			c.Audio.Resampler = def.Audio.Resampler
+		case "audio.stallTimeoutMs":
+			c.Audio.StallTimeoutMs = def.Audio.StallTimeoutMs
+		case "audio.defaultVolume":
+			c.Audio.DefaultVolume = def.Audio.DefaultVolume
+		case "audio.volumeCurve":
+			c.Audio.VolumeCurve = def.Audio.VolumeCurve
+		case "audio.fadeMs":
+			c.Audio.FadeMs = def.Audio.FadeMs
+		case "audio.balance":
+			c.Audio.Balance = def.Audio.Balance
+		case "audio.targetLufs":
+			c.Audio.TargetLufs = def.Audio.TargetLufs
+		case "audio.duckLevel":
+			c.Audio.DuckLevel = def.Audio.DuckLevel
+		case "audio.previewVolume":
+			c.Audio.PreviewVolume = def.Audio.PreviewVolume
+		case "audio.zones":
+			c.Audio.Zones = def.Audio.Zones
+		case "audio.dsp":
+			c.Audio.DSP = def.Audio.DSP
+		case "behavior.resumeThresholdMinutes":
+			c.Behavior.ResumeThresholdMinutes = def.Behavior.ResumeThresholdMinutes
+		case "behavior.resumePlayback":
+			c.Behavior.ResumePlayback = def.Behavior.ResumePlayback
+		case "behavior.silenceThresholdDb":
+			c.Behavior.SilenceThresholdDb = def.Behavior.SilenceThresholdDb
+		case "behavior.trackEndingSeconds":
+			c.Behavior.TrackEndingSeconds = def.Behavior.TrackEndingSeconds
+		case "behavior.idleTimeoutMinutes":
+			c.Behavior.IdleTimeoutMinutes = def.Behavior.IdleTimeoutMinutes
+		case "behavior.onPlaybackError":
+			c.Behavior.OnPlaybackError = def.Behavior.OnPlaybackError
+		case "auth.tokenTtlHours":
+			c.Auth.TokenTTLHours = def.Auth.TokenTTLHours
+		case "logging.level":
+			c.Logging.Level = def.Logging.Level
+		case "logging.maxSizeMb":
+			c.Logging.MaxSizeMB = def.Logging.MaxSizeMB
+		case "logging.maxFiles":
+			c.Logging.MaxFiles = def.Logging.MaxFiles
+		case "network.readAheadMs":
+			c.Network.ReadAheadMs = def.Network.ReadAheadMs
+		case "network.preBufferMs":
+			c.Network.PreBufferMs = min(def.Network.PreBufferMs, c.Network.ReadAheadMs)
+		case "network.cacheMaxMb":
+			c.Network.CacheMaxMB = def.Network.CacheMaxMB
+		case "scanner.workers":
+			c.Scanner.Workers = def.Scanner.Workers
+		case "scanner.niceLevel":
+			c.Scanner.NiceLevel = def.Scanner.NiceLevel
+		case "scanner.probeTimeoutMs":
+			c.Scanner.ProbeTimeoutMs = def.Scanner.ProbeTimeoutMs
+		case "libraryScan":
+			c.LibraryScan = def.LibraryScan
+		case "stations":
+			c.Stations = def.Stations
+		case "profiles":
+			c.Profiles = def.Profiles
+		case "podcasts.refreshMinutes":
+			c.Podcasts.RefreshMinutes = def.Podcasts.RefreshMinutes
+		case "transcode":
+			c.Transcode.TranscodeProfile = def.Transcode.TranscodeProfile
+		case "transcode.renderers":
+			c.Transcode.Renderers = def.Transcode.Renderers
+		case "transcode.cacheMaxMb":
+			c.Transcode.CacheMaxMB = def.Transcode.CacheMaxMB
+		case "notifications.timeoutMs":
+			c.Notifications.TimeoutMs = def.Notifications.TimeoutMs
+		// Bad combos are unbound, as the default may be what they clash with
+		case "hotkeys.playPause":
+			c.Hotkeys.PlayPause = ""
+		case "hotkeys.next":
+			c.Hotkeys.Next = ""
+		case "hotkeys.previous":
+			c.Hotkeys.Previous = ""
+		case "hotkeys.volumeUp":
+			c.Hotkeys.VolumeUp = ""
+		case "hotkeys.volumeDown":
+			c.Hotkeys.VolumeDown = ""
+		case "mqtt.broker":
+			c.MQTT.Broker = def.MQTT.Broker
+		case "mqtt.topicPrefix":
+			c.MQTT.TopicPrefix = def.MQTT.TopicPrefix
+		case "mqtt.discoveryPrefix":
+			c.MQTT.DiscoveryPrefix = def.MQTT.DiscoveryPrefix
+		case "mqtt.nodeId":
+			c.MQTT.NodeID = def.MQTT.NodeID
+		case "overlay.file":
+			c.Overlay.File = def.Overlay.File
+		case "overlay.format":
+			c.Overlay.Format = def.Overlay.Format
+		case "overlay.template":
+			c.Overlay.Template = def.Overlay.Template
+		case "overlay.listenAddr":
+			c.Overlay.ListenAddr = def.Overlay.ListenAddr
+		case "overlay.theme":
+			c.Overlay.Theme = def.Overlay.Theme
+		case "memory.budgetMb":
+			c.Memory.BudgetMB = def.Memory.BudgetMB
+		case "memory.cacheMb":
+			c.Memory.CacheMB = def.Memory.CacheMB
+		case "party.voteSkipPercent":
+			c.Party.VoteSkipPercent = def.Party.VoteSkipPercent
+		}
+	}
+	return errs
+}
+
+// zonesError describes the first problem with the output zones, or returns ""
+func zonesError(zones []ZoneConfig) string {
+	seen := make(map[string]bool, len(zones))
+	for i, z := range zones {
+		switch {
+		case z.Name == "":
+			return fmt.Sprintf("zone %d has no name", i)
+		case z.Name == LocalZoneName:
+			return fmt.Sprintf("%q is reserved for the default device", LocalZoneName)
+		case seen[z.Name]:
+			return fmt.Sprintf("zone %q is listed more than once", z.Name)
+		case z.Snapcast != "" && len(z.Command) > 0:
+			return fmt.Sprintf("zone %q can't have both a command and a Snapcast server", z.Name)
+		case z.Snapcast != "" && !isHostPort(z.Snapcast):
+			return fmt.Sprintf("zone %q Snapcast server must be host:port", z.Name)
+		case z.Snapcast == "" && (len(z.Command) == 0 || z.Command[0] == ""):
+			return fmt.Sprintf("zone %q has no command", z.Name)
+		case z.VolumeLevel() < 0 || z.VolumeLevel() > 1:
+			return fmt.Sprintf("zone %q volume must be between 0.0 and 1.0", z.Name)
+		}
+		seen[z.Name] = true
+	}
+	return ""
+}
+
+// scanOptionsError describes the first problem with the library scan
+// options, or returns ""
+func scanOptionsError(options map[string]ScanOptions) string {
+	for dir, opts := range options {
+		switch {
+		case opts.MinDurationMs < 0:
+			return fmt.Sprintf("%s minDurationMs must not be negative", dir)
+		case opts.MaxDepth < 0:
+			return fmt.Sprintf("%s maxDepth must not be negative", dir)
+		}
+		for _, pattern := range opts.Exclude {
+			if msg := excludePatternError(pattern); msg != "" {
+				return fmt.Sprintf("%s exclude pattern %q %s", dir, pattern, msg)
+			}
+		}
+	}
+	return ""
+}
+
+// excludePatternError describes what is wrong with a scan exclude pattern,
+// or returns ""
+func excludePatternError(pattern string) string {
+	if pattern == "" || strings.HasPrefix(pattern, "/") {
+		return "must be relative to the library path"
+	}
+	for _, part := range strings.Split(pattern, "/") {
+		if part == "**" {
+			continue
+		}
+		if _, err := path.Match(part, ""); err != nil {
+			return "is not a valid glob"
+		}
+	}
+	return ""
+}
+
+// transcodeProfileError describes the first problem with a transcode profile,
+// or returns "". A renderer's profile may leave the bitrate at 0 to inherit
+// it.
+func transcodeProfileError(p TranscodeProfile, inherits bool) string {
+	if p.Format != "" && !slices.Contains(TranscodeFormats, p.Format) {
+		return fmt.Sprintf("format must be one of %v or empty", TranscodeFormats)
+	}
+	if !(inherits && p.BitrateKbps == 0) && (p.BitrateKbps < MinTranscodeKbps || p.BitrateKbps > MaxTranscodeKbps) {
+		return fmt.Sprintf("bitrateKbps must be between %d and %d", MinTranscodeKbps, MaxTranscodeKbps)
+	}
+	for _, ext := range p.Extensions {
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			return fmt.Sprintf("extension %q must start with a dot", ext)
+		}
+	}
+	return ""
+}
+
+// stationsError describes the first problem with the saved stations, or
+// returns ""
+func stationsError(stations []StationConfig) string {
+	seen := make(map[string]bool, len(stations))
+	for i, st := range stations {
+		switch {
+		case st.Name == "":
+			return fmt.Sprintf("station %d has no name", i)
+		case seen[st.Name]:
+			return fmt.Sprintf("station %q is listed more than once", st.Name)
+		case !isStreamURL(st.URL):
+			return fmt.Sprintf("station %q URL must be http:// or https://", st.Name)
+		}
+		seen[st.Name] = true
+	}
+	return ""
+}
+
+// profilesError describes the first problem with the playback profiles, or
+// returns ""
+func profilesError(profiles []ProfileConfig) string {
+	seen := make(map[string]bool, len(profiles))
+	starts := make(map[int]string, len(profiles))
+	for i, p := range profiles {
+		switch {
+		case p.Name == "":
+			return fmt.Sprintf("profile %d has no name", i)
+		case seen[p.Name]:
+			return fmt.Sprintf("profile %q is listed more than once", p.Name)
+		case p.Volume != nil && (*p.Volume < 0 || *p.Volume > 1):
+			return fmt.Sprintf("profile %q volume must be between 0.0 and 1.0", p.Name)
+		case p.Seed != "" && p.SeedCommunity != nil:
+			return fmt.Sprintf("profile %q can't have both a seed and a seed community", p.Name)
+		}
+		switch p.ContinueMode {
+		case "", "off", "similar", "random":
+		default:
+			return fmt.Sprintf("profile %q continueMode must be \"off\", \"similar\" or \"random\"", p.Name)
+		}
+		if p.Start != "" {
+			start, ok := parseTimeOfDay(p.Start)
+			if !ok {
+				return fmt.Sprintf("profile %q start must be a time of day like \"08:30\"", p.Name)
+			}
+			if other, taken := starts[start]; taken {
+				return fmt.Sprintf("profiles %q and %q start at the same time", other, p.Name)
+			}
+			starts[start] = p.Name
+		}
+		seen[p.Name] = true
+	}
+	return ""
+}
+
+// mqttTopicError describes the problem with a topic prefix, or returns ""
+func mqttTopicError(prefix string) string {
+	switch {
+	case prefix == "":
+		return "must not be empty"
+	case strings.ContainsAny(prefix, "+#"):
+		return "must not hold the wildcards + or #"
+	case strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/"):
+		return "must not start or end with /"
+	}
+	return ""
+}
+
+func isStreamURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func isHostPort(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	return err == nil && host != "" && port != ""
+}
+
+func isValidSampleRate(rate int) bool {
+	for _, r := range ValidSampleRates {
+		if r == rate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// DefaultWatchInterval is how often Watch checks the config file for edits
+const DefaultWatchInterval = 2 * time.Second
+
+// Watch polls the config file until ctx is cancelled and applies edits made
+// outside the daemon. Polling is used rather than filesystem notifications
+// because editors commonly replace the file, which drops inotify watches.
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastMod time.Time
+	var lastSize int64
+	if info, err := os.Stat(m.configPath); err == nil {
+		lastMod, lastSize = info.ModTime(), info.Size()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(m.configPath)
+		if err != nil {
+			continue // Mid-replace or deleted; keep the running config
+		}
+		if info.ModTime().Equal(lastMod) && info.Size() == lastSize {
+			continue
+		}
+		lastMod, lastSize = info.ModTime(), info.Size()
+
+		m.reload()
+	}
+}
+
+// reload re-reads the config file and applies it if it differs from what the
+// daemon last read or wrote. Invalid files are ignored so a half-finished edit
+// does not disturb playback.
+func (m *Manager) reload() bool {
+	data, err := os.ReadFile(m.configPath)
+	if err != nil {
+		log.Printf("[CONFIG] Warning: failed to read %s: %v", m.configPath, err)
+		return false
+	}
+
+	m.mu.Lock()
+	if bytes.Equal(data, m.lastData) {
+		m.mu.Unlock()
+		return false
+	}
+	// Remember the content either way so a broken file is only reported once
+	m.lastData = data
+
+	config, _, err := parseConfig(data)
+	if err != nil {
+		m.mu.Unlock()
+		log.Printf("[CONFIG] Warning: ignoring edit to %s: %v", m.configPath, err)
+		return false
+	}
+	for _, fe := range config.repair() {
+		log.Printf("[CONFIG] Warning: %v; using default", fe)
+	}
+	if err := ValidateLibraryPaths(config.LibraryPaths); err != nil {
+		log.Printf("[CONFIG] Warning: %v", err)
+	}
+
+	old := m.config
+	m.config = config
+	cb := m.onChange
+	m.mu.Unlock()
+
+	log.Printf("[CONFIG] Reloaded %s", m.configPath)
+	if cb != nil {
+		cb(old, config)
+	}
+	return true
+}
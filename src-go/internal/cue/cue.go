@@ -0,0 +1,281 @@
+// Package cue reads CUE sheets, which describe the tracks of an album ripped
+// to a single image file, and names the virtual tracks played from them.
+package cue
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// framesPerSecond is the resolution of CUE sheet times, in CD frames
+const framesPerSecond = 75
+
+// imageExtensions are tried, in order, when the file a sheet names is
+// missing, as images are often re-encoded after the sheet was written
+var imageExtensions = []string{".flac", ".ape", ".wv", ".wav"}
+
+// Sheet is a parsed CUE sheet
+type Sheet struct {
+	Path      string   // The .cue file, set by Load
+	Title     string   // Album title
+	Performer string   // Album artist
+	Genre     string   // From REM GENRE
+	Year      int      // From REM DATE
+	Files     []string // Audio files the tracks play from, in order
+	Tracks    []Track
+}
+
+// Track is one audio track of a sheet
+type Track struct {
+	Number    int
+	Title     string
+	Performer string
+	File      string        // Audio file the track plays from
+	Start     time.Duration // Offset of INDEX 01 into File
+	End       time.Duration // Start of the next track in File, 0 for the end of the file
+}
+
+// Load reads a CUE sheet, resolving the files it names against its folder
+func Load(path string) (*Sheet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sheet, err := Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	sheet.Path = path
+
+	dir := filepath.Dir(path)
+	resolved := make(map[string]string, len(sheet.Files))
+	for i, name := range sheet.Files {
+		resolved[name] = resolveFile(dir, name)
+		sheet.Files[i] = resolved[name]
+	}
+	for i := range sheet.Tracks {
+		sheet.Tracks[i].File = resolved[sheet.Tracks[i].File]
+	}
+	return sheet, nil
+}
+
+// resolveFile finds the file a sheet names, falling back to a file of the
+// same name with another image extension
+func resolveFile(dir, name string) string {
+	path := filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	stem := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range imageExtensions {
+		if _, err := os.Stat(stem + ext); err == nil {
+			return stem + ext
+		}
+	}
+	return path
+}
+
+// Parse reads a CUE sheet. File names are left as written in the sheet.
+// Sheets that aren't valid UTF-8 are read as Latin-1, which is what most
+// older rippers wrote.
+func Parse(r io.Reader) (*Sheet, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	text := string(data)
+	if !utf8.Valid(data) {
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+
+	sheet := &Sheet{}
+	var file string
+	var track *Track
+	hasStart := false
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; scanner.Scan(); line++ {
+		command, args, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		args = strings.TrimSpace(args)
+
+		switch strings.ToUpper(command) {
+		case "REM":
+			key, value, _ := strings.Cut(args, " ")
+			value = unquote(strings.TrimSpace(value))
+			switch strings.ToUpper(key) {
+			case "GENRE":
+				sheet.Genre = value
+			case "DATE":
+				if len(value) >= 4 {
+					sheet.Year, _ = strconv.Atoi(value[:4])
+				}
+			}
+		case "TITLE":
+			if track != nil {
+				track.Title = unquote(args)
+			} else {
+				sheet.Title = unquote(args)
+			}
+		case "PERFORMER":
+			if track != nil {
+				track.Performer = unquote(args)
+			} else {
+				sheet.Performer = unquote(args)
+			}
+		case "FILE":
+			// The file type follows the name, which may hold spaces
+			if i := strings.LastIndex(args, " "); i > 0 {
+				args = strings.TrimSpace(args[:i])
+			}
+			file = unquote(args)
+			sheet.Files = append(sheet.Files, file)
+		case "TRACK":
+			if track != nil && !hasStart {
+				return nil, fmt.Errorf("line %d: track %d has no INDEX 01", line, track.Number)
+			}
+			track = nil
+			fields := strings.Fields(args)
+			if len(fields) < 2 || !strings.EqualFold(fields[1], "AUDIO") {
+				continue // Data tracks have no audio to play
+			}
+			if file == "" {
+				return nil, fmt.Errorf("line %d: TRACK before FILE", line)
+			}
+			n, err := strconv.Atoi(fields[0])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("line %d: invalid track number %q", line, fields[0])
+			}
+			sheet.Tracks = append(sheet.Tracks, Track{Number: n, File: file})
+			track = &sheet.Tracks[len(sheet.Tracks)-1]
+			hasStart = false
+		case "INDEX":
+			fields := strings.Fields(args)
+			if track == nil || len(fields) < 2 || fields[0] != "01" {
+				continue // Pregaps (INDEX 00) play as the end of the previous track
+			}
+			start, err := parseTime(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			track.Start = start
+			hasStart = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if track != nil && !hasStart {
+		return nil, fmt.Errorf("track %d has no INDEX 01", track.Number)
+	}
+	if len(sheet.Tracks) == 0 {
+		return nil, fmt.Errorf("no audio tracks")
+	}
+
+	// Each track runs until the next one in the same file starts
+	for i := range sheet.Tracks[:len(sheet.Tracks)-1] {
+		if next := sheet.Tracks[i+1]; next.File == sheet.Tracks[i].File {
+			sheet.Tracks[i].End = next.Start
+		}
+	}
+	return sheet, nil
+}
+
+// parseTime parses an mm:ss:ff time, where ff is in CD frames
+func parseTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var n [3]int
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		n[i] = v
+	}
+	if n[1] >= 60 || n[2] >= framesPerSecond {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(n[0])*time.Minute + time.Duration(n[1])*time.Second +
+		time.Duration(n[2])*time.Second/framesPerSecond, nil
+}
+
+// unquote strips the quotes around a value, if it has them
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Image returns the one file all of the sheet's tracks play from. ok is
+// false for sheets with a file per track, whose files are tracks already.
+func (s *Sheet) Image() (string, bool) {
+	if len(s.Files) != 1 {
+		return "", false
+	}
+	return s.Files[0], true
+}
+
+// Track returns the track with the given number
+func (s *Sheet) Track(number int) (Track, bool) {
+	for _, t := range s.Tracks {
+		if t.Number == number {
+			return t, true
+		}
+	}
+	return Track{}, false
+}
+
+// TrackPath names a track of a sheet, for use wherever a track is named by
+// its file path
+func TrackPath(sheetPath string, number int) string {
+	return sheetPath + "#" + strconv.Itoa(number)
+}
+
+// SplitTrackPath returns the sheet and track number of a path made by
+// TrackPath. ok is false for any other path.
+func SplitTrackPath(path string) (sheetPath string, number int, ok bool) {
+	i := strings.LastIndexByte(path, '#')
+	if i < 0 || !strings.EqualFold(filepath.Ext(path[:i]), ".cue") {
+		return "", 0, false
+	}
+	number, err := strconv.Atoi(path[i+1:])
+	if err != nil || number <= 0 {
+		return "", 0, false
+	}
+	return path[:i], number, true
+}
+
+// LoadTrack loads the track a path made by TrackPath names. ok is false for
+// any other path.
+func LoadTrack(path string) (sheet *Sheet, track Track, ok bool, err error) {
+	sheetPath, number, ok := SplitTrackPath(path)
+	if !ok {
+		return nil, Track{}, false, nil
+	}
+	if sheet, err = Load(sheetPath); err != nil {
+		return nil, Track{}, true, err
+	}
+	if track, ok = sheet.Track(number); !ok {
+		return nil, Track{}, true, fmt.Errorf("%s has no track %d", filepath.Base(sheetPath), number)
+	}
+	return sheet, track, true, nil
+}
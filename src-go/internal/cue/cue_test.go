@@ -0,0 +1,119 @@
+package cue
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const albumSheet = `REM GENRE "Progressive Rock"
+REM DATE 1973
+PERFORMER "Pink Floyd"
+TITLE "The Dark Side of the Moon"
+FILE "Pink Floyd - The Dark Side of the Moon.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "Speak to Me"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Breathe"
+    PERFORMER "Pink Floyd feat. Nobody"
+    INDEX 00 01:07:30
+    INDEX 01 01:08:45
+  TRACK 03 AUDIO
+    TITLE "On the Run"
+    INDEX 01 03:57:00
+`
+
+func TestParse(t *testing.T) {
+	sheet, err := Parse(strings.NewReader(albumSheet))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sheet.Title != "The Dark Side of the Moon" || sheet.Performer != "Pink Floyd" ||
+		sheet.Genre != "Progressive Rock" || sheet.Year != 1973 {
+		t.Errorf("unexpected album tags: %+v", sheet)
+	}
+	if image, ok := sheet.Image(); !ok || image != "Pink Floyd - The Dark Side of the Moon.wav" {
+		t.Errorf("expected a single image, got %q (%v)", image, ok)
+	}
+
+	want := []Track{
+		{Number: 1, Title: "Speak to Me", Start: 0, End: 68*time.Second + 600*time.Millisecond},
+		{Number: 2, Title: "Breathe", Performer: "Pink Floyd feat. Nobody", Start: 68*time.Second + 600*time.Millisecond, End: 237 * time.Second},
+		{Number: 3, Title: "On the Run", Start: 237 * time.Second},
+	}
+	if len(sheet.Tracks) != len(want) {
+		t.Fatalf("expected %d tracks, got %d", len(want), len(sheet.Tracks))
+	}
+	for i, w := range want {
+		w.File = "Pink Floyd - The Dark Side of the Moon.wav"
+		if sheet.Tracks[i] != w {
+			t.Errorf("track %d: expected %+v, got %+v", i+1, w, sheet.Tracks[i])
+		}
+	}
+}
+
+func TestParseLatin1(t *testing.T) {
+	sheet, err := Parse(strings.NewReader("TITLE \"Caf\xe9\"\nFILE a.flac WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:00\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheet.Title != "Café" {
+		t.Errorf("expected Latin-1 title to be decoded, got %q", sheet.Title)
+	}
+	if sheet.Files[0] != "a.flac" {
+		t.Errorf("expected unquoted file name, got %q", sheet.Files[0])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"no tracks":      "FILE a.flac WAVE\n",
+		"no index":       "FILE a.flac WAVE\nTRACK 01 AUDIO\nTRACK 02 AUDIO\nINDEX 01 00:10:00\n",
+		"bad time":       "FILE a.flac WAVE\nTRACK 01 AUDIO\nINDEX 01 00:75:00\n",
+		"track not file": "TRACK 01 AUDIO\nINDEX 01 00:00:00\n",
+	}
+	for name, text := range cases {
+		if _, err := Parse(strings.NewReader(text)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadFindsReencodedImage(t *testing.T) {
+	dir := t.TempDir()
+	sheetPath := filepath.Join(dir, "album.cue")
+	if err := os.WriteFile(sheetPath, []byte(albumSheet), 0644); err != nil {
+		t.Fatal(err)
+	}
+	image := filepath.Join(dir, "Pink Floyd - The Dark Side of the Moon.flac")
+	if err := os.WriteFile(image, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sheet, track, ok, err := LoadTrack(TrackPath(sheetPath, 2))
+	if err != nil || !ok {
+		t.Fatalf("expected track to load, got %v (%v)", err, ok)
+	}
+	if sheet.Path != sheetPath || sheet.Files[0] != image || track.File != image || track.Title != "Breathe" {
+		t.Errorf("expected track 2 of %s to play from %s, got %+v of %+v", sheetPath, image, track, sheet)
+	}
+
+	if _, _, ok, err := LoadTrack(TrackPath(sheetPath, 9)); !ok || err == nil {
+		t.Errorf("expected an error for a missing track, got %v (%v)", err, ok)
+	}
+}
+
+func TestSplitTrackPath(t *testing.T) {
+	if sheet, n, ok := SplitTrackPath(TrackPath("/music/A #1/album.cue", 12)); !ok || sheet != "/music/A #1/album.cue" || n != 12 {
+		t.Errorf("expected round trip, got %q %d %v", sheet, n, ok)
+	}
+	for _, path := range []string{"/music/Track #1.flac", "/music/album.cue", "/music/album.cue#x", "/music/album.cue#0"} {
+		if _, _, ok := SplitTrackPath(path); ok {
+			t.Errorf("%s: expected not to be a CUE track", path)
+		}
+	}
+}
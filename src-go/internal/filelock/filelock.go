@@ -0,0 +1,9 @@
+// Package filelock takes exclusive advisory locks on files. A lock is held
+// until the file is closed or the process holding it exits, so a lock that
+// can be taken is one nobody alive is using.
+package filelock
+
+import "errors"
+
+// ErrLocked is returned by TryLock when another process holds the lock
+var ErrLocked = errors.New("lock held by another process")
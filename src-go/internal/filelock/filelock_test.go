@@ -0,0 +1,35 @@
+package filelock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	open := func() *os.File {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	first := open()
+	if err := TryLock(first); err != nil {
+		t.Fatalf("Expected the lock, got %v", err)
+	}
+	second := open()
+	defer second.Close()
+	if err := TryLock(second); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected ErrLocked while it's held, got %v", err)
+	}
+
+	// Closing the file releases the lock
+	first.Close()
+	if err := TryLock(second); err != nil {
+		t.Errorf("Expected the lock once released, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+// Package focus times focus sessions: a stretch of music, such as a
+// pomodoro, that ends on its own after a set number of minutes.
+package focus
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MaxMinutes is the longest a focus session can run
+const MaxMinutes = 12 * 60
+
+// minute is the length of a session minute, shortened in tests
+var minute = time.Minute
+
+// What happens to playback when a session runs out
+const (
+	EndPause    = "pause"    // Pause where it got to
+	EndStop     = "stop"     // Stop playback
+	EndContinue = "continue" // Keep playing
+)
+
+// Session is a running or finished focus session
+type Session struct {
+	Playlist    string
+	EndBehavior string
+	Normalize   bool // Volume levelling was turned on for the session
+	StartedAt   time.Time
+	EndsAt      time.Time
+}
+
+// Options are what a session is started with
+type Options struct {
+	Minutes     int
+	Playlist    string
+	EndBehavior string // Defaults to EndPause
+	Normalize   bool
+}
+
+// Validate checks the options and fills in defaults
+func (o *Options) Validate() error {
+	if o.Minutes < 1 || o.Minutes > MaxMinutes {
+		return fmt.Errorf("minutes must be between 1 and %d", MaxMinutes)
+	}
+	switch o.EndBehavior {
+	case "":
+		o.EndBehavior = EndPause
+	case EndPause, EndStop, EndContinue:
+	default:
+		return errors.New(`endBehavior must be "pause", "stop" or "continue"`)
+	}
+	return nil
+}
+
+// Timer runs one focus session at a time, calling back when it runs out. It
+// is safe for concurrent use.
+type Timer struct {
+	mu      sync.Mutex
+	current *Session
+	timer   *time.Timer
+	onEnd   func(s Session, completed bool)
+}
+
+// NewTimer creates a focus session timer. onEnd is called when a session
+// runs out (completed) or is ended early by Stop or a new session.
+func NewTimer(onEnd func(s Session, completed bool)) *Timer {
+	return &Timer{onEnd: onEnd}
+}
+
+// Start begins a session, ending any that is running first
+func (t *Timer) Start(opts Options) (Session, error) {
+	if err := opts.Validate(); err != nil {
+		return Session{}, err
+	}
+	t.Stop()
+
+	now := time.Now()
+	session := &Session{
+		Playlist:    opts.Playlist,
+		EndBehavior: opts.EndBehavior,
+		Normalize:   opts.Normalize,
+		StartedAt:   now,
+		EndsAt:      now.Add(time.Duration(opts.Minutes) * minute),
+	}
+
+	t.mu.Lock()
+	t.current = session
+	t.timer = time.AfterFunc(session.EndsAt.Sub(now), func() { t.end(session, true) })
+	t.mu.Unlock()
+	return *session, nil
+}
+
+// Stop ends the running session early. It reports false if none was running.
+func (t *Timer) Stop() (Session, bool) {
+	t.mu.Lock()
+	session := t.current
+	t.mu.Unlock()
+	if session == nil {
+		return Session{}, false
+	}
+	return *session, t.end(session, false)
+}
+
+// Current returns the running session, if any
+func (t *Timer) Current() (Session, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil {
+		return Session{}, false
+	}
+	return *t.current, true
+}
+
+// end finishes session unless it has already ended, and reports whether it
+// did
+func (t *Timer) end(session *Session, completed bool) bool {
+	t.mu.Lock()
+	if t.current != session {
+		t.mu.Unlock()
+		return false
+	}
+	t.current = nil
+	t.timer.Stop()
+	t.mu.Unlock()
+
+	if t.onEnd != nil {
+		t.onEnd(*session, completed)
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package focus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	opts := Options{Minutes: 25}
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if opts.EndBehavior != EndPause {
+		t.Errorf("Expected endBehavior to default to pause, got %q", opts.EndBehavior)
+	}
+
+	for _, bad := range []Options{
+		{Minutes: 0},
+		{Minutes: MaxMinutes + 1},
+		{Minutes: 25, EndBehavior: "explode"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestTimerRunsOut(t *testing.T) {
+	defer func(m time.Duration) { minute = m }(minute)
+	minute = 10 * time.Millisecond
+
+	ended := make(chan bool, 1)
+	timer := NewTimer(func(s Session, completed bool) {
+		if s.Playlist != "focus" {
+			t.Errorf("Expected the focus session to end, got %q", s.Playlist)
+		}
+		ended <- completed
+	})
+	if _, err := timer.Start(Options{Minutes: 1, Playlist: "focus"}); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if _, ok := timer.Current(); !ok {
+		t.Fatal("Expected a running session")
+	}
+
+	select {
+	case completed := <-ended:
+		if !completed {
+			t.Error("Expected the session to complete")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Session never ended")
+	}
+	if _, ok := timer.Current(); ok {
+		t.Error("Expected no running session after it ended")
+	}
+}
+
+func TestTimerStop(t *testing.T) {
+	var ends []bool
+	timer := NewTimer(func(s Session, completed bool) { ends = append(ends, completed) })
+
+	if _, ok := timer.Stop(); ok {
+		t.Error("Expected Stop to report no session")
+	}
+	timer.Start(Options{Minutes: 25, Playlist: "first"})
+	timer.Start(Options{Minutes: 25, Playlist: "second"})
+	if s, ok := timer.Current(); !ok || s.Playlist != "second" {
+		t.Errorf("Expected the second session to run, got %+v", s)
+	}
+	if s, ok := timer.Stop(); !ok || s.Playlist != "second" {
+		t.Errorf("Expected Stop to end the second session, got %+v", s)
+	}
+	if len(ends) != 2 || ends[0] || ends[1] {
+		t.Errorf("Expected both sessions to end early, got %v", ends)
+	}
+}
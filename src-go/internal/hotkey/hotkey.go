@@ -0,0 +1,136 @@
+// Package hotkey listens for global keyboard shortcuts, so playback can be
+// controlled from any application on desktops where media keys don't reach
+// the daemon.
+package hotkey
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Action is what a hotkey does
+type Action string
+
+const (
+	ActionPlayPause  Action = "playPause"
+	ActionNext       Action = "next"
+	ActionPrevious   Action = "previous"
+	ActionVolumeUp   Action = "volumeUp"
+	ActionVolumeDown Action = "volumeDown"
+)
+
+// Modifiers is a set of modifier keys
+type Modifiers uint8
+
+const (
+	ModCtrl Modifiers = 1 << iota
+	ModAlt
+	ModShift
+	ModSuper // The Windows, Command or logo key
+)
+
+// modifierNames maps the names accepted in combos to modifiers
+var modifierNames = map[string]Modifiers{
+	"ctrl":    ModCtrl,
+	"control": ModCtrl,
+	"alt":     ModAlt,
+	"option":  ModAlt,
+	"shift":   ModShift,
+	"super":   ModSuper,
+	"win":     ModSuper,
+	"meta":    ModSuper,
+	"cmd":     ModSuper,
+}
+
+// namedKeys maps the names of keys other than letters, digits and function
+// keys to the name combos use for them
+var namedKeys = map[string]string{
+	"space":    "Space",
+	"left":     "Left",
+	"right":    "Right",
+	"up":       "Up",
+	"down":     "Down",
+	"home":     "Home",
+	"end":      "End",
+	"pageup":   "PageUp",
+	"pagedown": "PageDown",
+	"insert":   "Insert",
+	"delete":   "Delete",
+}
+
+// Combo is a key pressed together with modifiers, e.g. Ctrl+Alt+P
+type Combo struct {
+	Mods Modifiers
+	Key  string // "A"-"Z", "0"-"9", "F1"-"F24" or a namedKeys value
+}
+
+// ParseCombo reads a combo such as "ctrl+alt+p" or "Super+Shift+Right".
+// Names are case-insensitive, and at least one modifier is needed so a
+// hotkey doesn't take a key away from typing.
+func ParseCombo(s string) (Combo, error) {
+	parts := strings.Split(s, "+")
+	var c Combo
+	for i, part := range parts {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if i < len(parts)-1 {
+			mod, ok := modifierNames[name]
+			if !ok {
+				return Combo{}, fmt.Errorf("unknown modifier %q", part)
+			}
+			c.Mods |= mod
+			continue
+		}
+		key, ok := keyName(name)
+		if !ok {
+			return Combo{}, fmt.Errorf("unknown key %q", part)
+		}
+		c.Key = key
+	}
+	if c.Mods == 0 {
+		return Combo{}, errors.New("needs at least one modifier")
+	}
+	return c, nil
+}
+
+// keyName returns the combo name of a lower case key name
+func keyName(name string) (string, bool) {
+	if len(name) == 1 && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= '0' && name[0] <= '9') {
+		return strings.ToUpper(name), true
+	}
+	if key, ok := namedKeys[name]; ok {
+		return key, true
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(name, "f")); err == nil && strings.HasPrefix(name, "f") && n >= 1 && n <= 24 {
+		return "F" + strconv.Itoa(n), true
+	}
+	return "", false
+}
+
+func (c Combo) String() string {
+	var parts []string
+	for _, mod := range []struct {
+		mod  Modifiers
+		name string
+	}{{ModCtrl, "Ctrl"}, {ModAlt, "Alt"}, {ModShift, "Shift"}, {ModSuper, "Super"}} {
+		if c.Mods&mod.mod != 0 {
+			parts = append(parts, mod.name)
+		}
+	}
+	return strings.Join(append(parts, c.Key), "+")
+}
+
+// Binding ties a combo to an action
+type Binding struct {
+	Action Action
+	Combo  Combo
+}
+
+// Handler is called with the action of each hotkey pressed
+type Handler func(action Action)
+
+// Listener is a running hotkey listener
+type Listener interface {
+	Close() error
+}
@@ -0,0 +1,216 @@
+//go:build linux
+
+package hotkey
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Hotkeys are bound through the GlobalShortcuts desktop portal, which works
+// on Wayland as well as X11 and lets the desktop show and change them
+const (
+	portalBusName      = "org.freedesktop.portal.Desktop"
+	portalObjectPath   = "/org/freedesktop/portal/desktop"
+	shortcutsInterface = "org.freedesktop.portal.GlobalShortcuts"
+	requestInterface   = "org.freedesktop.portal.Request"
+	sessionInterface   = "org.freedesktop.portal.Session"
+
+	// portalTimeout is how long to wait for the portal to answer, which
+	// may include the user confirming the shortcuts in a dialog
+	portalTimeout = 2 * time.Minute
+)
+
+// requestCounter makes portal request tokens unique
+var requestCounter atomic.Uint64
+
+// portalKeys maps combo key names to the keysym names the portal takes
+var portalKeys = map[string]string{
+	"Space":    "space",
+	"PageUp":   "Page_Up",
+	"PageDown": "Page_Down",
+}
+
+// portalListener is a GlobalShortcuts session
+type portalListener struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+	signals chan *dbus.Signal
+}
+
+// Listen binds the hotkeys through the GlobalShortcuts portal and calls
+// handler from its own goroutine as they are pressed
+func Listen(bindings []Binding, handler Handler) (Listener, error) {
+	// A connection of our own, so closing it doesn't affect MPRIS
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+	l := &portalListener{conn: conn, signals: make(chan *dbus.Signal, 16)}
+	conn.Signal(l.signals)
+
+	if err := l.bind(bindings); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go l.run(handler)
+	return l, nil
+}
+
+func (l *portalListener) bind(bindings []Binding) error {
+	if err := l.conn.AddMatchSignal(
+		dbus.WithMatchInterface(shortcutsInterface),
+		dbus.WithMatchMember("Activated"),
+	); err != nil {
+		return err
+	}
+
+	results, err := l.request("CreateSession", func(options map[string]dbus.Variant) []interface{} {
+		options["session_handle_token"] = dbus.MakeVariant("musicd")
+		return []interface{}{options}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create shortcuts session: %w", err)
+	}
+	handle, _ := results["session_handle"].Value().(string)
+	if handle == "" {
+		return errors.New("portal returned no shortcuts session")
+	}
+	l.session = dbus.ObjectPath(handle)
+
+	type shortcut struct {
+		ID    string
+		Props map[string]dbus.Variant
+	}
+	shortcuts := make([]shortcut, len(bindings))
+	for i, b := range bindings {
+		shortcuts[i] = shortcut{ID: string(b.Action), Props: map[string]dbus.Variant{
+			"description":       dbus.MakeVariant(description(b.Action)),
+			"preferred_trigger": dbus.MakeVariant(portalTrigger(b.Combo)),
+		}}
+	}
+	if _, err := l.request("BindShortcuts", func(options map[string]dbus.Variant) []interface{} {
+		return []interface{}{l.session, shortcuts, "", options}
+	}); err != nil {
+		l.closeSession()
+		return fmt.Errorf("failed to bind shortcuts: %w", err)
+	}
+	return nil
+}
+
+// request calls a portal method and waits for its Response. args gets the
+// options with the request's handle token set and returns the arguments.
+func (l *portalListener) request(method string, args func(options map[string]dbus.Variant) []interface{}) (map[string]dbus.Variant, error) {
+	token := fmt.Sprintf("musicd%d", requestCounter.Add(1))
+	path := requestPath(l.conn, token)
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface(requestInterface),
+		dbus.WithMatchMember("Response"),
+	}
+	if err := l.conn.AddMatchSignal(match...); err != nil {
+		return nil, err
+	}
+	defer l.conn.RemoveMatchSignal(match...)
+
+	options := map[string]dbus.Variant{"handle_token": dbus.MakeVariant(token)}
+	call := l.conn.Object(portalBusName, portalObjectPath).Call(shortcutsInterface+"."+method, 0, args(options)...)
+	if call.Err != nil {
+		return nil, call.Err
+	}
+
+	timeout := time.After(portalTimeout)
+	for {
+		select {
+		case sig := <-l.signals:
+			if sig.Path != path || sig.Name != requestInterface+".Response" || len(sig.Body) < 2 {
+				continue
+			}
+			response, _ := sig.Body[0].(uint32)
+			results, _ := sig.Body[1].(map[string]dbus.Variant)
+			switch response {
+			case 0:
+				return results, nil
+			case 1:
+				return nil, errors.New("cancelled by the user")
+			default:
+				return nil, errors.New("refused by the portal")
+			}
+		case <-timeout:
+			return nil, errors.New("no response from the portal")
+		}
+	}
+}
+
+// requestPath returns the object path the portal answers a request with
+// token on
+func requestPath(conn *dbus.Conn, token string) dbus.ObjectPath {
+	sender := strings.ReplaceAll(strings.TrimPrefix(conn.Names()[0], ":"), ".", "_")
+	return dbus.ObjectPath(portalObjectPath + "/request/" + sender + "/" + token)
+}
+
+func (l *portalListener) run(handler Handler) {
+	for sig := range l.signals {
+		if sig.Name != shortcutsInterface+".Activated" || len(sig.Body) < 2 {
+			continue
+		}
+		if session, _ := sig.Body[0].(dbus.ObjectPath); session != l.session {
+			continue
+		}
+		if id, ok := sig.Body[1].(string); ok {
+			handler(Action(id))
+		}
+	}
+}
+
+func (l *portalListener) closeSession() {
+	l.conn.Object(portalBusName, l.session).Call(sessionInterface+".Close", 0)
+}
+
+// Close ends the session, which releases the shortcuts
+func (l *portalListener) Close() error {
+	l.closeSession()
+	return l.conn.Close()
+}
+
+// portalTrigger formats a combo as a shortcut trigger, e.g. "CTRL+ALT+p"
+func portalTrigger(c Combo) string {
+	var parts []string
+	for _, mod := range []struct {
+		mod  Modifiers
+		name string
+	}{{ModCtrl, "CTRL"}, {ModAlt, "ALT"}, {ModShift, "SHIFT"}, {ModSuper, "LOGO"}} {
+		if c.Mods&mod.mod != 0 {
+			parts = append(parts, mod.name)
+		}
+	}
+	key := c.Key
+	if keysym, ok := portalKeys[key]; ok {
+		key = keysym
+	} else if len(key) == 1 {
+		key = strings.ToLower(key)
+	}
+	return strings.Join(append(parts, key), "+")
+}
+
+// description is how the desktop lists an action's shortcut
+func description(action Action) string {
+	switch action {
+	case ActionPlayPause:
+		return "Play or pause"
+	case ActionNext:
+		return "Next track"
+	case ActionPrevious:
+		return "Previous track"
+	case ActionVolumeUp:
+		return "Volume up"
+	case ActionVolumeDown:
+		return "Volume down"
+	}
+	return string(action)
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+
+package hotkey
+
+import "errors"
+
+// Listen returns an error: macOS media keys reach the daemon through the
+// Now Playing integration, and other platforms have no listener
+func Listen(bindings []Binding, handler Handler) (Listener, error) {
+	return nil, errors.New("global hotkeys not supported on this platform")
+}
@@ -0,0 +1,35 @@
+package hotkey
+
+import "testing"
+
+func TestParseCombo(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"ctrl+alt+p", "Ctrl+Alt+P"},
+		{"Alt + Ctrl + Right", "Ctrl+Alt+Right"},
+		{"cmd+shift+f12", "Shift+Super+F12"},
+		{"Control+Option+pagedown", "Ctrl+Alt+PageDown"},
+		{"win+7", "Super+7"},
+	}
+	for _, tt := range tests {
+		combo, err := ParseCombo(tt.in)
+		if err != nil {
+			t.Errorf("ParseCombo(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got := combo.String(); got != tt.want {
+			t.Errorf("ParseCombo(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+		if again, err := ParseCombo(combo.String()); err != nil || again != combo {
+			t.Errorf("Expected %s to parse back to itself, got %+v, %v", combo, again, err)
+		}
+	}
+
+	for _, in := range []string{"", "p", "ctrl+", "hyper+p", "ctrl+f25", "ctrl+enter", "ctrl+alt"} {
+		if combo, err := ParseCombo(in); err == nil {
+			t.Errorf("Expected ParseCombo(%q) to fail, got %s", in, combo)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+//go:build windows
+
+package hotkey
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32                 = windows.NewLazySystemDLL("user32.dll")
+	procRegisterHotKey     = user32.NewProc("RegisterHotKey")
+	procUnregisterHotKey   = user32.NewProc("UnregisterHotKey")
+	procGetMessageW        = user32.NewProc("GetMessageW")
+	procPeekMessageW       = user32.NewProc("PeekMessageW")
+	procPostThreadMessageW = user32.NewProc("PostThreadMessageW")
+)
+
+const (
+	wmQuit   = 0x0012
+	wmHotkey = 0x0312
+
+	modAlt      = 0x0001
+	modControl  = 0x0002
+	modShift    = 0x0004
+	modWin      = 0x0008
+	modNoRepeat = 0x4000
+)
+
+// virtualKeys maps combo key names other than letters, digits and function
+// keys to virtual-key codes
+var virtualKeys = map[string]uint32{
+	"Space":    0x20,
+	"PageUp":   0x21,
+	"PageDown": 0x22,
+	"End":      0x23,
+	"Home":     0x24,
+	"Left":     0x25,
+	"Up":       0x26,
+	"Right":    0x27,
+	"Down":     0x28,
+	"Insert":   0x2D,
+	"Delete":   0x2E,
+}
+
+// msg is a Win32 MSG
+type msg struct {
+	hwnd    uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	pt      struct{ x, y int32 }
+}
+
+// windowsListener registers the hotkeys on a thread of its own, which gets
+// WM_HOTKEY messages as they are pressed
+type windowsListener struct {
+	threadID uint32
+	done     chan struct{}
+}
+
+// Listen registers the hotkeys with RegisterHotKey and calls handler from
+// its own goroutine as they are pressed. Combos already taken by another
+// application are logged and skipped.
+func Listen(bindings []Binding, handler Handler) (Listener, error) {
+	l := &windowsListener{done: make(chan struct{})}
+	started := make(chan error, 1)
+	go func() {
+		// Hotkey messages go to the thread that registered them
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer close(l.done)
+
+		var m msg
+		// Creates the thread's message queue, so Close can post to it
+		procPeekMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0, 0)
+		l.threadID = windows.GetCurrentThreadId()
+
+		registered := 0
+		for i, b := range bindings {
+			r, _, err := procRegisterHotKey.Call(0, uintptr(i+1), uintptr(modifiers(b.Combo)|modNoRepeat), uintptr(virtualKey(b.Combo.Key)))
+			if r == 0 {
+				log.Printf("[HOTKEY] Failed to register %s for %s: %v", b.Combo, b.Action, err)
+				continue
+			}
+			defer procUnregisterHotKey.Call(0, uintptr(i+1))
+			registered++
+		}
+		if registered == 0 && len(bindings) > 0 {
+			started <- fmt.Errorf("none of the %d hotkeys could be registered", len(bindings))
+			return
+		}
+		started <- nil
+
+		for {
+			r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if int32(r) <= 0 {
+				return // WM_QUIT or an error
+			}
+			if id := int(m.wParam); m.message == wmHotkey && id >= 1 && id <= len(bindings) {
+				handler(bindings[id-1].Action)
+			}
+		}
+	}()
+
+	if err := <-started; err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close unregisters the hotkeys
+func (l *windowsListener) Close() error {
+	procPostThreadMessageW.Call(uintptr(l.threadID), wmQuit, 0, 0)
+	<-l.done
+	return nil
+}
+
+func modifiers(c Combo) uint32 {
+	var mods uint32
+	if c.Mods&ModCtrl != 0 {
+		mods |= modControl
+	}
+	if c.Mods&ModAlt != 0 {
+		mods |= modAlt
+	}
+	if c.Mods&ModShift != 0 {
+		mods |= modShift
+	}
+	if c.Mods&ModSuper != 0 {
+		mods |= modWin
+	}
+	return mods
+}
+
+// virtualKey returns the virtual-key code of a combo key name
+func virtualKey(key string) uint32 {
+	if vk, ok := virtualKeys[key]; ok {
+		return vk
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(key, "F")); err == nil && len(key) > 1 {
+		return 0x70 + uint32(n-1) // VK_F1 onwards
+	}
+	return uint32(key[0]) // Letters and digits are their upper case ASCII codes
+}
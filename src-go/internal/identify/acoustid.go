@@ -0,0 +1,227 @@
+// Package identify looks up recordings by acoustic fingerprint through
+// AcoustID and MusicBrainz, and writes corrected tags back to files.
+package identify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/tags"
+)
+
+const (
+	// DefaultAcoustIDURL is the AcoustID lookup endpoint
+	DefaultAcoustIDURL = "https://api.acoustid.org/v2/lookup"
+
+	// minRequestInterval keeps lookups within AcoustID's limit of three
+	// requests per second
+	minRequestInterval = 334 * time.Millisecond
+
+	// maxCandidates caps the recordings returned by a lookup
+	maxCandidates = 5
+)
+
+// Candidate is a recording that matches a fingerprint, with the metadata of
+// its earliest known release
+type Candidate struct {
+	RecordingID string  `json:"recordingId"` // MusicBrainz recording ID
+	Score       float64 `json:"score"`       // AcoustID match score, 0-1
+	Title       string  `json:"title"`
+	Artist      string  `json:"artist"`
+	Album       string  `json:"album,omitempty"`
+	AlbumArtist string  `json:"albumArtist,omitempty"`
+	Year        int     `json:"year,omitempty"`
+	TrackNumber int     `json:"trackNumber,omitempty"`
+	DiscNumber  int     `json:"discNumber,omitempty"`
+}
+
+// Client queries the AcoustID web service
+type Client struct {
+	apiKey  string
+	baseURL string
+	http    *http.Client
+
+	mu          sync.Mutex
+	lastRequest time.Time
+}
+
+// NewClient creates an AcoustID client using the given application API key
+func NewClient(apiKey string) *Client {
+	return &Client{
+		apiKey:  apiKey,
+		baseURL: DefaultAcoustIDURL,
+		http:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// acoustIDArtist is an artist credit in a lookup response
+type acoustIDArtist struct {
+	Name       string `json:"name"`
+	JoinPhrase string `json:"joinphrase"`
+}
+
+type acoustIDResponse struct {
+	Status string `json:"status"`
+	Error  struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	Results []struct {
+		Score      float64 `json:"score"`
+		Recordings []struct {
+			ID       string           `json:"id"`
+			Title    string           `json:"title"`
+			Artists  []acoustIDArtist `json:"artists"`
+			Releases []struct {
+				Title string `json:"title"`
+				Date  struct {
+					Year int `json:"year"`
+				} `json:"date"`
+				Artists []acoustIDArtist `json:"artists"`
+				Mediums []struct {
+					Position int `json:"position"`
+					Tracks   []struct {
+						Position int `json:"position"`
+					} `json:"tracks"`
+				} `json:"mediums"`
+			} `json:"releases"`
+		} `json:"recordings"`
+	} `json:"results"`
+}
+
+// Lookup finds recordings matching a Chromaprint fingerprint. Candidates
+// are ordered best match first.
+func (c *Client) Lookup(ctx context.Context, duration int, fingerprint string) ([]Candidate, error) {
+	c.wait()
+
+	form := url.Values{
+		"client":      {c.apiKey},
+		"meta":        {"recordings releases compress"},
+		"duration":    {strconv.Itoa(duration)},
+		"fingerprint": {fingerprint},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("acoustid request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body acoustIDResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("acoustid response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if body.Status != "ok" {
+		return nil, fmt.Errorf("acoustid: %s", body.Error.Message)
+	}
+
+	// A recording can appear under several results; keep its best score
+	best := make(map[string]Candidate)
+	for _, result := range body.Results {
+		for _, rec := range result.Recordings {
+			if rec.Title == "" {
+				continue // Fingerprint known but not linked to MusicBrainz metadata
+			}
+			if existing, ok := best[rec.ID]; ok && existing.Score >= result.Score {
+				continue
+			}
+
+			cand := Candidate{
+				RecordingID: rec.ID,
+				Score:       result.Score,
+				Title:       rec.Title,
+				Artist:      artistCredit(rec.Artists),
+			}
+			// Prefer the original release over later compilations
+			release := -1
+			for i, r := range rec.Releases {
+				if release < 0 || earlierYear(r.Date.Year, rec.Releases[release].Date.Year) {
+					release = i
+				}
+			}
+			if release >= 0 {
+				r := rec.Releases[release]
+				cand.Album = r.Title
+				cand.AlbumArtist = artistCredit(r.Artists)
+				cand.Year = r.Date.Year
+				if len(r.Mediums) > 0 {
+					cand.DiscNumber = r.Mediums[0].Position
+					if len(r.Mediums[0].Tracks) > 0 {
+						cand.TrackNumber = r.Mediums[0].Tracks[0].Position
+					}
+				}
+			}
+			best[rec.ID] = cand
+		}
+	}
+
+	candidates := make([]Candidate, 0, len(best))
+	for _, cand := range best {
+		candidates = append(candidates, cand)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].RecordingID < candidates[j].RecordingID
+	})
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+	return candidates, nil
+}
+
+// Edit returns the candidate's metadata as a tag edit. Fields the lookup
+// didn't provide are left unchanged.
+func (c Candidate) Edit() tags.Edit {
+	e := tags.Edit{Title: &c.Title, Artist: &c.Artist}
+	if c.Album != "" {
+		e.Album, e.AlbumArtist = &c.Album, &c.AlbumArtist
+	}
+	if c.Year != 0 {
+		e.Year = &c.Year
+	}
+	if c.TrackNumber != 0 {
+		e.TrackNumber, e.DiscNumber = &c.TrackNumber, &c.DiscNumber
+	}
+	return e
+}
+
+// wait blocks until another request may be sent
+func (c *Client) wait() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if wait := minRequestInterval - time.Since(c.lastRequest); wait > 0 {
+		time.Sleep(wait)
+	}
+	c.lastRequest = time.Now()
+}
+
+// earlierYear reports whether year a is known and before b. Unknown years
+// are 0.
+func earlierYear(a, b int) bool {
+	return a != 0 && (b == 0 || a < b)
+}
+
+// artistCredit joins a credit such as "Artist A feat. Artist B"
+func artistCredit(artists []acoustIDArtist) string {
+	var b strings.Builder
+	for _, a := range artists {
+		b.WriteString(a.Name)
+		b.WriteString(a.JoinPhrase)
+	}
+	return b.String()
+}
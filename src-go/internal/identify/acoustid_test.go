@@ -0,0 +1,71 @@
+package identify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const lookupResponse = `{
+  "status": "ok",
+  "results": [
+    {"score": 0.95, "recordings": [
+      {"id": "rec-1", "title": "Under Pressure",
+       "artists": [{"name": "Queen", "joinphrase": " & "}, {"name": "David Bowie"}],
+       "releases": [
+         {"title": "Greatest Hits II", "date": {"year": 1991}, "artists": [{"name": "Queen"}],
+          "mediums": [{"position": 1, "tracks": [{"position": 3}]}]},
+         {"title": "Hot Space", "date": {"year": 1982}, "artists": [{"name": "Queen"}],
+          "mediums": [{"position": 1, "tracks": [{"position": 11}]}]},
+         {"title": "Undated Bootleg"}
+       ]},
+      {"id": "rec-unlinked"}
+    ]},
+    {"score": 0.40, "recordings": [{"id": "rec-1", "title": "Under Pressure"}]},
+    {"score": 0.60, "recordings": [{"id": "rec-2", "title": "Under Pressure (Rah Mix)"}]}
+  ]
+}`
+
+func TestLookup(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("client") != "key" || r.Form.Get("duration") != "248" {
+			t.Errorf("Unexpected request form: %v", r.Form)
+		}
+		w.Write([]byte(lookupResponse))
+	}))
+	defer srv.Close()
+
+	c := NewClient("key")
+	c.baseURL = srv.URL
+	candidates, err := c.Lookup(context.Background(), 248, "AQAA")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+
+	if len(candidates) != 2 || candidates[0].RecordingID != "rec-1" || candidates[1].RecordingID != "rec-2" {
+		t.Fatalf("Expected rec-1 then rec-2, got %+v", candidates)
+	}
+	got := candidates[0]
+	want := Candidate{
+		RecordingID: "rec-1", Score: 0.95, Title: "Under Pressure", Artist: "Queen & David Bowie",
+		Album: "Hot Space", AlbumArtist: "Queen", Year: 1982, TrackNumber: 11, DiscNumber: 1,
+	}
+	if got != want {
+		t.Errorf("Expected the earliest release\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestLookupError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status": "error", "error": {"code": 4, "message": "invalid API key"}}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient("bad")
+	c.baseURL = srv.URL
+	if _, err := c.Lookup(context.Background(), 1, "AQAA"); err == nil || err.Error() != "acoustid: invalid API key" {
+		t.Errorf("Expected API error to be reported, got %v", err)
+	}
+}
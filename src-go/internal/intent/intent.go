@@ -0,0 +1,442 @@
+// Package intent reads loosely worded requests, such as what a speech to
+// text client hears, as player actions: "pause", "volume up", "play some
+// chill music", "play something like Tycho but calmer".
+package intent
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/austinkregel/local-media/musicd/internal/analysis"
+)
+
+// Action is what a request asks the player to do
+type Action string
+
+// Actions
+const (
+	ActionPlay        Action = "play"        // Play library tracks: a search, a mood, or anything
+	ActionPlaySimilar Action = "playSimilar" // Play tracks similar to a search or the current track
+	ActionPause       Action = "pause"
+	ActionResume      Action = "resume"
+	ActionStop        Action = "stop"
+	ActionNext        Action = "next"
+	ActionPrevious    Action = "previous"
+	ActionVolume      Action = "volume"
+	ActionShuffle     Action = "shuffle"
+)
+
+// VolumeStep is how far "louder" and "quieter" move the volume
+const VolumeStep = 0.1
+
+// Adjustment asks for tracks with more or less of a descriptor than the
+// ones a request starts from
+type Adjustment struct {
+	Descriptor string // One of the analysis descriptors
+	Direction  int    // 1 for more, -1 for less
+}
+
+func (a Adjustment) String() string {
+	if a.Direction < 0 {
+		return "less " + a.Descriptor
+	}
+	return "more " + a.Descriptor
+}
+
+// Intent is a parsed request
+type Intent struct {
+	Action Action
+
+	// Query is the library search to play, or to play tracks similar to.
+	// Empty for ActionPlaySimilar means the current track.
+	Query string
+
+	// Mood is the analysis mood to play, or ""
+	Mood string
+
+	Adjustments []Adjustment
+
+	// Volume is the level for ActionVolume, 0 - 1, or the change to it
+	// when Relative
+	Volume   float64
+	Relative bool
+
+	// Shuffle is whether ActionShuffle turns shuffle on or off
+	Shuffle bool
+}
+
+// commands are the requests that need no more than a lookup
+var commands = map[string]Intent{
+	"pause":           {Action: ActionPause},
+	"pause it":        {Action: ActionPause},
+	"pause music":     {Action: ActionPause},
+	"pause the music": {Action: ActionPause},
+	"pause playback":  {Action: ActionPause},
+	"hold on":         {Action: ActionPause},
+
+	"play":            {Action: ActionResume},
+	"play it":         {Action: ActionResume},
+	"resume":          {Action: ActionResume},
+	"resume playback": {Action: ActionResume},
+	"unpause":         {Action: ActionResume},
+	"continue":        {Action: ActionResume},
+	"keep playing":    {Action: ActionResume},
+	"start playing":   {Action: ActionResume},
+
+	"stop":           {Action: ActionStop},
+	"stop it":        {Action: ActionStop},
+	"stop music":     {Action: ActionStop},
+	"stop the music": {Action: ActionStop},
+	"stop playing":   {Action: ActionStop},
+	"stop playback":  {Action: ActionStop},
+
+	"next":            {Action: ActionNext},
+	"next song":       {Action: ActionNext},
+	"next track":      {Action: ActionNext},
+	"skip":            {Action: ActionNext},
+	"skip it":         {Action: ActionNext},
+	"skip this":       {Action: ActionNext},
+	"skip this one":   {Action: ActionNext},
+	"skip this song":  {Action: ActionNext},
+	"skip this track": {Action: ActionNext},
+	"skip song":       {Action: ActionNext},
+	"skip track":      {Action: ActionNext},
+
+	"previous":       {Action: ActionPrevious},
+	"previous song":  {Action: ActionPrevious},
+	"previous track": {Action: ActionPrevious},
+	"back":           {Action: ActionPrevious},
+	"go back":        {Action: ActionPrevious},
+	"last song":      {Action: ActionPrevious},
+	"last track":     {Action: ActionPrevious},
+
+	"louder":               {Action: ActionVolume, Volume: VolumeStep, Relative: true},
+	"volume up":            {Action: ActionVolume, Volume: VolumeStep, Relative: true},
+	"turn it up":           {Action: ActionVolume, Volume: VolumeStep, Relative: true},
+	"turn up the volume":   {Action: ActionVolume, Volume: VolumeStep, Relative: true},
+	"turn the volume up":   {Action: ActionVolume, Volume: VolumeStep, Relative: true},
+	"quieter":              {Action: ActionVolume, Volume: -VolumeStep, Relative: true},
+	"softer":               {Action: ActionVolume, Volume: -VolumeStep, Relative: true},
+	"volume down":          {Action: ActionVolume, Volume: -VolumeStep, Relative: true},
+	"turn it down":         {Action: ActionVolume, Volume: -VolumeStep, Relative: true},
+	"turn down the volume": {Action: ActionVolume, Volume: -VolumeStep, Relative: true},
+	"turn the volume down": {Action: ActionVolume, Volume: -VolumeStep, Relative: true},
+	"mute":                 {Action: ActionVolume, Volume: 0},
+
+	"shuffle":          {Action: ActionShuffle, Shuffle: true},
+	"shuffle on":       {Action: ActionShuffle, Shuffle: true},
+	"turn on shuffle":  {Action: ActionShuffle, Shuffle: true},
+	"turn shuffle on":  {Action: ActionShuffle, Shuffle: true},
+	"enable shuffle":   {Action: ActionShuffle, Shuffle: true},
+	"shuffle off":      {Action: ActionShuffle},
+	"turn off shuffle": {Action: ActionShuffle},
+	"turn shuffle off": {Action: ActionShuffle},
+	"disable shuffle":  {Action: ActionShuffle},
+	"stop shuffling":   {Action: ActionShuffle},
+}
+
+// volumePattern matches "set the volume to 40%" and the like
+var volumePattern = regexp.MustCompile(`^(?:(?:set|turn|change|put) )?(?:the )?volume (?:to |at )?(\d{1,3})(?: ?%| percent)?$`)
+
+// Words around a request that don't change it
+var (
+	leadingFiller = []string{
+		"hey", "ok", "okay", "please", "can you", "could you", "would you",
+		"will you", "i want to", "i'd like to", "i would like to", "let's",
+		"lets", "go ahead and", "just",
+	}
+	trailingFiller = []string{"please", "now", "for me", "thanks", "thank you"}
+)
+
+// playVerbs start a request to play something
+var playVerbs = []string{"start playing", "play me", "play", "put on", "listen to", "hear"}
+
+// vagueWords stand for "something" before what's asked for
+var vagueWords = []string{
+	"something", "anything", "some", "a few", "a song", "a track",
+	"songs", "tracks", "music", "stuff",
+}
+
+// kindWords trail a mood or artist: "chill music", "tycho songs"
+var kindWords = []string{"music", "songs", "tracks", "stuff", "vibes", "playlist", "mix", "mood"}
+
+// likePhrases start a request for similar tracks
+var likePhrases = []string{"kind of like", "sort of like", "similar to", "in the style of", "like"}
+
+// currentTrack are the ways of saying the track that's playing
+var currentTrack = map[string]bool{
+	"":                 true,
+	"this":             true,
+	"this one":         true,
+	"this song":        true,
+	"this track":       true,
+	"that":             true,
+	"the current song": true,
+	"what's playing":   true,
+	"whats playing":    true,
+}
+
+// moodWords map the ways of naming a mood onto the analysis moods
+var moodWords = map[string]string{
+	"chill":         "chill",
+	"chilled":       "chill",
+	"chillout":      "chill",
+	"chill out":     "chill",
+	"calm":          "chill",
+	"relaxing":      "chill",
+	"relaxed":       "chill",
+	"mellow":        "chill",
+	"hype":          "hype",
+	"energetic":     "hype",
+	"high energy":   "hype",
+	"intense":       "hype",
+	"workout":       "hype",
+	"pump up":       "hype",
+	"party":         "party",
+	"dance":         "party",
+	"dancing":       "party",
+	"danceable":     "party",
+	"happy":         "happy",
+	"cheerful":      "happy",
+	"upbeat":        "happy",
+	"feel good":     "happy",
+	"melancholy":    "melancholy",
+	"melancholic":   "melancholy",
+	"sad":           "melancholy",
+	"moody":         "melancholy",
+	"acoustic":      "acoustic",
+	"unplugged":     "acoustic",
+	"focus":         "focus",
+	"study":         "focus",
+	"studying":      "focus",
+	"concentration": "focus",
+	"work":          "focus",
+	"working":       "focus",
+	"coding":        "focus",
+}
+
+// adjustmentWords map comparisons onto descriptor adjustments. Longer
+// phrases come first so "more energetic" isn't read as "more".
+var adjustmentWords = []struct {
+	phrase     string
+	adjustment Adjustment
+}{
+	{"less energetic", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"less intense", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"more relaxed", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"more relaxing", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"more chill", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"more mellow", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"more calm", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"calmer", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"chiller", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"mellower", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"gentler", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"softer", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"quieter", Adjustment{analysis.DescriptorEnergy, -1}},
+	{"slower", Adjustment{analysis.DescriptorEnergy, -1}},
+
+	{"more energetic", Adjustment{analysis.DescriptorEnergy, 1}},
+	{"more energy", Adjustment{analysis.DescriptorEnergy, 1}},
+	{"more intense", Adjustment{analysis.DescriptorEnergy, 1}},
+	{"more lively", Adjustment{analysis.DescriptorEnergy, 1}},
+	{"livelier", Adjustment{analysis.DescriptorEnergy, 1}},
+	{"harder", Adjustment{analysis.DescriptorEnergy, 1}},
+	{"heavier", Adjustment{analysis.DescriptorEnergy, 1}},
+	{"louder", Adjustment{analysis.DescriptorEnergy, 1}},
+	{"faster", Adjustment{analysis.DescriptorEnergy, 1}},
+
+	{"more upbeat", Adjustment{analysis.DescriptorValence, 1}},
+	{"more cheerful", Adjustment{analysis.DescriptorValence, 1}},
+	{"more positive", Adjustment{analysis.DescriptorValence, 1}},
+	{"more happy", Adjustment{analysis.DescriptorValence, 1}},
+	{"less sad", Adjustment{analysis.DescriptorValence, 1}},
+	{"happier", Adjustment{analysis.DescriptorValence, 1}},
+	{"brighter", Adjustment{analysis.DescriptorValence, 1}},
+
+	{"more melancholy", Adjustment{analysis.DescriptorValence, -1}},
+	{"more sad", Adjustment{analysis.DescriptorValence, -1}},
+	{"less happy", Adjustment{analysis.DescriptorValence, -1}},
+	{"sadder", Adjustment{analysis.DescriptorValence, -1}},
+	{"darker", Adjustment{analysis.DescriptorValence, -1}},
+	{"moodier", Adjustment{analysis.DescriptorValence, -1}},
+	{"gloomier", Adjustment{analysis.DescriptorValence, -1}},
+
+	{"more danceable", Adjustment{analysis.DescriptorDanceability, 1}},
+	{"more groovy", Adjustment{analysis.DescriptorDanceability, 1}},
+	{"less danceable", Adjustment{analysis.DescriptorDanceability, -1}},
+	{"dancier", Adjustment{analysis.DescriptorDanceability, 1}},
+	{"groovier", Adjustment{analysis.DescriptorDanceability, 1}},
+
+	{"more acoustic", Adjustment{analysis.DescriptorAcousticness, 1}},
+	{"less electronic", Adjustment{analysis.DescriptorAcousticness, 1}},
+	{"less acoustic", Adjustment{analysis.DescriptorAcousticness, -1}},
+	{"more electronic", Adjustment{analysis.DescriptorAcousticness, -1}},
+}
+
+// Parse reads text as an intent
+func Parse(text string) (Intent, error) {
+	s := normalize(text)
+	s = trimFiller(s)
+	if s == "" {
+		return Intent{}, fmt.Errorf("nothing to do")
+	}
+
+	if in, ok := commands[s]; ok {
+		return in, nil
+	}
+	if m := volumePattern.FindStringSubmatch(s); m != nil {
+		percent, _ := strconv.Atoi(m[1])
+		if percent > 100 {
+			return Intent{}, fmt.Errorf("volume %d%% is out of range", percent)
+		}
+		return Intent{Action: ActionVolume, Volume: float64(percent) / 100}, nil
+	}
+	for _, verb := range playVerbs {
+		if rest, ok := cutWord(s, verb); ok {
+			return parsePlay(rest), nil
+		}
+	}
+	return Intent{}, fmt.Errorf("didn't understand %q", strings.TrimSpace(text))
+}
+
+// parsePlay reads what follows "play"
+func parsePlay(s string) Intent {
+	in := Intent{Action: ActionPlay}
+	s, but, hasBut := strings.Cut(s, " but ")
+	if hasBut {
+		in.Adjustments, _ = adjustments(but)
+	}
+
+	vague := false
+	for stripped := true; stripped; {
+		stripped = false
+		for _, word := range vagueWords {
+			if rest, ok := cutWord(s, word); ok {
+				s, vague, stripped = rest, true, true
+			}
+		}
+	}
+
+	for _, phrase := range likePhrases {
+		if rest, ok := cutWord(strings.TrimPrefix(s, "more "), phrase); ok {
+			in.Action = ActionPlaySimilar
+			if seed := trimKind(rest); !currentTrack[seed] {
+				in.Query = seed
+			}
+			return in
+		}
+	}
+
+	// "something calmer", "more energetic stuff", "something happier
+	// than this"
+	if vague || strings.HasPrefix(s, "more ") {
+		var found []Adjustment
+		found, s = adjustments(s)
+		in.Adjustments = append(found, in.Adjustments...)
+		for _, than := range []string{"than this one", "than this", "than that"} {
+			s = strings.TrimSpace(strings.TrimSuffix(s, than))
+		}
+		s, _ = cutWord(s, "more")
+	}
+
+	s = trimKind(s)
+	if mood, ok := moodWords[s]; ok {
+		in.Mood = mood
+		return in
+	}
+	if s == "" {
+		// Adjusting nothing in particular adjusts what's playing
+		if len(in.Adjustments) > 0 {
+			in.Action = ActionPlaySimilar
+		}
+		return in
+	}
+
+	for _, prefix := range []string{"the album", "the song", "the artist", "album", "song", "artist", "by"} {
+		if rest, ok := cutWord(s, prefix); ok && rest != "" {
+			s = rest
+			break
+		}
+	}
+	in.Query = strings.ReplaceAll(s, " by ", " ")
+	return in
+}
+
+// adjustments finds the comparisons in s, returning them along with what
+// remains of s
+func adjustments(s string) ([]Adjustment, string) {
+	var found []Adjustment
+	s = " " + s + " "
+	for _, w := range adjustmentWords {
+		if strings.Contains(s, " "+w.phrase+" ") {
+			found = append(found, w.adjustment)
+			s = strings.Replace(s, " "+w.phrase+" ", " ", 1)
+		}
+	}
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "and" {
+		s = ""
+	}
+	return found, s
+}
+
+// normalize lower cases s and reduces it to words separated by single
+// spaces, keeping apostrophes and percent signs
+func normalize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' || r == '%':
+			return unicode.ToLower(r)
+		case r == '’':
+			return '\''
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// trimFiller removes politeness from either end of s
+func trimFiller(s string) string {
+	for trimmed := true; trimmed; {
+		trimmed = false
+		for _, word := range leadingFiller {
+			if rest, ok := cutWord(s, word); ok {
+				s, trimmed = rest, true
+			}
+		}
+		for _, word := range trailingFiller {
+			if rest, ok := strings.CutSuffix(s, word); ok && (rest == "" || strings.HasSuffix(rest, " ")) {
+				s, trimmed = strings.TrimSpace(rest), true
+			}
+		}
+	}
+	return s
+}
+
+// trimKind removes a trailing "music", "songs" and the like from s
+func trimKind(s string) string {
+	for _, word := range kindWords {
+		if s == word {
+			return ""
+		}
+		if rest, ok := strings.CutSuffix(s, " "+word); ok {
+			return rest
+		}
+	}
+	return s
+}
+
+// cutWord removes word from the start of s when it's whole words there
+func cutWord(s, word string) (string, bool) {
+	if s == word {
+		return "", true
+	}
+	if rest, ok := strings.CutPrefix(s, word+" "); ok {
+		return rest, true
+	}
+	return s, false
+}
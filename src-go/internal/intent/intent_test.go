@@ -0,0 +1,65 @@
+package intent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/austinkregel/local-media/musicd/internal/analysis"
+)
+
+func TestParse(t *testing.T) {
+	calmer := Adjustment{analysis.DescriptorEnergy, -1}
+	happier := Adjustment{analysis.DescriptorValence, 1}
+
+	tests := []struct {
+		text string
+		want Intent
+	}{
+		{"Pause.", Intent{Action: ActionPause}},
+		{"hey, skip this song please", Intent{Action: ActionNext}},
+		{"go back", Intent{Action: ActionPrevious}},
+		{"play", Intent{Action: ActionResume}},
+		{"Set the volume to 40%", Intent{Action: ActionVolume, Volume: 0.4}},
+		{"turn it down", Intent{Action: ActionVolume, Volume: -VolumeStep, Relative: true}},
+		{"turn off shuffle", Intent{Action: ActionShuffle}},
+		{"play Tycho", Intent{Action: ActionPlay, Query: "tycho"}},
+		{"play the album Dive by Tycho", Intent{Action: ActionPlay, Query: "dive tycho"}},
+		{"play some music", Intent{Action: ActionPlay}},
+		{"play some chill music", Intent{Action: ActionPlay, Mood: "chill"}},
+		{"I want to hear something relaxing", Intent{Action: ActionPlay, Mood: "chill"}},
+		{"put on study music but happier", Intent{Action: ActionPlay, Mood: "focus", Adjustments: []Adjustment{happier}}},
+		{"play something like Tycho but calmer", Intent{Action: ActionPlaySimilar, Query: "tycho", Adjustments: []Adjustment{calmer}}},
+		{"play more like this", Intent{Action: ActionPlaySimilar}},
+		{"play something calmer and happier", Intent{Action: ActionPlaySimilar, Adjustments: []Adjustment{calmer, happier}}},
+		{"play something more energetic", Intent{Action: ActionPlaySimilar, Adjustments: []Adjustment{{analysis.DescriptorEnergy, 1}}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.text)
+		if err != nil {
+			t.Errorf("%q: Parse failed: %v", tt.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %+v, got %+v", tt.text, tt.want, got)
+		}
+	}
+
+	for _, bad := range []string{"", "  please ", "what's the weather", "volume 250"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestMoodWordsAreMoods(t *testing.T) {
+	for word, mood := range moodWords {
+		if _, ok := analysis.Moods[mood]; !ok {
+			t.Errorf("%q maps onto unknown mood %q", word, mood)
+		}
+	}
+	for _, w := range adjustmentWords {
+		if _, ok := (analysis.Descriptors{}).Get(w.adjustment.Descriptor); !ok {
+			t.Errorf("%q adjusts unknown descriptor %q", w.phrase, w.adjustment.Descriptor)
+		}
+	}
+}
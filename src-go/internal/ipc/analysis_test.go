@@ -0,0 +1,122 @@
+package ipc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/austinkregel/local-media/musicd/internal/analysis"
+	"github.com/austinkregel/local-media/musicd/internal/library"
+)
+
+func TestAnalysisCoverage(t *testing.T) {
+	s := newTestServer(t)
+	features := &analysis.AudioFeatures{Tempo: 120, KeyStrength: 0.8}
+	s.featureStore.StoreFeatures("/music/a.flac", features, analysis.FeatureVersion, "a")
+	s.featureStore.StoreFeatures("/music/b.flac", features, analysis.FeatureVersion, "b")
+
+	// A release changes how keys are found, and one track has been
+	// re-analyzed since
+	oldVersion := analysis.FeatureGroupVersions[analysis.GroupKey]
+	analysis.FeatureGroupVersions[analysis.GroupKey] = oldVersion + 1
+	defer func() { analysis.FeatureGroupVersions[analysis.GroupKey] = oldVersion }()
+	s.featureStore.StoreFeatureGroups("/music/b.flac", features, []string{analysis.GroupKey}, "b")
+
+	resp := s.handleGetAnalysisCoverage()
+	if !resp.Success {
+		t.Fatalf("getAnalysisCoverage failed: %s", resp.Error)
+	}
+	var coverage AnalysisCoverageResponse
+	if err := json.Unmarshal(resp.Data, &coverage); err != nil {
+		t.Fatal(err)
+	}
+	if coverage.Analyzed != 2 || coverage.UpToDate != 1 || !reflect.DeepEqual(coverage.Versions, map[int]int{analysis.FeatureVersion: 2}) {
+		t.Errorf("Expected 2 analyzed and 1 up to date, got %+v", coverage)
+	}
+	if len(coverage.Groups) != len(analysis.FeatureGroups) {
+		t.Fatalf("Expected every group, got %+v", coverage.Groups)
+	}
+	for _, group := range coverage.Groups {
+		want := FeatureGroupCoverage{
+			Name:     group.Name,
+			Version:  analysis.FeatureGroupVersions[group.Name],
+			UpToDate: 2,
+			Versions: map[int]int{analysis.FeatureGroupVersions[group.Name]: 2},
+		}
+		if group.Name == analysis.GroupKey {
+			want.UpToDate, want.Stale = 1, 1
+			want.Versions = map[int]int{oldVersion: 1, oldVersion + 1: 1}
+		}
+		if !reflect.DeepEqual(group, want) {
+			t.Errorf("Expected %+v, got %+v", want, group)
+		}
+	}
+}
+
+func TestGetTrackFeatures(t *testing.T) {
+	s := newTestServer(t)
+	s.featureStore.StoreFeatures("/music/a.flac", &analysis.AudioFeatures{Tempo: 120, Key: 9, Mode: analysis.KeyMinor, KeyStrength: 0.8}, analysis.FeatureVersion, "a")
+
+	// path and trackPath both name the track
+	for _, data := range []string{`{"trackPath": "/music/a.flac"}`, `{"path": "/music/a.flac"}`} {
+		resp := s.handleGetTrackFeatures(&Request{Cmd: CmdGetTrackFeatures, Data: json.RawMessage(data)})
+		if !resp.Success {
+			t.Fatalf("%s: getTrackFeatures failed: %s", data, resp.Error)
+		}
+		var features GetTrackFeaturesResponse
+		if err := json.Unmarshal(resp.Data, &features); err != nil {
+			t.Fatal(err)
+		}
+		if features.TrackPath != "/music/a.flac" || features.Features.Tempo != 120 || features.Key == nil || features.Key.Name != "A minor" {
+			t.Errorf("%s: expected the track's features, got %+v", data, features)
+		}
+	}
+
+	for _, data := range []string{`{}`, `{"path": "/music/none.flac"}`} {
+		if resp := s.handleGetTrackFeatures(&Request{Cmd: CmdGetTrackFeatures, Data: json.RawMessage(data)}); resp.Success {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
+
+func TestGetFeatureDistribution(t *testing.T) {
+	s := newTestServer(t)
+	s.featureStore.StoreFeatures("/music/a.flac", &analysis.AudioFeatures{Tempo: 100}, analysis.FeatureVersion, "a")
+	s.featureStore.StoreFeatures("/music/b.flac", &analysis.AudioFeatures{Tempo: 140}, analysis.FeatureVersion, "b")
+	s.featureStore.StoreFeatures("/music/gone.flac", &analysis.AudioFeatures{Tempo: 200}, analysis.FeatureVersion, "c")
+	s.libraryIndex.Build([]library.Track{{Path: "/music/a.flac"}, {Path: "/music/b.flac"}})
+
+	resp := s.handleGetFeatureDistribution(&Request{Cmd: CmdGetFeatureDistribution, Data: json.RawMessage(`{"bins": 4, "features": ["tempo"]}`)})
+	if !resp.Success {
+		t.Fatalf("getFeatureDistribution failed: %s", resp.Error)
+	}
+	var dist GetFeatureDistributionResponse
+	if err := json.Unmarshal(resp.Data, &dist); err != nil {
+		t.Fatal(err)
+	}
+	// Analysis of tracks no longer in the library isn't counted
+	if dist.Tracks != 2 || len(dist.Histograms) != 1 {
+		t.Fatalf("Expected one histogram over 2 tracks, got %+v", dist)
+	}
+	if tempo := dist.Histograms[0]; tempo.Feature != "tempo" || tempo.Max != 140 || !reflect.DeepEqual(tempo.Counts, []int{1, 0, 0, 1}) {
+		t.Errorf("Expected tempos 100 and 140 in 4 bins, got %+v", tempo)
+	}
+	if !reflect.DeepEqual(dist.Features, analysis.DistributionFeatureNames()) {
+		t.Errorf("Expected the features that can be asked for, got %v", dist.Features)
+	}
+
+	// All features in the default number of bins
+	resp = s.handleGetFeatureDistribution(&Request{Cmd: CmdGetFeatureDistribution})
+	if err := json.Unmarshal(resp.Data, &dist); err != nil {
+		t.Fatal(err)
+	}
+	if len(dist.Histograms) != len(dist.Features) || len(dist.Histograms[0].Counts) != defaultHistogramBins {
+		t.Errorf("Expected every feature in %d bins, got %d histograms", defaultHistogramBins, len(dist.Histograms))
+	}
+
+	for _, data := range []string{`{"bins": 201}`, `{"features": ["loudness"]}`} {
+		if resp := s.handleGetFeatureDistribution(&Request{Cmd: CmdGetFeatureDistribution, Data: json.RawMessage(data)}); resp.Success {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
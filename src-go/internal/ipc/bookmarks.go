@@ -0,0 +1,188 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+// SetBookmarkStore enables the bookmark commands
+func (s *Server) SetBookmarkStore(store *queue.BookmarkStore) {
+	s.bookmarkStore = store
+}
+
+// handleAddBookmark bookmarks a position in a track, by default wherever the
+// current track is now
+func (s *Server) handleAddBookmark(req *Request) *Response {
+	if s.bookmarkStore == nil {
+		return NewErrorResponse("bookmarks not available")
+	}
+	var bookmarkReq BookmarkRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &bookmarkReq); err != nil {
+			return NewErrorResponse("invalid addBookmark request")
+		}
+	}
+
+	status := s.player.Status()
+	path := bookmarkReq.Path
+	if path == "" {
+		path = status.Path
+	}
+	if path == "" {
+		return NewErrorResponse("nothing is playing")
+	}
+	var positionMs int64
+	switch {
+	case bookmarkReq.PositionMs != nil:
+		positionMs = *bookmarkReq.PositionMs
+	case path == status.Path:
+		positionMs = status.Position
+	default:
+		return NewErrorResponse("positionMs is required for a track that isn't playing")
+	}
+
+	bookmark, err := s.bookmarkStore.Add(path, positionMs, bookmarkReq.Note)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	log.Printf("[QUEUE] Bookmarked %dms: %s", positionMs, path)
+
+	resp, err := NewSuccessResponse(AddBookmarkResponse{Path: path, Bookmark: toIPCBookmark(bookmark)})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleListBookmarks(req *Request) *Response {
+	if s.bookmarkStore == nil {
+		return NewErrorResponse("bookmarks not available")
+	}
+	var listReq ListBookmarksRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &listReq); err != nil {
+			return NewErrorResponse("invalid listBookmarks request")
+		}
+	}
+
+	if listReq.Path != "" {
+		return s.trackBookmarksResponse(listReq.Path)
+	}
+
+	result := ListBookmarksResponse{Tracks: []TrackBookmarks{}}
+	for path, marks := range s.bookmarkStore.All() {
+		result.Tracks = append(result.Tracks, toTrackBookmarks(path, marks))
+	}
+	sort.Slice(result.Tracks, func(i, j int) bool {
+		return result.Tracks[i].Path < result.Tracks[j].Path
+	})
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleRemoveBookmark(req *Request) *Response {
+	if s.bookmarkStore == nil {
+		return NewErrorResponse("bookmarks not available")
+	}
+	var bookmarkReq BookmarkRequest
+	if err := json.Unmarshal(req.Data, &bookmarkReq); err != nil || bookmarkReq.Path == "" {
+		return NewErrorResponse("invalid removeBookmark request")
+	}
+
+	removed, err := s.bookmarkStore.Remove(bookmarkReq.Path, bookmarkReq.ID)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	if !removed {
+		return NewErrorResponse("unknown bookmark")
+	}
+	return s.trackBookmarksResponse(bookmarkReq.Path)
+}
+
+// handleJumpToBookmark seeks to a bookmark, first playing its track if
+// another one is playing
+func (s *Server) handleJumpToBookmark(ctx context.Context, req *Request) *Response {
+	if s.bookmarkStore == nil {
+		return NewErrorResponse("bookmarks not available")
+	}
+	var bookmarkReq BookmarkRequest
+	if err := json.Unmarshal(req.Data, &bookmarkReq); err != nil || bookmarkReq.Path == "" {
+		return NewErrorResponse("invalid jumpToBookmark request")
+	}
+	bookmark, ok := s.bookmarkStore.Get(bookmarkReq.Path, bookmarkReq.ID)
+	if !ok {
+		return NewErrorResponse("unknown bookmark")
+	}
+
+	status := s.player.Status()
+	if status.Path == bookmarkReq.Path && (status.State == audio.StatePlaying || status.State == audio.StatePaused) {
+		log.Printf("[PLAYER] Jump to bookmark at %dms", bookmark.PositionMs)
+		if err := s.player.SeekTo(bookmark.PositionMs); err != nil {
+			return NewErrorResponse(err.Error())
+		}
+		s.statusRev.bump()
+		return s.handleStatus()
+	}
+
+	// Play the track from the queue if it's there, as a play command would
+	s.forgetTransition()
+	var metadata *audio.TrackMetadata
+	foundInQueue := false
+	for i, item := range s.queueMgr.GetItems() {
+		if item.Path == bookmarkReq.Path {
+			s.queueMgr.SetIndex(i)
+			metadata = (*audio.TrackMetadata)(item.Metadata)
+			foundInQueue = true
+			break
+		}
+	}
+	if !foundInQueue {
+		s.queueMgr.Set([]string{bookmarkReq.Path})
+		s.queueMgr.SetIndex(0)
+	}
+
+	log.Printf("[PLAYER] Playing bookmark at %dms: %s", bookmark.PositionMs, bookmarkReq.Path)
+	if err := s.player.PlayFrom(ctx, bookmarkReq.Path, metadata, bookmark.PositionMs); err != nil {
+		return s.playbackFailed(bookmarkReq.Path, err)
+	}
+	s.notifyTrackChanged(ctx, trackChangePlay)
+	return s.handleStatus()
+}
+
+// trackBookmarksResponse lists one track's bookmarks
+func (s *Server) trackBookmarksResponse(path string) *Response {
+	result := ListBookmarksResponse{
+		Tracks: []TrackBookmarks{toTrackBookmarks(path, s.bookmarkStore.List(path))},
+	}
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func toTrackBookmarks(path string, marks []queue.Bookmark) TrackBookmarks {
+	track := TrackBookmarks{Path: path, Bookmarks: make([]Bookmark, len(marks))}
+	for i, b := range marks {
+		track.Bookmarks[i] = toIPCBookmark(b)
+	}
+	return track
+}
+
+func toIPCBookmark(b queue.Bookmark) Bookmark {
+	return Bookmark{
+		ID:         b.ID,
+		PositionMs: b.PositionMs,
+		Note:       b.Note,
+		Created:    b.Created,
+	}
+}
@@ -0,0 +1,66 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/austinkregel/local-media/musicd/internal/cache"
+)
+
+// maxCacheTrackCount caps how many upcoming tracks one cacheTrack copies
+const maxCacheTrackCount = 50
+
+// SetTrackCache enables the cacheTrack command
+func (s *Server) SetTrackCache(c *cache.Cache) {
+	s.trackCache = c
+}
+
+func (s *Server) handleCacheTrack(ctx context.Context, req *Request) *Response {
+	if s.trackCache == nil {
+		return NewErrorResponse("track cache not available")
+	}
+
+	cacheReq := CacheTrackRequest{Count: 1}
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &cacheReq); err != nil || cacheReq.Count < 0 {
+			return NewErrorResponse("invalid cacheTrack request")
+		}
+	}
+	count := min(max(cacheReq.Count, 1), maxCacheTrackCount)
+
+	result := CacheTrackResponse{Copying: []string{}, Cached: []string{}}
+	for _, item := range s.queueMgr.Upcoming(count) {
+		if s.trackCache.Has(item.Path) {
+			result.Cached = append(result.Cached, item.Path)
+		} else {
+			result.Copying = append(result.Copying, item.Path)
+		}
+	}
+
+	// Copy one track at a time so the next one to play is ready first
+	if len(result.Copying) > 0 {
+		go func(paths []string) {
+			for _, path := range paths {
+				push := TrackCachedPush{Path: path}
+				if err := s.trackCache.Add(ctx, path); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					log.Printf("[QUEUE] Failed to cache %s: %v", path, err)
+					push.Error = err.Error()
+				} else {
+					log.Printf("[QUEUE] Cached %s", path)
+				}
+				s.broadcastPush("trackCached", push)
+			}
+		}(result.Copying)
+	}
+
+	result.CachedFiles, result.CachedBytes = s.trackCache.Stats()
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
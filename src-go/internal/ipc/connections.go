@@ -0,0 +1,108 @@
+package ipc
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/auth"
+)
+
+// connClient is the paired client behind an authenticated connection
+type connClient struct {
+	ref         ClientRef
+	canVote     bool // The client has the party scope
+	connectedAt time.Time
+	lastSeen    time.Time
+}
+
+// actorKey is the context key for the client a command came from
+type actorKey struct{}
+
+// withActor returns ctx carrying the client running a command
+func withActor(ctx context.Context, by *ClientRef) context.Context {
+	return context.WithValue(ctx, actorKey{}, by)
+}
+
+// actorFrom returns the client running the command ctx belongs to, or nil
+// for the daemon's own actions
+func actorFrom(ctx context.Context) *ClientRef {
+	by, _ := ctx.Value(actorKey{}).(*ClientRef)
+	return by
+}
+
+// trackConnection records that conn sent a command with client's token and
+// returns who the connection is. A connection keeps its ID if it switches to
+// another client's token.
+func (s *Server) trackConnection(conn net.Conn, client auth.ClientInfo) *ClientRef {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cc, ok := s.authedConns[conn]
+	if !ok {
+		s.nextConnID++
+		cc = &connClient{ref: ClientRef{ConnectionID: s.nextConnID}, connectedAt: now}
+		s.authedConns[conn] = cc
+	}
+	cc.ref.ClientID = client.ID
+	cc.ref.Name = client.Name
+	cc.canVote = client.HasScope(auth.ScopeParty)
+	cc.lastSeen = now
+
+	ref := cc.ref
+	return &ref
+}
+
+func (s *Server) handleGetConnectedClients(conn net.Conn) *Response {
+	s.mu.Lock()
+	result := GetConnectedClientsResponse{Connections: make([]ConnectedClient, 0, len(s.authedConns))}
+	for c, cc := range s.authedConns {
+		result.Connections = append(result.Connections, ConnectedClient{
+			ClientRef:   cc.ref,
+			ConnectedAt: cc.connectedAt.UnixMilli(),
+			LastSeen:    cc.lastSeen.UnixMilli(),
+			Self:        c == conn,
+		})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(result.Connections, func(i, j int) bool {
+		return result.Connections[i].ConnectionID < result.Connections[j].ConnectionID
+	})
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// Idle reports whether the daemon has nothing to do: no clients are
+// connected, nothing is playing, no scan, analysis run or podcast download
+// is under way, no schedule is waiting to start playback and no profile
+// has a start time to be switched to at
+func (s *Server) Idle() bool {
+	s.mu.Lock()
+	clients := len(s.clients)
+	s.mu.Unlock()
+	_, profileScheduled := s.configMgr.Get().ScheduledProfile(time.Now())
+	switch {
+	case clients > 0, s.player.Status().State == audio.StatePlaying:
+		return false
+	case s.libScanner.IsRunning():
+		return false
+	case s.analysisWorker != nil && s.analysisWorker.IsRunning():
+		return false
+	case s.podcasts != nil && s.podcasts.Downloading():
+		return false
+	case s.schedules != nil && !s.schedules.Next(time.Now()).IsZero():
+		return false
+	case profileScheduled:
+		return false
+	}
+	return true
+}
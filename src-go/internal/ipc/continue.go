@@ -0,0 +1,146 @@
+package ipc
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/austinkregel/local-media/musicd/internal/library"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+// continueCandidates is how many similar tracks continue mode considers
+// before giving up on the rating filter
+const continueCandidates = 20
+
+// recommendAspects is how many of the closest aspects of two tracks a
+// recommendation names
+const recommendAspects = 2
+
+// similarityAspects name the parts of explainSimilarity in recommendations.
+// Equally close aspects are named in this order.
+var similarityAspects = []struct{ key, name string }{
+	{"mfcc", "timbre"},
+	{"tempo", "tempo"},
+	{"key", "key"},
+	{"instruments", "instrumentation"},
+	{"energy", "energy"},
+	{"spectral", "brightness"},
+	{"bands", "tonal balance"},
+	{"context", "playing style"},
+}
+
+// continueAllows reports whether continue mode may add the track at path
+func (s *Server) continueAllows(path string) bool {
+	s.continueMu.Lock()
+	filter := s.continueFilter
+	s.continueMu.Unlock()
+	return filter.Allows(s.ratings.Get(path))
+}
+
+// continueQueue appends a track picked by continue mode once the queue has
+// run out. Returns false if continue mode is off or found nothing to add.
+func (s *Server) continueQueue() bool {
+	var path, reason string
+	switch s.queueMgr.GetContinueMode() {
+	case queue.ContinueSimilar:
+		path = s.queueMgr.TryGetSimilarTrack()
+		if seed, _ := s.queueMgr.Current(); path != "" {
+			reason = s.recommendation(seed, path)
+		}
+	case queue.ContinueRandom:
+		recent := make(map[string]bool)
+		for _, p := range s.queueMgr.GetRecentlyPlayed() {
+			recent[p] = true
+		}
+		current, _ := s.queueMgr.Current()
+		t, ok := s.libraryIndex.Random(func(t library.Track) bool {
+			return !recent[t.Path] && t.Path != current && s.continueAllows(t.Path)
+		})
+		if ok {
+			path, reason = t.Path, "Picked at random from the library"
+		}
+	}
+	if path == "" {
+		return false
+	}
+
+	item := queue.QueueItem{Path: path, Recommendation: reason}
+	if t, ok := s.libraryIndex.Get(path); ok {
+		item.Metadata = &queue.TrackMetadata{
+			Title:    t.Title,
+			Artist:   t.Artist,
+			Album:    t.Album,
+			Duration: t.Duration,
+		}
+	}
+	log.Printf("[QUEUE] Continue mode added: %s (%s)", path, reason)
+	s.queueMgr.AppendWithMetadata([]queue.QueueItem{item})
+	return true
+}
+
+// recommendation says why continue mode picked path to follow seed: the
+// ways they sound most alike, and the community they share if they do.
+// Returns "" if either hasn't been analyzed.
+func (s *Server) recommendation(seed, path string) string {
+	if s.similarityEngine == nil {
+		return ""
+	}
+	breakdown := s.similarityEngine.ExplainSimilarity(seed, path)
+	if breakdown == nil {
+		return ""
+	}
+
+	var aspects []string
+	for _, aspect := range similarityAspects {
+		if _, ok := breakdown[aspect.key]; ok {
+			aspects = append(aspects, aspect.key)
+		}
+	}
+	sort.SliceStable(aspects, func(i, j int) bool {
+		return breakdown[aspects[i]] > breakdown[aspects[j]]
+	})
+	var names []string
+	for _, key := range aspects[:min(recommendAspects, len(aspects))] {
+		for _, aspect := range similarityAspects {
+			if aspect.key == key {
+				names = append(names, aspect.name)
+			}
+		}
+	}
+
+	reason := fmt.Sprintf("Similar %s to %s", strings.Join(names, " and "), s.trackName(seed))
+	if community := s.sharedCommunity(seed, path); community != "" {
+		reason += "; same community: " + community
+	}
+	return reason
+}
+
+// sharedCommunity returns the name of the community both tracks are in, or
+// "" if they aren't in the same one
+func (s *Server) sharedCommunity(a, b string) string {
+	if s.featureStore == nil {
+		return ""
+	}
+	ca, okA := s.featureStore.GetCommunity(a)
+	cb, okB := s.featureStore.GetCommunity(b)
+	if !okA || !okB || ca.CommunityID != cb.CommunityID {
+		return ""
+	}
+	for _, info := range s.featureStore.GetCommunities() {
+		if info.ID == ca.CommunityID {
+			return info.Name
+		}
+	}
+	return ""
+}
+
+// trackName returns the title the library has for path, or its file name
+func (s *Server) trackName(path string) string {
+	if t, ok := s.libraryIndex.Get(path); ok && t.Title != "" {
+		return t.Title
+	}
+	return filepath.Base(path)
+}
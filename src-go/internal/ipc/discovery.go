@@ -0,0 +1,97 @@
+package ipc
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+const (
+	// Days of play history getDiscoveryStats looks at by default, and at
+	// most
+	defaultDiscoveryDays = 30
+	maxDiscoveryDays     = 365
+
+	// discoveryShuffleBoost is how much more often discovery shuffle draws
+	// never played tracks while listening is in a rut
+	discoveryShuffleBoost = 3.0
+
+	// rutCheckInterval is how long discovery shuffle trusts its last look
+	// at the play history
+	rutCheckInterval = 15 * time.Minute
+)
+
+// discoveryStats computes listening stats over the last days of plays
+func (s *Server) discoveryStats(days int) queue.DiscoveryStats {
+	if s.playCounts == nil {
+		return queue.DiscoveryStats{}
+	}
+	plays := s.playCounts.History(time.Now().AddDate(0, 0, -days))
+	return queue.Discovery(plays, func(path string) (string, bool) {
+		t, ok := s.libraryIndex.Get(path)
+		return t.Artist, ok
+	}, s.libraryIndex.Len())
+}
+
+func (s *Server) handleGetDiscoveryStats(req *Request) *Response {
+	var statsReq GetDiscoveryStatsRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &statsReq); err != nil {
+			return NewErrorResponse("invalid getDiscoveryStats request")
+		}
+	}
+	if statsReq.Days < 0 || statsReq.Days > maxDiscoveryDays {
+		return NewErrorResponse("days must be between 1 and 365")
+	}
+	if statsReq.Days == 0 {
+		statsReq.Days = defaultDiscoveryDays
+	}
+
+	stats := s.discoveryStats(statsReq.Days)
+	result := GetDiscoveryStatsResponse{
+		Days:             statsReq.Days,
+		LibraryTracks:    s.libraryIndex.Len(),
+		Plays:            stats.Plays,
+		TracksPlayed:     stats.Tracks,
+		CoveragePercent:  stats.Coverage * 100,
+		Artists:          stats.Artists,
+		ArtistEntropy:    stats.ArtistEntropy,
+		EffectiveArtists: stats.EffectiveArtists,
+		RepeatShare:      stats.RepeatShare,
+		InRut:            stats.InRut,
+		TopArtists:       []ArtistPlays{},
+		DiscoveryShuffle: s.configMgr.Get().Behavior.DiscoveryShuffle,
+	}
+	for _, a := range stats.TopArtists {
+		result.TopArtists = append(result.TopArtists, ArtistPlays{Artist: a.Artist, Plays: a.Plays})
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// inRut reports whether the last month of listening is stuck in a rut,
+// looking again at most every rutCheckInterval
+func (s *Server) inRut() bool {
+	s.rutMu.Lock()
+	defer s.rutMu.Unlock()
+	if time.Since(s.rutCheckedAt) >= rutCheckInterval {
+		s.rut = s.discoveryStats(defaultDiscoveryDays).InRut
+		s.rutCheckedAt = time.Now()
+	}
+	return s.rut
+}
+
+// discoveryWeight is the extra smart shuffle weight of a track played
+// count times: discoveryShuffleBoost for a track never played while
+// discovery shuffle is on and listening is in a rut, otherwise 1
+func (s *Server) discoveryWeight(count int) float64 {
+	if count > 0 || !s.configMgr.Get().Behavior.DiscoveryShuffle || !s.inRut() {
+		return 1
+	}
+	return discoveryShuffleBoost
+}
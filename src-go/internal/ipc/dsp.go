@@ -0,0 +1,73 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+)
+
+// dspChain returns the player's DSP chain and the stages that can go in it
+func (s *Server) dspChain() DSPChainResponse {
+	result := DSPChainResponse{Stages: []DSPStage{}, Available: []DSPStageType{}}
+	for _, stage := range s.player.DSPChain() {
+		result.Stages = append(result.Stages, DSPStage{Name: stage.Name, Enabled: stage.Enabled, Params: stage.Params})
+	}
+	for _, info := range audio.DSPStages() {
+		params := info.Params
+		if params == nil {
+			params = []string{}
+		}
+		result.Available = append(result.Available, DSPStageType{Name: info.Name, Description: info.Description, Params: params})
+	}
+	return result
+}
+
+func (s *Server) handleGetDSPChain() *Response {
+	resp, err := NewSuccessResponse(s.dspChain())
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// handleSetDSPChain replaces the DSP chain, which takes effect within the
+// output's buffer, and saves it to the config
+func (s *Server) handleSetDSPChain(ctx context.Context, req *Request) *Response {
+	var chainReq SetDSPChainRequest
+	if err := json.Unmarshal(req.Data, &chainReq); err != nil {
+		return NewErrorResponse("invalid setDSPChain request")
+	}
+
+	previous := s.player.DSPChain()
+	stages := make([]audio.DSPStageConfig, len(chainReq.Stages))
+	saved := make([]config.DSPStageConfig, len(chainReq.Stages))
+	for i, stage := range chainReq.Stages {
+		stages[i] = audio.DSPStageConfig{Name: stage.Name, Enabled: stage.Enabled, Params: stage.Params}
+		saved[i] = config.DSPStageConfig{Name: stage.Name, Enabled: stage.Enabled, Params: stage.Params}
+	}
+	if err := s.player.SetDSPChain(stages); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	cfg := *s.configMgr.Get()
+	cfg.Audio.DSP = saved
+	if err := s.configMgr.Update(&cfg); err != nil {
+		log.Printf("[CONFIG] Failed to save DSP chain: %v", err)
+		s.player.SetDSPChain(previous)
+		return NewErrorResponse(fmt.Sprintf("failed to save config: %v", err))
+	}
+	log.Printf("[AUDIO] DSP chain set: %d stages", len(stages))
+
+	result := s.dspChain()
+	s.broadcastPushBy(actorFrom(ctx), "dspChainChanged", result)
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
@@ -0,0 +1,94 @@
+package ipc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/speech"
+)
+
+const (
+	// maxAnnounceLength is the longest text announce reads out
+	maxAnnounceLength = 1000
+
+	// announceTimeout stops an announcement that is still speaking after
+	// this long, so a stuck text to speech engine doesn't keep the music down
+	announceTimeout = 2 * time.Minute
+)
+
+// announceCounter gives each announcement its own hold on the volume
+var announceCounter atomic.Uint64
+
+func (s *Server) handleDuck(req *Request) *Response {
+	var duckReq DuckRequest
+	if err := json.Unmarshal(req.Data, &duckReq); err != nil || duckReq.DurationMs < 0 {
+		return NewErrorResponse("invalid duck request")
+	}
+
+	level := s.duckLevel(duckReq.Level)
+	if err := s.player.Duck(audio.DuckManual, level, time.Duration(duckReq.DurationMs)*time.Millisecond); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	return s.duckResponse()
+}
+
+func (s *Server) handleAnnounce(req *Request) *Response {
+	var announceReq AnnounceRequest
+	if err := json.Unmarshal(req.Data, &announceReq); err != nil {
+		return NewErrorResponse("invalid announce request")
+	}
+	text := strings.TrimSpace(announceReq.Text)
+	if text == "" {
+		return NewErrorResponse("text is required")
+	}
+	if len(text) > maxAnnounceLength {
+		return NewErrorResponse(fmt.Sprintf("text must be at most %d bytes", maxAnnounceLength))
+	}
+
+	cmd, err := speech.Command(text)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	source := fmt.Sprintf("announce%d", announceCounter.Add(1))
+	if err := s.player.Duck(source, s.duckLevel(announceReq.Level), 0); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	if err := cmd.Start(); err != nil {
+		s.player.Duck(source, 1, 0)
+		return NewErrorResponse(fmt.Sprintf("failed to start text to speech: %v", err))
+	}
+	log.Printf("[PLAYER] Announcing %q", truncateForLog(text, 80))
+
+	// The music comes back up once the announcement has been spoken
+	go func() {
+		timeout := time.AfterFunc(announceTimeout, func() { cmd.Process.Kill() })
+		defer timeout.Stop()
+		if err := cmd.Wait(); err != nil {
+			log.Printf("[PLAYER] Announcement failed: %v", err)
+		}
+		s.player.Duck(source, 1, 0)
+	}()
+	return s.duckResponse()
+}
+
+// duckLevel returns the level a duck or announce request asks for,
+// defaulting to the configured one
+func (s *Server) duckLevel(requested *float64) float64 {
+	if requested != nil {
+		return *requested
+	}
+	return s.configMgr.Get().Audio.DuckLevel
+}
+
+func (s *Server) duckResponse() *Response {
+	resp, err := NewSuccessResponse(DuckResponse{Level: s.player.DuckLevel()})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
@@ -0,0 +1,209 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/focus"
+	"github.com/austinkregel/local-media/musicd/internal/media"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+// focusRestore is what a focus session changed, to put back when it ends
+type focusRestore struct {
+	shuffle queue.ShuffleMode
+	repeat  queue.RepeatMode
+}
+
+// SetOnFocusLevelling sets a function called when a focus session turns
+// volume levelling on or off, so it can be applied along with the
+// levelVolume setting
+func (s *Server) SetOnFocusLevelling(fn func()) {
+	s.focusMu.Lock()
+	defer s.focusMu.Unlock()
+	s.onFocusLevelling = fn
+}
+
+// FocusLevelling reports whether a running focus session has turned volume
+// levelling on
+func (s *Server) FocusLevelling() bool {
+	session, ok := s.focusTimer.Current()
+	return ok && session.Normalize
+}
+
+func (s *Server) handleStartFocusSession(ctx context.Context, req *Request) *Response {
+	var focusReq StartFocusSessionRequest
+	if err := json.Unmarshal(req.Data, &focusReq); err != nil {
+		return NewErrorResponse("invalid startFocusSession request")
+	}
+	opts := focus.Options{
+		Minutes:     focusReq.Minutes,
+		Playlist:    focusReq.Playlist,
+		EndBehavior: focusReq.EndBehavior,
+		Normalize:   focusReq.Normalize,
+	}
+	if err := opts.Validate(); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	items, err := s.focusTracks(focusReq)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	// A session already running ends first, putting back what it changed
+	session, err := s.focusTimer.Start(opts)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	log.Printf("[FOCUS] Started %d minute session: %q, %d tracks, ends with %s",
+		focusReq.Minutes, focusReq.Playlist, len(items), session.EndBehavior)
+
+	if focusReq.DisableShuffle {
+		s.focusMu.Lock()
+		s.focusRestore = &focusRestore{shuffle: s.queueMgr.GetShuffleMode(), repeat: s.queueMgr.GetRepeat()}
+		s.focusMu.Unlock()
+		s.setShuffleRepeat(queue.ShuffleOff, queue.RepeatOff)
+	}
+	if session.Normalize {
+		s.applyFocusLevelling()
+	}
+
+	if resp := s.playQueueItems(ctx, items); resp != nil {
+		s.focusTimer.Stop()
+		return resp
+	}
+
+	state := toFocusSessionState(session, true)
+	s.broadcastPush("focusSessionStarted", state)
+	resp, err := NewSuccessResponse(state)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleStopFocusSession() *Response {
+	session, ok := s.focusTimer.Stop()
+	if !ok {
+		return NewErrorResponse("no focus session running")
+	}
+	resp, err := NewSuccessResponse(toFocusSessionState(session, false))
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleGetFocusSession() *Response {
+	session, ok := s.focusTimer.Current()
+	resp, err := NewSuccessResponse(toFocusSessionState(session, ok))
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// endFocusSession puts back what the session changed and, if it ran its
+// course, pauses or stops playback as it asked
+func (s *Server) endFocusSession(session focus.Session, completed bool) {
+	log.Printf("[FOCUS] Session ended: %q, completed=%v", session.Playlist, completed)
+
+	s.focusMu.Lock()
+	restore := s.focusRestore
+	s.focusRestore = nil
+	s.focusMu.Unlock()
+	if restore != nil {
+		s.setShuffleRepeat(restore.shuffle, restore.repeat)
+	}
+	if session.Normalize {
+		s.applyFocusLevelling()
+	}
+
+	if completed {
+		var err error
+		switch session.EndBehavior {
+		case focus.EndPause:
+			err = s.player.Pause()
+		case focus.EndStop:
+			err = s.player.Stop()
+		}
+		if err != nil {
+			log.Printf("[FOCUS] Failed to %s at the end of the session: %v", session.EndBehavior, err)
+		}
+	}
+
+	s.broadcastPush("focusSessionEnded", FocusSessionEndedPush{
+		FocusSession: toFocusSessionState(session, false),
+		Completed:    completed,
+	})
+}
+
+// applyFocusLevelling lets the daemon apply volume levelling after a focus
+// session turned it on or off
+func (s *Server) applyFocusLevelling() {
+	s.focusMu.Lock()
+	fn := s.onFocusLevelling
+	s.focusMu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// setShuffleRepeat sets shuffle and repeat, keeping the OS media session in
+// step
+func (s *Server) setShuffleRepeat(shuffle queue.ShuffleMode, repeat queue.RepeatMode) {
+	s.queueMgr.SetShuffleMode(shuffle)
+	s.queueMgr.SetRepeat(repeat)
+
+	loopStatus := media.LoopNone
+	switch repeat {
+	case queue.RepeatOne:
+		loopStatus = media.LoopTrack
+	case queue.RepeatAll:
+		loopStatus = media.LoopPlaylist
+	}
+	if err := s.player.UpdateShuffle(shuffle != queue.ShuffleOff); err != nil {
+		log.Printf("[QUEUE] Failed to update media session shuffle: %v", err)
+	}
+	if err := s.player.UpdateLoopStatus(loopStatus); err != nil {
+		log.Printf("[QUEUE] Failed to update media session loop status: %v", err)
+	}
+}
+
+// focusTracks returns the tracks a focus session plays: the ones it was
+// given, or those of the daily mix or mood its playlist names
+func (s *Server) focusTracks(req StartFocusSessionRequest) ([]queue.QueueItem, error) {
+	paths := req.Tracks
+	if len(paths) == 0 {
+		if req.Playlist == "" {
+			return nil, fmt.Errorf("playlist or tracks is required")
+		}
+		var err error
+		if paths, err = s.playlistTracks(req.Playlist); err != nil {
+			return nil, err
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("playlist %q has no tracks in the library", req.Playlist)
+	}
+	return s.libraryQueueItems(paths), nil
+}
+
+// toFocusSessionState converts a focus session for the wire
+func toFocusSessionState(session focus.Session, active bool) FocusSession {
+	state := FocusSession{
+		Active:      active,
+		Playlist:    session.Playlist,
+		EndBehavior: session.EndBehavior,
+		Normalize:   session.Normalize,
+		StartedAt:   unixMilliOrZero(session.StartedAt),
+		EndsAt:      unixMilliOrZero(session.EndsAt),
+	}
+	if active {
+		state.RemainingMs = max(time.Until(session.EndsAt).Milliseconds(), 0)
+	}
+	return state
+}
@@ -0,0 +1,84 @@
+package ipc
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Audio data push formats, negotiated in subscribeAudioData
+const (
+	AudioDataFormatJSON   = "json"
+	AudioDataFormatBinary = "binary"
+)
+
+// Binary frames share the socket with newline-delimited JSON. A JSON message
+// always starts with '{', so a leading FrameMarker byte tells the client to
+// read a frame instead of a line:
+//
+//	offset  size  field
+//	0       1     FrameMarker (0x00)
+//	1       1     frame type
+//	2       4     payload length, big-endian uint32
+//	6       n     payload
+//
+// The FrameTypeAudioData payload is:
+//
+//	0       8     position in ms, big-endian int64
+//	8       8     timestamp in Unix ms, big-endian int64
+//	16      2     band count, big-endian uint16
+//	18      n     bands, one byte (0-255) each
+const (
+	FrameMarker        byte = 0x00
+	FrameTypeAudioData byte = 0x01
+
+	frameHeaderSize     = 6
+	audioDataHeaderSize = 18
+)
+
+// EncodeAudioDataFrame builds a binary audioData frame
+func EncodeAudioDataFrame(bands []uint8, position, timestamp int64) []byte {
+	payloadLen := audioDataHeaderSize + len(bands)
+	frame := make([]byte, frameHeaderSize+payloadLen)
+
+	frame[0] = FrameMarker
+	frame[1] = FrameTypeAudioData
+	binary.BigEndian.PutUint32(frame[2:6], uint32(payloadLen))
+
+	payload := frame[frameHeaderSize:]
+	binary.BigEndian.PutUint64(payload[0:8], uint64(position))
+	binary.BigEndian.PutUint64(payload[8:16], uint64(timestamp))
+	binary.BigEndian.PutUint16(payload[16:18], uint16(len(bands)))
+	copy(payload[audioDataHeaderSize:], bands)
+
+	return frame
+}
+
+// DecodeAudioDataFrame parses a complete binary audioData frame
+func DecodeAudioDataFrame(frame []byte) (*AudioDataResponse, error) {
+	if len(frame) < frameHeaderSize || frame[0] != FrameMarker {
+		return nil, fmt.Errorf("not a binary frame")
+	}
+	if frame[1] != FrameTypeAudioData {
+		return nil, fmt.Errorf("unexpected frame type %d", frame[1])
+	}
+	payloadLen := int(binary.BigEndian.Uint32(frame[2:6]))
+	payload := frame[frameHeaderSize:]
+	if len(payload) != payloadLen || payloadLen < audioDataHeaderSize {
+		return nil, fmt.Errorf("truncated frame")
+	}
+
+	count := int(binary.BigEndian.Uint16(payload[16:18]))
+	if len(payload) != audioDataHeaderSize+count {
+		return nil, fmt.Errorf("band count %d does not match payload", count)
+	}
+
+	bands := make([]int, count)
+	for i, b := range payload[audioDataHeaderSize:] {
+		bands[i] = int(b)
+	}
+	return &AudioDataResponse{
+		Bands:     bands,
+		Position:  int64(binary.BigEndian.Uint64(payload[0:8])),
+		Timestamp: int64(binary.BigEndian.Uint64(payload[8:16])),
+	}, nil
+}
@@ -0,0 +1,35 @@
+package ipc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAudioDataFrameRoundTrip(t *testing.T) {
+	bands := []uint8{0, 12, 255, 128}
+	frame := EncodeAudioDataFrame(bands, 61_500, 1_700_000_000_123)
+
+	if frame[0] != FrameMarker || bytes.IndexByte(frame, '{') == 0 {
+		t.Fatalf("Frame must not look like JSON: % x", frame[:2])
+	}
+	if len(frame) != frameHeaderSize+audioDataHeaderSize+len(bands) {
+		t.Errorf("Unexpected frame length %d", len(frame))
+	}
+
+	decoded, err := DecodeAudioDataFrame(frame)
+	if err != nil {
+		t.Fatalf("DecodeAudioDataFrame failed: %v", err)
+	}
+	if decoded.Position != 61_500 || decoded.Timestamp != 1_700_000_000_123 {
+		t.Errorf("Unexpected position/timestamp: %+v", decoded)
+	}
+	for i, b := range bands {
+		if decoded.Bands[i] != int(b) {
+			t.Errorf("Band %d: expected %d, got %d", i, b, decoded.Bands[i])
+		}
+	}
+
+	if _, err := DecodeAudioDataFrame(frame[:len(frame)-1]); err == nil {
+		t.Error("Expected truncated frame to be rejected")
+	}
+}
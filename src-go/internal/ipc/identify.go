@@ -0,0 +1,134 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/austinkregel/local-media/musicd/internal/analysis"
+	"github.com/austinkregel/local-media/musicd/internal/identify"
+	"github.com/austinkregel/local-media/musicd/internal/tags"
+)
+
+// acoustIDClient returns a client for the configured API key. The client is
+// shared so its rate limit applies across requests.
+func (s *Server) acoustIDClient(key string) *identify.Client {
+	s.acoustIDMu.Lock()
+	defer s.acoustIDMu.Unlock()
+
+	if s.acoustID == nil || s.acoustIDKey != key {
+		s.acoustID = identify.NewClient(key)
+		s.acoustIDKey = key
+	}
+	return s.acoustID
+}
+
+// inLibrary reports whether path is inside one of the library directories
+func inLibrary(path string, libraryPaths []string) bool {
+	for _, dir := range libraryPaths {
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackFingerprint returns the fingerprint stored by analysis, computing and
+// storing it if analysis hasn't reached the track yet
+func (s *Server) trackFingerprint(ctx context.Context, path string) (*analysis.Fingerprint, error) {
+	if s.featureStore != nil {
+		if fp, err := s.featureStore.GetFingerprint(path); err == nil {
+			return fp, nil
+		}
+	}
+
+	fpcalcPath := analysis.FindFpcalc()
+	if fpcalcPath == "" {
+		return nil, fmt.Errorf("fpcalc not found; install Chromaprint to identify tracks")
+	}
+	fp, err := analysis.ComputeFingerprint(ctx, fpcalcPath, path)
+	if err != nil {
+		return nil, err
+	}
+	if s.featureStore != nil {
+		if err := s.featureStore.StoreFingerprint(path, fp); err != nil {
+			log.Printf("[ANALYSIS] Warning: failed to store fingerprint for %s: %v", path, err)
+		}
+	}
+	return fp, nil
+}
+
+func (s *Server) handleIdentifyTrack(ctx context.Context, req *Request) *Response {
+	var idReq IdentifyTrackRequest
+	if err := json.Unmarshal(req.Data, &idReq); err != nil || idReq.Path == "" || idReq.Candidate < 0 {
+		return NewErrorResponse("invalid identify request")
+	}
+
+	cfg := s.configMgr.Get()
+	if cfg.Identify.AcoustIDKey == "" {
+		return NewErrorResponse("track identification is not configured: set identify.acoustidKey in the config file")
+	}
+	if !inLibrary(idReq.Path, cfg.LibraryPaths) {
+		return NewErrorResponse("track is not in the library")
+	}
+
+	fp, err := s.trackFingerprint(ctx, idReq.Path)
+	if err != nil {
+		return NewErrorResponse(fmt.Sprintf("failed to fingerprint track: %v", err))
+	}
+	candidates, err := s.acoustIDClient(cfg.Identify.AcoustIDKey).Lookup(ctx, fp.Duration, fp.Fingerprint)
+	if err != nil {
+		log.Printf("[SCANNER] Identification of %s failed: %v", idReq.Path, err)
+		return NewErrorResponse(fmt.Sprintf("lookup failed: %v", err))
+	}
+
+	result := IdentifyTrackResponse{
+		Path:       idReq.Path,
+		Candidates: make([]IdentifyCandidate, len(candidates)),
+	}
+	for i, c := range candidates {
+		result.Candidates[i] = toIdentifyCandidate(c)
+	}
+
+	if idReq.Apply {
+		if idReq.Candidate >= len(candidates) {
+			return NewErrorResponse(fmt.Sprintf("no candidate %d: lookup found %d", idReq.Candidate, len(candidates)))
+		}
+		chosen := candidates[idReq.Candidate]
+		edit := chosen.Edit()
+		if err := tags.Write(ctx, idReq.Path, edit); err != nil {
+			return NewErrorResponse(fmt.Sprintf("failed to write tags: %v", err))
+		}
+		log.Printf("[SCANNER] Tagged %s as %q by %q", idReq.Path, chosen.Title, chosen.Artist)
+
+		if t, ok := s.libraryIndex.Get(idReq.Path); ok {
+			s.libraryIndex.Update(applyTagEdit(t, edit))
+		}
+		applied := toIdentifyCandidate(chosen)
+		result.Applied = &applied
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func toIdentifyCandidate(c identify.Candidate) IdentifyCandidate {
+	return IdentifyCandidate{
+		RecordingID: c.RecordingID,
+		Score:       c.Score,
+		Title:       c.Title,
+		Artist:      c.Artist,
+		Album:       c.Album,
+		AlbumArtist: c.AlbumArtist,
+		Year:        c.Year,
+		TrackNumber: c.TrackNumber,
+		DiscNumber:  c.DiscNumber,
+	}
+}
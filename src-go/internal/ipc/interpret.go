@@ -0,0 +1,275 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/intent"
+	"github.com/austinkregel/local-media/musicd/internal/library"
+)
+
+const (
+	// interpretTracks is the most tracks an interpreted play request queues
+	interpretTracks = 50
+
+	// interpretSeeds is how many search results similar tracks are found
+	// from, for "play something like ..."
+	interpretSeeds = 5
+)
+
+// handleInterpret runs a loosely worded request, such as one from speech to
+// text, and reports what it did
+func (s *Server) handleInterpret(ctx context.Context, req *Request) *Response {
+	var interpretReq InterpretRequest
+	if err := json.Unmarshal(req.Data, &interpretReq); err != nil || strings.TrimSpace(interpretReq.Text) == "" {
+		return NewErrorResponse("invalid interpret request")
+	}
+	in, err := intent.Parse(interpretReq.Text)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	log.Printf("[PLAYER] Interpreting %q as %s", interpretReq.Text, in.Action)
+
+	result := InterpretResponse{
+		Action: string(in.Action),
+		Query:  in.Query,
+		Mood:   in.Mood,
+	}
+	for _, adj := range in.Adjustments {
+		result.Adjustments = append(result.Adjustments, adj.String())
+	}
+
+	var resp *Response
+	switch in.Action {
+	case intent.ActionPause:
+		resp, result.Description = s.handlePause(), "Paused"
+	case intent.ActionResume:
+		resp, result.Description = s.handleResume(), "Resumed"
+	case intent.ActionStop:
+		resp, result.Description = s.handleStop(), "Stopped"
+	case intent.ActionNext:
+		resp, result.Description = s.handleNext(ctx), "Skipped to the next track"
+	case intent.ActionPrevious:
+		resp, result.Description = s.handlePrev(ctx), "Went back to the previous track"
+	case intent.ActionVolume:
+		level := in.Volume
+		if in.Relative {
+			level += s.player.Volume()
+		}
+		level = limitVolume(ctx, min(max(level, 0), 1), s.player.Volume())
+		if err := s.player.SetVolume(level); err != nil {
+			return NewErrorResponse(err.Error())
+		}
+		result.Description = fmt.Sprintf("Set the volume to %.0f%%", level*100)
+	case intent.ActionShuffle:
+		s.queueMgr.SetShuffle(in.Shuffle)
+		if err := s.player.UpdateShuffle(s.queueMgr.GetShuffle()); err != nil {
+			log.Printf("[QUEUE] Failed to update media session shuffle: %v", err)
+		}
+		result.Description = "Turned shuffle off"
+		if in.Shuffle {
+			result.Description = "Turned shuffle on"
+		}
+	case intent.ActionPlay, intent.ActionPlaySimilar:
+		// "play something" carries on with what's paused
+		if in.Action == intent.ActionPlay && in.Query == "" && in.Mood == "" && s.player.Status().State == audio.StatePaused {
+			resp, result.Description = s.handleResume(), "Resumed"
+			result.Action = string(intent.ActionResume)
+			break
+		}
+		paths, description, err := s.interpretTracks(in)
+		if err != nil {
+			return NewErrorResponse(err.Error())
+		}
+		if resp := s.playQueueItems(ctx, s.libraryQueueItems(paths)); resp != nil {
+			return resp
+		}
+		result.Tracks = len(paths)
+		result.Description = description
+	}
+	if resp != nil && !resp.Success {
+		return resp
+	}
+
+	log.Printf("[PLAYER] %s", result.Description)
+	resp, err = NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// interpretTracks returns the tracks an interpreted play request plays, and
+// a description of them
+func (s *Server) interpretTracks(in intent.Intent) ([]string, string, error) {
+	var paths, reference []string
+	var description string
+	switch {
+	case in.Action == intent.ActionPlaySimilar:
+		if s.similarityEngine == nil {
+			return nil, "", fmt.Errorf("analysis not available")
+		}
+		if in.Query == "" {
+			current := s.player.Status().Path
+			if current == "" {
+				return nil, "", fmt.Errorf("nothing is playing")
+			}
+			reference = []string{current}
+			description = "similar to the current track"
+		} else {
+			var err error
+			if reference, err = s.searchPaths(in.Query, interpretSeeds); err != nil {
+				return nil, "", err
+			}
+			description = fmt.Sprintf("similar to %q", in.Query)
+		}
+		paths = s.similarTo(reference)
+
+	case in.Mood != "":
+		var err error
+		if paths, err = s.playlistTracks(in.Mood); err != nil {
+			return nil, "", err
+		}
+		rand.Shuffle(len(paths), func(i, j int) { paths[i], paths[j] = paths[j], paths[i] })
+		reference = paths
+		description = in.Mood
+
+	case in.Query != "":
+		var err error
+		if paths, err = s.searchPaths(in.Query, 0); err != nil {
+			return nil, "", err
+		}
+		reference = paths
+		description = fmt.Sprintf("matching %q", in.Query)
+
+	default:
+		tracks, _ := s.libraryIndex.Tracks(library.Facets{}, 0, 0)
+		for _, i := range rand.Perm(len(tracks)) {
+			paths = append(paths, tracks[i].Path)
+		}
+		reference = paths
+		description = "random"
+	}
+
+	if len(in.Adjustments) > 0 {
+		var err error
+		if paths, err = s.adjustTracks(paths, reference, in.Adjustments); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(paths) == 0 {
+		return nil, "", fmt.Errorf("no tracks in the library fit that")
+	}
+	if len(paths) > interpretTracks {
+		paths = paths[:interpretTracks]
+	}
+
+	if in.Mood != "" || description == "random" {
+		description = fmt.Sprintf("Playing %d %s tracks", len(paths), description)
+	} else {
+		description = fmt.Sprintf("Playing %d tracks %s", len(paths), description)
+	}
+	for i, adj := range in.Adjustments {
+		sep := " and "
+		if i == 0 {
+			sep = ", with "
+		}
+		description += sep + adj.String()
+	}
+	return paths, description, nil
+}
+
+// searchPaths returns the library tracks matching text, best first
+func (s *Server) searchPaths(text string, limit int) ([]string, error) {
+	query, err := library.ParseQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	results, _ := s.libraryIndex.Search(query, limit)
+	if len(results) == 0 {
+		return nil, fmt.Errorf("nothing in the library matches %q", text)
+	}
+	paths := make([]string, len(results))
+	for i, r := range results {
+		paths[i] = r.Track.Path
+	}
+	return paths, nil
+}
+
+// similarTo returns the library tracks most similar to seeds, taking from
+// each seed in turn, leaving out the seeds themselves
+func (s *Server) similarTo(seeds []string) []string {
+	seen := make(map[string]bool, len(seeds))
+	for _, seed := range seeds {
+		seen[seed] = true
+	}
+	lists := make([][]string, len(seeds))
+	for i, seed := range seeds {
+		for _, edge := range s.similarityEngine.FindSimilar(seed, interpretTracks, nil) {
+			lists[i] = append(lists[i], edge.TargetPath)
+		}
+		lists[i] = s.inLibrary(lists[i])
+	}
+
+	var paths []string
+	for round := 0; round < interpretTracks; round++ {
+		for _, list := range lists {
+			if round < len(list) && !seen[list[round]] {
+				seen[list[round]] = true
+				paths = append(paths, list[round])
+			}
+		}
+	}
+	return paths
+}
+
+// adjustTracks keeps the paths that have more or less of each adjusted
+// descriptor than reference does on average, e.g. calmer than the tracks
+// asked for. Tracks that haven't been analyzed are left out.
+func (s *Server) adjustTracks(paths, reference []string, adjustments []intent.Adjustment) ([]string, error) {
+	if s.featureStore == nil {
+		return nil, fmt.Errorf("analysis not available")
+	}
+	average := make(map[string]float32, len(adjustments))
+	for _, adj := range adjustments {
+		var sum float32
+		n := 0
+		for _, path := range reference {
+			if stored, ok := s.featureStore.GetFeatures(path); ok && stored.Descriptors != nil {
+				v, _ := stored.Descriptors.Get(adj.Descriptor)
+				sum += v
+				n++
+			}
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("tracks to compare with haven't been analyzed yet")
+		}
+		average[adj.Descriptor] = sum / float32(n)
+	}
+
+	var kept []string
+	for _, path := range paths {
+		stored, ok := s.featureStore.GetFeatures(path)
+		if !ok || stored.Descriptors == nil {
+			continue
+		}
+		fits := true
+		for _, adj := range adjustments {
+			v, _ := stored.Descriptors.Get(adj.Descriptor)
+			diff := v - average[adj.Descriptor]
+			if diff*float32(adj.Direction) <= 0 {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			kept = append(kept, path)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,61 @@
+package ipc
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/library"
+)
+
+// IntroSkip returns how many milliseconds to skip at the start of a track,
+// set for the track itself or for its album
+func (s *Server) IntroSkip(path string) int64 {
+	ms, _ := s.introSkips.Get(path, s.albumKey(path))
+	return ms
+}
+
+// albumKey returns the library.AlbumKey of the track at path, or "" if it
+// isn't in the library
+func (s *Server) albumKey(path string) string {
+	track, ok := s.libraryIndex.Get(path)
+	if !ok {
+		return ""
+	}
+	return library.AlbumKey(track)
+}
+
+func (s *Server) handleSetIntroSkip(req *Request) *Response {
+	var skipReq SetIntroSkipRequest
+	if err := json.Unmarshal(req.Data, &skipReq); err != nil {
+		return NewErrorResponse("invalid setIntroSkip request")
+	}
+	path := s.ratingPath(skipReq.Path)
+	if path == "" {
+		return NewErrorResponse("nothing is playing")
+	}
+
+	skip := time.Duration(skipReq.OffsetMs) * time.Millisecond
+	if skipReq.Album {
+		key := s.albumKey(path)
+		if key == "" {
+			return NewErrorResponse("track has no album in the library")
+		}
+		if err := s.introSkips.SetAlbum(key, skipReq.OffsetMs); err != nil {
+			return NewErrorResponse(err.Error())
+		}
+		log.Printf("[SCANNER] Skipping the first %v of every track on the album of %s", skip, path)
+	} else {
+		if err := s.introSkips.SetTrack(path, skipReq.OffsetMs); err != nil {
+			return NewErrorResponse(err.Error())
+		}
+		log.Printf("[SCANNER] Skipping the first %v of %s", skip, path)
+	}
+
+	ms, fromAlbum := s.introSkips.Get(path, s.albumKey(path))
+	resp, err := NewSuccessResponse(IntroSkipResponse{Path: path, OffsetMs: ms, Album: fromAlbum})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
@@ -0,0 +1,133 @@
+package ipc
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/austinkregel/local-media/musicd/internal/analysis"
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+)
+
+const (
+	// Moving on before this share of a track has played counts as a skip
+	skipMaxFraction = 0.5
+
+	// Used instead when the track's duration isn't known
+	skipMaxPositionMs = 30 * 1000
+
+	defaultLearnedTransitions = 20
+)
+
+// isSkip reports whether leaving the track in status now counts as skipping it
+func isSkip(status audio.Status) bool {
+	if status.Duration <= 0 {
+		return status.Position < skipMaxPositionMs
+	}
+	return float64(status.Position) < float64(status.Duration)*skipMaxFraction
+}
+
+// learnFromAdvance is called when playback moves on from path to the next
+// track in the queue, either because path finished or because it was
+// skipped. If path itself followed another track in the queue, that
+// transition teaches the weight learner. A path that wasn't skipped also
+// counts as played.
+func (s *Server) learnFromAdvance(path string, skipped bool) {
+	s.countPlay(path, skipped)
+
+	s.transitionMu.Lock()
+	from := s.transitionFrom
+	s.transitionFrom = path
+	s.transitionMu.Unlock()
+
+	if s.weightLearner == nil || from == "" || path == "" || from == path {
+		return
+	}
+	a, okA := s.featureStore.GetFeatures(from)
+	b, okB := s.featureStore.GetFeatures(path)
+	if !okA || !okB {
+		return
+	}
+
+	weights, err := s.weightLearner.Record(from, path, skipped, s.similarityEngine.Components(a.Features, b.Features))
+	s.similarityEngine.SetWeights(weights)
+	if err != nil {
+		log.Printf("[ANALYSIS] Warning: failed to save learned weights: %v", err)
+	}
+}
+
+// forgetTransition is called when the user picks a track directly or skips
+// ahead, so the next advance isn't mistaken for a transition the queue chose
+func (s *Server) forgetTransition() {
+	s.transitionMu.Lock()
+	s.transitionFrom = ""
+	s.transitionMu.Unlock()
+}
+
+func toSimilarityWeights(w analysis.FeatureWeights) SimilarityWeights {
+	return SimilarityWeights{
+		MFCC:        w.MFCC,
+		Tempo:       w.Tempo,
+		Spectral:    w.Spectral,
+		Energy:      w.Energy,
+		Bands:       w.Bands,
+		Instruments: w.Instruments,
+		Context:     w.Context,
+		Key:         w.Key,
+	}
+}
+
+func (s *Server) handleGetLearnedWeights(req *Request) *Response {
+	if s.weightLearner == nil {
+		return NewErrorResponse("analysis not available")
+	}
+
+	var weightsReq GetLearnedWeightsRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &weightsReq); err != nil {
+			return NewErrorResponse("invalid learned weights request")
+		}
+	}
+	limit := weightsReq.Limit
+	if limit <= 0 {
+		limit = defaultLearnedTransitions
+	}
+
+	plays, skips, updatedAt := s.weightLearner.Counts()
+	result := GetLearnedWeightsResponse{
+		Weights:     toSimilarityWeights(s.weightLearner.Weights()),
+		Defaults:    toSimilarityWeights(analysis.DefaultWeights()),
+		Plays:       plays,
+		Skips:       skips,
+		UpdatedAt:   updatedAt,
+		Transitions: []LearnedTransition{},
+	}
+	for _, t := range s.weightLearner.Transitions(limit) {
+		result.Transitions = append(result.Transitions, LearnedTransition{
+			From:  t.From,
+			To:    t.To,
+			Plays: t.Plays,
+			Skips: t.Skips,
+		})
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleResetLearnedWeights() *Response {
+	if s.weightLearner == nil {
+		return NewErrorResponse("analysis not available")
+	}
+
+	if err := s.weightLearner.Reset(); err != nil {
+		log.Printf("[ANALYSIS] Failed to reset learned weights: %v", err)
+		return NewErrorResponse("failed to reset learned weights")
+	}
+	s.similarityEngine.SetWeights(s.weightLearner.Weights())
+	log.Printf("[ANALYSIS] Learned similarity weights reset to defaults")
+
+	return s.handleGetLearnedWeights(&Request{})
+}
@@ -0,0 +1,241 @@
+package ipc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/austinkregel/local-media/musicd/internal/library"
+)
+
+// Result limits for librarySearch and libraryGetTracks
+const (
+	defaultLibraryLimit = 50
+	maxLibraryLimit     = 500
+)
+
+// libraryLimit applies the default and maximum to a requested limit
+func libraryLimit(limit int) int {
+	if limit == 0 {
+		return defaultLibraryLimit
+	}
+	return min(limit, maxLibraryLimit)
+}
+
+func (s *Server) handleLibrarySearch(req *Request) *Response {
+	var searchReq LibrarySearchRequest
+	if err := json.Unmarshal(req.Data, &searchReq); err != nil || searchReq.Limit < 0 {
+		return NewErrorResponse("invalid search request")
+	}
+	query, err := library.ParseQuery(searchReq.Query)
+	if err != nil {
+		return NewErrorResponse(fmt.Sprintf("invalid search query: %v", err))
+	}
+
+	matches, total := s.libraryIndex.Search(query, libraryLimit(searchReq.Limit))
+	results := make([]LibrarySearchResult, len(matches))
+	for i, m := range matches {
+		results[i] = LibrarySearchResult{LibraryTrack: toLibraryTrack(m.Track), Score: m.Score}
+	}
+
+	resp, err := NewSuccessResponse(LibrarySearchResponse{
+		Results: results,
+		Total:   total,
+		Indexed: s.libraryIndex.Len(),
+	})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleLibraryGetGenres() *Response {
+	genres := s.libraryIndex.Genres()
+	result := LibraryGetGenresResponse{Genres: make([]LibraryGenre, len(genres))}
+	for i, g := range genres {
+		result.Genres[i] = LibraryGenre{Genre: g.Genre, Count: g.Count}
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleLibraryGetYears() *Response {
+	years, decades := s.libraryIndex.Years()
+	result := LibraryGetYearsResponse{
+		Years:   toLibraryYears(years),
+		Decades: toLibraryYears(decades),
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleLibraryGetTracks(req *Request) *Response {
+	var tracksReq LibraryGetTracksRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &tracksReq); err != nil {
+			return NewErrorResponse("invalid library tracks request")
+		}
+	}
+	if tracksReq.Offset < 0 || tracksReq.Limit < 0 {
+		return NewErrorResponse("invalid library tracks request")
+	}
+	facets := library.Facets{
+		Genre:       tracksReq.Genre,
+		Year:        tracksReq.Year,
+		Decade:      tracksReq.Decade,
+		Artist:      tracksReq.Artist,
+		AlbumArtist: tracksReq.AlbumArtist,
+		Album:       tracksReq.Album,
+	}
+	if err := facets.Validate(); err != nil {
+		return NewErrorResponse(fmt.Sprintf("invalid library tracks request: %v", err))
+	}
+
+	tracks, total := s.libraryIndex.Tracks(facets, tracksReq.Offset, libraryLimit(tracksReq.Limit))
+	result := LibraryGetTracksResponse{Tracks: make([]LibraryTrack, len(tracks)), Total: total}
+	for i, t := range tracks {
+		result.Tracks[i] = toLibraryTrack(t)
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleLibraryGetComposers() *Response {
+	composers := s.libraryIndex.Composers()
+	result := LibraryGetComposersResponse{Composers: make([]LibraryComposer, len(composers))}
+	for i, c := range composers {
+		result.Composers[i] = LibraryComposer(c)
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleLibraryGetWorks(req *Request) *Response {
+	var worksReq LibraryGetWorksRequest
+	if err := json.Unmarshal(req.Data, &worksReq); err != nil {
+		return NewErrorResponse("invalid library works request")
+	}
+	if worksReq.Composer == "" {
+		return NewErrorResponse("composer is required")
+	}
+
+	works, standalone := s.libraryIndex.Works(worksReq.Composer)
+	result := LibraryGetWorksResponse{Works: make([]LibraryWork, len(works)), Standalone: standalone}
+	for i, w := range works {
+		result.Works[i] = LibraryWork(w)
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleLibraryGetMovements(req *Request) *Response {
+	var movementsReq LibraryGetMovementsRequest
+	if err := json.Unmarshal(req.Data, &movementsReq); err != nil {
+		return NewErrorResponse("invalid library movements request")
+	}
+	if movementsReq.Composer == "" {
+		return NewErrorResponse("composer is required")
+	}
+
+	tracks := s.libraryIndex.Movements(movementsReq.Composer, movementsReq.Work)
+	result := LibraryGetMovementsResponse{Tracks: make([]LibraryTrack, len(tracks))}
+	for i, t := range tracks {
+		result.Tracks[i] = toLibraryTrack(t)
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// maxDuplicateToleranceMs caps findDuplicates' duration tolerance; beyond
+// this, different recordings of a song start to be grouped together
+const maxDuplicateToleranceMs = 10000
+
+func (s *Server) handleFindDuplicates(req *Request) *Response {
+	var dupReq FindDuplicatesRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &dupReq); err != nil {
+			return NewErrorResponse("invalid duplicates request")
+		}
+	}
+	if dupReq.ToleranceMs < 0 || dupReq.ToleranceMs > maxDuplicateToleranceMs {
+		return NewErrorResponse(fmt.Sprintf("invalid duplicates request: toleranceMs must be between 0 and %d", maxDuplicateToleranceMs))
+	}
+	tolerance := dupReq.ToleranceMs
+	if tolerance == 0 {
+		tolerance = library.DefaultDuplicateTolerance
+	}
+
+	clusters := s.libraryIndex.FindDuplicates(tolerance)
+	result := FindDuplicatesResponse{Clusters: make([]DuplicateCluster, len(clusters))}
+	for i, c := range clusters {
+		tracks := make([]LibraryTrack, len(c.Tracks))
+		for j, t := range c.Tracks {
+			tracks[j] = toLibraryTrack(t)
+			if j > 0 {
+				result.DuplicateFiles++
+				result.DuplicateBytes += t.Size
+			}
+		}
+		result.Clusters[i] = DuplicateCluster{Tracks: tracks}
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func toLibraryTrack(t library.Track) LibraryTrack {
+	return LibraryTrack{
+		Path:        t.Path,
+		Title:       t.Title,
+		Artist:      t.Artist,
+		Album:       t.Album,
+		AlbumArtist: t.AlbumArtist,
+		Composer:    t.Composer,
+		Genre:       t.Genre,
+		Year:        t.Year,
+		TrackNumber: t.TrackNumber,
+		DiscNumber:  t.DiscNumber,
+		Duration:    t.Duration,
+		Size:        t.Size,
+		Bitrate:     t.Bitrate,
+		Cue:         toCueTrack(t.Cue),
+
+		Work:           t.Work,
+		Movement:       t.Movement,
+		MovementNumber: t.MovementNumber,
+	}
+}
+
+func toLibraryYears(counts []library.YearCount) []LibraryYear {
+	years := make([]LibraryYear, len(counts))
+	for i, c := range counts {
+		years[i] = LibraryYear{Year: c.Year, Count: c.Count}
+	}
+	return years
+}
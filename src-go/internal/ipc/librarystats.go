@@ -0,0 +1,62 @@
+package ipc
+
+import (
+	"log"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/library"
+	"github.com/austinkregel/local-media/musicd/internal/scanner"
+)
+
+// recordLibraryStats keeps the health summary of a completed scan for
+// libraryStats
+func (s *Server) recordLibraryStats(results []scanner.ScanResult, metadata *scanner.LibraryMetadata) {
+	stats := library.ComputeStats(results, metadata)
+	if len(stats.Unreadable) > 0 {
+		log.Printf("[SCANNER] %d files could not be read", len(stats.Unreadable))
+	}
+
+	s.libraryStatsMu.Lock()
+	s.libraryStats = &stats
+	s.libraryStatsAt = time.Now()
+	s.libraryStatsMu.Unlock()
+}
+
+func (s *Server) handleLibraryStats() *Response {
+	s.libraryStatsMu.Lock()
+	stats, at := s.libraryStats, s.libraryStatsAt
+	s.libraryStatsMu.Unlock()
+
+	result := LibraryStatsResponse{
+		Formats:    []LibraryFormatStats{},
+		Bitrates:   []LibraryBitrateBand{},
+		Unreadable: []UnreadableFile{},
+	}
+	if stats != nil {
+		result.Scanned = true
+		result.ScannedAt = at.UnixMilli()
+		result.Tracks = stats.Tracks
+		result.Duration = stats.Duration
+		result.Size = stats.Size
+		result.UnknownBitrate = stats.UnknownBitrate
+		result.Folders = stats.Folders
+		result.MissingArt = stats.MissingArt
+		result.Untagged = stats.Untagged
+		result.LibraryErrors = stats.LibraryErrors
+		for _, f := range stats.Formats {
+			result.Formats = append(result.Formats, LibraryFormatStats(f))
+		}
+		for _, b := range stats.Bitrates {
+			result.Bitrates = append(result.Bitrates, LibraryBitrateBand(b))
+		}
+		for _, u := range stats.Unreadable {
+			result.Unreadable = append(result.Unreadable, UnreadableFile(u))
+		}
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
@@ -0,0 +1,88 @@
+package ipc
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	// maxRequestBytes caps the size of a single request line
+	maxRequestBytes = 1 << 20 // 1 MiB
+
+	// Per-connection request rate (token bucket)
+	requestRate  = 100.0 // sustained requests per second
+	requestBurst = 200.0 // short bursts allowed above the sustained rate
+)
+
+// errRequestTooLarge is returned by readLine when a line exceeds the limit
+var errRequestTooLarge = errors.New("request too large")
+
+// readLine reads a newline-terminated line of at most max bytes.
+// Longer lines are drained from the reader without being buffered and
+// errRequestTooLarge is returned, so the connection stays usable.
+func readLine(reader *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	tooLarge := false
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLarge {
+			if len(line)+len(chunk) > max {
+				tooLarge = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tooLarge {
+			return nil, errRequestTooLarge
+		}
+		return line, nil
+	}
+}
+
+// rateLimiter is a token bucket limiting requests on one connection
+type rateLimiter struct {
+	rate   float64 // tokens added per second
+	burst  float64 // bucket capacity
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// allow consumes a token if one is available. When the bucket is empty it
+// returns false and how long the caller should wait before retrying.
+func (r *rateLimiter) allow(now time.Time) (bool, time.Duration) {
+	elapsed := now.Sub(r.last).Seconds()
+	r.last = now
+
+	r.tokens += elapsed * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+
+	if r.tokens >= 1 {
+		r.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration(math.Ceil((1 - r.tokens) / r.rate * float64(time.Second)))
+	return false, wait
+}
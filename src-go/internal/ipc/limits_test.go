@@ -0,0 +1,74 @@
+package ipc
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadLineWithinLimit(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("{\"cmd\":\"status\"}\n"))
+
+	line, err := readLine(reader, 64)
+	if err != nil {
+		t.Fatalf("readLine failed: %v", err)
+	}
+	if string(line) != "{\"cmd\":\"status\"}\n" {
+		t.Errorf("Unexpected line: %q", line)
+	}
+}
+
+func TestReadLineTooLarge(t *testing.T) {
+	huge := strings.Repeat("x", 10000)
+	reader := bufio.NewReaderSize(strings.NewReader(huge+"\n{\"cmd\":\"status\"}\n"), 16)
+
+	if _, err := readLine(reader, 100); err != errRequestTooLarge {
+		t.Fatalf("Expected errRequestTooLarge, got %v", err)
+	}
+
+	// The oversized line is drained and the next request is readable
+	line, err := readLine(reader, 100)
+	if err != nil {
+		t.Fatalf("readLine after oversized line failed: %v", err)
+	}
+	if string(line) != "{\"cmd\":\"status\"}\n" {
+		t.Errorf("Unexpected line after oversized request: %q", line)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(10, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow(now); !ok {
+			t.Fatalf("Request %d within burst should be allowed", i)
+		}
+	}
+
+	ok, retryAfter := limiter.allow(now)
+	if ok {
+		t.Fatal("Request beyond burst should be limited")
+	}
+	if retryAfter <= 0 || retryAfter > 100*time.Millisecond {
+		t.Errorf("Expected retry hint of at most 100ms, got %v", retryAfter)
+	}
+
+	if ok, _ := limiter.allow(now.Add(retryAfter)); !ok {
+		t.Error("Request after the retry hint should be allowed")
+	}
+}
+
+func TestRateLimitedResponse(t *testing.T) {
+	resp := NewRateLimitedResponse(250 * time.Millisecond)
+	if resp.Success {
+		t.Error("Rate limited response should not be successful")
+	}
+	if resp.Code != ErrCodeRateLimited {
+		t.Errorf("Expected code %q, got %q", ErrCodeRateLimited, resp.Code)
+	}
+	if resp.RetryAfterMs != 250 {
+		t.Errorf("Expected retryAfterMs 250, got %d", resp.RetryAfterMs)
+	}
+}
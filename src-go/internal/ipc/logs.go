@@ -0,0 +1,123 @@
+package ipc
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+
+	"github.com/austinkregel/local-media/musicd/internal/logging"
+)
+
+// SetLogger gives the server access to the daemon's log history so clients
+// can fetch and follow it
+func (s *Server) SetLogger(logger *logging.Logger) {
+	s.logger = logger
+}
+
+// parseLogsRequest decodes optional getLogs/subscribeLogs data
+func parseLogsRequest(req *Request) (LogsRequest, slog.Level, bool) {
+	var logsReq LogsRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &logsReq); err != nil {
+			return logsReq, 0, false
+		}
+	}
+	if logsReq.Level == "" {
+		return logsReq, slog.LevelDebug, true
+	}
+	level, err := logging.ParseLevel(logsReq.Level)
+	if err != nil || logsReq.Limit < 0 {
+		return logsReq, 0, false
+	}
+	return logsReq, level, true
+}
+
+func (s *Server) handleGetLogs(req *Request) *Response {
+	if s.logger == nil {
+		return NewErrorResponse("logs not available")
+	}
+	logsReq, level, ok := parseLogsRequest(req)
+	if !ok {
+		return NewErrorResponse("invalid logs request")
+	}
+
+	entries := s.logger.Recent(logsReq.Limit, level)
+	result := GetLogsResponse{Entries: make([]LogEntry, len(entries))}
+	for i, e := range entries {
+		result.Entries[i] = toIPCLogEntry(e)
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// handleSubscribeLogs streams new log entries to the connection as "log"
+// push messages. Subscribing again replaces the previous level filter.
+func (s *Server) handleSubscribeLogs(conn net.Conn, req *Request) *Response {
+	if s.logger == nil {
+		return NewErrorResponse("logs not available")
+	}
+	_, level, ok := parseLogsRequest(req)
+	if !ok {
+		return NewErrorResponse("invalid logs request")
+	}
+
+	s.unsubscribeLogs(conn)
+
+	entries, unsubscribe := s.logger.Subscribe()
+	s.logSubsMu.Lock()
+	s.logSubs[conn] = unsubscribe
+	s.logSubsMu.Unlock()
+
+	go func() {
+		for e := range entries {
+			if slogLevel, _ := logging.ParseLevel(e.Level); slogLevel < level {
+				continue
+			}
+			msgBytes, err := NewPushMessage("log", toIPCLogEntry(e))
+			if err != nil {
+				continue
+			}
+			// Deliberately not logged: a failure here would feed back into
+			// the stream being written
+			if err := s.send(conn, append(msgBytes, '\n')); err != nil {
+				s.unsubscribeLogs(conn)
+				return
+			}
+		}
+	}()
+
+	resp, _ := NewSuccessResponse(map[string]bool{"subscribed": true})
+	return resp
+}
+
+func (s *Server) handleUnsubscribeLogs(conn net.Conn) *Response {
+	s.unsubscribeLogs(conn)
+	resp, _ := NewSuccessResponse(map[string]bool{"subscribed": false})
+	return resp
+}
+
+// unsubscribeLogs stops streaming logs to a connection, if it was subscribed
+func (s *Server) unsubscribeLogs(conn net.Conn) {
+	s.logSubsMu.Lock()
+	unsubscribe, ok := s.logSubs[conn]
+	delete(s.logSubs, conn)
+	s.logSubsMu.Unlock()
+
+	if ok {
+		unsubscribe()
+	}
+}
+
+func toIPCLogEntry(e logging.Entry) LogEntry {
+	return LogEntry{
+		Time:      e.Time.UnixMilli(),
+		Level:     e.Level,
+		Component: e.Component,
+		Message:   e.Message,
+		Attrs:     e.Attrs,
+	}
+}
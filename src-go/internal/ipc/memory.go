@@ -0,0 +1,51 @@
+package ipc
+
+import (
+	"runtime"
+
+	"github.com/austinkregel/local-media/musicd/internal/analysis"
+)
+
+// SetCacheBytes sets how much memory data read from disk when needed may
+// take
+func (s *Server) SetCacheBytes(maxBytes int64) {
+	if s.featureStore != nil {
+		s.featureStore.SetCacheBytes(maxBytes)
+	}
+}
+
+func (s *Server) handleGetMemoryStats() *Response {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	_, queueSize := s.queueMgr.Position()
+
+	result := GetMemoryStatsResponse{
+		HeapBytes:     m.HeapAlloc,
+		SysBytes:      m.Sys,
+		BudgetBytes:   int64(s.configMgr.Get().Memory.BudgetMB) << 20,
+		GCCycles:      m.NumGC,
+		Goroutines:    runtime.NumGoroutine(),
+		LibraryTracks: s.libraryIndex.Len(),
+		QueueItems:    queueSize,
+	}
+	if s.featureStore != nil {
+		result.AnalyzedTracks = s.featureStore.GetAnalyzedCount()
+		result.SimilarCache = toIPCCacheStats(s.featureStore.CacheStats())
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func toIPCCacheStats(stats analysis.CacheStats) CacheStats {
+	return CacheStats{
+		Entries:  stats.Entries,
+		Bytes:    stats.Bytes,
+		MaxBytes: stats.MaxBytes,
+		Hits:     stats.Hits,
+		Misses:   stats.Misses,
+	}
+}
@@ -0,0 +1,51 @@
+package ipc
+
+import (
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/metrics"
+)
+
+var (
+	ipcRequests = metrics.NewCounterVec("musicd_ipc_requests_total",
+		"IPC requests handled, by command", "command")
+	ipcErrors = metrics.NewCounterVec("musicd_ipc_errors_total",
+		"IPC requests that returned an error, by command", "command")
+	ipcLatency = metrics.NewHistogramVec("musicd_ipc_request_duration_seconds",
+		"Time spent handling IPC requests, by command", "command", metrics.DefaultBuckets)
+	droppedFrames = metrics.NewCounter("musicd_ipc_dropped_frames_total",
+		"Visualization frames dropped because a client was not keeping up")
+)
+
+// observeRequest records the outcome of a handled request
+func observeRequest(cmd CommandType, resp *Response, start time.Time) {
+	// Unknown commands share a label so clients cannot grow the label set
+	label := string(cmd)
+	if resp.Error == "unknown command" {
+		label = "unknown"
+	}
+
+	ipcRequests.With(label).Inc()
+	ipcLatency.With(label).ObserveDuration(start)
+	if !resp.Success {
+		ipcErrors.With(label).Inc()
+	}
+}
+
+func (s *Server) handleGetMetrics() *Response {
+	s.mu.Lock()
+	clients := len(s.clients)
+	s.mu.Unlock()
+
+	resp, err := NewSuccessResponse(GetMetricsResponse{
+		Status:        "ok",
+		UptimeSeconds: metrics.Uptime().Seconds(),
+		PlayerState:   string(s.player.Status().State),
+		Clients:       clients,
+		Metrics:       metrics.Snapshot(),
+	})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
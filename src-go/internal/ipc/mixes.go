@@ -0,0 +1,114 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/analysis"
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+)
+
+// How often the scheduler checks whether the daily mixes are due
+const dailyMixCheckInterval = time.Hour
+
+// scheduleDailyMixes regenerates the daily mixes once they are a day old by
+// clock
+func (s *Server) scheduleDailyMixes(ctx context.Context, clock audio.Clock) {
+	ticker := clock.NewTicker(dailyMixCheckInterval)
+	defer ticker.Stop()
+
+	now := clock.Now()
+	for {
+		if s.mixStore.Due(now) {
+			if err := s.generateDailyMixes(now); err != nil {
+				log.Printf("[ANALYSIS] Daily mixes not generated: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C():
+		}
+	}
+}
+
+// generateDailyMixes builds a new set of mixes, leaving out recently played
+// tracks and tracks no longer in the library. now is when they count as
+// generated from.
+func (s *Server) generateDailyMixes(now time.Time) error {
+	s.mixMu.Lock()
+	defer s.mixMu.Unlock()
+
+	if len(s.featureStore.GetCommunities()) == 0 {
+		return fmt.Errorf("no communities detected yet, rebuild the similarity graph first")
+	}
+
+	exclude := s.queueMgr.GetRecentlyPlayed()
+	if s.libraryIndex.Len() > 0 {
+		for path := range s.featureStore.GetAllFeatures() {
+			if _, ok := s.libraryIndex.Get(path); !ok {
+				exclude = append(exclude, path)
+			}
+		}
+	}
+
+	mixes := s.mixGenerator.Generate(analysis.DefaultDailyMixCount, analysis.DefaultDailyMixSize, exclude, now.UnixNano())
+	if err := s.mixStore.Set(mixes, now); err != nil {
+		return fmt.Errorf("save mixes: %w", err)
+	}
+
+	log.Printf("[ANALYSIS] Generated %d daily mixes", len(mixes))
+	return nil
+}
+
+func (s *Server) handleGetDailyMixes(req *Request) *Response {
+	if s.mixStore == nil {
+		return NewErrorResponse("analysis not available")
+	}
+
+	var mixReq GetDailyMixesRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &mixReq); err != nil {
+			return NewErrorResponse("invalid daily mixes request")
+		}
+	}
+
+	if mixReq.Refresh {
+		if err := s.generateDailyMixes(time.Now()); err != nil {
+			return NewErrorResponse(fmt.Sprintf("failed to generate daily mixes: %v", err))
+		}
+	}
+
+	stored := s.mixStore.Get()
+	result := GetDailyMixesResponse{
+		GeneratedAt: stored.GeneratedAt,
+		Mixes:       make([]DailyMix, 0, len(stored.Mixes)),
+	}
+	for _, mix := range stored.Mixes {
+		tracks := make([]LibraryTrack, 0, len(mix.Tracks))
+		for _, path := range mix.Tracks {
+			// Tracks removed since the mixes were generated are dropped
+			if t, ok := s.libraryIndex.Get(path); ok {
+				tracks = append(tracks, toLibraryTrack(t))
+			}
+		}
+		result.Mixes = append(result.Mixes, DailyMix{
+			ID:          mix.ID,
+			Name:        mix.Name,
+			Description: mix.Description,
+			CommunityID: mix.CommunityID,
+			Mood:        mix.Mood,
+			Tracks:      tracks,
+		})
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
@@ -0,0 +1,46 @@
+package ipc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/analysis"
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+)
+
+func TestDailyMixesRegeneratedDaily(t *testing.T) {
+	s := newTestServer(t)
+	for i := 0; i < 6; i++ {
+		s.featureStore.StoreCommunity(fmt.Sprintf("/music/%02d.flac", i), &analysis.TrackCommunity{CommunityID: 1})
+	}
+	s.featureStore.StoreCommunityInfo([]analysis.CommunityInfo{{ID: 1, Name: "Upbeat", TrackCount: 6}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	clock := audio.NewManualClock(start)
+	go s.scheduleDailyMixes(ctx, clock)
+	if err := clock.WaitFor(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each tick is only taken once the check before it is done
+	clock.Advance(dailyMixCheckInterval)
+	mixes := s.mixStore.Get()
+	if mixes.GeneratedAt != start.Unix() || len(mixes.Mixes) != 1 {
+		t.Fatalf("Expected mixes generated straight away, got %+v", mixes)
+	}
+
+	clock.Advance(analysis.DailyMixInterval - 2*dailyMixCheckInterval)
+	if got := s.mixStore.Get().GeneratedAt; got != start.Unix() {
+		t.Errorf("Expected the mixes kept for a day, regenerated at %d", got-start.Unix())
+	}
+
+	clock.Advance(2 * dailyMixCheckInterval)
+	want := start.Add(analysis.DailyMixInterval).Unix()
+	if got := s.mixStore.Get().GeneratedAt; got != want {
+		t.Errorf("Expected the mixes regenerated after a day, generated at %d", got-start.Unix())
+	}
+}
@@ -0,0 +1,59 @@
+package ipc
+
+import (
+	"log"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/media"
+)
+
+// SetNotifier sets where desktop notifications are posted on track change,
+// while the notifications setting is on for this OS
+func (s *Server) SetNotifier(n media.Notifier) {
+	s.notifier = n
+}
+
+// notifyDesktop posts a desktop notification for the track that just
+// started playing
+func (s *Server) notifyDesktop(status audio.Status) {
+	settings := s.configMgr.Get().Notifications
+	if s.notifier == nil || status.Path == "" || !settings.EnabledOn(runtime.GOOS) {
+		return
+	}
+
+	n := trackNotification(status)
+	n.Timeout = time.Duration(settings.TimeoutMs) * time.Millisecond
+	go func() {
+		if err := s.notifier.Notify(n); err != nil {
+			log.Printf("[MEDIA] Failed to post notification: %v", err)
+		}
+	}()
+}
+
+// trackNotification describes a track as "Title" over "Artist — Album",
+// falling back to the file name for untagged tracks
+func trackNotification(status audio.Status) media.Notification {
+	var n media.Notification
+	var details []string
+	if meta := status.Metadata; meta != nil {
+		n.Title = meta.Title
+		n.ImagePath = meta.ArtPath
+		for _, detail := range []string{meta.Artist, meta.Album} {
+			if detail != "" {
+				details = append(details, detail)
+			}
+		}
+	}
+	if n.Title == "" {
+		n.Title = filepath.Base(status.Path)
+	}
+	n.Body = strings.Join(details, " — ")
+	if n.ImagePath == "" && !audio.IsStreamURL(status.Path) {
+		n.ImagePath = audio.FindAlbumArt(status.Path)
+	}
+	return n
+}
@@ -0,0 +1,78 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/auth"
+)
+
+// checkPartyRequest keeps clients with the party scope but not playback to
+// appending to the queue. Returns nil if the request may go ahead.
+func checkPartyRequest(client auth.ClientInfo, req *Request) *Response {
+	if req.Cmd != CmdQueue || client.HasScope(auth.ScopePlayback) {
+		return nil
+	}
+	var queueReq QueueRequest
+	if err := json.Unmarshal(req.Data, &queueReq); err == nil && queueReq.Append {
+		return nil
+	}
+	log.Printf("[AUTH] Party client %s tried to replace the queue", client.ID)
+	return NewErrorResponse("permission denied: party clients can only append to the queue")
+}
+
+// handleVoteSkip counts the caller's vote to skip the current track, and
+// skips it once enough of the connected clients have voted. Votes are reset
+// when the track changes.
+func (s *Server) handleVoteSkip(ctx context.Context) *Response {
+	status := s.player.Status()
+	if status.Path == "" || status.State == audio.StateStopped {
+		return NewErrorResponse("nothing is playing")
+	}
+	by := actorFrom(ctx)
+	needed := s.skipVotesNeeded()
+
+	s.skipVotesMu.Lock()
+	if s.skipVotesPath != status.Path {
+		s.skipVotesPath = status.Path
+		s.skipVotes = make(map[string]bool)
+	}
+	s.skipVotes[by.ClientID] = true
+	result := SkipVotes{Path: status.Path, Votes: len(s.skipVotes), Needed: needed}
+	result.Skipped = result.Votes >= result.Needed
+	if result.Skipped {
+		s.skipVotesPath, s.skipVotes = "", nil
+	}
+	s.skipVotesMu.Unlock()
+
+	log.Printf("[QUEUE] Skip vote from %s: %d of %d needed", by.Name, result.Votes, result.Needed)
+	s.broadcastPushBy(by, "skipVotes", result)
+	if result.Skipped {
+		s.learnFromAdvance(status.Path, isSkip(status))
+		s.playNextTrack(trackChangeNext)
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// skipVotesNeeded returns how many votes skip the current track: the
+// configured share of the clients connected that can vote, at least one
+func (s *Server) skipVotesNeeded() int {
+	s.mu.Lock()
+	voters := make(map[string]bool)
+	for _, cc := range s.authedConns {
+		if cc.canVote {
+			voters[cc.ref.ClientID] = true
+		}
+	}
+	s.mu.Unlock()
+
+	percent := s.configMgr.Get().Party.VoteSkipPercent
+	return max(1, (len(voters)*percent+99)/100)
+}
@@ -0,0 +1,177 @@
+package ipc
+
+import (
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/auth"
+)
+
+// commandScopes maps every command to the scope a client needs to run it.
+// Commands missing here are refused, so each new one must be given a scope.
+var commandScopes = map[CommandType]auth.Scope{
+	// Pairing comes before a token; any valid token may rotate itself
+	CmdPair:         "",
+	CmdRefreshToken: "",
+
+	// Party guests can follow along, find tracks and add them, but not
+	// change what plays now. checkPartyRequest keeps them to appending.
+	CmdStatus:           auth.ScopeParty,
+	CmdStatusSince:      auth.ScopeParty,
+	CmdGetQueue:         auth.ScopeParty,
+	CmdQueue:            auth.ScopeParty,
+	CmdVoteSkip:         auth.ScopeParty,
+	CmdLibrarySearch:    auth.ScopeParty,
+	CmdLibraryGetGenres: auth.ScopeParty,
+	CmdLibraryGetYears:  auth.ScopeParty,
+	CmdLibraryGetTracks: auth.ScopeParty,
+
+	// Playback, the queue, and reading the library and daemon state
+	CmdPlay:                   auth.ScopePlayback,
+	CmdPause:                  auth.ScopePlayback,
+	CmdResume:                 auth.ScopePlayback,
+	CmdStop:                   auth.ScopePlayback,
+	CmdNext:                   auth.ScopePlayback,
+	CmdPrev:                   auth.ScopePlayback,
+	CmdSeek:                   auth.ScopePlayback,
+	CmdVolume:                 auth.ScopePlayback,
+	CmdAdjustVolume:           auth.ScopePlayback,
+	CmdGetConfig:              auth.ScopePlayback,
+	CmdGetScanStatus:          auth.ScopePlayback,
+	CmdSubscribeScanResults:   auth.ScopePlayback,
+	CmdUnsubscribeScanResults: auth.ScopePlayback,
+	CmdLibraryGetComposers:    auth.ScopePlayback,
+	CmdLibraryGetWorks:        auth.ScopePlayback,
+	CmdLibraryGetMovements:    auth.ScopePlayback,
+	CmdFindDuplicates:         auth.ScopePlayback,
+	CmdLibraryStats:           auth.ScopePlayback,
+	CmdGetDiscoveryStats:      auth.ScopePlayback,
+	CmdGetQuarantine:          auth.ScopePlayback,
+	CmdSetRating:              auth.ScopePlayback,
+	CmdToggleFavorite:         auth.ScopePlayback,
+	CmdCacheTrack:             auth.ScopePlayback,
+	CmdGetTrackGain:           auth.ScopePlayback,
+	CmdListBookmarks:          auth.ScopePlayback,
+	CmdJumpToBookmark:         auth.ScopePlayback,
+	CmdListZones:              auth.ScopePlayback,
+	CmdEnableZone:             auth.ScopePlayback,
+	CmdSetZoneVolume:          auth.ScopePlayback,
+	CmdDuck:                   auth.ScopePlayback,
+	CmdAnnounce:               auth.ScopePlayback,
+	CmdStartFocusSession:      auth.ScopePlayback,
+	CmdStopFocusSession:       auth.ScopePlayback,
+	CmdGetFocusSession:        auth.ScopePlayback,
+	CmdListProfiles:           auth.ScopePlayback,
+	CmdSetProfile:             auth.ScopePlayback,
+	CmdListSchedules:          auth.ScopePlayback,
+	CmdInterpret:              auth.ScopePlayback,
+	CmdGetDSPChain:            auth.ScopePlayback,
+	CmdListRenderers:          auth.ScopePlayback,
+	CmdListStations:           auth.ScopePlayback,
+	CmdPodcastList:            auth.ScopePlayback,
+	CmdPodcastGetEpisodes:     auth.ScopePlayback,
+	CmdPodcastMarkPlayed:      auth.ScopePlayback,
+	CmdSetRepeat:              auth.ScopePlayback,
+	CmdSetShuffle:             auth.ScopePlayback,
+	CmdQueueJump:              auth.ScopePlayback,
+	CmdQueueRemove:            auth.ScopePlayback,
+	CmdQueueMove:              auth.ScopePlayback,
+	CmdQueueUndo:              auth.ScopePlayback,
+	CmdQueueRedo:              auth.ScopePlayback,
+	CmdPlayPath:               auth.ScopePlayback,
+	CmdQueueRemoveRange:       auth.ScopePlayback,
+	CmdQueueRemoveByPaths:     auth.ScopePlayback,
+	CmdQueueDeduplicate:       auth.ScopePlayback,
+	CmdQueueShuffleRemaining:  auth.ScopePlayback,
+	CmdQueueSmartOrder:        auth.ScopePlayback,
+	CmdGetAudioData:           auth.ScopePlayback,
+	CmdSubscribeAudioData:     auth.ScopePlayback,
+	CmdUnsubscribeAudioData:   auth.ScopePlayback,
+	CmdConfigureAudioData:     auth.ScopePlayback,
+	CmdGetAnalysisStatus:      auth.ScopePlayback,
+	CmdGetAnalysisCoverage:    auth.ScopePlayback,
+	CmdGetSimilarTracks:       auth.ScopePlayback,
+	CmdGetCommunities:         auth.ScopePlayback,
+	CmdGetCommunityTracks:     auth.ScopePlayback,
+	CmdGetBridgeTracks:        auth.ScopePlayback,
+	CmdExplainSimilarity:      auth.ScopePlayback,
+	CmdSetContinueMode:        auth.ScopePlayback,
+	CmdGetContinueMode:        auth.ScopePlayback,
+	CmdGetWaveform:            auth.ScopePlayback,
+	CmdGetPreview:             auth.ScopePlayback,
+	CmdPreviewPlay:            auth.ScopePlayback,
+	CmdPreviewStop:            auth.ScopePlayback,
+	CmdGetTrackFeatures:       auth.ScopePlayback,
+	CmdGetFeatureDistribution: auth.ScopePlayback,
+	CmdGetSmartPlaylist:       auth.ScopePlayback,
+	CmdGetDailyMixes:          auth.ScopePlayback,
+	CmdGetLearnedWeights:      auth.ScopePlayback,
+	CmdGetConnectedClients:    auth.ScopePlayback,
+	CmdGetLogs:                auth.ScopePlayback,
+	CmdSubscribeLogs:          auth.ScopePlayback,
+	CmdUnsubscribeLogs:        auth.ScopePlayback,
+	CmdGetMetrics:             auth.ScopePlayback,
+	CmdGetMemoryStats:         auth.ScopePlayback,
+
+	// Changes to the daemon's settings, and commands that reach out to the
+	// network or other devices
+	CmdSetConfig:          auth.ScopeConfigWrite,
+	CmdSaveStation:        auth.ScopeConfigWrite,
+	CmdRemoveStation:      auth.ScopeConfigWrite,
+	CmdSetDSPChain:        auth.ScopeConfigWrite,
+	CmdSetSchedule:        auth.ScopeConfigWrite,
+	CmdDeleteSchedule:     auth.ScopeConfigWrite,
+	CmdSetRenderer:        auth.ScopeConfigWrite,
+	CmdPodcastSubscribe:   auth.ScopeConfigWrite,
+	CmdPodcastUnsubscribe: auth.ScopeConfigWrite,
+	CmdPodcastDownload:    auth.ScopeConfigWrite,
+
+	// The library, the per-track data kept with it, and other clients
+	CmdScanLibrary:         auth.ScopeLibraryAdmin,
+	CmdStartAnalysis:       auth.ScopeLibraryAdmin,
+	CmdPauseAnalysis:       auth.ScopeLibraryAdmin,
+	CmdResumeAnalysis:      auth.ScopeLibraryAdmin,
+	CmdCancelAnalysis:      auth.ScopeLibraryAdmin,
+	CmdRebuildGraph:        auth.ScopeLibraryAdmin,
+	CmdResetLearnedWeights: auth.ScopeLibraryAdmin,
+	CmdIdentifyTrack:       auth.ScopeLibraryAdmin,
+	CmdSetTrackTags:        auth.ScopeLibraryAdmin,
+	CmdRelocateLibrary:     auth.ScopeLibraryAdmin,
+	CmdRetryQuarantined:    auth.ScopeLibraryAdmin,
+	CmdSetTrackGain:        auth.ScopeLibraryAdmin,
+	CmdSetIntroSkip:        auth.ScopeLibraryAdmin,
+	CmdAddBookmark:         auth.ScopeLibraryAdmin,
+	CmdRemoveBookmark:      auth.ScopeLibraryAdmin,
+	CmdListClients:         auth.ScopeLibraryAdmin,
+	CmdApproveClient:       auth.ScopeLibraryAdmin,
+	CmdRevokeClient:        auth.ScopeLibraryAdmin,
+	CmdSetClientScopes:     auth.ScopeLibraryAdmin,
+	CmdSetClientMaxVolume:  auth.ScopeLibraryAdmin,
+	CmdExportSync:          auth.ScopeLibraryAdmin,
+	CmdImportSync:          auth.ScopeLibraryAdmin,
+	CmdDumpState:           auth.ScopeLibraryAdmin,
+	CmdAdvanceClock:        auth.ScopeLibraryAdmin,
+}
+
+// requiredScope returns the scope needed for cmd, or "" if none is needed.
+// ok is false for commands without a scope, which nobody may run.
+func requiredScope(cmd CommandType) (scope auth.Scope, ok bool) {
+	scope, ok = commandScopes[cmd]
+	return scope, ok
+}
+
+// scopeNames converts scopes to their wire names
+func scopeNames(scopes []auth.Scope) []string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return names
+}
+
+// unixMilliOrZero returns t in Unix ms, or 0 for the zero time
+func unixMilliOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
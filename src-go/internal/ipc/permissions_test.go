@@ -0,0 +1,95 @@
+package ipc
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/austinkregel/local-media/musicd/internal/auth"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		cmd  CommandType
+		want auth.Scope
+	}{
+		{CmdPlay, auth.ScopePlayback},
+		{CmdStatus, auth.ScopeParty},
+		{CmdVoteSkip, auth.ScopeParty},
+		{CmdVolume, auth.ScopePlayback},
+		{CmdSetConfig, auth.ScopeConfigWrite},
+		{CmdListStations, auth.ScopePlayback},
+		{CmdSaveStation, auth.ScopeConfigWrite},
+		{CmdScanLibrary, auth.ScopeLibraryAdmin},
+		{CmdIdentifyTrack, auth.ScopeLibraryAdmin},
+		{CmdCancelAnalysis, auth.ScopeLibraryAdmin},
+		{CmdResetLearnedWeights, auth.ScopeLibraryAdmin},
+		{CmdRelocateLibrary, auth.ScopeLibraryAdmin},
+		{CmdApproveClient, auth.ScopeLibraryAdmin},
+		{CmdRefreshToken, ""},
+		{CmdPodcastSubscribe, auth.ScopeConfigWrite},
+		{CmdSetRenderer, auth.ScopeConfigWrite},
+		{CmdAddBookmark, auth.ScopeLibraryAdmin},
+		{CmdSetTrackGain, auth.ScopeLibraryAdmin},
+	}
+
+	for _, tt := range tests {
+		if got, ok := requiredScope(tt.cmd); !ok || got != tt.want {
+			t.Errorf("requiredScope(%s) = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+	if _, ok := requiredScope("madeUp"); ok {
+		t.Error("Expected an unknown command to have no scope")
+	}
+}
+
+// TestEveryCommandHasScope walks the Cmd constants, so a new command can't
+// be added without deciding who may run it
+func TestEveryCommandHasScope(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "protocol.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			value := spec.(*ast.ValueSpec)
+			if ident, ok := value.Type.(*ast.Ident); !ok || ident.Name != "CommandType" {
+				continue
+			}
+			for _, name := range value.Names {
+				count++
+				lit := value.Values[0].(*ast.BasicLit)
+				cmd := CommandType(lit.Value[1 : len(lit.Value)-1])
+				if _, ok := requiredScope(cmd); !ok {
+					t.Errorf("%s has no entry in commandScopes", name.Name)
+				}
+			}
+		}
+	}
+	if count == 0 {
+		t.Fatal("Found no commands in protocol.go")
+	}
+}
+
+func TestPartyClientsOnlyAppend(t *testing.T) {
+	guest := auth.ClientInfo{ID: "guest", Scopes: []auth.Scope{auth.ScopeParty}}
+	host := auth.ClientInfo{ID: "host", Scopes: []auth.Scope{auth.ScopePlayback}}
+	replace := &Request{Cmd: CmdQueue, Data: []byte(`{"items":[{"path":"/m/1.flac"}]}`)}
+	appendReq := &Request{Cmd: CmdQueue, Data: []byte(`{"items":[{"path":"/m/1.flac"}],"append":true}`)}
+
+	if resp := checkPartyRequest(guest, replace); resp == nil {
+		t.Error("Expected a party client to be stopped from replacing the queue")
+	}
+	if resp := checkPartyRequest(guest, appendReq); resp != nil {
+		t.Errorf("Expected a party client to append, got %q", resp.Error)
+	}
+	if resp := checkPartyRequest(host, replace); resp != nil {
+		t.Errorf("Expected a playback client to replace the queue, got %q", resp.Error)
+	}
+}
@@ -0,0 +1,71 @@
+package ipc
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+)
+
+// unsupportedFormatMessages are what ffmpeg and ffprobe print for files they
+// don't know how to read, as opposed to ones that are damaged
+var unsupportedFormatMessages = []string{
+	"invalid data found when processing input",
+	"unknown format",
+	"could not find codec parameters",
+	"decoder not found",
+	"not supported",
+	"unsupported",
+}
+
+// playbackFailed handles a track that failed to start: clients get a
+// playbackError push and unreadable files are quarantined. Returns the error
+// response, with its code, for the command that tried to play the track.
+func (s *Server) playbackFailed(path string, err error) *Response {
+	code := s.pushPlaybackError(path, err)
+	s.quarantineIfUnreadable(path, err)
+
+	resp := NewErrorResponse(err.Error())
+	resp.Code = code
+	return resp
+}
+
+// pushPlaybackError tells clients why path couldn't be played and returns
+// the error code it was given
+func (s *Server) pushPlaybackError(path string, err error) string {
+	code := playbackErrorCode(path, err)
+	s.broadcastPush("playbackError", PlaybackErrorPush{Path: path, Error: err.Error(), Code: code})
+	return code
+}
+
+// playbackErrorCode works out which ErrCode... best describes a playback
+// failure, falling back to ErrCodeDecodeFailed
+func playbackErrorCode(path string, err error) string {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrCodeNotFound
+	}
+	if !audio.IsStreamURL(path) {
+		if _, statErr := os.Stat(path); errors.Is(statErr, fs.ErrNotExist) {
+			return ErrCodeNotFound
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		msg += " " + strings.ToLower(string(exitErr.Stderr))
+	}
+	if errors.Is(err, syscall.EBUSY) || strings.Contains(msg, "device or resource busy") || strings.Contains(msg, "device busy") {
+		return ErrCodeDeviceBusy
+	}
+	for _, m := range unsupportedFormatMessages {
+		if strings.Contains(msg, m) {
+			return ErrCodeUnsupportedFormat
+		}
+	}
+	return ErrCodeDecodeFailed
+}
@@ -0,0 +1,36 @@
+package ipc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestPlaybackErrorCode(t *testing.T) {
+	dir := t.TempDir()
+	present := filepath.Join(dir, "track.flac")
+	if err := os.WriteFile(present, []byte("not audio"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		err  error
+		want string
+	}{
+		{"missing file", filepath.Join(dir, "gone.flac"), errors.New("failed to get duration: ffprobe failed: exit status 1"), ErrCodeNotFound},
+		{"device busy", present, fmt.Errorf("failed to open output: %w", syscall.EBUSY), ErrCodeDeviceBusy},
+		{"unknown format", present, errors.New("track.flac: Invalid data found when processing input"), ErrCodeUnsupportedFormat},
+		{"damaged file", present, errors.New("ffmpeg exited: exit status 183"), ErrCodeDecodeFailed},
+		{"stream", "http://radio.example/live", errors.New("connection reset"), ErrCodeDecodeFailed},
+	}
+	for _, tt := range tests {
+		if got := playbackErrorCode(tt.path, tt.err); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
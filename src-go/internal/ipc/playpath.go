@@ -0,0 +1,154 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/cue"
+	"github.com/austinkregel/local-media/musicd/internal/library"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+	"github.com/austinkregel/local-media/musicd/internal/scanner"
+)
+
+func (s *Server) handlePlayPath(ctx context.Context, req *Request) *Response {
+	var playReq PlayPathRequest
+	if err := json.Unmarshal(req.Data, &playReq); err != nil || playReq.Path == "" {
+		return NewErrorResponse("invalid playPath request")
+	}
+	dir := filepath.Clean(playReq.Path)
+	if info, err := os.Stat(dir); err != nil {
+		return NewErrorResponse(fmt.Sprintf("cannot read folder: %v", err))
+	} else if !info.IsDir() {
+		return NewErrorResponse("not a folder")
+	}
+
+	paths, err := scanner.FolderTracks(ctx, dir, playReq.Recursive)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	// Links in the folder may lead out of the library
+	if cfg := s.configMgr.Get(); cfg.Auth.Sandbox {
+		paths = s.sandboxPolicy(cfg).allowed(paths)
+	}
+	if len(paths) == 0 {
+		return NewErrorResponse("no tracks in folder")
+	}
+	items := s.folderQueueItems(paths)
+	log.Printf("[QUEUE] Play folder %s: %d tracks, recursive=%v, append=%v", dir, len(items), playReq.Recursive, playReq.Append)
+
+	if playReq.Append {
+		s.queueMgr.AppendWithMetadata(items)
+		return s.handleStatus()
+	}
+
+	if resp := s.playQueueItems(ctx, items); resp != nil {
+		return resp
+	}
+	return s.handleStatus()
+}
+
+// playQueueItems replaces the queue with items and plays the first. It
+// returns an error response if that fails to play, or nil.
+func (s *Server) playQueueItems(ctx context.Context, items []queue.QueueItem) *Response {
+	s.queueMgr.SetWithMetadata(items)
+	s.forgetTransition()
+	path, metadata := s.queueMgr.Next()
+	var audioMeta *audio.TrackMetadata
+	if metadata != nil {
+		audioMeta = &audio.TrackMetadata{
+			Title:    metadata.Title,
+			Artist:   metadata.Artist,
+			Album:    metadata.Album,
+			Duration: metadata.Duration,
+		}
+	}
+	if err := s.player.Play(ctx, path, audioMeta); err != nil {
+		return s.playbackFailed(path, err)
+	}
+	s.notifyTrackChanged(ctx, trackChangePlay)
+	return nil
+}
+
+// folderQueueItems orders the tracks of a folder for playing: folder by
+// folder, then by disc and track number where the library has them, with
+// untagged tracks after the tagged ones in file name order. Names compare
+// with numbers by value, so "Track 2" comes before "Track 10", and an
+// album's pre-gap track comes first.
+func (s *Server) folderQueueItems(paths []string) []queue.QueueItem {
+	type folderTrack struct {
+		item        queue.QueueItem
+		dir, dirKey string
+		name        string
+		disc, track int
+		pregap      bool
+	}
+
+	tracks := make([]folderTrack, len(paths))
+	for i, path := range paths {
+		t := folderTrack{
+			item: queue.QueueItem{Path: path},
+			dir:  filepath.Dir(path),
+			name: strings.ToLower(filepath.Base(path)),
+		}
+		if indexed, ok := s.libraryIndex.Get(path); ok {
+			t.disc, t.track = indexed.DiscNumber, indexed.TrackNumber
+			t.item.Metadata = &queue.TrackMetadata{
+				Title:    indexed.Title,
+				Artist:   indexed.Artist,
+				Album:    indexed.Album,
+				Duration: indexed.Duration,
+			}
+		} else if _, number, ok := cue.SplitTrackPath(path); ok {
+			t.track = number
+		}
+		t.dirKey = strings.ToLower(t.dir)
+		t.pregap = t.track == 0 && isPregap(t.name)
+		tracks[i] = t
+	}
+
+	sort.SliceStable(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if a.dir != b.dir {
+			if a.dirKey != b.dirKey {
+				return library.NaturalLess(a.dirKey, b.dirKey)
+			}
+			return a.dir < b.dir
+		}
+		if a.pregap != b.pregap {
+			return a.pregap
+		}
+		if (a.track == 0) != (b.track == 0) {
+			return a.track != 0
+		}
+		if a.disc != b.disc {
+			return a.disc < b.disc
+		}
+		if a.track != b.track {
+			return a.track < b.track
+		}
+		return library.NaturalLess(a.name, b.name)
+	})
+
+	items := make([]queue.QueueItem, len(tracks))
+	for i, t := range tracks {
+		items[i] = t.item
+	}
+	return items
+}
+
+// isPregap reports whether a file name is that of the audio hidden before
+// an album's first track, such as "00 - pregap.flac"
+func isPregap(name string) bool {
+	if strings.Contains(name, "pregap") || strings.Contains(name, "pre-gap") {
+		return true
+	}
+	digits := strings.TrimLeft(name, "0")
+	return len(digits) < len(name) && (digits == "" || digits[0] < '0' || digits[0] > '9')
+}
@@ -0,0 +1,18 @@
+package ipc
+
+import "testing"
+
+func TestIsPregap(t *testing.T) {
+	for name, want := range map[string]bool{
+		"00 - hidden track.flac": true,
+		"0.flac":                 true,
+		"pregap.wav":             true,
+		"01 - intro.flac":        false,
+		"007 - theme.mp3":        false,
+		"track 10.mp3":           false,
+	} {
+		if got := isPregap(name); got != want {
+			t.Errorf("isPregap(%q): expected %v, got %v", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/podcast"
+)
+
+// SetPodcasts enables the podcast commands
+func (s *Server) SetPodcasts(m *podcast.Manager) {
+	s.podcasts = m
+}
+
+func (s *Server) handlePodcastSubscribe(ctx context.Context, req *Request) *Response {
+	if s.podcasts == nil {
+		return NewErrorResponse("podcasts not available")
+	}
+	var podcastReq PodcastRequest
+	if err := json.Unmarshal(req.Data, &podcastReq); err != nil || !audio.IsStreamURL(podcastReq.FeedURL) {
+		return NewErrorResponse("invalid podcastSubscribe request")
+	}
+
+	p, err := s.podcasts.Subscribe(ctx, podcastReq.FeedURL)
+	if err != nil {
+		log.Printf("[PODCAST] Failed to subscribe to %s: %v", podcastReq.FeedURL, err)
+		return NewErrorResponse("failed to subscribe: " + err.Error())
+	}
+	log.Printf("[PODCAST] Subscribed to %s", p.Title)
+	return s.podcastEpisodesResponse(podcastReq.FeedURL)
+}
+
+func (s *Server) handlePodcastUnsubscribe(req *Request) *Response {
+	if s.podcasts == nil {
+		return NewErrorResponse("podcasts not available")
+	}
+	var podcastReq PodcastRequest
+	if err := json.Unmarshal(req.Data, &podcastReq); err != nil || podcastReq.FeedURL == "" {
+		return NewErrorResponse("invalid podcastUnsubscribe request")
+	}
+
+	if err := s.podcasts.Unsubscribe(podcastReq.FeedURL); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	log.Printf("[PODCAST] Unsubscribed from %s", podcastReq.FeedURL)
+	return s.handlePodcastList()
+}
+
+func (s *Server) handlePodcastList() *Response {
+	if s.podcasts == nil {
+		return NewErrorResponse("podcasts not available")
+	}
+
+	result := PodcastListResponse{Podcasts: []Podcast{}}
+	for _, p := range s.podcasts.List() {
+		result.Podcasts = append(result.Podcasts, toIPCPodcast(p))
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handlePodcastGetEpisodes(req *Request) *Response {
+	if s.podcasts == nil {
+		return NewErrorResponse("podcasts not available")
+	}
+	var podcastReq PodcastRequest
+	if err := json.Unmarshal(req.Data, &podcastReq); err != nil || podcastReq.FeedURL == "" {
+		return NewErrorResponse("invalid podcastGetEpisodes request")
+	}
+	return s.podcastEpisodesResponse(podcastReq.FeedURL)
+}
+
+func (s *Server) handlePodcastMarkPlayed(req *Request) *Response {
+	if s.podcasts == nil {
+		return NewErrorResponse("podcasts not available")
+	}
+	var episodeReq PodcastEpisodeRequest
+	if err := json.Unmarshal(req.Data, &episodeReq); err != nil || episodeReq.FeedURL == "" || episodeReq.EpisodeID == "" {
+		return NewErrorResponse("invalid podcastMarkPlayed request")
+	}
+	played := true
+	if episodeReq.Played != nil {
+		played = *episodeReq.Played
+	}
+
+	if err := s.podcasts.MarkPlayed(episodeReq.FeedURL, episodeReq.EpisodeID, played); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	return s.podcastEpisodesResponse(episodeReq.FeedURL)
+}
+
+// handlePodcastDownload starts downloading an episode and returns straight
+// away; a podcastDownloaded push follows when it finishes
+func (s *Server) handlePodcastDownload(ctx context.Context, req *Request) *Response {
+	if s.podcasts == nil {
+		return NewErrorResponse("podcasts not available")
+	}
+	var episodeReq PodcastEpisodeRequest
+	if err := json.Unmarshal(req.Data, &episodeReq); err != nil || episodeReq.FeedURL == "" || episodeReq.EpisodeID == "" {
+		return NewErrorResponse("invalid podcastDownload request")
+	}
+	if _, err := s.podcasts.Episodes(episodeReq.FeedURL); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	go func() {
+		push := PodcastDownloadedPush{FeedURL: episodeReq.FeedURL, EpisodeID: episodeReq.EpisodeID}
+		path, err := s.podcasts.Download(ctx, episodeReq.FeedURL, episodeReq.EpisodeID)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, podcast.ErrDownloading) {
+				return
+			}
+			log.Printf("[PODCAST] Failed to download %s: %v", episodeReq.EpisodeID, err)
+			push.Error = err.Error()
+		} else {
+			log.Printf("[PODCAST] Downloaded %s to %s", episodeReq.EpisodeID, path)
+			push.Path = path
+		}
+		s.broadcastPushBy(actorFrom(ctx), "podcastDownloaded", push)
+	}()
+
+	resp, _ := NewSuccessResponse(map[string]bool{"downloading": true})
+	return resp
+}
+
+// podcastEpisodesResponse lists a subscribed podcast and its episodes
+func (s *Server) podcastEpisodesResponse(feedURL string) *Response {
+	episodes, err := s.podcasts.Episodes(feedURL)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	result := PodcastEpisodesResponse{Episodes: make([]PodcastEpisode, 0, len(episodes))}
+	for _, p := range s.podcasts.List() {
+		if p.FeedURL == feedURL {
+			result.Podcast = toIPCPodcast(p)
+		}
+	}
+	for _, e := range episodes {
+		episode := PodcastEpisode{
+			ID:          e.ID,
+			Title:       e.Title,
+			Description: e.Description,
+			Duration:    e.Duration,
+			Path:        e.Path(),
+			AudioURL:    e.AudioURL,
+			Downloaded:  e.LocalPath != "",
+			Position:    e.Position,
+			Played:      e.Played,
+		}
+		if !e.Published.IsZero() {
+			episode.Published = e.Published.UnixMilli()
+		}
+		result.Episodes = append(result.Episodes, episode)
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func toIPCPodcast(p podcast.Podcast) Podcast {
+	result := Podcast{
+		FeedURL:     p.FeedURL,
+		Title:       p.Title,
+		Author:      p.Author,
+		Description: p.Description,
+		ImageURL:    p.ImageURL,
+		Error:       p.Error,
+	}
+	if !p.Refreshed.IsZero() {
+		result.Refreshed = p.Refreshed.UnixMilli()
+	}
+	return result
+}
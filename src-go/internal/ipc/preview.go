@@ -0,0 +1,165 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/transcode"
+)
+
+const (
+	defaultPreviewSeconds = 15
+	maxPreviewSeconds     = 60
+)
+
+// previewBitrates are the bitrates clips are encoded at, kept low since
+// they're sent over IPC and only heard briefly
+var previewBitrates = map[string]int{
+	"opus": 48,
+	"mp3":  64,
+}
+
+// previewStart returns where a clip of length should start in the track at
+// path, and whether it was picked from the track's analysis. Without a
+// waveform it starts a third of the way in, past most intros.
+func (s *Server) previewStart(path string, length, duration time.Duration) (time.Duration, bool) {
+	if s.featureStore != nil {
+		if waveform, err := s.featureStore.GetWaveform(path); err == nil {
+			return waveform.PreviewStart(length), true
+		} else if !os.IsNotExist(err) {
+			log.Printf("[ANALYSIS] Failed to read waveform for %s: %v", path, err)
+		}
+	}
+	if duration <= length {
+		return 0, false
+	}
+	return min(duration/3, duration-length), false
+}
+
+func (s *Server) handleGetPreview(ctx context.Context, req *Request) *Response {
+	if s.transcoder == nil {
+		return NewErrorResponse("previews not available")
+	}
+
+	var previewReq GetPreviewRequest
+	if err := json.Unmarshal(req.Data, &previewReq); err != nil || previewReq.Path == "" {
+		return NewErrorResponse("invalid getPreview request")
+	}
+	if previewReq.Seconds == 0 {
+		previewReq.Seconds = defaultPreviewSeconds
+	}
+	if previewReq.Seconds < 1 || previewReq.Seconds > maxPreviewSeconds {
+		return NewErrorResponse("seconds must be between 1 and 60")
+	}
+	if previewReq.Format == "" {
+		previewReq.Format = "opus"
+	}
+	bitrate, ok := previewBitrates[previewReq.Format]
+	if !ok {
+		return NewErrorResponse("format must be opus or mp3")
+	}
+
+	// Only tracks in the library, so this can't be used to read other files
+	track, ok := s.libraryIndex.Get(previewReq.Path)
+	if !ok {
+		return NewErrorResponse("track not in library")
+	}
+
+	duration := time.Duration(track.Duration) * time.Millisecond
+	length := time.Duration(previewReq.Seconds) * time.Second
+	start, fromAnalysis := s.previewStart(track.Path, length, duration)
+	if duration > 0 {
+		length = min(length, duration-start)
+	}
+
+	profile := transcode.Profile{
+		Format:      previewReq.Format,
+		BitrateKbps: bitrate,
+		Start:       start,
+		Length:      length,
+	}
+	file, err := s.transcoder.Get(ctx, track.Path, profile)
+	if err != nil {
+		log.Printf("[PREVIEW] Failed to cut preview of %s: %v", track.Path, err)
+		return NewErrorResponse("failed to cut preview")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		log.Printf("[PREVIEW] Failed to read preview of %s: %v", track.Path, err)
+		return NewErrorResponse("failed to read preview")
+	}
+
+	resp, err := NewSuccessResponse(GetPreviewResponse{
+		Path:         track.Path,
+		StartMs:      start.Milliseconds(),
+		DurationMs:   length.Milliseconds(),
+		ContentType:  profile.ContentType(),
+		Data:         data,
+		FromAnalysis: fromAnalysis,
+	})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handlePreviewPlay(req *Request) *Response {
+	preview := s.player.Preview()
+	if preview == nil {
+		return NewErrorResponse("preview channel not available")
+	}
+
+	var playReq PreviewPlayRequest
+	if err := json.Unmarshal(req.Data, &playReq); err != nil || playReq.Path == "" || playReq.LengthMs < 0 {
+		return NewErrorResponse("invalid previewPlay request")
+	}
+	track, ok := s.libraryIndex.Get(playReq.Path)
+	if !ok {
+		return NewErrorResponse("track not in library")
+	}
+
+	var startMs int64
+	if playReq.StartMs != nil {
+		startMs = max(*playReq.StartMs, 0)
+	} else {
+		length := time.Duration(playReq.LengthMs) * time.Millisecond
+		if length == 0 {
+			length = defaultPreviewSeconds * time.Second
+		}
+		start, _ := s.previewStart(track.Path, length, time.Duration(track.Duration)*time.Millisecond)
+		startMs = start.Milliseconds()
+	}
+
+	if err := preview.Play(track.Path, startMs, playReq.LengthMs); err != nil {
+		log.Printf("[PREVIEW] Failed to preview %s: %v", track.Path, err)
+		return NewErrorResponse(err.Error())
+	}
+	log.Printf("[PREVIEW] Previewing %s from %dms", track.Path, startMs)
+
+	resp, err := NewSuccessResponse(PreviewStatusResponse{
+		Path:    track.Path,
+		StartMs: startMs,
+		Volume:  preview.Volume(),
+	})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handlePreviewStop() *Response {
+	preview := s.player.Preview()
+	if preview == nil {
+		return NewErrorResponse("preview channel not available")
+	}
+	preview.Stop()
+
+	resp, err := NewSuccessResponse(PreviewStatusResponse{Volume: preview.Volume()})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
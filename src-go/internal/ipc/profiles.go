@@ -0,0 +1,176 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+)
+
+// How often the scheduler checks whether another profile's start time has
+// come round
+const profileCheckInterval = time.Minute
+
+// scheduleProfiles switches to each profile with a start time as it comes
+// round. A profile switched to by hand stays until the next one starts.
+func (s *Server) scheduleProfiles(ctx context.Context) {
+	ticker := time.NewTicker(profileCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		profile, ok := s.configMgr.Get().ScheduledProfile(time.Now())
+		s.profileMu.Lock()
+		due := ok && profile.Name != s.scheduledProfile
+		if due {
+			s.scheduledProfile = profile.Name
+		}
+		s.profileMu.Unlock()
+
+		if due {
+			log.Printf("[PROFILE] Switching to %q, scheduled for %s", profile.Name, profile.Start)
+			if err := s.applyProfile(ctx, profile, false); err != nil {
+				log.Printf("[PROFILE] Failed to switch to %q: %v", profile.Name, err)
+			} else {
+				s.broadcastPush("profileChanged", ProfileChangedPush{Name: profile.Name, Scheduled: true})
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) handleListProfiles() *Response {
+	result := ListProfilesResponse{Profiles: []Profile{}}
+	for _, p := range s.configMgr.Get().Profiles {
+		result.Profiles = append(result.Profiles, Profile{
+			Name:          p.Name,
+			Volume:        p.Volume,
+			EQ:            p.EQ,
+			ContinueMode:  p.ContinueMode,
+			Seed:          p.Seed,
+			SeedCommunity: p.SeedCommunity,
+			Start:         p.Start,
+		})
+	}
+	s.profileMu.Lock()
+	result.Active = s.activeProfile
+	s.profileMu.Unlock()
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// handleSetProfile switches to a profile by name
+func (s *Server) handleSetProfile(ctx context.Context, req *Request) *Response {
+	var profileReq SetProfileRequest
+	if err := json.Unmarshal(req.Data, &profileReq); err != nil || profileReq.Name == "" {
+		return NewErrorResponse("invalid setProfile request")
+	}
+
+	var profile config.ProfileConfig
+	found := false
+	for _, p := range s.configMgr.Get().Profiles {
+		if p.Name == profileReq.Name {
+			profile, found = p, true
+			break
+		}
+	}
+	if !found {
+		return NewErrorResponse(fmt.Sprintf("unknown profile %q", profileReq.Name))
+	}
+
+	log.Printf("[PROFILE] Switching to %q, play=%v", profile.Name, profileReq.Play)
+	if err := s.applyProfile(ctx, profile, profileReq.Play); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	s.broadcastPushBy(actorFrom(ctx), "profileChanged", ProfileChangedPush{Name: profile.Name})
+	return s.handleListProfiles()
+}
+
+// applyProfile applies the settings profile has, and plays its seed if play
+// is set
+func (s *Server) applyProfile(ctx context.Context, profile config.ProfileConfig, play bool) error {
+	var items []string
+	if play {
+		var err error
+		if items, err = s.profileSeed(profile); err != nil {
+			return err
+		}
+	}
+
+	if profile.Volume != nil {
+		if err := s.player.SetVolume(*profile.Volume); err != nil {
+			return fmt.Errorf("failed to set volume: %w", err)
+		}
+	}
+	if profile.EQ != nil {
+		if err := s.player.SetDSPChain(withEQ(s.player.DSPChain(), profile.EQ)); err != nil {
+			return fmt.Errorf("failed to set EQ: %w", err)
+		}
+		s.broadcastPush("dspChainChanged", s.dspChain())
+	}
+	if profile.ContinueMode != "" {
+		s.setContinueMode(profile.ContinueMode)
+	}
+
+	s.profileMu.Lock()
+	s.activeProfile = profile.Name
+	s.profileMu.Unlock()
+
+	if play {
+		if resp := s.playQueueItems(ctx, s.libraryQueueItems(items)); resp != nil {
+			return errors.New(resp.Error)
+		}
+	}
+	return nil
+}
+
+// profileSeed returns the library tracks of a profile's seed playlist or
+// community
+func (s *Server) profileSeed(profile config.ProfileConfig) ([]string, error) {
+	var paths []string
+	switch {
+	case profile.SeedCommunity != nil:
+		if s.featureStore == nil {
+			return nil, fmt.Errorf("analysis not available")
+		}
+		paths = s.inLibrary(s.featureStore.GetTracksInCommunity(*profile.SeedCommunity))
+	case profile.Seed != "":
+		var err error
+		if paths, err = s.playlistTracks(profile.Seed); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("profile %q has no seed to play", profile.Name)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("profile %q seed has no tracks in the library", profile.Name)
+	}
+	return paths, nil
+}
+
+// withEQ returns chain with its "eq" stage enabled and set to params, adding
+// one at the start if it has none
+func withEQ(chain []audio.DSPStageConfig, params map[string]float64) []audio.DSPStageConfig {
+	eq := audio.DSPStageConfig{Name: "eq", Enabled: true, Params: maps.Clone(params)}
+	for i, stage := range chain {
+		if stage.Name == eq.Name {
+			chain[i] = eq
+			return chain
+		}
+	}
+	return append([]audio.DSPStageConfig{eq}, chain...)
+}
@@ -0,0 +1,34 @@
+package ipc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+)
+
+func TestWithEQ(t *testing.T) {
+	gains := map[string]float64{"preamp": -2, "8k": 3}
+
+	chain := withEQ([]audio.DSPStageConfig{{Name: "limiter", Enabled: true}}, gains)
+	want := []audio.DSPStageConfig{
+		{Name: "eq", Enabled: true, Params: gains},
+		{Name: "limiter", Enabled: true},
+	}
+	if !reflect.DeepEqual(chain, want) {
+		t.Errorf("Expected eq to be added first, got %+v", chain)
+	}
+
+	// An existing eq keeps its place and is turned on
+	chain = withEQ([]audio.DSPStageConfig{
+		{Name: "replaygain", Enabled: true},
+		{Name: "eq", Params: map[string]float64{"1k": -6}},
+	}, gains)
+	want = []audio.DSPStageConfig{
+		{Name: "replaygain", Enabled: true},
+		{Name: "eq", Enabled: true, Params: gains},
+	}
+	if !reflect.DeepEqual(chain, want) {
+		t.Errorf("Expected eq to be replaced in place, got %+v", chain)
+	}
+}
@@ -4,6 +4,10 @@ package ipc
 import (
 	"encoding/json"
 	"fmt"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/config"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
 )
 
 // CommandType represents the type of command
@@ -20,12 +24,106 @@ const (
 	CmdQueue         CommandType = "queue"
 	CmdSeek          CommandType = "seek"
 	CmdVolume        CommandType = "volume"
+	CmdAdjustVolume  CommandType = "adjustVolume"
 	CmdStatus        CommandType = "status"
+	CmdStatusSince   CommandType = "statusSince"
 	CmdGetConfig     CommandType = "getConfig"
 	CmdSetConfig     CommandType = "setConfig"
 	CmdScanLibrary   CommandType = "scanLibrary"
 	CmdGetScanStatus CommandType = "getScanStatus"
 
+	// Streaming scan results
+	CmdSubscribeScanResults   CommandType = "subscribeScanResults"
+	CmdUnsubscribeScanResults CommandType = "unsubscribeScanResults"
+
+	// Library browsing
+	CmdLibrarySearch       CommandType = "librarySearch"
+	CmdLibraryGetGenres    CommandType = "libraryGetGenres"
+	CmdLibraryGetYears     CommandType = "libraryGetYears"
+	CmdLibraryGetTracks    CommandType = "libraryGetTracks"
+	CmdLibraryGetComposers CommandType = "libraryGetComposers"
+	CmdLibraryGetWorks     CommandType = "libraryGetWorks"
+	CmdLibraryGetMovements CommandType = "libraryGetMovements"
+	CmdFindDuplicates      CommandType = "findDuplicates"
+	CmdLibraryStats        CommandType = "libraryStats"
+	CmdGetDiscoveryStats   CommandType = "getDiscoveryStats"
+	CmdGetQuarantine       CommandType = "getQuarantine"
+	CmdRetryQuarantined    CommandType = "retryQuarantined"
+	CmdIdentifyTrack       CommandType = "identifyTrack"
+	CmdSetTrackTags        CommandType = "setTrackTags"
+	CmdRelocateLibrary     CommandType = "relocateLibrary"
+
+	// Ratings and favorites
+	CmdSetRating      CommandType = "setRating"
+	CmdToggleFavorite CommandType = "toggleFavorite"
+
+	// Intros skipped when tracks start
+	CmdSetIntroSkip CommandType = "setIntroSkip"
+
+	// Local copies of upcoming tracks
+	CmdCacheTrack CommandType = "cacheTrack"
+
+	// Per-track gain
+	CmdGetTrackGain CommandType = "getTrackGain"
+	CmdSetTrackGain CommandType = "setTrackGain"
+
+	// Bookmarks within tracks
+	CmdAddBookmark    CommandType = "addBookmark"
+	CmdListBookmarks  CommandType = "listBookmarks"
+	CmdRemoveBookmark CommandType = "removeBookmark"
+	CmdJumpToBookmark CommandType = "jumpToBookmark"
+
+	// Output zones
+	CmdListZones     CommandType = "listZones"
+	CmdEnableZone    CommandType = "enableZone"
+	CmdSetZoneVolume CommandType = "setZoneVolume"
+
+	// Lowering the music under other sounds
+	CmdDuck     CommandType = "duck"
+	CmdAnnounce CommandType = "announce"
+
+	// Timed focus sessions
+	CmdStartFocusSession CommandType = "startFocusSession"
+	CmdStopFocusSession  CommandType = "stopFocusSession"
+	CmdGetFocusSession   CommandType = "getFocusSession"
+
+	// Named playback profiles
+	CmdListProfiles CommandType = "listProfiles"
+	CmdSetProfile   CommandType = "setProfile"
+
+	// Scheduled playback, e.g. a sunrise alarm
+	CmdListSchedules  CommandType = "listSchedules"
+	CmdSetSchedule    CommandType = "setSchedule"
+	CmdDeleteSchedule CommandType = "deleteSchedule"
+
+	// Ratings, play counts and bookmarks carried between machines
+	CmdExportSync CommandType = "exportSync"
+	CmdImportSync CommandType = "importSync"
+
+	// Loosely worded requests, e.g. from speech to text
+	CmdInterpret CommandType = "interpret"
+
+	// Effects between the decoder and the output
+	CmdGetDSPChain CommandType = "getDSPChain"
+	CmdSetDSPChain CommandType = "setDSPChain"
+
+	// Playback on other devices
+	CmdListRenderers CommandType = "listRenderers"
+	CmdSetRenderer   CommandType = "setRenderer"
+
+	// Internet radio favorites
+	CmdListStations  CommandType = "listStations"
+	CmdSaveStation   CommandType = "saveStation"
+	CmdRemoveStation CommandType = "removeStation"
+
+	// Podcast subscriptions
+	CmdPodcastSubscribe   CommandType = "podcastSubscribe"
+	CmdPodcastUnsubscribe CommandType = "podcastUnsubscribe"
+	CmdPodcastList        CommandType = "podcastList"
+	CmdPodcastGetEpisodes CommandType = "podcastGetEpisodes"
+	CmdPodcastMarkPlayed  CommandType = "podcastMarkPlayed"
+	CmdPodcastDownload    CommandType = "podcastDownload"
+
 	// Queue management commands
 	CmdGetQueue     CommandType = "getQueue"
 	CmdSetRepeat    CommandType = "setRepeat"
@@ -33,17 +131,33 @@ const (
 	CmdQueueJump    CommandType = "queueJump"
 	CmdQueueRemove  CommandType = "queueRemove"
 	CmdQueueMove    CommandType = "queueMove"
+	CmdQueueUndo    CommandType = "queueUndo"
+	CmdQueueRedo    CommandType = "queueRedo"
+	CmdPlayPath     CommandType = "playPath"
+
+	// Party guests
+	CmdVoteSkip CommandType = "voteSkip"
+
+	// Bulk queue edits
+	CmdQueueRemoveRange      CommandType = "queueRemoveRange"
+	CmdQueueRemoveByPaths    CommandType = "queueRemoveByPaths"
+	CmdQueueDeduplicate      CommandType = "queueDeduplicate"
+	CmdQueueShuffleRemaining CommandType = "queueShuffleRemaining"
+	CmdQueueSmartOrder       CommandType = "queueSmartOrder"
 
 	// Audio visualization
 	CmdGetAudioData        CommandType = "getAudioData"
 	CmdSubscribeAudioData  CommandType = "subscribeAudioData"
 	CmdUnsubscribeAudioData CommandType = "unsubscribeAudioData"
+	CmdConfigureAudioData   CommandType = "configureAudioData"
 
 	// Audio analysis commands
 	CmdGetAnalysisStatus  CommandType = "getAnalysisStatus"
+	CmdGetAnalysisCoverage CommandType = "getAnalysisCoverage"
 	CmdStartAnalysis      CommandType = "startAnalysis"
 	CmdPauseAnalysis      CommandType = "pauseAnalysis"
 	CmdResumeAnalysis     CommandType = "resumeAnalysis"
+	CmdCancelAnalysis     CommandType = "cancelAnalysis"
 	CmdRebuildGraph       CommandType = "rebuildGraph"
 
 	// Similarity commands
@@ -54,12 +168,47 @@ const (
 	CmdExplainSimilarity   CommandType = "explainSimilarity"
 	CmdSetContinueMode     CommandType = "setContinueMode"
 	CmdGetContinueMode     CommandType = "getContinueMode"
+	CmdGetWaveform         CommandType = "getWaveform"
+	CmdGetPreview          CommandType = "getPreview"
+	CmdPreviewPlay         CommandType = "previewPlay"
+	CmdPreviewStop         CommandType = "previewStop"
+	CmdGetTrackFeatures    CommandType = "getTrackFeatures"
+	CmdGetFeatureDistribution CommandType = "getFeatureDistribution"
+	CmdGetSmartPlaylist    CommandType = "getSmartPlaylist"
+	CmdGetDailyMixes       CommandType = "getDailyMixes"
+	CmdGetLearnedWeights   CommandType = "getLearnedWeights"
+	CmdResetLearnedWeights CommandType = "resetLearnedWeights"
+
+	// Client management commands
+	CmdListClients        CommandType = "listClients"
+	CmdApproveClient      CommandType = "approveClient"
+	CmdRevokeClient       CommandType = "revokeClient"
+	CmdSetClientScopes    CommandType = "setClientScopes"
+	CmdSetClientMaxVolume CommandType = "setClientMaxVolume"
+	CmdRefreshToken       CommandType = "refreshToken"
+
+	// Connected clients
+	CmdGetConnectedClients CommandType = "getConnectedClients"
+
+	// Daemon logs
+	CmdGetLogs         CommandType = "getLogs"
+	CmdSubscribeLogs   CommandType = "subscribeLogs"
+	CmdUnsubscribeLogs CommandType = "unsubscribeLogs"
+
+	// Health and metrics
+	CmdGetMetrics     CommandType = "getMetrics"
+	CmdGetMemoryStats CommandType = "getMemoryStats"
+	CmdDumpState      CommandType = "dumpState"
+
+	// Simulated playback (musicd --simulate)
+	CmdAdvanceClock CommandType = "advanceClock"
 )
 
 // PushMessage represents a server-initiated message (no request needed)
 type PushMessage struct {
 	Type string          `json:"type"`
 	Data json.RawMessage `json:"data,omitempty"`
+	By   *ClientRef      `json:"by,omitempty"` // Client whose command caused the event, omitted for the daemon's own
 }
 
 // Request represents a client request
@@ -73,12 +222,35 @@ type Request struct {
 type Response struct {
 	Success bool            `json:"success"`
 	Error   string          `json:"error,omitempty"`
+	Code    string          `json:"code,omitempty"` // Machine-readable error code, e.g. "rate_limited"
 	Data    json.RawMessage `json:"data,omitempty"`
+
+	// RetryAfterMs hints how long to wait before retrying a rate limited request
+	RetryAfterMs int64 `json:"retryAfterMs,omitempty"`
 }
 
+// Error codes for structured error responses
+const (
+	ErrCodeRateLimited     = "rate_limited"
+	ErrCodeRequestTooLarge = "request_too_large"
+	ErrCodeConflict        = "conflict"
+	ErrCodeInvalidRequest  = "invalid_request"  // Data that fails the checks every command shares
+	ErrCodePathNotAllowed  = "path_not_allowed" // A file outside the folders the client may name
+)
+
+// Error codes for tracks that fail to play, on the error response of the
+// command that started them and in playbackError pushes
+const (
+	ErrCodeNotFound          = "ENOENT"             // The file is gone
+	ErrCodeDecodeFailed      = "DECODE_FAIL"        // ffmpeg failed to read the file
+	ErrCodeDeviceBusy        = "DEVICE_BUSY"        // The output device is in use
+	ErrCodeUnsupportedFormat = "UNSUPPORTED_FORMAT" // ffmpeg doesn't know the format
+)
+
 // PairRequest is the data for a pair command
 type PairRequest struct {
-	ClientName string `json:"clientName"`
+	ClientName string   `json:"clientName"`
+	Scopes     []string `json:"scopes,omitempty"` // Defaults to all scopes
 }
 
 // PairResponse is the response to a pair command
@@ -86,6 +258,67 @@ type PairResponse struct {
 	Token      string `json:"token"`
 	ClientID   string `json:"clientId"`
 	RequiresApproval bool `json:"requiresApproval"`
+	ExpiresAt  int64  `json:"expiresAt,omitempty"` // Unix ms, omitted if the token never expires
+}
+
+// ClientInfo describes a paired client
+type ClientInfo struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt int64    `json:"createdAt"`           // Unix ms
+	Status    string   `json:"status"`              // "approved" or "pending"
+	ExpiresAt int64    `json:"expiresAt,omitempty"` // Unix ms, omitted if the token never expires
+	Scopes    []string `json:"scopes"`
+	MaxVolume float64  `json:"maxVolume,omitempty"` // Loudest the client may set, omitted for no limit
+}
+
+// ClientRef identifies one connection of a paired client. A client may have
+// several connections open at once.
+type ClientRef struct {
+	ClientID     string `json:"clientId"`
+	Name         string `json:"name"`
+	ConnectionID uint64 `json:"connectionId"`
+}
+
+// ConnectedClient is an authenticated connection to the daemon
+type ConnectedClient struct {
+	ClientRef
+	ConnectedAt int64 `json:"connectedAt"` // Unix ms of the connection's first authenticated command
+	LastSeen    int64 `json:"lastSeen"`    // Unix ms of its latest command
+	Self        bool  `json:"self"`        // The connection that asked
+}
+
+// GetConnectedClientsResponse is the response to a getConnectedClients command
+type GetConnectedClientsResponse struct {
+	Connections []ConnectedClient `json:"connections"`
+}
+
+// ListClientsResponse is the response to a listClients command
+type ListClientsResponse struct {
+	Clients []ClientInfo `json:"clients"`
+}
+
+// ClientRequest is the data for approveClient and revokeClient commands
+type ClientRequest struct {
+	ClientID string `json:"clientId"`
+}
+
+// SetClientScopesRequest is the data for a setClientScopes command
+type SetClientScopesRequest struct {
+	ClientID string   `json:"clientId"`
+	Scopes   []string `json:"scopes"`
+}
+
+// SetClientMaxVolumeRequest is the data for a setClientMaxVolume command
+type SetClientMaxVolumeRequest struct {
+	ClientID  string  `json:"clientId"`
+	MaxVolume float64 `json:"maxVolume"` // 0.0 - 1.0, 0 to remove the limit
+}
+
+// RefreshTokenResponse is the response to a refreshToken command
+type RefreshTokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"` // Unix ms, omitted if the token never expires
 }
 
 // PlayRequest is the data for a play command
@@ -106,8 +339,14 @@ type TrackMetadata struct {
 // QueueRequest is the data for a queue command
 // QueueItem represents an item in the queue request
 type QueueItem struct {
+	ID       uint64         `json:"id,omitempty"` // Set by the daemon; ignored when queueing
 	Path     string         `json:"path"`
 	Metadata *TrackMetadata `json:"metadata,omitempty"`
+	AddedBy  string         `json:"addedBy,omitempty"` // Client ID; set by the daemon
+
+	// Recommendation says why continue mode picked the track; set by the
+	// daemon
+	Recommendation string `json:"recommendation,omitempty"`
 }
 
 type QueueRequest struct {
@@ -115,6 +354,15 @@ type QueueRequest struct {
 	Append bool        `json:"append"`
 }
 
+// SkipVotes is the response to voteSkip and the data of skipVotes pushes.
+// The current track is skipped once Votes reaches Needed.
+type SkipVotes struct {
+	Path    string `json:"path"`
+	Votes   int    `json:"votes"`
+	Needed  int    `json:"needed"`
+	Skipped bool   `json:"skipped"`
+}
+
 // SeekRequest is the data for a seek command
 type SeekRequest struct {
 	Position int64 `json:"position"` // milliseconds
@@ -125,15 +373,453 @@ type VolumeRequest struct {
 	Level float64 `json:"level"` // 0.0 - 1.0
 }
 
+// AdjustVolumeRequest is the data for an adjustVolume command
+type AdjustVolumeRequest struct {
+	DeltaPercent float64 `json:"deltaPercent"` // e.g. -10 for 10 points quieter
+}
+
+// Bookmark marks a moment in a track
+type Bookmark struct {
+	ID         int64  `json:"id"`
+	PositionMs int64  `json:"positionMs"`
+	Note       string `json:"note,omitempty"`
+	Created    int64  `json:"created"` // Unix ms
+}
+
+// BookmarkRequest is the data for the bookmark commands. addBookmark
+// defaults to the current track and position; removeBookmark and
+// jumpToBookmark need the path and ID.
+type BookmarkRequest struct {
+	Path       string `json:"path,omitempty"`
+	PositionMs *int64 `json:"positionMs,omitempty"` // addBookmark only
+	Note       string `json:"note,omitempty"`       // addBookmark only
+	ID         int64  `json:"id,omitempty"`
+}
+
+// AddBookmarkResponse is the response to addBookmark
+type AddBookmarkResponse struct {
+	Path     string   `json:"path"`
+	Bookmark Bookmark `json:"bookmark"`
+}
+
+// TrackBookmarks is a track's bookmarks, ordered by position
+type TrackBookmarks struct {
+	Path      string     `json:"path"`
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+// ListBookmarksRequest is the data for listBookmarks
+type ListBookmarksRequest struct {
+	Path string `json:"path,omitempty"` // Omit to list every bookmarked track
+}
+
+// ListBookmarksResponse is the response to listBookmarks and removeBookmark
+type ListBookmarksResponse struct {
+	Tracks []TrackBookmarks `json:"tracks"`
+}
+
+// TrackGainRequest is the data for getTrackGain and setTrackGain commands
+type TrackGainRequest struct {
+	Path   string  `json:"path"`
+	GainDb float64 `json:"gainDb"` // setTrackGain only; 0 clears the offset
+}
+
+// TrackGainResponse is the response to getTrackGain and setTrackGain
+type TrackGainResponse struct {
+	Path   string  `json:"path"`
+	GainDb float64 `json:"gainDb"`
+}
+
+// SetIntroSkipRequest is the data for a setIntroSkip command
+type SetIntroSkipRequest struct {
+	Path     string `json:"path,omitempty"`  // Defaults to the current track
+	Album    bool   `json:"album,omitempty"` // Set it for every track of the track's album
+	OffsetMs int64  `json:"offsetMs"`        // 0 clears it
+}
+
+// IntroSkipResponse is the response to setIntroSkip: how much of the track
+// is now skipped when it starts
+type IntroSkipResponse struct {
+	Path     string `json:"path"`
+	OffsetMs int64  `json:"offsetMs"`
+	Album    bool   `json:"album"` // The offset is set for the album rather than the track
+}
+
+// ZoneRequest is the data for enableZone and setZoneVolume commands
+type ZoneRequest struct {
+	Name    string  `json:"name"`
+	Enabled bool    `json:"enabled"` // enableZone only
+	Volume  float64 `json:"volume"`  // setZoneVolume only, 0.0 - 1.0
+}
+
+// DuckRequest is the data for a duck command
+type DuckRequest struct {
+	Level      *float64 `json:"level,omitempty"`      // 0.0 - 1.0, defaults to audio.duckLevel; 1 ends the duck
+	DurationMs int64    `json:"durationMs,omitempty"` // 0 holds it until ducked again with level 1
+}
+
+// AnnounceRequest is the data for an announce command, which ducks the
+// music while text is read out by the system's text to speech
+type AnnounceRequest struct {
+	Text  string   `json:"text"`
+	Level *float64 `json:"level,omitempty"` // Defaults to audio.duckLevel
+}
+
+// DuckResponse is the response to duck and announce: the share of the
+// volume playback is now ducked to
+type DuckResponse struct {
+	Level float64 `json:"level"` // 1 when nothing is ducking it
+}
+
+// StartFocusSessionRequest is the data for startFocusSession: play a
+// playlist for a set number of minutes, then pause
+type StartFocusSessionRequest struct {
+	Minutes        int      `json:"minutes"`                  // 1 to 720
+	Playlist       string   `json:"playlist,omitempty"`       // A daily mix name or a mood
+	Tracks         []string `json:"tracks,omitempty"`         // Paths to play instead, e.g. a playlist the client keeps
+	EndBehavior    string   `json:"endBehavior,omitempty"`    // "pause" (default), "stop" or "continue"
+	Normalize      bool     `json:"normalize,omitempty"`      // Level the volume for the session
+	DisableShuffle bool     `json:"disableShuffle,omitempty"` // Turn shuffle and repeat off for the session
+}
+
+// FocusSession is the response to startFocusSession, stopFocusSession and
+// getFocusSession, and the focusSessionStarted push
+type FocusSession struct {
+	Active      bool   `json:"active"`
+	Playlist    string `json:"playlist,omitempty"`
+	EndBehavior string `json:"endBehavior,omitempty"`
+	Normalize   bool   `json:"normalize"`
+	StartedAt   int64  `json:"startedAt,omitempty"` // Unix ms
+	EndsAt      int64  `json:"endsAt,omitempty"`    // Unix ms
+	RemainingMs int64  `json:"remainingMs"`
+}
+
+// Profile is a named set of playback settings from the profiles config.
+// Settings left out are not changed by switching to it.
+type Profile struct {
+	Name          string             `json:"name"`
+	Volume        *float64           `json:"volume,omitempty"`
+	EQ            map[string]float64 `json:"eq,omitempty"`            // Gains in dB for the "eq" DSP stage
+	ContinueMode  string             `json:"continueMode,omitempty"`  // "off", "similar" or "random"
+	Seed          string             `json:"seed,omitempty"`          // A daily mix or mood
+	SeedCommunity *int               `json:"seedCommunity,omitempty"` // A community, instead of seed
+	Start         string             `json:"start,omitempty"`         // "HH:MM" it is switched to each day
+}
+
+// ListProfilesResponse is the response to listProfiles and setProfile
+type ListProfilesResponse struct {
+	Profiles []Profile `json:"profiles"`
+	Active   string    `json:"active,omitempty"` // The profile last switched to
+}
+
+// SetProfileRequest is the data for setProfile
+type SetProfileRequest struct {
+	Name string `json:"name"`
+	Play bool   `json:"play,omitempty"` // Also replace the queue with the profile's seed and play it
+}
+
+// ProfileChangedPush is pushed when another profile is switched to
+type ProfileChangedPush struct {
+	Name      string `json:"name"`
+	Scheduled bool   `json:"scheduled"` // Switched to at its start time rather than by setProfile
+}
+
+// Schedule starts playback at a time of day, bringing the volume up from
+// silence over rampSeconds. It is the data for setSchedule, which adds a
+// schedule or, given an ID, changes one. Exactly one of playlist, tracks
+// and similarTo is set.
+type Schedule struct {
+	ID          int64    `json:"id,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Time        string   `json:"time"`                // Local "HH:MM"
+	Days        []string `json:"days,omitempty"`      // "mon" to "sun"; empty for every day
+	Playlist    string   `json:"playlist,omitempty"`  // A daily mix or mood
+	Tracks      []string `json:"tracks,omitempty"`    // Paths to play
+	SimilarTo   string   `json:"similarTo,omitempty"` // A track to start a radio of similar tracks from
+	Volume      float64  `json:"volume,omitempty"`    // Volume ramped up to (default: 1.0)
+	RampSeconds int      `json:"rampSeconds,omitempty"`
+	Enabled     *bool    `json:"enabled,omitempty"` // Default: true
+	LastRun     int64    `json:"lastRun,omitempty"` // Unix ms, set by the daemon
+	NextRun     int64    `json:"nextRun,omitempty"` // Unix ms, set by the daemon
+}
+
+// ListSchedulesResponse is the response to listSchedules, setSchedule and
+// deleteSchedule, and the schedulesChanged push
+type ListSchedulesResponse struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+// DeleteScheduleRequest is the data for deleteSchedule
+type DeleteScheduleRequest struct {
+	ID int64 `json:"id"`
+}
+
+// SyncData is a machine's ratings, play counts and bookmarks, as exportSync
+// returns them and importSync takes them. Tracks are keyed by a fingerprint
+// of the file's contents so the other machine finds its own copy wherever it
+// keeps it.
+type SyncData struct {
+	Version    int                  `json:"version"`
+	ExportedAt int64                `json:"exportedAt"` // Unix ms
+	Tracks     map[string]SyncTrack `json:"tracks"`
+}
+
+// SyncTrack is one track's data in SyncData
+type SyncTrack struct {
+	Path      string         `json:"path"` // Where the exporting machine keeps it, tried first
+	Rating    *SyncRating    `json:"rating,omitempty"`
+	PlayCount *SyncPlayCount `json:"playCount,omitempty"`
+	Bookmarks []Bookmark     `json:"bookmarks,omitempty"`
+}
+
+// SyncRating is a track's rating and when it last changed. Of two machines'
+// ratings the later one wins; a cleared rating is 0 stars, not a favorite.
+type SyncRating struct {
+	Stars    int   `json:"stars"`
+	Favorite bool  `json:"favorite"`
+	Updated  int64 `json:"updated"` // Unix ms
+}
+
+// SyncPlayCount is a track's play count. Of two machines' counts the one
+// played more recently wins.
+type SyncPlayCount struct {
+	Count      int   `json:"count"`
+	LastPlayed int64 `json:"lastPlayed"` // Unix ms
+}
+
+// ImportSyncResponse is the response to importSync and the syncImported
+// push: how many of each kind were taken, and how many tracks weren't found
+// in this machine's library
+type ImportSyncResponse struct {
+	Ratings    int `json:"ratings"`
+	PlayCounts int `json:"playCounts"`
+	Bookmarks  int `json:"bookmarks"`
+	Unmatched  int `json:"unmatched"`
+}
+
+// InterpretRequest is the data for the interpret command
+type InterpretRequest struct {
+	Text string `json:"text"` // e.g. "pause", "play something like Tycho but calmer"
+}
+
+// InterpretResponse is what interpret made of the text and did about it
+type InterpretResponse struct {
+	// Action is one of play, playSimilar, pause, resume, stop, next,
+	// previous, volume or shuffle
+	Action      string   `json:"action"`
+	Description string   `json:"description"` // e.g. "Playing 50 chill tracks"
+	Query       string   `json:"query,omitempty"`
+	Mood        string   `json:"mood,omitempty"`
+	Adjustments []string `json:"adjustments,omitempty"` // e.g. "less energy"
+	Tracks      int      `json:"tracks,omitempty"`      // How many tracks were queued
+}
+
+// FocusSessionEndedPush is pushed when a focus session runs out or is
+// stopped. Shuffle, repeat and volume levelling are back as they were.
+type FocusSessionEndedPush struct {
+	FocusSession
+	Completed bool `json:"completed"` // False if it was stopped early
+}
+
+// Zone is an output that plays alongside the others. "local" is the default
+// device; the rest are configured under audio.zones.
+type Zone struct {
+	Name    string  `json:"name"`
+	Local   bool    `json:"local"`
+	Enabled bool    `json:"enabled"`
+	Volume  float64 `json:"volume"`
+	Error   string  `json:"error,omitempty"` // Why the zone stopped, if it failed
+}
+
+// ListZonesResponse is the response to listZones, enableZone and setZoneVolume
+type ListZonesResponse struct {
+	Zones []Zone `json:"zones"`
+}
+
+// DSPStage is a stage of the DSP chain
+type DSPStage struct {
+	Name    string             `json:"name"`
+	Enabled bool               `json:"enabled"`
+	Params  map[string]float64 `json:"params,omitempty"` // Unset ones take the stage's defaults
+}
+
+// DSPStageType is a stage that can be put in the DSP chain
+type DSPStageType struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Params      []string `json:"params"`
+}
+
+// SetDSPChainRequest is the data for a setDSPChain command
+type SetDSPChainRequest struct {
+	Stages []DSPStage `json:"stages"` // In the order audio passes through them
+}
+
+// DSPChainResponse is the response to getDSPChain and setDSPChain, and the
+// data of a dspChainChanged push
+type DSPChainResponse struct {
+	Stages    []DSPStage     `json:"stages"`
+	Available []DSPStageType `json:"available"`
+}
+
+// ListRenderersRequest is the data for a listRenderers command
+type ListRenderersRequest struct {
+	Refresh bool `json:"refresh,omitempty"` // Search the LAN again instead of using the last results
+}
+
+// Renderer is a device playback can be sent to
+type Renderer struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Kind    string `json:"kind"` // "local", "chromecast" or "upnp"
+	Address string `json:"address,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Active  bool   `json:"active"`
+}
+
+// ListRenderersResponse is the response to a listRenderers command
+type ListRenderersResponse struct {
+	Renderers []Renderer `json:"renderers"`
+}
+
+// Station is a saved internet radio station. Play one by passing its URL as
+// the path of a play command.
+type Station struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// StationRequest is the data for saveStation and removeStation; removeStation
+// only needs the name
+type StationRequest struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+// ListStationsResponse is the response to listStations, saveStation and
+// removeStation
+type ListStationsResponse struct {
+	Stations []Station `json:"stations"`
+}
+
+// Podcast is a subscribed podcast feed
+type Podcast struct {
+	FeedURL     string `json:"feedUrl"`
+	Title       string `json:"title"`
+	Author      string `json:"author,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+	Refreshed   int64  `json:"refreshed"`       // Unix ms of the last successful refresh
+	Error       string `json:"error,omitempty"` // Why the last refresh failed
+}
+
+// PodcastEpisode is one episode of a podcast. Play it by passing Path as the
+// path of a play or queue command with Duration in its metadata, so it can be
+// seeked and resumed like a file.
+type PodcastEpisode struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Published   int64  `json:"published,omitempty"` // Unix ms
+	Duration    int64  `json:"duration"`            // milliseconds, 0 if unknown
+	Path        string `json:"path"`                // Downloaded file, or the audio URL
+	AudioURL    string `json:"audioUrl"`
+	Downloaded  bool   `json:"downloaded"`
+	Position    int64  `json:"position"` // milliseconds
+	Played      bool   `json:"played"`
+}
+
+// PodcastRequest is the data for podcastSubscribe, podcastUnsubscribe and
+// podcastGetEpisodes
+type PodcastRequest struct {
+	FeedURL string `json:"feedUrl"`
+}
+
+// PodcastEpisodeRequest is the data for podcastMarkPlayed and podcastDownload
+type PodcastEpisodeRequest struct {
+	FeedURL   string `json:"feedUrl"`
+	EpisodeID string `json:"episodeId"`
+	Played    *bool  `json:"played,omitempty"` // podcastMarkPlayed only (default: true)
+}
+
+// PodcastListResponse is the response to podcastList and podcastUnsubscribe
+type PodcastListResponse struct {
+	Podcasts []Podcast `json:"podcasts"`
+}
+
+// PodcastEpisodesResponse is the response to podcastSubscribe,
+// podcastGetEpisodes and podcastMarkPlayed
+type PodcastEpisodesResponse struct {
+	Podcast  Podcast          `json:"podcast"`
+	Episodes []PodcastEpisode `json:"episodes"` // Newest first
+}
+
+// PodcastDownloadedPush is pushed when a podcastDownload finishes
+type PodcastDownloadedPush struct {
+	FeedURL   string `json:"feedUrl"`
+	EpisodeID string `json:"episodeId"`
+	Path      string `json:"path,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SetRendererRequest is the data for a setRenderer command
+type SetRendererRequest struct {
+	ID string `json:"id"` // A renderer id from listRenderers, or "local"
+}
+
 // ConfigRequest is the data for a setConfig command
 type ConfigRequest struct {
 	LibraryPaths     *[]string `json:"libraryPaths,omitempty"`
 	SampleRate       *int      `json:"sampleRate,omitempty"`
 	BufferSizeMs     *int      `json:"bufferSizeMs,omitempty"`
+	BitDepth         *int      `json:"bitDepth,omitempty"`  // 16 or 24
+	Resampler        *string   `json:"resampler,omitempty"` // "fast", "standard", "high" or "soxr"
 	DefaultVolume    *float64  `json:"defaultVolume,omitempty"`
+	VolumeCurve      *string   `json:"volumeCurve,omitempty"` // "linear" or "logarithmic"
+	FadeMs           *int      `json:"fadeMs,omitempty"`
+	Mono             *bool     `json:"mono,omitempty"`
+	Balance          *float64  `json:"balance,omitempty"` // -1.0 (left only) to 1.0 (right only)
+	SwapChannels     *bool     `json:"swapChannels,omitempty"`
+	LevelVolume      *bool     `json:"levelVolume,omitempty"`
+	TargetLufs       *float64  `json:"targetLufs,omitempty"`
+	DuckLevel        *float64  `json:"duckLevel,omitempty"`
+	AutoDuck         *bool     `json:"autoDuck,omitempty"`
+	PreviewVolume    *float64  `json:"previewVolume,omitempty"`
+
+	PauseOnDeviceLoss    *bool `json:"pauseOnDeviceLoss,omitempty"`
+	ResumeOnDeviceReturn *bool `json:"resumeOnDeviceReturn,omitempty"`
+
 	ResumeOnStart    *bool     `json:"resumeOnStart,omitempty"`
 	RememberQueue    *bool     `json:"rememberQueue,omitempty"`
 	RememberPosition *bool     `json:"rememberPosition,omitempty"`
+
+	ResumeThresholdMinutes *int    `json:"resumeThresholdMinutes,omitempty"`
+	ResumePlayback         *string `json:"resumePlayback,omitempty"` // "paused" or "playing"
+	LogLevel               *string `json:"logLevel,omitempty"`       // "debug", "info", "warn" or "error"
+	ScanWorkers            *int    `json:"scanWorkers,omitempty"`    // 0 for one per CPU
+	ScanNiceLevel          *int    `json:"scanNiceLevel,omitempty"`  // 0 (normal) to 19 (lowest)
+	ScanProbeTimeoutMs     *int    `json:"scanProbeTimeoutMs,omitempty"`
+	TrimSilence            *bool   `json:"trimSilence,omitempty"`
+	SilenceThresholdDb     *int    `json:"silenceThresholdDb,omitempty"`
+	TrackEndingSeconds     *int    `json:"trackEndingSeconds,omitempty"` // 0 to disable trackEnding
+	NotificationsEnabled   *bool   `json:"notificationsEnabled,omitempty"`
+	IdleTimeoutMinutes     *int    `json:"idleTimeoutMinutes,omitempty"` // 0 to keep running
+	OnPlaybackError        *string `json:"onPlaybackError,omitempty"`    // "skip", "retry" or "stop"
+	DiscoveryShuffle       *bool   `json:"discoveryShuffle,omitempty"`
+	VoteSkipPercent        *int    `json:"voteSkipPercent,omitempty"`    // 1 to 100
+	FairQueue              *bool   `json:"fairQueue,omitempty"`
+
+	// Replaces the scan options of every library path; paths left out are
+	// scanned in full
+	LibraryScan *map[string]LibraryScanOptions `json:"libraryScan,omitempty"`
+}
+
+// LibraryScanOptions narrows what a scan of one library path picks up
+type LibraryScanOptions struct {
+	Exclude        []string `json:"exclude,omitempty"`        // Globs relative to the library path, e.g. "**/Audiobooks/**"
+	MinDurationMs  int64    `json:"minDurationMs,omitempty"`  // Skip shorter tracks
+	FollowSymlinks bool     `json:"followSymlinks,omitempty"` // Descend into symlinked folders
+	MaxDepth       int      `json:"maxDepth,omitempty"`       // Folder levels to scan, 1 for only the top level; 0 for no limit
 }
 
 // ConfigResponse is the response to a getConfig command
@@ -142,18 +828,156 @@ type ConfigResponse struct {
 	LibraryPaths     []string `json:"libraryPaths"`
 	SampleRate       int      `json:"sampleRate"`
 	BufferSizeMs     int      `json:"bufferSizeMs"`
+	BitDepth         int      `json:"bitDepth"`
+	Resampler        string   `json:"resampler"`
 	DefaultVolume    float64  `json:"defaultVolume"`
+	VolumeCurve      string   `json:"volumeCurve"`
+	FadeMs           int      `json:"fadeMs"`
+	Mono             bool     `json:"mono"`
+	Balance          float64  `json:"balance"`
+	SwapChannels     bool     `json:"swapChannels"`
+	LevelVolume      bool     `json:"levelVolume"`
+	TargetLufs       float64  `json:"targetLufs"`
+	DuckLevel        float64  `json:"duckLevel"`
+	AutoDuck         bool     `json:"autoDuck"`
+	PreviewVolume    float64  `json:"previewVolume"`
+
+	PauseOnDeviceLoss    bool `json:"pauseOnDeviceLoss"`
+	ResumeOnDeviceReturn bool `json:"resumeOnDeviceReturn"`
+
 	ResumeOnStart    bool     `json:"resumeOnStart"`
 	RememberQueue    bool     `json:"rememberQueue"`
 	RememberPosition bool     `json:"rememberPosition"`
+
+	ResumeThresholdMinutes int    `json:"resumeThresholdMinutes"`
+	ResumePlayback         string `json:"resumePlayback"`
+	LogLevel               string `json:"logLevel"`
+	ScanWorkers            int    `json:"scanWorkers"`
+	ScanNiceLevel          int    `json:"scanNiceLevel"`
+	ScanProbeTimeoutMs     int    `json:"scanProbeTimeoutMs"`
+	TrimSilence            bool   `json:"trimSilence"`
+	SilenceThresholdDb     int    `json:"silenceThresholdDb"`
+	TrackEndingSeconds     int    `json:"trackEndingSeconds"`
+	NotificationsEnabled   bool   `json:"notificationsEnabled"`
+	IdleTimeoutMinutes     int    `json:"idleTimeoutMinutes"`
+	OnPlaybackError        string `json:"onPlaybackError"`
+	DiscoveryShuffle       bool   `json:"discoveryShuffle"`
+	VoteSkipPercent        int    `json:"voteSkipPercent"`
+	FairQueue              bool   `json:"fairQueue"`
+
+	LibraryScan map[string]LibraryScanOptions `json:"libraryScan"`
+
+	// The format the output device is running at. Changes to sampleRate and
+	// bitDepth show up here after a restart.
+	Output OutputFormat `json:"output"`
+}
+
+// OutputFormat is the format audio is sent to the output device in
+type OutputFormat struct {
+	SampleRate int    `json:"sampleRate"`
+	Channels   int    `json:"channels"`
+	BitDepth   int    `json:"bitDepth"`
+	Resampler  string `json:"resampler"`
+}
+
+// LogsRequest is the data for getLogs and subscribeLogs commands
+type LogsRequest struct {
+	Limit int    `json:"limit,omitempty"` // getLogs only; 0 returns everything kept in memory
+	Level string `json:"level,omitempty"` // Minimum level, defaults to "debug" (everything)
+}
+
+// LogEntry is a single daemon log record. Subscribers receive these as
+// "log" push messages.
+type LogEntry struct {
+	Time      int64                  `json:"time"` // Unix ms
+	Level     string                 `json:"level"`
+	Component string                 `json:"component,omitempty"`
+	Message   string                 `json:"msg"`
+	Attrs     map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// GetLogsResponse is the response to a getLogs command
+type GetLogsResponse struct {
+	Entries []LogEntry `json:"entries"`
+}
+
+// GetMetricsResponse is the response to a getMetrics command
+type GetMetricsResponse struct {
+	Status        string                 `json:"status"` // "ok"
+	UptimeSeconds float64                `json:"uptimeSeconds"`
+	PlayerState   string                 `json:"playerState"`
+	Clients       int                    `json:"clients"` // Open IPC connections
+	Metrics       map[string]interface{} `json:"metrics"` // Metric name -> value
+}
+
+// GetMemoryStatsResponse is the response to a getMemoryStats command
+type GetMemoryStatsResponse struct {
+	HeapBytes   uint64 `json:"heapBytes"`   // Allocated heap objects, including those not yet collected
+	SysBytes    uint64 `json:"sysBytes"`    // Memory obtained from the OS
+	BudgetBytes int64  `json:"budgetBytes"` // Soft limit set by memory.budgetMb, 0 for none
+	GCCycles    uint32 `json:"gcCycles"`
+	Goroutines  int    `json:"goroutines"`
+
+	LibraryTracks  int `json:"libraryTracks"`  // Tracks in the search index
+	AnalyzedTracks int `json:"analyzedTracks"` // Tracks with audio features in memory
+	QueueItems     int `json:"queueItems"`
+
+	SimilarCache CacheStats `json:"similarCache"` // Similar track lists read from disk
+}
+
+// DumpStateResponse is the response to a dumpState command: a snapshot of
+// the daemon to attach to bug reports, without credentials or tokens.
+// Starting musicd with --load-state restores the queue, playback and config
+// from one.
+type DumpStateResponse struct {
+	TakenAt  int64                  `json:"takenAt"`  // Unix ms
+	Platform string                 `json:"platform"` // GOOS/GOARCH
+	Status   StatusResponse         `json:"status"`
+	Queue    queue.PersistentState  `json:"queue"` // Including the position in the current track
+	Config   *config.Config         `json:"config"`
+	Clients  []ClientInfo           `json:"clients"`
+	Scan     ScanStatusResponse     `json:"scan"` // Without results
+	Analysis AnalysisStatusResponse `json:"analysis"`
+	Errors   []LogEntry             `json:"errors"` // Recent warnings and errors, oldest first
+}
+
+// AdvanceClockRequest is the data for an advanceClock command
+type AdvanceClockRequest struct {
+	Ms int64 `json:"ms"` // How much playback time passes
+}
+
+// AdvanceClockResponse is the response to an advanceClock command. What
+// the time passing set off, like a track ending, may land just after it.
+type AdvanceClockResponse struct {
+	Now int64 `json:"now"` // Simulated time, Unix ms
+}
+
+// CacheStats describes an in-memory cache of data read from disk
+type CacheStats struct {
+	Entries  int    `json:"entries"`
+	Bytes    int64  `json:"bytes"`
+	MaxBytes int64  `json:"maxBytes"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
 }
 
 // ScanFileMetadata contains extracted metadata for a scanned file
 type ScanFileMetadata struct {
 	Title    string `json:"title,omitempty"`
 	Artist   string `json:"artist,omitempty"`
-	Album    string `json:"album,omitempty"`
-	Duration int64  `json:"duration,omitempty"` // milliseconds
+	Album       string `json:"album,omitempty"`
+	AlbumArtist string `json:"albumArtist,omitempty"`
+	Composer    string `json:"composer,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+	Year        int    `json:"year,omitempty"`
+	TrackNumber int    `json:"trackNumber,omitempty"`
+	DiscNumber  int    `json:"discNumber,omitempty"`
+	Duration    int64  `json:"duration,omitempty"` // milliseconds
+	Bitrate     int64  `json:"bitrate,omitempty"`  // bits per second
+
+	Work           string `json:"work,omitempty"`
+	Movement       string `json:"movement,omitempty"`       // Movement name
+	MovementNumber int    `json:"movementNumber,omitempty"` // Position in the work
 }
 
 // ScanFileInfo represents a scanned audio file
@@ -162,6 +986,28 @@ type ScanFileInfo struct {
 	Size       int64             `json:"size"`
 	ModifiedAt int64             `json:"modifiedAt"`
 	Metadata   *ScanFileMetadata `json:"metadata,omitempty"`
+	Cue        *CueTrack         `json:"cue,omitempty"` // Set for tracks of a CUE sheet
+}
+
+// CueTrack places a track of a CUE sheet within the album image it plays
+// from. Its path is the sheet's path followed by "#" and the track number.
+type CueTrack struct {
+	Sheet string `json:"sheet"`
+	Image string `json:"image"`
+	Start int64  `json:"start"`         // milliseconds into Image
+	End   int64  `json:"end,omitempty"` // milliseconds into Image, 0 for the end of the file
+}
+
+// ScanResultsPush is the data of a "scanResults" push, sent to clients
+// subscribed with subscribeScanResults as a scan finds files. The counters
+// cover the whole scan so far.
+type ScanResultsPush struct {
+	LibraryPath string         `json:"libraryPath"`
+	Files       []ScanFileInfo `json:"files"`
+	Discovered  int            `json:"discovered"` // Audio files found in the library paths walked so far
+	Processed   int            `json:"processed"`  // Files probed so far
+	Unreadable  int            `json:"unreadable"`
+	Done        bool           `json:"done"` // Set on a last push with no files once the scan is complete
 }
 
 // ScanResult is the result from scanning a library path
@@ -222,24 +1068,41 @@ type AlbumNFO struct {
 
 // StatusResponse is the response to a status command
 type StatusResponse struct {
-	State      string         `json:"state"`
-	Path       string         `json:"path,omitempty"`
-	Position   int64          `json:"position"`
-	Duration   int64          `json:"duration"`
-	Volume     float64        `json:"volume"`
-	Metadata   *TrackMetadata `json:"metadata,omitempty"`
-	QueueIndex int            `json:"queueIndex"`
-	QueueSize  int            `json:"queueSize"`
-	RepeatMode string         `json:"repeatMode"` // "off", "one", "all"
-	Shuffle    bool           `json:"shuffle"`
+	State       string         `json:"state"`
+	Path        string         `json:"path,omitempty"`
+	Position    int64          `json:"position"`
+	Duration    int64          `json:"duration"`
+	Volume      float64        `json:"volume"`
+	Metadata    *TrackMetadata `json:"metadata,omitempty"`
+	QueueIndex  int            `json:"queueIndex"`
+	QueueSize   int            `json:"queueSize"`
+	RepeatMode  string         `json:"repeatMode"` // "off", "one", "all"
+	Shuffle     bool           `json:"shuffle"`
+	ShuffleMode string         `json:"shuffleMode"` // "off", "uniform", "smart", "album", "artist"
+	Revision    uint64         `json:"revision"`    // Changes whenever anything but the position does
+	Renderer    string         `json:"renderer"`    // Device playing the audio, "local" for this computer
+
+	// Internet streams only
+	Buffering   bool   `json:"buffering,omitempty"`   // Waiting for audio before playing
+	StreamTitle string `json:"streamTitle,omitempty"` // Now playing, as sent by the station
+}
+
+// StatusSinceRequest is the data for a statusSince command
+type StatusSinceRequest struct {
+	Revision  uint64 `json:"revision"`            // Revision the client already has
+	TimeoutMs int    `json:"timeoutMs,omitempty"` // How long to wait for a change (default 25s, max 60s)
 }
 
 // GetQueueResponse is the response to a getQueue command
 type GetQueueResponse struct {
-	Items      []QueueItem `json:"items"`
-	Index      int         `json:"index"`
-	RepeatMode string      `json:"repeatMode"`
-	Shuffle    bool        `json:"shuffle"`
+	Items       []QueueItem `json:"items"`
+	Index       int         `json:"index"`
+	Version     uint64      `json:"version"` // Pass as ifVersion to edit only this state of the queue
+	RepeatMode  string      `json:"repeatMode"`
+	Shuffle     bool        `json:"shuffle"`
+	ShuffleMode string      `json:"shuffleMode"`
+	CanUndo     bool        `json:"canUndo"`
+	CanRedo     bool        `json:"canRedo"`
 }
 
 // SetRepeatRequest is the data for a setRepeat command
@@ -249,29 +1112,56 @@ type SetRepeatRequest struct {
 
 // SetShuffleRequest is the data for a setShuffle command
 type SetShuffleRequest struct {
-	Enabled bool `json:"enabled"`
+	Enabled bool   `json:"enabled"`
+	Mode    string `json:"mode,omitempty"` // "off", "uniform", "smart", "album", "artist"; overrides enabled
 }
 
-// QueueJumpRequest is the data for a queueJump command
+// QueueJumpRequest is the data for a queueJump command. ID, when set, is
+// used instead of Index.
 type QueueJumpRequest struct {
-	Index int `json:"index"`
+	Index int    `json:"index"`
+	ID    uint64 `json:"id,omitempty"`
 }
 
-// QueueRemoveRequest is the data for a queueRemove command
+// PlayPathRequest is the data for a playPath command, which queues the
+// tracks of a folder in album order
+type PlayPathRequest struct {
+	Path      string `json:"path"`
+	Recursive bool   `json:"recursive,omitempty"` // Include subfolders
+	Append    bool   `json:"append,omitempty"`    // Add to the queue instead of replacing it and playing
+}
+
+// QueueRemoveRequest is the data for a queueRemove command. ID, when set, is
+// used instead of Index.
 type QueueRemoveRequest struct {
-	Index int `json:"index"`
+	Index int    `json:"index"`
+	ID    uint64 `json:"id,omitempty"`
 }
 
-// QueueMoveRequest is the data for a queueMove command
+// QueueMoveRequest is the data for a queueMove command. With IDs, the item ID
+// moves to where the item ToID is now.
 type QueueMoveRequest struct {
-	FromIndex int `json:"fromIndex"`
-	ToIndex   int `json:"toIndex"`
+	FromIndex int    `json:"fromIndex"`
+	ToIndex   int    `json:"toIndex"`
+	ID        uint64 `json:"id,omitempty"`
+	ToID      uint64 `json:"toId,omitempty"`
+}
+
+// QueueRemoveRangeRequest is the data for a queueRemoveRange command
+type QueueRemoveRangeRequest struct {
+	Start int `json:"start"` // inclusive
+	End   int `json:"end"`   // exclusive
+}
+
+// QueueRemoveByPathsRequest is the data for a queueRemoveByPaths command
+type QueueRemoveByPathsRequest struct {
+	Paths []string `json:"paths"`
 }
 
 // AudioDataResponse contains real-time frequency data for visualization
 type AudioDataResponse struct {
 	// Bands contains frequency band magnitudes (0-255), similar to Web Audio API
-	// 128 bands, logarithmically distributed from 20Hz to 20kHz
+	// 128 bands by default (see configureAudioData), logarithmically distributed from 20Hz to 20kHz
 	// Note: Using []int instead of []uint8 because Go's json package base64-encodes []byte/[]uint8
 	Bands []int `json:"bands"`
 	// Position is the playback position in milliseconds when these samples were analyzed
@@ -281,6 +1171,28 @@ type AudioDataResponse struct {
 	Timestamp int64 `json:"timestamp"`
 }
 
+// AudioDataSettingsRequest is the optional data for subscribeAudioData and the
+// data for configureAudioData. Omitted fields keep their current value.
+type AudioDataSettingsRequest struct {
+	Bands     *int     `json:"bands,omitempty"`     // 1-256, default 128
+	Smoothing *float64 `json:"smoothing,omitempty"` // 0 to <1, default 0.5
+	MinDb     *float64 `json:"minDb,omitempty"`     // default -60
+	MaxDb     *float64 `json:"maxDb,omitempty"`     // default 0
+	FPS       *int     `json:"fps,omitempty"`       // 1-60, 0 for every FFT frame (~21/s)
+	Format    *string  `json:"format,omitempty"`    // "json" (default) or "binary", see frames.go
+}
+
+// AudioDataSettings describes a subscriber's visualizer output
+type AudioDataSettings struct {
+	Subscribed bool    `json:"subscribed"`
+	Bands      int     `json:"bands"`
+	Smoothing  float64 `json:"smoothing"`
+	MinDb      float64 `json:"minDb"`
+	MaxDb      float64 `json:"maxDb"`
+	FPS        int     `json:"fps"`
+	Format     string  `json:"format"`
+}
+
 // AnalysisStatusResponse is the response to getAnalysisStatus command
 type AnalysisStatusResponse struct {
 	Status       string `json:"status"` // "idle", "running", "paused", "complete"
@@ -292,6 +1204,25 @@ type AnalysisStatusResponse struct {
 	Message      string `json:"message"`
 }
 
+// AnalysisCoverageResponse is the response to getAnalysisCoverage command
+type AnalysisCoverageResponse struct {
+	LibraryTracks int                    `json:"libraryTracks"`
+	Analyzed      int                    `json:"analyzed"` // Tracks with stored features
+	UpToDate      int                    `json:"upToDate"` // Tracks with every group at its current version
+	Versions      map[int]int            `json:"versions"` // Feature version -> track count
+	Groups        []FeatureGroupCoverage `json:"groups"`
+}
+
+// FeatureGroupCoverage reports how many tracks have a feature group at each
+// version
+type FeatureGroupCoverage struct {
+	Name     string      `json:"name"`
+	Version  int         `json:"version"` // Current version
+	UpToDate int         `json:"upToDate"`
+	Stale    int         `json:"stale"`
+	Versions map[int]int `json:"versions"` // Stored version -> track count
+}
+
 // GetSimilarTracksRequest is the request for getSimilarTracks command
 type GetSimilarTracksRequest struct {
 	TrackPath string `json:"trackPath"`
@@ -344,6 +1275,514 @@ type GetBridgeTracksResponse struct {
 	Tracks []string `json:"tracks"`
 }
 
+// LibrarySearchRequest is the request for librarySearch command
+type LibrarySearchRequest struct {
+	Query string `json:"query"` // Free text plus artist:, album:, genre:, title: and year: filters
+	Limit int    `json:"limit,omitempty"`
+}
+
+// LibraryTrack is an indexed library track
+type LibraryTrack struct {
+	Path        string    `json:"path"`
+	Title       string    `json:"title"`
+	Artist      string    `json:"artist,omitempty"`
+	Album       string    `json:"album,omitempty"`
+	AlbumArtist string    `json:"albumArtist,omitempty"`
+	Composer    string    `json:"composer,omitempty"`
+	Genre       string    `json:"genre,omitempty"`
+	Year        int       `json:"year,omitempty"`
+	TrackNumber int       `json:"trackNumber,omitempty"`
+	DiscNumber  int       `json:"discNumber,omitempty"`
+	Duration    int64     `json:"duration,omitempty"` // milliseconds
+	Size        int64     `json:"size,omitempty"`     // bytes
+	Bitrate     int64     `json:"bitrate,omitempty"`  // bits per second
+	Rating      int       `json:"rating,omitempty"`   // 1-5 stars, 0 if unrated
+	Favorite    bool      `json:"favorite,omitempty"`
+	Cue         *CueTrack `json:"cue,omitempty"` // Set for tracks of a CUE sheet
+
+	Work           string `json:"work,omitempty"`
+	Movement       string `json:"movement,omitempty"`       // Movement name
+	MovementNumber int    `json:"movementNumber,omitempty"` // Position in the work
+}
+
+// SetRatingRequest is the data for a setRating command
+type SetRatingRequest struct {
+	Path   string `json:"path,omitempty"` // Default: the current track
+	Rating int    `json:"rating"`         // 0-5 stars; 0 clears the rating
+}
+
+// ToggleFavoriteRequest is the data for a toggleFavorite command
+type ToggleFavoriteRequest struct {
+	Path     string `json:"path,omitempty"`     // Default: the current track
+	Favorite *bool  `json:"favorite,omitempty"` // Set rather than toggle
+}
+
+// TrackRatingResponse is the response to setRating and toggleFavorite, and
+// is pushed to every client as ratingChanged
+type TrackRatingResponse struct {
+	Path     string `json:"path"`
+	Rating   int    `json:"rating"`
+	Favorite bool   `json:"favorite"`
+}
+
+// LibrarySearchResult is a track matching a search
+type LibrarySearchResult struct {
+	LibraryTrack
+	Score float64 `json:"score"`
+}
+
+// LibrarySearchResponse is the response to librarySearch command
+type LibrarySearchResponse struct {
+	Results []LibrarySearchResult `json:"results"`
+	Total   int                   `json:"total"`   // Matches before the limit was applied
+	Indexed int                   `json:"indexed"` // Tracks in the index; 0 until a scan completes
+}
+
+// LibraryGenre is a genre and its track count
+type LibraryGenre struct {
+	Genre string `json:"genre"`
+	Count int    `json:"count"`
+}
+
+// LibraryGetGenresResponse is the response to libraryGetGenres command
+type LibraryGetGenresResponse struct {
+	Genres []LibraryGenre `json:"genres"`
+}
+
+// LibraryYear is a year, or the first year of a decade, and its track count
+type LibraryYear struct {
+	Year  int `json:"year"`
+	Count int `json:"count"`
+}
+
+// LibraryGetYearsResponse is the response to libraryGetYears command
+type LibraryGetYearsResponse struct {
+	Years   []LibraryYear `json:"years"`
+	Decades []LibraryYear `json:"decades"`
+}
+
+// LibraryGetTracksRequest is the request for libraryGetTracks command.
+// Every facet given must match; text facets ignore case and accents.
+type LibraryGetTracksRequest struct {
+	Genre       string `json:"genre,omitempty"`
+	Year        int    `json:"year,omitempty"`
+	Decade      int    `json:"decade,omitempty"` // First year of the decade, e.g. 1990
+	Artist      string `json:"artist,omitempty"`
+	AlbumArtist string `json:"albumArtist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	Offset      int    `json:"offset,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+}
+
+// LibraryGetTracksResponse is the response to libraryGetTracks command
+type LibraryGetTracksResponse struct {
+	Tracks []LibraryTrack `json:"tracks"`
+	Total  int            `json:"total"` // Matches before offset and limit were applied
+}
+
+// LibraryComposer is a composer with the number of their works and tracks
+type LibraryComposer struct {
+	Composer string `json:"composer"`
+	Works    int    `json:"works"`
+	Tracks   int    `json:"tracks"`
+}
+
+// LibraryGetComposersResponse is the response to libraryGetComposers command
+type LibraryGetComposersResponse struct {
+	Composers []LibraryComposer `json:"composers"`
+}
+
+// LibraryGetWorksRequest is the request for libraryGetWorks command
+type LibraryGetWorksRequest struct {
+	Composer string `json:"composer"`
+}
+
+// LibraryWork is a work with its track count and the number of albums, each
+// usually one recording, its tracks come from
+type LibraryWork struct {
+	Work       string `json:"work"`
+	Tracks     int    `json:"tracks"`
+	Recordings int    `json:"recordings"`
+}
+
+// LibraryGetWorksResponse is the response to libraryGetWorks command. Works
+// are sorted by title with numbers in numeric order.
+type LibraryGetWorksResponse struct {
+	Works      []LibraryWork `json:"works"`
+	Standalone int           `json:"standalone"` // The composer's tracks that aren't part of a work
+}
+
+// LibraryGetMovementsRequest is the request for libraryGetMovements command.
+// An empty work selects the composer's tracks that aren't part of one.
+type LibraryGetMovementsRequest struct {
+	Composer string `json:"composer"`
+	Work     string `json:"work,omitempty"`
+}
+
+// LibraryGetMovementsResponse is the response to libraryGetMovements command.
+// Tracks are grouped by album, each recording in movement order.
+type LibraryGetMovementsResponse struct {
+	Tracks []LibraryTrack `json:"tracks"`
+}
+
+// FindDuplicatesRequest is the request for findDuplicates command
+type FindDuplicatesRequest struct {
+	ToleranceMs int64 `json:"toleranceMs,omitempty"` // Maximum duration difference; 0 for the default (2000)
+}
+
+// DuplicateCluster is a set of files that appear to be the same recording
+type DuplicateCluster struct {
+	Tracks []LibraryTrack `json:"tracks"` // Highest bitrate, then largest, first
+}
+
+// FindDuplicatesResponse is the response to findDuplicates command
+type FindDuplicatesResponse struct {
+	Clusters       []DuplicateCluster `json:"clusters"`
+	DuplicateFiles int                `json:"duplicateFiles"` // Copies beyond the first in each cluster
+	DuplicateBytes int64              `json:"duplicateBytes"` // Size of those copies
+}
+
+// LibraryFormatStats totals the tracks of one file format
+type LibraryFormatStats struct {
+	Format   string `json:"format"` // Extension, e.g. "flac"
+	Count    int    `json:"count"`
+	Size     int64  `json:"size"`     // bytes
+	Duration int64  `json:"duration"` // milliseconds
+}
+
+// LibraryBitrateBand counts tracks with a bitrate above MinKbps and up to
+// MaxKbps
+type LibraryBitrateBand struct {
+	MinKbps int64 `json:"minKbps"`
+	MaxKbps int64 `json:"maxKbps,omitempty"` // Omitted for the top band
+	Count   int   `json:"count"`
+}
+
+// UnreadableFile is a file the last scan could not read
+type UnreadableFile struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// QuarantinedFile is a file set aside because it failed to probe or decode.
+// Auto-advance skips quarantined tracks.
+type QuarantinedFile struct {
+	Path   string `json:"path"`
+	Error  string `json:"error"`
+	Source string `json:"source"` // "scan" or "playback"
+	At     int64  `json:"at"`     // Unix milliseconds of the latest failure
+}
+
+// GetQuarantineResponse is the response to getQuarantine command
+type GetQuarantineResponse struct {
+	Files []QuarantinedFile `json:"files"` // Most recent failure first
+}
+
+// RetryQuarantinedRequest is the request for retryQuarantined command
+type RetryQuarantinedRequest struct {
+	Paths []string `json:"paths,omitempty"` // Files to retry; all quarantined files if empty
+}
+
+// RetryQuarantinedResponse is the response to retryQuarantined command.
+// Files that probe cleanly now leave quarantine.
+type RetryQuarantinedResponse struct {
+	Released     []string          `json:"released"`
+	StillFailing []QuarantinedFile `json:"stillFailing"`
+}
+
+// TrackQuarantinedPush is sent when playback sets a file aside
+type TrackQuarantinedPush struct {
+	QuarantinedFile
+}
+
+// PlaybackErrorPush is sent when a track fails to start, or fails to decode
+// part way through and can't be recovered by restarting the decoder. Playback
+// moves on to the next track when it was advancing through the queue.
+type PlaybackErrorPush struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+	Code  string `json:"code"` // One of the ErrCode... playback error codes
+}
+
+// LibraryStatsResponse is the response to libraryStats command. It covers
+// the last completed scan; Scanned is false if none has completed since the
+// daemon started.
+type LibraryStatsResponse struct {
+	Scanned        bool                 `json:"scanned"`
+	ScannedAt      int64                `json:"scannedAt,omitempty"` // Unix milliseconds
+	Tracks         int                  `json:"tracks"`
+	Formats        []LibraryFormatStats `json:"formats"`  // Most tracks first
+	Duration       int64                `json:"duration"` // milliseconds
+	Size           int64                `json:"size"`     // bytes on disk
+	Bitrates       []LibraryBitrateBand `json:"bitrates"`
+	UnknownBitrate int                  `json:"unknownBitrate"`
+	Folders        int                  `json:"folders"`    // Folders holding tracks
+	MissingArt     int                  `json:"missingArt"` // Of those, folders without a cover art file
+	Untagged       int                  `json:"untagged"`   // Tracks with neither an artist nor an album tag
+	Unreadable     []UnreadableFile     `json:"unreadable"`
+	LibraryErrors  map[string]string    `json:"libraryErrors,omitempty"` // Library path -> why it couldn't be scanned
+}
+
+// GetDiscoveryStatsRequest is the request for getDiscoveryStats command
+type GetDiscoveryStatsRequest struct {
+	Days int `json:"days,omitempty"` // Days of play history to look at, up to 365 (default: 30)
+}
+
+// GetDiscoveryStatsResponse is the response to getDiscoveryStats command:
+// how widely listening over the last days ranged over the library. Skipped
+// tracks don't count as plays.
+type GetDiscoveryStatsResponse struct {
+	Days            int     `json:"days"`
+	LibraryTracks   int     `json:"libraryTracks"`
+	Plays           int     `json:"plays"`
+	TracksPlayed    int     `json:"tracksPlayed"`
+	CoveragePercent float64 `json:"coveragePercent"` // Of library tracks, played at least once
+	Artists         int     `json:"artists"`
+
+	// ArtistEntropy is the Shannon entropy of plays across artists, in
+	// bits. EffectiveArtists is how many artists played equally often
+	// would spread listening as widely.
+	ArtistEntropy    float64 `json:"artistEntropy"`
+	EffectiveArtists float64 `json:"effectiveArtists"`
+
+	RepeatShare float64       `json:"repeatShare"` // Share of plays of a track already played, 0 - 1
+	InRut       bool          `json:"inRut"`       // Listening keeps to a few artists or the same tracks
+	TopArtists  []ArtistPlays `json:"topArtists"`  // Most played first
+
+	// DiscoveryShuffle is whether smart shuffle favors never played tracks
+	// while in a rut (the discoveryShuffle setting)
+	DiscoveryShuffle bool `json:"discoveryShuffle"`
+}
+
+// ArtistPlays is how often an artist was played
+type ArtistPlays struct {
+	Artist string `json:"artist"`
+	Plays  int    `json:"plays"`
+}
+
+// IdentifyTrackRequest is the request for identifyTrack command
+type IdentifyTrackRequest struct {
+	Path      string `json:"path"`
+	Apply     bool   `json:"apply,omitempty"`     // Write the chosen candidate's tags to the file
+	Candidate int    `json:"candidate,omitempty"` // Index of the candidate to apply; 0 is the best match
+}
+
+// IdentifyCandidate is a recording that matches a track's fingerprint
+type IdentifyCandidate struct {
+	RecordingID string  `json:"recordingId"` // MusicBrainz recording ID
+	Score       float64 `json:"score"`       // 0-1
+	Title       string  `json:"title"`
+	Artist      string  `json:"artist"`
+	Album       string  `json:"album,omitempty"`
+	AlbumArtist string  `json:"albumArtist,omitempty"`
+	Year        int     `json:"year,omitempty"`
+	TrackNumber int     `json:"trackNumber,omitempty"`
+	DiscNumber  int     `json:"discNumber,omitempty"`
+}
+
+// IdentifyTrackResponse is the response to identifyTrack command
+type IdentifyTrackResponse struct {
+	Path       string              `json:"path"`
+	Candidates []IdentifyCandidate `json:"candidates"`
+	Applied    *IdentifyCandidate  `json:"applied,omitempty"`
+}
+
+// TrackTagEdit is a tag change for one file. Omitted fields are left
+// unchanged; an empty string or 0 removes the tag.
+type TrackTagEdit struct {
+	Path        string  `json:"path"`
+	Title       *string `json:"title,omitempty"`
+	Artist      *string `json:"artist,omitempty"`
+	Album       *string `json:"album,omitempty"`
+	AlbumArtist *string `json:"albumArtist,omitempty"`
+	Genre       *string `json:"genre,omitempty"`
+	Year        *int    `json:"year,omitempty"`
+	TrackNumber *int    `json:"trackNumber,omitempty"`
+	DiscNumber  *int    `json:"discNumber,omitempty"`
+	ArtPath     string  `json:"artPath,omitempty"` // JPEG or PNG to embed as cover art
+}
+
+// SetTrackTagsRequest is the request for setTrackTags command
+type SetTrackTagsRequest struct {
+	Edits  []TrackTagEdit `json:"edits"`
+	DryRun bool           `json:"dryRun,omitempty"` // Validate and preview without writing
+}
+
+// TrackTagsResult is the outcome of one edit
+type TrackTagsResult struct {
+	Path  string        `json:"path"`
+	Track *LibraryTrack `json:"track,omitempty"` // Indexed metadata after the edit
+	Error string        `json:"error,omitempty"`
+}
+
+// SetTrackTagsResponse is the response to setTrackTags command
+type SetTrackTagsResponse struct {
+	Results []TrackTagsResult `json:"results"`
+	Written int               `json:"written"` // Always 0 for a dry run
+	Failed  int               `json:"failed"`
+	DryRun  bool              `json:"dryRun"`
+}
+
+// RelocateLibraryRequest is the request for relocateLibrary command
+type RelocateLibraryRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RelocateLibraryResponse is the response to relocateLibrary command
+type RelocateLibraryResponse struct {
+	From         string         `json:"from"`
+	To           string         `json:"to"`
+	Updated      map[string]int `json:"updated"` // Store name -> paths rewritten
+	LibraryPaths []string       `json:"libraryPaths"`
+}
+
+// TrackSkippedPush is pushed when auto-advance moves past a track that
+// failed to play, after the playbackError push for it
+type TrackSkippedPush struct {
+	Path string `json:"path"`
+	Code string `json:"code"` // The playbackError code
+}
+
+// PathsRelocatedPush is pushed after tracks moved, so clients can update
+// paths they keep themselves such as playlists
+type PathsRelocatedPush struct {
+	From  string            `json:"from,omitempty"`  // Set for relocateLibrary
+	To    string            `json:"to,omitempty"`    // Set for relocateLibrary
+	Moves map[string]string `json:"moves,omitempty"` // Old -> new path, set after a scan re-matched moved files
+}
+
+// CacheTrackRequest is the request for cacheTrack command
+type CacheTrackRequest struct {
+	Count int `json:"count,omitempty"` // Upcoming queue items to copy (default: 1)
+}
+
+// CacheTrackResponse is the response to cacheTrack command
+type CacheTrackResponse struct {
+	Copying     []string `json:"copying"`     // Tracks being copied in the background
+	Cached      []string `json:"cached"`      // Tracks that already have a local copy
+	CachedFiles int      `json:"cachedFiles"` // Tracks in the cache
+	CachedBytes int64    `json:"cachedBytes"`
+}
+
+// TrackCachedPush is pushed when a cacheTrack copy finishes
+type TrackCachedPush struct {
+	Path  string `json:"path"`
+	Error string `json:"error,omitempty"`
+}
+
+// DeviceLostPush is pushed when the output device goes away, e.g.
+// headphones are unplugged
+type DeviceLostPush struct {
+	Device string `json:"device"`
+	Paused bool   `json:"paused"` // Playback was paused rather than moving to another device
+}
+
+// DeviceReturnedPush is pushed when a lost output device comes back
+type DeviceReturnedPush struct {
+	Device  string `json:"device"`
+	Resumed bool   `json:"resumed"` // Playback paused by the loss was resumed
+}
+
+// PreviewEndedPush is pushed when a track on the preview channel plays to
+// its end, not when it's stopped or replaced
+type PreviewEndedPush struct {
+	Path string `json:"path"`
+}
+
+// MediaSessionChangedPush is pushed when the OS media session (MPRIS, Now
+// Playing) is lost and media keys stop reaching the daemon, and when it has
+// been reconnected
+type MediaSessionChangedPush struct {
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"` // Why it's unavailable
+}
+
+// TrackChangedPush is pushed when a different track starts playing, including
+// when the daemon advances on its own at the end of a track
+type TrackChangedPush struct {
+	Path     string         `json:"path"`
+	Metadata *TrackMetadata `json:"metadata,omitempty"`
+	Duration int64          `json:"duration"` // milliseconds
+	Reason   string         `json:"reason"`   // "ended", "next", "previous", "jump" or "play"
+
+	// Recommendation says why continue mode picked the track, if it did
+	Recommendation string `json:"recommendation,omitempty"`
+}
+
+// TrackEndingPush is pushed trackEndingSeconds before the current track
+// ends, so clients can show what plays next ahead of the change
+type TrackEndingPush struct {
+	Path        string         `json:"path"` // The track that is ending
+	RemainingMs int64          `json:"remainingMs"`
+	NextPath    string         `json:"nextPath,omitempty"` // Empty when nothing is queued after it
+	Next        *TrackMetadata `json:"next,omitempty"`     // With the art path when art was found
+}
+
+// QueueChangedPush is pushed after a command adds, removes or reorders
+// queued tracks
+type QueueChangedPush struct {
+	Version uint64 `json:"version"`
+	Command string `json:"command"` // The command that made the change
+}
+
+// QueueIndexChangedPush is pushed with trackChanged when the current queue
+// position moves
+type QueueIndexChangedPush struct {
+	Index int `json:"index"`
+	Size  int `json:"size"`
+}
+
+// GetWaveformRequest is the request for getWaveform command
+type GetWaveformRequest struct {
+	TrackPath string `json:"trackPath"`
+	Buckets   int    `json:"buckets,omitempty"` // Maximum buckets to return; 0 returns all stored
+}
+
+// GetWaveformResponse is the response to getWaveform command
+type GetWaveformResponse struct {
+	TrackPath  string `json:"trackPath"`
+	DurationMs int64  `json:"durationMs"`
+	Buckets    int    `json:"buckets"`
+	Peaks      []int8 `json:"peaks"` // min,max pair per bucket, scaled to -127..127
+}
+
+// GetPreviewRequest is the data for a getPreview command
+type GetPreviewRequest struct {
+	Path    string `json:"path"`
+	Seconds int    `json:"seconds,omitempty"` // Length of the clip (default: 15, at most 60)
+	Format  string `json:"format,omitempty"`  // "opus" (default) or "mp3"
+}
+
+// GetPreviewResponse is the response to a getPreview command: a short clip
+// of the track for hover-to-preview, played by the client
+type GetPreviewResponse struct {
+	Path        string `json:"path"`
+	StartMs     int64  `json:"startMs"` // Where in the track the clip starts
+	DurationMs  int64  `json:"durationMs"`
+	ContentType string `json:"contentType"`
+	Data        []byte `json:"data"` // The encoded clip, base64 in JSON
+
+	// FromAnalysis is set when the clip is the track's most energetic
+	// stretch going by its analysis, rather than a guess
+	FromAnalysis bool `json:"fromAnalysis"`
+}
+
+// PreviewPlayRequest is the data for a previewPlay command, which plays a
+// track on the preview channel alongside the main playback
+type PreviewPlayRequest struct {
+	Path     string `json:"path"`
+	StartMs  *int64 `json:"startMs,omitempty"`  // Where to start; omitted picks the track's most energetic stretch
+	LengthMs int64  `json:"lengthMs,omitempty"` // How much to play, 0 for the rest of the track
+}
+
+// PreviewStatusResponse is the response to previewPlay and previewStop
+type PreviewStatusResponse struct {
+	Path    string  `json:"path,omitempty"` // The track previewing, if any
+	StartMs int64   `json:"startMs,omitempty"` // Where a preview just played starts
+	Volume  float64 `json:"volume"`
+}
+
 // ExplainSimilarityRequest is the request for explainSimilarity command
 type ExplainSimilarityRequest struct {
 	TrackA string `json:"trackA"`
@@ -353,6 +1792,33 @@ type ExplainSimilarityRequest struct {
 // ExplainSimilarityResponse is the response to explainSimilarity command
 type ExplainSimilarityResponse struct {
 	Overall     float32 `json:"overall"`
+	MFCC        float32 `json:"mfcc"`
+	Tempo       float32 `json:"tempo"`
+	Spectral    float32 `json:"spectral"`
+	Energy      float32 `json:"energy"`
+	Bands       float32 `json:"bands"`
+	Instruments float32  `json:"instruments"`
+	Context     float32  `json:"context"`
+	Key         *float32 `json:"key,omitempty"` // Omitted unless both keys are known
+}
+
+// GetLearnedWeightsRequest is the request for getLearnedWeights command
+type GetLearnedWeightsRequest struct {
+	Limit int `json:"limit,omitempty"` // Transitions to return, default 20
+}
+
+// GetLearnedWeightsResponse is the response to getLearnedWeights command
+type GetLearnedWeightsResponse struct {
+	Weights     SimilarityWeights   `json:"weights"`  // Weights in use, tuned by plays and skips
+	Defaults    SimilarityWeights   `json:"defaults"` // Weights before any learning
+	Plays       int                 `json:"plays"`
+	Skips       int                 `json:"skips"`
+	UpdatedAt   int64               `json:"updatedAt"`   // Unix seconds, 0 if nothing was learned
+	Transitions []LearnedTransition `json:"transitions"` // Most skipped first
+}
+
+// SimilarityWeights are the weights of each feature group in similarity
+type SimilarityWeights struct {
 	MFCC        float32 `json:"mfcc"`
 	Tempo       float32 `json:"tempo"`
 	Spectral    float32 `json:"spectral"`
@@ -360,16 +1826,176 @@ type ExplainSimilarityResponse struct {
 	Bands       float32 `json:"bands"`
 	Instruments float32 `json:"instruments"`
 	Context     float32 `json:"context"`
+	Key         float32 `json:"key"`
+}
+
+// LearnedTransition counts plays and skips of one track right after another
+type LearnedTransition struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Plays int    `json:"plays"`
+	Skips int    `json:"skips"`
+}
+
+// GetTrackFeaturesRequest is the request for getTrackFeatures command
+type GetTrackFeaturesRequest struct {
+	TrackPath string `json:"trackPath"`
+	Path      string `json:"path,omitempty"` // Alternative to trackPath
+}
+
+// GetTrackFeaturesResponse is the response to getTrackFeatures command
+type GetTrackFeaturesResponse struct {
+	TrackPath   string           `json:"trackPath"`
+	Version     int              `json:"version"`
+	AnalyzedAt  int64            `json:"analyzedAt"`
+	Groups      map[string]int   `json:"groups"` // Feature group -> version
+	Features    TrackFeatures    `json:"features"`
+	Key         *TrackKey        `json:"key,omitempty"` // Omitted until the key is analyzed
+	Descriptors TrackDescriptors `json:"descriptors"`
+}
+
+// TrackDescriptors are high-level scores derived from a track's features,
+// all 0-1
+type TrackDescriptors struct {
+	Energy       float32 `json:"energy"`
+	Danceability float32 `json:"danceability"`
+	Acousticness float32 `json:"acousticness"`
+	Valence      float32 `json:"valence"` // Rough proxy for how happy a track sounds
+}
+
+// GetSmartPlaylistRequest is the request for getSmartPlaylist command.
+// Tracks must match the mood, if given, and every rule.
+type GetSmartPlaylistRequest struct {
+	Mood          string           `json:"mood,omitempty"` // e.g. "chill" or "hype"
+	Rules         []DescriptorRule `json:"rules,omitempty"`
+	MinRating     int              `json:"minRating,omitempty"` // Stars
+	FavoritesOnly bool             `json:"favoritesOnly,omitempty"`
+	Offset        int              `json:"offset,omitempty"`
+	Limit         int              `json:"limit,omitempty"`
+}
+
+// DescriptorRule limits a descriptor to an inclusive range
+type DescriptorRule struct {
+	Descriptor string   `json:"descriptor"`    // "energy", "danceability", "acousticness" or "valence"
+	Min        *float32 `json:"min,omitempty"` // Default 0
+	Max        *float32 `json:"max,omitempty"` // Default 1
+}
+
+// GetSmartPlaylistResponse is the response to getSmartPlaylist command
+type GetSmartPlaylistResponse struct {
+	Tracks []SmartPlaylistTrack `json:"tracks"`
+	Total  int                  `json:"total"` // Matches before offset and limit were applied
+	Moods  []string             `json:"moods"` // Moods that can be requested
+}
+
+// SmartPlaylistTrack is a library track with its descriptors
+type SmartPlaylistTrack struct {
+	LibraryTrack
+	Descriptors TrackDescriptors `json:"descriptors"`
+}
+
+// GetDailyMixesRequest is the request for getDailyMixes command
+type GetDailyMixesRequest struct {
+	Refresh bool `json:"refresh,omitempty"` // Regenerate now instead of waiting for the schedule
+}
+
+// GetDailyMixesResponse is the response to getDailyMixes command
+type GetDailyMixesResponse struct {
+	GeneratedAt int64      `json:"generatedAt"` // Unix seconds, 0 if no mixes were generated yet
+	Mixes       []DailyMix `json:"mixes"`
+}
+
+// DailyMix is a generated playlist built around one community
+type DailyMix struct {
+	ID          int            `json:"id"`
+	Name        string         `json:"name"`        // e.g. "Daily Mix 1"
+	Description string         `json:"description"` // Name of the community the mix is built around
+	CommunityID int            `json:"communityId"`
+	Mood        string         `json:"mood,omitempty"` // Mood most of the tracks match, if any
+	Tracks      []LibraryTrack `json:"tracks"`
+}
+
+// TrackFeatures contains the audio features of a track
+type TrackFeatures struct {
+	MFCC             []float32        `json:"mfcc"`
+	MFCCStdDev       []float32        `json:"mfccStdDev"`
+	SpectralCentroid float32          `json:"spectralCentroid"`
+	SpectralRolloff  float32          `json:"spectralRolloff"`
+	SpectralFlux     float32          `json:"spectralFlux"`
+	ZeroCrossing     float32          `json:"zeroCrossing"`
+	RMSEnergy        float32          `json:"rmsEnergy"`
+	Tempo            float32          `json:"tempo"`
+	BassRatio        float32          `json:"bassRatio"`
+	MidRatio         float32          `json:"midRatio"`
+	TrebleRatio      float32          `json:"trebleRatio"`
+	AttackSharpness  float32          `json:"attackSharpness"`
+	HarmonicDensity  float32          `json:"harmonicDensity"`
+	RhythmComplexity float32          `json:"rhythmComplexity"`
+	DynamicRange     float32          `json:"dynamicRange"`
+	Instruments      InstrumentScores `json:"instruments"`
+}
+
+// InstrumentScores contains instrument family presence scores (0-1)
+type InstrumentScores struct {
+	BrassLike         float32 `json:"brassLike"`
+	StringLike        float32 `json:"stringLike"`
+	WoodwindLike      float32 `json:"woodwindLike"`
+	Percussive        float32 `json:"percussive"`
+	SynthPad          float32 `json:"synthPad"`
+	VocalPresence     float32 `json:"vocalPresence"`
+	ArticulationStyle float32 `json:"articulationStyle"`
+	EnsembleSize      float32 `json:"ensembleSize"`
+	PlayingIntensity  float32 `json:"playingIntensity"`
+}
+
+// GetFeatureDistributionRequest is the request for getFeatureDistribution
+// command
+type GetFeatureDistributionRequest struct {
+	Bins     int      `json:"bins,omitempty"`     // Bins per histogram, default 20
+	Features []string `json:"features,omitempty"` // Features to include, default all
+}
+
+// GetFeatureDistributionResponse is the response to getFeatureDistribution
+// command. Only tracks in the library are counted.
+type GetFeatureDistributionResponse struct {
+	Tracks     int                `json:"tracks"` // Analyzed tracks counted
+	Histograms []FeatureHistogram `json:"histograms"`
+	Keys       map[string]int     `json:"keys"`     // Key name (e.g. "A minor") -> tracks
+	Features   []string           `json:"features"` // Features that can be requested
+}
+
+// FeatureHistogram counts a feature's values in equal-width bins from Min to
+// Max
+type FeatureHistogram struct {
+	Feature string  `json:"feature"`
+	Min     float32 `json:"min"`
+	Max     float32 `json:"max"`
+	Mean    float32 `json:"mean"`
+	Tracks  int     `json:"tracks"` // Tracks with a known value
+	Counts  []int   `json:"counts"`
+}
+
+// TrackKey is the estimated musical key of a track
+type TrackKey struct {
+	Name     string  `json:"name"`    // e.g. "A minor"
+	Tonic    string  `json:"tonic"`   // e.g. "A"
+	Mode     string  `json:"mode"`    // "major" or "minor"
+	Camelot  string  `json:"camelot"` // e.g. "8A", for harmonic mixing
+	Strength float32 `json:"strength"`
 }
 
 // SetContinueModeRequest is the request for setContinueMode command
 type SetContinueModeRequest struct {
-	Mode string `json:"mode"` // "off", "similar", "random"
+	Mode          string `json:"mode"`                    // "off", "similar", "random"
+	MinRating     int    `json:"minRating,omitempty"`     // Only add tracks rated at least this
+	FavoritesOnly bool   `json:"favoritesOnly,omitempty"` // Only add favorites
 }
 
 // GetContinueModeResponse is the response to getContinueMode command
 type GetContinueModeResponse struct {
-	Mode string `json:"mode"` // "off", "similar", "random"
+	Mode          string `json:"mode"` // "off", "similar", "random"
+	MinRating     int    `json:"minRating,omitempty"`
+	FavoritesOnly bool   `json:"favoritesOnly,omitempty"`
 }
 
 // EncodeRequest encodes a request to JSON
@@ -424,8 +2050,42 @@ func NewErrorResponse(err string) *Response {
 	}
 }
 
+// NewRateLimitedResponse creates an error response telling the client to
+// retry after the given delay
+func NewRateLimitedResponse(retryAfter time.Duration) *Response {
+	retryMs := retryAfter.Milliseconds()
+	if retryMs < 1 {
+		retryMs = 1
+	}
+	return &Response{
+		Success:      false,
+		Error:        ErrCodeRateLimited,
+		Code:         ErrCodeRateLimited,
+		RetryAfterMs: retryMs,
+	}
+}
+
+// NewConflictResponse creates an error response for an edit made against
+// stale state, carrying the current state so the client can redo the edit
+func NewConflictResponse(current interface{}) *Response {
+	resp := &Response{
+		Success: false,
+		Error:   ErrCodeConflict,
+		Code:    ErrCodeConflict,
+	}
+	if data, err := json.Marshal(current); err == nil {
+		resp.Data = data
+	}
+	return resp
+}
+
 // NewPushMessage creates a push message for streaming data
 func NewPushMessage(msgType string, data interface{}) ([]byte, error) {
+	return NewPushMessageBy(msgType, data, nil)
+}
+
+// NewPushMessageBy creates a push message for an event a client caused
+func NewPushMessageBy(msgType string, data interface{}, by *ClientRef) ([]byte, error) {
 	var rawData json.RawMessage
 	if data != nil {
 		var err error
@@ -437,6 +2097,7 @@ func NewPushMessage(msgType string, data interface{}) ([]byte, error) {
 	msg := PushMessage{
 		Type: msgType,
 		Data: rawData,
+		By:   by,
 	}
 	return json.Marshal(msg)
 }
@@ -191,6 +191,46 @@ func TestNewErrorResponse(t *testing.T) {
 	}
 }
 
+func TestNewConflictResponse(t *testing.T) {
+	resp := NewConflictResponse(GetQueueResponse{Items: []QueueItem{{ID: 7, Path: "/a.mp3"}}, Version: 3})
+
+	if resp.Success || resp.Code != ErrCodeConflict {
+		t.Errorf("Expected a failed response with code %q, got %+v", ErrCodeConflict, resp)
+	}
+
+	var current GetQueueResponse
+	if err := json.Unmarshal(resp.Data, &current); err != nil {
+		t.Fatalf("Failed to unmarshal current state: %v", err)
+	}
+	if current.Version != 3 || len(current.Items) != 1 || current.Items[0].ID != 7 {
+		t.Errorf("Expected the current queue in the response, got %+v", current)
+	}
+}
+
+func TestPushMessageAttribution(t *testing.T) {
+	by := &ClientRef{ClientID: "abc", Name: "musicdctl", ConnectionID: 4}
+	data, err := NewPushMessageBy("queueChanged", QueueChangedPush{Version: 2, Command: "queue"}, by)
+	if err != nil {
+		t.Fatalf("NewPushMessageBy failed: %v", err)
+	}
+
+	var msg PushMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("Failed to unmarshal push: %v", err)
+	}
+	if msg.By == nil || *msg.By != *by {
+		t.Errorf("Expected push by %+v, got %+v", by, msg.By)
+	}
+
+	// The daemon's own events carry no client
+	data, _ = NewPushMessage("trackChanged", nil)
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	if _, ok := decoded["by"]; ok {
+		t.Errorf("Expected no by field, got %s", data)
+	}
+}
+
 func TestCommandTypes(t *testing.T) {
 	commands := []CommandType{
 		CmdPair,
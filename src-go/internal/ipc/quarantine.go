@@ -0,0 +1,151 @@
+package ipc
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/library"
+	"github.com/austinkregel/local-media/musicd/internal/scanner"
+)
+
+// quarantineFromScan sets aside the files a scan couldn't read and releases
+// quarantined files it read cleanly
+func (s *Server) quarantineFromScan(results []scanner.ScanResult) {
+	now := time.Now()
+	var readable []string
+	for _, result := range results {
+		failed := make(map[string]bool, len(result.Unreadable))
+		for _, u := range result.Unreadable {
+			failed[u.Path] = true
+			if err := s.quarantine.Add(u.Path, library.QuarantineScan, errors.New(u.Error), now); err != nil {
+				log.Printf("[SCANNER] Failed to save quarantine: %v", err)
+			}
+		}
+		for _, f := range result.Files {
+			if f.Metadata != nil && !failed[f.Path] {
+				readable = append(readable, f.Path)
+			}
+			if f.Cue != nil {
+				readable = append(readable, f.Cue.Image) // Split only if it read cleanly
+			}
+		}
+	}
+
+	if released, err := s.quarantine.Release(readable); err != nil {
+		log.Printf("[SCANNER] Failed to save quarantine: %v", err)
+	} else if released > 0 {
+		log.Printf("[SCANNER] Released %d files from quarantine", released)
+	}
+}
+
+// quarantineIfUnreadable sets a file aside if err shows ffmpeg or ffprobe
+// rejected it, and reports whether it did. Missing files, streams and
+// output failures aren't the file's fault and are left alone.
+func (s *Server) quarantineIfUnreadable(path string, err error) bool {
+	var exitErr *exec.ExitError
+	if audio.IsStreamURL(path) || !errors.As(err, &exitErr) {
+		return false
+	}
+	if _, statErr := os.Stat(path); statErr != nil {
+		return false
+	}
+
+	// Output() keeps what ffprobe printed, which says what is wrong
+	if msg, _, _ := strings.Cut(strings.TrimSpace(string(exitErr.Stderr)), "\n"); msg != "" {
+		err = errors.New(msg)
+	}
+	log.Printf("[PLAYER] Quarantining unreadable file %s: %v", path, err)
+	if saveErr := s.quarantine.Add(path, library.QuarantinePlayback, err, time.Now()); saveErr != nil {
+		log.Printf("[PLAYER] Failed to save quarantine: %v", saveErr)
+	}
+	s.broadcastPush("trackQuarantined", TrackQuarantinedPush{QuarantinedFile: QuarantinedFile{
+		Path:   path,
+		Error:  err.Error(),
+		Source: library.QuarantinePlayback,
+		At:     time.Now().UnixMilli(),
+	}})
+	return true
+}
+
+func (s *Server) handleGetQuarantine() *Response {
+	files := s.quarantine.List()
+	result := GetQuarantineResponse{Files: make([]QuarantinedFile, len(files))}
+	for i, f := range files {
+		result.Files[i] = QuarantinedFile(f)
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// handleRetryQuarantined probes quarantined files again and releases those
+// that read cleanly. A file that failed part way through playback can probe
+// fine and still fail to decode, in which case playback quarantines it again.
+func (s *Server) handleRetryQuarantined(req *Request) *Response {
+	var retryReq RetryQuarantinedRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &retryReq); err != nil {
+			return NewErrorResponse("invalid retryQuarantined request")
+		}
+	}
+
+	paths := retryReq.Paths
+	if len(paths) == 0 {
+		for _, f := range s.quarantine.List() {
+			paths = append(paths, f.Path)
+		}
+	}
+
+	result := RetryQuarantinedResponse{Released: []string{}, StillFailing: []QuarantinedFile{}}
+	for _, path := range paths {
+		if !s.quarantine.Contains(path) {
+			continue
+		}
+		probeErr := s.probeFile(path)
+		if probeErr == nil {
+			result.Released = append(result.Released, path)
+			continue
+		}
+
+		now := time.Now()
+		if err := s.quarantine.Add(path, library.QuarantineScan, probeErr, now); err != nil {
+			log.Printf("[SCANNER] Failed to save quarantine: %v", err)
+		}
+		result.StillFailing = append(result.StillFailing, QuarantinedFile{
+			Path:   path,
+			Error:  probeErr.Error(),
+			Source: library.QuarantineScan,
+			At:     now.UnixMilli(),
+		})
+	}
+
+	if released, err := s.quarantine.Release(result.Released); err != nil {
+		log.Printf("[SCANNER] Failed to save quarantine: %v", err)
+	} else if released > 0 {
+		log.Printf("[SCANNER] Released %d files from quarantine", released)
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// probeFile checks that a file exists and ffprobe can read it
+func (s *Server) probeFile(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	_, err := s.libScanner.Probe(path)
+	return err
+}
@@ -0,0 +1,48 @@
+package ipc
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// queueEditCommands change which tracks are queued or their order. Each
+// accepts an optional ifVersion in its data.
+var queueEditCommands = map[CommandType]bool{
+	CmdQueue:                 true,
+	CmdQueueRemove:           true,
+	CmdQueueMove:             true,
+	CmdQueueUndo:             true,
+	CmdQueueRedo:             true,
+	CmdQueueRemoveRange:      true,
+	CmdQueueRemoveByPaths:    true,
+	CmdQueueDeduplicate:      true,
+	CmdQueueShuffleRemaining: true,
+	CmdQueueSmartOrder:       true,
+}
+
+// queueCondition is the version a queue edit expects the queue to be at
+type queueCondition struct {
+	IfVersion *uint64 `json:"ifVersion,omitempty"`
+}
+
+// checkQueueVersion returns a conflict response with the current queue if an
+// edit expects a version the queue has moved past, so two clients editing at
+// once don't silently undo each other's changes. Edits without ifVersion
+// always apply. (must be called with queueEditMu held)
+func (s *Server) checkQueueVersion(req *Request) *Response {
+	if len(req.Data) == 0 {
+		return nil
+	}
+	var cond queueCondition
+	if err := json.Unmarshal(req.Data, &cond); err != nil || cond.IfVersion == nil {
+		// Malformed data is left for the command to reject
+		return nil
+	}
+
+	current := s.queueState()
+	if current.Version == *cond.IfVersion {
+		return nil
+	}
+	log.Printf("[QUEUE] Rejected %s for queue version %d, now at %d", req.Cmd, *cond.IfVersion, current.Version)
+	return NewConflictResponse(current)
+}
@@ -0,0 +1,75 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/austinkregel/local-media/musicd/internal/library"
+)
+
+// ratingPath returns the track a rating command is for, defaulting to the
+// current track
+func (s *Server) ratingPath(path string) string {
+	if path != "" {
+		return path
+	}
+	return s.player.Status().Path
+}
+
+func (s *Server) handleSetRating(ctx context.Context, req *Request) *Response {
+	var ratingReq SetRatingRequest
+	if err := json.Unmarshal(req.Data, &ratingReq); err != nil {
+		return NewErrorResponse("invalid setRating request")
+	}
+	path := s.ratingPath(ratingReq.Path)
+	if path == "" {
+		return NewErrorResponse("nothing is playing")
+	}
+
+	rating, err := s.ratings.SetStars(path, ratingReq.Rating)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	log.Printf("[SCANNER] Rated %d stars: %s", rating.Stars, path)
+	return s.ratingChanged(ctx, path, rating)
+}
+
+func (s *Server) handleToggleFavorite(ctx context.Context, req *Request) *Response {
+	var favoriteReq ToggleFavoriteRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &favoriteReq); err != nil {
+			return NewErrorResponse("invalid toggleFavorite request")
+		}
+	}
+	path := s.ratingPath(favoriteReq.Path)
+	if path == "" {
+		return NewErrorResponse("nothing is playing")
+	}
+
+	var rating library.Rating
+	var err error
+	if favoriteReq.Favorite != nil {
+		rating, err = s.ratings.SetFavorite(path, *favoriteReq.Favorite)
+	} else {
+		rating, err = s.ratings.ToggleFavorite(path)
+	}
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	log.Printf("[SCANNER] Favorite %v: %s", rating.Favorite, path)
+	return s.ratingChanged(ctx, path, rating)
+}
+
+// ratingChanged tells every client about a new rating and returns it as the
+// response
+func (s *Server) ratingChanged(ctx context.Context, path string, rating library.Rating) *Response {
+	result := TrackRatingResponse{Path: path, Rating: rating.Stars, Favorite: rating.Favorite}
+	s.broadcastPushBy(actorFrom(ctx), "ratingChanged", result)
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
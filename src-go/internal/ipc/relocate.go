@@ -0,0 +1,302 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/austinkregel/local-media/musicd/internal/analysis"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+	"github.com/austinkregel/local-media/musicd/internal/library"
+	"github.com/austinkregel/local-media/musicd/internal/scanner"
+)
+
+// Relocatable is a store keyed by track path. rename returns the new path
+// for a track and false if it did not move; RelocatePaths returns the number
+// of paths rewritten.
+type Relocatable interface {
+	RelocatePaths(rename func(path string) (string, bool)) int
+}
+
+// AddRelocatable registers a store the server doesn't own, such as the resume
+// positions, so it follows moved tracks too
+func (s *Server) AddRelocatable(name string, r Relocatable) {
+	if s.relocatables == nil {
+		s.relocatables = make(map[string]Relocatable)
+	}
+	s.relocatables[name] = r
+}
+
+// relocate rewrites track paths in every store and returns how many paths
+// each one changed
+func (s *Server) relocate(rename func(path string) (string, bool)) map[string]int {
+	updated := make(map[string]int)
+	for name, r := range s.relocatables {
+		updated[name] = r.RelocatePaths(rename)
+	}
+
+	if s.featureStore != nil {
+		updated["analysis"] = s.featureStore.RelocatePaths(rename)
+		if updated["analysis"] > 0 {
+			if err := s.featureStore.Save(); err != nil {
+				log.Printf("[ANALYSIS] Warning: failed to save relocated features: %v", err)
+			}
+		}
+	}
+	if s.mixStore != nil {
+		updated["mixes"] = s.mixStore.RelocatePaths(rename)
+	}
+	if s.weightLearner != nil {
+		updated["transitions"] = s.weightLearner.RelocatePaths(rename)
+	}
+	if s.trackGains != nil {
+		updated["gains"] = s.trackGains.RelocatePaths(rename)
+	}
+	if s.bookmarkStore != nil {
+		updated["bookmarks"] = s.bookmarkStore.RelocatePaths(rename)
+	}
+	if s.playCounts != nil {
+		updated["playCounts"] = s.playCounts.RelocatePaths(rename)
+	}
+	updated["library"] = s.libraryIndex.RelocatePaths(rename)
+	updated["ratings"] = s.ratings.RelocatePaths(rename)
+	updated["quarantine"] = s.quarantine.RelocatePaths(rename)
+	updated["introSkips"] = s.introSkips.RelocatePaths(rename)
+
+	// The queue goes last: its change callback saves the session, which should
+	// pick up the stores relocated above
+	updated["queue"] = s.queueMgr.RelocatePaths(rename)
+	return updated
+}
+
+func (s *Server) handleRelocateLibrary(ctx context.Context, req *Request) *Response {
+	var relocReq RelocateLibraryRequest
+	if err := json.Unmarshal(req.Data, &relocReq); err != nil {
+		return NewErrorResponse("invalid relocateLibrary request")
+	}
+	if relocReq.From == "" || relocReq.To == "" {
+		return NewErrorResponse("from and to are required")
+	}
+	if !filepath.IsAbs(relocReq.From) || !filepath.IsAbs(relocReq.To) {
+		return NewErrorResponse("from and to must be absolute paths")
+	}
+	from := filepath.Clean(relocReq.From)
+	to := filepath.Clean(relocReq.To)
+	if from == to {
+		return NewErrorResponse("from and to are the same path")
+	}
+	// In sandbox mode tracks can only move within the library, so it can't
+	// be pointed somewhere new
+	if cfg := s.configMgr.Get(); cfg.Auth.Sandbox {
+		if resp := (pathPolicy{roots: cfg.LibraryPaths, sandbox: true}).check(to); resp != nil {
+			return resp
+		}
+	}
+	if info, err := os.Stat(to); err != nil || !info.IsDir() {
+		return NewErrorResponse(fmt.Sprintf("%s is not a directory", to))
+	}
+
+	rename := library.PrefixRename(from, to)
+
+	// Point library directories under the old prefix at the new one
+	cfg := *s.configMgr.Get()
+	libraryPaths := make([]string, len(cfg.LibraryPaths))
+	changed := false
+	for i, dir := range cfg.LibraryPaths {
+		libraryPaths[i] = dir
+		if newDir, ok := rename(filepath.Clean(dir)); ok {
+			libraryPaths[i] = newDir
+			changed = true
+		}
+	}
+	// Scan options follow their library paths
+	libraryScan := make(map[string]config.ScanOptions, len(cfg.LibraryScan))
+	for dir, opts := range cfg.LibraryScan {
+		if newDir, ok := rename(filepath.Clean(dir)); ok {
+			dir = newDir
+			changed = true
+		}
+		libraryScan[dir] = opts
+	}
+	if changed {
+		if err := config.ValidateLibraryPaths(libraryPaths); err != nil {
+			return NewErrorResponse(err.Error())
+		}
+		cfg.LibraryPaths = libraryPaths
+		if len(libraryScan) > 0 {
+			cfg.LibraryScan = libraryScan
+		}
+		if err := s.configMgr.Update(&cfg); err != nil {
+			var fieldErr *config.FieldError
+			if errors.As(err, &fieldErr) {
+				return NewErrorResponse(fmt.Sprintf("invalid config: %v", err))
+			}
+			log.Printf("[CONFIG] Failed to save config: %v", err)
+			return NewErrorResponse(fmt.Sprintf("failed to save config: %v", err))
+		}
+	}
+
+	updated := s.relocate(rename)
+	log.Printf("[SCANNER] Relocated library %s -> %s: %v", from, to, updated)
+	s.broadcastPushBy(actorFrom(ctx), "pathsRelocated", PathsRelocatedPush{From: from, To: to})
+
+	resp, err := NewSuccessResponse(RelocateLibraryResponse{
+		From:         from,
+		To:           to,
+		Updated:      updated,
+		LibraryPaths: libraryPaths,
+	})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// reconcileMovedFiles matches analyzed tracks that disappeared from disk with
+// newly scanned files by content hash, or by acoustic fingerprint for tracks
+// that were re-encoded, and moves their data to the new paths
+func (s *Server) reconcileMovedFiles(results []scanner.ScanResult) {
+	if s.featureStore == nil {
+		return
+	}
+
+	scanned := make(map[string]scanner.FileInfo)
+	for _, result := range results {
+		for _, file := range result.Files {
+			scanned[file.Path] = file
+		}
+	}
+
+	// Analyzed tracks that are gone, by hash. Tracks stored before hashes
+	// ignored the path can't be matched; present ones get a new hash instead.
+	missing := make(map[string]string)
+	ambiguous := make(map[string]bool)
+	var gone []string
+	rehashed := 0
+	for path, hash := range s.featureStore.FileHashes() {
+		if _, err := os.Stat(path); err == nil {
+			if _, ok := scanned[path]; ok && !analysis.IsContentHash(hash) {
+				if newHash, err := analysis.FileHash(path); err == nil {
+					s.featureStore.SetFileHash(path, newHash)
+					rehashed++
+				}
+			}
+			continue
+		}
+		gone = append(gone, path)
+		if !analysis.IsContentHash(hash) {
+			continue
+		}
+		if _, dup := missing[hash]; dup {
+			ambiguous[hash] = true
+		}
+		missing[hash] = path
+	}
+
+	moves := make(map[string]string)
+	if len(missing) > 0 {
+		for path := range scanned {
+			if s.featureStore.HasFeatures(path, 0) {
+				continue
+			}
+			hash, err := analysis.FileHash(path)
+			if err != nil || ambiguous[hash] {
+				continue
+			}
+			if oldPath, ok := missing[hash]; ok {
+				moves[oldPath] = path
+				delete(missing, hash)
+			}
+		}
+	}
+	reencoded := s.matchReencodedFiles(gone, scanned, moves)
+
+	if len(moves) == 0 {
+		if rehashed > 0 {
+			if err := s.featureStore.Save(); err != nil {
+				log.Printf("[ANALYSIS] Warning: failed to save file hashes: %v", err)
+			}
+		}
+		return
+	}
+
+	// Every move is an analyzed track, so relocate saves the rehashed entries
+	updated := s.relocate(library.MapRename(moves))
+	log.Printf("[SCANNER] Re-matched %d moved files (%d re-encoded): %v", len(moves), reencoded, updated)
+	s.broadcastPush("pathsRelocated", PathsRelocatedPush{Moves: moves})
+}
+
+// matchReencodedFiles looks for the tracks in gone that moves doesn't account
+// for among new files of the same recording, by acoustic fingerprint, so a
+// track converted to another format keeps its ratings, play counts and the
+// rest. Its features carry over too, as they describe the same audio. Only
+// new files about as long as a missing track are fingerprinted. Matches are
+// added to moves; returns how many were found.
+func (s *Server) matchReencodedFiles(gone []string, scanned map[string]scanner.FileInfo, moves map[string]string) int {
+	fingerprints := make(map[string]*analysis.Fingerprint)
+	for _, path := range gone {
+		if _, moved := moves[path]; moved {
+			continue
+		}
+		if fp, err := s.featureStore.GetFingerprint(path); err == nil {
+			fingerprints[path] = fp
+		}
+	}
+	if len(fingerprints) == 0 {
+		return 0
+	}
+	fpcalcPath := analysis.FindFpcalc()
+	if fpcalcPath == "" {
+		return 0
+	}
+
+	taken := make(map[string]bool, len(moves))
+	for _, newPath := range moves {
+		taken[newPath] = true
+	}
+
+	found := 0
+	for path, file := range scanned {
+		if len(fingerprints) == 0 {
+			break
+		}
+		// Tracks of CUE sheets have no file of their own to fingerprint
+		if taken[path] || file.Cue != nil || file.Metadata == nil || s.featureStore.HasFeatures(path, 0) {
+			continue
+		}
+		seconds := int(file.Metadata.Duration / 1000)
+		var candidates []string
+		for oldPath, fp := range fingerprints {
+			if fp.Spans(seconds) {
+				candidates = append(candidates, oldPath)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
+		fp, err := analysis.ComputeFingerprint(context.Background(), fpcalcPath, path)
+		if err != nil {
+			log.Printf("[SCANNER] Warning: failed to fingerprint %s: %v", path, err)
+			continue
+		}
+		for _, oldPath := range candidates {
+			if !analysis.SameRecording(fingerprints[oldPath], fp) {
+				continue
+			}
+			// The stored hash is the old file's; relocate saves the new one
+			if hash, err := analysis.FileHash(path); err == nil {
+				s.featureStore.SetFileHash(oldPath, hash)
+			}
+			moves[oldPath] = path
+			delete(fingerprints, oldPath)
+			found++
+			break
+		}
+	}
+	return found
+}
@@ -0,0 +1,124 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/render"
+	"github.com/austinkregel/local-media/musicd/internal/transcode"
+)
+
+// localRendererID is the renderer id for this computer's own audio output
+const localRendererID = "local"
+
+// rendererConnectTimeout bounds connecting to a device in setRenderer
+const rendererConnectTimeout = 10 * time.Second
+
+// SetTranscoder has tracks streamed to renderers converted as the transcode
+// settings say for each renderer, and enables getPreview
+func (s *Server) SetTranscoder(t *transcode.Transcoder) {
+	s.transcoder = t
+	s.renderers.SetTranscoder(t, func(rendererID string) transcode.Profile {
+		profile := s.configMgr.Get().Transcode.ProfileFor(rendererID)
+		return transcode.Profile{
+			Format:      profile.Format,
+			BitrateKbps: profile.BitrateKbps,
+			Extensions:  profile.Extensions,
+		}
+	})
+}
+
+func (s *Server) handleListRenderers(ctx context.Context, req *Request) *Response {
+	var listReq ListRenderersRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &listReq); err != nil {
+			return NewErrorResponse("invalid listRenderers request")
+		}
+	}
+
+	s.rendererMu.Lock()
+	searched := s.renderersSearched
+	s.rendererMu.Unlock()
+
+	devices := s.renderers.Devices()
+	if listReq.Refresh || !searched {
+		found, err := s.renderers.Discover(ctx, render.DefaultDiscoveryTimeout)
+		if err != nil {
+			return NewErrorResponse("renderer discovery failed")
+		}
+		devices = found
+		log.Printf("[RENDER] Found %d renderer(s)", len(devices))
+
+		s.rendererMu.Lock()
+		s.renderersSearched = true
+		s.rendererMu.Unlock()
+	}
+
+	active := s.activeRendererID()
+	result := ListRenderersResponse{Renderers: []Renderer{{
+		ID:     localRendererID,
+		Name:   "This computer",
+		Kind:   localRendererID,
+		Active: active == localRendererID,
+	}}}
+	for _, d := range devices {
+		result.Renderers = append(result.Renderers, Renderer{
+			ID:      d.ID,
+			Name:    d.Name,
+			Kind:    d.Kind,
+			Address: d.Host,
+			Model:   d.Model,
+			Active:  active == d.ID,
+		})
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleSetRenderer(ctx context.Context, req *Request) *Response {
+	var setReq SetRendererRequest
+	if err := json.Unmarshal(req.Data, &setReq); err != nil || setReq.ID == "" {
+		return NewErrorResponse("invalid setRenderer request")
+	}
+
+	s.rendererSwitchMu.Lock()
+	defer s.rendererSwitchMu.Unlock()
+
+	if setReq.ID != s.activeRendererID() {
+		if setReq.ID == localRendererID {
+			s.player.SetRenderer(nil)
+		} else {
+			connectCtx, cancel := context.WithTimeout(ctx, rendererConnectTimeout)
+			r, err := s.renderers.Open(connectCtx, setReq.ID)
+			cancel()
+			if err != nil {
+				if errors.Is(err, render.ErrUnknownRenderer) {
+					return NewErrorResponse("unknown renderer")
+				}
+				log.Printf("[RENDER] Failed to connect to %s: %v", setReq.ID, err)
+				return NewErrorResponse("failed to connect to renderer")
+			}
+			s.player.SetRenderer(r)
+		}
+		s.rendererMu.Lock()
+		s.rendererID = setReq.ID
+		s.rendererMu.Unlock()
+		log.Printf("[RENDER] Playing on %s", setReq.ID)
+	}
+
+	return s.handleStatus()
+}
+
+// activeRendererID returns the id of the renderer playback goes to
+func (s *Server) activeRendererID() string {
+	s.rendererMu.Lock()
+	defer s.rendererMu.Unlock()
+	return s.rendererID
+}
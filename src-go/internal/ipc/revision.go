@@ -0,0 +1,116 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStatusWait = 25 * time.Second
+	maxStatusWait     = 60 * time.Second
+
+	// How often a waiting statusSince looks for changes that nothing
+	// announces, such as a track ending or pausing from the OS media controls
+	statusPollInterval = 250 * time.Millisecond
+)
+
+// statusRevision numbers status snapshots. The revision moves on whenever
+// anything but the playback position changes, so an unchanged revision means
+// a client's copy is still current.
+type statusRevision struct {
+	mu       sync.Mutex
+	revision uint64
+	key      string
+	changed  chan struct{} // Closed when the revision moves on
+}
+
+func newStatusRevision() *statusRevision {
+	return &statusRevision{changed: make(chan struct{})}
+}
+
+// observe compares a status snapshot with the last one and returns the
+// revision it belongs to
+func (r *statusRevision) observe(status StatusResponse) uint64 {
+	// Position advances on its own during playback; clients extrapolate it
+	status.Position = 0
+	status.Revision = 0
+	data, _ := json.Marshal(status)
+	key := string(data)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key != r.key {
+		r.key = key
+		r.advanceLocked()
+	}
+	return r.revision
+}
+
+// bump moves to a new revision for a change observe can't see, such as a
+// seek
+func (r *statusRevision) bump() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.advanceLocked()
+}
+
+// wait returns a channel that is closed when the revision next moves on
+func (r *statusRevision) wait() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.changed
+}
+
+// advanceLocked starts a new revision and wakes waiters (must be called with
+// lock held)
+func (r *statusRevision) advanceLocked() {
+	r.revision++
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// handleStatusSince answers once the status revision differs from the one the
+// client has, or when the wait times out with the status unchanged. A
+// revision that is different rather than higher counts, so a client that
+// kept a revision from before a daemon restart resynchronizes straight away.
+// The connection is busy while waiting, so clients should long-poll on a
+// connection of their own.
+func (s *Server) handleStatusSince(ctx context.Context, req *Request) *Response {
+	var sinceReq StatusSinceRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &sinceReq); err != nil {
+			return NewErrorResponse("invalid statusSince request")
+		}
+	}
+	if sinceReq.TimeoutMs < 0 {
+		return NewErrorResponse("invalid statusSince request")
+	}
+
+	timeout := defaultStatusWait
+	if sinceReq.TimeoutMs > 0 {
+		timeout = min(time.Duration(sinceReq.TimeoutMs)*time.Millisecond, maxStatusWait)
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+
+	for {
+		changed := s.statusRev.wait()
+		status := s.currentStatus()
+		if status.Revision != sinceReq.Revision {
+			return s.statusResponse(status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return NewErrorResponse("server shutting down")
+		case <-deadline.C:
+			return s.statusResponse(status)
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+// statusSince runs a statusSince command and returns the status it answers
+// with and how long it took
+func statusSince(t *testing.T, s *Server, revision uint64, timeoutMs int) (StatusResponse, time.Duration) {
+	t.Helper()
+	data, _ := json.Marshal(StatusSinceRequest{Revision: revision, TimeoutMs: timeoutMs})
+	start := time.Now()
+	resp := s.handleStatusSince(context.Background(), &Request{Cmd: CmdStatusSince, Data: data})
+	took := time.Since(start)
+	if !resp.Success {
+		t.Fatalf("statusSince failed: %s", resp.Error)
+	}
+	var status StatusResponse
+	if err := json.Unmarshal(resp.Data, &status); err != nil {
+		t.Fatal(err)
+	}
+	return status, took
+}
+
+func TestStatusSinceTimesOutUnchanged(t *testing.T) {
+	s := newTestServer(t)
+	current := s.currentStatus().Revision
+
+	status, took := statusSince(t, s, current, 100)
+	if status.Revision != current {
+		t.Errorf("Expected the same revision after the timeout, got %d for %d", status.Revision, current)
+	}
+	if took < 100*time.Millisecond {
+		t.Errorf("Expected to wait out the timeout, answered after %v", took)
+	}
+
+	// A revision the daemon never gave out, e.g. from before a restart, is
+	// answered straight away
+	if status, took := statusSince(t, s, current+100, 5000); status.Revision != current || took > time.Second {
+		t.Errorf("Expected revision %d straight away, got %d after %v", current, status.Revision, took)
+	}
+}
+
+func TestStatusSinceWakesOnChange(t *testing.T) {
+	s := newTestServer(t)
+	tracks := writeTracks(t, "a.flac")
+	if err := s.player.Play(context.Background(), tracks[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	current := s.currentStatus().Revision
+
+	// A seek announces itself
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		data, _ := json.Marshal(SeekRequest{Position: 10000})
+		s.handleSeek(&Request{Cmd: CmdSeek, Data: data})
+	}()
+	status, took := statusSince(t, s, current, 5000)
+	if status.Revision == current || took > time.Second {
+		t.Errorf("Expected a new revision after the seek, got %d after %v", status.Revision, took)
+	}
+
+	// Changes nothing announces are found by polling
+	current = status.Revision
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.queueMgr.SetRepeat(queue.RepeatAll)
+	}()
+	status, took = statusSince(t, s, current, 5000)
+	if status.Revision == current || status.RepeatMode != "all" || took > time.Second {
+		t.Errorf("Expected a new revision with repeat on, got %d (%s) after %v", status.Revision, status.RepeatMode, took)
+	}
+}
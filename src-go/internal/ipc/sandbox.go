@@ -0,0 +1,101 @@
+package ipc
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/austinkregel/local-media/musicd/internal/config"
+	"github.com/austinkregel/local-media/musicd/internal/cue"
+)
+
+// SetSandboxDirs sets the folders musicd keeps its own copies of tracks in,
+// which sandbox mode allows alongside the library
+func (s *Server) SetSandboxDirs(dirs ...string) {
+	s.sandboxDirs = dirs
+}
+
+// sandboxPolicy returns where files may be in sandbox mode
+func (s *Server) sandboxPolicy(cfg *config.Config) pathPolicy {
+	roots := make([]string, 0, len(cfg.LibraryPaths)+len(s.sandboxDirs))
+	roots = append(roots, cfg.LibraryPaths...)
+	roots = append(roots, s.sandboxDirs...)
+	return pathPolicy{roots: roots, sandbox: true, streamHosts: cfg.Auth.StreamHosts}
+}
+
+// CheckOpen returns an error if sandbox mode doesn't allow path to be
+// opened. The player puts every track and piece of album art to it before
+// opening them, so in sandbox mode paths that reach it other than in a
+// request, such as a schedule's or a bookmark's, are held to the sandbox
+// too. Outside sandbox mode it allows everything: which files a client may
+// name depends on its scopes, which validateRequest checks as the request
+// arrives.
+func (s *Server) CheckOpen(path string) error {
+	cfg := s.configMgr.Get()
+	if !cfg.Auth.Sandbox {
+		return nil
+	}
+	if resp := s.sandboxPolicy(cfg).check(path); resp != nil {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
+
+// leadsInside reports whether path is still in one of the roots with its
+// symlinks followed. A path that doesn't exist is judged by the nearest
+// folder above it that does, as that is where opening it would look.
+func (p pathPolicy) leadsInside(path string) bool {
+	if sheet, _, ok := cue.SplitTrackPath(path); ok {
+		path = sheet
+	}
+	roots := p.roots
+	for _, root := range p.roots {
+		if real, err := filepath.EvalSymlinks(root); err == nil && real != root {
+			roots = append(roots[:len(roots):len(roots)], real)
+		}
+	}
+
+	for {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return inLibrary(real, roots)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// allowed returns the paths the policy lets through
+func (p pathPolicy) allowed(paths []string) []string {
+	var result []string
+	for _, path := range paths {
+		if p.check(path) == nil {
+			result = append(result, path)
+		}
+	}
+	return result
+}
+
+// checkLibraryChange returns an error response if libraryPaths adds a
+// folder to the library in sandbox mode, or nil. Folders can still be
+// removed; adding one takes an edit to the config file.
+func (s *Server) checkLibraryChange(libraryPaths []string) *Response {
+	cfg := s.configMgr.Get()
+	if !cfg.Auth.Sandbox {
+		return nil
+	}
+	current := make(map[string]bool, len(cfg.LibraryPaths))
+	for _, dir := range cfg.LibraryPaths {
+		current[filepath.Clean(dir)] = true
+	}
+	for _, dir := range libraryPaths {
+		if !current[filepath.Clean(dir)] {
+			resp := NewErrorResponse("library folders can't be added over IPC in sandbox mode: " + dir)
+			resp.Code = ErrCodePathNotAllowed
+			return resp
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package ipc
+
+import (
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/config"
+	"github.com/austinkregel/local-media/musicd/internal/scanner"
+)
+
+// scanOptions returns the scanner options for each configured library path.
+// In sandbox mode every library path is confined to itself.
+func scanOptions(cfg *config.Config) map[string]scanner.Options {
+	options := make(map[string]scanner.Options, len(cfg.LibraryScan))
+	for dir, opts := range cfg.LibraryScan {
+		options[dir] = scanner.Options{
+			Exclude:        opts.Exclude,
+			MinDuration:    time.Duration(opts.MinDurationMs) * time.Millisecond,
+			FollowSymlinks: opts.FollowSymlinks,
+			MaxDepth:       opts.MaxDepth,
+		}
+	}
+	if cfg.Auth.Sandbox {
+		for _, dir := range cfg.LibraryPaths {
+			opts := options[dir]
+			opts.Confined = true
+			options[dir] = opts
+		}
+	}
+	return options
+}
+
+// scanTuning returns how hard scans may work the machine
+func scanTuning(cfg *config.Config) scanner.Tuning {
+	return scanner.Tuning{
+		Workers:      cfg.Scanner.Workers,
+		NiceLevel:    cfg.Scanner.NiceLevel,
+		ProbeTimeout: time.Duration(cfg.Scanner.ProbeTimeoutMs) * time.Millisecond,
+	}
+}
+
+// toLibraryScanOptions converts configured scan options for the wire
+func toLibraryScanOptions(options map[string]config.ScanOptions) map[string]LibraryScanOptions {
+	result := make(map[string]LibraryScanOptions, len(options))
+	for dir, opts := range options {
+		result[dir] = LibraryScanOptions(opts)
+	}
+	return result
+}
+
+// fromLibraryScanOptions converts scan options from setConfig, dropping
+// paths whose options are all defaults
+func fromLibraryScanOptions(options map[string]LibraryScanOptions) map[string]config.ScanOptions {
+	var result map[string]config.ScanOptions
+	for dir, opts := range options {
+		cfgOpts := config.ScanOptions(opts)
+		if len(cfgOpts.Exclude) == 0 && cfgOpts.MinDurationMs == 0 && !cfgOpts.FollowSymlinks && cfgOpts.MaxDepth == 0 {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]config.ScanOptions)
+		}
+		result[dir] = cfgOpts
+	}
+	return result
+}
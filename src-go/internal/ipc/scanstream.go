@@ -0,0 +1,111 @@
+package ipc
+
+import (
+	"log"
+	"net"
+
+	"github.com/austinkregel/local-media/musicd/internal/scanner"
+)
+
+// handleSubscribeScanResults streams the files found by library scans to the
+// connection as "scanResults" pushes, in batches of up to scanner.BatchSize,
+// so the library can be shown before a long scan finishes
+func (s *Server) handleSubscribeScanResults(conn net.Conn) *Response {
+	s.scanSubsMu.Lock()
+	s.scanSubs[conn] = true
+	s.scanSubsMu.Unlock()
+
+	resp, _ := NewSuccessResponse(map[string]bool{"subscribed": true})
+	return resp
+}
+
+func (s *Server) handleUnsubscribeScanResults(conn net.Conn) *Response {
+	s.unsubscribeScanResults(conn)
+	resp, _ := NewSuccessResponse(map[string]bool{"subscribed": false})
+	return resp
+}
+
+// unsubscribeScanResults stops streaming scan results to a connection
+func (s *Server) unsubscribeScanResults(conn net.Conn) {
+	s.scanSubsMu.Lock()
+	delete(s.scanSubs, conn)
+	s.scanSubsMu.Unlock()
+}
+
+// pushScanBatch sends a batch of scanned files to subscribed clients
+func (s *Server) pushScanBatch(batch scanner.ScanBatch) {
+	s.scanSubsMu.Lock()
+	conns := make([]net.Conn, 0, len(s.scanSubs))
+	for conn := range s.scanSubs {
+		conns = append(conns, conn)
+	}
+	s.scanSubsMu.Unlock()
+	if len(conns) == 0 {
+		return
+	}
+
+	push := ScanResultsPush{
+		LibraryPath: batch.LibraryPath,
+		Files:       make([]ScanFileInfo, len(batch.Files)),
+		Discovered:  batch.Discovered,
+		Processed:   batch.Processed,
+		Unreadable:  batch.Unreadable,
+		Done:        batch.Done,
+	}
+	for i, f := range batch.Files {
+		push.Files[i] = toScanFileInfo(f)
+	}
+
+	msgBytes, err := NewPushMessage("scanResults", push)
+	if err != nil {
+		log.Printf("[IPC] Failed to encode scanResults push: %v", err)
+		return
+	}
+	msgBytes = append(msgBytes, '\n')
+
+	for _, conn := range conns {
+		if err := s.send(conn, msgBytes); err != nil {
+			log.Printf("[IPC] Failed to push scanResults to %s: %v", conn.RemoteAddr(), err)
+			s.unsubscribeScanResults(conn)
+		}
+	}
+}
+
+// toScanFileInfo converts a scanned file to its IPC form
+func toScanFileInfo(f scanner.FileInfo) ScanFileInfo {
+	fileInfo := ScanFileInfo{
+		Path:       f.Path,
+		Size:       f.Size,
+		ModifiedAt: f.ModifiedAt,
+		Cue:        toCueTrack(f.Cue),
+	}
+	// Include metadata if available
+	if f.Metadata != nil {
+		fileInfo.Metadata = &ScanFileMetadata{
+			Title:       f.Metadata.Title,
+			Artist:      f.Metadata.Artist,
+			Album:       f.Metadata.Album,
+			AlbumArtist: f.Metadata.AlbumArtist,
+			Composer:    f.Metadata.Composer,
+			Genre:       f.Metadata.Genre,
+			Year:        f.Metadata.Year,
+			TrackNumber: f.Metadata.TrackNumber,
+			DiscNumber:  f.Metadata.DiscNumber,
+			Duration:    f.Metadata.Duration,
+			Bitrate:     f.Metadata.Bitrate,
+
+			Work:           f.Metadata.Work,
+			Movement:       f.Metadata.Movement,
+			MovementNumber: f.Metadata.MovementNumber,
+		}
+	}
+	return fileInfo
+}
+
+func toCueTrack(t *scanner.CueTrack) *CueTrack {
+	if t == nil {
+		return nil
+	}
+	c := CueTrack(*t)
+	return &c
+}
@@ -0,0 +1,238 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/alarm"
+)
+
+const (
+	// scheduleCheckInterval is how often the scheduler looks for schedules
+	// due to start
+	scheduleCheckInterval = 15 * time.Second
+
+	// scheduleRadioSize is how many similar tracks a similarTo schedule
+	// queues; continue mode carries on from there
+	scheduleRadioSize = 25
+
+	// volumeRampStep is how often a schedule's volume ramp turns it up
+	volumeRampStep = 500 * time.Millisecond
+)
+
+// runSchedules starts each enabled schedule as its time comes round.
+// Schedules that came round while the daemon wasn't running are not made up.
+func (s *Server) runSchedules(ctx context.Context) {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due, err := s.schedules.Due(last, now)
+			if err != nil {
+				log.Printf("[SCHEDULE] Warning: failed to save schedules: %v", err)
+			}
+			last = now
+			// Of several due at once, the last one is left playing
+			for _, sch := range due {
+				if err := s.startSchedule(ctx, sch); err != nil {
+					log.Printf("[SCHEDULE] Schedule %d failed to start: %v", sch.ID, err)
+				}
+			}
+		}
+	}
+}
+
+// startSchedule plays what sch plays, bringing the volume up from silence
+// over its ramp
+func (s *Server) startSchedule(ctx context.Context, sch alarm.Schedule) error {
+	paths, err := s.scheduleTracks(sch)
+	if err != nil {
+		return err
+	}
+	log.Printf("[SCHEDULE] Starting schedule %d %q: %d tracks", sch.ID, sch.Name, len(paths))
+
+	ramp := time.Duration(sch.RampSeconds) * time.Second
+	start := sch.Volume
+	if ramp > 0 {
+		start = 0
+	}
+	if err := s.player.SetVolume(start); err != nil {
+		return fmt.Errorf("failed to set volume: %w", err)
+	}
+	if sch.SimilarTo != "" {
+		s.setContinueMode("similar")
+	}
+	if resp := s.playQueueItems(ctx, s.libraryQueueItems(paths)); resp != nil {
+		return fmt.Errorf("failed to play: %s", resp.Error)
+	}
+	if ramp > 0 {
+		go s.rampVolume(ctx, start, sch.Volume, ramp)
+	}
+
+	s.broadcastPush("scheduleStarted", toIPCSchedule(sch))
+	return nil
+}
+
+// rampVolume turns the volume from "from" up to "to" over d. It gives up if
+// the volume is changed some other way meanwhile, or another ramp starts.
+func (s *Server) rampVolume(ctx context.Context, from, to float64, d time.Duration) {
+	s.rampMu.Lock()
+	s.rampGen++
+	gen := s.rampGen
+	s.rampMu.Unlock()
+
+	ticker := time.NewTicker(volumeRampStep)
+	defer ticker.Stop()
+
+	started := time.Now()
+	level := from
+	for level != to {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.rampMu.Lock()
+		superseded := s.rampGen != gen
+		s.rampMu.Unlock()
+		if superseded || s.player.Volume() != level {
+			log.Printf("[SCHEDULE] Volume ramp stopped, volume was changed")
+			return
+		}
+
+		progress := min(float64(time.Since(started))/float64(d), 1)
+		level = from + (to-from)*progress
+		if err := s.player.SetVolume(level); err != nil {
+			log.Printf("[SCHEDULE] Volume ramp failed: %v", err)
+			return
+		}
+		if progress == 1 {
+			return
+		}
+	}
+}
+
+// scheduleTracks returns the tracks sch plays
+func (s *Server) scheduleTracks(sch alarm.Schedule) ([]string, error) {
+	var paths []string
+	switch {
+	case len(sch.Tracks) > 0:
+		paths = sch.Tracks
+	case sch.Playlist != "":
+		var err error
+		if paths, err = s.playlistTracks(sch.Playlist); err != nil {
+			return nil, err
+		}
+	case sch.SimilarTo != "":
+		if s.similarityEngine == nil {
+			return nil, fmt.Errorf("analysis not available")
+		}
+		paths = []string{sch.SimilarTo}
+		for _, edge := range s.similarityEngine.FindSimilar(sch.SimilarTo, scheduleRadioSize, nil) {
+			paths = append(paths, edge.TargetPath)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("nothing to play")
+	}
+	return paths, nil
+}
+
+// scheduleList returns the schedules as listSchedules reports them
+func (s *Server) scheduleList() ListSchedulesResponse {
+	result := ListSchedulesResponse{Schedules: []Schedule{}}
+	for _, sch := range s.schedules.List() {
+		result.Schedules = append(result.Schedules, toIPCSchedule(sch))
+	}
+	return result
+}
+
+func (s *Server) handleListSchedules() *Response {
+	resp, err := NewSuccessResponse(s.scheduleList())
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// handleSetSchedule adds a schedule, or changes the one with the given ID
+func (s *Server) handleSetSchedule(ctx context.Context, req *Request) *Response {
+	var schReq Schedule
+	if err := json.Unmarshal(req.Data, &schReq); err != nil {
+		return NewErrorResponse("invalid setSchedule request")
+	}
+
+	enabled := true
+	if schReq.Enabled != nil {
+		enabled = *schReq.Enabled
+	}
+	sch, err := s.schedules.Set(alarm.Schedule{
+		ID:          schReq.ID,
+		Name:        schReq.Name,
+		Time:        schReq.Time,
+		Days:        schReq.Days,
+		Playlist:    schReq.Playlist,
+		Tracks:      schReq.Tracks,
+		SimilarTo:   schReq.SimilarTo,
+		Volume:      schReq.Volume,
+		RampSeconds: schReq.RampSeconds,
+		Enabled:     enabled,
+	})
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	log.Printf("[SCHEDULE] Saved schedule %d at %s", sch.ID, sch.Time)
+
+	s.broadcastPushBy(actorFrom(ctx), "schedulesChanged", s.scheduleList())
+	return s.handleListSchedules()
+}
+
+func (s *Server) handleDeleteSchedule(ctx context.Context, req *Request) *Response {
+	var delReq DeleteScheduleRequest
+	if err := json.Unmarshal(req.Data, &delReq); err != nil || delReq.ID == 0 {
+		return NewErrorResponse("invalid deleteSchedule request")
+	}
+
+	deleted, err := s.schedules.Delete(delReq.ID)
+	if err != nil {
+		return NewErrorResponse(fmt.Sprintf("failed to save schedules: %v", err))
+	}
+	if !deleted {
+		return NewErrorResponse("unknown schedule")
+	}
+	log.Printf("[SCHEDULE] Deleted schedule %d", delReq.ID)
+
+	s.broadcastPushBy(actorFrom(ctx), "schedulesChanged", s.scheduleList())
+	return s.handleListSchedules()
+}
+
+// toIPCSchedule converts a schedule for the wire
+func toIPCSchedule(sch alarm.Schedule) Schedule {
+	enabled := sch.Enabled
+	result := Schedule{
+		ID:          sch.ID,
+		Name:        sch.Name,
+		Time:        sch.Time,
+		Days:        sch.Days,
+		Playlist:    sch.Playlist,
+		Tracks:      sch.Tracks,
+		SimilarTo:   sch.SimilarTo,
+		Volume:      sch.Volume,
+		RampSeconds: sch.RampSeconds,
+		Enabled:     &enabled,
+		LastRun:     sch.LastRun,
+	}
+	if next := sch.Next(time.Now()); sch.Enabled && !next.IsZero() {
+		result.NextRun = next.UnixMilli()
+	}
+	return result
+}
@@ -4,21 +4,33 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/austinkregel/local-media/musicd/internal/alarm"
 	"github.com/austinkregel/local-media/musicd/internal/analysis"
 	"github.com/austinkregel/local-media/musicd/internal/audio"
 	"github.com/austinkregel/local-media/musicd/internal/auth"
+	"github.com/austinkregel/local-media/musicd/internal/cache"
 	"github.com/austinkregel/local-media/musicd/internal/config"
+	"github.com/austinkregel/local-media/musicd/internal/focus"
+	"github.com/austinkregel/local-media/musicd/internal/identify"
+	"github.com/austinkregel/local-media/musicd/internal/library"
+	"github.com/austinkregel/local-media/musicd/internal/logging"
 	"github.com/austinkregel/local-media/musicd/internal/media"
+	"github.com/austinkregel/local-media/musicd/internal/podcast"
 	"github.com/austinkregel/local-media/musicd/internal/queue"
+	"github.com/austinkregel/local-media/musicd/internal/render"
 	"github.com/austinkregel/local-media/musicd/internal/scanner"
+	"github.com/austinkregel/local-media/musicd/internal/transcode"
 )
 
 // Server handles IPC communication with clients
@@ -30,21 +42,131 @@ type Server struct {
 	queueMgr        *queue.Manager
 	mediaSession    media.Session
 	libScanner      *scanner.Scanner
+	libraryIndex    *library.Index
+	ratings         *library.Ratings
+	quarantine      *library.Quarantine
+	introSkips      *library.IntroSkips
+
+	// Library health as of the last completed scan
+	libraryStatsMu sync.Mutex
+	libraryStats   *library.Stats
+	libraryStatsAt time.Time
+
+	// AcoustID client, recreated when the API key changes
+	acoustIDMu  sync.Mutex
+	acoustID    *identify.Client
+	acoustIDKey string
 	listener        net.Listener
+	inherited       bool // listener was passed in with SetListener
 	mu              sync.Mutex
-	clients         map[net.Conn]struct{}
+	clients         map[net.Conn]*connWriter
+	authedConns     map[net.Conn]*connClient // Connections that sent a valid token
+	nextConnID      uint64                   // Last connection ID handed out
 	advancingTrack  sync.Mutex // Prevents concurrent next/prev track calls
 	audioLogCounter int        // For throttled audio debug logging
 
 	// Audio data streaming (callback-based, no polling)
 	audioSubsMu sync.RWMutex
-	audioSubs   map[net.Conn]bool // Clients subscribed to audio data
+	audioSubs   map[net.Conn]*audioSubscriber // Clients subscribed to audio data
+
+	// Votes to skip the current track, by client ID
+	skipVotesMu   sync.Mutex
+	skipVotesPath string
+	skipVotes     map[string]bool
+
+	// Per-track gain offsets
+	trackGains *library.TrackGains
+
+	// Bookmarks within tracks
+	bookmarkStore *queue.BookmarkStore
+
+	// Play counts for smart shuffle
+	playCounts *queue.PlayCountStore
+
+	// Whether listening was in a rut when discovery shuffle last looked
+	rutMu        sync.Mutex
+	rut          bool
+	rutCheckedAt time.Time
+
+	// Serializes queue edits from clients (see checkQueueVersion)
+	queueEditMu sync.Mutex
+
+	// Local copies of tracks on slow storage
+	trackCache *cache.Cache
+
+	// Podcast subscriptions
+	podcasts *podcast.Manager
+
+	// Desktop notifications on track change
+	notifier media.Notifier
+
+	// Extra stores keyed by track path, updated when files move
+	relocatables map[string]Relocatable
+
+	// Daemon log access
+	logger    *logging.Logger
+	logSubsMu sync.Mutex
+	logSubs   map[net.Conn]func() // Connection -> unsubscribe
+
+	// Clients following scans with subscribeScanResults
+	scanSubsMu sync.Mutex
+	scanSubs   map[net.Conn]bool
 
 	// Audio analysis
 	analysisWorker   *analysis.Worker
+	analysisJobs     *analysis.JobStore
 	featureStore     *analysis.FeatureStore
 	similarityEngine *analysis.SimilarityEngine
 	communityDetector *analysis.CommunityDetector
+	mixGenerator     *analysis.MixGenerator
+	mixStore         *analysis.MixStore
+	mixMu            sync.Mutex // Serializes mix generation
+	weightLearner    *analysis.WeightLearner
+
+	// Numbers status snapshots for statusSince
+	statusRev *statusRevision
+
+	// Chromecast and UPnP devices playback can be sent to
+	renderers         *render.Manager
+	rendererSwitchMu  sync.Mutex // Serializes setRenderer
+	rendererMu        sync.Mutex // Guards the fields below
+	rendererID        string
+	renderersSearched bool
+
+	// Converts tracks for renderers, and cuts previews
+	transcoder *transcode.Transcoder
+
+	// Which tracks continue mode may add
+	continueMu     sync.Mutex
+	continueFilter library.RatingFilter
+
+	// Track played before the current one when the queue moved on to it, for
+	// learning from skips
+	transitionMu   sync.Mutex
+	transitionFrom string
+
+	// Timed focus sessions, and what the running one changed
+	focusTimer       *focus.Timer
+	focusMu          sync.Mutex
+	focusRestore     *focusRestore
+	onFocusLevelling func()
+
+	// Playback profile last switched to, and the last one the schedule
+	// switched to
+	profileMu        sync.Mutex
+	activeProfile    string
+	scheduledProfile string
+
+	// Scheduled playback, and the volume ramp of the last one started
+	schedules *alarm.Store
+	rampMu    sync.Mutex
+	rampGen   uint64
+
+	// What a simulated player is timed by, nil unless simulating
+	simClock *audio.ManualClock
+
+	// musicd's caches, where sandbox mode allows files besides the library
+	sandboxDirs []string
 }
 
 // NewServer creates a new IPC server
@@ -57,12 +179,7 @@ func NewServer(
 	mediaSession media.Session,
 ) (*Server, error) {
 	// Initialize feature store
-	cfg := configMgr.Get()
-	dataDir := cfg.DataDir
-	if dataDir == "" {
-		homeDir, _ := os.UserHomeDir()
-		dataDir = homeDir + "/.local-media"
-	}
+	dataDir := configMgr.Get().DataPath()
 
 	featureStore, err := analysis.NewFeatureStore(dataDir)
 	if err != nil {
@@ -72,9 +189,46 @@ func NewServer(
 
 	var similarityEngine *analysis.SimilarityEngine
 	var communityDetector *analysis.CommunityDetector
+	var analysisJobs *analysis.JobStore
+	var mixGenerator *analysis.MixGenerator
+	var mixStore *analysis.MixStore
+	var weightLearner *analysis.WeightLearner
 	if featureStore != nil {
 		similarityEngine = analysis.NewSimilarityEngine(featureStore)
 		communityDetector = analysis.NewCommunityDetector(featureStore, similarityEngine)
+		analysisJobs = analysis.NewJobStore(dataDir)
+		if err := analysisJobs.Load(); err != nil {
+			log.Printf("[ANALYSIS] Warning: Could not load analysis job: %v", err)
+		}
+		mixGenerator = analysis.NewMixGenerator(featureStore)
+		mixStore = analysis.NewMixStore(dataDir)
+		if err := mixStore.Load(); err != nil {
+			log.Printf("[ANALYSIS] Warning: Could not load daily mixes: %v", err)
+		}
+		weightLearner = analysis.NewWeightLearner(dataDir)
+		if err := weightLearner.Load(); err != nil {
+			log.Printf("[ANALYSIS] Warning: Could not load learned weights: %v", err)
+		}
+		similarityEngine.SetWeights(weightLearner.Weights())
+	}
+
+	ratings := library.NewRatings(dataDir)
+	if err := ratings.Load(); err != nil {
+		log.Printf("[SCANNER] Warning: Could not load ratings: %v", err)
+	}
+	libraryIndex := library.NewIndex()
+	libraryIndex.SetRatings(ratings)
+	quarantine := library.NewQuarantine(dataDir)
+	if err := quarantine.Load(); err != nil {
+		log.Printf("[SCANNER] Warning: Could not load quarantine: %v", err)
+	}
+	introSkips := library.NewIntroSkips(dataDir)
+	if err := introSkips.Load(); err != nil {
+		log.Printf("[SCANNER] Warning: Could not load intro skips: %v", err)
+	}
+	schedules := alarm.NewStore(dataDir)
+	if err := schedules.Load(); err != nil {
+		log.Printf("[SCHEDULE] Warning: Could not load schedules: %v", err)
 	}
 
 	s := &Server{
@@ -85,31 +239,85 @@ func NewServer(
 		queueMgr:          queueMgr,
 		mediaSession:      mediaSession,
 		libScanner:        scanner.NewScanner(),
-		clients:           make(map[net.Conn]struct{}),
-		audioSubs:         make(map[net.Conn]bool),
+		libraryIndex:      libraryIndex,
+		ratings:           ratings,
+		quarantine:        quarantine,
+		introSkips:        introSkips,
+		schedules:         schedules,
+		clients:           make(map[net.Conn]*connWriter),
+		authedConns:       make(map[net.Conn]*connClient),
+		audioSubs:         make(map[net.Conn]*audioSubscriber),
+		logSubs:           make(map[net.Conn]func()),
+		scanSubs:          make(map[net.Conn]bool),
 		featureStore:      featureStore,
+		analysisJobs:      analysisJobs,
 		similarityEngine:  similarityEngine,
 		communityDetector: communityDetector,
-	}
+		mixGenerator:      mixGenerator,
+		mixStore:          mixStore,
+		weightLearner:     weightLearner,
+		statusRev:         newStatusRevision(),
+		renderers:         render.NewManager(),
+		rendererID:        localRendererID,
+	}
+	queueMgr.SetShuffleWeight(s.shuffleWeight)
+	s.focusTimer = focus.NewTimer(s.endFocusSession)
 	
+	// Let approved clients know when someone is waiting for approval
+	authManager.SetOnPairingRequest(func(client auth.ClientInfo) {
+		log.Printf("[AUTH] Client %q (ID: %s) is waiting for approval", client.Name, client.ID)
+		s.broadcastPush("pairingRequest", toIPCClientInfo(client))
+	})
+
+	// Scans leave the CPU to playback
+	s.libScanner.SetIsPlayingFunc(func() bool {
+		return s.player.Status().State == "playing"
+	})
+
+	// Keep the search index in step with the library
+	s.libScanner.SetOnComplete(func(results []scanner.ScanResult, metadata *scanner.LibraryMetadata) {
+		s.libraryIndex.Build(library.TracksFromScan(results, metadata))
+		log.Printf("[SCANNER] Search index rebuilt: %d tracks", s.libraryIndex.Len())
+		s.recordLibraryStats(results, metadata)
+		s.quarantineFromScan(results)
+		s.reconcileMovedFiles(results)
+	})
+
+	// Stream files to subscribed clients as scans find them
+	s.libScanner.SetOnBatch(s.pushScanBatch)
+
 	// Register callback for real-time audio data push (no polling!)
-	player.SetAudioCallback(func(bands []uint8) {
-		s.pushAudioDataImmediate(bands)
+	player.SetAudioCallback(func(frame audio.AudioFrame) {
+		s.pushAudioDataImmediate(frame)
 	})
 	
 	// Set up callbacks for queue management
 	player.SetOnTrackEnd(func(finishedPath string) {
 		log.Printf("[QUEUE] Track ended: %s, advancing to next", finishedPath)
-		s.playNextTrack()
+		s.queueMgr.AddToRecentlyPlayed(finishedPath)
+		s.learnFromAdvance(finishedPath, false)
+		s.playNextTrack(trackChangeEnded)
 	})
 	
+	player.SetNextTrackProvider(s.upcomingTrack)
+	player.SetOnTrackEnding(s.notifyTrackEnding)
+
+	player.SetOnDecodeError(func(path string, err error) {
+		s.pushPlaybackError(path, err)
+		s.quarantineIfUnreadable(path, err)
+	})
+
 	player.SetOnNext(func() {
 		log.Printf("[QUEUE] Next track requested via OS media controls")
-		s.playNextTrack()
+		status := s.player.Status()
+		s.learnFromAdvance(status.Path, isSkip(status))
+		s.forgetTransition()
+		s.playNextTrack(trackChangeNext)
 	})
 	
 	player.SetOnPrevious(func() {
 		log.Printf("[QUEUE] Previous track requested via OS media controls")
+		s.forgetTransition()
 		s.playPrevTrack()
 	})
 
@@ -138,22 +346,118 @@ func NewServer(
 	return s, nil
 }
 
-// playNextTrack advances to the next track in the queue and starts playing
-func (s *Server) playNextTrack() {
+// upcomingLookahead is how far down the queue upcomingTrack looks past
+// quarantined tracks
+const upcomingLookahead = 10
+
+const (
+	// playbackRetryDelay is how long the "retry" onPlaybackError setting
+	// waits before trying a track again
+	playbackRetryDelay = time.Second
+
+	// maxSkippedTracks is how many tracks in a row auto-advance skips for
+	// failing to play before it stops
+	maxSkippedTracks = 10
+)
+
+// Reasons given in trackChanged pushes
+const (
+	trackChangeEnded    = "ended"    // The previous track finished
+	trackChangeNext     = "next"     // Skipped forward
+	trackChangePrevious = "previous" // Went back
+	trackChangeJump     = "jump"     // Jumped to a queue position
+	trackChangePlay     = "play"     // A track was played directly
+)
+
+// playNextTrack advances to the next track in the queue and starts playing.
+// reason is passed on to clients in the trackChanged push. Tracks that fail
+// to play are handled as the onPlaybackError setting says.
+func (s *Server) playNextTrack(reason string) {
 	// Serialize track advancement to prevent concurrent calls from causing issues
 	s.advancingTrack.Lock()
 	defer s.advancingTrack.Unlock()
 
-	nextPath, nextMeta := s.queueMgr.Next()
-	if nextPath == "" {
-		log.Printf("[QUEUE] No more tracks in queue")
+	policy := s.configMgr.Get().Behavior.OnPlaybackError
+
+	// Skip quarantined tracks and ones that fail to play, but give up after
+	// going round the queue once or too many failures in a row, e.g. when
+	// looping a queue of nothing but broken files
+	_, size := s.queueMgr.Position()
+	failures := 0
+	for attempt := 0; attempt <= size; attempt++ {
+		nextPath, nextMeta := s.queueMgr.Next()
+		if nextPath == "" && s.continueQueue() {
+			nextPath, nextMeta = s.queueMgr.Next()
+		}
+		if nextPath == "" {
+			log.Printf("[QUEUE] No more tracks in queue")
+			return
+		}
+		if s.quarantine.Contains(nextPath) {
+			log.Printf("[QUEUE] Skipping quarantined track: %s", nextPath)
+			continue
+		}
+
+		log.Printf("[QUEUE] Playing next track: %s", nextPath)
+		err := s.player.Play(context.Background(), nextPath, (*audio.TrackMetadata)(nextMeta))
+		if err != nil && policy == "retry" {
+			log.Printf("[QUEUE] Failed to play next track, retrying: %v", err)
+			time.Sleep(playbackRetryDelay)
+			err = s.player.Play(context.Background(), nextPath, (*audio.TrackMetadata)(nextMeta))
+		}
+		if err != nil {
+			log.Printf("[QUEUE] Failed to play next track: %v", err)
+			code := s.pushPlaybackError(nextPath, err)
+			s.quarantineIfUnreadable(nextPath, err)
+
+			// Every track would fail the same way while the device is taken
+			if policy == "stop" || code == ErrCodeDeviceBusy {
+				return
+			}
+			if failures++; failures >= maxSkippedTracks {
+				log.Printf("[QUEUE] Stopping after %d unplayable tracks in a row", failures)
+				return
+			}
+			log.Printf("[QUEUE] Skipping unplayable track: %s", nextPath)
+			s.broadcastPush("trackSkipped", TrackSkippedPush{Path: nextPath, Code: code})
+			continue
+		}
+		s.notifyTrackChanged(context.Background(), reason)
 		return
 	}
+	log.Printf("[QUEUE] No playable tracks left in queue")
+}
+
+// upcomingTrack returns the track playNextTrack will most likely play, so
+// the player can get it ready ahead of time
+func (s *Server) upcomingTrack() (string, *audio.TrackMetadata) {
+	if s.queueMgr.GetRepeat() == queue.RepeatOne {
+		path, meta := s.queueMgr.Current()
+		return path, (*audio.TrackMetadata)(meta)
+	}
+	for _, item := range s.queueMgr.Upcoming(upcomingLookahead) {
+		if !s.quarantine.Contains(item.Path) {
+			return item.Path, (*audio.TrackMetadata)(item.Metadata)
+		}
+	}
+	return "", nil
+}
 
-	log.Printf("[QUEUE] Playing next track: %s", nextPath)
-	if err := s.player.Play(context.Background(), nextPath, (*audio.TrackMetadata)(nextMeta)); err != nil {
-		log.Printf("[QUEUE] Failed to play next track: %v", err)
+// notifyTrackEnding pushes the track expected next as the current one nears
+// its end
+func (s *Server) notifyTrackEnding(path string, remainingMs int64) {
+	push := TrackEndingPush{Path: path, RemainingMs: remainingMs}
+	if nextPath, nextMeta := s.upcomingTrack(); nextPath != "" {
+		next := toIPCTrackMetadata(nextMeta)
+		if next == nil {
+			next = &TrackMetadata{}
+		}
+		if next.ArtPath == "" && !audio.IsStreamURL(nextPath) {
+			next.ArtPath = audio.FindAlbumArt(nextPath)
+		}
+		push.NextPath, push.Next = nextPath, next
 	}
+	s.broadcastPush("trackEnding", push)
 }
 
 // playPrevTrack goes to the previous track in the queue and starts playing
@@ -171,36 +475,76 @@ func (s *Server) playPrevTrack() {
 	log.Printf("[QUEUE] Playing previous track: %s", prevPath)
 	if err := s.player.Play(context.Background(), prevPath, (*audio.TrackMetadata)(prevMeta)); err != nil {
 		log.Printf("[QUEUE] Failed to play previous track: %v", err)
+		s.pushPlaybackError(prevPath, err)
+		s.quarantineIfUnreadable(prevPath, err)
+		return
 	}
+	s.notifyTrackChanged(context.Background(), trackChangePrevious)
 }
 
-// Start starts the IPC server
-func (s *Server) Start(ctx context.Context) error {
-	// Remove existing socket file if it exists
-	if err := os.RemoveAll(s.socketPath); err != nil {
-		return fmt.Errorf("failed to remove existing socket: %w", err)
-	}
+// notifyTrackChanged pushes the new track and queue position to clients so
+// they don't have to wait for their next status poll
+func (s *Server) notifyTrackChanged(ctx context.Context, reason string) {
+	status := s.player.Status()
+	index, size := s.queueMgr.Position()
+	by := actorFrom(ctx)
 
-	log.Printf("[IPC] Creating socket at %s", s.socketPath)
+	push := TrackChangedPush{
+		Path:     status.Path,
+		Metadata: toIPCTrackMetadata(status.Metadata),
+		Duration: status.Duration,
+		Reason:   reason,
+	}
+	if item, ok := s.queueMgr.CurrentItem(); ok && item.Path == status.Path {
+		push.Recommendation = item.Recommendation
+	}
+	s.broadcastPushBy(by, "trackChanged", push)
+	s.broadcastPushBy(by, "queueIndexChanged", QueueIndexChangedPush{Index: index, Size: size})
+	s.notifyDesktop(status)
+}
 
-	// Create Unix socket listener
-	listener, err := net.Listen("unix", s.socketPath)
-	if err != nil {
-		return fmt.Errorf("failed to listen on socket: %w", err)
+// toIPCTrackMetadata converts player metadata for the wire
+func toIPCTrackMetadata(m *audio.TrackMetadata) *TrackMetadata {
+	if m == nil {
+		return nil
 	}
-	s.listener = listener
+	return &TrackMetadata{
+		Title:    m.Title,
+		Artist:   m.Artist,
+		Album:    m.Album,
+		Duration: m.Duration,
+		ArtPath:  m.ArtPath,
+	}
+}
 
-	// Set socket permissions (user-only)
-	if err := os.Chmod(s.socketPath, 0600); err != nil {
-		listener.Close()
-		return fmt.Errorf("failed to set socket permissions: %w", err)
+// SetListener has Start accept connections on l, such as a socket passed in
+// by the service manager, rather than creating the socket itself. The socket
+// file then belongs to whoever created it and is left in place on shutdown.
+func (s *Server) SetListener(l net.Listener) {
+	s.listener = l
+	s.inherited = true
+}
+
+// Start starts the IPC server
+func (s *Server) Start(ctx context.Context) error {
+	if s.inherited {
+		log.Printf("[IPC] Using socket passed in at %s", s.listener.Addr())
+	} else if err := s.createSocket(); err != nil {
+		return err
 	}
+	listener := s.listener
 
 	log.Printf("[IPC] Server listening, waiting for connections...")
 
 	// Accept connections in background
 	go s.acceptLoop(ctx)
 
+	if s.mixStore != nil {
+		go s.scheduleDailyMixes(ctx, audio.SystemClock{})
+	}
+	go s.scheduleProfiles(ctx)
+	go s.runSchedules(ctx)
+
 	// Audio data is now pushed via callback (no timer-based streaming)
 
 	// Wait for context cancellation
@@ -211,21 +555,61 @@ func (s *Server) Start(ctx context.Context) error {
 	// Cleanup
 	s.mu.Lock()
 	clientCount := len(s.clients)
-	for conn := range s.clients {
-		conn.Close()
+	for _, w := range s.clients {
+		w.close()
 	}
 	s.mu.Unlock()
 
 	log.Printf("[IPC] Closed %d client connections", clientCount)
 
+	// Save analysis progress so the run resumes on the next start
+	if s.analysisWorker != nil {
+		s.analysisWorker.Stop()
+	}
+	if s.featureStore != nil {
+		if err := s.featureStore.Close(); err != nil {
+			log.Printf("[ANALYSIS] Warning: failed to save feature store: %v", err)
+		}
+	}
+
+	if err := s.renderers.Close(); err != nil {
+		log.Printf("[RENDER] Failed to stop media server: %v", err)
+	}
+
 	listener.Close()
-	os.RemoveAll(s.socketPath)
+	if !s.inherited {
+		os.RemoveAll(s.socketPath)
+	}
 
 	log.Printf("[IPC] Server stopped")
 
 	return nil
 }
 
+// createSocket replaces any stale socket file with a new user-only socket
+func (s *Server) createSocket() error {
+	// Remove existing socket file if it exists
+	if err := os.RemoveAll(s.socketPath); err != nil {
+		return fmt.Errorf("failed to remove existing socket: %w", err)
+	}
+
+	log.Printf("[IPC] Creating socket at %s", s.socketPath)
+
+	// Create Unix socket listener
+	listener, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on socket: %w", err)
+	}
+
+	// Set socket permissions (user-only)
+	if err := os.Chmod(s.socketPath, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	s.listener = listener
+	return nil
+}
+
 func (s *Server) acceptLoop(ctx context.Context) {
 	for {
 		conn, err := s.listener.Accept()
@@ -243,7 +627,7 @@ func (s *Server) acceptLoop(ctx context.Context) {
 		log.Printf("[IPC] New client connection from %s", remoteAddr)
 
 		s.mu.Lock()
-		s.clients[conn] = struct{}{}
+		s.clients[conn] = newConnWriter(conn)
 		clientCount := len(s.clients)
 		s.mu.Unlock()
 
@@ -258,19 +642,25 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
 	
 	defer func() {
 		log.Printf("[IPC] Client disconnected: %s", remoteAddr)
-		conn.Close()
 		s.mu.Lock()
+		if w, ok := s.clients[conn]; ok {
+			w.close()
+		}
 		delete(s.clients, conn)
+		delete(s.authedConns, conn)
 		clientCount := len(s.clients)
 		s.mu.Unlock()
 		// Remove from audio subscribers
 		s.audioSubsMu.Lock()
 		delete(s.audioSubs, conn)
 		s.audioSubsMu.Unlock()
+		s.unsubscribeLogs(conn)
+		s.unsubscribeScanResults(conn)
 		log.Printf("[IPC] Active clients: %d", clientCount)
 	}()
 
 	reader := bufio.NewReader(conn)
+	limiter := newRateLimiter(requestRate, requestBurst)
 
 	for {
 		select {
@@ -279,8 +669,17 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
 		default:
 		}
 
-		// Read line (newline-delimited JSON)
-		line, err := reader.ReadBytes('\n')
+		// Read line (newline-delimited JSON), refusing oversized requests
+		line, err := readLine(reader, maxRequestBytes)
+		if err == errRequestTooLarge {
+			log.Printf("[IPC] Request from %s exceeds %d bytes, discarded", remoteAddr, maxRequestBytes)
+			resp := NewErrorResponse("request too large")
+			resp.Code = ErrCodeRequestTooLarge
+			if err := s.sendResponse(conn, resp); err != nil {
+				return
+			}
+			continue
+		}
 		if err != nil {
 			if err != io.EOF {
 				log.Printf("[IPC] Read error from %s: %v", remoteAddr, err)
@@ -288,6 +687,14 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
 			return
 		}
 
+		// Throttle clients that flood the daemon
+		if ok, retryAfter := limiter.allow(time.Now()); !ok {
+			if err := s.sendResponse(conn, NewRateLimitedResponse(retryAfter)); err != nil {
+				return
+			}
+			continue
+		}
+
 		// Parse request
 		req, err := DecodeRequest(line)
 		if err != nil {
@@ -297,14 +704,16 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
 		}
 
 		// Skip verbose logging for frequent polling commands
-		isPollingCmd := req.Cmd == CmdStatus || req.Cmd == CmdGetScanStatus || req.Cmd == CmdGetAudioData
+		isPollingCmd := req.Cmd == CmdStatus || req.Cmd == CmdStatusSince || req.Cmd == CmdGetScanStatus || req.Cmd == CmdGetAudioData || req.Cmd == CmdGetMetrics
 
 		if !isPollingCmd {
 			log.Printf("[IPC] Command: %s", req.Cmd)
 		}
 
 		// Handle request (pass conn for subscription commands)
+		start := time.Now()
 		resp := s.handleRequest(ctx, conn, req)
+		observeRequest(req.Cmd, resp, start)
 
 		if !isPollingCmd {
 			if resp.Success {
@@ -335,11 +744,58 @@ func (s *Server) handleRequest(ctx context.Context, conn net.Conn, req *Request)
 		return s.handlePair(req)
 	}
 
-	// All other commands require authentication
-	if !s.authManager.ValidateToken(req.Token) {
+	// All other commands require an approved client
+	client, err := s.authManager.CheckToken(req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrPendingApproval):
+			return NewErrorResponse("pending approval")
+		case errors.Is(err, auth.ErrTokenExpired):
+			return NewErrorResponse("token expired")
+		}
 		return NewErrorResponse("unauthorized")
 	}
 
+	// ...with the scope the command needs
+	scope, ok := requiredScope(req.Cmd)
+	if !ok {
+		log.Printf("[AUTH] Client %s sent unknown command %s", client.ID, req.Cmd)
+		return NewErrorResponse("unknown command")
+	}
+	if scope != "" && !client.HasScope(scope) {
+		log.Printf("[AUTH] Client %s lacks scope %q for %s", client.ID, scope, req.Cmd)
+		return NewErrorResponse(fmt.Sprintf("permission denied: %s requires scope %q", req.Cmd, scope))
+	}
+
+	if resp := checkPartyRequest(client, req); resp != nil {
+		return resp
+	}
+
+	// ...and data that passes the checks every command shares
+	if resp := validateRequest(req, s.pathPolicy(client)); resp != nil {
+		log.Printf("[IPC] Rejected %s from client %s: %s", req.Cmd, client.ID, resp.Error)
+		return resp
+	}
+
+	by := s.trackConnection(conn, client)
+	ctx = withActor(ctx, by)
+	ctx = withVolumeLimit(ctx, client)
+
+	// Queue edits run one at a time so ifVersion holds until the edit is done
+	if queueEditCommands[req.Cmd] {
+		s.queueEditMu.Lock()
+		defer s.queueEditMu.Unlock()
+		if resp := s.checkQueueVersion(req); resp != nil {
+			return resp
+		}
+		before := s.queueMgr.Version()
+		defer func() {
+			if after := s.queueMgr.Version(); after != before {
+				s.broadcastPushBy(by, "queueChanged", QueueChangedPush{Version: after, Command: string(req.Cmd)})
+			}
+		}()
+	}
+
 	switch req.Cmd {
 	case CmdPlay:
 		return s.handlePlay(ctx, req)
@@ -354,13 +810,19 @@ func (s *Server) handleRequest(ctx context.Context, conn net.Conn, req *Request)
 	case CmdPrev:
 		return s.handlePrev(ctx)
 	case CmdQueue:
-		return s.handleQueue(req)
+		return s.handleQueue(ctx, req)
+	case CmdVoteSkip:
+		return s.handleVoteSkip(ctx)
 	case CmdSeek:
 		return s.handleSeek(req)
 	case CmdVolume:
-		return s.handleVolume(req)
+		return s.handleVolume(ctx, req)
+	case CmdAdjustVolume:
+		return s.handleAdjustVolume(ctx, req)
 	case CmdStatus:
 		return s.handleStatus()
+	case CmdStatusSince:
+		return s.handleStatusSince(ctx, req)
 	case CmdGetConfig:
 		return s.handleGetConfig()
 	case CmdSetConfig:
@@ -369,6 +831,118 @@ func (s *Server) handleRequest(ctx context.Context, conn net.Conn, req *Request)
 		return s.handleScanLibrary(ctx)
 	case CmdGetScanStatus:
 		return s.handleGetScanStatus()
+	case CmdSubscribeScanResults:
+		return s.handleSubscribeScanResults(conn)
+	case CmdUnsubscribeScanResults:
+		return s.handleUnsubscribeScanResults(conn)
+	case CmdLibrarySearch:
+		return s.handleLibrarySearch(req)
+	case CmdLibraryGetGenres:
+		return s.handleLibraryGetGenres()
+	case CmdLibraryGetYears:
+		return s.handleLibraryGetYears()
+	case CmdLibraryGetTracks:
+		return s.handleLibraryGetTracks(req)
+	case CmdLibraryGetComposers:
+		return s.handleLibraryGetComposers()
+	case CmdLibraryGetWorks:
+		return s.handleLibraryGetWorks(req)
+	case CmdLibraryGetMovements:
+		return s.handleLibraryGetMovements(req)
+	case CmdFindDuplicates:
+		return s.handleFindDuplicates(req)
+	case CmdLibraryStats:
+		return s.handleLibraryStats()
+	case CmdGetDiscoveryStats:
+		return s.handleGetDiscoveryStats(req)
+	case CmdGetQuarantine:
+		return s.handleGetQuarantine()
+	case CmdRetryQuarantined:
+		return s.handleRetryQuarantined(req)
+	case CmdIdentifyTrack:
+		return s.handleIdentifyTrack(ctx, req)
+	case CmdSetTrackTags:
+		return s.handleSetTrackTags(ctx, req)
+	case CmdSetRating:
+		return s.handleSetRating(ctx, req)
+	case CmdToggleFavorite:
+		return s.handleToggleFavorite(ctx, req)
+	case CmdSetIntroSkip:
+		return s.handleSetIntroSkip(req)
+	case CmdDuck:
+		return s.handleDuck(req)
+	case CmdAnnounce:
+		return s.handleAnnounce(req)
+	case CmdStartFocusSession:
+		return s.handleStartFocusSession(ctx, req)
+	case CmdStopFocusSession:
+		return s.handleStopFocusSession()
+	case CmdGetFocusSession:
+		return s.handleGetFocusSession()
+	case CmdListProfiles:
+		return s.handleListProfiles()
+	case CmdSetProfile:
+		return s.handleSetProfile(ctx, req)
+	case CmdListSchedules:
+		return s.handleListSchedules()
+	case CmdSetSchedule:
+		return s.handleSetSchedule(ctx, req)
+	case CmdDeleteSchedule:
+		return s.handleDeleteSchedule(ctx, req)
+	case CmdExportSync:
+		return s.handleExportSync()
+	case CmdImportSync:
+		return s.handleImportSync(ctx, req)
+	case CmdInterpret:
+		return s.handleInterpret(ctx, req)
+	case CmdRelocateLibrary:
+		return s.handleRelocateLibrary(ctx, req)
+	case CmdCacheTrack:
+		return s.handleCacheTrack(ctx, req)
+	case CmdAddBookmark:
+		return s.handleAddBookmark(req)
+	case CmdListBookmarks:
+		return s.handleListBookmarks(req)
+	case CmdRemoveBookmark:
+		return s.handleRemoveBookmark(req)
+	case CmdJumpToBookmark:
+		return s.handleJumpToBookmark(ctx, req)
+	case CmdGetTrackGain:
+		return s.handleGetTrackGain(req)
+	case CmdSetTrackGain:
+		return s.handleSetTrackGain(req)
+	case CmdListZones:
+		return s.handleListZones()
+	case CmdEnableZone:
+		return s.handleEnableZone(req)
+	case CmdSetZoneVolume:
+		return s.handleSetZoneVolume(req)
+	case CmdGetDSPChain:
+		return s.handleGetDSPChain()
+	case CmdSetDSPChain:
+		return s.handleSetDSPChain(ctx, req)
+	case CmdListRenderers:
+		return s.handleListRenderers(ctx, req)
+	case CmdSetRenderer:
+		return s.handleSetRenderer(ctx, req)
+	case CmdListStations:
+		return s.handleListStations()
+	case CmdSaveStation:
+		return s.handleSaveStation(req)
+	case CmdRemoveStation:
+		return s.handleRemoveStation(req)
+	case CmdPodcastSubscribe:
+		return s.handlePodcastSubscribe(ctx, req)
+	case CmdPodcastUnsubscribe:
+		return s.handlePodcastUnsubscribe(req)
+	case CmdPodcastList:
+		return s.handlePodcastList()
+	case CmdPodcastGetEpisodes:
+		return s.handlePodcastGetEpisodes(req)
+	case CmdPodcastMarkPlayed:
+		return s.handlePodcastMarkPlayed(req)
+	case CmdPodcastDownload:
+		return s.handlePodcastDownload(ctx, req)
 	case CmdGetQueue:
 		return s.handleGetQueue()
 	case CmdSetRepeat:
@@ -381,21 +955,43 @@ func (s *Server) handleRequest(ctx context.Context, conn net.Conn, req *Request)
 		return s.handleQueueRemove(req)
 	case CmdQueueMove:
 		return s.handleQueueMove(req)
+	case CmdQueueUndo:
+		return s.handleQueueUndo()
+	case CmdQueueRedo:
+		return s.handleQueueRedo()
+	case CmdPlayPath:
+		return s.handlePlayPath(ctx, req)
+	case CmdQueueRemoveRange:
+		return s.handleQueueRemoveRange(req)
+	case CmdQueueRemoveByPaths:
+		return s.handleQueueRemoveByPaths(req)
+	case CmdQueueDeduplicate:
+		return s.handleQueueDeduplicate()
+	case CmdQueueShuffleRemaining:
+		return s.handleQueueShuffleRemaining()
+	case CmdQueueSmartOrder:
+		return s.handleQueueSmartOrder()
 	case CmdGetAudioData:
 		return s.handleGetAudioData()
 	case CmdSubscribeAudioData:
-		return s.handleSubscribeAudioData(conn)
+		return s.handleSubscribeAudioData(conn, req)
 	case CmdUnsubscribeAudioData:
 		return s.handleUnsubscribeAudioData(conn)
+	case CmdConfigureAudioData:
+		return s.handleConfigureAudioData(conn, req)
 	// Analysis commands
 	case CmdGetAnalysisStatus:
 		return s.handleGetAnalysisStatus()
+	case CmdGetAnalysisCoverage:
+		return s.handleGetAnalysisCoverage()
 	case CmdStartAnalysis:
-		return s.handleStartAnalysis()
+		return s.handleStartAnalysis(ctx)
 	case CmdPauseAnalysis:
 		return s.handlePauseAnalysis()
 	case CmdResumeAnalysis:
 		return s.handleResumeAnalysis()
+	case CmdCancelAnalysis:
+		return s.handleCancelAnalysis()
 	case CmdRebuildGraph:
 		return s.handleRebuildGraph()
 	// Similarity commands
@@ -413,6 +1009,56 @@ func (s *Server) handleRequest(ctx context.Context, conn net.Conn, req *Request)
 		return s.handleSetContinueMode(req)
 	case CmdGetContinueMode:
 		return s.handleGetContinueMode()
+	case CmdGetWaveform:
+		return s.handleGetWaveform(req)
+	case CmdGetPreview:
+		return s.handleGetPreview(ctx, req)
+	case CmdPreviewPlay:
+		return s.handlePreviewPlay(req)
+	case CmdPreviewStop:
+		return s.handlePreviewStop()
+	case CmdGetTrackFeatures:
+		return s.handleGetTrackFeatures(req)
+	case CmdGetFeatureDistribution:
+		return s.handleGetFeatureDistribution(req)
+	case CmdGetSmartPlaylist:
+		return s.handleGetSmartPlaylist(req)
+	case CmdGetDailyMixes:
+		return s.handleGetDailyMixes(req)
+	case CmdGetLearnedWeights:
+		return s.handleGetLearnedWeights(req)
+	case CmdResetLearnedWeights:
+		return s.handleResetLearnedWeights()
+	// Client management commands
+	case CmdListClients:
+		return s.handleListClients()
+	case CmdApproveClient:
+		return s.handleApproveClient(req)
+	case CmdRevokeClient:
+		return s.handleRevokeClient(req)
+	case CmdSetClientScopes:
+		return s.handleSetClientScopes(req)
+	case CmdSetClientMaxVolume:
+		return s.handleSetClientMaxVolume(req)
+	case CmdRefreshToken:
+		return s.handleRefreshToken(req)
+	case CmdGetConnectedClients:
+		return s.handleGetConnectedClients(conn)
+	// Log commands
+	case CmdGetLogs:
+		return s.handleGetLogs(req)
+	case CmdSubscribeLogs:
+		return s.handleSubscribeLogs(conn, req)
+	case CmdUnsubscribeLogs:
+		return s.handleUnsubscribeLogs(conn)
+	case CmdGetMetrics:
+		return s.handleGetMetrics()
+	case CmdGetMemoryStats:
+		return s.handleGetMemoryStats()
+	case CmdDumpState:
+		return s.handleDumpState()
+	case CmdAdvanceClock:
+		return s.handleAdvanceClock(req)
 	default:
 		return NewErrorResponse("unknown command")
 	}
@@ -428,7 +1074,15 @@ func (s *Server) handlePair(req *Request) *Response {
 
 	log.Printf("[AUTH] Pairing request from client: %q", pairReq.ClientName)
 
-	token, clientID, requiresApproval, err := s.authManager.Pair(pairReq.ClientName)
+	var scopes []auth.Scope
+	if pairReq.Scopes != nil {
+		var err error
+		if scopes, err = auth.ParseScopes(pairReq.Scopes); err != nil {
+			return NewErrorResponse(err.Error())
+		}
+	}
+
+	token, clientID, requiresApproval, err := s.authManager.PairWithScopes(pairReq.ClientName, scopes)
 	if err != nil {
 		log.Printf("[AUTH] Pairing failed: %v", err)
 		return NewErrorResponse(err.Error())
@@ -436,10 +1090,16 @@ func (s *Server) handlePair(req *Request) *Response {
 
 	log.Printf("[AUTH] Paired client %s (ID: %s, approval required: %v)", pairReq.ClientName, clientID, requiresApproval)
 
+	var expiresAt int64
+	if client, err := s.authManager.GetClient(clientID); err == nil {
+		expiresAt = unixMilliOrZero(client.ExpiresAt)
+	}
+
 	resp, err := NewSuccessResponse(PairResponse{
 		Token:            token,
 		ClientID:         clientID,
 		RequiresApproval: requiresApproval,
+		ExpiresAt:        expiresAt,
 	})
 	if err != nil {
 		return NewErrorResponse("internal error")
@@ -461,6 +1121,7 @@ func (s *Server) handlePlay(ctx context.Context, req *Request) *Response {
 	}
 
 	log.Printf("[PLAYER] Play request: %s", playReq.Path)
+	s.forgetTransition()
 
 	// Check if this path is in the queue
 	queueItems := s.queueMgr.GetItems()
@@ -496,8 +1157,9 @@ func (s *Server) handlePlay(ctx context.Context, req *Request) *Response {
 
 	if err := s.player.Play(ctx, playReq.Path, metadata); err != nil {
 		log.Printf("[PLAYER] Play failed: %v", err)
-		return NewErrorResponse(err.Error())
+		return s.playbackFailed(playReq.Path, err)
 	}
+	s.notifyTrackChanged(ctx, trackChangePlay)
 
 	log.Printf("[PLAYER] Now playing: %s", playReq.Path)
 	return s.handleStatus()
@@ -535,7 +1197,22 @@ func (s *Server) handleStop() *Response {
 
 func (s *Server) handleNext(ctx context.Context) *Response {
 	log.Printf("[PLAYER] Next track requested")
-	path, metadata := s.queueMgr.Next()
+	status := s.player.Status()
+	s.learnFromAdvance(status.Path, isSkip(status))
+	s.forgetTransition()
+
+	// Skip quarantined tracks, but only once round the queue
+	var path string
+	var metadata *queue.TrackMetadata
+	_, size := s.queueMgr.Position()
+	for attempt := 0; attempt <= size; attempt++ {
+		path, metadata = s.queueMgr.Next()
+		if path == "" || !s.quarantine.Contains(path) {
+			break
+		}
+		log.Printf("[QUEUE] Skipping quarantined track: %s", path)
+		path = ""
+	}
 	if path == "" {
 		log.Printf("[PLAYER] No next track in queue")
 		return NewErrorResponse("no next track")
@@ -554,14 +1231,17 @@ func (s *Server) handleNext(ctx context.Context) *Response {
 	}
 
 	if err := s.player.Play(ctx, path, audioMeta); err != nil {
-		return NewErrorResponse(err.Error())
+		return s.playbackFailed(path, err)
 	}
+	s.notifyTrackChanged(ctx, trackChangeNext)
 
 	return s.handleStatus()
 }
 
 func (s *Server) handlePrev(ctx context.Context) *Response {
 	log.Printf("[PLAYER] Previous track requested")
+	s.forgetTransition()
+
 	path, metadata := s.queueMgr.Prev()
 	if path == "" {
 		log.Printf("[PLAYER] No previous track in queue")
@@ -581,13 +1261,14 @@ func (s *Server) handlePrev(ctx context.Context) *Response {
 	}
 
 	if err := s.player.Play(ctx, path, audioMeta); err != nil {
-		return NewErrorResponse(err.Error())
+		return s.playbackFailed(path, err)
 	}
+	s.notifyTrackChanged(ctx, trackChangePrevious)
 
 	return s.handleStatus()
 }
 
-func (s *Server) handleQueue(req *Request) *Response {
+func (s *Server) handleQueue(ctx context.Context, req *Request) *Response {
 	var queueReq QueueRequest
 	if err := json.Unmarshal(req.Data, &queueReq); err != nil {
 		return NewErrorResponse("invalid queue request")
@@ -595,10 +1276,14 @@ func (s *Server) handleQueue(req *Request) *Response {
 
 	log.Printf("[QUEUE] Queue request: %d items, append=%v", len(queueReq.Items), queueReq.Append)
 
-	// Convert to queue items
+	// Convert to queue items, noting who added them for fair queuing
+	var addedBy string
+	if by := actorFrom(ctx); by != nil {
+		addedBy = by.ClientID
+	}
 	var queueItems []queue.QueueItem
 	for _, item := range queueReq.Items {
-		qi := queue.QueueItem{Path: item.Path}
+		qi := queue.QueueItem{Path: item.Path, AddedBy: addedBy}
 		if item.Metadata != nil {
 			qi.Metadata = &queue.TrackMetadata{
 				Title:    item.Metadata.Title,
@@ -631,22 +1316,27 @@ func (s *Server) handleSeek(req *Request) *Response {
 	}
 
 	log.Printf("[PLAYER] Seek to position: %dms", seekReq.Position)
-	if err := s.player.Seek(seekReq.Position); err != nil {
+	if err := s.player.SeekTo(seekReq.Position); err != nil {
 		log.Printf("[PLAYER] Seek failed: %v", err)
 		return NewErrorResponse(err.Error())
 	}
+	s.statusRev.bump()
 
 	return s.handleStatus()
 }
 
-func (s *Server) handleVolume(req *Request) *Response {
+func (s *Server) handleVolume(ctx context.Context, req *Request) *Response {
 	var volReq VolumeRequest
 	if err := json.Unmarshal(req.Data, &volReq); err != nil {
 		return NewErrorResponse("invalid volume request")
 	}
+	if volReq.Level < 0 || volReq.Level > 1 {
+		return NewErrorResponse("volume must be between 0.0 and 1.0")
+	}
 
-	log.Printf("[PLAYER] Set volume to: %.2f", volReq.Level)
-	if err := s.player.SetVolume(volReq.Level); err != nil {
+	level := limitVolume(ctx, volReq.Level, s.player.Volume())
+	log.Printf("[PLAYER] Set volume to: %.2f", level)
+	if err := s.player.SetVolume(level); err != nil {
 		log.Printf("[PLAYER] Volume change failed: %v", err)
 		return NewErrorResponse(err.Error())
 	}
@@ -654,21 +1344,65 @@ func (s *Server) handleVolume(req *Request) *Response {
 	return s.handleStatus()
 }
 
+// SetTrackGains enables the getTrackGain and setTrackGain commands
+func (s *Server) SetTrackGains(gains *library.TrackGains) {
+	s.trackGains = gains
+}
+
+func (s *Server) handleGetTrackGain(req *Request) *Response {
+	if s.trackGains == nil {
+		return NewErrorResponse("track gain not available")
+	}
+	var gainReq TrackGainRequest
+	if err := json.Unmarshal(req.Data, &gainReq); err != nil || gainReq.Path == "" {
+		return NewErrorResponse("invalid track gain request")
+	}
+
+	resp, err := NewSuccessResponse(TrackGainResponse{
+		Path:   gainReq.Path,
+		GainDb: s.trackGains.Get(gainReq.Path),
+	})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleSetTrackGain(req *Request) *Response {
+	if s.trackGains == nil {
+		return NewErrorResponse("track gain not available")
+	}
+	var gainReq TrackGainRequest
+	if err := json.Unmarshal(req.Data, &gainReq); err != nil || gainReq.Path == "" {
+		return NewErrorResponse("invalid track gain request")
+	}
+
+	log.Printf("[PLAYER] Set track gain to %+.1fdB: %s", gainReq.GainDb, gainReq.Path)
+	if err := s.trackGains.Set(gainReq.Path, gainReq.GainDb); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	s.player.RefreshTrackGain(gainReq.Path)
+
+	resp, err := NewSuccessResponse(TrackGainResponse{
+		Path:   gainReq.Path,
+		GainDb: gainReq.GainDb,
+	})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
 func (s *Server) handleStatus() *Response {
+	return s.statusResponse(s.currentStatus())
+}
+
+// currentStatus gathers player and queue state, numbered with the status
+// revision
+func (s *Server) currentStatus() StatusResponse {
 	status := s.player.Status()
 	queueIdx, queueSize := s.queueMgr.Position()
 
-	var metadata *TrackMetadata
-	if status.Metadata != nil {
-		metadata = &TrackMetadata{
-			Title:    status.Metadata.Title,
-			Artist:   status.Metadata.Artist,
-			Album:    status.Metadata.Album,
-			Duration: status.Metadata.Duration,
-			ArtPath:  status.Metadata.ArtPath,
-		}
-	}
-
 	// Get repeat mode as string
 	repeatMode := "off"
 	switch s.queueMgr.GetRepeat() {
@@ -679,22 +1413,31 @@ func (s *Server) handleStatus() *Response {
 	}
 
 	statusResp := StatusResponse{
-		State:      string(status.State),
-		Path:       status.Path,
-		Position:   status.Position,
-		Duration:   status.Duration,
-		Volume:     status.Volume,
-		Metadata:   metadata,
-		QueueIndex: queueIdx,
-		QueueSize:  queueSize,
-		RepeatMode: repeatMode,
-		Shuffle:    s.queueMgr.GetShuffle(),
-	}
+		State:       string(status.State),
+		Path:        status.Path,
+		Position:    status.Position,
+		Duration:    status.Duration,
+		Volume:      status.Volume,
+		Metadata:    toIPCTrackMetadata(status.Metadata),
+		QueueIndex:  queueIdx,
+		QueueSize:   queueSize,
+		RepeatMode:  repeatMode,
+		Shuffle:     s.queueMgr.GetShuffle(),
+		ShuffleMode: s.queueMgr.GetShuffleMode().String(),
+		Renderer:    s.activeRendererID(),
+
+		Buffering:   status.Buffering,
+		StreamTitle: status.StreamTitle,
+	}
+	statusResp.Revision = s.statusRev.observe(statusResp)
+	return statusResp
+}
 
+func (s *Server) statusResponse(statusResp StatusResponse) *Response {
 	// Log status details if playing or paused
-	if status.State != "stopped" {
+	if statusResp.State != "stopped" {
 		log.Printf("[PLAYER] Status: state=%s pos=%dms dur=%dms path=%s",
-			status.State, status.Position, status.Duration, truncateForLog(status.Path, 50))
+			statusResp.State, statusResp.Position, statusResp.Duration, truncateForLog(statusResp.Path, 50))
 	}
 
 	resp, err := NewSuccessResponse(statusResp)
@@ -740,18 +1483,8 @@ func (s *Server) handleGetAudioData() *Response {
 
 func (s *Server) handleGetConfig() *Response {
 	log.Printf("[CONFIG] Get config requested")
-	cfg := s.configMgr.Get()
 
-	resp, err := NewSuccessResponse(ConfigResponse{
-		ConfigPath:       s.configMgr.GetPath(),
-		LibraryPaths:     cfg.LibraryPaths,
-		SampleRate:       cfg.Audio.SampleRate,
-		BufferSizeMs:     cfg.Audio.BufferSizeMs,
-		DefaultVolume:    cfg.Audio.DefaultVolume,
-		ResumeOnStart:    cfg.Behavior.ResumeOnStart,
-		RememberQueue:    cfg.Behavior.RememberQueue,
-		RememberPosition: cfg.Behavior.RememberPosition,
-	})
+	resp, err := NewSuccessResponse(s.configResponse())
 	if err != nil {
 		return NewErrorResponse("internal error")
 	}
@@ -759,6 +1492,96 @@ func (s *Server) handleGetConfig() *Response {
 	return resp
 }
 
+func (s *Server) configResponse() ConfigResponse {
+	cfg := s.configMgr.Get()
+	return ConfigResponse{
+		ConfigPath:             s.configMgr.GetPath(),
+		LibraryPaths:           cfg.LibraryPaths,
+		SampleRate:             cfg.Audio.SampleRate,
+		BufferSizeMs:           cfg.Audio.BufferSizeMs,
+		BitDepth:               cfg.Audio.BitDepth,
+		Resampler:              cfg.Audio.Resampler,
+		DefaultVolume:          cfg.Audio.DefaultVolume,
+		VolumeCurve:            cfg.Audio.VolumeCurve,
+		FadeMs:                 cfg.Audio.FadeMs,
+		Mono:                   cfg.Audio.Mono,
+		Balance:                cfg.Audio.Balance,
+		SwapChannels:           cfg.Audio.SwapChannels,
+		LevelVolume:            cfg.Audio.LevelVolume,
+		TargetLufs:             cfg.Audio.TargetLufs,
+		DuckLevel:              cfg.Audio.DuckLevel,
+		AutoDuck:               cfg.Audio.AutoDuck,
+		PauseOnDeviceLoss:      cfg.Audio.PauseOnDeviceLoss,
+		ResumeOnDeviceReturn:   cfg.Audio.ResumeOnDeviceReturn,
+		PreviewVolume:          cfg.Audio.PreviewVolume,
+		ResumeOnStart:          cfg.Behavior.ResumeOnStart,
+		RememberQueue:          cfg.Behavior.RememberQueue,
+		RememberPosition:       cfg.Behavior.RememberPosition,
+		ResumeThresholdMinutes: cfg.Behavior.ResumeThresholdMinutes,
+		ResumePlayback:         cfg.Behavior.ResumePlayback,
+		LogLevel:               cfg.Logging.Level,
+		ScanWorkers:            cfg.Scanner.Workers,
+		ScanNiceLevel:          cfg.Scanner.NiceLevel,
+		ScanProbeTimeoutMs:     cfg.Scanner.ProbeTimeoutMs,
+		TrimSilence:            cfg.Behavior.TrimSilence,
+		SilenceThresholdDb:     cfg.Behavior.SilenceThresholdDb,
+		TrackEndingSeconds:     cfg.Behavior.TrackEndingSeconds,
+		NotificationsEnabled:   cfg.Notifications.Enabled,
+		IdleTimeoutMinutes:     cfg.Behavior.IdleTimeoutMinutes,
+		OnPlaybackError:        cfg.Behavior.OnPlaybackError,
+		DiscoveryShuffle:       cfg.Behavior.DiscoveryShuffle,
+		VoteSkipPercent:        cfg.Party.VoteSkipPercent,
+		FairQueue:              cfg.Party.FairQueue,
+		LibraryScan:            toLibraryScanOptions(cfg.LibraryScan),
+		Output:                 s.outputFormat(),
+	}
+}
+
+// outputFormat reports the format the player's output was opened with
+func (s *Server) outputFormat() OutputFormat {
+	format := s.player.OutputFormat()
+	return OutputFormat{
+		SampleRate: format.SampleRate,
+		Channels:   format.Channels,
+		BitDepth:   format.BitDepth,
+		Resampler:  format.Resampler,
+	}
+}
+
+// NotifyConfigChanged pushes the current configuration to every authenticated
+// client as a configChanged event
+func (s *Server) NotifyConfigChanged() {
+	s.broadcastPush("configChanged", s.configResponse())
+}
+
+// NotifyDeviceLost pushes a deviceLost event when the output device audio
+// was playing on goes away
+func (s *Server) NotifyDeviceLost(device string, paused bool) {
+	s.broadcastPush("deviceLost", DeviceLostPush{Device: device, Paused: paused})
+}
+
+// NotifyDeviceReturned pushes a deviceReturned event when a lost output
+// device comes back
+func (s *Server) NotifyDeviceReturned(device string, resumed bool) {
+	s.broadcastPush("deviceReturned", DeviceReturnedPush{Device: device, Resumed: resumed})
+}
+
+// NotifyPreviewEnded pushes a previewEnded event when a track on the preview
+// channel plays to its end
+func (s *Server) NotifyPreviewEnded(path string) {
+	s.broadcastPush("previewEnded", PreviewEndedPush{Path: path})
+}
+
+// NotifyMediaSession pushes a mediaSessionChanged event when OS media
+// integration is lost, so media keys stop working, and when it comes back
+func (s *Server) NotifyMediaSession(available bool, err error) {
+	push := MediaSessionChangedPush{Available: available}
+	if err != nil {
+		push.Error = err.Error()
+	}
+	s.broadcastPush("mediaSessionChanged", push)
+}
+
 func (s *Server) handleScanLibrary(ctx context.Context) *Response {
 	cfg := s.configMgr.Get()
 
@@ -777,6 +1600,8 @@ func (s *Server) handleScanLibrary(ctx context.Context) *Response {
 	log.Printf("[SCANNER] Starting async library scan for %d paths: %v", len(cfg.LibraryPaths), cfg.LibraryPaths)
 
 	// Start async scan - returns immediately
+	s.libScanner.SetPathOptions(scanOptions(cfg))
+	s.libScanner.SetTuning(scanTuning(cfg))
 	started := s.libScanner.ScanPathsAsync(ctx, cfg.LibraryPaths, true)
 	if !started {
 		return NewErrorResponse("failed to start scan")
@@ -810,21 +1635,7 @@ func (s *Server) handleGetScanStatus() *Response {
 		for _, sr := range results {
 			files := make([]ScanFileInfo, 0, len(sr.Files))
 			for _, f := range sr.Files {
-				fileInfo := ScanFileInfo{
-					Path:       f.Path,
-					Size:       f.Size,
-					ModifiedAt: f.ModifiedAt,
-				}
-				// Include metadata if available
-				if f.Metadata != nil {
-					fileInfo.Metadata = &ScanFileMetadata{
-						Title:    f.Metadata.Title,
-						Artist:   f.Metadata.Artist,
-						Album:    f.Metadata.Album,
-						Duration: f.Metadata.Duration,
-					}
-				}
-				files = append(files, fileInfo)
+				files = append(files, toScanFileInfo(f))
 			}
 
 			ipcResults = append(ipcResults, ScanResult{
@@ -912,10 +1723,17 @@ func (s *Server) handleSetConfig(req *Request) *Response {
 		return NewErrorResponse("invalid config request")
 	}
 
-	cfg := s.configMgr.Get()
+	// Work on a copy so a rejected request leaves the running config untouched
+	cfg := *s.configMgr.Get()
 
 	// Update fields if provided
 	if cfgReq.LibraryPaths != nil {
+		if err := config.ValidateLibraryPaths(*cfgReq.LibraryPaths); err != nil {
+			return NewErrorResponse(err.Error())
+		}
+		if resp := s.checkLibraryChange(*cfgReq.LibraryPaths); resp != nil {
+			return resp
+		}
 		cfg.LibraryPaths = *cfgReq.LibraryPaths
 	}
 	if cfgReq.SampleRate != nil {
@@ -924,9 +1742,51 @@ func (s *Server) handleSetConfig(req *Request) *Response {
 	if cfgReq.BufferSizeMs != nil {
 		cfg.Audio.BufferSizeMs = *cfgReq.BufferSizeMs
 	}
+	if cfgReq.BitDepth != nil {
+		cfg.Audio.BitDepth = *cfgReq.BitDepth
+	}
+	if cfgReq.Resampler != nil {
+		cfg.Audio.Resampler = *cfgReq.Resampler
+	}
 	if cfgReq.DefaultVolume != nil {
 		cfg.Audio.DefaultVolume = *cfgReq.DefaultVolume
 	}
+	if cfgReq.VolumeCurve != nil {
+		cfg.Audio.VolumeCurve = *cfgReq.VolumeCurve
+	}
+	if cfgReq.FadeMs != nil {
+		cfg.Audio.FadeMs = *cfgReq.FadeMs
+	}
+	if cfgReq.Mono != nil {
+		cfg.Audio.Mono = *cfgReq.Mono
+	}
+	if cfgReq.Balance != nil {
+		cfg.Audio.Balance = *cfgReq.Balance
+	}
+	if cfgReq.SwapChannels != nil {
+		cfg.Audio.SwapChannels = *cfgReq.SwapChannels
+	}
+	if cfgReq.LevelVolume != nil {
+		cfg.Audio.LevelVolume = *cfgReq.LevelVolume
+	}
+	if cfgReq.TargetLufs != nil {
+		cfg.Audio.TargetLufs = *cfgReq.TargetLufs
+	}
+	if cfgReq.DuckLevel != nil {
+		cfg.Audio.DuckLevel = *cfgReq.DuckLevel
+	}
+	if cfgReq.AutoDuck != nil {
+		cfg.Audio.AutoDuck = *cfgReq.AutoDuck
+	}
+	if cfgReq.PauseOnDeviceLoss != nil {
+		cfg.Audio.PauseOnDeviceLoss = *cfgReq.PauseOnDeviceLoss
+	}
+	if cfgReq.ResumeOnDeviceReturn != nil {
+		cfg.Audio.ResumeOnDeviceReturn = *cfgReq.ResumeOnDeviceReturn
+	}
+	if cfgReq.PreviewVolume != nil {
+		cfg.Audio.PreviewVolume = *cfgReq.PreviewVolume
+	}
 	if cfgReq.ResumeOnStart != nil {
 		cfg.Behavior.ResumeOnStart = *cfgReq.ResumeOnStart
 	}
@@ -936,9 +1796,61 @@ func (s *Server) handleSetConfig(req *Request) *Response {
 	if cfgReq.RememberPosition != nil {
 		cfg.Behavior.RememberPosition = *cfgReq.RememberPosition
 	}
+	if cfgReq.ResumeThresholdMinutes != nil {
+		cfg.Behavior.ResumeThresholdMinutes = *cfgReq.ResumeThresholdMinutes
+	}
+	if cfgReq.ResumePlayback != nil {
+		cfg.Behavior.ResumePlayback = *cfgReq.ResumePlayback
+	}
+	if cfgReq.TrimSilence != nil {
+		cfg.Behavior.TrimSilence = *cfgReq.TrimSilence
+	}
+	if cfgReq.SilenceThresholdDb != nil {
+		cfg.Behavior.SilenceThresholdDb = *cfgReq.SilenceThresholdDb
+	}
+	if cfgReq.TrackEndingSeconds != nil {
+		cfg.Behavior.TrackEndingSeconds = *cfgReq.TrackEndingSeconds
+	}
+	if cfgReq.NotificationsEnabled != nil {
+		cfg.Notifications.Enabled = *cfgReq.NotificationsEnabled
+	}
+	if cfgReq.IdleTimeoutMinutes != nil {
+		cfg.Behavior.IdleTimeoutMinutes = *cfgReq.IdleTimeoutMinutes
+	}
+	if cfgReq.OnPlaybackError != nil {
+		cfg.Behavior.OnPlaybackError = *cfgReq.OnPlaybackError
+	}
+	if cfgReq.DiscoveryShuffle != nil {
+		cfg.Behavior.DiscoveryShuffle = *cfgReq.DiscoveryShuffle
+	}
+	if cfgReq.VoteSkipPercent != nil {
+		cfg.Party.VoteSkipPercent = *cfgReq.VoteSkipPercent
+	}
+	if cfgReq.FairQueue != nil {
+		cfg.Party.FairQueue = *cfgReq.FairQueue
+	}
+	if cfgReq.LogLevel != nil {
+		cfg.Logging.Level = *cfgReq.LogLevel
+	}
+	if cfgReq.ScanWorkers != nil {
+		cfg.Scanner.Workers = *cfgReq.ScanWorkers
+	}
+	if cfgReq.ScanNiceLevel != nil {
+		cfg.Scanner.NiceLevel = *cfgReq.ScanNiceLevel
+	}
+	if cfgReq.ScanProbeTimeoutMs != nil {
+		cfg.Scanner.ProbeTimeoutMs = *cfgReq.ScanProbeTimeoutMs
+	}
+	if cfgReq.LibraryScan != nil {
+		cfg.LibraryScan = fromLibraryScanOptions(*cfgReq.LibraryScan)
+	}
 
-	// Save the updated config
-	if err := s.configMgr.Update(cfg); err != nil {
+	// Validate and save the updated config
+	if err := s.configMgr.Update(&cfg); err != nil {
+		var fieldErr *config.FieldError
+		if errors.As(err, &fieldErr) {
+			return NewErrorResponse(fmt.Sprintf("invalid config: %v", err))
+		}
 		log.Printf("[CONFIG] Failed to save config: %v", err)
 		return NewErrorResponse(fmt.Sprintf("failed to save config: %v", err))
 	}
@@ -950,13 +1862,24 @@ func (s *Server) handleSetConfig(req *Request) *Response {
 func (s *Server) handleGetQueue() *Response {
 	log.Printf("[QUEUE] Get queue requested")
 
-	items := s.queueMgr.GetItems()
-	idx, _ := s.queueMgr.Position()
-
-	// Convert to IPC format
+	resp, err := NewSuccessResponse(s.queueState())
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// queueState returns the queue as getQueue reports it
+func (s *Server) queueState() GetQueueResponse {
+	// Read the version first so a concurrent edit makes it look older, not newer
+	version := s.queueMgr.Version()
+	items := s.queueMgr.GetItems()
+	idx, _ := s.queueMgr.Position()
+
+	// Convert to IPC format
 	ipcItems := make([]QueueItem, len(items))
 	for i, item := range items {
-		ipcItems[i] = QueueItem{Path: item.Path}
+		ipcItems[i] = QueueItem{ID: item.ID, Path: item.Path, AddedBy: item.AddedBy, Recommendation: item.Recommendation}
 		if item.Metadata != nil {
 			ipcItems[i].Metadata = &TrackMetadata{
 				Title:    item.Metadata.Title,
@@ -977,16 +1900,18 @@ func (s *Server) handleGetQueue() *Response {
 		repeatMode = "all"
 	}
 
-	resp, err := NewSuccessResponse(GetQueueResponse{
-		Items:      ipcItems,
-		Index:      idx,
-		RepeatMode: repeatMode,
-		Shuffle:    s.queueMgr.GetShuffle(),
-	})
-	if err != nil {
-		return NewErrorResponse("internal error")
+	undoSteps, redoSteps := s.queueMgr.HistorySize()
+
+	return GetQueueResponse{
+		Items:       ipcItems,
+		Index:       idx,
+		Version:     version,
+		RepeatMode:  repeatMode,
+		Shuffle:     s.queueMgr.GetShuffle(),
+		ShuffleMode: s.queueMgr.GetShuffleMode().String(),
+		CanUndo:     undoSteps > 0,
+		CanRedo:     redoSteps > 0,
 	}
-	return resp
 }
 
 func (s *Server) handleSetRepeat(req *Request) *Response {
@@ -1027,11 +1952,20 @@ func (s *Server) handleSetShuffle(req *Request) *Response {
 		return NewErrorResponse("invalid setShuffle request")
 	}
 
-	log.Printf("[QUEUE] Set shuffle to: %v", shuffleReq.Enabled)
-	s.queueMgr.SetShuffle(shuffleReq.Enabled)
+	if shuffleReq.Mode == "" {
+		log.Printf("[QUEUE] Set shuffle to: %v", shuffleReq.Enabled)
+		s.queueMgr.SetShuffle(shuffleReq.Enabled)
+	} else {
+		mode, err := queue.ParseShuffleMode(shuffleReq.Mode)
+		if err != nil {
+			return NewErrorResponse(err.Error())
+		}
+		log.Printf("[QUEUE] Set shuffle mode to: %s", shuffleReq.Mode)
+		s.queueMgr.SetShuffleMode(mode)
+	}
 
 	// Update OS media session
-	if err := s.player.UpdateShuffle(shuffleReq.Enabled); err != nil {
+	if err := s.player.UpdateShuffle(s.queueMgr.GetShuffle()); err != nil {
 		log.Printf("[QUEUE] Failed to update media session shuffle: %v", err)
 	}
 
@@ -1044,11 +1978,18 @@ func (s *Server) handleQueueJump(ctx context.Context, req *Request) *Response {
 		return NewErrorResponse("invalid queueJump request")
 	}
 
-	log.Printf("[QUEUE] Jump to index: %d", jumpReq.Index)
-
-	if !s.queueMgr.SetIndex(jumpReq.Index) {
-		return NewErrorResponse("invalid queue index")
+	if jumpReq.ID != 0 {
+		log.Printf("[QUEUE] Jump to item: %d", jumpReq.ID)
+		if !s.queueMgr.JumpToID(jumpReq.ID) {
+			return NewErrorResponse("unknown queue item")
+		}
+	} else {
+		log.Printf("[QUEUE] Jump to index: %d", jumpReq.Index)
+		if !s.queueMgr.SetIndex(jumpReq.Index) {
+			return NewErrorResponse("invalid queue index")
+		}
 	}
+	s.forgetTransition()
 
 	// Get the current item and start playing it
 	path, metadata := s.queueMgr.Current()
@@ -1068,8 +2009,9 @@ func (s *Server) handleQueueJump(ctx context.Context, req *Request) *Response {
 	}
 
 	if err := s.player.Play(ctx, path, audioMeta); err != nil {
-		return NewErrorResponse(err.Error())
+		return s.playbackFailed(path, err)
 	}
+	s.notifyTrackChanged(ctx, trackChangeJump)
 
 	return s.handleStatus()
 }
@@ -1080,6 +2022,14 @@ func (s *Server) handleQueueRemove(req *Request) *Response {
 		return NewErrorResponse("invalid queueRemove request")
 	}
 
+	if removeReq.ID != 0 {
+		log.Printf("[QUEUE] Remove item: %d", removeReq.ID)
+		if !s.queueMgr.RemoveID(removeReq.ID) {
+			return NewErrorResponse("unknown queue item")
+		}
+		return s.handleStatus()
+	}
+
 	log.Printf("[QUEUE] Remove item at index: %d", removeReq.Index)
 
 	if !s.queueMgr.Remove(removeReq.Index) {
@@ -1095,6 +2045,17 @@ func (s *Server) handleQueueMove(req *Request) *Response {
 		return NewErrorResponse("invalid queueMove request")
 	}
 
+	if moveReq.ID != 0 || moveReq.ToID != 0 {
+		if moveReq.ID == 0 || moveReq.ToID == 0 {
+			return NewErrorResponse("queueMove by ID needs both id and toId")
+		}
+		log.Printf("[QUEUE] Move item %d to item %d", moveReq.ID, moveReq.ToID)
+		if !s.queueMgr.MoveID(moveReq.ID, moveReq.ToID) {
+			return NewErrorResponse("unknown queue item")
+		}
+		return s.handleStatus()
+	}
+
 	log.Printf("[QUEUE] Move item from %d to %d", moveReq.FromIndex, moveReq.ToIndex)
 
 	if !s.queueMgr.Move(moveReq.FromIndex, moveReq.ToIndex) {
@@ -1104,32 +2065,285 @@ func (s *Server) handleQueueMove(req *Request) *Response {
 	return s.handleStatus()
 }
 
+func (s *Server) handleQueueUndo() *Response {
+	log.Printf("[QUEUE] Undo requested")
+
+	if !s.queueMgr.Undo() {
+		return NewErrorResponse("nothing to undo")
+	}
+
+	return s.handleGetQueue()
+}
+
+func (s *Server) handleQueueRedo() *Response {
+	log.Printf("[QUEUE] Redo requested")
+
+	if !s.queueMgr.Redo() {
+		return NewErrorResponse("nothing to redo")
+	}
+
+	return s.handleGetQueue()
+}
+
+func (s *Server) handleQueueRemoveRange(req *Request) *Response {
+	var rangeReq QueueRemoveRangeRequest
+	if err := json.Unmarshal(req.Data, &rangeReq); err != nil {
+		return NewErrorResponse("invalid queueRemoveRange request")
+	}
+	if rangeReq.Start < 0 || rangeReq.End <= rangeReq.Start {
+		return NewErrorResponse("invalid queue range")
+	}
+
+	removed := s.queueMgr.RemoveRange(rangeReq.Start, rangeReq.End)
+	log.Printf("[QUEUE] Removed %d items in range [%d, %d)", removed, rangeReq.Start, rangeReq.End)
+
+	return s.handleGetQueue()
+}
+
+func (s *Server) handleQueueRemoveByPaths(req *Request) *Response {
+	var pathsReq QueueRemoveByPathsRequest
+	if err := json.Unmarshal(req.Data, &pathsReq); err != nil {
+		return NewErrorResponse("invalid queueRemoveByPaths request")
+	}
+
+	removed := s.queueMgr.RemoveByPaths(pathsReq.Paths)
+	log.Printf("[QUEUE] Removed %d items matching %d paths", removed, len(pathsReq.Paths))
+
+	return s.handleGetQueue()
+}
+
+func (s *Server) handleQueueDeduplicate() *Response {
+	removed := s.queueMgr.Deduplicate()
+	log.Printf("[QUEUE] Deduplicated queue, removed %d items", removed)
+
+	return s.handleGetQueue()
+}
+
+func (s *Server) handleQueueShuffleRemaining() *Response {
+	log.Printf("[QUEUE] Shuffling remaining items")
+	s.queueMgr.ShuffleRemaining()
+
+	return s.handleGetQueue()
+}
+
+func (s *Server) handleQueueSmartOrder() *Response {
+	if s.similarityEngine == nil {
+		return NewErrorResponse("analysis not available")
+	}
+
+	items := s.queueMgr.GetItems()
+	features := make(map[string]*analysis.StoredFeatures, len(items))
+	for _, item := range items {
+		if f, ok := s.featureStore.GetFeatures(item.Path); ok {
+			features[item.Path] = f
+		}
+	}
+
+	// Unanalyzed tracks are as far as possible from everything, so they
+	// drift towards the end
+	reordered := s.queueMgr.SmartOrder(func(from, to string) float64 {
+		a, okA := features[from]
+		b, okB := features[to]
+		if !okA || !okB {
+			return 1
+		}
+		return float64(s.similarityEngine.TransitionDistance(a, b))
+	})
+	log.Printf("[QUEUE] Smart ordered remaining items (%d analyzed of %d, reordered: %v)", len(features), len(items), reordered)
+
+	return s.handleGetQueue()
+}
+
+// writerFor returns the connection's writer, or nil once it has disconnected
+func (s *Server) writerFor(conn net.Conn) *connWriter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clients[conn]
+}
+
+// send queues raw message bytes for delivery to a connection
+func (s *Server) send(conn net.Conn, msg []byte) error {
+	w := s.writerFor(conn)
+	if w == nil {
+		return errWriterClosed
+	}
+	return w.send(msg)
+}
+
 func (s *Server) sendResponse(conn net.Conn, resp *Response) error {
 	data, err := EncodeResponse(resp)
 	if err != nil {
 		return err
 	}
 	data = append(data, '\n')
-	_, err = conn.Write(data)
-	return err
+	return s.send(conn, data)
 }
 
 func (s *Server) sendError(conn net.Conn, msg string) {
 	s.sendResponse(conn, NewErrorResponse(msg))
 }
 
+// broadcastPush sends a push message to every authenticated connection
+func (s *Server) broadcastPush(msgType string, data interface{}) {
+	s.broadcastPushBy(nil, msgType, data)
+}
+
+// broadcastPushBy is broadcastPush for an event a client's command caused
+func (s *Server) broadcastPushBy(by *ClientRef, msgType string, data interface{}) {
+	msgBytes, err := NewPushMessageBy(msgType, data, by)
+	if err != nil {
+		log.Printf("[IPC] Failed to encode %s push: %v", msgType, err)
+		return
+	}
+	msgBytes = append(msgBytes, '\n')
+
+	s.mu.Lock()
+	writers := make([]*connWriter, 0, len(s.authedConns))
+	for conn := range s.authedConns {
+		if w, ok := s.clients[conn]; ok {
+			writers = append(writers, w)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, w := range writers {
+		if err := w.send(msgBytes); err != nil {
+			log.Printf("[IPC] Failed to push %s to %s: %v", msgType, w.conn.RemoteAddr(), err)
+		}
+	}
+}
+
 // Audio data subscription handlers
 
-func (s *Server) handleSubscribeAudioData(conn net.Conn) *Response {
+// audioSubscriber holds one client's visualizer settings. Clients that keep
+// the defaults share the analyzer's own bands; others get a private BandView
+// because smoothing depends on the frames each view has seen.
+type audioSubscriber struct {
+	settings audio.VisualizerSettings
+	format   string
+	custom   bool
+	view     *audio.BandView
+	lastSent time.Time
+}
+
+// applyAudioFormat returns the requested push format, or current if none was requested
+func applyAudioFormat(current string, req AudioDataSettingsRequest) (string, error) {
+	if req.Format == nil {
+		return current, nil
+	}
+	switch *req.Format {
+	case AudioDataFormatJSON, AudioDataFormatBinary:
+		return *req.Format, nil
+	}
+	return "", fmt.Errorf("format must be %q or %q", AudioDataFormatJSON, AudioDataFormatBinary)
+}
+
+// applyAudioSettings merges a settings request over base and validates it
+func applyAudioSettings(base audio.VisualizerSettings, req AudioDataSettingsRequest) (audio.VisualizerSettings, error) {
+	if req.Bands != nil {
+		base.Bands = *req.Bands
+	}
+	if req.Smoothing != nil {
+		base.Smoothing = *req.Smoothing
+	}
+	if req.MinDb != nil {
+		base.MinDb = *req.MinDb
+	}
+	if req.MaxDb != nil {
+		base.MaxDb = *req.MaxDb
+	}
+	if req.FPS != nil {
+		base.FPS = *req.FPS
+	}
+	return base, base.Validate()
+}
+
+func newAudioSubscriber(settings audio.VisualizerSettings, format string) *audioSubscriber {
+	return &audioSubscriber{
+		settings: settings,
+		format:   format,
+		custom:   settings != audio.DefaultVisualizerSettings(),
+	}
+}
+
+func audioSettingsResponse(sub *audioSubscriber) *Response {
+	settings := audio.DefaultVisualizerSettings()
+	format := AudioDataFormatJSON
+	if sub != nil {
+		settings = sub.settings
+		format = sub.format
+	}
+	resp, err := NewSuccessResponse(AudioDataSettings{
+		Subscribed: sub != nil,
+		Bands:      settings.Bands,
+		Smoothing:  settings.Smoothing,
+		MinDb:      settings.MinDb,
+		MaxDb:      settings.MaxDb,
+		FPS:        settings.FPS,
+		Format:     format,
+	})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleSubscribeAudioData(conn net.Conn, req *Request) *Response {
+	var settingsReq AudioDataSettingsRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &settingsReq); err != nil {
+			return NewErrorResponse("invalid audio data settings")
+		}
+	}
+	settings, err := applyAudioSettings(audio.DefaultVisualizerSettings(), settingsReq)
+	if err != nil {
+		return NewErrorResponse(fmt.Sprintf("invalid audio data settings: %v", err))
+	}
+	format, err := applyAudioFormat(AudioDataFormatJSON, settingsReq)
+	if err != nil {
+		return NewErrorResponse(fmt.Sprintf("invalid audio data settings: %v", err))
+	}
+	sub := newAudioSubscriber(settings, format)
+
 	s.audioSubsMu.Lock()
-	s.audioSubs[conn] = true
+	s.audioSubs[conn] = sub
 	count := len(s.audioSubs)
 	s.audioSubsMu.Unlock()
 	
 	log.Printf("[AUDIO] Client subscribed to audio data (total: %d)", count)
 	
-	resp, _ := NewSuccessResponse(map[string]bool{"subscribed": true})
-	return resp
+	return audioSettingsResponse(sub)
+}
+
+func (s *Server) handleConfigureAudioData(conn net.Conn, req *Request) *Response {
+	var settingsReq AudioDataSettingsRequest
+	if err := json.Unmarshal(req.Data, &settingsReq); err != nil {
+		return NewErrorResponse("invalid audio data settings")
+	}
+
+	s.audioSubsMu.Lock()
+	defer s.audioSubsMu.Unlock()
+
+	current, ok := s.audioSubs[conn]
+	if !ok {
+		return NewErrorResponse("not subscribed to audio data")
+	}
+	settings, err := applyAudioSettings(current.settings, settingsReq)
+	if err != nil {
+		return NewErrorResponse(fmt.Sprintf("invalid audio data settings: %v", err))
+	}
+	format, err := applyAudioFormat(current.format, settingsReq)
+	if err != nil {
+		return NewErrorResponse(fmt.Sprintf("invalid audio data settings: %v", err))
+	}
+
+	// Replace rather than modify: the push path may be using the old one
+	sub := newAudioSubscriber(settings, format)
+	s.audioSubs[conn] = sub
+
+	log.Printf("[AUDIO] Client configured audio data: %d bands, smoothing %.2f, %.0f to %.0f dB, fps %d, %s",
+		settings.Bands, settings.Smoothing, settings.MinDb, settings.MaxDb, settings.FPS, format)
+	return audioSettingsResponse(sub)
 }
 
 func (s *Server) handleUnsubscribeAudioData(conn net.Conn) *Response {
@@ -1140,13 +2354,12 @@ func (s *Server) handleUnsubscribeAudioData(conn net.Conn) *Response {
 	
 	log.Printf("[AUDIO] Client unsubscribed from audio data (remaining: %d)", count)
 	
-	resp, _ := NewSuccessResponse(map[string]bool{"subscribed": false})
-	return resp
+	return audioSettingsResponse(nil)
 }
 
 // pushAudioDataImmediate is called directly by the audio analyzer callback
 // This provides true real-time push with zero latency (no polling/timer)
-func (s *Server) pushAudioDataImmediate(bandsU8 []uint8) {
+func (s *Server) pushAudioDataImmediate(frame audio.AudioFrame) {
 	s.audioSubsMu.RLock()
 	if len(s.audioSubs) == 0 {
 		s.audioSubsMu.RUnlock()
@@ -1154,39 +2367,69 @@ func (s *Server) pushAudioDataImmediate(bandsU8 []uint8) {
 	}
 	
 	// Copy subscriber list to avoid holding lock during I/O
-	subs := make([]net.Conn, 0, len(s.audioSubs))
-	for conn := range s.audioSubs {
-		subs = append(subs, conn)
+	subs := make(map[net.Conn]*audioSubscriber, len(s.audioSubs))
+	for conn, sub := range s.audioSubs {
+		subs[conn] = sub
 	}
 	s.audioSubsMu.RUnlock()
 	
-	// Convert []uint8 to []int for JSON
-	bands := make([]int, len(bandsU8))
-	for i, b := range bandsU8 {
-		bands[i] = int(b)
-	}
-	
 	// Get current playback position for sync (Position is already in ms)
 	status := s.player.Status()
 	position := status.Position
 	timestamp := time.Now().UnixMilli()
-	
-	// Create push message with position for sync
-	msgBytes, err := NewPushMessage("audioData", AudioDataResponse{
-		Bands:     bands,
-		Position:  position,
-		Timestamp: timestamp,
-	})
-	if err != nil {
-		return
-	}
-	msgBytes = append(msgBytes, '\n')
-	
-	// Send to all subscribers immediately
-	for _, conn := range subs {
-		_, err := conn.Write(msgBytes)
+	now := time.Now()
+
+	encode := func(bandsU8 []uint8, format string) []byte {
+		if format == AudioDataFormatBinary {
+			return EncodeAudioDataFrame(bandsU8, position, timestamp)
+		}
+
+		// Convert []uint8 to []int for JSON
+		bands := make([]int, len(bandsU8))
+		for i, b := range bandsU8 {
+			bands[i] = int(b)
+		}
+
+		// Create push message with position for sync
+		msgBytes, err := NewPushMessage("audioData", AudioDataResponse{
+			Bands:     bands,
+			Position:  position,
+			Timestamp: timestamp,
+		})
 		if err != nil {
-			// Remove failed connection from subscribers
+			return nil
+		}
+		return append(msgBytes, '\n')
+	}
+
+	// The default output is shared by every subscriber that didn't customize it
+	defaultMsgs := make(map[string][]byte, 2)
+	for conn, sub := range subs {
+		var msgBytes []byte
+		if sub.custom {
+			if sub.view == nil {
+				sub.view = audio.NewBandView(sub.settings, frame.SampleRate)
+			}
+			// Keep smoothing up to date even for frames that are skipped
+			sub.view.Update(frame.Spectrum)
+			if sub.settings.FPS > 0 && now.Sub(sub.lastSent) < time.Second/time.Duration(sub.settings.FPS) {
+				continue
+			}
+			msgBytes = encode(sub.view.Bands(), sub.format)
+		} else {
+			if defaultMsgs[sub.format] == nil {
+				defaultMsgs[sub.format] = encode(frame.Bands, sub.format)
+			}
+			msgBytes = defaultMsgs[sub.format]
+		}
+		if msgBytes == nil {
+			continue
+		}
+		sub.lastSent = now
+
+		// Only queued here; the connection's writer does the I/O so a slow
+		// client can't hold up the analyzer
+		if w := s.writerFor(conn); w == nil || !w.sendFrame(msgBytes) {
 			s.audioSubsMu.Lock()
 			delete(s.audioSubs, conn)
 			s.audioSubsMu.Unlock()
@@ -1197,6 +2440,15 @@ func (s *Server) pushAudioDataImmediate(bandsU8 []uint8) {
 // Analysis and similarity handlers
 
 func (s *Server) handleGetAnalysisStatus() *Response {
+	resp, err := NewSuccessResponse(s.analysisStatus())
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// analysisStatus reports on the analysis job and what it has found so far
+func (s *Server) analysisStatus() AnalysisStatusResponse {
 	status := AnalysisStatusResponse{
 		Status:      "idle",
 		TotalTracks: 0,
@@ -1219,25 +2471,38 @@ func (s *Server) handleGetAnalysisStatus() *Response {
 		communities := s.featureStore.GetCommunities()
 		status.Communities = len(communities)
 	}
+	return status
+}
 
-	resp, err := NewSuccessResponse(status)
-	if err != nil {
-		return NewErrorResponse("internal error")
+// TrackSilence returns the silence analysis found at the start and end of a
+// track, measured at thresholdDB, or zero if the track hasn't been analyzed
+// for it
+func (s *Server) TrackSilence(path string, thresholdDB float64) (lead, trail time.Duration) {
+	if s.featureStore == nil {
+		return 0, 0
 	}
-	return resp
+	stored, ok := s.featureStore.GetFeatures(path)
+	if !ok || stored.Features == nil || stored.Groups[analysis.GroupSilence] == 0 {
+		return 0, 0
+	}
+	return stored.Features.Silence.Trim(thresholdDB)
 }
 
-func (s *Server) handleStartAnalysis() *Response {
+// TrackLoudness returns the integrated loudness analysis measured for a
+// track in LUFS
+func (s *Server) TrackLoudness(path string) (float64, bool) {
 	if s.featureStore == nil {
-		return NewErrorResponse("analysis not available")
+		return 0, false
 	}
-
-	// Check if already running
-	if s.analysisWorker != nil && s.analysisWorker.IsRunning() {
-		return NewErrorResponse("analysis already running")
+	stored, ok := s.featureStore.GetFeatures(path)
+	if !ok || stored.Features == nil || stored.Groups[analysis.GroupLoudness] == 0 || stored.Features.Loudness == 0 {
+		return 0, false
 	}
+	return float64(stored.Features.Loudness), true
+}
 
-	// Create worker if needed
+// ensureAnalysisWorker creates the analysis worker on first use
+func (s *Server) ensureAnalysisWorker() error {
 	if s.analysisWorker == nil {
 		worker, err := analysis.NewWorker(analysis.WorkerConfig{
 			IsPlayingFunc: func() bool {
@@ -1246,23 +2511,133 @@ func (s *Server) handleStartAnalysis() *Response {
 			},
 			OnResult: func(result analysis.AnalysisResult) {
 				if result.Error == nil && result.Features != nil {
-					s.featureStore.StoreFeatures(result.TrackPath, result.Features, analysis.FeatureVersion, result.FileHash)
+					if result.Groups != nil {
+						s.featureStore.StoreFeatureGroups(result.TrackPath, result.Features, result.Groups, result.FileHash)
+					} else {
+						s.featureStore.StoreFeatures(result.TrackPath, result.Features, analysis.FeatureVersion, result.FileHash)
+					}
+				}
+				if result.Error == nil && result.Waveform != nil {
+					if err := s.featureStore.StoreWaveform(result.TrackPath, result.Waveform); err != nil {
+						log.Printf("[ANALYSIS] Warning: failed to store waveform for %s: %v", result.TrackPath, err)
+					}
+				}
+				if result.Fingerprint != nil {
+					if err := s.featureStore.StoreFingerprint(result.TrackPath, result.Fingerprint); err != nil {
+						log.Printf("[ANALYSIS] Warning: failed to store fingerprint for %s: %v", result.TrackPath, err)
+					}
+				}
+			},
+			Jobs: s.analysisJobs,
+			OnCheckpoint: func() {
+				if err := s.featureStore.Save(); err != nil {
+					log.Printf("[ANALYSIS] Warning: Failed to save feature store: %v", err)
 				}
 			},
 		})
 		if err != nil {
-			return NewErrorResponse(fmt.Sprintf("failed to create worker: %v", err))
+			return err
 		}
 		s.analysisWorker = worker
 	}
+	return nil
+}
 
-	// Get all tracks to analyze from last scan
+// ResumeAnalysisJob continues an analysis run that was interrupted by a
+// restart
+func (s *Server) ResumeAnalysisJob(ctx context.Context) {
+	if s.analysisJobs == nil || len(s.analysisJobs.Pending()) == 0 {
+		return
+	}
+	if err := s.ensureAnalysisWorker(); err != nil {
+		log.Printf("[ANALYSIS] Warning: Could not resume analysis: %v", err)
+		return
+	}
+
+	remaining, err := s.analysisWorker.ResumeJob(ctx)
+	if err != nil {
+		log.Printf("[ANALYSIS] Warning: Could not resume analysis: %v", err)
+		return
+	}
+	if remaining > 0 {
+		log.Printf("[ANALYSIS] Resumed analysis with %d tracks remaining", remaining)
+	}
+}
+
+func (s *Server) handleGetAnalysisCoverage() *Response {
+	if s.featureStore == nil {
+		return NewErrorResponse("analysis not available")
+	}
+
+	coverage := AnalysisCoverageResponse{
+		LibraryTracks: s.libraryIndex.Len(),
+		Versions:      make(map[int]int),
+		Groups:        make([]FeatureGroupCoverage, len(analysis.FeatureGroups)),
+	}
+	for i, group := range analysis.FeatureGroups {
+		coverage.Groups[i] = FeatureGroupCoverage{
+			Name:     group,
+			Version:  analysis.FeatureGroupVersions[group],
+			Versions: make(map[int]int),
+		}
+	}
+
+	for _, stored := range s.featureStore.GetAllFeatures() {
+		coverage.Analyzed++
+		coverage.Versions[stored.Version]++
+		if len(stored.StaleGroups()) == 0 {
+			coverage.UpToDate++
+		}
+		for i := range coverage.Groups {
+			group := &coverage.Groups[i]
+			version := stored.Groups[group.Name]
+			group.Versions[version]++
+			if version >= group.Version {
+				group.UpToDate++
+			} else {
+				group.Stale++
+			}
+		}
+	}
+
+	resp, err := NewSuccessResponse(coverage)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleStartAnalysis(ctx context.Context) *Response {
+	if s.featureStore == nil {
+		return NewErrorResponse("analysis not available")
+	}
+
+	// Check if already running
+	if s.analysisWorker != nil && s.analysisWorker.IsRunning() {
+		return NewErrorResponse("analysis already running")
+	}
+
+	// Create worker if needed
+	if err := s.ensureAnalysisWorker(); err != nil {
+		return NewErrorResponse(fmt.Sprintf("failed to create worker: %v", err))
+	}
+
+	// Get all tracks to analyze from last scan. Tracks are also fingerprinted,
+	// so identifyTrack doesn't have to wait for fpcalc and a track's data can
+	// follow it when it's re-encoded. Tracks with only some feature groups out
+	// of date recompute just those.
 	results, _ := s.libScanner.GetLastResults()
+	canFingerprint := s.analysisWorker.CanFingerprint()
 	var tracks []analysis.TrackInfo
 	for _, sr := range results {
 		for _, f := range sr.Files {
-			if !s.featureStore.HasFeatures(f.Path, analysis.FeatureVersion) {
-				tracks = append(tracks, analysis.TrackInfo{Path: f.Path})
+			needsFingerprint := canFingerprint && !s.featureStore.HasFingerprint(f.Path)
+			stale, analyzed := s.featureStore.StaleGroups(f.Path)
+			switch {
+			case !analyzed || needsFingerprint || !s.featureStore.HasWaveform(f.Path):
+				tracks = append(tracks, analysis.TrackInfo{Path: f.Path, Fingerprint: needsFingerprint})
+			case len(stale) > 0:
+				tracks = append(tracks, analysis.TrackInfo{Path: f.Path, Groups: stale})
 			}
 		}
 	}
@@ -1272,7 +2647,6 @@ func (s *Server) handleStartAnalysis() *Response {
 	}
 
 	// Start analysis
-	ctx := context.Background()
 	if err := s.analysisWorker.Start(ctx, tracks); err != nil {
 		return NewErrorResponse(err.Error())
 	}
@@ -1299,13 +2673,25 @@ func (s *Server) handleResumeAnalysis() *Response {
 	return s.handleGetAnalysisStatus()
 }
 
+func (s *Server) handleCancelAnalysis() *Response {
+	if s.analysisWorker == nil || !s.analysisWorker.IsRunning() {
+		return NewErrorResponse("no analysis running")
+	}
+	s.analysisWorker.Cancel()
+	log.Printf("[ANALYSIS] Analysis cancelled")
+	return s.handleGetAnalysisStatus()
+}
+
 func (s *Server) handleRebuildGraph() *Response {
 	if s.similarityEngine == nil || s.communityDetector == nil {
 		return NewErrorResponse("analysis not available")
 	}
 
 	log.Printf("[ANALYSIS] Rebuilding similarity graph...")
-	s.similarityEngine.BuildGraph()
+	if err := s.similarityEngine.BuildGraph(); err != nil {
+		log.Printf("[ANALYSIS] Failed to rebuild similarity graph: %v", err)
+		return NewErrorResponse("failed to save similarity graph")
+	}
 
 	log.Printf("[ANALYSIS] Detecting communities...")
 	communities := s.communityDetector.DetectCommunities()
@@ -1428,6 +2814,180 @@ func (s *Server) handleGetBridgeTracks(req *Request) *Response {
 	return resp
 }
 
+func (s *Server) handleGetWaveform(req *Request) *Response {
+	if s.featureStore == nil {
+		return NewErrorResponse("analysis not available")
+	}
+
+	var waveReq GetWaveformRequest
+	if err := json.Unmarshal(req.Data, &waveReq); err != nil || waveReq.TrackPath == "" || waveReq.Buckets < 0 {
+		return NewErrorResponse("invalid request")
+	}
+
+	waveform, err := s.featureStore.GetWaveform(waveReq.TrackPath)
+	if os.IsNotExist(err) {
+		return NewErrorResponse("waveform not available, run analysis first")
+	}
+	if err != nil {
+		log.Printf("[ANALYSIS] Failed to read waveform for %s: %v", waveReq.TrackPath, err)
+		return NewErrorResponse("failed to read waveform")
+	}
+	waveform = waveform.Downsample(waveReq.Buckets)
+
+	resp, err := NewSuccessResponse(GetWaveformResponse{
+		TrackPath:  waveReq.TrackPath,
+		DurationMs: waveform.DurationMs,
+		Buckets:    waveform.Buckets(),
+		Peaks:      waveform.Peaks,
+	})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleGetTrackFeatures(req *Request) *Response {
+	if s.featureStore == nil {
+		return NewErrorResponse("analysis not available")
+	}
+
+	var featReq GetTrackFeaturesRequest
+	if err := json.Unmarshal(req.Data, &featReq); err != nil {
+		return NewErrorResponse("invalid request")
+	}
+	if featReq.TrackPath == "" {
+		featReq.TrackPath = featReq.Path
+	}
+	if featReq.TrackPath == "" {
+		return NewErrorResponse("invalid request")
+	}
+
+	stored, ok := s.featureStore.GetFeatures(featReq.TrackPath)
+	if !ok || stored.Features == nil {
+		return NewErrorResponse("track not analyzed")
+	}
+	f := stored.Features
+
+	result := GetTrackFeaturesResponse{
+		TrackPath:  featReq.TrackPath,
+		Version:    stored.Version,
+		AnalyzedAt: stored.AnalyzedAt,
+		Groups:     stored.Groups,
+		Features: TrackFeatures{
+			MFCC:             f.MFCC[:],
+			MFCCStdDev:       f.MFCCStdDev[:],
+			SpectralCentroid: f.SpectralCentroid,
+			SpectralRolloff:  f.SpectralRolloff,
+			SpectralFlux:     f.SpectralFlux,
+			ZeroCrossing:     f.ZeroCrossing,
+			RMSEnergy:        f.RMSEnergy,
+			Tempo:            f.Tempo,
+			BassRatio:        f.BassRatio,
+			MidRatio:         f.MidRatio,
+			TrebleRatio:      f.TrebleRatio,
+			AttackSharpness:  f.AttackSharpness,
+			HarmonicDensity:  f.HarmonicDensity,
+			RhythmComplexity: f.RhythmComplexity,
+			DynamicRange:     f.DynamicRange,
+			Instruments: InstrumentScores{
+				BrassLike:         f.Instruments.BrassLike,
+				StringLike:        f.Instruments.StringLike,
+				WoodwindLike:      f.Instruments.WoodwindLike,
+				Percussive:        f.Instruments.Percussive,
+				SynthPad:          f.Instruments.SynthPad,
+				VocalPresence:     f.Instruments.VocalPresence,
+				ArticulationStyle: f.Instruments.ArticulationStyle,
+				EnsembleSize:      f.Instruments.EnsembleSize,
+				PlayingIntensity:  f.Instruments.PlayingIntensity,
+			},
+		},
+	}
+	if stored.Descriptors != nil {
+		result.Descriptors = toTrackDescriptors(*stored.Descriptors)
+	}
+	if f.KeyStrength > 0 {
+		result.Key = &TrackKey{
+			Name:     analysis.KeyName(f.Key, f.Mode),
+			Tonic:    analysis.PitchClassName(f.Key),
+			Mode:     analysis.ModeName(f.Mode),
+			Camelot:  analysis.CamelotKey(f.Key, f.Mode),
+			Strength: f.KeyStrength,
+		}
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// Histogram bins for getFeatureDistribution
+const (
+	defaultHistogramBins = 20
+	maxHistogramBins     = 200
+)
+
+func (s *Server) handleGetFeatureDistribution(req *Request) *Response {
+	if s.featureStore == nil {
+		return NewErrorResponse("analysis not available")
+	}
+
+	var distReq GetFeatureDistributionRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &distReq); err != nil {
+			return NewErrorResponse("invalid request")
+		}
+	}
+	bins := distReq.Bins
+	if bins <= 0 {
+		bins = defaultHistogramBins
+	}
+	if bins > maxHistogramBins {
+		return NewErrorResponse(fmt.Sprintf("bins must be at most %d", maxHistogramBins))
+	}
+
+	names := analysis.DistributionFeatureNames()
+	for _, feature := range distReq.Features {
+		if !slices.Contains(names, feature) {
+			return NewErrorResponse(fmt.Sprintf("unknown feature %q", feature))
+		}
+	}
+
+	// Analysis can outlive a track's removal from the library
+	var include func(path string) bool
+	if s.libraryIndex.Len() > 0 {
+		include = func(path string) bool {
+			_, ok := s.libraryIndex.Get(path)
+			return ok
+		}
+	}
+	dist := s.featureStore.FeatureDistribution(bins, distReq.Features, include)
+
+	result := GetFeatureDistributionResponse{
+		Tracks:     dist.Tracks,
+		Histograms: make([]FeatureHistogram, len(dist.Histograms)),
+		Keys:       dist.Keys,
+		Features:   names,
+	}
+	for i, h := range dist.Histograms {
+		result.Histograms[i] = FeatureHistogram{
+			Feature: h.Feature,
+			Min:     h.Min,
+			Max:     h.Max,
+			Mean:    h.Mean,
+			Tracks:  h.Tracks,
+			Counts:  h.Counts,
+		}
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
 func (s *Server) handleExplainSimilarity(req *Request) *Response {
 	if s.similarityEngine == nil {
 		return NewErrorResponse("analysis not available")
@@ -1442,6 +3002,10 @@ func (s *Server) handleExplainSimilarity(req *Request) *Response {
 	if breakdown == nil {
 		return NewErrorResponse("tracks not analyzed")
 	}
+	var key *float32
+	if k, ok := breakdown["key"]; ok {
+		key = &k
+	}
 
 	resp, err := NewSuccessResponse(ExplainSimilarityResponse{
 		Overall:     breakdown["overall"],
@@ -1452,6 +3016,7 @@ func (s *Server) handleExplainSimilarity(req *Request) *Response {
 		Bands:       breakdown["bands"],
 		Instruments: breakdown["instruments"],
 		Context:     breakdown["context"],
+		Key:         key,
 	})
 	if err != nil {
 		return NewErrorResponse("internal error")
@@ -1464,9 +3029,24 @@ func (s *Server) handleSetContinueMode(req *Request) *Response {
 	if err := json.Unmarshal(req.Data, &modeReq); err != nil {
 		return NewErrorResponse("invalid request")
 	}
+	filter := library.RatingFilter{MinStars: modeReq.MinRating, FavoritesOnly: modeReq.FavoritesOnly}
+	if err := filter.Validate(); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	s.continueMu.Lock()
+	s.continueFilter = filter
+	s.continueMu.Unlock()
+	s.setContinueMode(modeReq.Mode)
 
+	log.Printf("[QUEUE] Continue mode set to: %s", modeReq.Mode)
+	return s.handleGetContinueMode()
+}
+
+// setContinueMode sets continue mode to "similar", "random" or off
+func (s *Server) setContinueMode(name string) {
 	var mode queue.ContinueMode
-	switch modeReq.Mode {
+	switch name {
 	case "similar":
 		mode = queue.ContinueSimilar
 	case "random":
@@ -1474,22 +3054,19 @@ func (s *Server) handleSetContinueMode(req *Request) *Response {
 	default:
 		mode = queue.ContinueOff
 	}
-
 	s.queueMgr.SetContinueMode(mode)
 
 	// Set up similarity provider if enabling similar mode
 	if mode == queue.ContinueSimilar && s.similarityEngine != nil {
 		s.queueMgr.SetSimilarityProvider(func(trackPath string, exclude []string) string {
-			edges := s.similarityEngine.FindSimilar(trackPath, 1, exclude)
-			if len(edges) > 0 {
-				return edges[0].TargetPath
+			for _, edge := range s.similarityEngine.FindSimilar(trackPath, continueCandidates, exclude) {
+				if s.continueAllows(edge.TargetPath) {
+					return edge.TargetPath
+				}
 			}
 			return ""
 		})
 	}
-
-	log.Printf("[QUEUE] Continue mode set to: %s", modeReq.Mode)
-	return s.handleGetContinueMode()
 }
 
 func (s *Server) handleGetContinueMode() *Response {
@@ -1503,7 +3080,134 @@ func (s *Server) handleGetContinueMode() *Response {
 		modeStr = "random"
 	}
 
-	resp, err := NewSuccessResponse(GetContinueModeResponse{Mode: modeStr})
+	s.continueMu.Lock()
+	filter := s.continueFilter
+	s.continueMu.Unlock()
+
+	resp, err := NewSuccessResponse(GetContinueModeResponse{
+		Mode:          modeStr,
+		MinRating:     filter.MinStars,
+		FavoritesOnly: filter.FavoritesOnly,
+	})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// Client management handlers
+
+func toIPCClientInfo(client auth.ClientInfo) ClientInfo {
+	return ClientInfo{
+		ID:        client.ID,
+		Name:      client.Name,
+		CreatedAt: client.CreatedAt.UnixMilli(),
+		Status:    string(client.Status),
+		ExpiresAt: unixMilliOrZero(client.ExpiresAt),
+		Scopes:    scopeNames(client.Scopes),
+		MaxVolume: client.MaxVolume,
+	}
+}
+
+func (s *Server) handleListClients() *Response {
+	ipcClients, err := s.listClients()
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	resp, err := NewSuccessResponse(ListClientsResponse{Clients: ipcClients})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// listClients returns the paired clients, oldest first
+func (s *Server) listClients() ([]ClientInfo, error) {
+	clients, err := s.authManager.ListClients()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+	})
+
+	ipcClients := make([]ClientInfo, len(clients))
+	for i, client := range clients {
+		ipcClients[i] = toIPCClientInfo(client)
+	}
+	return ipcClients, nil
+}
+
+func (s *Server) handleApproveClient(req *Request) *Response {
+	var clientReq ClientRequest
+	if err := json.Unmarshal(req.Data, &clientReq); err != nil || clientReq.ClientID == "" {
+		return NewErrorResponse("invalid approveClient request")
+	}
+
+	if err := s.authManager.ApproveClient(clientReq.ClientID); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	log.Printf("[AUTH] Approved client %s", clientReq.ClientID)
+	return s.handleListClients()
+}
+
+func (s *Server) handleRevokeClient(req *Request) *Response {
+	var clientReq ClientRequest
+	if err := json.Unmarshal(req.Data, &clientReq); err != nil || clientReq.ClientID == "" {
+		return NewErrorResponse("invalid revokeClient request")
+	}
+
+	if err := s.authManager.RevokeClient(clientReq.ClientID); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	// Stop pushing events to connections of the revoked client
+	s.mu.Lock()
+	for conn, cc := range s.authedConns {
+		if cc.ref.ClientID == clientReq.ClientID {
+			delete(s.authedConns, conn)
+		}
+	}
+	s.mu.Unlock()
+
+	log.Printf("[AUTH] Revoked client %s", clientReq.ClientID)
+	return s.handleListClients()
+}
+
+func (s *Server) handleSetClientScopes(req *Request) *Response {
+	var scopesReq SetClientScopesRequest
+	if err := json.Unmarshal(req.Data, &scopesReq); err != nil || scopesReq.ClientID == "" {
+		return NewErrorResponse("invalid setClientScopes request")
+	}
+
+	scopes, err := auth.ParseScopes(scopesReq.Scopes)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	if err := s.authManager.SetClientScopes(scopesReq.ClientID, scopes); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	log.Printf("[AUTH] Set scopes for client %s: %v", scopesReq.ClientID, scopesReq.Scopes)
+	return s.handleListClients()
+}
+
+func (s *Server) handleRefreshToken(req *Request) *Response {
+	token, client, err := s.authManager.RefreshToken(req.Token)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	log.Printf("[AUTH] Refreshed token for client %s", client.ID)
+
+	resp, err := NewSuccessResponse(RefreshTokenResponse{
+		Token:     token,
+		ExpiresAt: unixMilliOrZero(client.ExpiresAt),
+	})
 	if err != nil {
 		return NewErrorResponse("internal error")
 	}
@@ -0,0 +1,197 @@
+package ipc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/auth"
+	"github.com/austinkregel/local-media/musicd/internal/config"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+// newTestServer returns a server with a simulated player and its data kept
+// in a temporary directory
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+
+	configMgr := config.NewManager(dir)
+	cfg := config.DefaultConfig()
+	cfg.DataDir = dir
+	if err := configMgr.Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+	store, err := auth.NewStore(filepath.Join(dir, "clients.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	player, err := audio.NewSimulatedPlayer(nil, audio.NewSimDecoder(time.Minute), audio.NewManualClock(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { player.Close() })
+
+	s, err := NewServer(filepath.Join(dir, "musicd.sock"), auth.NewManager(store, true), configMgr, player, queue.NewManager(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// writeTracks creates empty files to queue, named as given
+func writeTracks(t *testing.T, names ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestNextSkipsQuarantinedTracks(t *testing.T) {
+	s := newTestServer(t)
+	tracks := writeTracks(t, "a.flac", "b.flac", "c.flac")
+	s.queueMgr.Set(tracks)
+	s.queueMgr.SetIndex(0)
+	if err := s.quarantine.Add(tracks[1], "play", errors.New("damaged"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Playing the first track from the queue leaves it as the transition
+	// to learn from
+	s.learnFromAdvance(tracks[0], false)
+
+	if resp := s.handleNext(context.Background()); !resp.Success {
+		t.Fatalf("Expected next to succeed, got %s", resp.Error)
+	}
+	if status := s.player.Status(); status.Path != tracks[2] {
+		t.Errorf("Expected the quarantined track skipped, playing %s", status.Path)
+	}
+	if index, _ := s.queueMgr.Position(); index != 2 {
+		t.Errorf("Expected the queue at 2, got %d", index)
+	}
+	if s.transitionFrom != "" {
+		t.Errorf("Expected the transition forgotten, got %s", s.transitionFrom)
+	}
+
+	// With nothing but quarantined tracks ahead there's no next track
+	s.queueMgr.SetIndex(0)
+	if err := s.quarantine.Add(tracks[2], "play", errors.New("damaged"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if resp := s.handleNext(context.Background()); resp.Success {
+		t.Error("Expected no next track when the rest are quarantined")
+	}
+}
+
+func TestIdle(t *testing.T) {
+	s := newTestServer(t)
+	if !s.Idle() {
+		t.Fatal("Expected a new server to be idle")
+	}
+
+	tracks := writeTracks(t, "a.flac")
+	if err := s.player.Play(context.Background(), tracks[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	if s.Idle() {
+		t.Error("Expected the server busy while playing")
+	}
+	s.player.Stop()
+
+	// A profile with a start time has to be switched to when it comes round
+	cfg := *s.configMgr.Get()
+	cfg.Profiles = []config.ProfileConfig{{Name: "morning", Start: "07:00"}}
+	if err := s.configMgr.Update(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if s.Idle() {
+		t.Error("Expected the server busy with a scheduled profile")
+	}
+}
+
+// connectTestClient adds an approved client to the server and returns what
+// it is sent
+func connectTestClient(t *testing.T, s *Server) *bufio.Reader {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	w := newConnWriter(server)
+	t.Cleanup(w.close)
+
+	s.mu.Lock()
+	s.clients[server] = w
+	s.authedConns[server] = &connClient{connectedAt: time.Now()}
+	s.mu.Unlock()
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return bufio.NewReader(client)
+}
+
+// readPush returns the data of the next push of type msgType
+func readPush(t *testing.T, r *bufio.Reader, msgType string, data interface{}) {
+	t.Helper()
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("No %s push: %v", msgType, err)
+		}
+		var push PushMessage
+		if err := json.Unmarshal(line, &push); err != nil {
+			t.Fatalf("Invalid push %q: %v", line, err)
+		}
+		if push.Type == msgType {
+			if err := json.Unmarshal(push.Data, data); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+}
+
+func TestTrackChangePushed(t *testing.T) {
+	s := newTestServer(t)
+	pushes := connectTestClient(t, s)
+	tracks := writeTracks(t, "a.flac", "b.flac")
+	s.queueMgr.Set(tracks)
+	s.queueMgr.SetIndex(0)
+
+	tests := []struct {
+		name   string
+		change func() *Response
+		path   string
+		reason string
+		index  int
+	}{
+		{"next", func() *Response { return s.handleNext(context.Background()) }, tracks[1], trackChangeNext, 1},
+		{"previous", func() *Response { return s.handlePrev(context.Background()) }, tracks[0], trackChangePrevious, 0},
+	}
+	for _, tt := range tests {
+		if resp := tt.change(); !resp.Success {
+			t.Fatalf("%s failed: %s", tt.name, resp.Error)
+		}
+		var changed TrackChangedPush
+		readPush(t, pushes, "trackChanged", &changed)
+		if changed.Path != tt.path || changed.Reason != tt.reason {
+			t.Errorf("%s: expected %s for %s, got %+v", tt.name, tt.path, tt.reason, changed)
+		}
+		var index QueueIndexChangedPush
+		readPush(t, pushes, "queueIndexChanged", &index)
+		if index.Index != tt.index || index.Size != len(tracks) {
+			t.Errorf("%s: expected index %d of %d, got %+v", tt.name, tt.index, len(tracks), index)
+		}
+	}
+}
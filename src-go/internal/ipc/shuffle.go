@@ -0,0 +1,64 @@
+package ipc
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+// Smart shuffle weighting
+const (
+	favoriteShuffleBoost = 1.5            // Favorites come up half again as often
+	recentPlayWindow     = 24 * time.Hour // Tracks played within this are held back
+	minRecentPlayWeight  = 0.05           // Weight of a track that has only just played
+)
+
+// SetPlayCountStore enables play counting, which smart shuffle uses to
+// favor well-loved tracks and hold back recently played ones
+func (s *Server) SetPlayCountStore(store *queue.PlayCountStore) {
+	s.playCounts = store
+}
+
+// countPlay records a play of path unless it was skipped
+func (s *Server) countPlay(path string, skipped bool) {
+	if s.playCounts == nil || path == "" || skipped {
+		return
+	}
+	if err := s.playCounts.Record(path, time.Now()); err != nil {
+		log.Printf("[QUEUE] Failed to save play count: %v", err)
+	}
+}
+
+// shuffleWeight is how strongly smart shuffle favors a track. Unrated,
+// unplayed tracks weigh 1. Stars scale the weight so 3 stars is neutral, 1
+// star a third and 5 stars five thirds. Play count adds a slowly growing
+// boost, and a track played in the last day is held back in proportion to
+// how recently it played. With discovery shuffle on, never played tracks
+// are favored while listening is in a rut.
+func (s *Server) shuffleWeight(path string) float64 {
+	weight := 1.0
+
+	rating := s.ratings.Get(path)
+	if rating.Stars > 0 {
+		weight *= float64(rating.Stars) / 3
+	}
+	if rating.Favorite {
+		weight *= favoriteShuffleBoost
+	}
+
+	if s.playCounts == nil {
+		return weight
+	}
+	plays := s.playCounts.Get(path)
+	weight *= 1 + math.Log2(1+float64(plays.Count))/4
+	weight *= s.discoveryWeight(plays.Count)
+	if plays.LastPlayed > 0 {
+		since := time.Since(time.UnixMilli(plays.LastPlayed))
+		if since < recentPlayWindow {
+			weight *= max(minRecentPlayWeight, float64(since)/float64(recentPlayWindow))
+		}
+	}
+	return weight
+}
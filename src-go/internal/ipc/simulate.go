@@ -0,0 +1,32 @@
+package ipc
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+)
+
+// SetSimulationClock gives clients control of the clock a simulated player
+// is timed by, through advanceClock
+func (s *Server) SetSimulationClock(clock *audio.ManualClock) {
+	s.simClock = clock
+}
+
+func (s *Server) handleAdvanceClock(req *Request) *Response {
+	if s.simClock == nil {
+		return NewErrorResponse("playback isn't simulated; start musicd with --simulate")
+	}
+
+	var advanceReq AdvanceClockRequest
+	if err := json.Unmarshal(req.Data, &advanceReq); err != nil || advanceReq.Ms <= 0 {
+		return NewErrorResponse("invalid advanceClock request")
+	}
+	s.simClock.Advance(time.Duration(advanceReq.Ms) * time.Millisecond)
+
+	resp, err := NewSuccessResponse(AdvanceClockResponse{Now: s.simClock.Now().UnixMilli()})
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
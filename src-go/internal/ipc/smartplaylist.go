@@ -0,0 +1,160 @@
+package ipc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/austinkregel/local-media/musicd/internal/analysis"
+	"github.com/austinkregel/local-media/musicd/internal/library"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+// descriptorRules converts a smart playlist request into analysis rules
+func descriptorRules(req GetSmartPlaylistRequest) ([]analysis.DescriptorRule, error) {
+	var rules []analysis.DescriptorRule
+	if req.Mood != "" {
+		moodRules, ok := analysis.Moods[strings.ToLower(req.Mood)]
+		if !ok {
+			return nil, fmt.Errorf("unknown mood %q (one of %s)", req.Mood, strings.Join(analysis.MoodNames(), ", "))
+		}
+		rules = append(rules, moodRules...)
+	}
+
+	for _, r := range req.Rules {
+		rule := analysis.DescriptorRule{Descriptor: strings.ToLower(r.Descriptor), Min: 0, Max: 1}
+		if r.Min != nil {
+			rule.Min = *r.Min
+		}
+		if r.Max != nil {
+			rule.Max = *r.Max
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func toTrackDescriptors(d analysis.Descriptors) TrackDescriptors {
+	return TrackDescriptors{
+		Energy:       d.Energy,
+		Danceability: d.Danceability,
+		Acousticness: d.Acousticness,
+		Valence:      d.Valence,
+	}
+}
+
+func (s *Server) handleGetSmartPlaylist(req *Request) *Response {
+	if s.featureStore == nil {
+		return NewErrorResponse("analysis not available")
+	}
+
+	var playlistReq GetSmartPlaylistRequest
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &playlistReq); err != nil {
+			return NewErrorResponse("invalid smart playlist request")
+		}
+	}
+	if playlistReq.Offset < 0 || playlistReq.Limit < 0 {
+		return NewErrorResponse("invalid smart playlist request")
+	}
+	rules, err := descriptorRules(playlistReq)
+	if err != nil {
+		return NewErrorResponse(fmt.Sprintf("invalid smart playlist request: %v", err))
+	}
+	ratingFilter := library.RatingFilter{MinStars: playlistReq.MinRating, FavoritesOnly: playlistReq.FavoritesOnly}
+	if err := ratingFilter.Validate(); err != nil {
+		return NewErrorResponse(fmt.Sprintf("invalid smart playlist request: %v", err))
+	}
+
+	// Analysis can outlive a track's removal from the library
+	var tracks []SmartPlaylistTrack
+	for _, path := range s.featureStore.FindByDescriptors(rules) {
+		t, ok := s.libraryIndex.Get(path)
+		if !ok || !ratingFilter.Allows(library.Rating{Stars: t.Rating, Favorite: t.Favorite}) {
+			continue
+		}
+		stored, ok := s.featureStore.GetFeatures(path)
+		if !ok || stored.Descriptors == nil {
+			continue
+		}
+		tracks = append(tracks, SmartPlaylistTrack{
+			LibraryTrack: toLibraryTrack(t),
+			Descriptors:  toTrackDescriptors(*stored.Descriptors),
+		})
+	}
+
+	result := GetSmartPlaylistResponse{
+		Tracks: []SmartPlaylistTrack{},
+		Total:  len(tracks),
+		Moods:  analysis.MoodNames(),
+	}
+	if playlistReq.Offset < len(tracks) {
+		end := min(playlistReq.Offset+libraryLimit(playlistReq.Limit), len(tracks))
+		result.Tracks = tracks[playlistReq.Offset:end]
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// playlistTracks returns the library tracks of the daily mix or mood called
+// name, ignoring case
+func (s *Server) playlistTracks(name string) ([]string, error) {
+	if s.featureStore == nil {
+		return nil, fmt.Errorf("analysis not available")
+	}
+
+	var candidates []string
+	found := false
+	for _, mix := range s.mixStore.Get().Mixes {
+		if strings.EqualFold(mix.Name, name) {
+			candidates, found = mix.Tracks, true
+			break
+		}
+	}
+	if !found {
+		rules, ok := analysis.Moods[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown playlist %q: not a daily mix or one of the moods %s",
+				name, strings.Join(analysis.MoodNames(), ", "))
+		}
+		candidates = s.featureStore.FindByDescriptors(rules)
+	}
+	return s.inLibrary(candidates), nil
+}
+
+// inLibrary returns the paths that are library tracks. Mixes and analysis
+// can outlive a track's removal from the library.
+func (s *Server) inLibrary(paths []string) []string {
+	var tracks []string
+	for _, path := range paths {
+		if _, ok := s.libraryIndex.Get(path); ok {
+			tracks = append(tracks, path)
+		}
+	}
+	return tracks
+}
+
+// libraryQueueItems makes queue items of paths, with the metadata the
+// library has for them
+func (s *Server) libraryQueueItems(paths []string) []queue.QueueItem {
+	items := make([]queue.QueueItem, len(paths))
+	for i, path := range paths {
+		items[i] = queue.QueueItem{Path: path}
+		if t, ok := s.libraryIndex.Get(path); ok {
+			items[i].Metadata = &queue.TrackMetadata{
+				Title:    t.Title,
+				Artist:   t.Artist,
+				Album:    t.Album,
+				Duration: t.Duration,
+			}
+		}
+	}
+	return items
+}
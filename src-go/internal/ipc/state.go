@@ -0,0 +1,57 @@
+package ipc
+
+import (
+	"log"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+)
+
+// dumpStateErrors is how many recent warnings and errors a state dump holds
+const dumpStateErrors = 50
+
+// handleDumpState snapshots the daemon for a bug report
+func (s *Server) handleDumpState() *Response {
+	status := s.currentStatus()
+
+	queueState := s.queueMgr.State()
+	queueState.PositionPath = status.Path
+	queueState.Position = status.Position
+	queueState.Playing = status.State == string(audio.StatePlaying)
+
+	clients, err := s.listClients()
+	if err != nil {
+		log.Printf("[AUTH] Failed to list clients for state dump: %v", err)
+	}
+
+	scan := s.libScanner.GetStatus()
+	result := DumpStateResponse{
+		TakenAt:  time.Now().UnixMilli(),
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+		Status:   status,
+		Queue:    queueState,
+		Config:   s.configMgr.Get().Redacted(),
+		Clients:  clients,
+		Scan: ScanStatusResponse{
+			Status:   scan.Status,
+			Progress: scan.Progress,
+			Message:  scan.Message,
+		},
+		Analysis: s.analysisStatus(),
+		Errors:   []LogEntry{},
+	}
+	if s.logger != nil {
+		for _, e := range s.logger.Recent(dumpStateErrors, slog.LevelWarn) {
+			result.Errors = append(result.Errors, toIPCLogEntry(e))
+		}
+	}
+
+	log.Printf("[IPC] Dumped daemon state: %d queue items, %d errors", len(queueState.Items), len(result.Errors))
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
@@ -0,0 +1,91 @@
+package ipc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/austinkregel/local-media/musicd/internal/config"
+)
+
+func (s *Server) handleListStations() *Response {
+	result := ListStationsResponse{Stations: []Station{}}
+	for _, st := range s.configMgr.Get().Stations {
+		result.Stations = append(result.Stations, Station{Name: st.Name, URL: st.URL})
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// handleSaveStation adds a station, or changes the URL of the one with the
+// same name
+func (s *Server) handleSaveStation(req *Request) *Response {
+	var stationReq StationRequest
+	if err := json.Unmarshal(req.Data, &stationReq); err != nil || stationReq.Name == "" {
+		return NewErrorResponse("invalid station request")
+	}
+
+	cfg := *s.configMgr.Get()
+	stations := make([]config.StationConfig, 0, len(cfg.Stations)+1)
+	saved := false
+	for _, st := range cfg.Stations {
+		if st.Name == stationReq.Name {
+			st.URL = stationReq.URL
+			saved = true
+		}
+		stations = append(stations, st)
+	}
+	if !saved {
+		stations = append(stations, config.StationConfig{Name: stationReq.Name, URL: stationReq.URL})
+	}
+	cfg.Stations = stations
+
+	if resp := s.updateStations(&cfg); resp != nil {
+		return resp
+	}
+	log.Printf("[CONFIG] Saved station %s: %s", stationReq.Name, stationReq.URL)
+	return s.handleListStations()
+}
+
+func (s *Server) handleRemoveStation(req *Request) *Response {
+	var stationReq StationRequest
+	if err := json.Unmarshal(req.Data, &stationReq); err != nil || stationReq.Name == "" {
+		return NewErrorResponse("invalid station request")
+	}
+
+	cfg := *s.configMgr.Get()
+	stations := make([]config.StationConfig, 0, len(cfg.Stations))
+	for _, st := range cfg.Stations {
+		if st.Name != stationReq.Name {
+			stations = append(stations, st)
+		}
+	}
+	if len(stations) == len(cfg.Stations) {
+		return NewErrorResponse("unknown station")
+	}
+	cfg.Stations = stations
+
+	if resp := s.updateStations(&cfg); resp != nil {
+		return resp
+	}
+	log.Printf("[CONFIG] Removed station %s", stationReq.Name)
+	return s.handleListStations()
+}
+
+// updateStations saves cfg, returning an error response if it was rejected
+func (s *Server) updateStations(cfg *config.Config) *Response {
+	if err := s.configMgr.Update(cfg); err != nil {
+		var fieldErr *config.FieldError
+		if errors.As(err, &fieldErr) {
+			return NewErrorResponse(fmt.Sprintf("invalid station: %v", err))
+		}
+		log.Printf("[CONFIG] Failed to save config: %v", err)
+		return NewErrorResponse(fmt.Sprintf("failed to save config: %v", err))
+	}
+	return nil
+}
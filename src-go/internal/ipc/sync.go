@@ -0,0 +1,210 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/analysis"
+	"github.com/austinkregel/local-media/musicd/internal/cue"
+	"github.com/austinkregel/local-media/musicd/internal/library"
+	"github.com/austinkregel/local-media/musicd/internal/queue"
+)
+
+// syncDataVersion is the version of SyncData exportSync writes and
+// importSync reads
+const syncDataVersion = 1
+
+// handleExportSync returns this machine's ratings, play counts and bookmarks,
+// keyed by fingerprint. Tracks whose files can't be read are left out.
+func (s *Server) handleExportSync() *Response {
+	tracks := make(map[string]*SyncTrack)
+	hashes := s.storedFileHashes()
+	skipped := 0
+	track := func(path string) *SyncTrack {
+		fingerprint, err := s.syncFingerprint(path, hashes)
+		if err != nil {
+			skipped++
+			return nil
+		}
+		if t, ok := tracks[fingerprint]; ok {
+			return t
+		}
+		t := &SyncTrack{Path: path}
+		tracks[fingerprint] = t
+		return t
+	}
+
+	for path, record := range s.ratings.Records() {
+		if t := track(path); t != nil {
+			t.Rating = &SyncRating{Stars: record.Stars, Favorite: record.Favorite, Updated: record.Updated}
+		}
+	}
+	if s.playCounts != nil {
+		for path, play := range s.playCounts.All() {
+			if t := track(path); t != nil {
+				t.PlayCount = &SyncPlayCount{Count: play.Count, LastPlayed: play.LastPlayed}
+			}
+		}
+	}
+	if s.bookmarkStore != nil {
+		for path, marks := range s.bookmarkStore.All() {
+			if t := track(path); t != nil {
+				for _, b := range marks {
+					t.Bookmarks = append(t.Bookmarks, toIPCBookmark(b))
+				}
+			}
+		}
+	}
+
+	result := SyncData{
+		Version:    syncDataVersion,
+		ExportedAt: time.Now().UnixMilli(),
+		Tracks:     make(map[string]SyncTrack, len(tracks)),
+	}
+	for fingerprint, t := range tracks {
+		result.Tracks[fingerprint] = *t
+	}
+	log.Printf("[SYNC] Exported %d tracks (%d unreadable skipped)", len(result.Tracks), skipped)
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// handleImportSync merges another machine's exported data into this one's.
+// Each rating and play count is taken if it changed later than this
+// machine's; bookmarks this machine lacks are added.
+func (s *Server) handleImportSync(ctx context.Context, req *Request) *Response {
+	var data SyncData
+	if err := json.Unmarshal(req.Data, &data); err != nil {
+		return NewErrorResponse("invalid importSync request")
+	}
+	if data.Version != syncDataVersion {
+		return NewErrorResponse(fmt.Sprintf("unsupported sync data version %d", data.Version))
+	}
+
+	ratings := make(map[string]library.RatingRecord)
+	plays := make(map[string]queue.PlayCount)
+	bookmarks := make(map[string][]queue.Bookmark)
+	matcher := s.newSyncMatcher()
+	result := ImportSyncResponse{}
+	for fingerprint, t := range data.Tracks {
+		paths := matcher.match(fingerprint, t.Path)
+		if len(paths) == 0 {
+			result.Unmatched++
+			continue
+		}
+		// Found by fingerprint, identical copies of a file all get its data
+		for _, path := range paths {
+			if t.Rating != nil {
+				ratings[path] = library.RatingRecord{
+					Rating:  library.Rating{Stars: t.Rating.Stars, Favorite: t.Rating.Favorite},
+					Updated: t.Rating.Updated,
+				}
+			}
+			if t.PlayCount != nil {
+				plays[path] = queue.PlayCount{Count: t.PlayCount.Count, LastPlayed: t.PlayCount.LastPlayed}
+			}
+			for _, b := range t.Bookmarks {
+				bookmarks[path] = append(bookmarks[path], queue.Bookmark{
+					PositionMs: b.PositionMs,
+					Note:       b.Note,
+					Created:    b.Created,
+				})
+			}
+		}
+	}
+
+	var err error
+	if result.Ratings, err = s.ratings.Merge(ratings); err != nil {
+		return NewErrorResponse(fmt.Sprintf("failed to save ratings: %v", err))
+	}
+	if s.playCounts != nil {
+		if result.PlayCounts, err = s.playCounts.Merge(plays); err != nil {
+			return NewErrorResponse(fmt.Sprintf("failed to save play counts: %v", err))
+		}
+	}
+	if s.bookmarkStore != nil {
+		if result.Bookmarks, err = s.bookmarkStore.Merge(bookmarks); err != nil {
+			return NewErrorResponse(fmt.Sprintf("failed to save bookmarks: %v", err))
+		}
+	}
+	log.Printf("[SYNC] Imported %d ratings, %d play counts, %d bookmarks; %d of %d tracks unmatched",
+		result.Ratings, result.PlayCounts, result.Bookmarks, result.Unmatched, len(data.Tracks))
+
+	s.broadcastPushBy(actorFrom(ctx), "syncImported", result)
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+// storedFileHashes returns the content hashes kept with analyzed tracks, so
+// those files don't need reading again
+func (s *Server) storedFileHashes() map[string]string {
+	hashes := make(map[string]string)
+	if s.featureStore == nil {
+		return hashes
+	}
+	for path, hash := range s.featureStore.FileHashes() {
+		if analysis.IsContentHash(hash) {
+			hashes[path] = hash
+		}
+	}
+	return hashes
+}
+
+// syncFingerprint returns the content hash of a track, from hashes if it was
+// analyzed. A track of a CUE sheet is the sheet's hash and its number.
+func (s *Server) syncFingerprint(path string, hashes map[string]string) (string, error) {
+	if sheetPath, number, ok := cue.SplitTrackPath(path); ok {
+		hash, err := analysis.FileHash(sheetPath)
+		if err != nil {
+			return "", err
+		}
+		return hash + "#" + strconv.Itoa(number), nil
+	}
+	if hash, ok := hashes[path]; ok {
+		return hash, nil
+	}
+	return analysis.FileHash(path)
+}
+
+// syncMatcher finds the library tracks with a fingerprint. The library is
+// only fingerprinted if a track isn't at the path the other machine had it.
+type syncMatcher struct {
+	s      *Server
+	hashes map[string]string   // Stored hashes by path
+	byHash map[string][]string // Library paths by hash, once built
+}
+
+func (s *Server) newSyncMatcher() *syncMatcher {
+	return &syncMatcher{s: s, hashes: s.storedFileHashes()}
+}
+
+// match returns the library tracks with fingerprint, trying path first
+func (m *syncMatcher) match(fingerprint, path string) []string {
+	if _, ok := m.s.libraryIndex.Get(path); ok {
+		if hash, err := m.s.syncFingerprint(path, m.hashes); err == nil && hash == fingerprint {
+			return []string{path}
+		}
+	}
+
+	if m.byHash == nil {
+		tracks, _ := m.s.libraryIndex.Tracks(library.Facets{}, 0, 0)
+		m.byHash = make(map[string][]string, len(tracks))
+		for _, t := range tracks {
+			if hash, err := m.s.syncFingerprint(t.Path, m.hashes); err == nil {
+				m.byHash[hash] = append(m.byHash[hash], t.Path)
+			}
+		}
+	}
+	return m.byHash[fingerprint]
+}
@@ -0,0 +1,113 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/austinkregel/local-media/musicd/internal/library"
+	"github.com/austinkregel/local-media/musicd/internal/tags"
+)
+
+// maxTagEdits caps the files changed by one setTrackTags request
+const maxTagEdits = 500
+
+// applyTagEdit returns t with the edit's tags applied
+func applyTagEdit(t library.Track, e tags.Edit) library.Track {
+	text := func(dst *string, v *string) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	number := func(dst *int, v *int) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	text(&t.Title, e.Title)
+	text(&t.Artist, e.Artist)
+	text(&t.Album, e.Album)
+	text(&t.AlbumArtist, e.AlbumArtist)
+	text(&t.Genre, e.Genre)
+	number(&t.Year, e.Year)
+	number(&t.TrackNumber, e.TrackNumber)
+	number(&t.DiscNumber, e.DiscNumber)
+	return t
+}
+
+func toTagEdit(e TrackTagEdit) tags.Edit {
+	return tags.Edit{
+		Title:       e.Title,
+		Artist:      e.Artist,
+		Album:       e.Album,
+		AlbumArtist: e.AlbumArtist,
+		Genre:       e.Genre,
+		Year:        e.Year,
+		TrackNumber: e.TrackNumber,
+		DiscNumber:  e.DiscNumber,
+		ArtPath:     e.ArtPath,
+	}
+}
+
+// handleSetTrackTags writes tags to one or more files and updates the
+// library index to match. Each edit succeeds or fails on its own.
+func (s *Server) handleSetTrackTags(ctx context.Context, req *Request) *Response {
+	var tagsReq SetTrackTagsRequest
+	if err := json.Unmarshal(req.Data, &tagsReq); err != nil || len(tagsReq.Edits) == 0 {
+		return NewErrorResponse("invalid tags request")
+	}
+	if len(tagsReq.Edits) > maxTagEdits {
+		return NewErrorResponse(fmt.Sprintf("invalid tags request: at most %d edits per request", maxTagEdits))
+	}
+
+	libraryPaths := s.configMgr.Get().LibraryPaths
+	result := SetTrackTagsResponse{
+		Results: make([]TrackTagsResult, len(tagsReq.Edits)),
+		DryRun:  tagsReq.DryRun,
+	}
+
+	for i, reqEdit := range tagsReq.Edits {
+		res := &result.Results[i]
+		res.Path = reqEdit.Path
+
+		edit := toTagEdit(reqEdit)
+		err := edit.Validate()
+		switch {
+		case err != nil:
+		case reqEdit.Path == "" || !inLibrary(reqEdit.Path, libraryPaths):
+			err = fmt.Errorf("track is not in the library")
+		case edit.IsEmpty():
+			err = fmt.Errorf("no tags to write")
+		case !tagsReq.DryRun:
+			err = tags.Write(ctx, reqEdit.Path, edit)
+		}
+		if err != nil {
+			res.Error = err.Error()
+			result.Failed++
+			continue
+		}
+
+		if t, ok := s.libraryIndex.Get(reqEdit.Path); ok {
+			t = applyTagEdit(t, edit)
+			track := toLibraryTrack(t)
+			res.Track = &track
+			if !tagsReq.DryRun {
+				s.libraryIndex.Update(t)
+			}
+		}
+		if !tagsReq.DryRun {
+			result.Written++
+		}
+	}
+
+	if !tagsReq.DryRun {
+		log.Printf("[SCANNER] Wrote tags to %d files (%d failed)", result.Written, result.Failed)
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
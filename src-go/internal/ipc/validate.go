@@ -0,0 +1,263 @@
+package ipc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/auth"
+)
+
+const (
+	// maxStringBytes caps every string in a request's data
+	maxStringBytes = 64 << 10
+
+	// maxPathBytes caps the paths of files a request names
+	maxPathBytes = 4096
+)
+
+// fieldRule checks one field of a command's data. field is the way to it
+// through the JSON, going into every element of the arrays on the way.
+type fieldRule struct {
+	field    []string
+	path     bool    // A file path, or a list of them
+	min, max float64 // Otherwise the range a number is clamped to
+}
+
+func pathField(field ...string) fieldRule {
+	return fieldRule{field: field, path: true}
+}
+
+func numberField(min, max float64, field ...string) fieldRule {
+	return fieldRule{field: field, min: min, max: max}
+}
+
+// requestRules are the fields of each command that validateRequest checks
+// before the command's handler sees it
+var requestRules = map[CommandType][]fieldRule{
+	CmdPlay:               {pathField("path"), pathField("metadata", "artPath")},
+	CmdQueue:              {pathField("items", "path")},
+	CmdPlayPath:           {pathField("path")},
+	CmdSeek:               {numberField(0, math.Inf(1), "position")},
+	CmdVolume:             {numberField(0, 1, "level")},
+	CmdAdjustVolume:       {numberField(-100, 100, "deltaPercent")},
+	CmdSetClientMaxVolume: {numberField(0, 1, "maxVolume")},
+	CmdSetZoneVolume:      {numberField(0, 1, "volume")},
+	CmdDuck:               {numberField(0, 1, "level"), numberField(0, math.Inf(1), "durationMs")},
+	CmdAnnounce:           {numberField(0, 1, "level")},
+	CmdStatusSince:        {numberField(0, 60000, "timeoutMs")},
+	CmdSetRating:          {numberField(0, 5, "rating")},
+	CmdGetDiscoveryStats:  {numberField(0, 365, "days")},
+	CmdStartFocusSession:  {pathField("tracks")},
+	CmdSetTrackTags:       {pathField("edits", "path"), pathField("edits", "artPath")},
+	CmdRetryQuarantined:   {pathField("paths")},
+	CmdIdentifyTrack:      {pathField("path")},
+	CmdGetPreview:         {pathField("path"), numberField(0, maxPreviewSeconds, "seconds")},
+	CmdPreviewPlay:        {pathField("path"), numberField(0, math.Inf(1), "startMs"), numberField(0, math.Inf(1), "lengthMs")},
+	CmdAddBookmark:        {pathField("path")},
+	CmdJumpToBookmark:     {pathField("path")},
+	CmdSetSchedule:        {pathField("tracks"), pathField("similarTo")},
+	CmdGetTrackFeatures:   {pathField("trackPath"), pathField("path")},
+	CmdGetWaveform:        {pathField("trackPath")},
+	CmdSetTrackGain:       {pathField("path")},
+	CmdSetIntroSkip:       {pathField("path")},
+	CmdGetSimilarTracks:   {pathField("trackPath")},
+	CmdExplainSimilarity:  {pathField("trackA"), pathField("trackB")},
+	CmdRelocateLibrary:    {pathField("to")},
+}
+
+// pathPolicy is where the files a request names may be
+type pathPolicy struct {
+	roots    []string // The library folders, and musicd's caches in sandbox mode
+	anywhere bool     // Files outside them are allowed too
+	sandbox  bool     // Symlinks must lead inside them as well
+
+	// streamHosts are the hosts stream URLs may come from in sandbox mode
+	streamHosts []string
+}
+
+// pathPolicy returns where the files client names may be. Sandbox mode
+// holds every client to the library, whatever its scopes.
+func (s *Server) pathPolicy(client auth.ClientInfo) pathPolicy {
+	cfg := s.configMgr.Get()
+	if cfg.Auth.Sandbox {
+		return s.sandboxPolicy(cfg)
+	}
+	return pathPolicy{
+		roots:    cfg.LibraryPaths,
+		anywhere: client.HasScope(auth.ScopeAnyPath),
+	}
+}
+
+// check returns an error response if path may not be named, or nil. Stream
+// URLs aren't files, so they may be unless sandbox mode holds them to its
+// hosts.
+func (p pathPolicy) check(path string) *Response {
+	if path == "" {
+		return nil
+	}
+	if audio.IsStreamURL(path) {
+		return p.checkStream(path)
+	}
+	if len(path) > maxPathBytes || strings.IndexByte(path, 0) >= 0 {
+		return newValidationError(ErrCodeInvalidRequest, "invalid path")
+	}
+	if !filepath.IsAbs(path) {
+		return newValidationError(ErrCodeInvalidRequest, "path must be absolute: "+path)
+	}
+	if p.anywhere {
+		return nil
+	}
+	if p.sandbox {
+		if !inLibrary(filepath.Clean(path), p.roots) {
+			return newValidationError(ErrCodePathNotAllowed, "path is outside the library and cache folders (sandbox mode): "+path)
+		}
+		if !p.leadsInside(path) {
+			return newValidationError(ErrCodePathNotAllowed, "path links outside the library and cache folders (sandbox mode): "+path)
+		}
+		return nil
+	}
+	if !inLibrary(filepath.Clean(path), p.roots) {
+		return newValidationError(ErrCodePathNotAllowed, "path is outside the library folders: "+path)
+	}
+	return nil
+}
+
+// checkStream returns an error response if the stream at rawURL may not be
+// played, or nil
+func (p pathPolicy) checkStream(rawURL string) *Response {
+	if !p.sandbox {
+		return nil
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		for _, host := range p.streamHosts {
+			if strings.EqualFold(u.Hostname(), host) {
+				return nil
+			}
+		}
+	}
+	return newValidationError(ErrCodePathNotAllowed, "stream is not from one of the allowed hosts (sandbox mode): "+rawURL)
+}
+
+// newValidationError creates an error response for a request turned away
+// before reaching its handler
+func newValidationError(code, message string) *Response {
+	return &Response{
+		Success: false,
+		Error:   message,
+		Code:    code,
+	}
+}
+
+// validateRequest applies the checks every command shares to a request's
+// data: strings are bounded, file paths must be absolute and allowed by
+// policy, and numbers are clamped to their ranges, rewriting req.Data if any
+// were. Returns an error response, or nil if the request may go ahead.
+func validateRequest(req *Request, policy pathPolicy) *Response {
+	if len(req.Data) == 0 {
+		return nil
+	}
+	// Numbers are kept as written, so IDs too large for a float64 survive
+	decoder := json.NewDecoder(bytes.NewReader(req.Data))
+	decoder.UseNumber()
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return newValidationError(ErrCodeInvalidRequest, fmt.Sprintf("invalid %s request", req.Cmd))
+	}
+	if !stringsBounded(data) {
+		return newValidationError(ErrCodeInvalidRequest, fmt.Sprintf("string longer than %d bytes", maxStringBytes))
+	}
+
+	var failure *Response
+	clamped := false
+	for _, rule := range requestRules[req.Cmd] {
+		data = visitField(data, rule.field, func(v interface{}) interface{} {
+			if rule.path {
+				if path, ok := v.(string); ok && failure == nil {
+					failure = policy.check(path)
+				}
+				return v
+			}
+			number, ok := v.(json.Number)
+			if !ok {
+				return v
+			}
+			f, err := number.Float64()
+			if err != nil {
+				return v
+			}
+			if c := math.Max(rule.min, math.Min(f, rule.max)); c != f {
+				clamped = true
+				return c
+			}
+			return v
+		})
+	}
+	if failure != nil {
+		return failure
+	}
+
+	if clamped {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return NewErrorResponse("internal error")
+		}
+		req.Data = encoded
+	}
+	return nil
+}
+
+// visitField replaces each value at field within v with what fn returns
+// for it, going into every element of the arrays on the way
+func visitField(v interface{}, field []string, fn func(interface{}) interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = visitField(v[i], field, fn)
+		}
+		return v
+	case map[string]interface{}:
+		if len(field) == 0 {
+			return fn(v)
+		}
+		// Handlers decode with encoding/json, which matches keys whatever
+		// their case, so every spelling of the field is visited
+		for key, child := range v {
+			if strings.EqualFold(key, field[0]) {
+				v[key] = visitField(child, field[1:], fn)
+			}
+		}
+		return v
+	}
+	if len(field) == 0 {
+		return fn(v)
+	}
+	return v
+}
+
+// stringsBounded reports whether every string in v, keys included, is at
+// most maxStringBytes long
+func stringsBounded(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		return len(v) <= maxStringBytes
+	case []interface{}:
+		for _, e := range v {
+			if !stringsBounded(e) {
+				return false
+			}
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			if len(k) > maxStringBytes || !stringsBounded(e) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package ipc
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateRequestPaths(t *testing.T) {
+	library := pathPolicy{roots: []string{"/music"}}
+	anywhere := pathPolicy{roots: []string{"/music"}, anywhere: true}
+
+	tests := []struct {
+		name   string
+		req    *Request
+		policy pathPolicy
+		code   string // "" if the request may go ahead
+	}{
+		{"in the library", &Request{Cmd: CmdPlay, Data: []byte(`{"path":"/music/a.flac"}`)}, library, ""},
+		{"outside the library", &Request{Cmd: CmdPlay, Data: []byte(`{"path":"/etc/passwd"}`)}, library, ErrCodePathNotAllowed},
+		{"out through ..", &Request{Cmd: CmdPlay, Data: []byte(`{"path":"/music/../etc/passwd"}`)}, library, ErrCodePathNotAllowed},
+		{"allowed anywhere", &Request{Cmd: CmdPlay, Data: []byte(`{"path":"/tmp/a.flac"}`)}, anywhere, ""},
+		{"relative", &Request{Cmd: CmdPlay, Data: []byte(`{"path":"a.flac"}`)}, anywhere, ErrCodeInvalidRequest},
+		{"stream", &Request{Cmd: CmdPlay, Data: []byte(`{"path":"https://radio.example/live"}`)}, library, ""},
+		{"queued item", &Request{Cmd: CmdQueue, Data: []byte(`{"items":[{"path":"/music/a.flac"},{"path":"/home/b.flac"}]}`)}, library, ErrCodePathNotAllowed},
+		{"list of paths", &Request{Cmd: CmdStartFocusSession, Data: []byte(`{"tracks":["/music/a.flac","/srv/b.flac"]}`)}, library, ErrCodePathNotAllowed},
+		{"art with a track", &Request{Cmd: CmdPlay, Data: []byte(`{"path":"/music/a.flac","metadata":{"artPath":"/home/me/.ssh/id_rsa"}}`)}, library, ErrCodePathNotAllowed},
+		{"key in another case", &Request{Cmd: CmdPlay, Data: []byte(`{"Path":"/etc/passwd"}`)}, library, ErrCodePathNotAllowed},
+		{"nested key in another case", &Request{Cmd: CmdQueue, Data: []byte(`{"ITEMS":[{"pAtH":"/etc/passwd"}]}`)}, library, ErrCodePathNotAllowed},
+		{"key spelt twice", &Request{Cmd: CmdPlay, Data: []byte(`{"path":"/music/a.flac","PATH":"/etc/passwd"}`)}, library, ErrCodePathNotAllowed},
+		{"track features", &Request{Cmd: CmdGetTrackFeatures, Data: []byte(`{"path":"/srv/b.flac"}`)}, library, ErrCodePathNotAllowed},
+		{"waveform", &Request{Cmd: CmdGetWaveform, Data: []byte(`{"trackPath":"/srv/b.flac"}`)}, library, ErrCodePathNotAllowed},
+		{"track gain", &Request{Cmd: CmdSetTrackGain, Data: []byte(`{"path":"/srv/b.flac","gainDb":-3}`)}, library, ErrCodePathNotAllowed},
+		{"intro skip", &Request{Cmd: CmdSetIntroSkip, Data: []byte(`{"path":"/srv/b.flac","offsetMs":1000}`)}, library, ErrCodePathNotAllowed},
+		{"similar tracks", &Request{Cmd: CmdGetSimilarTracks, Data: []byte(`{"trackPath":"/srv/b.flac"}`)}, library, ErrCodePathNotAllowed},
+		{"explain similarity", &Request{Cmd: CmdExplainSimilarity, Data: []byte(`{"trackA":"/music/a.flac","trackB":"/srv/b.flac"}`)}, library, ErrCodePathNotAllowed},
+		{"relocate library", &Request{Cmd: CmdRelocateLibrary, Data: []byte(`{"from":"/music","to":"/srv"}`)}, library, ErrCodePathNotAllowed},
+		{"art to embed", &Request{Cmd: CmdSetTrackTags, Data: []byte(`{"edits":[{"path":"/music/a.flac","artPath":"/etc/shadow"}]}`)}, library, ErrCodePathNotAllowed},
+		{"bookmark", &Request{Cmd: CmdAddBookmark, Data: []byte(`{"path":"/srv/b.flac","positionMs":1000}`)}, library, ErrCodePathNotAllowed},
+		{"jump to bookmark", &Request{Cmd: CmdJumpToBookmark, Data: []byte(`{"path":"/srv/b.flac"}`)}, library, ErrCodePathNotAllowed},
+		{"scheduled tracks", &Request{Cmd: CmdSetSchedule, Data: []byte(`{"time":"07:00","tracks":["/srv/b.flac"]}`)}, library, ErrCodePathNotAllowed},
+		{"scheduled radio", &Request{Cmd: CmdSetSchedule, Data: []byte(`{"time":"07:00","similarTo":"/srv/b.flac"}`)}, library, ErrCodePathNotAllowed},
+		{"other commands", &Request{Cmd: CmdSetRating, Data: []byte(`{"path":"/srv/b.flac","rating":3}`)}, library, ""},
+		{"too long", &Request{Cmd: CmdPause, Data: []byte(`{"x":"` + strings.Repeat("a", maxStringBytes+1) + `"}`)}, anywhere, ErrCodeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := validateRequest(tt.req, tt.policy)
+			switch {
+			case tt.code == "" && resp != nil:
+				t.Errorf("Expected the request to go ahead, got %q", resp.Error)
+			case tt.code != "" && resp == nil:
+				t.Errorf("Expected %s, got nil", tt.code)
+			case tt.code != "" && resp.Code != tt.code:
+				t.Errorf("Expected %s, got %s (%q)", tt.code, resp.Code, resp.Error)
+			}
+		})
+	}
+}
+
+func TestSandboxPolicy(t *testing.T) {
+	library, cache, outside := t.TempDir(), t.TempDir(), t.TempDir()
+	for _, path := range []string{filepath.Join(library, "a.flac"), filepath.Join(outside, "secret.flac")} {
+		if err := os.WriteFile(path, []byte("audio"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.flac"), filepath.Join(library, "link.flac")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	os.Symlink(outside, filepath.Join(library, "Linked"))
+	os.Symlink(filepath.Join(library, "a.flac"), filepath.Join(library, "b.flac"))
+
+	policy := pathPolicy{roots: []string{library, cache}, sandbox: true}
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{filepath.Join(library, "a.flac"), true},
+		{filepath.Join(library, "b.flac"), true},
+		{filepath.Join(library, "missing.flac"), true},
+		{filepath.Join(cache, "copy.flac"), true},
+		{filepath.Join(outside, "secret.flac"), false},
+		{filepath.Join(library, "link.flac"), false},
+		{filepath.Join(library, "Linked", "secret.flac"), false},
+		{filepath.Join(library, "Linked", "missing.flac"), false},
+		{filepath.Join(library, "Linked", "image.cue") + "#2", false},
+	}
+	for _, tt := range tests {
+		resp := policy.check(tt.path)
+		if tt.ok && resp != nil {
+			t.Errorf("%s: expected allowed, got %q", tt.path, resp.Error)
+		}
+		if !tt.ok && (resp == nil || resp.Code != ErrCodePathNotAllowed) {
+			t.Errorf("%s: expected %s, got %+v", tt.path, ErrCodePathNotAllowed, resp)
+		}
+	}
+
+	policy.streamHosts = []string{"radio.example.com"}
+	for stream, ok := range map[string]bool{
+		"https://radio.example.com/live":     true,
+		"http://RADIO.example.com:8000/live": true,
+		"http://169.254.169.254/latest":      false,
+		"https://radio.example.com.evil/x":   false,
+	} {
+		if resp := policy.check(stream); (resp == nil) != ok {
+			t.Errorf("%s: expected allowed %v, got %+v", stream, ok, resp)
+		}
+	}
+
+	if got := policy.allowed([]string{filepath.Join(library, "a.flac"), filepath.Join(library, "link.flac")}); len(got) != 1 {
+		t.Errorf("Expected only the track in the library, got %v", got)
+	}
+}
+
+func TestValidateRequestClampsNumbers(t *testing.T) {
+	req := &Request{Cmd: CmdVolume, Data: []byte(`{"level":7}`)}
+	if resp := validateRequest(req, pathPolicy{}); resp != nil {
+		t.Fatalf("Expected the request to go ahead, got %q", resp.Error)
+	}
+	var volumeReq VolumeRequest
+	if err := json.Unmarshal(req.Data, &volumeReq); err != nil || volumeReq.Level != 1 {
+		t.Errorf("Expected the level clamped to 1, got %s", req.Data)
+	}
+	req = &Request{Cmd: CmdVolume, Data: []byte(`{"LEVEL":50}`)}
+	validateRequest(req, pathPolicy{})
+	volumeReq = VolumeRequest{}
+	if err := json.Unmarshal(req.Data, &volumeReq); err != nil || volumeReq.Level != 1 {
+		t.Errorf("Expected the level clamped to 1 whatever the key's case, got %s", req.Data)
+	}
+
+	// Untouched data is passed on as it was, large IDs and all
+	data := `{"revision":18446744073709551615,"timeoutMs":1000}`
+	req = &Request{Cmd: CmdStatusSince, Data: []byte(data)}
+	if resp := validateRequest(req, pathPolicy{}); resp != nil || string(req.Data) != data {
+		t.Errorf("Expected the data unchanged, got %s", req.Data)
+	}
+	req = &Request{Cmd: CmdStatusSince, Data: []byte(`{"revision":18446744073709551615,"timeoutMs":-5}`)}
+	validateRequest(req, pathPolicy{})
+	var sinceReq StatusSinceRequest
+	if err := json.Unmarshal(req.Data, &sinceReq); err != nil || sinceReq.Revision != 18446744073709551615 || sinceReq.TimeoutMs != 0 {
+		t.Errorf("Expected only the timeout clamped, got %s", req.Data)
+	}
+}
+
+func FuzzValidateRequest(f *testing.F) {
+	f.Add("play", []byte(`{"path":"/music/a.flac"}`))
+	f.Add("queue", []byte(`{"items":[{"path":"/music/a.flac"},{"path":"b"}],"append":true}`))
+	f.Add("volume", []byte(`{"level":1e308}`))
+	f.Add("startFocusSession", []byte(`{"tracks":[["/x"]],"minutes":5}`))
+	f.Add("setTrackTags", []byte(`{"edits":{"path":7}}`))
+
+	policy := pathPolicy{roots: []string{"/music"}}
+	f.Fuzz(func(t *testing.T, cmd string, data []byte) {
+		if !json.Valid(data) {
+			return // Can't get past DecodeRequest
+		}
+		req := &Request{Cmd: CommandType(cmd), Data: data}
+		resp := validateRequest(req, policy)
+		if resp != nil {
+			if resp.Success || resp.Code == "" {
+				t.Fatalf("Expected a structured error, got %+v", resp)
+			}
+			return
+		}
+		if !json.Valid(req.Data) {
+			t.Fatalf("Validated data is not JSON: %s", req.Data)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+
+	"github.com/austinkregel/local-media/musicd/internal/auth"
+)
+
+// volumeLimitKey is the context key for the client whose volume limit
+// applies to a command
+type volumeLimitKey struct{}
+
+// withVolumeLimit returns ctx carrying client's volume limit
+func withVolumeLimit(ctx context.Context, client auth.ClientInfo) context.Context {
+	return context.WithValue(ctx, volumeLimitKey{}, client)
+}
+
+// limitVolume returns the volume the client running ctx's command gets when
+// it asks for level while the volume is at current. The daemon's own
+// actions aren't limited.
+func limitVolume(ctx context.Context, level, current float64) float64 {
+	client, ok := ctx.Value(volumeLimitKey{}).(auth.ClientInfo)
+	if !ok {
+		return level
+	}
+	if limited := client.LimitVolume(level, current); limited != level {
+		log.Printf("[PLAYER] Client %s is limited to %.0f%% volume", client.ID, client.MaxVolume*100)
+		return limited
+	}
+	return level
+}
+
+// handleAdjustVolume turns the volume up or down by a number of percentage
+// points, which suits volume keys better than setting a level
+func (s *Server) handleAdjustVolume(ctx context.Context, req *Request) *Response {
+	var adjustReq AdjustVolumeRequest
+	if err := json.Unmarshal(req.Data, &adjustReq); err != nil {
+		return NewErrorResponse("invalid adjustVolume request")
+	}
+	if adjustReq.DeltaPercent < -100 || adjustReq.DeltaPercent > 100 {
+		return NewErrorResponse("deltaPercent must be between -100 and 100")
+	}
+
+	current := s.player.Volume()
+	// Rounded to a tenth of a point so repeated steps don't drift
+	level := math.Round((current*100+adjustReq.DeltaPercent)*10) / 1000
+	level = limitVolume(ctx, min(max(level, 0), 1), current)
+
+	log.Printf("[PLAYER] Adjust volume by %+.1f%% to: %.2f", adjustReq.DeltaPercent, level)
+	if err := s.player.SetVolume(level); err != nil {
+		log.Printf("[PLAYER] Volume change failed: %v", err)
+		return NewErrorResponse(err.Error())
+	}
+
+	return s.handleStatus()
+}
+
+func (s *Server) handleSetClientMaxVolume(req *Request) *Response {
+	var limitReq SetClientMaxVolumeRequest
+	if err := json.Unmarshal(req.Data, &limitReq); err != nil || limitReq.ClientID == "" {
+		return NewErrorResponse("invalid setClientMaxVolume request")
+	}
+
+	if err := s.authManager.SetClientMaxVolume(limitReq.ClientID, limitReq.MaxVolume); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	log.Printf("[AUTH] Set max volume for client %s: %.2f", limitReq.ClientID, limitReq.MaxVolume)
+	return s.handleListClients()
+}
@@ -0,0 +1,152 @@
+package ipc
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// maxQueuedMessages caps responses and push messages waiting for a
+	// client. A client this far behind has stopped reading and is dropped.
+	maxQueuedMessages = 256
+
+	// maxQueuedFrames caps visualization frames waiting for a client. Frames
+	// are only useful while fresh, so the oldest is dropped to make room.
+	maxQueuedFrames = 4
+
+	// writeTimeout bounds a single write to a client
+	writeTimeout = 5 * time.Second
+)
+
+var (
+	errWriterClosed = errors.New("connection closed")
+	errSlowClient   = errors.New("client is not reading")
+)
+
+// connWriter owns every write to one client connection. Messages are queued
+// and written by the writer's goroutine, so a client that stops reading
+// cannot block the audio callback, request handling or other clients.
+type connWriter struct {
+	conn net.Conn
+
+	mu     sync.Mutex
+	queue  [][]byte // Responses and push messages, never dropped
+	frames [][]byte // Visualization frames, oldest dropped when full
+	closed bool
+
+	wake chan struct{} // Signalled when something is queued
+	done chan struct{}
+}
+
+func newConnWriter(conn net.Conn) *connWriter {
+	w := &connWriter{
+		conn: conn,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// send queues a message that must be delivered. If the client has fallen
+// too far behind, the connection is closed and errSlowClient returned.
+func (w *connWriter) send(msg []byte) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return errWriterClosed
+	}
+	if len(w.queue) >= maxQueuedMessages {
+		w.mu.Unlock()
+		w.close()
+		return errSlowClient
+	}
+	w.queue = append(w.queue, msg)
+	w.mu.Unlock()
+
+	w.signal()
+	return nil
+}
+
+// sendFrame queues a visualization frame, dropping the oldest queued frame
+// if the client hasn't kept up. Returns false if the connection is closed.
+func (w *connWriter) sendFrame(frame []byte) bool {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return false
+	}
+	if len(w.frames) >= maxQueuedFrames {
+		w.frames = w.frames[1:]
+		droppedFrames.Inc()
+	}
+	w.frames = append(w.frames, frame)
+	w.mu.Unlock()
+
+	w.signal()
+	return true
+}
+
+func (w *connWriter) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next pops the next message to write, preferring messages over frames so
+// responses aren't delayed behind visualization data
+func (w *connWriter) next() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.queue) > 0 {
+		msg := w.queue[0]
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+		return msg
+	}
+	if len(w.frames) > 0 {
+		frame := w.frames[0]
+		w.frames = w.frames[1:]
+		return frame
+	}
+	return nil
+}
+
+func (w *connWriter) run() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.wake:
+		}
+
+		for msg := w.next(); msg != nil; msg = w.next() {
+			w.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if _, err := w.conn.Write(msg); err != nil {
+				// Closing the connection also ends its read loop, which
+				// cleans up the client's subscriptions
+				w.close()
+				return
+			}
+		}
+	}
+}
+
+// close stops the writer and closes the connection. Queued data is discarded.
+func (w *connWriter) close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	w.queue, w.frames = nil, nil
+	w.mu.Unlock()
+
+	close(w.done)
+	w.conn.Close()
+}
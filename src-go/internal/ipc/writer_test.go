@@ -0,0 +1,77 @@
+package ipc
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnWriterDeliversInOrder(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	w := newConnWriter(server)
+	defer w.close()
+
+	w.send([]byte("first\n"))
+	w.sendFrame([]byte("frame\n"))
+	w.send([]byte("second\n"))
+
+	reader := bufio.NewReader(client)
+	got := make([]string, 0, 3)
+	for i := 0; i < 3; i++ {
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		got = append(got, line)
+	}
+
+	// Frames may be overtaken by messages, but messages keep their order
+	first, second := -1, -1
+	for i, line := range got {
+		switch line {
+		case "first\n":
+			first = i
+		case "second\n":
+			second = i
+		}
+	}
+	if first < 0 || second < first {
+		t.Errorf("Expected messages in order, got %q", got)
+	}
+}
+
+func TestConnWriterSlowClient(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	w := newConnWriter(server)
+	defer w.close()
+
+	// Nothing reads from client, so the writer blocks on the first write
+
+	for i := 0; i < maxQueuedFrames*3; i++ {
+		if !w.sendFrame([]byte{byte(i)}) {
+			t.Fatal("Expected frames to be accepted while connected")
+		}
+	}
+	w.mu.Lock()
+	frames := len(w.frames)
+	newest := w.frames[len(w.frames)-1][0]
+	w.mu.Unlock()
+	if frames != maxQueuedFrames || int(newest) != maxQueuedFrames*3-1 {
+		t.Errorf("Expected the %d newest frames to be kept, got %d ending in %d", maxQueuedFrames, frames, newest)
+	}
+
+	var err error
+	for i := 0; i < maxQueuedMessages+2 && err == nil; i++ {
+		err = w.send([]byte("msg\n"))
+	}
+	if err != errSlowClient {
+		t.Fatalf("Expected errSlowClient once the queue is full, got %v", err)
+	}
+	if w.sendFrame([]byte{0}) {
+		t.Error("Expected frames to be refused after disconnecting")
+	}
+}
@@ -0,0 +1,55 @@
+package ipc
+
+import (
+	"encoding/json"
+	"log"
+)
+
+func (s *Server) handleListZones() *Response {
+	result := ListZonesResponse{Zones: []Zone{}}
+	for _, z := range s.player.Zones() {
+		result.Zones = append(result.Zones, Zone{
+			Name:    z.Name,
+			Local:   z.Local,
+			Enabled: z.Enabled,
+			Volume:  z.Volume,
+			Error:   z.Error,
+		})
+	}
+
+	resp, err := NewSuccessResponse(result)
+	if err != nil {
+		return NewErrorResponse("internal error")
+	}
+	return resp
+}
+
+func (s *Server) handleEnableZone(req *Request) *Response {
+	var zoneReq ZoneRequest
+	if err := json.Unmarshal(req.Data, &zoneReq); err != nil || zoneReq.Name == "" {
+		return NewErrorResponse("invalid zone request")
+	}
+
+	if err := s.player.EnableZone(zoneReq.Name, zoneReq.Enabled); err != nil {
+		log.Printf("[PLAYER] Failed to enable zone %s: %v", zoneReq.Name, err)
+		return NewErrorResponse(err.Error())
+	}
+	log.Printf("[PLAYER] Zone %s enabled: %v", zoneReq.Name, zoneReq.Enabled)
+
+	return s.handleListZones()
+}
+
+func (s *Server) handleSetZoneVolume(req *Request) *Response {
+	var zoneReq ZoneRequest
+	if err := json.Unmarshal(req.Data, &zoneReq); err != nil || zoneReq.Name == "" {
+		return NewErrorResponse("invalid zone request")
+	}
+
+	if err := s.player.SetZoneVolume(zoneReq.Name, zoneReq.Volume); err != nil {
+		log.Printf("[PLAYER] Zone volume change failed: %v", err)
+		return NewErrorResponse(err.Error())
+	}
+	log.Printf("[PLAYER] Set zone %s volume to: %.2f", zoneReq.Name, zoneReq.Volume)
+
+	return s.handleListZones()
+}
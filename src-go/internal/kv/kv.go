@@ -0,0 +1,431 @@
+// Package kv is a small embedded key-value store for data kept as many small
+// records. Writes are appended to a log file in checksummed batches, so a
+// crash loses at most the batch being written, and the log is compacted once
+// most of it holds values that were since replaced.
+//
+// It stands in for bbolt or SQLite, which the analysis store would otherwise
+// use. SQLite needs cgo, and the Windows daemon is built without it. bbolt
+// maps the whole file into memory and never gives space back without a copy
+// to a new file, which for a store of feature vectors that are replaced on
+// every re-analysis means a file that only grows. What the analysis store
+// needs is small: one writer, atomic batches, every key in memory and values
+// read by key, which an append-only log covers in a few hundred lines that
+// the tests put through crashes and corruption.
+package kv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// batchHeaderSize is the payload length and CRC-32 before each batch
+	batchHeaderSize = 8
+
+	opPut    byte = 1
+	opDelete byte = 2
+
+	// compactMinBytes is the log size below which it is never compacted
+	compactMinBytes = 1 << 20
+
+	// compactBatchBytes is roughly how much a compacted log puts in a batch
+	compactBatchBytes = 4 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errCorrupt marks a batch that is incomplete or fails its checksum
+var errCorrupt = errors.New("corrupt batch")
+
+// location is where a value is in the log
+type location struct {
+	offset int64
+	size   int
+}
+
+// DB is a key-value store kept in a single log file. It is safe for
+// concurrent use.
+type DB struct {
+	mu    sync.RWMutex
+	path  string
+	file  *os.File
+	size  int64 // End of the last complete batch
+	live  int64 // Bytes of the keys and values in use
+	index map[string]location
+}
+
+// Open opens the store at path, creating it if needed. A batch left
+// incomplete by a crash is discarded.
+func Open(path string) (*DB, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{path: path, file: file}
+	if err := db.readLog(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// readLog builds the index from the log, cutting off anything after the last
+// complete batch
+func (db *DB) readLog() error {
+	db.index = make(map[string]location)
+	db.size, db.live = 0, 0
+
+	info, err := db.file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := db.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(db.file)
+	for {
+		payload, err := readBatch(r, info.Size()-db.size)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errCorrupt) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// Written partly when the daemon stopped
+			if err := db.file.Truncate(db.size); err != nil {
+				return fmt.Errorf("truncate incomplete batch: %w", err)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := db.apply(payload, db.size+batchHeaderSize); err != nil {
+			return err
+		}
+		db.size += batchHeaderSize + int64(len(payload))
+	}
+	return nil
+}
+
+// readBatch reads the next batch's payload, checking it against its checksum.
+// remaining is how much of the file is left, which a length read from a
+// damaged header can't be trusted to stay within.
+func readBatch(r io.Reader, remaining int64) ([]byte, error) {
+	var header [batchHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(header[0:4])
+	sum := binary.LittleEndian.Uint32(header[4:8])
+	if int64(length) > remaining-batchHeaderSize {
+		return nil, errCorrupt
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(payload, crcTable) != sum {
+		return nil, errCorrupt
+	}
+	return payload, nil
+}
+
+// apply updates the index with the operations of a batch whose payload
+// starts at offset in the log
+func (db *DB) apply(payload []byte, offset int64) error {
+	for pos := 0; pos < len(payload); {
+		op := payload[pos]
+		pos++
+		key, n, err := readBytes(payload[pos:])
+		if err != nil {
+			return err
+		}
+		pos += n
+
+		db.drop(string(key))
+		switch op {
+		case opPut:
+			value, n, err := readBytes(payload[pos:])
+			if err != nil {
+				return err
+			}
+			db.index[string(key)] = location{offset: offset + int64(pos+n-len(value)), size: len(value)}
+			db.live += int64(len(key) + len(value))
+			pos += n
+		case opDelete:
+		default:
+			return fmt.Errorf("%w: unknown operation %d", errCorrupt, op)
+		}
+	}
+	return nil
+}
+
+// drop forgets the value of key in the index
+func (db *DB) drop(key string) {
+	if loc, ok := db.index[key]; ok {
+		db.live -= int64(len(key) + loc.size)
+		delete(db.index, key)
+	}
+}
+
+// readBytes reads a length-prefixed byte string, returning it and the number
+// of bytes read
+func readBytes(buf []byte) ([]byte, int, error) {
+	length, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < length {
+		return nil, 0, fmt.Errorf("%w: truncated record", errCorrupt)
+	}
+	return buf[n : n+int(length)], n + int(length), nil
+}
+
+// Close closes the log file
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.file.Close()
+}
+
+// Get returns the value of key, and false if there is none
+func (db *DB) Get(key string) ([]byte, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	loc, ok := db.index[key]
+	if !ok {
+		return nil, false, nil
+	}
+	value := make([]byte, loc.size)
+	if _, err := db.file.ReadAt(value, loc.offset); err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Len returns the number of keys
+func (db *DB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.index)
+}
+
+// Keys returns the keys starting with prefix, sorted
+func (db *DB) Keys(prefix string) []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var keys []string
+	for key := range db.index {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ForEach calls fn with each key starting with prefix and its value, in the
+// order they are in the log, stopping at the first error. fn must not write
+// to the store.
+func (db *DB) ForEach(prefix string, fn func(key string, value []byte) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	keys := make([]string, 0, len(db.index))
+	for key := range db.index {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return db.index[keys[i]].offset < db.index[keys[j]].offset
+	})
+
+	for _, key := range keys {
+		loc := db.index[key]
+		value := make([]byte, loc.size)
+		if _, err := db.file.ReadAt(value, loc.offset); err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Batch is a set of writes made together
+type Batch struct {
+	payload []byte
+	count   int
+}
+
+// Put sets key to value
+func (b *Batch) Put(key string, value []byte) {
+	b.payload = append(b.payload, opPut)
+	b.payload = appendBytes(b.payload, []byte(key))
+	b.payload = appendBytes(b.payload, value)
+	b.count++
+}
+
+// Delete removes key
+func (b *Batch) Delete(key string) {
+	b.payload = append(b.payload, opDelete)
+	b.payload = appendBytes(b.payload, []byte(key))
+	b.count++
+}
+
+// Len returns the number of writes in the batch
+func (b *Batch) Len() int {
+	return b.count
+}
+
+func appendBytes(buf, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// Write applies a batch. It reaches the disk before Write returns, and after
+// a crash the store has either all of it or none of it. The log is compacted
+// afterwards if most of it is no longer in use; a compaction that fails is
+// logged and tried again on a later write, as the batch is written either
+// way.
+func (db *DB) Write(b *Batch) error {
+	if b.count == 0 {
+		return nil
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.append(db.file, db.size, b.payload); err != nil {
+		// Don't leave a partial batch for the next write to follow
+		db.file.Truncate(db.size)
+		return err
+	}
+	if err := db.apply(b.payload, db.size+batchHeaderSize); err != nil {
+		return err
+	}
+	db.size += batchHeaderSize + int64(len(b.payload))
+
+	if db.size > compactMinBytes && db.live < db.size/2 {
+		if err := db.compactLocked(); err != nil {
+			log.Printf("[KV] Failed to compact %s: %v", db.path, err)
+		}
+	}
+	return nil
+}
+
+// append writes a batch with payload at offset in file and syncs it
+func (db *DB) append(file *os.File, offset int64, payload []byte) error {
+	buf := make([]byte, batchHeaderSize, batchHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	buf = append(buf, payload...)
+
+	if _, err := file.WriteAt(buf, offset); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Compact rewrites the log with only the values in use
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.compactLocked()
+}
+
+// compactLocked writes the values in use to a new log and swaps it in for
+// the old one (must be called with lock held)
+func (db *DB) compactLocked() error {
+	tmpPath := db.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("compact: %w", err)
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("compact: %w", err)
+	}
+
+	keys := make([]string, 0, len(db.index))
+	for key := range db.index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var batch Batch
+	var offset int64
+	flush := func() error {
+		if batch.count == 0 {
+			return nil
+		}
+		if err := db.append(tmp, offset, batch.payload); err != nil {
+			return err
+		}
+		offset += batchHeaderSize + int64(len(batch.payload))
+		batch = Batch{}
+		return nil
+	}
+	for _, key := range keys {
+		loc := db.index[key]
+		value := make([]byte, loc.size)
+		if _, err := db.file.ReadAt(value, loc.offset); err != nil {
+			return fail(err)
+		}
+		batch.Put(key, value)
+		if len(batch.payload) >= compactBatchBytes {
+			if err := flush(); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("compact: %w", err)
+	}
+
+	// Windows can't rename over a file that is open
+	db.file.Close()
+	renameErr := os.Rename(tmpPath, db.path)
+	if renameErr != nil {
+		os.Remove(tmpPath)
+	} else {
+		syncDir(filepath.Dir(db.path))
+	}
+
+	file, err := os.OpenFile(db.path, os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("compact: reopen: %w", err)
+	}
+	db.file = file
+	if err := db.readLog(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return fmt.Errorf("compact: %w", renameErr)
+	}
+	return nil
+}
+
+// syncDir makes a rename in dir durable where the platform allows it
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,269 @@
+package kv
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func openTestDB(t *testing.T, path string) *DB {
+	t.Helper()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestWritesSurviveReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openTestDB(t, path)
+
+	var b Batch
+	b.Put("a", []byte("1"))
+	b.Put("b", []byte("2"))
+	b.Put("c", []byte("3"))
+	if err := db.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	b = Batch{}
+	b.Put("a", []byte("changed"))
+	b.Delete("b")
+	if err := db.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	db.Close()
+
+	db = openTestDB(t, path)
+	if value, ok, err := db.Get("a"); err != nil || !ok || string(value) != "changed" {
+		t.Errorf("Get(a) = %q, %v, %v; want the changed value", value, ok, err)
+	}
+	if _, ok, _ := db.Get("b"); ok {
+		t.Errorf("Expected b to stay deleted")
+	}
+	if keys := db.Keys(""); len(keys) != 2 || keys[0] != "a" || keys[1] != "c" {
+		t.Errorf("Keys() = %v, want [a c]", keys)
+	}
+}
+
+func TestIncompleteBatchDiscarded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openTestDB(t, path)
+
+	var b Batch
+	b.Put("kept", []byte("yes"))
+	if err := db.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	b = Batch{}
+	b.Put("lost", []byte("half written"))
+	if err := db.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	db.Close()
+
+	// Cut the second batch short, as a crash while writing it would
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-4); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, path)
+	if _, ok, _ := db.Get("lost"); ok {
+		t.Errorf("Expected the incomplete batch to be discarded")
+	}
+	if value, ok, _ := db.Get("kept"); !ok || string(value) != "yes" {
+		t.Errorf("Expected the complete batch to be kept, got %q", value)
+	}
+
+	b = Batch{}
+	b.Put("after", []byte("crash"))
+	if err := db.Write(&b); err != nil {
+		t.Fatalf("Write after recovery failed: %v", err)
+	}
+	db.Close()
+	db = openTestDB(t, path)
+	if db.Len() != 2 {
+		t.Errorf("Expected writes after recovery to follow the last complete batch, have %v", db.Keys(""))
+	}
+}
+
+func TestCompactionKeepsValuesInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openTestDB(t, path)
+
+	value := bytes.Repeat([]byte("x"), 1024)
+	for round := 0; round < 4; round++ {
+		var b Batch
+		for i := 0; i < 500; i++ {
+			b.Put("track/"+strconv.Itoa(i), append(value, byte(round)))
+		}
+		if err := db.Write(&b); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 2*500*int64(len(value)+16) {
+		t.Errorf("Expected the log to be compacted, it is %d bytes", info.Size())
+	}
+
+	db.Close()
+	db = openTestDB(t, path)
+	count := 0
+	err = db.ForEach("track/", func(key string, v []byte) error {
+		if v[len(v)-1] != 3 {
+			t.Errorf("Expected the last value of %s, got round %d", key, v[len(v)-1])
+		}
+		count++
+		return nil
+	})
+	if err != nil || count != 500 {
+		t.Errorf("Expected 500 tracks after compaction, got %d (%v)", count, err)
+	}
+}
+
+func TestCrashAtAnyPointKeepsWholeBatches(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.db")
+	db := openTestDB(t, path)
+
+	var b Batch
+	b.Put("a", []byte("1"))
+	b.Put("b", []byte("2"))
+	if err := db.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	info, _ := os.Stat(path)
+	firstEnd := info.Size()
+	b = Batch{}
+	b.Put("a", []byte("changed"))
+	b.Delete("b")
+	b.Put("c", []byte("3"))
+	if err := db.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	db.Close()
+	full, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash can stop the second batch after any byte of it
+	for size := firstEnd; size < int64(len(full)); size++ {
+		crashed := filepath.Join(dir, "crashed-"+strconv.FormatInt(size, 10)+".db")
+		if err := os.WriteFile(crashed, full[:size], 0600); err != nil {
+			t.Fatal(err)
+		}
+		db := openTestDB(t, crashed)
+		a, _, _ := db.Get("a")
+		_, hasB, _ := db.Get("b")
+		_, hasC, _ := db.Get("c")
+		if string(a) != "1" || !hasB || hasC {
+			t.Fatalf("Cut at %d: expected only the first batch, got a=%q b=%v c=%v", size, a, hasB, hasC)
+		}
+		if info, _ := os.Stat(crashed); info.Size() != firstEnd {
+			t.Errorf("Cut at %d: expected the partial batch truncated, file is %d bytes", size, info.Size())
+		}
+	}
+}
+
+func TestCorruptBatchDiscarded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openTestDB(t, path)
+
+	for _, key := range []string{"first", "second", "third"} {
+		var b Batch
+		b.Put(key, []byte("value of "+key))
+		if err := db.Write(&b); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	db.Close()
+
+	// Flip a byte in the second batch's value
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, []byte("value of second"))
+	data[i] ^= 0xff
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing after a batch that fails its checksum can be trusted either
+	db = openTestDB(t, path)
+	if keys := db.Keys(""); len(keys) != 1 || keys[0] != "first" {
+		t.Errorf("Expected only the batch before the corrupt one, have %v", keys)
+	}
+}
+
+func TestCorruptLengthNotAllocated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openTestDB(t, path)
+	var b Batch
+	b.Put("kept", []byte("yes"))
+	if err := db.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	db.Close()
+
+	// A header claiming a batch of nearly 4 GiB in a file of a few bytes
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0xf0, 0xff, 0xff, 0xff, 0, 0, 0, 0, 'x'})
+	f.Close()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	db = openTestDB(t, path)
+	runtime.ReadMemStats(&after)
+	if grew := after.TotalAlloc - before.TotalAlloc; grew > 1<<20 {
+		t.Errorf("Expected the bad length not to be allocated, %d bytes were", grew)
+	}
+	if value, ok, _ := db.Get("kept"); !ok || string(value) != "yes" {
+		t.Errorf("Expected the batch before the bad header kept, got %q", value)
+	}
+}
+
+func TestInterruptedCompactionIgnored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openTestDB(t, path)
+	var b Batch
+	b.Put("a", []byte("1"))
+	if err := db.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	db.Close()
+
+	// A crash during compaction leaves its half-written file behind
+	if err := os.WriteFile(path+".compact", []byte("half a log"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	db = openTestDB(t, path)
+	if value, ok, _ := db.Get("a"); !ok || string(value) != "1" {
+		t.Fatalf("Expected the log kept, got %q", value)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if value, ok, _ := db.Get("a"); !ok || string(value) != "1" {
+		t.Errorf("Expected the value kept through compaction, got %q", value)
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("Expected no compaction file left, got %v", err)
+	}
+}
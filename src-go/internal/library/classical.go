@@ -0,0 +1,179 @@
+package library
+
+import (
+	"sort"
+	"strconv"
+)
+
+// ComposerCount is a composer with the number of their works and tracks
+type ComposerCount struct {
+	Composer string `json:"composer"`
+	Works    int    `json:"works"`
+	Tracks   int    `json:"tracks"`
+}
+
+// WorkCount is a work with the number of its tracks and of the albums they
+// come from, each of which usually holds one recording of the work
+type WorkCount struct {
+	Work       string `json:"work"`
+	Tracks     int    `json:"tracks"`
+	Recordings int    `json:"recordings"`
+}
+
+// Composers returns every composer in the library with their work and track
+// counts, sorted by name. Spellings differing only in case or accents are
+// merged, keeping the most common.
+func (idx *Index) Composers() []ComposerCount {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	byKey := make(map[string]spellings)
+	tracks := make(map[string]int)
+	works := make(map[string]map[string]bool)
+	for i := range idx.entries {
+		e := &idx.entries[i]
+		if e.composerKey == "" {
+			continue
+		}
+		if byKey[e.composerKey] == nil {
+			byKey[e.composerKey] = make(spellings)
+			works[e.composerKey] = make(map[string]bool)
+		}
+		byKey[e.composerKey][e.track.Composer]++
+		tracks[e.composerKey]++
+		if e.workKey != "" {
+			works[e.composerKey][e.workKey] = true
+		}
+	}
+
+	composers := make([]ComposerCount, 0, len(byKey))
+	for key, names := range byKey {
+		composers = append(composers, ComposerCount{
+			Composer: mostCommon(names),
+			Works:    len(works[key]),
+			Tracks:   tracks[key],
+		})
+	}
+	sort.Slice(composers, func(i, j int) bool {
+		return NaturalLess(normalizeKey(composers[i].Composer), normalizeKey(composers[j].Composer))
+	})
+	return composers
+}
+
+// Works returns a composer's works, sorted by title with numbers in numeric
+// order so "Symphony No. 9" comes before "Symphony No. 10", along with the
+// number of the composer's tracks that aren't part of a work
+func (idx *Index) Works(composer string) ([]WorkCount, int) {
+	composerKey := normalizeKey(composer)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	byKey := make(map[string]spellings)
+	tracks := make(map[string]int)
+	albums := make(map[string]map[string]bool)
+	standalone := 0
+	for i := range idx.entries {
+		e := &idx.entries[i]
+		if composerKey == "" || e.composerKey != composerKey {
+			continue
+		}
+		if e.workKey == "" {
+			standalone++
+			continue
+		}
+		if byKey[e.workKey] == nil {
+			byKey[e.workKey] = make(spellings)
+			albums[e.workKey] = make(map[string]bool)
+		}
+		byKey[e.workKey][e.track.Work]++
+		tracks[e.workKey]++
+		albums[e.workKey][e.albumArtist+"\x00"+e.albumKey] = true
+	}
+
+	works := make([]WorkCount, 0, len(byKey))
+	for key, names := range byKey {
+		works = append(works, WorkCount{Work: mostCommon(names), Tracks: tracks[key], Recordings: len(albums[key])})
+	}
+	sort.Slice(works, func(i, j int) bool {
+		return NaturalLess(normalizeKey(works[i].Work), normalizeKey(works[j].Work))
+	})
+	return works, standalone
+}
+
+// Movements returns the tracks of a composer's work in playing order: one
+// recording (album) after another, each by movement number, falling back to
+// disc and track number. An empty work returns the composer's tracks that
+// aren't part of one, in album order.
+func (idx *Index) Movements(composer, work string) []Track {
+	composerKey := normalizeKey(composer)
+	workKey := normalizeKey(work)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var matches []*entry
+	for i := range idx.entries {
+		e := &idx.entries[i]
+		if composerKey != "" && e.composerKey == composerKey && e.workKey == workKey {
+			matches = append(matches, e)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.albumArtist != b.albumArtist {
+			return a.albumArtist < b.albumArtist
+		}
+		if a.albumKey != b.albumKey {
+			return a.albumKey < b.albumKey
+		}
+		if am, bm := a.track.MovementNumber, b.track.MovementNumber; am > 0 && bm > 0 && am != bm {
+			return am < bm
+		}
+		if a.track.DiscNumber != b.track.DiscNumber {
+			return a.track.DiscNumber < b.track.DiscNumber
+		}
+		if a.track.TrackNumber != b.track.TrackNumber {
+			return a.track.TrackNumber < b.track.TrackNumber
+		}
+		return a.sort < b.sort
+	})
+
+	tracks := make([]Track, len(matches))
+	for i, e := range matches {
+		tracks[i] = idx.ratedLocked(e.track)
+	}
+	return tracks
+}
+
+// NaturalLess compares strings with runs of digits compared by value, so
+// "op 9" sorts before "op 10"
+func NaturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da != "" && db != "" {
+			na, _ := strconv.ParseUint(da, 10, 64)
+			nb, _ := strconv.ParseUint(db, 10, 64)
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// leadingDigits returns the run of ASCII digits s starts with
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
@@ -0,0 +1,90 @@
+package library
+
+import "testing"
+
+func classicalIndex() *Index {
+	idx := NewIndex()
+	idx.Build([]Track{
+		{Path: "/k/2", Composer: "Beethoven", Work: "Symphony No. 10", Album: "Sketches", TrackNumber: 1},
+		{Path: "/a/3", Composer: "Beethoven", Work: "Symphony No. 9", Album: "Karajan 1962", MovementNumber: 2, TrackNumber: 8},
+		{Path: "/a/2", Composer: "Beethoven", Work: "Symphony No. 9", Album: "Karajan 1962", MovementNumber: 1, TrackNumber: 7},
+		{Path: "/b/1", Composer: "beethoven", Work: "symphony no. 9", Album: "Bernstein 1979", MovementNumber: 1},
+		{Path: "/a/1", Composer: "Beethoven", Title: "Für Elise", Album: "Karajan 1962", TrackNumber: 1},
+		{Path: "/c/1", Composer: "Bach", Work: "Goldberg Variations"},
+		{Path: "/d/1", Artist: "Not classical"},
+	})
+	return idx
+}
+
+func TestComposers(t *testing.T) {
+	composers := classicalIndex().Composers()
+	want := []ComposerCount{
+		{Composer: "Bach", Works: 1, Tracks: 1},
+		{Composer: "Beethoven", Works: 2, Tracks: 5},
+	}
+	if len(composers) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, composers)
+	}
+	for i := range want {
+		if composers[i] != want[i] {
+			t.Errorf("Composer %d: expected %v, got %v", i, want[i], composers[i])
+		}
+	}
+}
+
+func TestWorksSortNumbersByValue(t *testing.T) {
+	works, standalone := classicalIndex().Works("BEETHOVEN")
+	want := []WorkCount{
+		{Work: "Symphony No. 9", Tracks: 3, Recordings: 2},
+		{Work: "Symphony No. 10", Tracks: 1, Recordings: 1},
+	}
+	if len(works) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, works)
+	}
+	for i := range want {
+		if works[i] != want[i] {
+			t.Errorf("Work %d: expected %v, got %v", i, want[i], works[i])
+		}
+	}
+	if standalone != 1 {
+		t.Errorf("Expected 1 track outside a work, got %d", standalone)
+	}
+}
+
+func TestMovementsInPlayingOrder(t *testing.T) {
+	idx := classicalIndex()
+
+	tracks := idx.Movements("Beethoven", "Symphony No. 9")
+	want := []string{"/b/1", "/a/2", "/a/3"} // Bernstein's recording, then Karajan's
+	if len(tracks) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, tracks)
+	}
+	for i, path := range want {
+		if tracks[i].Path != path {
+			t.Errorf("Movement %d: expected %s, got %s", i, path, tracks[i].Path)
+		}
+	}
+
+	if tracks := idx.Movements("Beethoven", ""); len(tracks) != 1 || tracks[0].Path != "/a/1" {
+		t.Errorf("Expected the track outside a work, got %v", tracks)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"symphony no 9", "symphony no 10", true},
+		{"symphony no 10", "symphony no 9", false},
+		{"op 2 no 1", "op 2 no 3", true},
+		{"partita", "partita 2", true},
+		{"a", "b", true},
+		{"track 2.flac", "track 10.flac", true},
+	}
+	for _, c := range cases {
+		if got := NaturalLess(c.a, c.b); got != c.want {
+			t.Errorf("NaturalLess(%q, %q): expected %v, got %v", c.a, c.b, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package library
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultDuplicateTolerance is how far apart, in milliseconds, the durations
+// of two copies of a track may be. Rips of the same recording differ by
+// encoder padding, usually well under a second.
+const DefaultDuplicateTolerance = 2000
+
+// DuplicateCluster is a set of files that appear to be the same recording
+type DuplicateCluster struct {
+	Tracks []Track `json:"tracks"` // Best copy first
+}
+
+// FindDuplicates groups tracks with the same artist and title whose
+// durations are within toleranceMs of each other. Artist and title are
+// compared case- and accent-insensitively, so tag variations between rips
+// don't hide duplicates. Tracks without an artist are never grouped, since
+// a bare title (often just the file name) is too weak a match.
+//
+// Within a cluster the copy with the highest bitrate, then the largest file,
+// comes first. Clusters are ordered by artist and title.
+func (idx *Index) FindDuplicates(toleranceMs int64) []DuplicateCluster {
+	idx.mu.RLock()
+	groups := make(map[string][]*entry)
+	for i := range idx.entries {
+		e := &idx.entries[i]
+		artist := e.artistKey
+		if artist == "" {
+			artist = e.albumArtist
+		}
+		if artist == "" {
+			continue
+		}
+		key := artist + "\x00" + e.text[fieldTitle]
+		groups[key] = append(groups[key], e)
+	}
+	idx.mu.RUnlock()
+
+	var clusters []DuplicateCluster
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		// Sort by duration and split wherever neighbours are too far apart
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].track.Duration < group[j].track.Duration
+		})
+		start := 0
+		for i := 1; i <= len(group); i++ {
+			if i < len(group) && group[i].track.Duration-group[i-1].track.Duration <= toleranceMs {
+				continue
+			}
+			if i-start > 1 {
+				clusters = append(clusters, newDuplicateCluster(group[start:i]))
+			}
+			start = i
+		}
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusterKey(clusters[i]) < clusterKey(clusters[j])
+	})
+	return clusters
+}
+
+func newDuplicateCluster(entries []*entry) DuplicateCluster {
+	tracks := make([]Track, len(entries))
+	for i, e := range entries {
+		tracks[i] = e.track
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		if tracks[i].Bitrate != tracks[j].Bitrate {
+			return tracks[i].Bitrate > tracks[j].Bitrate
+		}
+		if tracks[i].Size != tracks[j].Size {
+			return tracks[i].Size > tracks[j].Size
+		}
+		return tracks[i].Path < tracks[j].Path
+	})
+	return DuplicateCluster{Tracks: tracks}
+}
+
+func clusterKey(c DuplicateCluster) string {
+	t := c.Tracks[0]
+	return strings.Join([]string{normalizeKey(t.Artist), normalizeKey(t.Title), t.Path}, "\x00")
+}
@@ -0,0 +1,29 @@
+package library
+
+import "testing"
+
+func TestFindDuplicates(t *testing.T) {
+	idx := NewIndex()
+	idx.Build([]Track{
+		{Path: "/mp3/time.mp3", Title: "Time", Artist: "Pink Floyd", Duration: 413_000, Bitrate: 128_000, Size: 6_000_000},
+		{Path: "/flac/time.flac", Title: "Time", Artist: "PINK FLOYD", Duration: 413_400, Bitrate: 900_000, Size: 45_000_000},
+		{Path: "/v0/time.mp3", Title: "Time", Artist: "Pink Floyd", Duration: 412_100, Bitrate: 245_000, Size: 12_000_000},
+		// Same name, different recording
+		{Path: "/live/time.mp3", Title: "Time", Artist: "Pink Floyd", Duration: 480_000},
+		// No artist: never grouped
+		{Path: "/a/01.mp3", Title: "01"},
+		{Path: "/b/01.mp3", Title: "01"},
+	})
+
+	clusters := idx.FindDuplicates(DefaultDuplicateTolerance)
+	if len(clusters) != 1 {
+		t.Fatalf("Expected 1 cluster, got %+v", clusters)
+	}
+	tracks := clusters[0].Tracks
+	if len(tracks) != 3 {
+		t.Fatalf("Expected 3 copies, got %+v", tracks)
+	}
+	if tracks[0].Path != "/flac/time.flac" || tracks[1].Path != "/v0/time.mp3" {
+		t.Errorf("Expected copies ordered by bitrate, got %s, %s", tracks[0].Path, tracks[1].Path)
+	}
+}
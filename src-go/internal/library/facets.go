@@ -0,0 +1,206 @@
+package library
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GenreCount is a genre and the number of tracks tagged with it
+type GenreCount struct {
+	Genre string `json:"genre"`
+	Count int    `json:"count"`
+}
+
+// YearCount is a year, or the first year of a decade, and its track count
+type YearCount struct {
+	Year  int `json:"year"`
+	Count int `json:"count"`
+}
+
+// Facets selects tracks for browsing. Empty fields match everything; text
+// fields match case- and accent-insensitively but otherwise exactly.
+type Facets struct {
+	Genre       string
+	Year        int
+	Decade      int // First year of the decade, e.g. 1990
+	Artist      string
+	AlbumArtist string
+	Album       string
+}
+
+// Validate checks that the facets are usable
+func (f Facets) Validate() error {
+	if f.Year < 0 || f.Decade < 0 {
+		return fmt.Errorf("year and decade must not be negative")
+	}
+	if f.Decade%10 != 0 {
+		return fmt.Errorf("decade must be the first year of a decade, e.g. 1990")
+	}
+	return nil
+}
+
+// splitGenres splits a genre tag holding several genres ("Rock; Pop",
+// "Rock/Pop") into its parts
+func splitGenres(tag string) []string {
+	parts := strings.FieldsFunc(tag, func(r rune) bool {
+		return r == ';' || r == ',' || r == '/'
+	})
+	genres := parts[:0]
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			genres = append(genres, part)
+		}
+	}
+	return genres
+}
+
+// spellings counts the ways a facet value is written
+type spellings map[string]int
+
+// mostCommon returns the most used spelling, the first alphabetically on a
+// tie
+func mostCommon(names spellings) string {
+	best, bestCount := "", 0
+	for name, n := range names {
+		if n > bestCount || (n == bestCount && name < best) {
+			best, bestCount = name, n
+		}
+	}
+	return best
+}
+
+// normalizeKey normalizes s for exact facet comparison
+func normalizeKey(s string) string {
+	return strings.Join(normalize(s), " ")
+}
+
+// Genres returns every genre in the library with its track count, sorted by
+// name. Genres differing only in case or accents are merged, keeping the
+// most common spelling.
+func (idx *Index) Genres() []GenreCount {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	byKey := make(map[string]spellings)
+	counts := make(map[string]int)
+	for i := range idx.entries {
+		e := &idx.entries[i]
+		seen := make(map[string]bool, len(e.genres))
+		for j, genre := range e.genres {
+			key := e.genreKeys[j]
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			if byKey[key] == nil {
+				byKey[key] = make(spellings)
+			}
+			byKey[key][genre]++
+			counts[key]++
+		}
+	}
+
+	genres := make([]GenreCount, 0, len(byKey))
+	for key, names := range byKey {
+		genres = append(genres, GenreCount{Genre: mostCommon(names), Count: counts[key]})
+	}
+	sort.Slice(genres, func(i, j int) bool {
+		return normalizeKey(genres[i].Genre) < normalizeKey(genres[j].Genre)
+	})
+	return genres
+}
+
+// Years returns the track count for every tagged year and every decade,
+// both in ascending order
+func (idx *Index) Years() (years, decades []YearCount) {
+	idx.mu.RLock()
+	byYear := make(map[int]int)
+	for i := range idx.entries {
+		if year := idx.entries[i].track.Year; year > 0 {
+			byYear[year]++
+		}
+	}
+	idx.mu.RUnlock()
+
+	byDecade := make(map[int]int)
+	for year, n := range byYear {
+		years = append(years, YearCount{Year: year, Count: n})
+		byDecade[year/10*10] += n
+	}
+	for decade, n := range byDecade {
+		decades = append(decades, YearCount{Year: decade, Count: n})
+	}
+
+	sort.Slice(years, func(i, j int) bool { return years[i].Year < years[j].Year })
+	sort.Slice(decades, func(i, j int) bool { return decades[i].Year < decades[j].Year })
+	return years, decades
+}
+
+// Tracks returns tracks matching the facets in album order (album artist,
+// album, disc, track number), skipping offset and returning at most limit
+// (0 for all), along with the total number of matches
+func (idx *Index) Tracks(f Facets, offset, limit int) ([]Track, int) {
+	genre := normalizeKey(f.Genre)
+	artist := normalizeKey(f.Artist)
+	albumArtist := normalizeKey(f.AlbumArtist)
+	album := normalizeKey(f.Album)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var matches []*entry
+	for i := range idx.entries {
+		e := &idx.entries[i]
+		year := e.track.Year
+		switch {
+		case f.Year != 0 && year != f.Year,
+			f.Decade != 0 && (year == 0 || year/10*10 != f.Decade),
+			artist != "" && e.artistKey != artist,
+			albumArtist != "" && e.albumArtist != albumArtist,
+			album != "" && e.albumKey != album,
+			genre != "" && !contains(e.genreKeys, genre):
+			continue
+		}
+		matches = append(matches, e)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.albumArtist != b.albumArtist {
+			return a.albumArtist < b.albumArtist
+		}
+		if a.albumKey != b.albumKey {
+			return a.albumKey < b.albumKey
+		}
+		if a.track.DiscNumber != b.track.DiscNumber {
+			return a.track.DiscNumber < b.track.DiscNumber
+		}
+		if a.track.TrackNumber != b.track.TrackNumber {
+			return a.track.TrackNumber < b.track.TrackNumber
+		}
+		return a.sort < b.sort
+	})
+
+	total := len(matches)
+	if offset >= len(matches) {
+		return []Track{}, total
+	}
+	matches = matches[offset:]
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	tracks := make([]Track, len(matches))
+	for i, e := range matches {
+		tracks[i] = idx.ratedLocked(e.track)
+	}
+	return tracks, total
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package library
+
+import "testing"
+
+func TestGenresMergesSpellings(t *testing.T) {
+	idx := NewIndex()
+	idx.Build([]Track{
+		{Path: "/1", Genre: "Rock; Pop"},
+		{Path: "/2", Genre: "rock"},
+		{Path: "/3", Genre: "Rock"},
+		{Path: "/4", Genre: "Électronique"},
+		{Path: "/5"},
+	})
+
+	genres := idx.Genres()
+	want := []GenreCount{{"Électronique", 1}, {"Pop", 1}, {"Rock", 3}}
+	if len(genres) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, genres)
+	}
+	for i := range want {
+		if genres[i] != want[i] {
+			t.Errorf("Genre %d: expected %v, got %v", i, want[i], genres[i])
+		}
+	}
+}
+
+func TestYearsAndDecades(t *testing.T) {
+	idx := NewIndex()
+	idx.Build([]Track{
+		{Path: "/1", Year: 1979},
+		{Path: "/2", Year: 1973},
+		{Path: "/3", Year: 1973},
+		{Path: "/4", Year: 1985},
+		{Path: "/5"},
+	})
+
+	years, decades := idx.Years()
+	if len(years) != 3 || years[0] != (YearCount{1973, 2}) {
+		t.Errorf("Unexpected years: %v", years)
+	}
+	if len(decades) != 2 || decades[0] != (YearCount{1970, 3}) || decades[1] != (YearCount{1980, 1}) {
+		t.Errorf("Unexpected decades: %v", decades)
+	}
+}
+
+func TestTracksFacetsAndAlbumOrder(t *testing.T) {
+	idx := NewIndex()
+	idx.Build([]Track{
+		{Path: "/b2", Album: "B", AlbumArtist: "X", DiscNumber: 2, TrackNumber: 1, Genre: "Jazz", Year: 1959},
+		{Path: "/b1", Album: "B", AlbumArtist: "X", DiscNumber: 1, TrackNumber: 2, Genre: "Jazz", Year: 1959},
+		{Path: "/a1", Album: "A", Artist: "X", TrackNumber: 1, Genre: "Jazz/Blues", Year: 1961},
+		{Path: "/c1", Album: "C", AlbumArtist: "Y", Genre: "Rock", Year: 1961},
+	})
+
+	tracks, total := idx.Tracks(Facets{Genre: "jazz"}, 0, 0)
+	if total != 3 || tracks[0].Path != "/a1" || tracks[1].Path != "/b1" || tracks[2].Path != "/b2" {
+		t.Errorf("Expected jazz tracks in album order, got %+v", tracks)
+	}
+
+	tracks, total = idx.Tracks(Facets{Decade: 1960}, 1, 1)
+	if total != 2 || len(tracks) != 1 || tracks[0].Path != "/c1" {
+		t.Errorf("Expected second 1960s track, got %d %+v", total, tracks)
+	}
+
+	// The artist stands in for a missing album artist
+	if _, total := idx.Tracks(Facets{AlbumArtist: "x"}, 0, 0); total != 3 {
+		t.Errorf("Expected 3 tracks by X, got %d", total)
+	}
+
+	if err := (Facets{Decade: 1995}).Validate(); err == nil {
+		t.Error("Expected a decade not divisible by 10 to be rejected")
+	}
+}
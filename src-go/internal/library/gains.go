@@ -0,0 +1,127 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+// Limits for per-track gain offsets in dB
+const (
+	MinTrackGainDb = -24.0
+	MaxTrackGainDb = 12.0
+)
+
+// TrackGains stores a gain offset per track path, so quiet or loud tracks can
+// be levelled without touching the master volume. It is safe for concurrent
+// use.
+type TrackGains struct {
+	mu       sync.Mutex
+	filePath string
+	gains    map[string]float64
+}
+
+// NewTrackGains creates a track gain store kept in dataDir
+func NewTrackGains(dataDir string) *TrackGains {
+	return &TrackGains{
+		filePath: filepath.Join(dataDir, "track_gains.json"),
+		gains:    make(map[string]float64),
+	}
+}
+
+// Load loads saved gains from disk
+func (s *TrackGains) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read gains file: %w", err)
+	}
+
+	gains := make(map[string]float64)
+	if err := json.Unmarshal(data, &gains); err != nil {
+		return fmt.Errorf("failed to parse gains file: %w", err)
+	}
+
+	s.gains = gains
+	return nil
+}
+
+// Get returns the gain offset for a track in dB, or 0 if none is set
+func (s *TrackGains) Get(path string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gains[path]
+}
+
+// Set stores the gain offset for a track and saves it. A gain of 0 removes
+// the entry.
+func (s *TrackGains) Set(path string, db float64) error {
+	if path == "" {
+		return fmt.Errorf("path is required")
+	}
+	if db < MinTrackGainDb || db > MaxTrackGainDb {
+		return fmt.Errorf("gain must be between %.0f and %.0f dB", MinTrackGainDb, MaxTrackGainDb)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if db == 0 {
+		delete(s.gains, path)
+	} else {
+		s.gains[path] = db
+	}
+	return s.saveLocked()
+}
+
+// RelocatePaths moves track gains to the new track paths and saves them
+func (s *TrackGains) RelocatePaths(rename func(path string) (string, bool)) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	moved := 0
+	gains := make(map[string]float64, len(s.gains))
+	for path, db := range s.gains {
+		if newPath, ok := rename(path); ok && newPath != path {
+			path = newPath
+			moved++
+		}
+		gains[path] = db
+	}
+	s.gains = gains
+
+	if moved > 0 {
+		if err := s.saveLocked(); err != nil {
+			log.Printf("[SCANNER] Failed to save relocated track gains: %v", err)
+		}
+	}
+	return moved
+}
+
+// saveLocked writes the gains to disk (must be called with lock held)
+func (s *TrackGains) saveLocked() error {
+	data, err := json.MarshalIndent(s.gains, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal gains: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create gains directory: %w", err)
+	}
+
+	if err := atomicfile.Write(s.filePath, data); err != nil {
+		return fmt.Errorf("failed to write gains file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package library
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTrackGainsSetAndLoad(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "library_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store := NewTrackGains(tmpDir)
+	if err := store.Set("/music/quiet.flac", 4.5); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := store.Set("/music/loud.mp3", -100); err == nil {
+		t.Error("Expected out of range gain to be rejected")
+	}
+
+	loaded := NewTrackGains(tmpDir)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if gain := loaded.Get("/music/quiet.flac"); gain != 4.5 {
+		t.Errorf("Expected restored gain 4.5, got %f", gain)
+	}
+
+	// Setting 0 forgets the track
+	if err := loaded.Set("/music/quiet.flac", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if len(loaded.gains) != 0 {
+		t.Errorf("Expected zero gain to be removed, got %v", loaded.gains)
+	}
+}
+
+func TestTrackGainsRelocatePaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	gains := NewTrackGains(tmpDir)
+	if err := gains.Set("/old/quiet.mp3", 3); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if moved := gains.RelocatePaths(PrefixRename("/old", "/new")); moved != 1 {
+		t.Errorf("Expected 1 moved gain, got %d", moved)
+	}
+
+	loaded := NewTrackGains(tmpDir)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if db := loaded.Get("/new/quiet.mp3"); db != 3 {
+		t.Errorf("Expected saved gain at new path, got %v", db)
+	}
+}
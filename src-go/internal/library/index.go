@@ -0,0 +1,382 @@
+// Package library provides an in-memory search index over scanned tracks.
+package library
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/austinkregel/local-media/musicd/internal/scanner"
+)
+
+// Track is a searchable library track
+type Track struct {
+	Path        string `json:"path"`
+	Title       string `json:"title"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	AlbumArtist string `json:"albumArtist,omitempty"`
+	Composer    string `json:"composer,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+	Year        int    `json:"year,omitempty"`
+	TrackNumber int    `json:"trackNumber,omitempty"`
+	DiscNumber  int    `json:"discNumber,omitempty"`
+	Duration    int64  `json:"duration,omitempty"` // milliseconds
+	Size        int64  `json:"size,omitempty"`     // bytes
+	Bitrate     int64  `json:"bitrate,omitempty"`  // bits per second
+	Rating      int    `json:"rating,omitempty"`   // Stars, 0 if unrated
+	Favorite    bool   `json:"favorite,omitempty"`
+
+	Work           string `json:"work,omitempty"`
+	Movement       string `json:"movement,omitempty"`       // Movement name
+	MovementNumber int    `json:"movementNumber,omitempty"` // Position in the work
+
+	Cue *scanner.CueTrack `json:"cue,omitempty"` // Set for tracks of a CUE sheet
+}
+
+// Result is a track matching a query
+type Result struct {
+	Track
+	Score float64 `json:"score"`
+}
+
+// Searchable text fields, in the order stored on each entry
+const (
+	fieldTitle = iota
+	fieldArtist
+	fieldAlbum
+	fieldGenre
+	numFields
+)
+
+// fieldWeights rank a match in the title above the same match in the artist,
+// album or genre
+var fieldWeights = [numFields]float64{3, 2, 1.5, 1}
+
+var fieldIndexes = map[string]int{
+	"title":  fieldTitle,
+	"artist": fieldArtist,
+	"album":  fieldAlbum,
+	"genre":  fieldGenre,
+}
+
+// Match quality of a single term against a word
+const (
+	matchExact     = 1.0
+	matchPrefix    = 0.8 // Lets results appear while a word is being typed
+	matchSubstring = 0.5
+	matchFuzzy     = 0.4
+
+	// phraseBonus is added when the whole free text appears in a field
+	phraseBonus = 2.0
+)
+
+type entry struct {
+	track Track
+	words [numFields][]string
+	text  [numFields]string // Normalized words joined by spaces
+	sort  string            // Key for ordering equally scored results
+
+	// Browse facets
+	genres      []string // Genre tag split into individual genres
+	genreKeys   []string // Normalized genres
+	artistKey   string
+	albumKey    string
+	albumArtist string // Normalized album artist, falling back to the artist
+	composerKey string
+	workKey     string
+}
+
+// Index is an in-memory search index. It is safe for concurrent use.
+type Index struct {
+	mu      sync.RWMutex
+	entries []entry
+	ratings *Ratings // Looked up as tracks are returned, so it outlives rebuilds
+}
+
+// NewIndex creates an empty index
+func NewIndex() *Index {
+	return &Index{}
+}
+
+// SetRatings sets where track ratings and favorites come from
+func (idx *Index) SetRatings(r *Ratings) {
+	idx.mu.Lock()
+	idx.ratings = r
+	idx.mu.Unlock()
+}
+
+// ratingLocked returns a track's rating (must be called with lock held)
+func (idx *Index) ratingLocked(path string) Rating {
+	if idx.ratings == nil {
+		return Rating{}
+	}
+	return idx.ratings.Get(path)
+}
+
+// ratedLocked returns t with its rating filled in (must be called with lock
+// held)
+func (idx *Index) ratedLocked(t Track) Track {
+	r := idx.ratingLocked(t.Path)
+	t.Rating, t.Favorite = r.Stars, r.Favorite
+	return t
+}
+
+// Build replaces the indexed tracks
+func (idx *Index) Build(tracks []Track) {
+	entries := make([]entry, len(tracks))
+	for i, t := range tracks {
+		entries[i] = newEntry(t)
+	}
+
+	idx.mu.Lock()
+	idx.entries = entries
+	idx.mu.Unlock()
+}
+
+// Get returns the indexed track at path
+func (idx *Index) Get(path string) (Track, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	for i := range idx.entries {
+		if idx.entries[i].track.Path == path {
+			return idx.ratedLocked(idx.entries[i].track), true
+		}
+	}
+	return Track{}, false
+}
+
+// Update replaces the indexed track with the same path, e.g. after its tags
+// were rewritten. Returns false if the path isn't indexed.
+func (idx *Index) Update(t Track) bool {
+	e := newEntry(t)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for i := range idx.entries {
+		if idx.entries[i].track.Path == t.Path {
+			idx.entries[i] = e
+			return true
+		}
+	}
+	return false
+}
+
+func newEntry(t Track) entry {
+	e := entry{track: t}
+	for field, value := range [numFields]string{t.Title, t.Artist, t.Album, t.Genre} {
+		e.words[field] = normalize(value)
+		e.text[field] = strings.Join(e.words[field], " ")
+	}
+	e.sort = e.text[fieldArtist] + "\x00" + e.text[fieldAlbum] + "\x00" + e.text[fieldTitle] + "\x00" + t.Path
+
+	e.genres = splitGenres(t.Genre)
+	for _, genre := range e.genres {
+		e.genreKeys = append(e.genreKeys, normalizeKey(genre))
+	}
+	e.artistKey = e.text[fieldArtist]
+	e.albumKey = e.text[fieldAlbum]
+	e.albumArtist = normalizeKey(t.AlbumArtist)
+	if e.albumArtist == "" {
+		e.albumArtist = e.artistKey
+	}
+	e.composerKey = normalizeKey(t.Composer)
+	e.workKey = normalizeKey(t.Work)
+	return e
+}
+
+// Len returns the number of indexed tracks
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.entries)
+}
+
+// Search returns up to limit tracks matching q, best first, along with the
+// total number of matches. Every term must match some field, allowing for
+// prefixes and small typos. A query with only filters returns the filtered
+// tracks ordered by artist, album and title.
+func (idx *Index) Search(q Query, limit int) ([]Result, int) {
+	if q.IsEmpty() {
+		return []Result{}, 0
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	type match struct {
+		e     *entry
+		score float64
+	}
+	var matches []match
+	for i := range idx.entries {
+		e := &idx.entries[i]
+		if !e.passes(q.Filters, idx.ratingLocked) {
+			continue
+		}
+		score, ok := e.score(q)
+		if !ok {
+			continue
+		}
+		matches = append(matches, match{e, score})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].e.sort < matches[j].e.sort
+	})
+
+	total := len(matches)
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	results := make([]Result, len(matches))
+	for i, m := range matches {
+		results[i] = Result{Track: idx.ratedLocked(m.e.track), Score: m.score}
+	}
+	return results, total
+}
+
+// passes reports whether the entry matches every filter, looking up its
+// rating only if a filter needs it
+func (e *entry) passes(filters []Filter, rating func(path string) Rating) bool {
+	for _, f := range filters {
+		switch f.Field {
+		case "rating":
+			if stars := rating(e.track.Path).Stars; stars < f.MinRating || stars > f.MaxRating {
+				return false
+			}
+			continue
+		case "favorite":
+			if rating(e.track.Path).Favorite != f.Favorite {
+				return false
+			}
+			continue
+		}
+		if f.Field == "year" {
+			year := e.track.Year
+			if year == 0 || (f.MinYear != 0 && year < f.MinYear) || (f.MaxYear != 0 && year > f.MaxYear) {
+				return false
+			}
+			continue
+		}
+		if !strings.Contains(e.text[fieldIndexes[f.Field]], f.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// score sums each term's best weighted match across fields. It reports false
+// if any term matches nothing.
+func (e *entry) score(q Query) (float64, bool) {
+	var total float64
+	for _, term := range q.Terms {
+		best := 0.0
+		for field := 0; field < numFields; field++ {
+			best = max(best, fieldWeights[field]*matchWords(term, e.words[field]))
+		}
+		if best == 0 {
+			return 0, false
+		}
+		total += best
+	}
+
+	if len(q.Terms) > 1 {
+		for field := 0; field < numFields; field++ {
+			if strings.Contains(e.text[field], q.Phrase) {
+				total += phraseBonus * fieldWeights[field] / fieldWeights[fieldTitle]
+				break
+			}
+		}
+	}
+	return total, true
+}
+
+// matchWords returns the best match quality of term against any word
+func matchWords(term string, words []string) float64 {
+	best := 0.0
+	for _, word := range words {
+		switch {
+		case word == term:
+			return matchExact
+		case strings.HasPrefix(word, term):
+			best = max(best, matchPrefix)
+		case len(term) >= 3 && strings.Contains(word, term):
+			best = max(best, matchSubstring)
+		case best < matchFuzzy && withinEdits(term, word, maxEdits(term)):
+			best = matchFuzzy
+		}
+	}
+	return best
+}
+
+// maxEdits is the number of typos tolerated in a term of this length
+func maxEdits(term string) int {
+	switch n := len(term); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// withinEdits reports whether the Levenshtein distance between a and b is
+// at most k
+func withinEdits(a, b string, k int) bool {
+	if k == 0 {
+		return false
+	}
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > k || -diff > k {
+		return false
+	}
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > k {
+			return false
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)] <= k
+}
+
+// Random returns a random indexed track that accept allows
+func (idx *Index) Random(accept func(Track) bool) (Track, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := len(idx.entries)
+	if n == 0 {
+		return Track{}, false
+	}
+	start := rand.Intn(n)
+	for i := 0; i < n; i++ {
+		t := idx.ratedLocked(idx.entries[(start+i)%n].track)
+		if accept == nil || accept(t) {
+			return t, true
+		}
+	}
+	return Track{}, false
+}
@@ -0,0 +1,116 @@
+package library
+
+import "testing"
+
+func testIndex() *Index {
+	idx := NewIndex()
+	idx.Build([]Track{
+		{Path: "/m/1.flac", Title: "Time", Artist: "Pink Floyd", Album: "The Dark Side of the Moon", Genre: "Progressive Rock", Year: 1973},
+		{Path: "/m/2.flac", Title: "Money", Artist: "Pink Floyd", Album: "The Dark Side of the Moon", Genre: "Progressive Rock", Year: 1973},
+		{Path: "/m/3.flac", Title: "Halo", Artist: "Beyoncé", Album: "I Am... Sasha Fierce", Genre: "R&B", Year: 2008},
+		{Path: "/m/4.flac", Title: "Moonlight Sonata", Artist: "Beethoven", Album: "Piano Sonatas", Genre: "Classical"},
+		{Path: "/m/5.flac", Title: "Don't Stop Me Now", Artist: "Queen", Album: "Jazz", Genre: "Rock", Year: 1978},
+	})
+	return idx
+}
+
+func search(t *testing.T, idx *Index, query string) []Result {
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) failed: %v", query, err)
+	}
+	results, _ := idx.Search(q, 0)
+	return results
+}
+
+func paths(results []Result) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.Path
+	}
+	return out
+}
+
+func TestSearchRanking(t *testing.T) {
+	idx := testIndex()
+
+	// A title match outranks an album match
+	results := search(t, idx, "moon")
+	if len(results) != 3 || results[0].Path != "/m/4.flac" {
+		t.Errorf("Expected Moonlight Sonata first of 3, got %v", paths(results))
+	}
+
+	// Every term has to match
+	results = search(t, idx, "pink money")
+	if len(results) != 1 || results[0].Path != "/m/2.flac" {
+		t.Errorf("Expected only Money, got %v", paths(results))
+	}
+}
+
+func TestSearchPrefixFuzzyAndFolding(t *testing.T) {
+	idx := testIndex()
+
+	cases := map[string]string{
+		"beeth":     "/m/4.flac", // As-you-type prefix
+		"beethovan": "/m/4.flac", // One typo
+		"beyonce":   "/m/3.flac", // Accent folding
+		"dont stop": "/m/5.flac", // Apostrophes dropped
+	}
+	for query, want := range cases {
+		results := search(t, idx, query)
+		if len(results) == 0 || results[0].Path != want {
+			t.Errorf("%q: expected %s first, got %v", query, want, paths(results))
+		}
+	}
+
+	if results := search(t, idx, "xyz"); len(results) != 0 {
+		t.Errorf("Expected no results for short unmatched term, got %v", paths(results))
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	idx := testIndex()
+
+	results := search(t, idx, `artist:"pink floyd" year:>1970`)
+	if len(results) != 2 {
+		t.Errorf("Expected both Pink Floyd tracks, got %v", paths(results))
+	}
+
+	results = search(t, idx, "genre:rock year:>=1975")
+	if len(results) != 1 || results[0].Path != "/m/5.flac" {
+		t.Errorf("Expected only Queen, got %v", paths(results))
+	}
+
+	// Tracks without a year never pass a year filter
+	results = search(t, idx, "sonata year:<2000")
+	if len(results) != 0 {
+		t.Errorf("Expected undated track to be filtered out, got %v", paths(results))
+	}
+
+	results = search(t, idx, "year:1970-1979")
+	if len(results) != 3 {
+		t.Errorf("Expected 3 tracks from the 70s, got %v", paths(results))
+	}
+}
+
+func TestSearchLimitReportsTotal(t *testing.T) {
+	q, _ := ParseQuery("genre:rock")
+	results, total := testIndex().Search(q, 1)
+	if len(results) != 1 || total != 3 {
+		t.Errorf("Expected 1 of 3 results, got %d of %d", len(results), total)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{"year:abc", "year:1990-1980", "year:>"} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("Expected %q to be rejected", query)
+		}
+	}
+
+	// Unknown prefixes are plain text
+	q, err := ParseQuery("re:stacks")
+	if err != nil || len(q.Filters) != 0 || len(q.Terms) != 2 {
+		t.Errorf("Expected unknown prefix to be searched as text, got %+v (%v)", q, err)
+	}
+}
@@ -0,0 +1,176 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+// MaxIntroSkipMs is the longest intro that can be skipped
+const MaxIntroSkipMs = 10 * 60 * 1000
+
+// IntroSkips stores how much of the start of tracks to skip, set for single
+// tracks or for a whole album (e.g. the applause opening every track of a
+// live album). It is safe for concurrent use.
+type IntroSkips struct {
+	mu       sync.Mutex
+	filePath string
+	skips    introSkipFile
+}
+
+// introSkipFile is the on-disk form of IntroSkips, in milliseconds
+type introSkipFile struct {
+	Tracks map[string]int64 `json:"tracks"` // By path
+	Albums map[string]int64 `json:"albums"` // By AlbumKey
+}
+
+// AlbumKey identifies the album of t for IntroSkips, by its album artist (or
+// artist) and title ignoring case and accents. It is "" for tracks without
+// an album tag.
+func AlbumKey(t Track) string {
+	album := normalizeKey(t.Album)
+	if album == "" {
+		return ""
+	}
+	artist := normalizeKey(t.AlbumArtist)
+	if artist == "" {
+		artist = normalizeKey(t.Artist)
+	}
+	return artist + "/" + album
+}
+
+// NewIntroSkips creates an intro skip store kept in dataDir
+func NewIntroSkips(dataDir string) *IntroSkips {
+	return &IntroSkips{
+		filePath: filepath.Join(dataDir, "intro_skips.json"),
+		skips: introSkipFile{
+			Tracks: make(map[string]int64),
+			Albums: make(map[string]int64),
+		},
+	}
+}
+
+// Load loads saved intro skips from disk
+func (s *IntroSkips) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read intro skips file: %w", err)
+	}
+
+	var skips introSkipFile
+	if err := json.Unmarshal(data, &skips); err != nil {
+		return fmt.Errorf("failed to parse intro skips file: %w", err)
+	}
+	if skips.Tracks == nil {
+		skips.Tracks = make(map[string]int64)
+	}
+	if skips.Albums == nil {
+		skips.Albums = make(map[string]int64)
+	}
+	s.skips = skips
+	return nil
+}
+
+// Get returns the milliseconds to skip at the start of the track at path,
+// whose album has albumKey. A track's own setting wins over its album's;
+// fromAlbum reports which one applied.
+func (s *IntroSkips) Get(path, albumKey string) (ms int64, fromAlbum bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ms, ok := s.skips.Tracks[path]; ok {
+		return ms, false
+	}
+	if albumKey == "" {
+		return 0, false
+	}
+	ms, ok := s.skips.Albums[albumKey]
+	return ms, ok
+}
+
+// SetTrack sets the intro to skip for one track, 0 clearing it, and saves
+// the change
+func (s *IntroSkips) SetTrack(path string, ms int64) error {
+	if path == "" {
+		return fmt.Errorf("path is required")
+	}
+	return s.set(s.skips.Tracks, path, ms)
+}
+
+// SetAlbum sets the intro to skip for every track of an album, 0 clearing
+// it, and saves the change
+func (s *IntroSkips) SetAlbum(albumKey string, ms int64) error {
+	if albumKey == "" {
+		return fmt.Errorf("track has no album")
+	}
+	return s.set(s.skips.Albums, albumKey, ms)
+}
+
+func (s *IntroSkips) set(skips map[string]int64, key string, ms int64) error {
+	if ms < 0 || ms > MaxIntroSkipMs {
+		return fmt.Errorf("intro skip must be between 0 and %dms", MaxIntroSkipMs)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ms == 0 {
+		delete(skips, key)
+	} else {
+		skips[key] = ms
+	}
+	return s.saveLocked()
+}
+
+// RelocatePaths moves track intro skips to the new track paths. Album skips
+// aren't keyed by path and stay as they are.
+func (s *IntroSkips) RelocatePaths(rename func(path string) (string, bool)) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	moved := 0
+	tracks := make(map[string]int64, len(s.skips.Tracks))
+	for path, ms := range s.skips.Tracks {
+		if newPath, ok := rename(path); ok && newPath != path {
+			path = newPath
+			moved++
+		}
+		tracks[path] = ms
+	}
+	s.skips.Tracks = tracks
+
+	if moved > 0 {
+		if err := s.saveLocked(); err != nil {
+			log.Printf("[SCANNER] Failed to save relocated intro skips: %v", err)
+		}
+	}
+	return moved
+}
+
+// saveLocked writes the intro skips to disk (must be called with lock held)
+func (s *IntroSkips) saveLocked() error {
+	data, err := json.MarshalIndent(s.skips, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal intro skips: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create intro skips directory: %w", err)
+	}
+
+	if err := atomicfile.Write(s.filePath, data); err != nil {
+		return fmt.Errorf("failed to write intro skips file: %w", err)
+	}
+	return nil
+}
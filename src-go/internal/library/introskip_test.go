@@ -0,0 +1,39 @@
+package library
+
+import "testing"
+
+func TestIntroSkipsTrackOverridesAlbum(t *testing.T) {
+	dir := t.TempDir()
+	s := NewIntroSkips(dir)
+
+	live := Track{Path: "/m/live/1.flac", Artist: "Band", AlbumArtist: "The Band", Album: "Live at Leeds"}
+	album := AlbumKey(live)
+	if err := s.SetAlbum(album, 10000); err != nil {
+		t.Fatalf("SetAlbum failed: %v", err)
+	}
+	if err := s.SetTrack("/m/live/2.flac", 4000); err != nil {
+		t.Fatalf("SetTrack failed: %v", err)
+	}
+	if err := s.SetTrack("/m/live/3.flac", MaxIntroSkipMs+1); err == nil {
+		t.Error("Expected an intro skip beyond the limit to be rejected")
+	}
+
+	loaded := NewIntroSkips(dir)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if ms, fromAlbum := loaded.Get(live.Path, album); ms != 10000 || !fromAlbum {
+		t.Errorf("Expected the album's 10s, got %d (album %v)", ms, fromAlbum)
+	}
+	if ms, fromAlbum := loaded.Get("/m/live/2.flac", album); ms != 4000 || fromAlbum {
+		t.Errorf("Expected the track's own 4s, got %d (album %v)", ms, fromAlbum)
+	}
+	if ms, _ := loaded.Get("/m/other.flac", ""); ms != 0 {
+		t.Errorf("Expected no skip for a track without an album, got %d", ms)
+	}
+
+	// Album keys ignore case and accents
+	if got := AlbumKey(Track{AlbumArtist: "the band", Album: "LIVE AT LEEDS"}); got != album {
+		t.Errorf("Expected the same album key, got %q and %q", got, album)
+	}
+}
@@ -0,0 +1,167 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+// Where a file was found to be unreadable
+const (
+	QuarantineScan     = "scan"
+	QuarantinePlayback = "playback"
+)
+
+// QuarantinedFile is a file that failed to probe or decode
+type QuarantinedFile struct {
+	Path   string `json:"path"`
+	Error  string `json:"error"`
+	Source string `json:"source"` // QuarantineScan or QuarantinePlayback
+	At     int64  `json:"at"`     // Unix milliseconds of the latest failure
+}
+
+// Quarantine tracks corrupt and unreadable files so playback can skip them
+// until they are fixed. It is safe for concurrent use.
+type Quarantine struct {
+	mu       sync.Mutex
+	filePath string
+	files    map[string]QuarantinedFile
+}
+
+// NewQuarantine creates a quarantine list kept in dataDir
+func NewQuarantine(dataDir string) *Quarantine {
+	return &Quarantine{
+		filePath: filepath.Join(dataDir, "quarantine.json"),
+		files:    make(map[string]QuarantinedFile),
+	}
+}
+
+// Load loads the saved quarantine list from disk
+func (q *Quarantine) Load() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	data, err := os.ReadFile(q.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read quarantine file: %w", err)
+	}
+
+	files := make(map[string]QuarantinedFile)
+	if err := json.Unmarshal(data, &files); err != nil {
+		return fmt.Errorf("failed to parse quarantine file: %w", err)
+	}
+	q.files = files
+	return nil
+}
+
+// Contains reports whether a file is quarantined
+func (q *Quarantine) Contains(path string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.files[path]
+	return ok
+}
+
+// List returns the quarantined files, most recent failure first
+func (q *Quarantine) List() []QuarantinedFile {
+	q.mu.Lock()
+	files := make([]QuarantinedFile, 0, len(q.files))
+	for _, f := range q.files {
+		files = append(files, f)
+	}
+	q.mu.Unlock()
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].At != files[j].At {
+			return files[i].At > files[j].At
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// Add quarantines a file, or updates the error of one already quarantined,
+// and saves the change
+func (q *Quarantine) Add(path, source string, reason error, at time.Time) error {
+	if path == "" {
+		return fmt.Errorf("path is required")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.files[path] = QuarantinedFile{Path: path, Error: reason.Error(), Source: source, At: at.UnixMilli()}
+	return q.saveLocked()
+}
+
+// Release takes files out of quarantine, saving if any were in it, and
+// returns how many were
+func (q *Quarantine) Release(paths []string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	released := 0
+	for _, path := range paths {
+		if _, ok := q.files[path]; ok {
+			delete(q.files, path)
+			released++
+		}
+	}
+	if released == 0 {
+		return 0, nil
+	}
+	return released, q.saveLocked()
+}
+
+// RelocatePaths moves quarantined files to their new paths
+func (q *Quarantine) RelocatePaths(rename func(path string) (string, bool)) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	moved := 0
+	files := make(map[string]QuarantinedFile, len(q.files))
+	for path, f := range q.files {
+		if newPath, ok := rename(path); ok && newPath != path {
+			path = newPath
+			f.Path = newPath
+			moved++
+		}
+		files[path] = f
+	}
+	q.files = files
+
+	if moved > 0 {
+		if err := q.saveLocked(); err != nil {
+			log.Printf("[SCANNER] Failed to save relocated quarantine: %v", err)
+		}
+	}
+	return moved
+}
+
+// saveLocked writes the quarantine list to disk (must be called with lock
+// held)
+func (q *Quarantine) saveLocked() error {
+	data, err := json.MarshalIndent(q.files, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal quarantine: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+
+	if err := atomicfile.Write(q.filePath, data); err != nil {
+		return fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package library
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuarantinePersist(t *testing.T) {
+	dir := t.TempDir()
+	q := NewQuarantine(dir)
+	start := time.UnixMilli(1_700_000_000_000)
+
+	if err := q.Add("/m/1.mp3", QuarantineScan, errors.New("Invalid data found when processing input"), start); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := q.Add("/m/2.flac", QuarantinePlayback, errors.New("exit status 1"), start.Add(time.Minute)); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	loaded := NewQuarantine(dir)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !loaded.Contains("/m/1.mp3") || loaded.Contains("/m/3.mp3") {
+		t.Error("Expected only quarantined files to be reported")
+	}
+	files := loaded.List()
+	if len(files) != 2 || files[0].Path != "/m/2.flac" || files[0].Source != QuarantinePlayback {
+		t.Errorf("Expected the latest failure first, got %+v", files)
+	}
+
+	released, err := loaded.Release([]string{"/m/1.mp3", "/m/3.mp3"})
+	if err != nil || released != 1 {
+		t.Errorf("Expected 1 file released, got %d (%v)", released, err)
+	}
+	if loaded.Contains("/m/1.mp3") {
+		t.Error("Expected released file to leave quarantine")
+	}
+}
+
+func TestQuarantineRelocate(t *testing.T) {
+	q := NewQuarantine(t.TempDir())
+	q.Add("/old/1.mp3", QuarantineScan, errors.New("bad"), time.Now())
+
+	moved := q.RelocatePaths(func(path string) (string, bool) {
+		return "/new/1.mp3", path == "/old/1.mp3"
+	})
+	if moved != 1 || !q.Contains("/new/1.mp3") || q.List()[0].Path != "/new/1.mp3" {
+		t.Errorf("Expected quarantine to follow the move, got %+v", q.List())
+	}
+}
@@ -0,0 +1,233 @@
+package library
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed search query: free-text terms plus field filters
+type Query struct {
+	Terms   []string // Normalized free-text words; all must match
+	Phrase  string   // Normalized free text as typed, for phrase bonuses
+	Filters []Filter
+}
+
+// Filter restricts results by a single field
+type Filter struct {
+	Field string // "title", "artist", "album", "genre", "year", "rating" or "favorite"
+	Value string // Normalized text the field must contain (text fields)
+
+	// Inclusive year range (year filters); 0 means unbounded
+	MinYear, MaxYear int
+
+	// Inclusive star range (rating filters), 0 being unrated
+	MinRating, MaxRating int
+
+	// Whether tracks must be favorites or must not be (favorite filters)
+	Favorite bool
+}
+
+// filterFields are the prefixes recognized as filters, e.g. artist:bowie.
+// Anything else containing a colon is searched as text.
+var filterFields = map[string]bool{
+	"title":    true,
+	"artist":   true,
+	"album":    true,
+	"genre":    true,
+	"year":     true,
+	"rating":   true,
+	"favorite": true,
+}
+
+// ParseQuery parses a search string such as
+//
+//	dark side artist:"pink floyd" year:>1970 rating:>=4 favorite:yes
+//
+// Year and rating filters accept 1973, >1970, >=1970, <1980, <=1980 and
+// 1970-1979. Favorite filters accept yes/no, true/false and 1/0.
+func ParseQuery(s string) (Query, error) {
+	var q Query
+	var free []string
+
+	for _, token := range splitQuery(s) {
+		field, value, ok := strings.Cut(token, ":")
+		field = strings.ToLower(field)
+		if !ok || !filterFields[field] {
+			free = append(free, token)
+			continue
+		}
+
+		value = strings.Trim(value, `"`)
+		var filter Filter
+		var err error
+		switch field {
+		case "year":
+			filter, err = parseYearFilter(value)
+		case "rating":
+			filter, err = parseRatingFilter(value)
+		case "favorite":
+			filter, err = parseFavoriteFilter(value)
+		}
+		if err != nil {
+			return Query{}, err
+		}
+		if filter.Field != "" {
+			q.Filters = append(q.Filters, filter)
+			continue
+		}
+
+		normalized := strings.Join(normalize(value), " ")
+		if normalized == "" {
+			continue // "artist:" while the user is still typing
+		}
+		q.Filters = append(q.Filters, Filter{Field: field, Value: normalized})
+	}
+
+	for _, token := range free {
+		q.Terms = append(q.Terms, normalize(strings.Trim(token, `"`))...)
+	}
+	q.Phrase = strings.Join(q.Terms, " ")
+	return q, nil
+}
+
+// IsEmpty reports whether the query has neither terms nor filters
+func (q Query) IsEmpty() bool {
+	return len(q.Terms) == 0 && len(q.Filters) == 0
+}
+
+// splitQuery splits on whitespace, keeping double-quoted sections together
+func splitQuery(s string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+func parseYearFilter(value string) (Filter, error) {
+	lo, hi, err := parseRange(value)
+	if err != nil {
+		return Filter{}, err
+	}
+	filter := Filter{Field: "year", MinYear: lo}
+	if hi != math.MaxInt {
+		filter.MaxYear = hi
+	}
+	return filter, nil
+}
+
+func parseRatingFilter(value string) (Filter, error) {
+	lo, hi, err := parseRange(value)
+	if err != nil {
+		return Filter{}, err
+	}
+	if lo > MaxStars {
+		return Filter{}, fmt.Errorf("rating must be between 0 and %d", MaxStars)
+	}
+	return Filter{Field: "rating", MinRating: lo, MaxRating: min(hi, MaxStars)}, nil
+}
+
+func parseFavoriteFilter(value string) (Filter, error) {
+	switch strings.ToLower(value) {
+	case "yes", "true", "1":
+		return Filter{Field: "favorite", Favorite: true}, nil
+	case "no", "false", "0":
+		return Filter{Field: "favorite", Favorite: false}, nil
+	}
+	return Filter{}, fmt.Errorf("invalid favorite filter %q (yes or no)", value)
+}
+
+// parseRange parses 1973, >1970, >=1970, <1980, <=1980 or 1970-1979 into an
+// inclusive range. An open lower end is 0 and an open upper end math.MaxInt.
+func parseRange(value string) (lo, hi int, err error) {
+	parse := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number %q", s)
+		}
+		return n, nil
+	}
+
+	hi = math.MaxInt
+	switch {
+	case strings.HasPrefix(value, ">="):
+		lo, err = parse(value[2:])
+	case strings.HasPrefix(value, ">"):
+		lo, err = parse(value[1:])
+		lo++
+	case strings.HasPrefix(value, "<="):
+		hi, err = parse(value[2:])
+	case strings.HasPrefix(value, "<"):
+		hi, err = parse(value[1:])
+		hi--
+	case strings.Contains(value, "-"):
+		from, to, _ := strings.Cut(value, "-")
+		if lo, err = parse(from); err == nil {
+			hi, err = parse(to)
+		}
+	default:
+		lo, err = parse(value)
+		hi = lo
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if lo > hi {
+		return 0, 0, fmt.Errorf("empty range %q", value)
+	}
+	return lo, hi, nil
+}
+
+// foldTable maps accented Latin letters to their base letter so "beyonce"
+// finds "Beyoncé"
+var foldTable = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a',
+	'ç': 'c',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i',
+	'ñ': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u',
+	'ý': 'y', 'ÿ': 'y',
+}
+
+// normalize lowercases s, folds accents and splits it into words.
+// Punctuation separates words, except apostrophes which are dropped so
+// "don't" matches "dont".
+func normalize(s string) []string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if folded, ok := foldTable[r]; ok {
+			r = folded
+		}
+		switch {
+		case r == '\'' || r == '’':
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteByte(' ')
+		}
+	}
+	return strings.Fields(b.String())
+}
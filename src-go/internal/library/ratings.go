@@ -0,0 +1,221 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+// MaxStars is the highest rating a track can have
+const MaxStars = 5
+
+// Rating is a track's star rating (0 for unrated) and favorite flag
+type Rating struct {
+	Stars    int  `json:"stars,omitempty"`
+	Favorite bool `json:"favorite,omitempty"`
+}
+
+// RatingRecord is a rating along with when it last changed, which decides
+// which of two machines' ratings wins when they are synced
+type RatingRecord struct {
+	Rating
+	Updated int64 `json:"updated,omitempty"` // Unix ms
+}
+
+// RatingFilter selects tracks by rating. The zero value allows everything.
+type RatingFilter struct {
+	MinStars      int
+	FavoritesOnly bool
+}
+
+// Allows reports whether a track with rating r passes the filter
+func (f RatingFilter) Allows(r Rating) bool {
+	return r.Stars >= f.MinStars && (r.Favorite || !f.FavoritesOnly)
+}
+
+// Validate checks that the filter is usable
+func (f RatingFilter) Validate() error {
+	if f.MinStars < 0 || f.MinStars > MaxStars {
+		return fmt.Errorf("minimum rating must be between 0 and %d", MaxStars)
+	}
+	return nil
+}
+
+// Ratings stores track ratings and favorites by path. A cleared rating is
+// kept with the time it was cleared, so syncing carries the clear over. It is
+// safe for concurrent use.
+type Ratings struct {
+	mu       sync.Mutex
+	filePath string
+	ratings  map[string]RatingRecord
+}
+
+// NewRatings creates a rating store kept in dataDir
+func NewRatings(dataDir string) *Ratings {
+	return &Ratings{
+		filePath: filepath.Join(dataDir, "ratings.json"),
+		ratings:  make(map[string]RatingRecord),
+	}
+}
+
+// Load loads saved ratings from disk
+func (r *Ratings) Load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := os.ReadFile(r.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read ratings file: %w", err)
+	}
+
+	ratings := make(map[string]RatingRecord)
+	if err := json.Unmarshal(data, &ratings); err != nil {
+		return fmt.Errorf("failed to parse ratings file: %w", err)
+	}
+	r.ratings = ratings
+	return nil
+}
+
+// Get returns a track's rating
+func (r *Ratings) Get(path string) Rating {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ratings[path].Rating
+}
+
+// Records returns every track's rating with when it last changed, including
+// cleared ones
+func (r *Ratings) Records() map[string]RatingRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records := make(map[string]RatingRecord, len(r.ratings))
+	for path, record := range r.ratings {
+		records[path] = record
+	}
+	return records
+}
+
+// Merge takes each of records that changed more recently than the track's
+// own rating and saves the result. Returns the number of ratings taken.
+func (r *Ratings) Merge(records map[string]RatingRecord) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	merged := 0
+	for path, record := range records {
+		if path == "" || record.Stars < 0 || record.Stars > MaxStars {
+			continue
+		}
+		if record.Updated > r.ratings[path].Updated {
+			r.ratings[path] = record
+			merged++
+		}
+	}
+	if merged == 0 {
+		return 0, nil
+	}
+	return merged, r.saveLocked()
+}
+
+// SetStars sets a track's star rating, 0 clearing it, and saves the change
+func (r *Ratings) SetStars(path string, stars int) (Rating, error) {
+	if path == "" {
+		return Rating{}, fmt.Errorf("path is required")
+	}
+	if stars < 0 || stars > MaxStars {
+		return Rating{}, fmt.Errorf("rating must be between 0 and %d", MaxStars)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rating := r.ratings[path].Rating
+	rating.Stars = stars
+	return rating, r.setLocked(path, rating)
+}
+
+// SetFavorite sets or clears a track's favorite flag and saves the change
+func (r *Ratings) SetFavorite(path string, favorite bool) (Rating, error) {
+	if path == "" {
+		return Rating{}, fmt.Errorf("path is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rating := r.ratings[path].Rating
+	rating.Favorite = favorite
+	return rating, r.setLocked(path, rating)
+}
+
+// ToggleFavorite flips a track's favorite flag and saves the change
+func (r *Ratings) ToggleFavorite(path string) (Rating, error) {
+	if path == "" {
+		return Rating{}, fmt.Errorf("path is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rating := r.ratings[path].Rating
+	rating.Favorite = !rating.Favorite
+	return rating, r.setLocked(path, rating)
+}
+
+// RelocatePaths moves ratings to the new track paths
+func (r *Ratings) RelocatePaths(rename func(path string) (string, bool)) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	moved := 0
+	ratings := make(map[string]RatingRecord, len(r.ratings))
+	for path, record := range r.ratings {
+		if newPath, ok := rename(path); ok && newPath != path {
+			path = newPath
+			moved++
+		}
+		ratings[path] = record
+	}
+	r.ratings = ratings
+
+	if moved > 0 {
+		if err := r.saveLocked(); err != nil {
+			log.Printf("[SCANNER] Failed to save relocated ratings: %v", err)
+		}
+	}
+	return moved
+}
+
+// setLocked stores a rating as changed now and saves (must be called with
+// lock held)
+func (r *Ratings) setLocked(path string, rating Rating) error {
+	r.ratings[path] = RatingRecord{Rating: rating, Updated: time.Now().UnixMilli()}
+	return r.saveLocked()
+}
+
+// saveLocked writes the ratings to disk (must be called with lock held)
+func (r *Ratings) saveLocked() error {
+	data, err := json.MarshalIndent(r.ratings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal ratings: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create ratings directory: %w", err)
+	}
+
+	if err := atomicfile.Write(r.filePath, data); err != nil {
+		return fmt.Errorf("failed to write ratings file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package library
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRatingsPersist(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRatings(dir)
+
+	if _, err := r.SetStars("/m/1.flac", 6); err == nil {
+		t.Error("Expected a rating above 5 to be rejected")
+	}
+	if _, err := r.SetStars("/m/1.flac", 4); err != nil {
+		t.Fatalf("SetStars failed: %v", err)
+	}
+	if rating, _ := r.ToggleFavorite("/m/1.flac"); rating != (Rating{Stars: 4, Favorite: true}) {
+		t.Errorf("Expected a 4 star favorite, got %+v", rating)
+	}
+
+	loaded := NewRatings(dir)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if rating := loaded.Get("/m/1.flac"); rating != (Rating{Stars: 4, Favorite: true}) {
+		t.Errorf("Expected restored rating, got %+v", rating)
+	}
+}
+
+func TestSearchRatingFilters(t *testing.T) {
+	idx := testIndex()
+	r := NewRatings(t.TempDir())
+	idx.SetRatings(r)
+	r.SetStars("/m/1.flac", 5)
+	r.SetStars("/m/2.flac", 3)
+	r.SetFavorite("/m/2.flac", true)
+	r.SetFavorite("/m/5.flac", true)
+
+	cases := map[string][]string{
+		"pink rating:>=4":        {"/m/1.flac"},
+		"pink rating:3-4":        {"/m/2.flac"},
+		"pink rating:<1":         nil,
+		"favorite:yes":           {"/m/2.flac", "/m/5.flac"},
+		"pink favorite:no":       {"/m/1.flac"},
+		"favorite:yes rating:>2": {"/m/2.flac"},
+	}
+	for query, want := range cases {
+		got := paths(search(t, idx, query))
+		if len(got) == 0 {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %v, got %v", query, want, got)
+		}
+	}
+
+	// Results carry their rating
+	results := search(t, idx, "time")
+	if len(results) != 1 || results[0].Rating != 5 || results[0].Favorite {
+		t.Errorf("Expected Time rated 5 stars, got %+v", results)
+	}
+
+	for _, query := range []string{"rating:6", "rating:x", "favorite:maybe"} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("Expected %q to be rejected", query)
+		}
+	}
+}
+
+func TestRatingsMergeLastWriteWins(t *testing.T) {
+	r := NewRatings(t.TempDir())
+	r.SetStars("/m/1.flac", 3)
+	r.SetStars("/m/2.flac", 4)
+	r.SetStars("/m/2.flac", 0)
+	local := r.Records()
+
+	merged, err := r.Merge(map[string]RatingRecord{
+		// Older than the local rating
+		"/m/1.flac": {Rating: Rating{Stars: 1}, Updated: local["/m/1.flac"].Updated - 1},
+		// Newer than the local clear
+		"/m/2.flac": {Rating: Rating{Stars: 5, Favorite: true}, Updated: local["/m/2.flac"].Updated + 1},
+		"/m/3.flac": {Rating: Rating{Favorite: true}, Updated: 1},
+		"/m/4.flac": {Rating: Rating{Stars: 9}, Updated: 1},
+	})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if merged != 2 {
+		t.Errorf("Expected 2 ratings merged, got %d", merged)
+	}
+
+	want := map[string]Rating{
+		"/m/1.flac": {Stars: 3},
+		"/m/2.flac": {Stars: 5, Favorite: true},
+		"/m/3.flac": {Favorite: true},
+		"/m/4.flac": {},
+	}
+	for path, rating := range want {
+		if got := r.Get(path); got != rating {
+			t.Errorf("%s: expected %+v, got %+v", path, rating, got)
+		}
+	}
+
+	// A clear is kept so it can win over an older rating elsewhere
+	r.SetFavorite("/m/3.flac", false)
+	if record, ok := r.Records()["/m/3.flac"]; !ok || record.Updated <= 1 {
+		t.Errorf("Expected the cleared rating kept with its time, got %+v, %v", record, ok)
+	}
+}
@@ -0,0 +1,57 @@
+package library
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// PrefixRename returns a rename function that moves paths under the from
+// directory to the same place under to. Only whole path components match, so
+// /music does not match /musicals.
+func PrefixRename(from, to string) func(path string) (string, bool) {
+	from = filepath.Clean(from)
+	to = filepath.Clean(to)
+	prefix := from
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+
+	return func(path string) (string, bool) {
+		if path == from {
+			return to, true
+		}
+		if !strings.HasPrefix(path, prefix) {
+			return "", false
+		}
+		return filepath.Join(to, path[len(prefix):]), true
+	}
+}
+
+// MapRename returns a rename function for an explicit old to new path mapping
+func MapRename(moves map[string]string) func(path string) (string, bool) {
+	return func(path string) (string, bool) {
+		newPath, ok := moves[path]
+		return newPath, ok
+	}
+}
+
+// RelocatePaths rewrites the paths of indexed tracks. Returns the number of
+// tracks moved.
+func (idx *Index) RelocatePaths(rename func(path string) (string, bool)) int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	moved := 0
+	for i := range idx.entries {
+		e := &idx.entries[i]
+		newPath, ok := rename(e.track.Path)
+		if !ok || newPath == e.track.Path {
+			continue
+		}
+		t := e.track
+		t.Path = newPath
+		*e = newEntry(t)
+		moved++
+	}
+	return moved
+}
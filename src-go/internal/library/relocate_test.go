@@ -0,0 +1,44 @@
+package library
+
+import "testing"
+
+func TestPrefixRename(t *testing.T) {
+	rename := PrefixRename("/mnt/nas/music/", "/Volumes/music")
+
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"/mnt/nas/music/a/b.flac", "/Volumes/music/a/b.flac", true},
+		{"/mnt/nas/music", "/Volumes/music", true},
+		{"/mnt/nas/musicals/c.flac", "", false},
+		{"/home/user/d.flac", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := rename(tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("rename(%q) = %q, %v; expected %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIndexRelocatePaths(t *testing.T) {
+	idx := testIndex()
+
+	moved := idx.RelocatePaths(MapRename(map[string]string{"/m/1.flac": "/n/1.flac"}))
+	if moved != 1 {
+		t.Errorf("Expected 1 moved track, got %d", moved)
+	}
+	if _, ok := idx.Get("/m/1.flac"); ok {
+		t.Error("Expected old path to be gone")
+	}
+	track, ok := idx.Get("/n/1.flac")
+	if !ok || track.Title != "Time" {
+		t.Errorf("Expected Time at new path, got %+v", track)
+	}
+	if results := search(t, idx, "time"); len(results) != 1 || results[0].Path != "/n/1.flac" {
+		t.Errorf("Expected search to return new path, got %v", paths(results))
+	}
+}
@@ -0,0 +1,58 @@
+package library
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/austinkregel/local-media/musicd/internal/scanner"
+)
+
+// TracksFromScan converts scan results into index tracks. Album details
+// missing from a file's tags are taken from the album.nfo in its directory.
+func TracksFromScan(results []scanner.ScanResult, metadata *scanner.LibraryMetadata) []Track {
+	albums := make(map[string]*scanner.AlbumInfo)
+	if metadata != nil {
+		for i := range metadata.Albums {
+			albums[metadata.Albums[i].AlbumPath] = &metadata.Albums[i]
+		}
+	}
+
+	var tracks []Track
+	for _, result := range results {
+		for _, f := range result.Files {
+			t := Track{Path: f.Path, Size: f.Size, Cue: f.Cue}
+			if m := f.Metadata; m != nil {
+				t.Title, t.Artist, t.Album = m.Title, m.Artist, m.Album
+				t.AlbumArtist, t.Composer = m.AlbumArtist, m.Composer
+				t.Genre, t.Year, t.Duration = m.Genre, m.Year, m.Duration
+				t.TrackNumber, t.DiscNumber = m.TrackNumber, m.DiscNumber
+				t.Bitrate = m.Bitrate
+				t.Work, t.Movement, t.MovementNumber = m.Work, m.Movement, m.MovementNumber
+			}
+			if t.Title == "" {
+				name := filepath.Base(f.Path)
+				t.Title = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+
+			if album := albums[filepath.Dir(f.Path)]; album != nil {
+				if t.Album == "" {
+					t.Album = album.Title
+				}
+				if t.Artist == "" {
+					t.Artist = album.Artist
+				}
+				if t.AlbumArtist == "" {
+					t.AlbumArtist = album.Artist
+				}
+				if t.Genre == "" && len(album.Genre) > 0 {
+					t.Genre = strings.Join(album.Genre, ", ")
+				}
+				if t.Year == 0 {
+					t.Year = album.Year
+				}
+			}
+			tracks = append(tracks, t)
+		}
+	}
+	return tracks
+}
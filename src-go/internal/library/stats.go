@@ -0,0 +1,139 @@
+package library
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/austinkregel/local-media/musicd/internal/scanner"
+)
+
+// BitrateBuckets are the upper bounds, in kbps, of the bitrate bands stats
+// are grouped into. Tracks above the last bound, usually lossless files,
+// form a final open-ended band.
+var BitrateBuckets = []int64{128, 192, 256, 320}
+
+// FormatStats totals the tracks of one file format
+type FormatStats struct {
+	Format   string // Extension without the dot, e.g. "flac"
+	Count    int
+	Size     int64 // bytes
+	Duration int64 // milliseconds
+}
+
+// BitrateBand counts tracks with a bitrate in (MinKbps, MaxKbps]. MaxKbps
+// is 0 for the open-ended top band.
+type BitrateBand struct {
+	MinKbps int64
+	MaxKbps int64
+	Count   int
+}
+
+// Stats summarizes the size and health of a scanned library
+type Stats struct {
+	Tracks         int
+	Formats        []FormatStats // Most tracks first
+	Duration       int64         // milliseconds
+	Size           int64         // bytes
+	Bitrates       []BitrateBand
+	UnknownBitrate int // Tracks with no bitrate, e.g. because ffprobe failed
+	Folders        int // Folders holding tracks
+	MissingArt     int // Folders holding tracks but no cover art file
+	Untagged       int // Tracks with neither an artist nor an album tag
+	Unreadable     []scanner.UnreadableFile
+	LibraryErrors  map[string]string // Library path -> why it couldn't be scanned
+}
+
+// ComputeStats summarizes scan results. Art is looked for in the artwork
+// files found by the metadata scan, so embedded art isn't counted.
+func ComputeStats(results []scanner.ScanResult, metadata *scanner.LibraryMetadata) Stats {
+	stats := Stats{Bitrates: make([]BitrateBand, len(BitrateBuckets)+1)}
+	for i := range stats.Bitrates {
+		if i > 0 {
+			stats.Bitrates[i].MinKbps = BitrateBuckets[i-1]
+		}
+		if i < len(BitrateBuckets) {
+			stats.Bitrates[i].MaxKbps = BitrateBuckets[i]
+		}
+	}
+
+	formats := make(map[string]*FormatStats)
+	folders := make(map[string]bool)
+	for _, result := range results {
+		if result.Error != "" {
+			if stats.LibraryErrors == nil {
+				stats.LibraryErrors = make(map[string]string)
+			}
+			stats.LibraryErrors[result.LibraryPath] = result.Error
+		}
+		stats.Unreadable = append(stats.Unreadable, result.Unreadable...)
+
+		for _, f := range result.Files {
+			stats.Tracks++
+			stats.Size += f.Size
+			folders[filepath.Dir(f.Path)] = true
+
+			file := f.Path
+			if f.Cue != nil {
+				file = f.Cue.Image // Tracks of a CUE sheet are in the image's format
+			}
+			ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+			format := formats[ext]
+			if format == nil {
+				format = &FormatStats{Format: ext}
+				formats[ext] = format
+			}
+			format.Count++
+			format.Size += f.Size
+
+			m := f.Metadata
+			if m == nil || (m.Artist == "" && m.Album == "") {
+				stats.Untagged++
+			}
+			if m == nil {
+				stats.UnknownBitrate++
+				continue
+			}
+			stats.Duration += m.Duration
+			format.Duration += m.Duration
+			if m.Bitrate <= 0 {
+				stats.UnknownBitrate++
+			} else {
+				stats.Bitrates[bitrateBand(m.Bitrate)].Count++
+			}
+		}
+	}
+
+	stats.Formats = make([]FormatStats, 0, len(formats))
+	for _, format := range formats {
+		stats.Formats = append(stats.Formats, *format)
+	}
+	sort.Slice(stats.Formats, func(i, j int) bool {
+		a, b := stats.Formats[i], stats.Formats[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Format < b.Format
+	})
+
+	stats.Folders = len(folders)
+	for dir := range folders {
+		if metadata == nil || len(metadata.Artwork[dir]) == 0 {
+			stats.MissingArt++
+		}
+	}
+	return stats
+}
+
+// bitrateBand returns the index of the band a bitrate in bits per second
+// falls in. Bitrates are rounded to the nearest kbps first, so a 320 kbps
+// MP3 reported as 320043 bps still counts as 320.
+func bitrateBand(bps int64) int {
+	kbps := (bps + 500) / 1000
+	for i, max := range BitrateBuckets {
+		if kbps <= max {
+			return i
+		}
+	}
+	return len(BitrateBuckets)
+}
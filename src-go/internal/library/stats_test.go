@@ -0,0 +1,55 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/austinkregel/local-media/musicd/internal/scanner"
+)
+
+func TestComputeStats(t *testing.T) {
+	results := []scanner.ScanResult{
+		{
+			LibraryPath: "/music",
+			Files: []scanner.FileInfo{
+				{Path: "/music/a/01.flac", Size: 30_000_000, Metadata: &scanner.TrackMetadata{Artist: "A", Duration: 200_000, Bitrate: 900_000}},
+				{Path: "/music/a/02.flac", Size: 40_000_000, Metadata: &scanner.TrackMetadata{Artist: "A", Duration: 250_000, Bitrate: 950_000}},
+				{Path: "/music/b/01.mp3", Size: 8_000_000, Metadata: &scanner.TrackMetadata{Title: "01", Duration: 200_000, Bitrate: 320_043}},
+				{Path: "/music/b/02.MP3", Size: 3_000_000, Metadata: &scanner.TrackMetadata{Album: "B", Duration: 180_000, Bitrate: 128_000}},
+				{Path: "/music/c/broken.mp3", Size: 100},
+			},
+			Unreadable: []scanner.UnreadableFile{{Path: "/music/c/broken.mp3", Error: "Invalid data found when processing input"}},
+		},
+		{LibraryPath: "/gone", Error: "no such file or directory"},
+	}
+	metadata := &scanner.LibraryMetadata{Artwork: map[string][]string{"/music/a": {"/music/a/cover.jpg"}}}
+
+	stats := ComputeStats(results, metadata)
+
+	if stats.Tracks != 5 || stats.Size != 81_000_100 || stats.Duration != 830_000 {
+		t.Errorf("Expected 5 tracks, 81000100 bytes, 830000ms; got %d, %d, %d", stats.Tracks, stats.Size, stats.Duration)
+	}
+	if len(stats.Formats) != 2 || stats.Formats[0].Format != "mp3" || stats.Formats[0].Count != 3 || stats.Formats[1].Duration != 450_000 {
+		t.Errorf("Expected mp3 (3) then flac (450000ms), got %+v", stats.Formats)
+	}
+
+	wantBands := []int{1, 0, 0, 1, 2} // <=128, <=192, <=256, <=320, above
+	for i, want := range wantBands {
+		if stats.Bitrates[i].Count != want {
+			t.Errorf("Band %d: expected %d tracks, got %+v", i, want, stats.Bitrates[i])
+		}
+	}
+	if stats.UnknownBitrate != 1 {
+		t.Errorf("Expected 1 track without a bitrate, got %d", stats.UnknownBitrate)
+	}
+
+	if stats.Folders != 3 || stats.MissingArt != 2 {
+		t.Errorf("Expected 2 of 3 folders missing art, got %d of %d", stats.MissingArt, stats.Folders)
+	}
+	// 01.mp3 has only a title and broken.mp3 has no tags at all
+	if stats.Untagged != 2 {
+		t.Errorf("Expected 2 untagged tracks, got %d", stats.Untagged)
+	}
+	if len(stats.Unreadable) != 1 || stats.LibraryErrors["/gone"] == "" {
+		t.Errorf("Expected the unreadable file and missing library, got %+v, %+v", stats.Unreadable, stats.LibraryErrors)
+	}
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// bridge turns lines written through the standard library logger, which use
+// the "[TAG] message" convention, into structured records. The tag becomes
+// the component and the level is inferred from the message.
+type bridge struct {
+	logger *slog.Logger
+}
+
+func (b *bridge) Write(p []byte) (int, error) {
+	component, level, msg := parseLegacyLine(string(p))
+
+	if !b.logger.Enabled(context.Background(), level) {
+		return len(p), nil
+	}
+	if component != "" {
+		b.logger.Log(context.Background(), level, msg, ComponentKey, component)
+	} else {
+		b.logger.Log(context.Background(), level, msg)
+	}
+	return len(p), nil
+}
+
+// parseLegacyLine splits "[TAG] Warning: text" into its component, level and
+// message
+func parseLegacyLine(line string) (component string, level slog.Level, msg string) {
+	msg = strings.TrimRight(line, "\n")
+
+	if strings.HasPrefix(msg, "[") {
+		if end := strings.Index(msg, "]"); end > 1 {
+			component = strings.ToLower(msg[1:end])
+			msg = strings.TrimLeft(msg[end+1:], " ")
+		}
+	}
+
+	level = slog.LevelInfo
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.HasPrefix(lower, "warning:"):
+		level = slog.LevelWarn
+		msg = strings.TrimLeft(msg[len("warning:"):], " ")
+	case strings.HasPrefix(lower, "warning"):
+		level = slog.LevelWarn
+	case strings.HasPrefix(lower, "error"),
+		strings.HasPrefix(lower, "fatal"),
+		strings.HasPrefix(lower, "failed"):
+		level = slog.LevelError
+	case strings.HasPrefix(lower, "debug:"):
+		level = slog.LevelDebug
+		msg = strings.TrimLeft(msg[len("debug:"):], " ")
+	}
+
+	return component, level, msg
+}
@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// ComponentKey is the attribute naming the subsystem that logged a record
+const ComponentKey = "component"
+
+// handler fans records out to the file and stderr handlers and records them
+// in the logger's history
+type handler struct {
+	logger  *Logger
+	outputs []slog.Handler
+	attrs   []slog.Attr // Attributes added with WithAttrs, keys already prefixed
+	prefix  string      // Group prefix for attribute keys
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.logger.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, out := range h.outputs {
+		if err := out.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	entry := Entry{
+		Time:    r.Time,
+		Level:   levelName(r.Level),
+		Message: r.Message,
+	}
+	add := func(a slog.Attr) {
+		if a.Key == ComponentKey {
+			entry.Component = a.Value.String()
+			return
+		}
+		if entry.Attrs == nil {
+			entry.Attrs = make(map[string]interface{})
+		}
+		entry.Attrs[a.Key] = a.Value.Resolve().Any()
+	}
+	for _, a := range h.attrs {
+		add(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		a.Key = h.prefix + a.Key
+		add(a)
+		return true
+	})
+	h.logger.record(entry)
+
+	return firstErr
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := h.clone()
+	for i, out := range next.outputs {
+		next.outputs[i] = out.WithAttrs(attrs)
+	}
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		next.attrs = append(next.attrs, a)
+	}
+	return next
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := h.clone()
+	for i, out := range next.outputs {
+		next.outputs[i] = out.WithGroup(name)
+	}
+	next.prefix = h.prefix + name + "."
+	return next
+}
+
+func (h *handler) clone() *handler {
+	return &handler{
+		logger:  h.logger,
+		outputs: append([]slog.Handler(nil), h.outputs...),
+		attrs:   append([]slog.Attr(nil), h.attrs...),
+		prefix:  h.prefix,
+	}
+}
@@ -0,0 +1,221 @@
+// Package logging provides the daemon's leveled, structured logger.
+// Records are written as JSON to rotating files, mirrored to stderr, and kept
+// in memory so clients can fetch or follow recent logs over IPC.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxSizeMB is the default size at which the log file is rotated
+	DefaultMaxSizeMB = 5
+
+	// DefaultMaxFiles is the default number of rotated files kept
+	DefaultMaxFiles = 3
+
+	// recentCapacity is how many entries are kept in memory for getLogs
+	recentCapacity = 1000
+
+	// subscriberBuffer is how many entries may queue for a slow subscriber
+	// before further entries are dropped
+	subscriberBuffer = 256
+)
+
+// Entry is a single log record as exposed to clients
+type Entry struct {
+	Time      time.Time              `json:"time"`
+	Level     string                 `json:"level"`
+	Component string                 `json:"component,omitempty"`
+	Message   string                 `json:"msg"`
+	Attrs     map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// Options configures Setup
+type Options struct {
+	Level     string    // "debug", "info", "warn" or "error"
+	MaxSizeMB int       // Rotate after this many megabytes
+	MaxFiles  int       // Number of rotated files to keep
+	Stderr    io.Writer // Human readable mirror, nil to disable
+}
+
+// Logger owns the log outputs and the in-memory history
+type Logger struct {
+	level *slog.LevelVar
+	file  *rotatingWriter
+	slog  *slog.Logger
+
+	mu     sync.Mutex
+	recent []Entry // ring buffer
+	next   int
+	full   bool
+	subs   map[chan Entry]struct{}
+}
+
+// Setup creates the logger, installs it as the slog default and routes the
+// standard library logger through it
+func Setup(dir string, opts Options) (*Logger, error) {
+	l, err := newLogger(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.SetDefault(l.slog)
+	// Must come after SetDefault, which points the log package at slog itself
+	log.SetFlags(0)
+	log.SetOutput(&bridge{logger: l.slog})
+
+	return l, nil
+}
+
+// newLogger creates a logger writing to dir without installing it globally
+func newLogger(dir string, opts Options) (*Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxSizeMB <= 0 {
+		opts.MaxSizeMB = DefaultMaxSizeMB
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = DefaultMaxFiles
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	file, err := newRotatingWriter(filepath.Join(dir, "musicd.log"), int64(opts.MaxSizeMB)*1024*1024, opts.MaxFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Logger{
+		level:  new(slog.LevelVar),
+		file:   file,
+		recent: make([]Entry, recentCapacity),
+		subs:   make(map[chan Entry]struct{}),
+	}
+	l.level.Set(level)
+
+	handlerOpts := &slog.HandlerOptions{Level: l.level}
+	handlers := []slog.Handler{slog.NewJSONHandler(file, handlerOpts)}
+	if opts.Stderr != nil {
+		handlers = append(handlers, slog.NewTextHandler(opts.Stderr, handlerOpts))
+	}
+	l.slog = slog.New(&handler{logger: l, outputs: handlers})
+
+	return l, nil
+}
+
+// ParseLevel converts a level name into a slog level
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// SetLevel changes the minimum level that is logged
+func (l *Logger) SetLevel(name string) error {
+	level, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	l.level.Set(level)
+	return nil
+}
+
+// Recent returns up to limit of the most recent entries at or above minLevel,
+// oldest first. A limit of 0 returns everything kept in memory.
+func (l *Logger) Recent(limit int, minLevel slog.Level) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var ordered []Entry
+	if l.full {
+		ordered = append(ordered, l.recent[l.next:]...)
+	}
+	ordered = append(ordered, l.recent[:l.next]...)
+
+	entries := make([]Entry, 0, len(ordered))
+	for _, e := range ordered {
+		if level, _ := ParseLevel(e.Level); level >= minLevel {
+			entries = append(entries, e)
+		}
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+// Subscribe returns a channel receiving every new entry and a function that
+// ends the subscription. Entries are dropped if the reader falls behind.
+func (l *Logger) Subscribe() (<-chan Entry, func()) {
+	ch := make(chan Entry, subscriberBuffer)
+
+	l.mu.Lock()
+	l.subs[ch] = struct{}{}
+	l.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			delete(l.subs, ch)
+			l.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Close flushes and closes the log file
+func (l *Logger) Close() error {
+	return l.file.Close()
+}
+
+// record stores an entry and fans it out to subscribers
+func (l *Logger) record(e Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.recent[l.next] = e
+	l.next = (l.next + 1) % len(l.recent)
+	if l.next == 0 {
+		l.full = true
+	}
+
+	for ch := range l.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func levelName(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "error"
+	case level >= slog.LevelWarn:
+		return "warn"
+	case level >= slog.LevelInfo:
+		return "info"
+	}
+	return "debug"
+}
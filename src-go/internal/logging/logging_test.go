@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func createTestLogger(t *testing.T, opts Options) (*Logger, string) {
+	tmpDir, err := os.MkdirTemp("", "logging_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	logger, err := newLogger(tmpDir, opts)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	return logger, tmpDir
+}
+
+func TestParseLegacyLine(t *testing.T) {
+	tests := []struct {
+		line      string
+		component string
+		level     slog.Level
+		msg       string
+	}{
+		{"[QUEUE] Loaded saved queue\n", "queue", slog.LevelInfo, "Loaded saved queue"},
+		{"[AUTH] Warning: failed to create admin token", "auth", slog.LevelWarn, "failed to create admin token"},
+		{"[PLAYER] Failed to decode: eof", "player", slog.LevelError, "Failed to decode: eof"},
+		{"Starting IPC server", "", slog.LevelInfo, "Starting IPC server"},
+		{"[IPC] Debug: raw request", "ipc", slog.LevelDebug, "raw request"},
+	}
+
+	for _, tt := range tests {
+		component, level, msg := parseLegacyLine(tt.line)
+		if component != tt.component || level != tt.level || msg != tt.msg {
+			t.Errorf("parseLegacyLine(%q) = (%q, %v, %q), want (%q, %v, %q)",
+				tt.line, component, level, msg, tt.component, tt.level, tt.msg)
+		}
+	}
+}
+
+func TestRecentFiltersAndLimits(t *testing.T) {
+	logger, _ := createTestLogger(t, Options{Level: "debug"})
+
+	logger.slog.Debug("one", ComponentKey, "queue")
+	logger.slog.Info("two", ComponentKey, "player", "path", "/music/a.mp3")
+	logger.slog.Warn("three")
+
+	all := logger.Recent(0, slog.LevelDebug)
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(all))
+	}
+	if all[1].Component != "player" || all[1].Attrs["path"] != "/music/a.mp3" {
+		t.Errorf("Unexpected entry: %+v", all[1])
+	}
+
+	if got := logger.Recent(0, slog.LevelInfo); len(got) != 2 {
+		t.Errorf("Expected 2 entries at info, got %d", len(got))
+	}
+	if got := logger.Recent(1, slog.LevelDebug); len(got) != 1 || got[0].Message != "three" {
+		t.Errorf("Expected only the newest entry, got %+v", got)
+	}
+}
+
+func TestLevelChange(t *testing.T) {
+	logger, _ := createTestLogger(t, Options{Level: "warn"})
+
+	logger.slog.Info("hidden")
+	if err := logger.SetLevel("info"); err != nil {
+		t.Fatalf("SetLevel failed: %v", err)
+	}
+	logger.slog.Info("shown")
+
+	entries := logger.Recent(0, slog.LevelDebug)
+	if len(entries) != 1 || entries[0].Message != "shown" {
+		t.Errorf("Expected only the entry logged after the level change, got %+v", entries)
+	}
+
+	if err := logger.SetLevel("loud"); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	logger, _ := createTestLogger(t, Options{})
+
+	entries, unsubscribe := logger.Subscribe()
+	logger.slog.Info("hello")
+
+	select {
+	case e := <-entries:
+		if e.Message != "hello" {
+			t.Errorf("Expected hello, got %q", e.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for entry")
+	}
+
+	unsubscribe()
+	unsubscribe() // Safe to call twice
+	if _, ok := <-entries; ok {
+		t.Error("Expected channel to be closed after unsubscribe")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "logging_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "musicd.log")
+	w, err := newRotatingWriter(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	expect := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for file, want := range expect {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), data, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected only 2 rotated files to be kept")
+	}
+}
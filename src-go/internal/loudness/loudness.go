@@ -0,0 +1,300 @@
+// Package loudness levels tracks to a target loudness. Tracks coming up in
+// the queue are measured in the background, so their gain is ready before
+// they start instead of being corrected once they are playing.
+package loudness
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/cue"
+)
+
+// Limits on the gain applied to level a track, in dB. Boosts are kept
+// smaller than cuts since quiet masters often peak near full scale already.
+const (
+	MaxBoostDb = 6.0
+	MaxCutDb   = 20.0
+)
+
+// maxMeasured is how many measured tracks are remembered
+const maxMeasured = 5000
+
+// AnalyzedFunc returns the loudness that analysis found for a track, if any
+type AnalyzedFunc func(path string) (lufs float64, ok bool)
+
+// measurement is the result of measuring a track with FFmpeg. Tracks that
+// couldn't be measured are remembered too, so they aren't tried again.
+type measurement struct {
+	lufs float64
+	ok   bool
+}
+
+// Leveler works out the gain that brings each track to the target loudness,
+// from analysis when a track has been analyzed and from a quick FFmpeg pass
+// when it hasn't. It is safe for concurrent use.
+type Leveler struct {
+	mu         sync.Mutex
+	analyzed   AnalyzedFunc
+	onMeasured func(path string)
+	enabled    bool
+	target     float64 // LUFS
+	measured   map[string]measurement
+	order      []string // Measured paths, oldest first
+	pending    []string // Paths waiting to be measured, soonest first
+	wake       chan struct{}
+}
+
+// New creates a leveler, which is off until SetTarget turns it on
+func New() *Leveler {
+	return &Leveler{
+		measured: make(map[string]measurement),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// SetAnalyzed sets the lookup of loudness found by analysis. Analyzed tracks
+// are never measured.
+func (l *Leveler) SetAnalyzed(analyzed AnalyzedFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.analyzed = analyzed
+}
+
+// SetOnMeasured sets a callback for when a track's loudness has been
+// measured, so a track that was already playing can pick up its gain
+func (l *Leveler) SetOnMeasured(callback func(path string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onMeasured = callback
+}
+
+// SetTarget turns levelling on or off and sets the loudness it aims for
+func (l *Leveler) SetTarget(enabled bool, lufs float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enabled = enabled
+	l.target = lufs
+	if !enabled {
+		l.pending = nil
+	}
+}
+
+// Gain returns the gain in dB that brings path to the target loudness, or 0
+// while levelling is off or the track's loudness isn't known yet. An unknown
+// track is measured next.
+func (l *Leveler) Gain(path string) float64 {
+	l.mu.Lock()
+	enabled, target := l.enabled, l.target
+	l.mu.Unlock()
+	if !enabled || !measurable(path) {
+		return 0
+	}
+
+	lufs, ok := l.loudness(path)
+	if !ok {
+		l.mu.Lock()
+		if _, tried := l.measured[path]; !tried {
+			l.pending = append([]string{path}, removePath(l.pending, path)...)
+			l.signalLocked()
+		}
+		l.mu.Unlock()
+		return 0
+	}
+	return math.Max(-MaxCutDb, math.Min(target-lufs, MaxBoostDb))
+}
+
+// Prefetch measures the tracks in paths that haven't been measured or
+// analyzed, in order, replacing the tracks waiting from the last call
+func (l *Leveler) Prefetch(paths []string) {
+	l.mu.Lock()
+	enabled := l.enabled
+	l.mu.Unlock()
+	if !enabled {
+		return
+	}
+
+	var pending []string
+	for _, path := range paths {
+		if !measurable(path) {
+			continue
+		}
+		if _, ok := l.analyzedLoudness(path); ok {
+			continue
+		}
+		pending = append(pending, path)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending = l.pending[:0]
+	for _, path := range pending {
+		if _, tried := l.measured[path]; !tried {
+			l.pending = append(l.pending, path)
+		}
+	}
+	if len(l.pending) > 0 {
+		l.signalLocked()
+	}
+}
+
+// Run measures waiting tracks one at a time until ctx is cancelled
+func (l *Leveler) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.wake:
+		}
+
+		for {
+			l.mu.Lock()
+			if len(l.pending) == 0 {
+				l.mu.Unlock()
+				break
+			}
+			path := l.pending[0]
+			l.pending = l.pending[1:]
+			l.mu.Unlock()
+
+			lufs, err := measure(ctx, path)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("[AUDIO] Failed to measure loudness of %s: %v", filepath.Base(path), err)
+			} else {
+				log.Printf("[AUDIO] Measured %.1f LUFS: %s", lufs, filepath.Base(path))
+			}
+
+			l.mu.Lock()
+			l.storeLocked(path, measurement{lufs: lufs, ok: err == nil})
+			onMeasured := l.onMeasured
+			l.mu.Unlock()
+			if err == nil && onMeasured != nil {
+				onMeasured(path)
+			}
+		}
+	}
+}
+
+// loudness returns the analyzed or measured loudness of path
+func (l *Leveler) loudness(path string) (float64, bool) {
+	if lufs, ok := l.analyzedLoudness(path); ok {
+		return lufs, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m := l.measured[path]
+	return m.lufs, m.ok
+}
+
+// analyzedLoudness looks up path with the analysis lookup, which is called
+// without the lock held
+func (l *Leveler) analyzedLoudness(path string) (float64, bool) {
+	l.mu.Lock()
+	analyzed := l.analyzed
+	l.mu.Unlock()
+	if analyzed == nil {
+		return 0, false
+	}
+	return analyzed(path)
+}
+
+// storeLocked remembers a measurement, forgetting the oldest beyond
+// maxMeasured (must be called with lock held)
+func (l *Leveler) storeLocked(path string, m measurement) {
+	if _, ok := l.measured[path]; !ok {
+		l.order = append(l.order, path)
+	}
+	l.measured[path] = m
+	for len(l.order) > maxMeasured {
+		delete(l.measured, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+func (l *Leveler) signalLocked() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+func removePath(paths []string, path string) []string {
+	result := paths[:0:0]
+	for _, p := range paths {
+		if p != path {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// measurable reports whether path is a file or CUE track rather than a
+// stream, which has no end to measure to
+func measurable(path string) bool {
+	return path != "" && !audio.IsStreamURL(path)
+}
+
+var inputLoudness = regexp.MustCompile(`"input_i"\s*:\s*"([^"]+)"`)
+
+// measure runs FFmpeg's loudnorm filter over the first audio stream of a
+// track to find its integrated loudness. A track of a CUE sheet is measured
+// over its own part of the image.
+func measure(ctx context.Context, path string) (float64, error) {
+	ffmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return 0, fmt.Errorf("ffmpeg not found: %w", err)
+	}
+
+	args := []string{"-hide_banner", "-nostdin", "-nostats"}
+	file := path
+	if _, track, ok, err := cue.LoadTrack(path); ok {
+		if err != nil {
+			return 0, err
+		}
+		file = track.File
+		args = append(args, "-ss", fmt.Sprintf("%.3f", track.Start.Seconds()))
+		if track.End > track.Start {
+			args = append(args, "-t", fmt.Sprintf("%.3f", (track.End-track.Start).Seconds()))
+		}
+	}
+	args = append(args,
+		"-i", file,
+		"-map", "0:a:0",
+		"-af", "loudnorm=print_format=json",
+		"-f", "null", "-",
+	)
+
+	output, err := exec.CommandContext(ctx, ffmpegPath, args...).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", err, lastLine(output))
+	}
+	match := inputLoudness.FindSubmatch(output)
+	if match == nil {
+		return 0, fmt.Errorf("no loudness in ffmpeg output")
+	}
+	lufs, err := strconv.ParseFloat(string(match[1]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected loudness %q", match[1])
+	}
+	if math.IsInf(lufs, 0) || math.IsNaN(lufs) {
+		return 0, fmt.Errorf("track is silent")
+	}
+	return lufs, nil
+}
+
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return lines[len(lines)-1]
+}
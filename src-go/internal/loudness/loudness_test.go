@@ -0,0 +1,135 @@
+package loudness
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFFmpeg puts an ffmpeg on PATH that reports the loudness named by the
+// input file's contents, and logs each input to the returned file
+func fakeFFmpeg(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg is a shell script")
+	}
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	script := "#!/bin/sh\nwhile [ \"$1\" != -i ]; do shift; done\necho \"$2\" >> " + runs + "\n" +
+		"read lufs < \"$2\"\n" +
+		"printf '{\\n\\t\"input_i\" : \"%s\",\\n\\t\"input_tp\" : \"-1.00\"\\n}\\n' \"$lufs\" >&2\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	return runs
+}
+
+// track writes a fake track whose loudness is lufs
+func track(t *testing.T, dir, name, lufs string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(lufs), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrefetchMeasuresUpcomingTracks(t *testing.T) {
+	runs := fakeFFmpeg(t)
+	dir := t.TempDir()
+	quiet := track(t, dir, "quiet.flac", "-30.0")
+	loud := track(t, dir, "loud.flac", "-8.5")
+	analyzed := track(t, dir, "analyzed.flac", "-1.0")
+	silent := track(t, dir, "silent.flac", "-inf")
+
+	l := New()
+	l.SetAnalyzed(func(path string) (float64, bool) {
+		return -14, path == analyzed
+	})
+	measured := make(chan string, 10)
+	l.SetOnMeasured(func(path string) { measured <- path })
+	l.SetTarget(true, -18)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.Run(ctx)
+
+	l.Prefetch([]string{quiet, analyzed, "https://radio.example/stream", loud, silent})
+	for _, want := range []string{quiet, loud} {
+		select {
+		case got := <-measured:
+			if got != want {
+				t.Errorf("Expected %s to be measured next, got %s", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s", want)
+		}
+	}
+
+	// Boosts and cuts are limited
+	if g := l.Gain(quiet); g != MaxBoostDb {
+		t.Errorf("Expected the quiet track boosted by %v dB, got %v", MaxBoostDb, g)
+	}
+	if g := l.Gain(loud); g != -9.5 {
+		t.Errorf("Expected the loud track cut by 9.5 dB, got %v", g)
+	}
+	if g := l.Gain(analyzed); g != -4 {
+		t.Errorf("Expected the analyzed loudness to be used, got %v", g)
+	}
+
+	// Wait for the silent track, which can't be levelled and isn't retried
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(runs)
+		if strings.Count(string(data), "\n") == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected three tracks measured, got %q", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if g := l.Gain(silent); g != 0 {
+		t.Errorf("Expected no gain for a silent track, got %v", g)
+	}
+	l.Prefetch([]string{quiet, loud, silent})
+	time.Sleep(100 * time.Millisecond)
+	if data, _ := os.ReadFile(runs); strings.Count(string(data), "\n") != 3 {
+		t.Errorf("Expected measured tracks not to be measured again, got %q", data)
+	}
+
+	l.SetTarget(false, -18)
+	if g := l.Gain(loud); g != 0 {
+		t.Errorf("Expected no gain with levelling off, got %v", g)
+	}
+}
+
+func TestGainMeasuresUnknownTrack(t *testing.T) {
+	fakeFFmpeg(t)
+	path := track(t, t.TempDir(), "song.mp3", "-20.0")
+
+	l := New()
+	measured := make(chan string, 1)
+	l.SetOnMeasured(func(path string) { measured <- path })
+	l.SetTarget(true, -16)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.Run(ctx)
+
+	if g := l.Gain(path); g != 0 {
+		t.Errorf("Expected no gain before the track is measured, got %v", g)
+	}
+	select {
+	case <-measured:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the track to be measured")
+	}
+	if g := l.Gain(path); g != 4 {
+		t.Errorf("Expected a 4 dB boost once measured, got %v", g)
+	}
+}
@@ -88,6 +88,12 @@ func (s *WindowsSession) UpdateLoopStatus(status LoopStatus) error {
 	return nil
 }
 
+// UpdateVolume updates the playback volume
+func (s *WindowsSession) UpdateVolume(volume float64) error {
+	// SMTC has no volume control; the system mixer handles it
+	return nil
+}
+
 // SetCommandHandler sets the handler for media commands
 func (s *WindowsSession) SetCommandHandler(handler CommandHandler) {
 	s.handler = handler
@@ -4,6 +4,7 @@ package media
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/godbus/dbus/v5"
@@ -14,22 +15,34 @@ const (
 	mprisPlayerInterface = "org.mpris.MediaPlayer2.Player"
 	mprisBusName         = "org.mpris.MediaPlayer2.musicd"
 	mprisObjectPath      = "/org/mpris/MediaPlayer2"
+	mprisTrackID         = dbus.ObjectPath("/org/musicd/track/1")
+
+	// seekedTolerance is how far a reported position may drift from the
+	// extrapolated one before clients are told about a jump
+	seekedTolerance = time.Second
 )
 
 // MPRISSession implements MPRIS media session for Linux
 type MPRISSession struct {
 	conn       *dbus.Conn
 	handler    CommandHandler
+	status     StatusProvider // Live position/volume, if the handler provides it
 	metadata   Metadata
+	artURL     string // mpris:artUrl of metadata.ArtPath
+	art        *artCache
 	state      PlaybackState
 	position   time.Duration
+	positionAt time.Time // When position was last reported
+	volume     float64
 	shuffle    bool
 	loopStatus LoopStatus
 }
 
 // NewSession creates a new MPRIS media session
 func NewSession() (Session, error) {
-	conn, err := dbus.SessionBus()
+	// A connection of our own, so a dropped one can be replaced without
+	// touching anyone else's
+	conn, err := dbus.ConnectSessionBus()
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
 	}
@@ -48,7 +61,9 @@ func NewSession() (Session, error) {
 
 	session := &MPRISSession{
 		conn:       conn,
+		art:        newArtCache(),
 		state:      StateStopped,
+		volume:     1.0,
 		shuffle:    false,
 		loopStatus: LoopNone,
 	}
@@ -68,8 +83,10 @@ func (s *MPRISSession) exportInterfaces() error {
 		return err
 	}
 
-	// Export the Player interface
-	if err := s.conn.Export(s, dbus.ObjectPath(mprisObjectPath), mprisPlayerInterface); err != nil {
+	// Export the Player interface. Seek is implemented as SeekBy so it does
+	// not clash with the io.Seeker signature.
+	seekMapping := map[string]string{"SeekBy": "Seek"}
+	if err := s.conn.ExportWithMap(s, seekMapping, dbus.ObjectPath(mprisObjectPath), mprisPlayerInterface); err != nil {
 		return err
 	}
 
@@ -83,6 +100,14 @@ func (s *MPRISSession) exportInterfaces() error {
 
 // UpdateMetadata updates the track metadata
 func (s *MPRISSession) UpdateMetadata(metadata Metadata) error {
+	if metadata.ArtPath != s.metadata.ArtPath || s.artURL == "" {
+		s.artURL = ""
+		if metadata.ArtPath != "" {
+			s.artURL = s.art.url(metadata.ArtPath)
+		} else {
+			s.art.clear()
+		}
+	}
 	s.metadata = metadata
 
 	// Emit PropertiesChanged signal
@@ -96,23 +121,53 @@ func (s *MPRISSession) UpdateMetadata(metadata Metadata) error {
 // UpdatePlaybackState updates the playback state
 func (s *MPRISSession) UpdatePlaybackState(state PlaybackState, position time.Duration) error {
 	oldState := s.state
+	expected := s.expectedPosition()
 	s.state = state
 	s.position = position
+	s.positionAt = time.Now()
 
 	// Only emit PlaybackStatus - clients track position based on rate
 	props := map[string]dbus.Variant{
 		"PlaybackStatus": dbus.MakeVariant(s.getPlaybackStatus()),
 	}
 
-	// When starting playback from stopped, emit Seeked signal with position 0
-	if oldState != state && state == StatePlaying {
-		// Emit Seeked signal to tell OS the current position
+	// Tell clients the position when playback starts or jumps (seek, track
+	// change) so their sliders don't extrapolate from a stale value
+	drift := position - expected
+	if drift < 0 {
+		drift = -drift
+	}
+	if (oldState != state && state == StatePlaying) || (state != StateStopped && drift > seekedTolerance) {
 		s.emitSeeked(position)
 	}
 
 	return s.emitPropertiesChanged(mprisPlayerInterface, props)
 }
 
+// expectedPosition extrapolates the last reported position to now
+func (s *MPRISSession) expectedPosition() time.Duration {
+	if s.state == StatePlaying && !s.positionAt.IsZero() {
+		return s.position + time.Since(s.positionAt)
+	}
+	return s.position
+}
+
+// currentPosition returns the live playback position
+func (s *MPRISSession) currentPosition() time.Duration {
+	if s.status != nil {
+		return s.status.Position()
+	}
+	return s.expectedPosition()
+}
+
+// currentVolume returns the live playback volume
+func (s *MPRISSession) currentVolume() float64 {
+	if s.status != nil {
+		return s.status.Volume()
+	}
+	return s.volume
+}
+
 // emitSeeked emits the Seeked signal to tell clients the current position
 func (s *MPRISSession) emitSeeked(position time.Duration) error {
 	return s.conn.Emit(
@@ -144,13 +199,32 @@ func (s *MPRISSession) UpdateLoopStatus(status LoopStatus) error {
 	return s.emitPropertiesChanged(mprisPlayerInterface, props)
 }
 
+// UpdateVolume updates the playback volume
+func (s *MPRISSession) UpdateVolume(volume float64) error {
+	s.volume = volume
+
+	props := map[string]dbus.Variant{
+		"Volume": dbus.MakeVariant(volume),
+	}
+
+	return s.emitPropertiesChanged(mprisPlayerInterface, props)
+}
+
 // SetCommandHandler sets the handler for media commands
 func (s *MPRISSession) SetCommandHandler(handler CommandHandler) {
 	s.handler = handler
+	s.status, _ = handler.(StatusProvider)
+}
+
+// Disconnected is closed when the session bus connection drops, e.g. after
+// the login session restarts
+func (s *MPRISSession) Disconnected() <-chan struct{} {
+	return s.conn.Context().Done()
 }
 
 // Close releases resources
 func (s *MPRISSession) Close() error {
+	s.art.clear()
 	if s.conn != nil {
 		return s.conn.Close()
 	}
@@ -213,21 +287,37 @@ func (s *MPRISSession) Previous() *dbus.Error {
 	return nil
 }
 
-func (s *MPRISSession) Seek(offset int64) *dbus.Error {
-	if s.handler != nil {
-		newPos := s.position + time.Duration(offset)*time.Microsecond
-		if newPos < 0 {
-			newPos = 0
-		}
-		s.handler.OnCommand(CmdSeek, newPos)
+// SeekBy implements the MPRIS Seek method: offset is in microseconds,
+// relative to the current position
+func (s *MPRISSession) SeekBy(offset int64) *dbus.Error {
+	if s.handler == nil {
+		return nil
+	}
+
+	newPos := s.currentPosition() + time.Duration(offset)*time.Microsecond
+	if newPos < 0 {
+		newPos = 0
 	}
+	// Seeking past the end behaves like Next, per the MPRIS spec
+	if s.metadata.Duration > 0 && newPos >= s.metadata.Duration {
+		s.handler.OnCommand(CmdNext, nil)
+		return nil
+	}
+	s.handler.OnCommand(CmdSeek, newPos)
 	return nil
 }
 
 func (s *MPRISSession) SetPosition(trackId dbus.ObjectPath, position int64) *dbus.Error {
-	if s.handler != nil {
-		s.handler.OnCommand(CmdSeek, time.Duration(position)*time.Microsecond)
+	if s.handler == nil {
+		return nil
 	}
+
+	// Requests for a stale track or outside the track are ignored, per the MPRIS spec
+	pos := time.Duration(position) * time.Microsecond
+	if trackId != mprisTrackID || pos < 0 || (s.metadata.Duration > 0 && pos > s.metadata.Duration) {
+		return nil
+	}
+	s.handler.OnCommand(CmdSeek, pos)
 	return nil
 }
 
@@ -277,6 +367,20 @@ func (s *MPRISSession) Set(iface, prop string, value dbus.Variant) *dbus.Error {
 		if s.handler != nil {
 			s.handler.OnCommand(CmdSetLoopStatus, LoopStatus(status))
 		}
+	case "Volume":
+		volume, ok := value.Value().(float64)
+		if !ok || math.IsNaN(volume) {
+			return dbus.MakeFailedError(fmt.Errorf("invalid Volume"))
+		}
+		// Negative values mean mute; we don't amplify above 1.0
+		if volume < 0 {
+			volume = 0
+		} else if volume > 1 {
+			volume = 1
+		}
+		if s.handler != nil {
+			s.handler.OnCommand(CmdSetVolume, volume)
+		}
 	}
 
 	return nil
@@ -309,7 +413,7 @@ func (s *MPRISSession) getPlayerProperty(prop string) (dbus.Variant, *dbus.Error
 	case "Metadata":
 		return dbus.MakeVariant(s.getMetadataMap()), nil
 	case "Position":
-		return dbus.MakeVariant(s.position.Microseconds()), nil
+		return dbus.MakeVariant(s.currentPosition().Microseconds()), nil
 	case "Rate":
 		return dbus.MakeVariant(1.0), nil
 	case "MinimumRate":
@@ -329,7 +433,7 @@ func (s *MPRISSession) getPlayerProperty(prop string) (dbus.Variant, *dbus.Error
 	case "CanControl":
 		return dbus.MakeVariant(true), nil
 	case "Volume":
-		return dbus.MakeVariant(1.0), nil
+		return dbus.MakeVariant(s.currentVolume()), nil
 	case "Shuffle":
 		return dbus.MakeVariant(s.shuffle), nil
 	case "LoopStatus":
@@ -354,7 +458,7 @@ func (s *MPRISSession) getAllPlayerProperties() map[string]dbus.Variant {
 	return map[string]dbus.Variant{
 		"PlaybackStatus": dbus.MakeVariant(s.getPlaybackStatus()),
 		"Metadata":       dbus.MakeVariant(s.getMetadataMap()),
-		"Position":       dbus.MakeVariant(s.position.Microseconds()),
+		"Position":       dbus.MakeVariant(s.currentPosition().Microseconds()),
 		"Rate":           dbus.MakeVariant(1.0),
 		"MinimumRate":    dbus.MakeVariant(1.0),
 		"MaximumRate":    dbus.MakeVariant(1.0),
@@ -364,7 +468,7 @@ func (s *MPRISSession) getAllPlayerProperties() map[string]dbus.Variant {
 		"CanPause":       dbus.MakeVariant(true),
 		"CanSeek":        dbus.MakeVariant(true),
 		"CanControl":     dbus.MakeVariant(true),
-		"Volume":         dbus.MakeVariant(1.0),
+		"Volume":         dbus.MakeVariant(s.currentVolume()),
 		"Shuffle":        dbus.MakeVariant(s.shuffle),
 		"LoopStatus":     dbus.MakeVariant(string(s.loopStatus)),
 	}
@@ -384,7 +488,7 @@ func (s *MPRISSession) getPlaybackStatus() string {
 func (s *MPRISSession) getMetadataMap() map[string]dbus.Variant {
 	m := make(map[string]dbus.Variant)
 
-	m["mpris:trackid"] = dbus.MakeVariant(dbus.ObjectPath("/org/musicd/track/1"))
+	m["mpris:trackid"] = dbus.MakeVariant(mprisTrackID)
 
 	if s.metadata.Title != "" {
 		m["xesam:title"] = dbus.MakeVariant(s.metadata.Title)
@@ -398,8 +502,8 @@ func (s *MPRISSession) getMetadataMap() map[string]dbus.Variant {
 	if s.metadata.Duration > 0 {
 		m["mpris:length"] = dbus.MakeVariant(s.metadata.Duration.Microseconds())
 	}
-	if s.metadata.ArtPath != "" {
-		m["mpris:artUrl"] = dbus.MakeVariant("file://" + s.metadata.ArtPath)
+	if s.artURL != "" {
+		m["mpris:artUrl"] = dbus.MakeVariant(s.artURL)
 	}
 
 	return m
@@ -0,0 +1,144 @@
+//go:build linux
+
+package media
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxArtCopyBytes is the largest cover art copied into the runtime
+// directory; bigger files are linked to where they are
+const maxArtCopyBytes = 16 << 20
+
+// artCache copies cover art into the user's runtime directory, so a desktop
+// shell outside our sandbox (Flatpak, snap) or without access to the music
+// folder can still show it. Only the current track's art is kept.
+type artCache struct {
+	dir  string // "" when there's no runtime directory
+	copy string // The current copy
+}
+
+func newArtCache() *artCache {
+	return &artCache{dir: runtimeArtDir()}
+}
+
+// runtimeArtDir returns where copied art goes. Under Flatpak only the app's
+// own directory in XDG_RUNTIME_DIR is shared with the host; snaps already
+// get a runtime directory of their own.
+func runtimeArtDir() string {
+	runtime := os.Getenv("XDG_RUNTIME_DIR")
+	if runtime == "" {
+		return ""
+	}
+	if app := os.Getenv("FLATPAK_ID"); app != "" {
+		return filepath.Join(runtime, "app", app, "musicd-art")
+	}
+	return filepath.Join(runtime, "musicd", "art")
+}
+
+// url returns the mpris:artUrl for the art at path, copied into the runtime
+// directory if possible and linked in place otherwise. Anything that isn't
+// a JPEG or PNG gets no art: the path can come from a client, and the copy
+// would put the file where any app in the session can read it.
+func (c *artCache) url(path string) string {
+	if err := checkImage(path); err != nil {
+		log.Printf("[MEDIA] Not showing album art: %v", err)
+		return ""
+	}
+	if c.dir != "" {
+		if copied, err := c.copyArt(path); err != nil {
+			log.Printf("[MEDIA] Failed to copy album art for MPRIS: %v", err)
+		} else {
+			path = copied
+		}
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// copyArt copies path into the runtime directory, replacing the previous
+// copy. The name changes with the file, so shells don't show stale art.
+func (c *artCache) copyArt(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > maxArtCopyBytes {
+		return "", fmt.Errorf("%s is too large to copy", path)
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%d\x00%d", path, info.Size(), info.ModTime().UnixNano())
+	name := filepath.Join(c.dir, fmt.Sprintf("%016x%s", h.Sum64(), filepath.Ext(path)))
+	if name == c.copy {
+		if _, err := os.Stat(name); err == nil {
+			return name, nil
+		}
+	}
+
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return "", err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(c.dir, ".art-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return "", err
+	}
+
+	if c.copy != "" && c.copy != name {
+		os.Remove(c.copy)
+	}
+	c.copy = name
+	return name, nil
+}
+
+// checkImage returns an error unless path is a JPEG or PNG by both name and
+// content
+func checkImage(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png":
+	default:
+		return fmt.Errorf("%s is not a JPEG or PNG", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	switch http.DetectContentType(head[:n]) {
+	case "image/jpeg", "image/png":
+		return nil
+	}
+	return fmt.Errorf("%s is not a JPEG or PNG", path)
+}
+
+// clear removes the current copy
+func (c *artCache) clear() {
+	if c.copy != "" {
+		os.Remove(c.copy)
+		c.copy = ""
+	}
+}
@@ -0,0 +1,78 @@
+//go:build linux
+
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// jpeg starts like a JPEG file, enough for content sniffing
+var jpeg = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+
+func TestArtCacheCopiesIntoRuntimeDir(t *testing.T) {
+	runtime := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtime)
+	t.Setenv("FLATPAK_ID", "")
+
+	music := t.TempDir()
+	first := filepath.Join(music, "My Album", "cover.jpg")
+	second := filepath.Join(music, "Other", "folder.png")
+	for _, path := range []string{first, second} {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, jpeg, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newArtCache()
+	url := c.url(first)
+	dir := filepath.Join(runtime, "musicd", "art")
+	if !strings.HasPrefix(url, "file://"+dir+"/") || !strings.HasSuffix(url, ".jpg") {
+		t.Fatalf("Expected art copied into %s, got %s", dir, url)
+	}
+	copied := strings.TrimPrefix(url, "file://")
+	if data, err := os.ReadFile(copied); err != nil || string(data) != string(jpeg) {
+		t.Fatalf("Expected the copy to hold the art, got %q, %v", data, err)
+	}
+
+	// Only the current track's art is kept
+	c.url(second)
+	if _, err := os.Stat(copied); !os.IsNotExist(err) {
+		t.Errorf("Expected the previous copy removed, got %v", err)
+	}
+	c.clear()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no copies left, got %d", len(entries))
+	}
+
+	// Without a runtime directory art is linked in place, escaped
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	if url := newArtCache().url(first); url != "file://"+strings.ReplaceAll(first, " ", "%20") {
+		t.Errorf("Expected a link to the original, got %s", url)
+	}
+}
+
+func TestArtCacheRefusesOtherFiles(t *testing.T) {
+	runtime := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtime)
+	t.Setenv("FLATPAK_ID", "")
+
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "token.json")
+	disguised := filepath.Join(dir, "cover.jpg")
+	os.WriteFile(secret, []byte(`{"token":"x"}`), 0600)
+	os.WriteFile(disguised, []byte(`{"token":"x"}`), 0600)
+
+	c := newArtCache()
+	for _, path := range []string{secret, disguised} {
+		if url := c.url(path); url != "" {
+			t.Errorf("%s: expected no art, got %s", path, url)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Join(runtime, "musicd", "art")); len(entries) != 0 {
+		t.Errorf("Expected nothing copied, got %d files", len(entries))
+	}
+}
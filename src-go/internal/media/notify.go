@@ -0,0 +1,18 @@
+package media
+
+import "time"
+
+// Notification is a desktop notification
+type Notification struct {
+	Title     string
+	Body      string
+	ImagePath string        // Album art shown with it, if any
+	Timeout   time.Duration // How long it stays up, 0 for the OS default
+}
+
+// Notifier posts desktop notifications. Each notification replaces the one
+// before it rather than stacking up.
+type Notifier interface {
+	Notify(n Notification) error
+	Close() error
+}
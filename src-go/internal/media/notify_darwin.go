@@ -0,0 +1,73 @@
+//go:build darwin
+
+package media
+
+/*
+#cgo CFLAGS: -x objective-c -Wno-deprecated-declarations
+#cgo LDFLAGS: -framework Foundation -framework AppKit
+
+#import <Foundation/Foundation.h>
+#import <AppKit/AppKit.h>
+
+// postUserNotification replaces the last notification with a new one.
+// Returns 0 when there is no notification center, as for binaries that
+// aren't run from an app bundle.
+static int postUserNotification(const char* title, const char* body, const char* imagePath) {
+    @autoreleasepool {
+        NSUserNotificationCenter *center = [NSUserNotificationCenter defaultUserNotificationCenter];
+        if (center == nil) {
+            return 0;
+        }
+
+        NSUserNotification *notification = [[NSUserNotification alloc] init];
+        notification.title = [NSString stringWithUTF8String:title];
+        notification.informativeText = [NSString stringWithUTF8String:body];
+        if (imagePath != NULL) {
+            NSImage *image = [[NSImage alloc] initWithContentsOfFile:[NSString stringWithUTF8String:imagePath]];
+            if (image != nil) {
+                notification.contentImage = image;
+            }
+        }
+
+        [center removeAllDeliveredNotifications];
+        [center deliverNotification:notification];
+        return 1;
+    }
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// UserNotifier posts notifications through the macOS notification center
+type UserNotifier struct{}
+
+// NewNotifier returns a notifier for the macOS notification center
+func NewNotifier() (Notifier, error) {
+	return &UserNotifier{}, nil
+}
+
+func (n *UserNotifier) Notify(notification Notification) error {
+	cTitle := C.CString(notification.Title)
+	defer C.free(unsafe.Pointer(cTitle))
+	cBody := C.CString(notification.Body)
+	defer C.free(unsafe.Pointer(cBody))
+
+	var cImage *C.char
+	if notification.ImagePath != "" {
+		cImage = C.CString(notification.ImagePath)
+		defer C.free(unsafe.Pointer(cImage))
+	}
+
+	if C.postUserNotification(cTitle, cBody, cImage) == 0 {
+		return errors.New("notification center unavailable")
+	}
+	return nil
+}
+
+func (n *UserNotifier) Close() error {
+	return nil
+}
@@ -0,0 +1,69 @@
+//go:build linux
+
+package media
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	notificationsBusName    = "org.freedesktop.Notifications"
+	notificationsObjectPath = "/org/freedesktop/Notifications"
+	notificationsInterface  = "org.freedesktop.Notifications"
+)
+
+// bodyMarkup escapes the characters notification servers read as markup
+var bodyMarkup = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// DBusNotifier posts notifications through org.freedesktop.Notifications
+type DBusNotifier struct {
+	conn *dbus.Conn
+
+	mu     sync.Mutex
+	lastID uint32 // Replaced by the next notification
+}
+
+// NewNotifier connects to the notification server on the session bus
+func NewNotifier() (Notifier, error) {
+	// A connection of our own, as closing the shared one would take MPRIS down with it
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+	return &DBusNotifier{conn: conn}, nil
+}
+
+func (n *DBusNotifier) Notify(notification Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	hints := map[string]dbus.Variant{
+		"category":  dbus.MakeVariant("x-gnome.music"),
+		"transient": dbus.MakeVariant(true),
+	}
+	if notification.ImagePath != "" {
+		hints["image-path"] = dbus.MakeVariant(notification.ImagePath)
+	}
+	timeout := int32(-1) // The server's default
+	if notification.Timeout > 0 {
+		timeout = int32(notification.Timeout.Milliseconds())
+	}
+
+	call := n.conn.Object(notificationsBusName, notificationsObjectPath).Call(
+		notificationsInterface+".Notify", 0,
+		"musicd", n.lastID, "", notification.Title, bodyMarkup.Replace(notification.Body),
+		[]string{}, hints, timeout,
+	)
+	if call.Err != nil {
+		return call.Err
+	}
+	return call.Store(&n.lastID)
+}
+
+func (n *DBusNotifier) Close() error {
+	return n.conn.Close()
+}
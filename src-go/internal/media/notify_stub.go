@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package media
+
+import "fmt"
+
+// NewNotifier returns an error: desktop notifications are only posted on
+// Linux and macOS
+func NewNotifier() (Notifier, error) {
+	return nil, fmt.Errorf("desktop notifications not supported on this platform")
+}
@@ -252,6 +252,12 @@ func (s *DarwinSession) UpdateLoopStatus(status LoopStatus) error {
 	return nil
 }
 
+// UpdateVolume updates the playback volume
+// Note: macOS Now Playing Center has no volume control; the system volume is used
+func (s *DarwinSession) UpdateVolume(volume float64) error {
+	return nil
+}
+
 // SetCommandHandler sets the handler for media commands
 func (s *DarwinSession) SetCommandHandler(handler CommandHandler) {
 	s.handler = handler
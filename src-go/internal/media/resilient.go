@@ -0,0 +1,296 @@
+package media
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Backoff between attempts to bring a dropped media session back
+const (
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = 2 * time.Minute
+)
+
+// ErrUnsupported is returned by NewSession on platforms without OS media
+// integration, where reconnecting would never succeed
+var ErrUnsupported = errors.New("media session not supported on this platform")
+
+// errDisconnected is why a session that lost its connection is degraded
+var errDisconnected = errors.New("connection to the media session lost")
+
+// Disconnecter is implemented by sessions whose connection to the OS can drop
+// out from under them, such as MPRIS after the D-Bus session bus restarts
+type Disconnecter interface {
+	// Disconnected is closed once the session has lost its connection
+	Disconnected() <-chan struct{}
+}
+
+// ResilientSession keeps an OS media session registered. When the session
+// drops or an update to it fails, a new one is connected with exponential
+// backoff and the last state is replayed to it. Updates made while degraded
+// are remembered rather than lost.
+type ResilientSession struct {
+	connect func() (Session, error)
+
+	mu       sync.Mutex
+	session  Session       // nil while degraded
+	lost     chan struct{} // Closed when session is given up on
+	err      error         // Why the session is degraded
+	handler  CommandHandler
+	onChange func(available bool, err error)
+
+	// Last update of each kind, replayed to a reconnected session
+	metadata   *Metadata
+	state      PlaybackState
+	position   time.Duration
+	positionAt time.Time
+	shuffle    bool
+	loopStatus LoopStatus
+	volume     float64
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewResilientSession connects a session with connect, and keeps connecting
+// new ones in the background while it's down. A session that fails to
+// connect at first is retried too, unless the platform is unsupported.
+func NewResilientSession(connect func() (Session, error)) *ResilientSession {
+	s := &ResilientSession{
+		connect:    connect,
+		lost:       make(chan struct{}),
+		loopStatus: LoopNone,
+		volume:     1.0,
+		done:       make(chan struct{}),
+	}
+	s.session, s.err = connect()
+	if errors.Is(s.err, ErrUnsupported) {
+		return s
+	}
+	go s.run()
+	return s
+}
+
+// Available reports whether the session is registered with the OS, and if
+// not, why
+func (s *ResilientSession) Available() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.session != nil, s.err
+}
+
+// OnStatusChange sets fn to be called when the session is lost, with the
+// reason, and when it comes back
+func (s *ResilientSession) OnStatusChange(fn func(available bool, err error)) {
+	s.mu.Lock()
+	s.onChange = fn
+	s.mu.Unlock()
+}
+
+// run waits for the session to drop and brings it back, backing off
+// between failed attempts
+func (s *ResilientSession) run() {
+	backoff := reconnectMinBackoff
+	var lastErr string
+	for {
+		s.mu.Lock()
+		session, lost := s.session, s.lost
+		s.mu.Unlock()
+
+		if session != nil {
+			var disconnected <-chan struct{}
+			if d, ok := session.(Disconnecter); ok {
+				disconnected = d.Disconnected()
+			}
+			select {
+			case <-s.done:
+				return
+			case <-disconnected:
+				s.degrade(session, errDisconnected)
+			case <-lost:
+			}
+			backoff = reconnectMinBackoff
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		session, err := s.connect()
+		if err != nil {
+			// Only log a change of reason, not every attempt
+			if err.Error() != lastErr {
+				log.Printf("[MEDIA] Media session still unavailable: %v (retrying in up to %v)", err, reconnectMaxBackoff)
+				lastErr = err.Error()
+			}
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+			backoff = min(backoff*2, reconnectMaxBackoff)
+			continue
+		}
+		lastErr = ""
+		s.restore(session)
+	}
+}
+
+// degrade gives up on session, if it's still the current one
+func (s *ResilientSession) degrade(session Session, err error) {
+	s.mu.Lock()
+	if s.session != session || session == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.session = nil
+	s.err = err
+	close(s.lost)
+	onChange := s.onChange
+	s.mu.Unlock()
+
+	session.Close()
+	log.Printf("[MEDIA] Media session lost: %v; reconnecting", err)
+	if onChange != nil {
+		onChange(false, err)
+	}
+}
+
+// restore makes session the current one and replays the last state to it
+func (s *ResilientSession) restore(session Session) {
+	// The live position is read without s.mu: the player holds its own lock
+	// while it updates us, so asking it for the position with s.mu held
+	// could deadlock
+	s.mu.Lock()
+	status, _ := s.handler.(StatusProvider)
+	s.mu.Unlock()
+	var live time.Duration
+	readAt := time.Now()
+	if status != nil {
+		live = status.Position()
+	}
+
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		session.Close()
+		return
+	default:
+	}
+	position := s.recordedPosition()
+	if status != nil && !s.positionAt.After(readAt) {
+		position = live
+	}
+	if s.handler != nil {
+		session.SetCommandHandler(s.handler)
+	}
+	if s.metadata != nil {
+		session.UpdateMetadata(*s.metadata)
+	}
+	session.UpdatePlaybackState(s.state, position)
+	session.UpdateShuffle(s.shuffle)
+	session.UpdateLoopStatus(s.loopStatus)
+	session.UpdateVolume(s.volume)
+	s.session = session
+	s.lost = make(chan struct{})
+	s.err = nil
+	onChange := s.onChange
+	s.mu.Unlock()
+
+	log.Printf("[MEDIA] Media session reconnected")
+	if onChange != nil {
+		onChange(true, nil)
+	}
+}
+
+// recordedPosition extrapolates the last recorded position to now. Called
+// with s.mu held.
+func (s *ResilientSession) recordedPosition() time.Duration {
+	if s.state == StatePlaying && !s.positionAt.IsZero() {
+		return s.position + time.Since(s.positionAt)
+	}
+	return s.position
+}
+
+// update records the state with s.mu held, then applies it to the current
+// session, if there is one. A failed update gives up on the session.
+func (s *ResilientSession) update(record func(), apply func(Session) error) error {
+	s.mu.Lock()
+	record()
+	session := s.session
+	if session == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	err := apply(session)
+	s.mu.Unlock()
+
+	if err != nil {
+		s.degrade(session, err)
+	}
+	return err
+}
+
+// UpdateMetadata updates the currently playing track metadata
+func (s *ResilientSession) UpdateMetadata(metadata Metadata) error {
+	return s.update(func() { s.metadata = &metadata }, func(session Session) error {
+		return session.UpdateMetadata(metadata)
+	})
+}
+
+// UpdatePlaybackState updates the playback state and position
+func (s *ResilientSession) UpdatePlaybackState(state PlaybackState, position time.Duration) error {
+	return s.update(func() {
+		s.state, s.position, s.positionAt = state, position, time.Now()
+	}, func(session Session) error {
+		return session.UpdatePlaybackState(state, position)
+	})
+}
+
+// UpdateShuffle updates the shuffle state
+func (s *ResilientSession) UpdateShuffle(enabled bool) error {
+	return s.update(func() { s.shuffle = enabled }, func(session Session) error {
+		return session.UpdateShuffle(enabled)
+	})
+}
+
+// UpdateLoopStatus updates the repeat/loop mode
+func (s *ResilientSession) UpdateLoopStatus(status LoopStatus) error {
+	return s.update(func() { s.loopStatus = status }, func(session Session) error {
+		return session.UpdateLoopStatus(status)
+	})
+}
+
+// UpdateVolume updates the playback volume
+func (s *ResilientSession) UpdateVolume(volume float64) error {
+	return s.update(func() { s.volume = volume }, func(session Session) error {
+		return session.UpdateVolume(volume)
+	})
+}
+
+// SetCommandHandler sets the handler for media commands, on this session
+// and every one reconnected after it
+func (s *ResilientSession) SetCommandHandler(handler CommandHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = handler
+	if s.session != nil {
+		s.session.SetCommandHandler(handler)
+	}
+}
+
+// Close stops reconnecting and releases the current session
+func (s *ResilientSession) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	s.mu.Lock()
+	session := s.session
+	s.session = nil
+	s.mu.Unlock()
+	if session != nil {
+		return session.Close()
+	}
+	return nil
+}
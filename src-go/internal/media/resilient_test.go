@@ -0,0 +1,150 @@
+package media
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSession records the last state pushed to it
+type fakeSession struct {
+	NoOpSession
+	mu           sync.Mutex
+	metadata     Metadata
+	shuffle      bool
+	handler      CommandHandler
+	disconnected chan struct{}
+}
+
+func (f *fakeSession) UpdateMetadata(metadata Metadata) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metadata = metadata
+	return nil
+}
+
+func (f *fakeSession) UpdateShuffle(enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.shuffle = enabled
+	return nil
+}
+
+func (f *fakeSession) SetCommandHandler(handler CommandHandler) {
+	f.handler = handler
+}
+
+func (f *fakeSession) Disconnected() <-chan struct{} {
+	return f.disconnected
+}
+
+func TestResilientSessionReconnects(t *testing.T) {
+	var mu sync.Mutex
+	var sessions []*fakeSession
+	connect := func() (Session, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		f := &fakeSession{disconnected: make(chan struct{})}
+		sessions = append(sessions, f)
+		return f, nil
+	}
+	changes := make(chan bool, 4)
+
+	s := NewResilientSession(connect)
+	defer s.Close()
+	s.OnStatusChange(func(available bool, err error) { changes <- available })
+	handler := CommandHandlerFunc(func(Command, interface{}) error { return nil })
+	s.SetCommandHandler(handler)
+	s.UpdateMetadata(Metadata{Title: "First"})
+
+	// Drop the connection; updates made while it's down are kept
+	close(sessions[0].disconnected)
+	if available := <-changes; available {
+		t.Fatal("Expected the session to be reported lost")
+	}
+	s.UpdateShuffle(true)
+	s.UpdateMetadata(Metadata{Title: "Second"})
+
+	select {
+	case available := <-changes:
+		if !available {
+			t.Fatal("Expected the session to be reported back")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Session wasn't reconnected")
+	}
+	mu.Lock()
+	latest := sessions[len(sessions)-1]
+	mu.Unlock()
+	if latest.metadata.Title != "Second" || !latest.shuffle || latest.handler == nil {
+		t.Errorf("Expected the last state replayed to the new session, got %+v", latest)
+	}
+	if available, err := s.Available(); !available || err != nil {
+		t.Errorf("Expected the session available, got %v, %v", available, err)
+	}
+}
+
+// updatingHandler pushes an update while it's asked for the position, as
+// the player does when a track changes during a reconnect
+type updatingHandler struct {
+	CommandHandlerFunc
+	s *ResilientSession
+}
+
+func (h updatingHandler) Position() time.Duration {
+	h.s.UpdateShuffle(true)
+	return 5 * time.Second
+}
+
+func (h updatingHandler) Volume() float64 { return 1 }
+
+func TestResilientSessionRestoreDoesNotHoldLockForPosition(t *testing.T) {
+	var mu sync.Mutex
+	var sessions []*fakeSession
+	connect := func() (Session, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		f := &fakeSession{disconnected: make(chan struct{})}
+		sessions = append(sessions, f)
+		return f, nil
+	}
+	changes := make(chan bool, 4)
+
+	s := NewResilientSession(connect)
+	defer s.Close()
+	s.OnStatusChange(func(available bool, err error) { changes <- available })
+	s.SetCommandHandler(updatingHandler{
+		CommandHandlerFunc: func(Command, interface{}) error { return nil },
+		s:                  s,
+	})
+
+	mu.Lock()
+	close(sessions[0].disconnected)
+	mu.Unlock()
+	<-changes
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reconnect deadlocked asking the handler for the position")
+	}
+	mu.Lock()
+	latest := sessions[len(sessions)-1]
+	mu.Unlock()
+	latest.mu.Lock()
+	defer latest.mu.Unlock()
+	if !latest.shuffle {
+		t.Error("Expected the update made during the reconnect replayed")
+	}
+}
+
+func TestResilientSessionUnsupported(t *testing.T) {
+	s := NewResilientSession(func() (Session, error) { return nil, ErrUnsupported })
+	defer s.Close()
+	if available, err := s.Available(); available || !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected an unsupported session, got %v, %v", available, err)
+	}
+	if err := s.UpdateMetadata(Metadata{Title: "x"}); err != nil {
+		t.Errorf("Expected updates to be kept while unavailable, got %v", err)
+	}
+}
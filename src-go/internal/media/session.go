@@ -46,6 +46,9 @@ type Session interface {
 	// UpdateLoopStatus updates the repeat/loop mode
 	UpdateLoopStatus(status LoopStatus) error
 
+	// UpdateVolume updates the playback volume (0.0 - 1.0)
+	UpdateVolume(volume float64) error
+
 	// SetCommandHandler sets the handler for media commands (play, pause, etc.)
 	SetCommandHandler(handler CommandHandler)
 
@@ -66,6 +69,7 @@ const (
 	CmdSeek
 	CmdSetShuffle
 	CmdSetLoopStatus
+	CmdSetVolume
 )
 
 // String returns the command name
@@ -89,6 +93,8 @@ func (c Command) String() string {
 		return "SetShuffle"
 	case CmdSetLoopStatus:
 		return "SetLoopStatus"
+	case CmdSetVolume:
+		return "SetVolume"
 	default:
 		return "Unknown"
 	}
@@ -99,6 +105,14 @@ type CommandHandler interface {
 	OnCommand(cmd Command, data interface{}) error
 }
 
+// StatusProvider reports live playback state. Sessions that the OS queries on
+// demand (MPRIS) read from it when the command handler implements it, rather
+// than relying on the last pushed update.
+type StatusProvider interface {
+	Position() time.Duration
+	Volume() float64
+}
+
 // CommandHandlerFunc is a function adapter for CommandHandler
 type CommandHandlerFunc func(cmd Command, data interface{}) error
 
@@ -131,6 +145,10 @@ func (s *NoOpSession) UpdateLoopStatus(status LoopStatus) error {
 	return nil
 }
 
+func (s *NoOpSession) UpdateVolume(volume float64) error {
+	return nil
+}
+
 func (s *NoOpSession) SetCommandHandler(handler CommandHandler) {
 }
 
@@ -0,0 +1,360 @@
+// Package metrics provides lightweight runtime metrics for the daemon.
+// Metrics are declared by the packages that update them and registered in a
+// process-wide registry, which can be read as a JSON-friendly snapshot or in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, suited to IPC
+// latencies up to multi-minute scans
+var DefaultBuckets = []float64{0.001, 0.005, 0.025, 0.1, 0.5, 2.5, 10, 60, 300}
+
+// startTime is used for the uptime metric
+var startTime = time.Now()
+
+// metric is anything the registry can export
+type metric interface {
+	writePrometheus(w io.Writer, name string)
+	snapshot() interface{}
+}
+
+type entry struct {
+	name   string
+	help   string
+	kind   string // Prometheus type: counter, gauge or histogram
+	metric metric
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]*entry)
+)
+
+func register(name, help, kind string, m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	registry[name] = &entry{name: name, help: help, kind: kind, metric: m}
+}
+
+func sortedEntries() []*entry {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	entries := make([]*entry, 0, len(registry))
+	for _, e := range registry {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries
+}
+
+// Uptime returns how long the process has been running
+func Uptime() time.Duration {
+	return time.Since(startTime)
+}
+
+// Snapshot returns the current value of every metric keyed by name.
+// Counters and gauges are numbers, labelled metrics are maps keyed by label
+// value and histograms report their count, sum and average.
+func Snapshot() map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, e := range sortedEntries() {
+		result[e.name] = e.metric.snapshot()
+	}
+	return result
+}
+
+// WritePrometheus writes every metric in the Prometheus text format
+func WritePrometheus(w io.Writer) {
+	for _, e := range sortedEntries() {
+		fmt.Fprintf(w, "# HELP %s %s\n", e.name, e.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", e.name, e.kind)
+		e.metric.writePrometheus(w, e.name)
+	}
+}
+
+// Counter is a monotonically increasing count
+type Counter struct {
+	value atomic.Int64
+}
+
+// NewCounter registers a counter
+func NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	register(name, help, "counter", c)
+	return c
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add adds n to the counter
+func (c *Counter) Add(n int64) {
+	c.value.Add(n)
+}
+
+// Value returns the current count
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+func (c *Counter) writePrometheus(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %d\n", name, c.Value())
+}
+
+func (c *Counter) snapshot() interface{} {
+	return c.Value()
+}
+
+// CounterVec is a set of counters partitioned by one label
+type CounterVec struct {
+	label    string
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+// NewCounterVec registers a counter partitioned by label
+func NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{label: label, counters: make(map[string]*Counter)}
+	register(name, help, "counter", v)
+	return v
+}
+
+// With returns the counter for a label value
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c, ok := v.counters[value]
+	if !ok {
+		c = &Counter{}
+		v.counters[value] = c
+	}
+	return c
+}
+
+func (v *CounterVec) sortedLabels() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	labels := make([]string, 0, len(v.counters))
+	for l := range v.counters {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func (v *CounterVec) writePrometheus(w io.Writer, name string) {
+	for _, l := range v.sortedLabels() {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, v.label, l, v.With(l).Value())
+	}
+}
+
+func (v *CounterVec) snapshot() interface{} {
+	result := make(map[string]int64)
+	for _, l := range v.sortedLabels() {
+		result[l] = v.With(l).Value()
+	}
+	return result
+}
+
+// GaugeFunc reports a value computed when metrics are read
+type GaugeFunc struct {
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value comes from fn
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{fn: fn}
+	register(name, help, "gauge", g)
+	return g
+}
+
+func (g *GaugeFunc) writePrometheus(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(g.fn()))
+}
+
+func (g *GaugeFunc) snapshot() interface{} {
+	return g.fn()
+}
+
+// Histogram tracks the distribution of observed values
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64 // Per bucket, not cumulative
+	count   uint64
+	sum     float64
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := newHistogram(buckets)
+	register(name, help, "histogram", h)
+	return h
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// Observe records a value
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// ObserveDuration records the time elapsed since start in seconds
+func (h *Histogram) ObserveDuration(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) writePrometheusLabelled(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, formatFloat(upper), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+
+	braced := ""
+	if labels != "" {
+		braced = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, braced, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, braced, h.count)
+}
+
+func (h *Histogram) writePrometheus(w io.Writer, name string) {
+	h.writePrometheusLabelled(w, name, "")
+}
+
+// HistogramSnapshot summarizes a histogram for JSON output
+type HistogramSnapshot struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	Avg   float64 `json:"avg"`
+}
+
+func (h *Histogram) snapshot() interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := HistogramSnapshot{Count: h.count, Sum: h.sum}
+	if h.count > 0 {
+		s.Avg = h.sum / float64(h.count)
+	}
+	return s
+}
+
+// HistogramVec is a set of histograms partitioned by one label
+type HistogramVec struct {
+	label      string
+	buckets    []float64
+	mu         sync.Mutex
+	histograms map[string]*Histogram
+}
+
+// NewHistogramVec registers a histogram partitioned by label
+func NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	v := &HistogramVec{label: label, buckets: buckets, histograms: make(map[string]*Histogram)}
+	register(name, help, "histogram", v)
+	return v
+}
+
+// With returns the histogram for a label value
+func (v *HistogramVec) With(value string) *Histogram {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	h, ok := v.histograms[value]
+	if !ok {
+		h = newHistogram(v.buckets)
+		v.histograms[value] = h
+	}
+	return h
+}
+
+func (v *HistogramVec) sortedLabels() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	labels := make([]string, 0, len(v.histograms))
+	for l := range v.histograms {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func (v *HistogramVec) writePrometheus(w io.Writer, name string) {
+	for _, l := range v.sortedLabels() {
+		v.With(l).writePrometheusLabelled(w, name, fmt.Sprintf("%s=%q", v.label, l))
+	}
+}
+
+func (v *HistogramVec) snapshot() interface{} {
+	result := make(map[string]interface{})
+	for _, l := range v.sortedLabels() {
+		result[l] = v.With(l).snapshot()
+	}
+	return result
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%g", v)
+}
+
+// Process metrics
+var (
+	_ = NewGaugeFunc("musicd_uptime_seconds", "Seconds since the daemon started", func() float64 {
+		return Uptime().Seconds()
+	})
+	_ = NewGaugeFunc("musicd_goroutines", "Number of running goroutines", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	_ = NewGaugeFunc("musicd_heap_alloc_bytes", "Bytes of allocated heap objects", func() float64 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return float64(m.HeapAlloc)
+	})
+)
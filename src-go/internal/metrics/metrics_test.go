@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	h := newHistogram([]float64{1, 5})
+	h.Observe(0.5)
+	h.Observe(3)
+	h.Observe(10)
+
+	var buf bytes.Buffer
+	h.writePrometheus(&buf, "test_seconds")
+	out := buf.String()
+
+	for _, want := range []string{
+		`test_seconds_bucket{le="1"} 1`,
+		`test_seconds_bucket{le="5"} 2`,
+		`test_seconds_bucket{le="+Inf"} 3`,
+		`test_seconds_sum 13.5`,
+		`test_seconds_count 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+
+	snap := h.snapshot().(HistogramSnapshot)
+	if snap.Count != 3 || snap.Avg != 4.5 {
+		t.Errorf("Unexpected snapshot: %+v", snap)
+	}
+}
+
+func TestRegistryExport(t *testing.T) {
+	requests := NewCounterVec("test_requests_total", "Test requests", "command")
+	requests.With("play").Inc()
+	requests.With("play").Inc()
+	requests.With("pause").Inc()
+
+	latency := NewHistogramVec("test_latency_seconds", "Test latency", "command", []float64{0.1})
+	latency.With("play").Observe(0.05)
+
+	var buf bytes.Buffer
+	WritePrometheus(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{command="pause"} 1`,
+		`test_requests_total{command="play"} 2`,
+		`test_latency_seconds_bucket{command="play",le="0.1"} 1`,
+		`test_latency_seconds_count{command="play"} 1`,
+		"# TYPE musicd_uptime_seconds gauge",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+
+	snap := Snapshot()
+	counts, ok := snap["test_requests_total"].(map[string]int64)
+	if !ok || counts["play"] != 2 {
+		t.Errorf("Unexpected snapshot for test_requests_total: %#v", snap["test_requests_total"])
+	}
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	NewCounter("test_duplicate_total", "First")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic on duplicate registration")
+		}
+	}()
+	NewCounter("test_duplicate_total", "Second")
+}
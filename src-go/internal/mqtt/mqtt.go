@@ -0,0 +1,394 @@
+// Package mqtt is a small MQTT 3.1.1 client. It publishes and subscribes at
+// QoS 0 only, which is all publishing player state to a home automation
+// broker needs.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Packet types, in the high nibble of the first byte
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+const (
+	// protocolLevel is MQTT 3.1.1
+	protocolLevel = 4
+
+	// maxRemainingLength is the most four length bytes can encode
+	maxRemainingLength = 268435455
+
+	// maxPacketSize bounds packets read from the broker
+	maxPacketSize = 1 << 20
+
+	dialTimeout = 10 * time.Second
+
+	// DefaultKeepAlive is used when Options.KeepAlive is 0
+	DefaultKeepAlive = 30 * time.Second
+)
+
+var (
+	errClosed          = errors.New("mqtt connection closed")
+	errMalformedPacket = errors.New("malformed MQTT packet")
+)
+
+// connackErrors are the reasons a broker gives for refusing a connection
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Message is a message published to a topic
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool // The broker keeps it for clients that subscribe later
+}
+
+// Options are what a client connects with
+type Options struct {
+	Addr      string // The broker's "host:port"
+	TLS       bool
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+
+	// Will is published by the broker if the connection is lost without
+	// Close being called
+	Will *Message
+}
+
+// Client is a connection to a broker. It is safe for concurrent use.
+type Client struct {
+	conn      net.Conn
+	keepAlive time.Duration
+	onMessage func(Message)
+
+	writeMu  sync.Mutex
+	packetID uint16
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// Dial connects to a broker. onMessage is called, one message at a time,
+// with messages on the topics the client subscribes to.
+func Dial(ctx context.Context, opts Options, onMessage func(Message)) (*Client, error) {
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if opts.TLS {
+		host, _, _ := net.SplitHostPort(opts.Addr)
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", opts.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", opts.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:      conn,
+		keepAlive: opts.KeepAlive,
+		onMessage: onMessage,
+		done:      make(chan struct{}),
+	}
+	reader := bufio.NewReader(conn)
+	if err := c.connect(reader, opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go c.readLoop(reader)
+	go c.pingLoop()
+	return c, nil
+}
+
+// connect sends CONNECT and waits for the broker to accept it
+func (c *Client) connect(reader *bufio.Reader, opts Options) error {
+	c.conn.SetDeadline(time.Now().Add(dialTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if err := c.writePacket(packetConnect<<4, connectBody(opts)); err != nil {
+		return err
+	}
+	header, body, err := readPacket(reader)
+	if err != nil {
+		return fmt.Errorf("no reply to connect: %w", err)
+	}
+	if header>>4 != packetConnack || len(body) != 2 {
+		return errMalformedPacket
+	}
+	if code := body[1]; code != 0 {
+		if reason, ok := connackErrors[code]; ok {
+			return fmt.Errorf("broker refused connection: %s", reason)
+		}
+		return fmt.Errorf("broker refused connection: code %d", code)
+	}
+	return nil
+}
+
+// connectBody encodes the variable header and payload of CONNECT
+func connectBody(opts Options) []byte {
+	flags := byte(0x02) // Clean session
+	if opts.Will != nil {
+		flags |= 0x04
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = appendString(body, opts.ClientID)
+	if opts.Will != nil {
+		body = appendString(body, opts.Will.Topic)
+		body = appendString(body, string(opts.Will.Payload))
+	}
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+		if opts.Password != "" {
+			body = appendString(body, opts.Password)
+		}
+	}
+	return body
+}
+
+// Publish sends a message at QoS 0
+func (c *Client) Publish(msg Message) error {
+	header := byte(packetPublish << 4)
+	if msg.Retain {
+		header |= 0x01
+	}
+	body := appendString(nil, msg.Topic)
+	body = append(body, msg.Payload...)
+	return c.writePacket(header, body)
+}
+
+// Subscribe asks for messages on topics, which may hold wildcards, at QoS 0
+func (c *Client) Subscribe(topics ...string) error {
+	c.writeMu.Lock()
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID = 1
+	}
+	id := c.packetID
+	c.writeMu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, topic := range topics {
+		body = appendString(body, topic)
+		body = append(body, 0) // QoS 0
+	}
+	return c.writePacket(packetSubscribe<<4|0x02, body)
+}
+
+// Done is closed when the connection is lost or closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, once Done is closed
+func (c *Client) Err() error {
+	<-c.done
+	return c.err
+}
+
+// Close disconnects from the broker. The will is not published.
+func (c *Client) Close() error {
+	c.writePacket(packetDisconnect<<4, nil)
+	c.shutdown(errClosed)
+	return nil
+}
+
+func (c *Client) shutdown(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		c.conn.Close()
+		close(c.done)
+	})
+}
+
+func (c *Client) writePacket(header byte, body []byte) error {
+	if len(body) > maxRemainingLength {
+		return fmt.Errorf("mqtt packet too large: %d bytes", len(body))
+	}
+	packet := append([]byte{header}, appendLength(nil, len(body))...)
+	packet = append(packet, body...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive))
+	if _, err := c.conn.Write(packet); err != nil {
+		c.shutdown(err)
+		return err
+	}
+	return nil
+}
+
+// readLoop hands incoming messages to onMessage until the connection ends.
+// The broker answers pings, so it is lost if nothing arrives for one and a
+// half keep-alive periods.
+func (c *Client) readLoop(reader *bufio.Reader) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		header, body, err := readPacket(reader)
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+
+		switch header >> 4 {
+		case packetPublish:
+			msg, err := parsePublish(header, body)
+			if err != nil {
+				c.shutdown(err)
+				return
+			}
+			// QoS 1 needs acknowledging; subscriptions ask for 0, but a
+			// broker may still send 1
+			if qos := (header >> 1) & 0x03; qos == 1 {
+				c.writePacket(packetPuback<<4, body[2+len(msg.Topic):4+len(msg.Topic)])
+			}
+			if c.onMessage != nil {
+				c.onMessage(msg)
+			}
+		case packetSuback:
+			for _, code := range body[min(2, len(body)):] {
+				if code == 0x80 {
+					c.shutdown(errors.New("broker refused subscription"))
+					return
+				}
+			}
+		}
+	}
+}
+
+// pingLoop keeps the connection alive while nothing else is sent
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.writePacket(packetPingreq<<4, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readPacket reads one packet, returning its first byte and the rest
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, err := readLength(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length > maxPacketSize {
+		return 0, nil, fmt.Errorf("mqtt packet too large: %d bytes", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// parsePublish decodes a PUBLISH packet
+func parsePublish(header byte, body []byte) (Message, error) {
+	if len(body) < 2 {
+		return Message{}, errMalformedPacket
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	rest := body[2:]
+	if len(rest) < n {
+		return Message{}, errMalformedPacket
+	}
+	msg := Message{Topic: string(rest[:n]), Retain: header&0x01 != 0}
+	rest = rest[n:]
+	if (header>>1)&0x03 > 0 {
+		if len(rest) < 2 {
+			return Message{}, errMalformedPacket
+		}
+		rest = rest[2:] // Packet ID
+	}
+	msg.Payload = rest
+	return msg, nil
+}
+
+// appendLength appends a remaining length, seven bits to a byte
+func appendLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func readLength(r io.ByteReader) (int, error) {
+	n, shift := 0, 0
+	for i := 0; i < 4; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n |= int(digit&0x7f) << shift
+		if digit&0x80 == 0 {
+			return n, nil
+		}
+		shift += 7
+	}
+	return 0, errMalformedPacket
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,127 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRemainingLengthRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097151, maxRemainingLength} {
+		encoded := appendLength(nil, n)
+		got, err := readLength(bytes.NewReader(encoded))
+		if err != nil || got != n {
+			t.Errorf("%d: got %d, %v from % x", n, got, err, encoded)
+		}
+	}
+	if _, err := readLength(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x01})); err == nil {
+		t.Error("Expected a five byte length to be rejected")
+	}
+}
+
+func TestParsePublish(t *testing.T) {
+	body := appendString(nil, "musicd/cmd")
+	body = append(body, "pause"...)
+	msg, err := parsePublish(packetPublish<<4|0x01, body)
+	if err != nil {
+		t.Fatalf("parsePublish failed: %v", err)
+	}
+	if msg.Topic != "musicd/cmd" || string(msg.Payload) != "pause" || !msg.Retain {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+
+	// QoS 1 carries a packet ID before the payload
+	withID := appendString(nil, "t")
+	withID = append(withID, 0, 7, 'x')
+	if msg, err := parsePublish(packetPublish<<4|0x02, withID); err != nil || string(msg.Payload) != "x" {
+		t.Errorf("Expected payload x after the packet ID, got %+v, %v", msg, err)
+	}
+
+	if _, err := parsePublish(packetPublish<<4, []byte{0, 9, 'a'}); err == nil {
+		t.Error("Expected a truncated topic to be rejected")
+	}
+}
+
+func TestClientAgainstBroker(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	published := make(chan Message, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		header, body, err := readPacket(r)
+		if err != nil || header>>4 != packetConnect || !bytes.Contains(body, []byte("musicd/avail")) {
+			return
+		}
+		conn.Write([]byte{packetConnack << 4, 2, 0, 0})
+
+		if header, _, err = readPacket(r); err != nil || header>>4 != packetSubscribe {
+			return
+		}
+		conn.Write([]byte{packetSuback << 4, 3, 0, 1, 0})
+
+		cmd := appendString(nil, "musicd/cmd")
+		cmd = append(cmd, "next"...)
+		conn.Write(append(append([]byte{packetPublish << 4}, appendLength(nil, len(cmd))...), cmd...))
+
+		for {
+			header, body, err := readPacket(r)
+			if err != nil {
+				return
+			}
+			if header>>4 == packetPublish {
+				msg, _ := parsePublish(header, body)
+				published <- msg
+			}
+		}
+	}()
+
+	received := make(chan Message, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, Options{
+		Addr:     ln.Addr().String(),
+		ClientID: "test",
+		Will:     &Message{Topic: "musicd/avail", Payload: []byte("offline"), Retain: true},
+	}, func(msg Message) { received <- msg })
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Subscribe("musicd/cmd"); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	select {
+	case msg := <-received:
+		if msg.Topic != "musicd/cmd" || string(msg.Payload) != "next" {
+			t.Errorf("Unexpected message %+v", msg)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for a message")
+	}
+
+	if err := c.Publish(Message{Topic: "musicd/state", Payload: []byte(`{"state":"playing"}`), Retain: true}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	select {
+	case msg := <-published:
+		if msg.Topic != "musicd/state" || !msg.Retain {
+			t.Errorf("Unexpected published message %+v", msg)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the broker to get the message")
+	}
+}
@@ -0,0 +1,227 @@
+// Package overlay shows what's playing to stream overlays: a file rewritten
+// as the track changes, for an OBS text source, and a small HTML page for a
+// browser source.
+package overlay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+// File formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Themes are the looks the HTML overlay comes in
+var Themes = []string{"dark", "light", "transparent"}
+
+// NowPlaying is what the overlay shows
+type NowPlaying struct {
+	State    string `json:"state"` // "playing", "paused" or "stopped"
+	Title    string `json:"title"`
+	Artist   string `json:"artist"`
+	Album    string `json:"album"`
+	Duration int64  `json:"duration"` // milliseconds
+	Position int64  `json:"position"` // milliseconds
+	HasArt   bool   `json:"hasArt"`
+}
+
+// Text fills in the {title}, {artist}, {album} and {state} placeholders of
+// template. Nothing is shown while stopped.
+func (np NowPlaying) Text(template string) string {
+	if np.State == "stopped" || np.Title == "" {
+		return ""
+	}
+	return strings.NewReplacer(
+		"{title}", np.Title,
+		"{artist}", np.Artist,
+		"{album}", np.Album,
+		"{state}", np.State,
+	).Replace(template)
+}
+
+// WriteFile writes np to path in format, replacing the file whole so a
+// source reading it never sees half of it
+func WriteFile(path, format, template string, np NowPlaying) error {
+	var data []byte
+	if format == FormatJSON {
+		var err error
+		if data, err = json.Marshal(np); err != nil {
+			return err
+		}
+	} else {
+		data = []byte(np.Text(template))
+	}
+
+	if err := atomicfile.Write(path, data); err != nil {
+		return fmt.Errorf("failed to write now playing file: %w", err)
+	}
+	return nil
+}
+
+// Source provides what the HTTP overlay shows
+type Source struct {
+	// NowPlaying returns the current track
+	NowPlaying func() NowPlaying
+
+	// ArtPath returns the current track's album art file, or ""
+	ArtPath func() string
+
+	// Theme is the default look, from Themes; ?theme= picks another
+	Theme string
+
+	// CSSFile is a stylesheet added after the theme's, or ""
+	CSSFile string
+}
+
+// Handler serves the overlay page at /overlay, the current track at
+// /nowplaying.json and its album art at /art
+func Handler(src Source) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/overlay", func(w http.ResponseWriter, r *http.Request) {
+		theme := r.URL.Query().Get("theme")
+		if !isTheme(theme) {
+			theme = src.Theme
+		}
+		var custom string
+		if src.CSSFile != "" {
+			if data, err := os.ReadFile(src.CSSFile); err != nil {
+				log.Printf("[OVERLAY] Failed to read %s: %v", src.CSSFile, err)
+			} else {
+				custom = string(data)
+			}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprintf(w, overlayPage, theme, strings.ReplaceAll(custom, "</", `<\/`))
+	})
+	mux.HandleFunc("/nowplaying.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(src.NowPlaying())
+	})
+	mux.HandleFunc("/art", func(w http.ResponseWriter, r *http.Request) {
+		path := src.ArtPath()
+		if !isImage(path) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.ServeFile(w, r, path)
+	})
+	return mux
+}
+
+// isImage reports whether path names an album art image. /art has no
+// login, so anything else is refused even if it was offered as art.
+func isImage(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// Serve serves handler on addr until ctx is cancelled
+func Serve(ctx context.Context, addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("[OVERLAY] Serving the now playing overlay on http://%s/overlay", listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func isTheme(theme string) bool {
+	for _, t := range Themes {
+		if t == theme {
+			return true
+		}
+	}
+	return false
+}
+
+// overlayPage is the HTML overlay. It polls /nowplaying.json rather than
+// holding a connection open, so it recovers on its own when the daemon
+// restarts. Filled in with the theme and the custom stylesheet.
+const overlayPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Now playing</title>
+<style>
+body { margin: 0; font: 24px/1.3 system-ui, sans-serif; }
+#np { display: flex; align-items: center; gap: 16px; padding: 12px 16px; border-radius: 8px; transition: opacity .4s; }
+#np.hidden { opacity: 0; }
+#art { width: 80px; height: 80px; border-radius: 4px; object-fit: cover; }
+#art.none { display: none; }
+#title { font-weight: 600; }
+#sub { opacity: .75; font-size: .8em; }
+#bar { height: 4px; margin-top: 8px; background: currentColor; opacity: .6; width: 0; }
+.dark #np { background: rgba(0,0,0,.7); color: #fff; }
+.light #np { background: rgba(255,255,255,.85); color: #111; }
+.transparent #np { color: #fff; text-shadow: 0 1px 3px #000; }
+</style>
+<style>%[2]s</style>
+</head>
+<body class="%[1]s">
+<div id="np" class="hidden">
+<img id="art" class="none" alt="">
+<div><div id="title"></div><div id="sub"></div><div id="bar"></div></div>
+</div>
+<script>
+let art = "";
+async function update() {
+  try {
+    const np = await (await fetch("/nowplaying.json", {cache: "no-store"})).json();
+    const shown = np.state !== "stopped" && np.title;
+    document.getElementById("np").classList.toggle("hidden", !shown);
+    document.getElementById("title").textContent = np.title;
+    document.getElementById("sub").textContent = [np.artist, np.album].filter(Boolean).join(" — ");
+    document.getElementById("bar").style.width = np.duration ? (100 * np.position / np.duration) + "%%" : "0";
+    const key = np.hasArt ? np.title + "\n" + np.album : "";
+    if (key !== art) {
+      art = key;
+      const img = document.getElementById("art");
+      img.classList.toggle("none", !np.hasArt);
+      if (np.hasArt) img.src = "/art?" + encodeURIComponent(key);
+    }
+  } catch (e) {
+    document.getElementById("np").classList.add("hidden");
+  }
+}
+update();
+setInterval(update, 1000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,102 @@
+package overlay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nowplaying.txt")
+	np := NowPlaying{State: "playing", Title: "Time", Artist: "Pink Floyd", Album: "The Dark Side of the Moon"}
+
+	if err := WriteFile(path, FormatText, "{artist} - {title}", np); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "Pink Floyd - Time" {
+		t.Errorf("Expected the filled in template, got %q", data)
+	}
+
+	// Nothing is shown while stopped
+	np.State = "stopped"
+	if err := WriteFile(path, FormatText, "{artist} - {title}", np); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("Expected an empty file while stopped, got %q", data)
+	}
+
+	if err := WriteFile(path, FormatJSON, "", np); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	var got NowPlaying
+	if data, _ := os.ReadFile(path); json.Unmarshal(data, &got) != nil || got != np {
+		t.Errorf("Expected %+v as JSON, got %q", np, data)
+	}
+
+	// Only the file itself is left behind
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected no temporary files left, got %d entries", len(entries))
+	}
+}
+
+func TestHandler(t *testing.T) {
+	np := NowPlaying{State: "playing", Title: "Time", Position: 1000, Duration: 4000}
+	handler := Handler(Source{
+		NowPlaying: func() NowPlaying { return np },
+		ArtPath:    func() string { return "" },
+		Theme:      "dark",
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nowplaying.json", nil))
+	var got NowPlaying
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got != np {
+		t.Errorf("Expected %+v, got %q", np, rec.Body.String())
+	}
+
+	for query, theme := range map[string]string{"": "dark", "?theme=light": "light", "?theme=<script>": "dark"} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/overlay"+query, nil))
+		if !strings.Contains(rec.Body.String(), `<body class="`+theme+`">`) {
+			t.Errorf("%q: expected the %s theme", query, theme)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/art", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a track without art, got %d", rec.Code)
+	}
+}
+
+func TestHandlerServesOnlyImages(t *testing.T) {
+	dir := t.TempDir()
+	cover := filepath.Join(dir, "cover.jpg")
+	secret := filepath.Join(dir, "secret.txt")
+	os.WriteFile(cover, []byte("jpeg"), 0644)
+	os.WriteFile(secret, []byte("token"), 0644)
+
+	art := cover
+	handler := Handler(Source{
+		NowPlaying: func() NowPlaying { return NowPlaying{} },
+		ArtPath:    func() string { return art },
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/art", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "jpeg" {
+		t.Errorf("Expected the cover to be served, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	art = secret
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/art", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a file that isn't an image, got %d", rec.Code)
+	}
+}
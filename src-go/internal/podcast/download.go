@@ -0,0 +1,150 @@
+package podcast
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// ErrDownloading is returned when an episode is already being downloaded
+var ErrDownloading = errors.New("episode is already downloading")
+
+// Download saves an episode into the download directory so it plays offline,
+// returning where it was saved. An episode downloaded before isn't fetched
+// again.
+func (m *Manager) Download(ctx context.Context, feedURL, episodeID string) (string, error) {
+	m.mu.Lock()
+	e, err := m.episodeLocked(feedURL, episodeID)
+	if err != nil {
+		m.mu.Unlock()
+		return "", err
+	}
+	if e.LocalPath != "" {
+		if _, err := os.Stat(e.LocalPath); err == nil {
+			m.mu.Unlock()
+			return e.LocalPath, nil
+		}
+	}
+	if m.downloading[episodeID] {
+		m.mu.Unlock()
+		return "", ErrDownloading
+	}
+	m.downloading[episodeID] = true
+	audioURL, mimeType := e.AudioURL, e.MimeType
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.downloading, episodeID)
+		m.mu.Unlock()
+	}()
+
+	dest := filepath.Join(m.downloadDir, episodeFileName(feedURL, episodeID, audioURL, mimeType))
+	if err := m.fetchTo(ctx, audioURL, dest); err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The podcast may have been unsubscribed in the meantime
+	e, err = m.episodeLocked(feedURL, episodeID)
+	if err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+	e.LocalPath = dest
+	m.saveLocked()
+	return dest, nil
+}
+
+// Downloading reports whether any episode is being downloaded
+func (m *Manager) Downloading() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.downloading) > 0
+}
+
+// DeleteDownload removes an episode's downloaded copy
+func (m *Manager) DeleteDownload(feedURL, episodeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.episodeLocked(feedURL, episodeID)
+	if err != nil {
+		return err
+	}
+	if e.LocalPath == "" {
+		return nil
+	}
+	if err := os.Remove(e.LocalPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete download: %w", err)
+	}
+	e.LocalPath = ""
+	m.saveLocked()
+	return nil
+}
+
+// fetchTo downloads url into dest through a temporary file, so a failed
+// download never leaves a partial episode behind
+func (m *Manager) fetchTo(ctx context.Context, audioURL, dest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, audioURL, nil)
+	if err != nil {
+		return err
+	}
+	// Episodes are large, so the client's overall timeout doesn't apply
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download: %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(m.downloadDir, 0700); err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(m.downloadDir, ".download-*")
+	if err != nil {
+		return fmt.Errorf("failed to create download file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("download: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write download: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return fmt.Errorf("failed to save download: %w", err)
+	}
+	return nil
+}
+
+// episodeFileName names a download after a hash of its feed and episode,
+// keeping the audio's extension so decoders and renderers can recognise it
+func episodeFileName(feedURL, episodeID, audioURL, mimeType string) string {
+	sum := sha1.Sum([]byte(feedURL + "\x00" + episodeID))
+	ext := ""
+	if u, err := url.Parse(audioURL); err == nil {
+		ext = path.Ext(u.Path)
+	}
+	if ext == "" || len(ext) > 6 {
+		ext = ".mp3"
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return hex.EncodeToString(sum[:]) + ext
+}
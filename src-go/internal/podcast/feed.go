@@ -0,0 +1,165 @@
+package podcast
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFeedSize limits how much of a feed is read
+const maxFeedSize = 16 << 20
+
+// pubDateLayouts are the date formats seen in the wild for RSS pubDate
+var pubDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"Mon, 02 Jan 2006 15:04 -0700",
+	time.RFC3339,
+}
+
+// rssFeed is the part of an RSS 2.0 podcast feed that is used. Elements in
+// the iTunes namespace are matched by local name.
+type rssFeed struct {
+	Channel struct {
+		Title       string     `xml:"title"`
+		Description string     `xml:"description"`
+		Author      string     `xml:"author"`
+		Images      []rssImage `xml:"image"`
+		Items       []rssItem  `xml:"item"`
+	} `xml:"channel"`
+}
+
+// rssImage is either an RSS <image> with a <url>, or an <itunes:image> with
+// an href
+type rssImage struct {
+	URL  string `xml:"url"`
+	Href string `xml:"href,attr"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+	Duration    string `xml:"duration"`
+	Enclosure   struct {
+		URL    string `xml:"url,attr"`
+		Type   string `xml:"type,attr"`
+		Length int64  `xml:"length,attr"`
+	} `xml:"enclosure"`
+}
+
+// fetchFeed downloads and parses a feed
+func fetchFeed(ctx context.Context, client *http.Client, feedURL string) (Podcast, []*Episode, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return Podcast{}, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Podcast{}, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Podcast{}, nil, fmt.Errorf("feed: %s", resp.Status)
+	}
+	return parseFeed(io.LimitReader(resp.Body, maxFeedSize), feedURL)
+}
+
+// parseFeed reads an RSS feed into a podcast and its episodes, newest first.
+// Items without an audio enclosure are skipped.
+func parseFeed(r io.Reader, feedURL string) (Podcast, []*Episode, error) {
+	var feed rssFeed
+	dec := xml.NewDecoder(r)
+	// Feeds declaring other charsets are nearly always ASCII-compatible
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := dec.Decode(&feed); err != nil {
+		return Podcast{}, nil, fmt.Errorf("parse feed: %w", err)
+	}
+
+	ch := feed.Channel
+	p := Podcast{
+		FeedURL:     feedURL,
+		Title:       strings.TrimSpace(ch.Title),
+		Author:      strings.TrimSpace(ch.Author),
+		Description: strings.TrimSpace(ch.Description),
+	}
+	// iTunes artwork is usually the larger, so it wins
+	for _, img := range ch.Images {
+		if img.Href != "" {
+			p.ImageURL = img.Href
+			break
+		}
+		if p.ImageURL == "" {
+			p.ImageURL = strings.TrimSpace(img.URL)
+		}
+	}
+	if p.Title == "" {
+		p.Title = feedURL
+	}
+
+	var episodes []*Episode
+	for _, item := range ch.Items {
+		if item.Enclosure.URL == "" {
+			continue
+		}
+		e := &Episode{
+			ID:          strings.TrimSpace(item.GUID),
+			Title:       strings.TrimSpace(item.Title),
+			Description: strings.TrimSpace(item.Description),
+			Published:   parsePubDate(item.PubDate),
+			Duration:    parseItunesDuration(item.Duration),
+			AudioURL:    strings.TrimSpace(item.Enclosure.URL),
+			MimeType:    item.Enclosure.Type,
+			Size:        item.Enclosure.Length,
+		}
+		if e.ID == "" {
+			e.ID = e.AudioURL
+		}
+		episodes = append(episodes, e)
+	}
+	sort.SliceStable(episodes, func(i, j int) bool {
+		return episodes[i].Published.After(episodes[j].Published)
+	})
+	return p, episodes, nil
+}
+
+// parsePubDate parses an RSS date, returning the zero time if it can't
+func parsePubDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range pubDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseItunesDuration reads itunes:duration, which is either seconds or
+// [[HH:]MM:]SS, and returns milliseconds (0 if unknown)
+func parseItunesDuration(s string) int64 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	var seconds float64
+	for _, part := range strings.Split(s, ":") {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0
+		}
+		seconds = seconds*60 + v
+	}
+	return int64(seconds * 1000)
+}
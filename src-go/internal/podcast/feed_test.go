@@ -0,0 +1,99 @@
+package podcast
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+  <channel>
+    <title>Test Show</title>
+    <description>A show about tests</description>
+    <itunes:author>Jane Host</itunes:author>
+    <itunes:image href="http://example.com/cover.jpg"/>
+    <item>
+      <title>Episode 1</title>
+      <guid>ep-1</guid>
+      <pubDate>Mon, 02 Jan 2006 15:04:05 -0700</pubDate>
+      <itunes:duration>1:02:03</itunes:duration>
+      <enclosure url="http://example.com/ep1.mp3" type="audio/mpeg" length="1234"/>
+    </item>
+    <item>
+      <title>Show notes only</title>
+      <guid>notes</guid>
+    </item>
+    <item>
+      <title>Episode 2</title>
+      <pubDate>Tue, 10 Jan 2006 08:00:00 GMT</pubDate>
+      <itunes:duration>1800</itunes:duration>
+      <enclosure url="http://example.com/ep2.mp3" type="audio/mpeg"/>
+    </item>
+  </channel>
+</rss>`
+
+func TestParseFeed(t *testing.T) {
+	p, episodes, err := parseFeed(strings.NewReader(testFeed), "http://example.com/feed.xml")
+	if err != nil {
+		t.Fatalf("parseFeed failed: %v", err)
+	}
+
+	if p.Title != "Test Show" || p.Author != "Jane Host" || p.ImageURL != "http://example.com/cover.jpg" {
+		t.Errorf("Unexpected podcast: %+v", p)
+	}
+
+	// The item without an enclosure is skipped, and the newest comes first
+	if len(episodes) != 2 {
+		t.Fatalf("Expected 2 episodes, got %d", len(episodes))
+	}
+	if episodes[0].Title != "Episode 2" || episodes[1].Title != "Episode 1" {
+		t.Errorf("Expected newest first, got %q then %q", episodes[0].Title, episodes[1].Title)
+	}
+
+	// Without a guid the audio URL identifies the episode
+	if episodes[0].ID != "http://example.com/ep2.mp3" {
+		t.Errorf("Expected audio URL as ID, got %q", episodes[0].ID)
+	}
+	if episodes[1].ID != "ep-1" || episodes[1].Size != 1234 {
+		t.Errorf("Unexpected episode: %+v", episodes[1])
+	}
+	if episodes[1].Duration != (62*60+3)*1000 || episodes[0].Duration != 1800*1000 {
+		t.Errorf("Unexpected durations %d and %d", episodes[1].Duration, episodes[0].Duration)
+	}
+}
+
+func TestParseItunesDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"", 0},
+		{"90", 90_000},
+		{"05:30", 330_000},
+		{"1:00:00", 3_600_000},
+		{"12.5", 12_500},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseItunesDuration(tt.in); got != tt.want {
+			t.Errorf("parseItunesDuration(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParsePubDate(t *testing.T) {
+	want := time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC)
+	for _, in := range []string{
+		"Tue, 05 Mar 2024 09:30:00 +0000",
+		"Tue, 5 Mar 2024 09:30:00 +0000",
+		"2024-03-05T09:30:00Z",
+	} {
+		if got := parsePubDate(in); !got.Equal(want) {
+			t.Errorf("parsePubDate(%q) = %v, want %v", in, got, want)
+		}
+	}
+	if got := parsePubDate("last week"); !got.IsZero() {
+		t.Errorf("Expected zero time for an unparseable date, got %v", got)
+	}
+}
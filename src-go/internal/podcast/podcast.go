@@ -0,0 +1,436 @@
+// Package podcast manages podcast subscriptions: it refreshes RSS feeds,
+// downloads episodes and remembers how far each episode has been played.
+package podcast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+const (
+	// finishedMarginMs - positions this close to the end mark an episode played
+	finishedMarginMs = 30 * 1000
+
+	// saveDelay debounces writes caused by position updates
+	saveDelay = 2 * time.Second
+
+	// fetchTimeout bounds a single feed download
+	fetchTimeout = 30 * time.Second
+)
+
+var (
+	// ErrUnknownPodcast is returned for a feed that isn't subscribed
+	ErrUnknownPodcast = errors.New("unknown podcast")
+
+	// ErrUnknownEpisode is returned for an episode not in the feed
+	ErrUnknownEpisode = errors.New("unknown episode")
+)
+
+// Podcast is a subscribed feed
+type Podcast struct {
+	FeedURL     string    `json:"feedUrl"`
+	Title       string    `json:"title"`
+	Author      string    `json:"author,omitempty"`
+	Description string    `json:"description,omitempty"`
+	ImageURL    string    `json:"imageUrl,omitempty"`
+	Refreshed   time.Time `json:"refreshed"`
+	Error       string    `json:"error,omitempty"` // Why the last refresh failed
+}
+
+// Episode is one episode of a podcast and how far it has been played
+type Episode struct {
+	ID          string    `json:"id"` // The item's guid, or its audio URL
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Published   time.Time `json:"published"`
+	Duration    int64     `json:"duration"` // milliseconds, 0 if the feed doesn't say
+	AudioURL    string    `json:"audioUrl"`
+	MimeType    string    `json:"mimeType,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+
+	LocalPath string `json:"localPath,omitempty"` // Downloaded copy
+	Position  int64  `json:"position"`            // milliseconds
+	Played    bool   `json:"played"`
+}
+
+// Path returns what to play: the downloaded copy if there is one, otherwise
+// the audio URL
+func (e *Episode) Path() string {
+	if e.LocalPath != "" {
+		return e.LocalPath
+	}
+	return e.AudioURL
+}
+
+// subscription is a podcast with its episodes, newest first
+type subscription struct {
+	Podcast  Podcast    `json:"podcast"`
+	Episodes []*Episode `json:"episodes"`
+}
+
+// Manager keeps the subscriptions and their episodes. It is safe for
+// concurrent use.
+type Manager struct {
+	filePath    string
+	downloadDir string
+	client      *http.Client
+
+	mu            sync.Mutex
+	subscriptions []*subscription
+	downloading   map[string]bool // Episode IDs being downloaded
+	saveTimer     *time.Timer
+	interval      time.Duration
+	intervalSet   chan struct{}
+}
+
+// NewManager creates a manager that keeps its state in configDir and
+// downloads episodes into downloadDir
+func NewManager(configDir, downloadDir string) *Manager {
+	return &Manager{
+		filePath:    filepath.Join(configDir, "podcasts.json"),
+		downloadDir: downloadDir,
+		client:      &http.Client{Timeout: fetchTimeout},
+		downloading: make(map[string]bool),
+		intervalSet: make(chan struct{}, 1),
+	}
+}
+
+// Load loads the subscriptions from disk
+func (m *Manager) Load() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := os.ReadFile(m.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read podcasts file: %w", err)
+	}
+
+	var subscriptions []*subscription
+	if err := json.Unmarshal(data, &subscriptions); err != nil {
+		return fmt.Errorf("failed to parse podcasts file: %w", err)
+	}
+	m.subscriptions = subscriptions
+	return nil
+}
+
+// Subscribe fetches a feed and adds it. Subscribing to a feed again
+// refreshes it.
+func (m *Manager) Subscribe(ctx context.Context, feedURL string) (Podcast, error) {
+	podcast, episodes, err := fetchFeed(ctx, m.client, feedURL)
+	if err != nil {
+		return Podcast{}, err
+	}
+	podcast.Refreshed = time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sub := m.findLocked(feedURL); sub != nil {
+		sub.update(podcast, episodes)
+	} else {
+		m.subscriptions = append(m.subscriptions, &subscription{Podcast: podcast, Episodes: episodes})
+	}
+	m.saveLocked()
+	return podcast, nil
+}
+
+// Unsubscribe removes a feed and deletes its downloaded episodes
+func (m *Manager) Unsubscribe(feedURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, sub := range m.subscriptions {
+		if sub.Podcast.FeedURL != feedURL {
+			continue
+		}
+		for _, e := range sub.Episodes {
+			if e.LocalPath != "" {
+				os.Remove(e.LocalPath)
+			}
+		}
+		m.subscriptions = append(m.subscriptions[:i], m.subscriptions[i+1:]...)
+		m.saveLocked()
+		return nil
+	}
+	return ErrUnknownPodcast
+}
+
+// List returns the subscribed podcasts
+func (m *Manager) List() []Podcast {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	podcasts := make([]Podcast, len(m.subscriptions))
+	for i, sub := range m.subscriptions {
+		podcasts[i] = sub.Podcast
+	}
+	return podcasts
+}
+
+// Episodes returns copies of a podcast's episodes, newest first
+func (m *Manager) Episodes(feedURL string) ([]Episode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub := m.findLocked(feedURL)
+	if sub == nil {
+		return nil, ErrUnknownPodcast
+	}
+	episodes := make([]Episode, len(sub.Episodes))
+	for i, e := range sub.Episodes {
+		episodes[i] = *e
+	}
+	return episodes, nil
+}
+
+// MarkPlayed marks an episode played or unplayed. Either way it starts from
+// the beginning next time.
+func (m *Manager) MarkPlayed(feedURL, episodeID string, played bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.episodeLocked(feedURL, episodeID)
+	if err != nil {
+		return err
+	}
+	e.Played = played
+	e.Position = 0
+	m.saveLocked()
+	return nil
+}
+
+// Position returns the saved position of the episode at path in
+// milliseconds, 0 once it has been played. ok is false if path isn't an
+// episode.
+func (m *Manager) Position(path string) (positionMs int64, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.byPathLocked(path)
+	if e == nil {
+		return 0, false
+	}
+	if e.Played {
+		return 0, true
+	}
+	return e.Position, true
+}
+
+// SetPosition records the playback position of the episode at path,
+// reporting whether path is an episode. An episode played to (nearly) the
+// end is marked played.
+func (m *Manager) SetPosition(path string, positionMs, durationMs int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.byPathLocked(path)
+	if e == nil {
+		return false
+	}
+	if durationMs > 0 && positionMs >= durationMs-finishedMarginMs {
+		e.Played = true
+		e.Position = 0
+	} else {
+		e.Position = positionMs
+	}
+	if durationMs > 0 {
+		e.Duration = durationMs
+	}
+	m.scheduleSaveLocked()
+	return true
+}
+
+// Refresh fetches every feed again. A feed that fails keeps its episodes and
+// records the error.
+func (m *Manager) Refresh(ctx context.Context) {
+	for _, p := range m.List() {
+		podcast, episodes, err := fetchFeed(ctx, m.client, p.FeedURL)
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.mu.Lock()
+		if sub := m.findLocked(p.FeedURL); sub != nil {
+			if err != nil {
+				log.Printf("[PODCAST] Failed to refresh %s: %v", p.FeedURL, err)
+				sub.Podcast.Error = err.Error()
+			} else {
+				podcast.Refreshed = time.Now()
+				sub.update(podcast, episodes)
+			}
+			m.saveLocked()
+		}
+		m.mu.Unlock()
+	}
+}
+
+// SetRefreshInterval sets how often Run refreshes the feeds; 0 stops it
+func (m *Manager) SetRefreshInterval(d time.Duration) {
+	m.mu.Lock()
+	changed := d != m.interval
+	m.interval = d
+	m.mu.Unlock()
+
+	if changed {
+		select {
+		case m.intervalSet <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run refreshes the feeds every refresh interval until ctx is done
+func (m *Manager) Run(ctx context.Context) {
+	var timer <-chan time.Time
+	for {
+		m.mu.Lock()
+		interval := m.interval
+		m.mu.Unlock()
+		if interval > 0 {
+			timer = time.After(interval)
+		} else {
+			timer = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.intervalSet:
+		case <-timer:
+			m.Refresh(ctx)
+		}
+	}
+}
+
+// Flush writes pending changes to disk immediately
+func (m *Manager) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.saveTimer != nil {
+		m.saveTimer.Stop()
+		m.saveTimer = nil
+	}
+	return m.writeLocked()
+}
+
+// update replaces the podcast's details and episode list, keeping the play
+// state and downloads of episodes already known. Downloaded episodes that
+// left the feed are kept.
+func (s *subscription) update(podcast Podcast, episodes []*Episode) {
+	known := make(map[string]*Episode, len(s.Episodes))
+	for _, e := range s.Episodes {
+		known[e.ID] = e
+	}
+	for _, e := range episodes {
+		if old, ok := known[e.ID]; ok {
+			e.LocalPath, e.Position, e.Played = old.LocalPath, old.Position, old.Played
+			if e.Duration == 0 {
+				e.Duration = old.Duration
+			}
+			delete(known, e.ID)
+		}
+	}
+	for _, old := range s.Episodes {
+		if _, gone := known[old.ID]; gone && old.LocalPath != "" {
+			episodes = append(episodes, old)
+		}
+	}
+	s.Podcast = podcast
+	s.Episodes = episodes
+}
+
+// findLocked returns the subscription to feedURL (must be called with lock
+// held)
+func (m *Manager) findLocked(feedURL string) *subscription {
+	for _, sub := range m.subscriptions {
+		if sub.Podcast.FeedURL == feedURL {
+			return sub
+		}
+	}
+	return nil
+}
+
+// episodeLocked returns an episode of a subscribed feed (must be called with
+// lock held)
+func (m *Manager) episodeLocked(feedURL, episodeID string) (*Episode, error) {
+	sub := m.findLocked(feedURL)
+	if sub == nil {
+		return nil, ErrUnknownPodcast
+	}
+	for _, e := range sub.Episodes {
+		if e.ID == episodeID {
+			return e, nil
+		}
+	}
+	return nil, ErrUnknownEpisode
+}
+
+// byPathLocked returns the episode played from path, by its audio URL or
+// downloaded copy (must be called with lock held)
+func (m *Manager) byPathLocked(path string) *Episode {
+	if path == "" {
+		return nil
+	}
+	for _, sub := range m.subscriptions {
+		for _, e := range sub.Episodes {
+			if e.AudioURL == path || e.LocalPath == path {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// scheduleSaveLocked arranges for the subscriptions to be written shortly
+// (must be called with lock held)
+func (m *Manager) scheduleSaveLocked() {
+	if m.saveTimer != nil {
+		return
+	}
+	m.saveTimer = time.AfterFunc(saveDelay, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.saveTimer = nil
+		m.saveLocked()
+	})
+}
+
+// saveLocked writes the subscriptions, logging failures (must be called with
+// lock held)
+func (m *Manager) saveLocked() {
+	if err := m.writeLocked(); err != nil {
+		log.Printf("[PODCAST] Warning: failed to save podcasts: %v", err)
+	}
+}
+
+// writeLocked writes the subscriptions to disk (must be called with lock
+// held)
+func (m *Manager) writeLocked() error {
+	data, err := json.MarshalIndent(m.subscriptions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal podcasts: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create podcasts directory: %w", err)
+	}
+
+	if err := atomicfile.Write(m.filePath, data); err != nil {
+		return fmt.Errorf("failed to write podcasts file: %w", err)
+	}
+	return nil
+}
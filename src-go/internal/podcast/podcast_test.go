@@ -0,0 +1,171 @@
+package podcast
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// feedServer serves a feed whose items can be changed between requests,
+// along with the episode audio
+type feedServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	items []string
+}
+
+func newFeedServer(t *testing.T) *feedServer {
+	fs := &feedServer{}
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".mp3") {
+			w.Write([]byte("audio of " + r.URL.Path))
+			return
+		}
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		fmt.Fprintf(w, `<rss><channel><title>Show</title>%s</channel></rss>`, strings.Join(fs.items, ""))
+	}))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+func (fs *feedServer) setEpisodes(ids ...string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.items = nil
+	for _, id := range ids {
+		fs.items = append(fs.items, fmt.Sprintf(
+			`<item><title>%s</title><guid>%s</guid><itunes:duration>3600</itunes:duration><enclosure url="%s/%s.mp3" type="audio/mpeg"/></item>`,
+			id, id, fs.URL, id))
+	}
+}
+
+func TestManagerRefreshKeepsEpisodeState(t *testing.T) {
+	fs := newFeedServer(t)
+	fs.setEpisodes("ep1")
+	feedURL := fs.URL + "/feed.xml"
+
+	m := NewManager(t.TempDir(), t.TempDir())
+	if _, err := m.Subscribe(context.Background(), feedURL); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := m.MarkPlayed(feedURL, "ep1", true); err != nil {
+		t.Fatalf("MarkPlayed failed: %v", err)
+	}
+
+	fs.setEpisodes("ep2", "ep1")
+	m.Refresh(context.Background())
+
+	episodes, err := m.Episodes(feedURL)
+	if err != nil {
+		t.Fatalf("Episodes failed: %v", err)
+	}
+	if len(episodes) != 2 {
+		t.Fatalf("Expected 2 episodes after refresh, got %d", len(episodes))
+	}
+	for _, e := range episodes {
+		if played := e.ID == "ep1"; e.Played != played {
+			t.Errorf("Episode %s: expected played=%v", e.ID, played)
+		}
+	}
+
+	if err := m.MarkPlayed(feedURL, "missing", true); err != ErrUnknownEpisode {
+		t.Errorf("Expected ErrUnknownEpisode, got %v", err)
+	}
+}
+
+func TestManagerPositions(t *testing.T) {
+	fs := newFeedServer(t)
+	fs.setEpisodes("ep1")
+	feedURL := fs.URL + "/feed.xml"
+	audioURL := fs.URL + "/ep1.mp3"
+
+	configDir := t.TempDir()
+	m := NewManager(configDir, t.TempDir())
+	if _, err := m.Subscribe(context.Background(), feedURL); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	if _, ok := m.Position("/music/song.mp3"); ok {
+		t.Error("Expected a track that isn't an episode to be ignored")
+	}
+	if !m.SetPosition(audioURL, 10*60_000, 60*60_000) {
+		t.Fatal("Expected SetPosition to recognise the episode")
+	}
+	if pos, _ := m.Position(audioURL); pos != 10*60_000 {
+		t.Errorf("Expected position %d, got %d", 10*60_000, pos)
+	}
+
+	// Positions survive a restart
+	if err := m.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	loaded := NewManager(configDir, t.TempDir())
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if pos, _ := loaded.Position(audioURL); pos != 10*60_000 {
+		t.Errorf("Expected restored position %d, got %d", 10*60_000, pos)
+	}
+
+	// Reaching the end marks it played and starts it over next time
+	loaded.SetPosition(audioURL, 60*60_000-5000, 60*60_000)
+	episodes, _ := loaded.Episodes(feedURL)
+	if !episodes[0].Played {
+		t.Error("Expected episode to be marked played")
+	}
+	if pos, ok := loaded.Position(audioURL); !ok || pos != 0 {
+		t.Errorf("Expected a played episode to start over, got %d", pos)
+	}
+}
+
+func TestManagerDownload(t *testing.T) {
+	fs := newFeedServer(t)
+	fs.setEpisodes("ep1")
+	feedURL := fs.URL + "/feed.xml"
+
+	m := NewManager(t.TempDir(), t.TempDir())
+	if _, err := m.Subscribe(context.Background(), feedURL); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	path, err := m.Download(context.Background(), feedURL, "ep1")
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "audio of /ep1.mp3" {
+		t.Fatalf("Unexpected download %q: %v", data, err)
+	}
+	if !strings.HasSuffix(path, ".mp3") {
+		t.Errorf("Expected download to keep its extension, got %s", path)
+	}
+
+	// The downloaded copy plays from now on, and its position is tracked
+	episodes, _ := m.Episodes(feedURL)
+	if episodes[0].Path() != path {
+		t.Errorf("Expected episode to play from %s, got %s", path, episodes[0].Path())
+	}
+	if !m.SetPosition(path, 60_000, 60*60_000) {
+		t.Error("Expected the downloaded copy to be recognised")
+	}
+
+	// A downloaded episode the feed drops is kept until unsubscribing
+	fs.setEpisodes("ep2")
+	m.Refresh(context.Background())
+	if episodes, _ := m.Episodes(feedURL); len(episodes) != 2 {
+		t.Errorf("Expected the downloaded episode to be kept, got %d episodes", len(episodes))
+	}
+
+	if err := m.Unsubscribe(feedURL); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected download to be deleted on unsubscribe, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+// MaxBookmarkNoteLength caps the note saved with a bookmark
+const MaxBookmarkNoteLength = 1000
+
+// Bookmark marks a moment in a track
+type Bookmark struct {
+	ID         int64  `json:"id"`
+	PositionMs int64  `json:"positionMs"`
+	Note       string `json:"note,omitempty"`
+	Created    int64  `json:"created"` // Unix ms
+}
+
+// bookmarksFile is the on-disk form of the bookmarks
+type bookmarksFile struct {
+	NextID int64                 `json:"nextId"`
+	Tracks map[string][]Bookmark `json:"tracks"`
+}
+
+// BookmarkStore keeps bookmarks for each track, ordered by position
+type BookmarkStore struct {
+	mu        sync.Mutex
+	filePath  string
+	nextID    int64
+	bookmarks map[string][]Bookmark
+}
+
+// NewBookmarkStore creates a new bookmark store
+func NewBookmarkStore(configDir string) *BookmarkStore {
+	return &BookmarkStore{
+		filePath:  filepath.Join(configDir, "bookmarks.json"),
+		nextID:    1,
+		bookmarks: make(map[string][]Bookmark),
+	}
+}
+
+// Load loads saved bookmarks from disk
+func (s *BookmarkStore) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read bookmarks file: %w", err)
+	}
+
+	var file bookmarksFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse bookmarks file: %w", err)
+	}
+
+	s.bookmarks = make(map[string][]Bookmark, len(file.Tracks))
+	s.nextID = max(file.NextID, 1)
+	for path, marks := range file.Tracks {
+		s.bookmarks[path] = marks
+		for _, b := range marks {
+			s.nextID = max(s.nextID, b.ID+1)
+		}
+	}
+	return nil
+}
+
+// Add bookmarks a position in a track and saves it
+func (s *BookmarkStore) Add(path string, positionMs int64, note string) (Bookmark, error) {
+	if path == "" {
+		return Bookmark{}, fmt.Errorf("path is required")
+	}
+	if positionMs < 0 {
+		return Bookmark{}, fmt.Errorf("position must not be negative")
+	}
+	if len(note) > MaxBookmarkNoteLength {
+		return Bookmark{}, fmt.Errorf("note must be at most %d bytes", MaxBookmarkNoteLength)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := Bookmark{
+		ID:         s.nextID,
+		PositionMs: positionMs,
+		Note:       note,
+		Created:    time.Now().UnixMilli(),
+	}
+	s.nextID++
+
+	marks := append(s.bookmarks[path], b)
+	sort.SliceStable(marks, func(i, j int) bool {
+		return marks[i].PositionMs < marks[j].PositionMs
+	})
+	s.bookmarks[path] = marks
+	return b, s.saveLocked()
+}
+
+// Merge adds the bookmarks in tracks that the store doesn't have yet, as
+// bookmarks from another machine, and saves the result. A bookmark is the
+// same one if it was made at the same time and position. Bookmarks are only
+// added, so one removed here comes back if another machine still has it.
+// Returns the number of bookmarks added.
+func (s *BookmarkStore) Merge(tracks map[string][]Bookmark) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := 0
+	for path, incoming := range tracks {
+		if path == "" {
+			continue
+		}
+		marks := s.bookmarks[path]
+		n := len(marks)
+		for _, b := range incoming {
+			if b.PositionMs < 0 || len(b.Note) > MaxBookmarkNoteLength || hasBookmark(marks, b) {
+				continue
+			}
+			b.ID = s.nextID
+			s.nextID++
+			marks = append(marks, b)
+		}
+		if len(marks) == n {
+			continue
+		}
+		sort.SliceStable(marks, func(i, j int) bool {
+			return marks[i].PositionMs < marks[j].PositionMs
+		})
+		s.bookmarks[path] = marks
+		added += len(marks) - n
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, s.saveLocked()
+}
+
+// hasBookmark reports whether marks holds b, made at the same time and
+// position
+func hasBookmark(marks []Bookmark, b Bookmark) bool {
+	for _, m := range marks {
+		if m.Created == b.Created && m.PositionMs == b.PositionMs {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns one of a track's bookmarks
+func (s *BookmarkStore) Get(path string, id int64) (Bookmark, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range s.bookmarks[path] {
+		if b.ID == id {
+			return b, true
+		}
+	}
+	return Bookmark{}, false
+}
+
+// List returns a track's bookmarks, ordered by position
+func (s *BookmarkStore) List(path string) []Bookmark {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Bookmark{}, s.bookmarks[path]...)
+}
+
+// All returns the bookmarks of every track that has some
+func (s *BookmarkStore) All() map[string][]Bookmark {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := make(map[string][]Bookmark, len(s.bookmarks))
+	for path, marks := range s.bookmarks {
+		all[path] = append([]Bookmark{}, marks...)
+	}
+	return all
+}
+
+// Remove deletes a bookmark and saves the change. Returns false if the track
+// has no such bookmark.
+func (s *BookmarkStore) Remove(path string, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	marks := s.bookmarks[path]
+	for i, b := range marks {
+		if b.ID != id {
+			continue
+		}
+		marks = append(marks[:i:i], marks[i+1:]...)
+		if len(marks) == 0 {
+			delete(s.bookmarks, path)
+		} else {
+			s.bookmarks[path] = marks
+		}
+		return true, s.saveLocked()
+	}
+	return false, nil
+}
+
+// saveLocked writes the bookmarks to disk (must be called with lock held)
+func (s *BookmarkStore) saveLocked() error {
+	data, err := json.MarshalIndent(bookmarksFile{NextID: s.nextID, Tracks: s.bookmarks}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bookmarks: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create bookmarks directory: %w", err)
+	}
+
+	if err := atomicfile.Write(s.filePath, data); err != nil {
+		return fmt.Errorf("failed to write bookmarks file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package queue
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBookmarkStoreAddListRemove(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "queue_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store := NewBookmarkStore(tmpDir)
+	late, err := store.Add("/mixes/set.mp3", 45*60_000, "the drop")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	early, err := store.Add("/mixes/set.mp3", 5*60_000, "")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if late.ID == early.ID {
+		t.Errorf("Expected distinct bookmark IDs, got %d twice", late.ID)
+	}
+
+	// Listed in track order, not the order they were added
+	marks := store.List("/mixes/set.mp3")
+	if len(marks) != 2 || marks[0].ID != early.ID || marks[1].Note != "the drop" {
+		t.Fatalf("Unexpected bookmarks: %+v", marks)
+	}
+
+	if _, err := store.Add("/mixes/set.mp3", -1, ""); err == nil {
+		t.Error("Expected a negative position to be rejected")
+	}
+
+	if removed, err := store.Remove("/mixes/set.mp3", early.ID); err != nil || !removed {
+		t.Fatalf("Remove failed: %v, %v", removed, err)
+	}
+	if removed, _ := store.Remove("/mixes/set.mp3", early.ID); removed {
+		t.Error("Expected removing a bookmark twice to report false")
+	}
+
+	// Bookmarks and the ID sequence survive a restart
+	loaded := NewBookmarkStore(tmpDir)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if b, ok := loaded.Get("/mixes/set.mp3", late.ID); !ok || b.PositionMs != 45*60_000 {
+		t.Errorf("Expected restored bookmark, got %+v, %v", b, ok)
+	}
+	next, _ := loaded.Add("/lectures/one.m4a", 1000, "")
+	if next.ID <= early.ID {
+		t.Errorf("Expected IDs not to be reused, got %d after %d", next.ID, early.ID)
+	}
+}
+
+func TestBookmarkStoreRelocatePaths(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "queue_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store := NewBookmarkStore(tmpDir)
+	b, _ := store.Add("/old/lecture.mp3", 90_000, "key point")
+
+	moved := store.RelocatePaths(func(path string) (string, bool) {
+		if path == "/old/lecture.mp3" {
+			return "/new/lecture.mp3", true
+		}
+		return "", false
+	})
+	if moved != 1 {
+		t.Errorf("Expected 1 moved track, got %d", moved)
+	}
+	if _, ok := store.Get("/new/lecture.mp3", b.ID); !ok {
+		t.Error("Expected bookmark to follow the moved track")
+	}
+	if len(store.List("/old/lecture.mp3")) != 0 {
+		t.Error("Expected no bookmarks left at the old path")
+	}
+}
+
+func TestBookmarkStoreMerge(t *testing.T) {
+	store := NewBookmarkStore(t.TempDir())
+	local, err := store.Add("/mixes/set.mp3", 60_000, "local")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	added, err := store.Merge(map[string][]Bookmark{
+		"/mixes/set.mp3": {
+			{ID: 9, PositionMs: local.PositionMs, Note: "same one", Created: local.Created},
+			{ID: local.ID, PositionMs: 30_000, Note: "remote", Created: 1},
+		},
+		"/mixes/other.mp3": {{ID: 1, PositionMs: 1000, Created: 2}},
+	})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if added != 2 {
+		t.Errorf("Expected 2 bookmarks added, got %d", added)
+	}
+
+	// Merged bookmarks get IDs of their own and keep position order
+	marks := store.List("/mixes/set.mp3")
+	if len(marks) != 2 || marks[0].Note != "remote" || marks[1].ID != local.ID {
+		t.Fatalf("Unexpected bookmarks: %+v", marks)
+	}
+	if marks[0].ID == local.ID {
+		t.Errorf("Expected a merged bookmark to get a new ID, got %d", marks[0].ID)
+	}
+
+	// Merging again adds nothing
+	if added, _ := store.Merge(map[string][]Bookmark{"/mixes/set.mp3": marks}); added != 0 {
+		t.Errorf("Expected nothing added by a second merge, got %d", added)
+	}
+}
@@ -0,0 +1,251 @@
+package queue
+
+// RemoveRange removes items in the half-open range [start, end) (actual item
+// indices, not shuffle positions). Returns the number of items removed.
+func (m *Manager) RemoveRange(start, end int) int {
+	m.mu.Lock()
+
+	if start < 0 {
+		start = 0
+	}
+	if end > len(m.items) {
+		end = len(m.items)
+	}
+	if start >= end {
+		m.mu.Unlock()
+		return 0
+	}
+
+	remove := make([]bool, len(m.items))
+	for i := start; i < end; i++ {
+		remove[i] = true
+	}
+	m.recordHistory()
+	removed := m.removeMarked(remove)
+
+	m.mu.Unlock()
+	m.notifyChange()
+	return removed
+}
+
+// RemoveByPaths removes every item whose path is in paths.
+// Returns the number of items removed.
+func (m *Manager) RemoveByPaths(paths []string) int {
+	m.mu.Lock()
+
+	wanted := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		wanted[p] = true
+	}
+
+	remove := make([]bool, len(m.items))
+	count := 0
+	for i, item := range m.items {
+		if wanted[item.Path] {
+			remove[i] = true
+			count++
+		}
+	}
+	if count == 0 {
+		m.mu.Unlock()
+		return 0
+	}
+
+	m.recordHistory()
+	removed := m.removeMarked(remove)
+
+	m.mu.Unlock()
+	m.notifyChange()
+	return removed
+}
+
+// Deduplicate removes repeated paths from the queue, keeping the first
+// occurrence of each. If the current track is a duplicate, the current entry
+// is kept instead so playback position is not disturbed.
+// Returns the number of items removed.
+func (m *Manager) Deduplicate() int {
+	m.mu.Lock()
+
+	currentIdx := -1
+	currentPath := ""
+	if m.index >= 0 {
+		currentIdx = m.getItemIndex(m.index)
+		if currentIdx >= 0 && currentIdx < len(m.items) {
+			currentPath = m.items[currentIdx].Path
+		}
+	}
+
+	seen := make(map[string]bool, len(m.items))
+	remove := make([]bool, len(m.items))
+	count := 0
+	for i, item := range m.items {
+		if currentPath != "" && item.Path == currentPath {
+			if i != currentIdx {
+				remove[i] = true
+				count++
+			}
+			continue
+		}
+		if seen[item.Path] {
+			remove[i] = true
+			count++
+			continue
+		}
+		seen[item.Path] = true
+	}
+	if count == 0 {
+		m.mu.Unlock()
+		return 0
+	}
+
+	m.recordHistory()
+	removed := m.removeMarked(remove)
+
+	m.mu.Unlock()
+	m.notifyChange()
+	return removed
+}
+
+// ShuffleRemaining randomizes the order of the tracks after the current one,
+// leaving already-played tracks and the current track in place.
+func (m *Manager) ShuffleRemaining() {
+	m.mu.Lock()
+
+	start := m.index + 1
+	if start < 0 {
+		start = 0
+	}
+	if m.getMaxIndex()-start < 2 {
+		m.mu.Unlock()
+		return
+	}
+
+	m.recordHistory()
+
+	if m.shuffle && len(m.shuffleOrder) > 0 {
+		rest := m.shuffleOrder[start:]
+		m.rng.Shuffle(len(rest), func(i, j int) {
+			rest[i], rest[j] = rest[j], rest[i]
+		})
+	} else {
+		rest := m.items[start:]
+		m.rng.Shuffle(len(rest), func(i, j int) {
+			rest[i], rest[j] = rest[j], rest[i]
+		})
+	}
+
+	m.mu.Unlock()
+	m.notifyChange()
+}
+
+// TransitionDistance scores how jarring it is to go from one track to
+// another, lower is smoother
+type TransitionDistance func(from, to string) float64
+
+// SmartOrder reorders the tracks after the current one so each is followed by
+// the closest remaining track, starting from the current track (or the first
+// one if nothing is playing). Already-played tracks and the current track stay
+// in place. Returns false if there was nothing to reorder.
+func (m *Manager) SmartOrder(distance TransitionDistance) bool {
+	m.mu.Lock()
+
+	anchor := max(m.index, 0)
+	start := anchor + 1
+	if m.getMaxIndex()-start < 2 {
+		m.mu.Unlock()
+		return false
+	}
+
+	m.recordHistory()
+
+	// Work on item indices in play order so shuffled queues are reordered
+	// through shuffleOrder without touching items
+	var order []int
+	if m.shuffle && len(m.shuffleOrder) > 0 {
+		order = m.shuffleOrder
+	} else {
+		order = make([]int, len(m.items))
+		for i := range order {
+			order[i] = i
+		}
+	}
+
+	// Greedy nearest neighbour: ties keep the existing order
+	remaining := append([]int(nil), order[start:]...)
+	prev := m.items[order[anchor]].Path
+	for pos := start; pos < len(order); pos++ {
+		best := 0
+		bestDist := distance(prev, m.items[remaining[0]].Path)
+		for i := 1; i < len(remaining); i++ {
+			if d := distance(prev, m.items[remaining[i]].Path); d < bestDist {
+				best, bestDist = i, d
+			}
+		}
+		order[pos] = remaining[best]
+		prev = m.items[remaining[best]].Path
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+
+	if !m.shuffle || len(m.shuffleOrder) == 0 {
+		items := make([]QueueItem, len(m.items))
+		for i, idx := range order {
+			items[i] = m.items[idx]
+		}
+		m.items = items
+	}
+
+	m.mu.Unlock()
+	m.notifyChange()
+	return true
+}
+
+// removeMarked removes all items flagged in remove and fixes up the shuffle
+// order and current index (must be called with lock held).
+// Returns the number of items removed.
+func (m *Manager) removeMarked(remove []bool) int {
+	newIndex := make([]int, len(m.items))
+	items := make([]QueueItem, 0, len(m.items))
+	for i, item := range m.items {
+		if remove[i] {
+			newIndex[i] = -1
+			continue
+		}
+		newIndex[i] = len(items)
+		items = append(items, item)
+	}
+	removed := len(m.items) - len(items)
+
+	if m.shuffle && len(m.shuffleOrder) > 0 {
+		order := make([]int, 0, len(items))
+		pos := m.index
+		for i, idx := range m.shuffleOrder {
+			if newIndex[idx] < 0 {
+				// Removed entries before the current position shift it back
+				if i < m.index {
+					pos--
+				}
+				continue
+			}
+			order = append(order, newIndex[idx])
+		}
+		m.shuffleOrder = order
+		m.index = pos
+	} else if m.index >= 0 {
+		// Count surviving items before the current one; if the current item
+		// was removed this lands on the track that followed it
+		pos := 0
+		for i := 0; i < m.index && i < len(remove); i++ {
+			if !remove[i] {
+				pos++
+			}
+		}
+		m.index = pos
+	}
+
+	m.items = items
+	if m.index >= len(m.items) {
+		m.index = len(m.items) - 1
+	}
+
+	return removed
+}
@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"math"
+	"sort"
+)
+
+// What counts as stuck in a rut
+const (
+	rutMinPlays    = 20  // Fewer plays than this are too few to judge
+	rutArtists     = 4   // Listening spread no wider than this many artists
+	rutRepeatShare = 0.6 // Or this share of plays going to tracks already played
+)
+
+// topArtists is how many of the most played artists DiscoveryStats lists
+const topArtists = 5
+
+// ArtistPlays is how often an artist was played
+type ArtistPlays struct {
+	Artist string
+	Plays  int
+}
+
+// DiscoveryStats describe how widely listening ranges over the library
+type DiscoveryStats struct {
+	Plays    int     // Plays of library tracks
+	Tracks   int     // Different tracks played
+	Coverage float64 // Share of the library played, 0 - 1
+	Artists  int     // Different artists played
+
+	// ArtistEntropy is the Shannon entropy of plays across artists, in
+	// bits. EffectiveArtists is 2 to its power: how many artists played
+	// equally often would spread listening as widely.
+	ArtistEntropy    float64
+	EffectiveArtists float64
+
+	// RepeatShare is the share of plays going to a track already played
+	RepeatShare float64
+
+	// InRut is set when there are enough plays to judge and they keep to
+	// a few artists or the same tracks
+	InRut bool
+
+	TopArtists []ArtistPlays // Most played first
+}
+
+// Discovery computes DiscoveryStats for plays. artist returns a track's
+// artist, and false if it isn't in the library; plays of those are left
+// out. Tracks without an artist count towards coverage but not diversity.
+func Discovery(plays []PlayEvent, artist func(path string) (string, bool), librarySize int) DiscoveryStats {
+	var stats DiscoveryStats
+	tracks := make(map[string]bool)
+	byArtist := make(map[string]int)
+	artistPlays := 0
+	for _, play := range plays {
+		name, ok := artist(play.Path)
+		if !ok {
+			continue
+		}
+		stats.Plays++
+		tracks[play.Path] = true
+		if name != "" {
+			byArtist[name]++
+			artistPlays++
+		}
+	}
+	if stats.Plays == 0 {
+		return stats
+	}
+
+	stats.Tracks = len(tracks)
+	stats.Artists = len(byArtist)
+	if librarySize > 0 {
+		stats.Coverage = min(float64(stats.Tracks)/float64(librarySize), 1)
+	}
+	stats.RepeatShare = 1 - float64(stats.Tracks)/float64(stats.Plays)
+
+	for name, n := range byArtist {
+		p := float64(n) / float64(artistPlays)
+		stats.ArtistEntropy -= p * math.Log2(p)
+		stats.TopArtists = append(stats.TopArtists, ArtistPlays{Artist: name, Plays: n})
+	}
+	if artistPlays > 0 {
+		stats.EffectiveArtists = math.Exp2(stats.ArtistEntropy)
+	}
+	sort.Slice(stats.TopArtists, func(i, j int) bool {
+		a, b := stats.TopArtists[i], stats.TopArtists[j]
+		if a.Plays != b.Plays {
+			return a.Plays > b.Plays
+		}
+		return a.Artist < b.Artist
+	})
+	if len(stats.TopArtists) > topArtists {
+		stats.TopArtists = stats.TopArtists[:topArtists]
+	}
+
+	stats.InRut = stats.Plays >= rutMinPlays &&
+		((artistPlays > 0 && stats.EffectiveArtists <= rutArtists) || stats.RepeatShare >= rutRepeatShare)
+	return stats
+}
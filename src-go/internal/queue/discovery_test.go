@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestDiscovery(t *testing.T) {
+	artists := map[string]string{}
+	for i := 0; i < 40; i++ {
+		artists[fmt.Sprintf("/t/%d.mp3", i)] = fmt.Sprintf("Artist %d", i%8)
+	}
+	artist := func(path string) (string, bool) {
+		name, ok := artists[path]
+		return name, ok
+	}
+
+	// Every track once, across eight artists equally, plus one that left
+	// the library
+	var plays []PlayEvent
+	for i := 0; i < 20; i++ {
+		plays = append(plays, PlayEvent{Path: fmt.Sprintf("/t/%d.mp3", i)})
+	}
+	plays = append(plays, PlayEvent{Path: "/gone.mp3"})
+	stats := Discovery(plays, artist, len(artists))
+	if stats.Plays != 20 || stats.Tracks != 20 || stats.Coverage != 0.5 {
+		t.Errorf("Expected 20 plays of 20 tracks covering half the library, got %+v", stats)
+	}
+	if stats.Artists != 8 || math.Abs(stats.ArtistEntropy-3) > 0.1 || stats.InRut {
+		t.Errorf("Expected about 3 bits across 8 artists and no rut, got %+v", stats)
+	}
+
+	// The same two tracks over and over
+	plays = nil
+	for i := 0; i < 30; i++ {
+		plays = append(plays, PlayEvent{Path: fmt.Sprintf("/t/%d.mp3", i%2)})
+	}
+	stats = Discovery(plays, artist, len(artists))
+	if !stats.InRut || stats.Artists != 2 || stats.TopArtists[0].Plays != 15 {
+		t.Errorf("Expected a rut between two artists, got %+v", stats)
+	}
+
+	if stats := Discovery(nil, artist, len(artists)); stats.Plays != 0 || stats.InRut {
+		t.Errorf("Expected empty stats without plays, got %+v", stats)
+	}
+}
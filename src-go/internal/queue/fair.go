@@ -0,0 +1,56 @@
+package queue
+
+// SetFairQueue turns fair queuing on or off. While it is on, appended tracks
+// are interleaved round-robin with the other upcoming tracks by the client
+// that added them, so one client can't take over the queue with a whole
+// album. It has no effect while shuffle is on.
+func (m *Manager) SetFairQueue(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fair = enabled
+}
+
+// fairOrderLocked interleaves the tracks after the current one by
+// QueueItem.AddedBy, keeping each client's tracks in the order they were
+// added. Clients take turns in the order their first upcoming track appears,
+// except that the client whose track is playing goes last.
+func (m *Manager) fairOrderLocked() {
+	start := m.index + 1
+	if start < 0 {
+		start = 0
+	}
+	if len(m.items)-start < 2 {
+		return
+	}
+
+	var order []string
+	byClient := make(map[string][]QueueItem)
+	for _, item := range m.items[start:] {
+		if _, ok := byClient[item.AddedBy]; !ok {
+			order = append(order, item.AddedBy)
+		}
+		byClient[item.AddedBy] = append(byClient[item.AddedBy], item)
+	}
+	if len(order) < 2 {
+		return
+	}
+	if m.index >= 0 && m.index < len(m.items) {
+		playing := m.items[m.index].AddedBy
+		for i, client := range order {
+			if client == playing {
+				order = append(append(order[:i:i], order[i+1:]...), client)
+				break
+			}
+		}
+	}
+
+	pending := m.items[start:start:len(m.items)]
+	for len(pending) < len(m.items)-start {
+		for _, client := range order {
+			if tracks := byClient[client]; len(tracks) > 0 {
+				pending = append(pending, tracks[0])
+				byClient[client] = tracks[1:]
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"reflect"
+	"testing"
+)
+
+func queued(by string, paths ...string) []QueueItem {
+	items := make([]QueueItem, len(paths))
+	for i, path := range paths {
+		items[i] = QueueItem{Path: path, AddedBy: by}
+	}
+	return items
+}
+
+func TestFairQueueInterleavesClients(t *testing.T) {
+	m := NewManager()
+	m.SetFairQueue(true)
+	m.AppendWithMetadata(queued("alice", "/a1.mp3"))
+	m.SetIndex(0)
+
+	// Alice's track is playing, so Bob's album doesn't wait behind her next one
+	m.AppendWithMetadata(queued("alice", "/a2.mp3", "/a3.mp3"))
+	m.AppendWithMetadata(queued("bob", "/b1.mp3", "/b2.mp3", "/b3.mp3", "/b4.mp3"))
+	m.AppendWithMetadata(queued("carol", "/c1.mp3"))
+
+	var paths []string
+	for _, item := range m.GetItems() {
+		paths = append(paths, item.Path)
+	}
+	want := []string{"/a1.mp3", "/b1.mp3", "/c1.mp3", "/a2.mp3", "/b2.mp3", "/a3.mp3", "/b3.mp3", "/b4.mp3"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Expected %v, got %v", want, paths)
+	}
+	if idx, _ := m.Position(); idx != 0 {
+		t.Errorf("Expected the current track to stay at 0, got %d", idx)
+	}
+}
+
+func TestFairQueueOff(t *testing.T) {
+	m := NewManager()
+	m.AppendWithMetadata(queued("alice", "/a1.mp3", "/a2.mp3"))
+	m.AppendWithMetadata(queued("bob", "/b1.mp3"))
+
+	if items := m.GetItems(); items[2].Path != "/b1.mp3" {
+		t.Errorf("Expected tracks in the order they were added, got %+v", items)
+	}
+}
@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Album and artist shuffle move whole groups of tracks around but keep each
+// group in queue order, so albums still play start to finish.
+
+// isGrouped reports whether a shuffle mode shuffles groups rather than tracks
+func (mode ShuffleMode) isGrouped() bool {
+	return mode == ShuffleAlbum || mode == ShuffleArtist
+}
+
+// groupKey returns the group a track belongs to for the current shuffle
+// mode. Tracks without tags fall back to their folder, which for most
+// libraries is the album. (must be called with lock held)
+func (m *Manager) groupKey(itemIdx int) string {
+	item := m.items[itemIdx]
+	dir := filepath.Dir(item.Path)
+	if item.Metadata == nil {
+		return dir
+	}
+	switch m.shuffleKind {
+	case ShuffleArtist:
+		if item.Metadata.Artist != "" {
+			return strings.ToLower(item.Metadata.Artist)
+		}
+	case ShuffleAlbum:
+		// Same-named albums by different artists live in different folders
+		if item.Metadata.Album != "" {
+			return strings.ToLower(item.Metadata.Album) + "\x00" + dir
+		}
+	}
+	return dir
+}
+
+// groupIndices splits item indices into groups, in order of each group's
+// first track and keeping queue order within a group (must be called with
+// lock held)
+func (m *Manager) groupIndices(indices []int) [][]int {
+	var groups [][]int
+	byKey := make(map[string]int)
+	for _, idx := range indices {
+		key := m.groupKey(idx)
+		g, ok := byKey[key]
+		if !ok {
+			g = len(groups)
+			byKey[key] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], idx)
+	}
+	return groups
+}
+
+// groupedShuffleOrder shuffles whole groups, each played in queue order
+// (must be called with lock held)
+func (m *Manager) groupedShuffleOrder() {
+	groups := m.groupIndices(m.shuffleOrder)
+	m.rng.Shuffle(len(groups), func(i, j int) {
+		groups[i], groups[j] = groups[j], groups[i]
+	})
+
+	m.shuffleOrder = m.shuffleOrder[:0]
+	for _, group := range groups {
+		m.shuffleOrder = append(m.shuffleOrder, group...)
+	}
+}
+
+// startGroupedShuffleAt moves the group holding itemIdx to the front of the
+// shuffle order and points index at the track, so the rest of its group
+// plays next (must be called with lock held)
+func (m *Manager) startGroupedShuffleAt(itemIdx int) {
+	key := m.groupKey(itemIdx)
+	order := make([]int, 0, len(m.shuffleOrder))
+	for _, idx := range m.shuffleOrder {
+		if m.groupKey(idx) == key {
+			order = append(order, idx)
+		}
+	}
+	for _, idx := range m.shuffleOrder {
+		if m.groupKey(idx) != key {
+			order = append(order, idx)
+		}
+	}
+	m.shuffleOrder = order
+
+	for pos, idx := range m.shuffleOrder {
+		if idx == itemIdx {
+			m.index = pos
+			return
+		}
+	}
+}
+
+// insertGroupsIntoShuffleOrder adds new item indices to the shuffle order
+// without splitting groups. Tracks join their group if it hasn't finished
+// playing; otherwise they form a new group between two upcoming ones. (must
+// be called with lock held)
+func (m *Manager) insertGroupsIntoShuffleOrder(indices []int) {
+	for _, group := range m.groupIndices(indices) {
+		key := m.groupKey(group[0])
+
+		insertPos := -1
+		for pos := len(m.shuffleOrder) - 1; pos > m.index; pos-- {
+			if m.groupKey(m.shuffleOrder[pos]) == key {
+				insertPos = pos + 1
+				break
+			}
+		}
+		if insertPos < 0 {
+			var boundaries []int
+			for pos := m.index + 1; pos <= len(m.shuffleOrder); pos++ {
+				if pos == 0 || pos == len(m.shuffleOrder) ||
+					m.groupKey(m.shuffleOrder[pos]) != m.groupKey(m.shuffleOrder[pos-1]) {
+					boundaries = append(boundaries, pos)
+				}
+			}
+			insertPos = boundaries[m.rng.Intn(len(boundaries))]
+		}
+
+		m.shuffleOrder = append(m.shuffleOrder[:insertPos], append(group, m.shuffleOrder[insertPos:]...)...)
+	}
+}
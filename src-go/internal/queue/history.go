@@ -0,0 +1,117 @@
+package queue
+
+// DefaultMaxHistory is the default number of undoable queue mutations kept
+const DefaultMaxHistory = 50
+
+// snapshot captures the queue state needed to undo a mutation
+type snapshot struct {
+	items        []QueueItem
+	index        int
+	shuffle      bool
+	shuffleOrder []int
+}
+
+// takeSnapshot copies the current queue state (must be called with lock held)
+func (m *Manager) takeSnapshot() snapshot {
+	s := snapshot{
+		items:   make([]QueueItem, len(m.items)),
+		index:   m.index,
+		shuffle: m.shuffle,
+	}
+	copy(s.items, m.items)
+	if m.shuffleOrder != nil {
+		s.shuffleOrder = make([]int, len(m.shuffleOrder))
+		copy(s.shuffleOrder, m.shuffleOrder)
+	}
+	return s
+}
+
+// restoreSnapshot replaces the queue state with a snapshot (must be called with lock held)
+func (m *Manager) restoreSnapshot(s snapshot) {
+	m.items = s.items
+	m.index = s.index
+	m.shuffle = s.shuffle
+	m.shuffleOrder = s.shuffleOrder
+	m.version++
+}
+
+// recordHistory pushes the current state onto the undo stack and clears the
+// redo stack. The mutation also moves the queue to a new version. (must be
+// called with lock held, before the mutation is applied)
+func (m *Manager) recordHistory() {
+	m.version++
+	if m.maxHistory <= 0 {
+		return
+	}
+	m.undoStack = append(m.undoStack, m.takeSnapshot())
+	if len(m.undoStack) > m.maxHistory {
+		m.undoStack = m.undoStack[len(m.undoStack)-m.maxHistory:]
+	}
+	m.redoStack = nil
+}
+
+// Undo reverts the most recent destructive queue mutation.
+// Returns false if there is nothing to undo.
+func (m *Manager) Undo() bool {
+	m.mu.Lock()
+
+	if len(m.undoStack) == 0 {
+		m.mu.Unlock()
+		return false
+	}
+
+	prev := m.undoStack[len(m.undoStack)-1]
+	m.undoStack = m.undoStack[:len(m.undoStack)-1]
+	m.redoStack = append(m.redoStack, m.takeSnapshot())
+	m.restoreSnapshot(prev)
+
+	m.mu.Unlock()
+	m.notifyChange()
+	return true
+}
+
+// Redo re-applies the most recently undone queue mutation.
+// Returns false if there is nothing to redo.
+func (m *Manager) Redo() bool {
+	m.mu.Lock()
+
+	if len(m.redoStack) == 0 {
+		m.mu.Unlock()
+		return false
+	}
+
+	next := m.redoStack[len(m.redoStack)-1]
+	m.redoStack = m.redoStack[:len(m.redoStack)-1]
+	m.undoStack = append(m.undoStack, m.takeSnapshot())
+	m.restoreSnapshot(next)
+
+	m.mu.Unlock()
+	m.notifyChange()
+	return true
+}
+
+// HistorySize returns the number of available undo and redo steps
+func (m *Manager) HistorySize() (undo int, redo int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.undoStack), len(m.redoStack)
+}
+
+// SetMaxHistory sets how many mutations can be undone (0 disables history)
+func (m *Manager) SetMaxHistory(max int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.maxHistory = max
+	if max <= 0 {
+		m.undoStack = nil
+		m.redoStack = nil
+		return
+	}
+	if len(m.undoStack) > max {
+		m.undoStack = m.undoStack[len(m.undoStack)-max:]
+	}
+	if len(m.redoStack) > max {
+		m.redoStack = m.redoStack[len(m.redoStack)-max:]
+	}
+}
@@ -0,0 +1,100 @@
+package queue
+
+// Queue items carry IDs so clients can address them without racing other
+// clients' edits, which shift indices. IDs are never reused while the
+// daemon runs, and survive undo and a restart.
+
+// assignIDs gives items fresh IDs (must be called with lock held)
+func (m *Manager) assignIDs(items []QueueItem) {
+	for i := range items {
+		m.nextID++
+		items[i].ID = m.nextID
+	}
+}
+
+// restoreIDs picks up the IDs of loaded items, giving fresh ones to items
+// saved before queue items had IDs (must be called with lock held)
+func (m *Manager) restoreIDs() {
+	for _, item := range m.items {
+		m.nextID = max(m.nextID, item.ID)
+	}
+	for i := range m.items {
+		if m.items[i].ID == 0 {
+			m.nextID++
+			m.items[i].ID = m.nextID
+		}
+	}
+}
+
+// indexOfID returns the item index of an ID, or -1 if nothing queued has it
+// (must be called with lock held)
+func (m *Manager) indexOfID(id uint64) int {
+	if id == 0 {
+		return -1
+	}
+	for i, item := range m.items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// IndexOfID returns the item index (not shuffle position) of the item with
+// the given ID
+func (m *Manager) IndexOfID(id uint64) (int, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx := m.indexOfID(id)
+	return idx, idx >= 0
+}
+
+// RemoveID removes the item with the given ID
+func (m *Manager) RemoveID(id uint64) bool {
+	m.mu.Lock()
+	ok := m.removeLocked(m.indexOfID(id))
+	m.mu.Unlock()
+
+	if ok {
+		m.notifyChange()
+	}
+	return ok
+}
+
+// MoveID moves the item with the given ID to where the item toID is now
+func (m *Manager) MoveID(id, toID uint64) bool {
+	m.mu.Lock()
+	ok, moved := m.moveLocked(m.indexOfID(id), m.indexOfID(toID))
+	m.mu.Unlock()
+
+	if moved {
+		m.notifyChange()
+	}
+	return ok
+}
+
+// JumpToID makes the item with the given ID the current one
+func (m *Manager) JumpToID(id uint64) bool {
+	m.mu.Lock()
+
+	idx := m.indexOfID(id)
+	if idx < 0 {
+		m.mu.Unlock()
+		return false
+	}
+	if m.shuffle && len(m.shuffleOrder) > 0 {
+		for pos, itemIdx := range m.shuffleOrder {
+			if itemIdx == idx {
+				m.index = pos
+				break
+			}
+		}
+	} else {
+		m.index = idx
+	}
+
+	m.mu.Unlock()
+	m.notifyChange()
+	return true
+}
@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"os"
+	"testing"
+)
+
+func TestItemIDsStableAcrossEdits(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/3.mp3"})
+	m.Append([]string{"/path/4.mp3"})
+
+	items := m.GetItems()
+	seen := make(map[uint64]bool)
+	for _, item := range items {
+		if item.ID == 0 || seen[item.ID] {
+			t.Fatalf("Expected unique non-zero IDs, got %+v", items)
+		}
+		seen[item.ID] = true
+	}
+	third := items[2].ID
+
+	// Another client removes the first track; the ID still finds the third
+	m.Remove(0)
+	if idx, ok := m.IndexOfID(third); !ok || idx != 1 {
+		t.Fatalf("Expected item %d at index 1, got %d, %v", third, idx, ok)
+	}
+	if !m.RemoveID(third) {
+		t.Fatal("RemoveID failed")
+	}
+	if m.RemoveID(third) {
+		t.Error("Expected removing an item twice to fail")
+	}
+	for _, item := range m.GetItems() {
+		if item.Path == "/path/3.mp3" {
+			t.Error("Expected /path/3.mp3 to be removed")
+		}
+	}
+
+	// Undo brings the item back under the same ID
+	m.Undo()
+	if _, ok := m.IndexOfID(third); !ok {
+		t.Error("Expected undo to restore the item's ID")
+	}
+
+	// New items never reuse an ID
+	m.Insert(0, "/path/5.mp3", nil)
+	if id := m.GetItems()[0].ID; seen[id] {
+		t.Errorf("Expected a fresh ID, got reused %d", id)
+	}
+}
+
+func TestMoveAndJumpByID(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/3.mp3", "/path/4.mp3"})
+	items := m.GetItems()
+
+	if !m.MoveID(items[3].ID, items[1].ID) {
+		t.Fatal("MoveID failed")
+	}
+	want := []string{"/path/1.mp3", "/path/4.mp3", "/path/2.mp3", "/path/3.mp3"}
+	for i, item := range m.GetItems() {
+		if item.Path != want[i] {
+			t.Fatalf("Expected order %v, got %+v", want, m.GetItems())
+		}
+	}
+	if m.MoveID(items[0].ID, 999) {
+		t.Error("Expected moving to an unknown item to fail")
+	}
+
+	// Jumping by ID lands on the item whether or not the queue is shuffled
+	m.SetShuffle(true)
+	if !m.JumpToID(items[2].ID) {
+		t.Fatal("JumpToID failed")
+	}
+	if path, _ := m.Current(); path != "/path/3.mp3" {
+		t.Errorf("Expected /path/3.mp3 after jump, got %s", path)
+	}
+}
+
+func TestStoreRestoresItemIDs(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "queue_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3"})
+	ids := []uint64{m.GetItems()[0].ID, m.GetItems()[1].ID}
+
+	// A queue saved before items had IDs
+	m.mu.Lock()
+	m.items = append(m.items, QueueItem{Path: "/path/3.mp3"})
+	m.mu.Unlock()
+
+	if err := NewStore(tmpDir, m).Save(); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	m2 := NewManager()
+	if err := NewStore(tmpDir, m2).Load(); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	items := m2.GetItems()
+	if items[0].ID != ids[0] || items[1].ID != ids[1] {
+		t.Errorf("Expected IDs %v to survive a restart, got %+v", ids, items)
+	}
+	if items[2].ID == 0 || items[2].ID == ids[0] || items[2].ID == ids[1] {
+		t.Errorf("Expected a fresh ID for the legacy item, got %d", items[2].ID)
+	}
+	m2.Append([]string{"/path/4.mp3"})
+	if id := m2.GetItems()[3].ID; id <= items[2].ID {
+		t.Errorf("Expected new IDs after the restored ones, got %d", id)
+	}
+}
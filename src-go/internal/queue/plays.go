@@ -0,0 +1,228 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+// PlayCount is how often a track has been played through and when it last was
+type PlayCount struct {
+	Count      int   `json:"count"`
+	LastPlayed int64 `json:"lastPlayed"` // Unix milliseconds
+}
+
+// PlayEvent is one play of a track
+type PlayEvent struct {
+	Path string `json:"path"`
+	At   int64  `json:"at"` // Unix milliseconds
+}
+
+// Limits on the play history; the oldest plays are dropped past either
+const (
+	playHistoryAge = 365 * 24 * time.Hour
+	maxPlayHistory = 20000
+)
+
+// PlayCountStore counts plays per track for smart shuffle, and keeps a
+// history of recent plays for listening stats
+type PlayCountStore struct {
+	mu          sync.Mutex
+	filePath    string
+	historyPath string
+	plays       map[string]PlayCount
+	history     []PlayEvent // Oldest first
+}
+
+// NewPlayCountStore creates a new play count store
+func NewPlayCountStore(configDir string) *PlayCountStore {
+	return &PlayCountStore{
+		filePath:    filepath.Join(configDir, "play_counts.json"),
+		historyPath: filepath.Join(configDir, "play_history.json"),
+		plays:       make(map[string]PlayCount),
+	}
+}
+
+// Load loads saved play counts from disk
+func (s *PlayCountStore) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read play counts file: %w", err)
+	}
+
+	plays := make(map[string]PlayCount)
+	if err := json.Unmarshal(data, &plays); err != nil {
+		return fmt.Errorf("failed to parse play counts file: %w", err)
+	}
+	s.plays = plays
+
+	// The history came later than the counts, so may not be there yet
+	data, err = os.ReadFile(s.historyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read play history file: %w", err)
+	}
+	var history []PlayEvent
+	if err := json.Unmarshal(data, &history); err != nil {
+		return fmt.Errorf("failed to parse play history file: %w", err)
+	}
+	s.history = history
+	return nil
+}
+
+// Get returns a track's play count, the zero value if it was never played
+func (s *PlayCountStore) Get(path string) PlayCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.plays[path]
+}
+
+// All returns the play counts of every track that has been played
+func (s *PlayCountStore) All() map[string]PlayCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := make(map[string]PlayCount, len(s.plays))
+	for path, play := range s.plays {
+		all[path] = play
+	}
+	return all
+}
+
+// History returns the plays since the given time, oldest first
+func (s *PlayCountStore) History(since time.Time) []PlayEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := since.UnixMilli()
+	i := sort.Search(len(s.history), func(i int) bool { return s.history[i].At >= cutoff })
+	return append([]PlayEvent(nil), s.history[i:]...)
+}
+
+// Merge takes each of plays last played more recently than the track's own
+// count and saves the result. Returns the number of counts taken.
+func (s *PlayCountStore) Merge(plays map[string]PlayCount) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merged := 0
+	for path, play := range plays {
+		if path == "" || play.Count < 0 {
+			continue
+		}
+		if play.LastPlayed > s.plays[path].LastPlayed {
+			s.plays[path] = play
+			merged++
+		}
+	}
+	if merged == 0 {
+		return 0, nil
+	}
+	return merged, s.saveLocked()
+}
+
+// Record counts a play of a track at the given time and saves it
+func (s *PlayCountStore) Record(path string, at time.Time) error {
+	if path == "" {
+		return fmt.Errorf("path is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	play := s.plays[path]
+	play.Count++
+	play.LastPlayed = at.UnixMilli()
+	s.plays[path] = play
+
+	// Plays are recorded as they happen, so the history stays in order
+	s.history = append(s.history, PlayEvent{Path: path, At: play.LastPlayed})
+	cutoff := at.Add(-playHistoryAge).UnixMilli()
+	drop := sort.Search(len(s.history), func(i int) bool { return s.history[i].At >= cutoff })
+	drop = max(drop, len(s.history)-maxPlayHistory)
+	if drop > 0 {
+		s.history = append([]PlayEvent(nil), s.history[drop:]...)
+	}
+
+	if err := s.saveLocked(); err != nil {
+		return err
+	}
+	return s.saveHistoryLocked()
+}
+
+// RelocatePaths moves play counts to the new track paths
+func (s *PlayCountStore) RelocatePaths(rename func(path string) (string, bool)) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	moved := 0
+	plays := make(map[string]PlayCount, len(s.plays))
+	for path, play := range s.plays {
+		if newPath, ok := rename(path); ok && newPath != path {
+			path = newPath
+			moved++
+		}
+		plays[path] = play
+	}
+	s.plays = plays
+	for i, event := range s.history {
+		if newPath, ok := rename(event.Path); ok {
+			s.history[i].Path = newPath
+		}
+	}
+
+	if moved > 0 {
+		if err := s.saveLocked(); err != nil {
+			log.Printf("[QUEUE] Failed to save relocated play counts: %v", err)
+		}
+		if err := s.saveHistoryLocked(); err != nil {
+			log.Printf("[QUEUE] Failed to save relocated play history: %v", err)
+		}
+	}
+	return moved
+}
+
+// saveLocked writes the play counts to disk (must be called with lock held)
+func (s *PlayCountStore) saveLocked() error {
+	data, err := json.MarshalIndent(s.plays, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal play counts: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	if err := atomicfile.Write(s.filePath, data); err != nil {
+		return fmt.Errorf("failed to write play counts file: %w", err)
+	}
+	return nil
+}
+
+// saveHistoryLocked writes the play history to disk (must be called with
+// lock held). It is written compactly as it can run to thousands of plays.
+func (s *PlayCountStore) saveHistoryLocked() error {
+	data, err := json.Marshal(s.history)
+	if err != nil {
+		return fmt.Errorf("failed to marshal play history: %w", err)
+	}
+	if err := atomicfile.Write(s.historyPath, data); err != nil {
+		return fmt.Errorf("failed to write play history file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlayCountStoreRecord(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "queue_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store := NewPlayCountStore(tmpDir)
+	if play := store.Get("/path/1.mp3"); play != (PlayCount{}) {
+		t.Errorf("Expected no plays for an unplayed track, got %+v", play)
+	}
+
+	first := time.UnixMilli(1_700_000_000_000)
+	store.Record("/path/1.mp3", first)
+	if err := store.Record("/path/1.mp3", first.Add(time.Hour)); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if err := store.Record("", first); err == nil {
+		t.Error("Expected an empty path to be rejected")
+	}
+
+	loaded := NewPlayCountStore(tmpDir)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := PlayCount{Count: 2, LastPlayed: first.Add(time.Hour).UnixMilli()}
+	if play := loaded.Get("/path/1.mp3"); play != want {
+		t.Errorf("Expected %+v, got %+v", want, play)
+	}
+
+	moved := loaded.RelocatePaths(func(path string) (string, bool) {
+		return "/moved/1.mp3", path == "/path/1.mp3"
+	})
+	if moved != 1 || loaded.Get("/moved/1.mp3") != want {
+		t.Errorf("Expected the play count to follow the moved track, moved %d", moved)
+	}
+}
+
+func TestPlayCountStoreHistory(t *testing.T) {
+	dir := t.TempDir()
+	store := NewPlayCountStore(dir)
+	start := time.UnixMilli(1_700_000_000_000)
+	store.Record("/path/old.mp3", start)
+	store.Record("/path/1.mp3", start.Add(playHistoryAge))
+	if err := store.Record("/path/2.mp3", start.Add(playHistoryAge+time.Hour)); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	loaded := NewPlayCountStore(dir)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	// The first play is more than a year older than the last, so dropped
+	want := []PlayEvent{
+		{Path: "/path/1.mp3", At: start.Add(playHistoryAge).UnixMilli()},
+		{Path: "/path/2.mp3", At: start.Add(playHistoryAge + time.Hour).UnixMilli()},
+	}
+	if got := loaded.History(time.Time{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	if got := loaded.History(start.Add(playHistoryAge + time.Minute)); len(got) != 1 || got[0].Path != "/path/2.mp3" {
+		t.Errorf("Expected only the last play, got %+v", got)
+	}
+	if loaded.Get("/path/old.mp3").Count != 1 {
+		t.Error("Expected the play count to outlive the history")
+	}
+}
+
+func TestPlayCountStoreMerge(t *testing.T) {
+	store := NewPlayCountStore(t.TempDir())
+	store.Record("/path/1.mp3", time.UnixMilli(2000))
+	store.Record("/path/2.mp3", time.UnixMilli(2000))
+
+	merged, err := store.Merge(map[string]PlayCount{
+		"/path/1.mp3": {Count: 7, LastPlayed: 1000},
+		"/path/2.mp3": {Count: 4, LastPlayed: 3000},
+		"/path/3.mp3": {Count: 2, LastPlayed: 500},
+	})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if merged != 2 {
+		t.Errorf("Expected 2 play counts merged, got %d", merged)
+	}
+
+	// The most recently played count wins
+	want := map[string]PlayCount{
+		"/path/1.mp3": {Count: 1, LastPlayed: 2000},
+		"/path/2.mp3": {Count: 4, LastPlayed: 3000},
+		"/path/3.mp3": {Count: 2, LastPlayed: 500},
+	}
+	for path, play := range want {
+		if got := store.Get(path); got != play {
+			t.Errorf("%s: expected %+v, got %+v", path, play, got)
+		}
+	}
+}
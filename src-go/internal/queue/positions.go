@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
+)
+
+const (
+	// maxStoredPositions caps how many tracks keep a resume position
+	maxStoredPositions = 500
+
+	// finishedMarginMs - positions this close to the end count as finished
+	finishedMarginMs = 30 * 1000
+
+	// minResumePositionMs - positions earlier than this are not worth resuming
+	minResumePositionMs = 10 * 1000
+
+	// positionFlushDelay debounces writes to positions.json
+	positionFlushDelay = 2 * time.Second
+)
+
+// SavedPosition is the last known playback position of a long track
+type SavedPosition struct {
+	Position  int64     `json:"position"` // milliseconds
+	Duration  int64     `json:"duration"` // milliseconds
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// PositionStore remembers playback positions for long tracks (audiobooks,
+// podcasts, DJ mixes) so playback can resume where it left off
+type PositionStore struct {
+	mu          sync.Mutex
+	filePath    string
+	thresholdMs int64
+	positions   map[string]*SavedPosition
+	flushTimer  *time.Timer
+}
+
+// NewPositionStore creates a new position store. Only tracks at least
+// threshold long have their position remembered.
+func NewPositionStore(configDir string, threshold time.Duration) *PositionStore {
+	return &PositionStore{
+		filePath:    filepath.Join(configDir, "positions.json"),
+		thresholdMs: threshold.Milliseconds(),
+		positions:   make(map[string]*SavedPosition),
+	}
+}
+
+// Load loads saved positions from disk
+func (s *PositionStore) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read positions file: %w", err)
+	}
+
+	positions := make(map[string]*SavedPosition)
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return fmt.Errorf("failed to parse positions file: %w", err)
+	}
+
+	s.positions = positions
+	return nil
+}
+
+// SetThreshold changes the minimum track length for position tracking
+func (s *PositionStore) SetThreshold(threshold time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.thresholdMs = threshold.Milliseconds()
+}
+
+// Get returns the saved position for a track in milliseconds, or 0 if none
+func (s *PositionStore) Get(path string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, ok := s.positions[path]
+	if !ok {
+		return 0
+	}
+	return saved.Position
+}
+
+// Set records the playback position of a track. Short tracks are ignored and
+// tracks that were played to (nearly) the end are forgotten.
+func (s *PositionStore) Set(path string, positionMs, durationMs int64) {
+	if path == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, existed := s.positions[path]
+
+	switch {
+	case durationMs < s.thresholdMs,
+		positionMs < minResumePositionMs,
+		positionMs >= durationMs-finishedMarginMs:
+		if !existed {
+			return
+		}
+		delete(s.positions, path)
+	default:
+		s.positions[path] = &SavedPosition{
+			Position:  positionMs,
+			Duration:  durationMs,
+			UpdatedAt: time.Now(),
+		}
+		if !existed {
+			s.trimLocked()
+		}
+	}
+
+	s.scheduleFlushLocked()
+}
+
+// Clear forgets the saved position of a track
+func (s *PositionStore) Clear(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.positions[path]; !ok {
+		return
+	}
+	delete(s.positions, path)
+	s.scheduleFlushLocked()
+}
+
+// Flush writes pending changes to disk immediately
+func (s *PositionStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+		s.flushTimer = nil
+	}
+	return s.saveLocked()
+}
+
+// GetFilePath returns the path to the positions file
+func (s *PositionStore) GetFilePath() string {
+	return s.filePath
+}
+
+// trimLocked drops the least recently updated entries beyond the cap
+func (s *PositionStore) trimLocked() {
+	for len(s.positions) > maxStoredPositions {
+		var oldestPath string
+		var oldest time.Time
+		for path, saved := range s.positions {
+			if oldestPath == "" || saved.UpdatedAt.Before(oldest) {
+				oldestPath = path
+				oldest = saved.UpdatedAt
+			}
+		}
+		delete(s.positions, oldestPath)
+	}
+}
+
+// scheduleFlushLocked arranges for the positions to be written shortly
+func (s *PositionStore) scheduleFlushLocked() {
+	if s.flushTimer != nil {
+		return
+	}
+	s.flushTimer = time.AfterFunc(positionFlushDelay, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.flushTimer = nil
+		if err := s.saveLocked(); err != nil {
+			log.Printf("[QUEUE] Warning: failed to save positions: %v", err)
+		}
+	})
+}
+
+// saveLocked writes the positions to disk (must be called with lock held)
+func (s *PositionStore) saveLocked() error {
+	data, err := json.MarshalIndent(s.positions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal positions: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create positions directory: %w", err)
+	}
+
+	if err := atomicfile.Write(s.filePath, data); err != nil {
+		return fmt.Errorf("failed to write positions file: %w", err)
+	}
+
+	return nil
+}
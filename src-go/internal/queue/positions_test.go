@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPositionStoreThreshold(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "queue_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store := NewPositionStore(tmpDir, 20*time.Minute)
+
+	// Short track is ignored
+	store.Set("/music/song.mp3", 60_000, 4*60_000)
+	if pos := store.Get("/music/song.mp3"); pos != 0 {
+		t.Errorf("Expected no position for short track, got %d", pos)
+	}
+
+	// Long track is remembered
+	store.Set("/books/chapter1.m4b", 25*60_000, 90*60_000)
+	if pos := store.Get("/books/chapter1.m4b"); pos != 25*60_000 {
+		t.Errorf("Expected position %d, got %d", 25*60_000, pos)
+	}
+
+	// Finishing the track forgets it
+	store.Set("/books/chapter1.m4b", 90*60_000, 90*60_000)
+	if pos := store.Get("/books/chapter1.m4b"); pos != 0 {
+		t.Errorf("Expected finished track to be forgotten, got %d", pos)
+	}
+}
+
+func TestPositionStoreFlushAndLoad(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "queue_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store := NewPositionStore(tmpDir, 20*time.Minute)
+	store.Set("/podcasts/episode.mp3", 30*60_000, 60*60_000)
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	loaded := NewPositionStore(tmpDir, 20*time.Minute)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if pos := loaded.Get("/podcasts/episode.mp3"); pos != 30*60_000 {
+		t.Errorf("Expected restored position %d, got %d", 30*60_000, pos)
+	}
+}
@@ -2,7 +2,10 @@
 package queue
 
 import (
+	"fmt"
+	"math"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 )
@@ -18,8 +21,14 @@ type TrackMetadata struct {
 
 // QueueItem represents an item in the playback queue
 type QueueItem struct {
+	ID       uint64 // Stable for as long as the item is queued
 	Path     string
 	Metadata *TrackMetadata
+	AddedBy  string `json:",omitempty"` // ID of the client that queued it, if known
+
+	// Recommendation says why continue mode picked the track, e.g.
+	// "Similar timbre and tempo to Awake"
+	Recommendation string `json:",omitempty"`
 }
 
 // ChangeCallback is called when the queue state changes
@@ -34,16 +43,30 @@ type Manager struct {
 	items        []QueueItem
 	index        int // Current position in items (or shuffleOrder if shuffled)
 	shuffle      bool
-	shuffleOrder []int // Shuffled indices into items
+	shuffleOrder []int  // Shuffled indices into items
+	nextID       uint64 // Last item ID handed out
+	version      uint64 // Bumped whenever the items or their order change
 	repeat       RepeatMode
 	rng          *rand.Rand
 	onChange     ChangeCallback // Called when queue state changes
 
+	// Interleave appended tracks by the client that added them
+	fair bool
+
+	// Shuffle settings
+	shuffleKind   ShuffleMode   // How to shuffle when shuffle is on; kept while it's off
+	shuffleWeight ShuffleWeight // Nil weights every track equally
+
 	// Continue mode settings
 	continueMode       ContinueMode
 	recentlyPlayed     []string // Track paths recently played (for exclusion)
 	maxRecentlyPlayed  int      // Max items to keep in recentlyPlayed
 	similarityProvider SimilarityProvider
+
+	// Undo/redo history for destructive mutations
+	undoStack  []snapshot
+	redoStack  []snapshot
+	maxHistory int
 }
 
 // RepeatMode represents the repeat behavior
@@ -55,6 +78,51 @@ const (
 	RepeatAll
 )
 
+// ShuffleMode represents how the queue is shuffled
+type ShuffleMode int
+
+const (
+	ShuffleOff     ShuffleMode = iota
+	ShuffleUniform             // Every order equally likely
+	ShuffleSmart               // Higher weighted tracks tend to come first
+	ShuffleAlbum               // Albums shuffled, tracks within one in order
+	ShuffleArtist              // Artists shuffled, their tracks in order
+)
+
+// String returns the name of a shuffle mode
+func (mode ShuffleMode) String() string {
+	switch mode {
+	case ShuffleUniform:
+		return "uniform"
+	case ShuffleSmart:
+		return "smart"
+	case ShuffleAlbum:
+		return "album"
+	case ShuffleArtist:
+		return "artist"
+	default:
+		return "off"
+	}
+}
+
+// ParseShuffleMode parses a shuffle mode name
+func ParseShuffleMode(name string) (ShuffleMode, error) {
+	for mode := ShuffleOff; mode <= ShuffleArtist; mode++ {
+		if mode.String() == name {
+			return mode, nil
+		}
+	}
+	return ShuffleOff, fmt.Errorf("invalid shuffle mode: %s", name)
+}
+
+// ShuffleWeight returns how strongly smart shuffle favors a track. 1 is
+// neutral; weights at or below zero are treated as a very small weight.
+type ShuffleWeight func(path string) float64
+
+// minShuffleWeight stands in for weights at or below zero so those tracks
+// still play eventually
+const minShuffleWeight = 0.01
+
 // ContinueMode represents what happens when the queue is exhausted
 type ContinueMode int
 
@@ -71,10 +139,12 @@ func NewManager() *Manager {
 		index:             -1,
 		repeat:            RepeatOff,
 		shuffleOrder:      make([]int, 0),
+		shuffleKind:       ShuffleUniform,
 		rng:               rand.New(rand.NewSource(time.Now().UnixNano())),
 		continueMode:      ContinueOff,
 		recentlyPlayed:    make([]string, 0),
 		maxRecentlyPlayed: 50,
+		maxHistory:        DefaultMaxHistory,
 	}
 }
 
@@ -98,11 +168,13 @@ func (m *Manager) notifyChange() {
 // Set replaces the entire queue with new paths
 func (m *Manager) Set(paths []string) {
 	m.mu.Lock()
+	m.recordHistory()
 
 	m.items = make([]QueueItem, len(paths))
 	for i, path := range paths {
 		m.items[i] = QueueItem{Path: path}
 	}
+	m.assignIDs(m.items)
 	m.index = -1
 
 	// Regenerate shuffle order if shuffle is enabled
@@ -117,9 +189,11 @@ func (m *Manager) Set(paths []string) {
 // SetWithMetadata replaces the queue with paths and metadata
 func (m *Manager) SetWithMetadata(items []QueueItem) {
 	m.mu.Lock()
+	m.recordHistory()
 
 	m.items = make([]QueueItem, len(items))
 	copy(m.items, items)
+	m.assignIDs(m.items)
 	m.index = -1
 
 	// Regenerate shuffle order if shuffle is enabled
@@ -138,6 +212,8 @@ func (m *Manager) Append(paths []string) {
 	for _, path := range paths {
 		m.items = append(m.items, QueueItem{Path: path})
 	}
+	m.assignIDs(m.items[len(m.items)-len(paths):])
+	m.version++
 
 	// Add new items to shuffle order if shuffle is enabled
 	if m.shuffle {
@@ -153,10 +229,14 @@ func (m *Manager) AppendWithMetadata(items []QueueItem) {
 	m.mu.Lock()
 
 	m.items = append(m.items, items...)
+	m.assignIDs(m.items[len(m.items)-len(items):])
+	m.version++
 
 	// Add new items to shuffle order if shuffle is enabled
 	if m.shuffle {
 		m.appendToShuffleOrder(len(items))
+	} else if m.fair {
+		m.fairOrderLocked()
 	}
 
 	m.mu.Unlock()
@@ -166,6 +246,14 @@ func (m *Manager) AppendWithMetadata(items []QueueItem) {
 // appendToShuffleOrder adds new item indices to the shuffle order in random positions
 func (m *Manager) appendToShuffleOrder(count int) {
 	startIdx := len(m.items) - count
+	if m.shuffleKind.isGrouped() {
+		indices := make([]int, count)
+		for i := range indices {
+			indices[i] = startIdx + i
+		}
+		m.insertGroupsIntoShuffleOrder(indices)
+		return
+	}
 	for i := 0; i < count; i++ {
 		newIdx := startIdx + i
 		// Insert at random position after current index
@@ -181,6 +269,10 @@ func (m *Manager) appendToShuffleOrder(count int) {
 func (m *Manager) Clear() {
 	m.mu.Lock()
 
+	if len(m.items) > 0 {
+		m.recordHistory()
+	}
+
 	m.items = make([]QueueItem, 0)
 	m.shuffleOrder = make([]int, 0)
 	m.index = -1
@@ -309,6 +401,14 @@ func (m *Manager) generateShuffleOrder() {
 	for i := 0; i < n; i++ {
 		m.shuffleOrder[i] = i
 	}
+	switch {
+	case m.shuffleKind == ShuffleSmart && m.shuffleWeight != nil:
+		m.weightedShuffleOrder()
+		return
+	case m.shuffleKind.isGrouped():
+		m.groupedShuffleOrder()
+		return
+	}
 	// Fisher-Yates shuffle
 	for i := n - 1; i > 0; i-- {
 		j := m.rng.Intn(i + 1)
@@ -316,6 +416,24 @@ func (m *Manager) generateShuffleOrder() {
 	}
 }
 
+// weightedShuffleOrder orders shuffleOrder as a weighted random permutation
+// (Efraimidis-Spirakis): each track draws the key -ln(u)/weight and the
+// smallest keys play first, so a track twice as heavy is twice as likely to
+// come before any given other track (must be called with lock held)
+func (m *Manager) weightedShuffleOrder() {
+	keys := make([]float64, len(m.items))
+	for i, item := range m.items {
+		weight := m.shuffleWeight(item.Path)
+		if weight <= 0 || math.IsNaN(weight) {
+			weight = minShuffleWeight
+		}
+		keys[i] = m.rng.ExpFloat64() / weight
+	}
+	sort.SliceStable(m.shuffleOrder, func(a, b int) bool {
+		return keys[m.shuffleOrder[a]] < keys[m.shuffleOrder[b]]
+	})
+}
+
 // Current returns the current track
 func (m *Manager) Current() (string, *TrackMetadata) {
 	m.mu.RLock()
@@ -334,6 +452,47 @@ func (m *Manager) Current() (string, *TrackMetadata) {
 	return item.Path, item.Metadata
 }
 
+// CurrentItem returns the current queue item, or false if there is none
+func (m *Manager) CurrentItem() (QueueItem, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.index < 0 {
+		return QueueItem{}, false
+	}
+	itemIdx := m.getItemIndex(m.index)
+	if itemIdx < 0 || itemIdx >= len(m.items) {
+		return QueueItem{}, false
+	}
+	return m.items[itemIdx], true
+}
+
+// Upcoming returns up to n tracks that play after the current one, in play
+// order. With repeat all the queue wraps around, stopping before the current
+// track.
+func (m *Manager) Upcoming(n int) []QueueItem {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	maxIndex := m.getMaxIndex()
+	var items []QueueItem
+	for pos := m.index + 1; len(items) < n; pos++ {
+		if pos >= maxIndex {
+			if m.repeat != RepeatAll || m.index < 0 {
+				break
+			}
+			pos -= maxIndex
+		}
+		if pos == m.index {
+			break
+		}
+		if itemIdx := m.getItemIndex(pos); itemIdx >= 0 && itemIdx < len(m.items) {
+			items = append(items, m.items[itemIdx])
+		}
+	}
+	return items
+}
+
 // SetIndex sets the current queue index
 func (m *Manager) SetIndex(index int) bool {
 	m.mu.Lock()
@@ -357,6 +516,15 @@ func (m *Manager) Position() (int, int) {
 	return m.index, len(m.items)
 }
 
+// Version returns the queue version, which changes whenever items are added,
+// removed or reordered but not when playback moves through the queue
+func (m *Manager) Version() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.version
+}
+
 // GetItems returns all items in the queue
 func (m *Manager) GetItems() []QueueItem {
 	m.mu.RLock()
@@ -367,20 +535,45 @@ func (m *Manager) GetItems() []QueueItem {
 	return items
 }
 
-// SetShuffle enables or disables shuffle mode
+// SetShuffle enables or disables shuffle mode. Enabling uses the last shuffle
+// mode chosen.
 func (m *Manager) SetShuffle(enabled bool) {
+	mode := ShuffleOff
+	if enabled {
+		m.mu.RLock()
+		mode = m.shuffleKind
+		m.mu.RUnlock()
+	}
+	m.SetShuffleMode(mode)
+}
+
+// SetShuffleMode sets the shuffle mode. Switching from one kind of shuffle to
+// another draws a new order that starts with the current track.
+func (m *Manager) SetShuffleMode(mode ShuffleMode) {
 	m.mu.Lock()
 
 	wasEnabled := m.shuffle
+	wasKind := m.shuffleKind
+	enabled := mode != ShuffleOff
 	m.shuffle = enabled
+	if enabled {
+		m.shuffleKind = mode
+	}
+
+	if enabled && (!wasEnabled || wasKind != m.shuffleKind) {
+		// Work from the current item's actual position if already shuffled
+		if wasEnabled && m.index >= 0 && m.index < len(m.shuffleOrder) {
+			m.index = m.shuffleOrder[m.index]
+		}
 
-	if enabled && !wasEnabled {
 		// Just enabled shuffle - generate shuffle order
 		m.generateShuffleOrder()
 
 		// If we have a current track, find it in the shuffle order and move it to position 0
 		// so the user continues from where they were
-		if m.index >= 0 && m.index < len(m.items) {
+		if m.shuffleKind.isGrouped() && m.index >= 0 && m.index < len(m.items) {
+			m.startGroupedShuffleAt(m.index)
+		} else if m.index >= 0 && m.index < len(m.items) {
 			currentItemIdx := m.index
 			for i, idx := range m.shuffleOrder {
 				if idx == currentItemIdx {
@@ -404,6 +597,24 @@ func (m *Manager) SetShuffle(enabled bool) {
 	m.notifyChange()
 }
 
+// GetShuffleMode returns the current shuffle mode
+func (m *Manager) GetShuffleMode() ShuffleMode {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.shuffle {
+		return ShuffleOff
+	}
+	return m.shuffleKind
+}
+
+// SetShuffleWeight sets the weight smart shuffle draws tracks by
+func (m *Manager) SetShuffleWeight(weight ShuffleWeight) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shuffleWeight = weight
+}
+
 // GetShuffle returns whether shuffle is enabled
 func (m *Manager) GetShuffle() bool {
 	m.mu.RLock()
@@ -431,12 +642,22 @@ func (m *Manager) GetRepeat() RepeatMode {
 // Remove removes an item at the specified index (actual item index, not shuffle position)
 func (m *Manager) Remove(index int) bool {
 	m.mu.Lock()
+	ok := m.removeLocked(index)
+	m.mu.Unlock()
+
+	if ok {
+		m.notifyChange()
+	}
+	return ok
+}
 
+// removeLocked removes the item at index (must be called with lock held)
+func (m *Manager) removeLocked(index int) bool {
 	if index < 0 || index >= len(m.items) {
-		m.mu.Unlock()
 		return false
 	}
 
+	m.recordHistory()
 	m.items = append(m.items[:index], m.items[index+1:]...)
 
 	// Update shuffle order if enabled
@@ -474,9 +695,6 @@ func (m *Manager) Remove(index int) bool {
 			}
 		}
 	}
-
-	m.mu.Unlock()
-	m.notifyChange()
 	return true
 }
 
@@ -489,7 +707,9 @@ func (m *Manager) Insert(index int, path string, metadata *TrackMetadata) bool {
 		return false
 	}
 
-	item := QueueItem{Path: path, Metadata: metadata}
+	m.nextID++
+	item := QueueItem{ID: m.nextID, Path: path, Metadata: metadata}
+	m.version++
 
 	// Insert at index
 	m.items = append(m.items[:index], append([]QueueItem{item}, m.items[index:]...)...)
@@ -502,12 +722,16 @@ func (m *Manager) Insert(index int, path string, metadata *TrackMetadata) bool {
 				m.shuffleOrder[i]++
 			}
 		}
-		// Add the new index at a random position after current
-		insertPos := m.index + 1 + m.rng.Intn(len(m.shuffleOrder)-m.index)
-		if insertPos > len(m.shuffleOrder) {
-			insertPos = len(m.shuffleOrder)
+		if m.shuffleKind.isGrouped() {
+			m.insertGroupsIntoShuffleOrder([]int{index})
+		} else {
+			// Add the new index at a random position after current
+			insertPos := m.index + 1 + m.rng.Intn(len(m.shuffleOrder)-m.index)
+			if insertPos > len(m.shuffleOrder) {
+				insertPos = len(m.shuffleOrder)
+			}
+			m.shuffleOrder = append(m.shuffleOrder[:insertPos], append([]int{index}, m.shuffleOrder[insertPos:]...)...)
 		}
-		m.shuffleOrder = append(m.shuffleOrder[:insertPos], append([]int{index}, m.shuffleOrder[insertPos:]...)...)
 	} else {
 		// Non-shuffle mode: adjust current index if needed
 		if index <= m.index {
@@ -523,20 +747,30 @@ func (m *Manager) Insert(index int, path string, metadata *TrackMetadata) bool {
 // Move moves an item from one index to another
 func (m *Manager) Move(fromIndex, toIndex int) bool {
 	m.mu.Lock()
+	ok, moved := m.moveLocked(fromIndex, toIndex)
+	m.mu.Unlock()
 
+	if moved {
+		m.notifyChange()
+	}
+	return ok
+}
+
+// moveLocked moves an item and reports whether the indices were valid and
+// whether anything moved (must be called with lock held)
+func (m *Manager) moveLocked(fromIndex, toIndex int) (ok, moved bool) {
 	if fromIndex < 0 || fromIndex >= len(m.items) {
-		m.mu.Unlock()
-		return false
+		return false, false
 	}
 	if toIndex < 0 || toIndex >= len(m.items) {
-		m.mu.Unlock()
-		return false
+		return false, false
 	}
 	if fromIndex == toIndex {
-		m.mu.Unlock()
-		return true
+		return true, false
 	}
 
+	m.recordHistory()
+
 	// Remove item at fromIndex
 	item := m.items[fromIndex]
 	m.items = append(m.items[:fromIndex], m.items[fromIndex+1:]...)
@@ -558,10 +792,7 @@ func (m *Manager) Move(fromIndex, toIndex int) bool {
 			m.index++
 		}
 	}
-
-	m.mu.Unlock()
-	m.notifyChange()
-	return true
+	return true, true
 }
 
 // SetContinueMode sets the queue continuation mode
@@ -1,6 +1,9 @@
 package queue
 
 import (
+	"fmt"
+	"math"
+	"path/filepath"
 	"testing"
 )
 
@@ -130,6 +133,20 @@ func TestCurrent(t *testing.T) {
 	}
 }
 
+func TestCurrentItem(t *testing.T) {
+	m := NewManager()
+	if _, ok := m.CurrentItem(); ok {
+		t.Error("Expected no current item in an empty queue")
+	}
+
+	m.AppendWithMetadata([]QueueItem{{Path: "/path/1.mp3", Recommendation: "Similar tempo to Intro"}})
+	m.Next()
+	item, ok := m.CurrentItem()
+	if !ok || item.Path != "/path/1.mp3" || item.Recommendation != "Similar tempo to Intro" {
+		t.Errorf("Expected the appended item with its recommendation, got %+v, %v", item, ok)
+	}
+}
+
 func TestSetIndex(t *testing.T) {
 	m := NewManager()
 	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/3.mp3"})
@@ -184,6 +201,30 @@ func TestRepeatAll(t *testing.T) {
 	}
 }
 
+func TestUpcoming(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/3.mp3"})
+
+	// Nothing has played yet, so everything is upcoming
+	if items := m.Upcoming(5); len(items) != 3 {
+		t.Errorf("Expected 3 upcoming items before playback, got %d", len(items))
+	}
+
+	m.Next() // 0
+	m.Next() // 1
+	items := m.Upcoming(5)
+	if len(items) != 1 || items[0].Path != "/path/3.mp3" {
+		t.Errorf("Expected only /path/3.mp3 upcoming, got %v", items)
+	}
+
+	// Repeat all wraps around but stops before the current track
+	m.SetRepeat(RepeatAll)
+	items = m.Upcoming(5)
+	if len(items) != 2 || items[1].Path != "/path/1.mp3" {
+		t.Errorf("Expected 3 then 1 with RepeatAll, got %v", items)
+	}
+}
+
 func TestRepeatOne(t *testing.T) {
 	m := NewManager()
 	m.Set([]string{"/path/1.mp3", "/path/2.mp3"})
@@ -283,6 +324,251 @@ func TestShuffleGetSet(t *testing.T) {
 	}
 }
 
+func TestShuffleModeGetSet(t *testing.T) {
+	m := NewManager()
+
+	if m.GetShuffleMode() != ShuffleOff {
+		t.Error("Shuffle mode should be off by default")
+	}
+
+	m.SetShuffleMode(ShuffleSmart)
+	if m.GetShuffleMode() != ShuffleSmart || !m.GetShuffle() {
+		t.Error("Expected smart shuffle to count as shuffle on")
+	}
+
+	// Toggling shuffle off and on comes back to smart shuffle
+	m.SetShuffle(false)
+	if m.GetShuffleMode() != ShuffleOff {
+		t.Error("Shuffle mode should be off after SetShuffle(false)")
+	}
+	m.SetShuffle(true)
+	if m.GetShuffleMode() != ShuffleSmart {
+		t.Errorf("Expected smart shuffle back, got %v", m.GetShuffleMode())
+	}
+
+	m.SetShuffleMode(ShuffleUniform)
+	m.SetShuffle(false)
+	m.SetShuffle(true)
+	if m.GetShuffleMode() != ShuffleUniform {
+		t.Errorf("Expected uniform shuffle back, got %v", m.GetShuffleMode())
+	}
+}
+
+func TestSmartShuffleFavorsHeavyTracks(t *testing.T) {
+	paths := make([]string, 10)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/path/%d.mp3", i)
+	}
+	weight := func(path string) float64 {
+		switch path {
+		case "/path/7.mp3":
+			return 1000
+		case "/path/3.mp3":
+			return 0 // Still played, just last
+		}
+		return 1
+	}
+
+	heavyFirst, zeroLast := 0, 0
+	for trial := 0; trial < 100; trial++ {
+		m := NewManager()
+		m.SetShuffleWeight(weight)
+		m.Set(paths)
+		m.SetShuffleMode(ShuffleSmart)
+
+		var order []string
+		for path, _ := m.Next(); path != ""; path, _ = m.Next() {
+			order = append(order, path)
+		}
+		if len(order) != len(paths) {
+			t.Fatalf("Expected every track once, got %v", order)
+		}
+		if order[0] == "/path/7.mp3" {
+			heavyFirst++
+		}
+		if order[len(order)-1] == "/path/3.mp3" {
+			zeroLast++
+		}
+	}
+
+	// 1000/1009 and 1-1/(1+0.01*9) respectively
+	if heavyFirst < 90 {
+		t.Errorf("Expected the heavy track first nearly always, got %d/100", heavyFirst)
+	}
+	if zeroLast < 75 {
+		t.Errorf("Expected the zero weight track last nearly always, got %d/100", zeroLast)
+	}
+}
+
+func TestShuffleModeSwitchMaintainsCurrentTrack(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/3.mp3", "/path/4.mp3"})
+	m.SetShuffleWeight(func(string) float64 { return 1 })
+
+	m.SetShuffleMode(ShuffleUniform)
+	m.Next()
+	m.Next()
+	currentPath, _ := m.Current()
+
+	m.SetShuffleMode(ShuffleSmart)
+	if path, _ := m.Current(); path != currentPath {
+		t.Errorf("Expected current track to stay %s, got %s", currentPath, path)
+	}
+	if pos, _ := m.Position(); pos != 0 {
+		t.Errorf("Expected the current track first in the new order, got position %d", pos)
+	}
+}
+
+// albumItems returns tracks 1-3 of each album, tagged with the album name
+func albumItems(albums ...string) []QueueItem {
+	var items []QueueItem
+	for _, album := range albums {
+		for track := 1; track <= 3; track++ {
+			items = append(items, QueueItem{
+				Path:     fmt.Sprintf("/music/%s/%d.flac", album, track),
+				Metadata: &TrackMetadata{Album: album, Artist: "Artist " + album},
+			})
+		}
+	}
+	return items
+}
+
+// assertWholeAlbums checks that order plays each album's tracks together and
+// in track order
+func assertWholeAlbums(t *testing.T, order []string) {
+	t.Helper()
+	for i := 0; i < len(order); i += 3 {
+		album := filepath.Dir(order[i])
+		for track := 1; track <= 3; track++ {
+			if want := fmt.Sprintf("%s/%d.flac", album, track); order[i+track-1] != want {
+				t.Fatalf("Expected %s at %d, got order %v", want, i+track-1, order)
+			}
+		}
+	}
+}
+
+func TestAlbumShuffleKeepsAlbumsTogether(t *testing.T) {
+	for trial := 0; trial < 20; trial++ {
+		m := NewManager()
+		m.SetWithMetadata(albumItems("a", "b", "c", "d"))
+		m.SetShuffleMode(ShuffleAlbum)
+
+		var order []string
+		for path, _ := m.Next(); path != ""; path, _ = m.Next() {
+			order = append(order, path)
+		}
+		if len(order) != 12 {
+			t.Fatalf("Expected every track once, got %v", order)
+		}
+		assertWholeAlbums(t, order)
+	}
+}
+
+func TestAlbumShuffleContinuesCurrentAlbum(t *testing.T) {
+	m := NewManager()
+	m.SetWithMetadata(albumItems("a", "b", "c"))
+	m.SetIndex(4) // b/2
+
+	m.SetShuffleMode(ShuffleAlbum)
+	if path, _ := m.Current(); path != "/music/b/2.flac" {
+		t.Fatalf("Expected current track to stay /music/b/2.flac, got %s", path)
+	}
+	if path, _ := m.Next(); path != "/music/b/3.flac" {
+		t.Errorf("Expected the rest of the album next, got %s", path)
+	}
+}
+
+func TestAlbumShuffleAppendKeepsAlbumsTogether(t *testing.T) {
+	m := NewManager()
+	m.SetWithMetadata(albumItems("a", "b"))
+	m.SetShuffleMode(ShuffleAlbum)
+	m.Next()
+
+	// A new album and an untagged track, grouped by its folder
+	m.AppendWithMetadata(albumItems("c"))
+	m.Insert(0, "/music/untagged/1.flac", nil)
+
+	var order []string
+	for i := 0; i < 13; i++ {
+		path, _ := m.Current()
+		order = append(order, path)
+		m.Next()
+	}
+	seen := make(map[string]bool)
+	for i, path := range order {
+		album := filepath.Dir(path)
+		if seen[album] && filepath.Dir(order[i-1]) != album {
+			t.Fatalf("Expected %s to play as one block, got %v", album, order)
+		}
+		seen[album] = true
+	}
+}
+
+func TestArtistShuffleGroupsByArtist(t *testing.T) {
+	m := NewManager()
+	items := albumItems("a", "b", "c")
+	// Albums b and c are by the same artist
+	for _, item := range items[6:] {
+		item.Metadata.Artist = "Artist b"
+	}
+	m.SetWithMetadata(items)
+	m.SetShuffleMode(ShuffleArtist)
+
+	var order []string
+	for path, _ := m.Next(); path != ""; path, _ = m.Next() {
+		order = append(order, path)
+	}
+	want := []string{"/music/b/1.flac", "/music/b/2.flac", "/music/b/3.flac",
+		"/music/c/1.flac", "/music/c/2.flac", "/music/c/3.flac"}
+	start := 0
+	if order[0] != "/music/b/1.flac" {
+		start = 3
+	}
+	for i, path := range want {
+		if order[start+i] != path {
+			t.Fatalf("Expected the artist's tracks in queue order, got %v", order)
+		}
+	}
+}
+
+func TestVersionChangesOnEdits(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/3.mp3"})
+
+	edits := []struct {
+		name string
+		edit func()
+	}{
+		{"append", func() { m.Append([]string{"/path/4.mp3"}) }},
+		{"insert", func() { m.Insert(0, "/path/5.mp3", nil) }},
+		{"move", func() { m.Move(0, 2) }},
+		{"remove", func() { m.Remove(0) }},
+		{"undo", func() { m.Undo() }},
+		{"redo", func() { m.Redo() }},
+	}
+	for _, e := range edits {
+		before := m.Version()
+		e.edit()
+		if m.Version() == before {
+			t.Errorf("Expected %s to change the version", e.name)
+		}
+	}
+
+	// Playing through the queue isn't an edit
+	before := m.Version()
+	m.Next()
+	m.SetIndex(2)
+	m.SetShuffle(true)
+	if m.Version() != before {
+		t.Errorf("Expected playback not to change the version, went from %d to %d", before, m.Version())
+	}
+
+	// Nor is a failed edit
+	if m.Remove(99); m.Version() != before {
+		t.Error("Expected a rejected remove not to change the version")
+	}
+}
+
 func TestRepeatGetSet(t *testing.T) {
 	m := NewManager()
 
@@ -429,3 +715,271 @@ func TestOnChange(t *testing.T) {
 		t.Errorf("Expected 3 onChange calls after SetRepeat, got %d", callCount)
 	}
 }
+
+func TestUndoClear(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/3.mp3"})
+	m.SetIndex(1)
+
+	m.Clear()
+	if _, size := m.Position(); size != 0 {
+		t.Fatalf("Expected empty queue after Clear, got %d", size)
+	}
+
+	if !m.Undo() {
+		t.Fatal("Undo should succeed after Clear")
+	}
+
+	idx, size := m.Position()
+	if size != 3 {
+		t.Errorf("Expected 3 items after Undo, got %d", size)
+	}
+	if idx != 1 {
+		t.Errorf("Expected index 1 after Undo, got %d", idx)
+	}
+
+	if !m.Redo() {
+		t.Fatal("Redo should succeed after Undo")
+	}
+	if _, size := m.Position(); size != 0 {
+		t.Errorf("Expected empty queue after Redo, got %d", size)
+	}
+}
+
+func TestUndoRemoveAndMove(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/3.mp3"})
+
+	m.Remove(0)
+	m.Move(0, 1)
+
+	if !m.Undo() {
+		t.Fatal("Undo of Move should succeed")
+	}
+	items := m.GetItems()
+	if len(items) != 2 || items[0].Path != "/path/2.mp3" {
+		t.Errorf("Expected /path/2.mp3 first after undoing Move, got %v", items)
+	}
+
+	if !m.Undo() {
+		t.Fatal("Undo of Remove should succeed")
+	}
+	items = m.GetItems()
+	if len(items) != 3 || items[0].Path != "/path/1.mp3" {
+		t.Errorf("Expected original queue after undoing Remove, got %v", items)
+	}
+}
+
+func TestUndoNothing(t *testing.T) {
+	m := NewManager()
+
+	if m.Undo() {
+		t.Error("Undo should fail on a fresh manager")
+	}
+	if m.Redo() {
+		t.Error("Redo should fail on a fresh manager")
+	}
+
+	// Clearing an empty queue is not recorded
+	m.Clear()
+	if m.Undo() {
+		t.Error("Undo should fail after clearing an empty queue")
+	}
+}
+
+func TestNewMutationClearsRedo(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3"})
+	m.Remove(0)
+	m.Undo()
+
+	m.Remove(1)
+	if m.Redo() {
+		t.Error("Redo should fail after a new mutation")
+	}
+}
+
+func TestHistoryBounded(t *testing.T) {
+	m := NewManager()
+	m.SetMaxHistory(3)
+
+	for i := 0; i < 10; i++ {
+		m.Set([]string{"/path/1.mp3"})
+	}
+
+	undo, _ := m.HistorySize()
+	if undo != 3 {
+		t.Errorf("Expected 3 undo steps, got %d", undo)
+	}
+}
+
+func TestRemoveRange(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/3.mp3", "/path/4.mp3", "/path/5.mp3"})
+	m.SetIndex(3) // 4.mp3
+
+	if removed := m.RemoveRange(1, 3); removed != 2 {
+		t.Errorf("Expected 2 removed, got %d", removed)
+	}
+
+	items := m.GetItems()
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(items))
+	}
+	path, _ := m.Current()
+	if path != "/path/4.mp3" {
+		t.Errorf("Expected current track to remain /path/4.mp3, got %s", path)
+	}
+}
+
+func TestRemoveByPaths(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/1.mp3", "/path/3.mp3"})
+
+	if removed := m.RemoveByPaths([]string{"/path/1.mp3"}); removed != 2 {
+		t.Errorf("Expected 2 removed, got %d", removed)
+	}
+	items := m.GetItems()
+	if len(items) != 2 || items[0].Path != "/path/2.mp3" || items[1].Path != "/path/3.mp3" {
+		t.Errorf("Unexpected items after RemoveByPaths: %v", items)
+	}
+
+	if removed := m.RemoveByPaths([]string{"/missing.mp3"}); removed != 0 {
+		t.Errorf("Expected 0 removed for unknown path, got %d", removed)
+	}
+}
+
+func TestDeduplicateKeepsCurrent(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/1.mp3", "/path/2.mp3"})
+	m.SetIndex(2) // second copy of 1.mp3
+
+	if removed := m.Deduplicate(); removed != 2 {
+		t.Errorf("Expected 2 removed, got %d", removed)
+	}
+
+	items := m.GetItems()
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+	path, _ := m.Current()
+	if path != "/path/1.mp3" {
+		t.Errorf("Expected current track /path/1.mp3, got %s", path)
+	}
+	if items[0].Path != "/path/2.mp3" {
+		t.Errorf("Expected the earlier copy of the current track to be removed, got %v", items)
+	}
+}
+
+func TestShuffleRemaining(t *testing.T) {
+	m := NewManager()
+	paths := make([]string, 20)
+	for i := range paths {
+		paths[i] = "/path/" + string(rune('a'+i)) + ".mp3"
+	}
+	m.Set(paths)
+	m.SetIndex(4)
+
+	m.ShuffleRemaining()
+
+	items := m.GetItems()
+	for i := 0; i <= 4; i++ {
+		if items[i].Path != paths[i] {
+			t.Errorf("Item %d before/at current should be unchanged", i)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, item := range items {
+		seen[item.Path] = true
+	}
+	if len(seen) != len(paths) {
+		t.Errorf("Expected all %d tracks to remain, got %d", len(paths), len(seen))
+	}
+}
+
+func TestSmartOrder(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/0.mp3", "/path/5.mp3", "/path/9.mp3", "/path/2.mp3", "/path/6.mp3", "/path/4.mp3"})
+	m.SetIndex(1)
+
+	// Distance is the difference between the numbers in the names
+	value := func(path string) float64 { return float64(path[len("/path/")] - '0') }
+	distance := func(from, to string) float64 { return math.Abs(value(from) - value(to)) }
+
+	if !m.SmartOrder(distance) {
+		t.Fatal("Expected the queue to be reordered")
+	}
+
+	want := []string{"/path/0.mp3", "/path/5.mp3", "/path/6.mp3", "/path/4.mp3", "/path/2.mp3", "/path/9.mp3"}
+	for i, item := range m.GetItems() {
+		if item.Path != want[i] {
+			t.Fatalf("Expected order %v, got item %d = %s", want, i, item.Path)
+		}
+	}
+	if path, _ := m.Current(); path != "/path/5.mp3" {
+		t.Errorf("Expected the current track to stay the anchor, got %s", path)
+	}
+
+	m.Undo()
+	if items := m.GetItems(); items[2].Path != "/path/9.mp3" {
+		t.Errorf("Expected undo to restore the original order, got %v", items)
+	}
+}
+
+func TestSmartOrderShuffled(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/0.mp3", "/path/5.mp3", "/path/9.mp3", "/path/2.mp3", "/path/6.mp3", "/path/3.mp3"})
+	m.SetShuffle(true)
+	m.Next()
+	current, _ := m.Current()
+
+	value := func(path string) float64 { return float64(path[len("/path/")] - '0') }
+	m.SmartOrder(func(from, to string) float64 { return math.Abs(value(from) - value(to)) })
+
+	if path, _ := m.Current(); path != current {
+		t.Errorf("Expected current track %s to stay put, got %s", current, path)
+	}
+
+	// Every step must go to the closest track not yet played
+	prev := current
+	var rest []string
+	for {
+		path, _ := m.Next()
+		if path == "" {
+			break
+		}
+		rest = append(rest, path)
+	}
+	for i, path := range rest {
+		for _, other := range rest[i+1:] {
+			if math.Abs(value(prev)-value(other)) < math.Abs(value(prev)-value(path)) {
+				t.Fatalf("Expected %s after %s, got %s", other, prev, path)
+			}
+		}
+		prev = path
+	}
+}
+
+func TestRemoveRangeShuffled(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3", "/path/3.mp3", "/path/4.mp3"})
+	m.SetShuffle(true)
+	m.Next()
+	m.Next()
+	current, _ := m.Current()
+
+	// Remove everything except the current track
+	var others []string
+	for _, item := range m.GetItems() {
+		if item.Path != current {
+			others = append(others, item.Path)
+		}
+	}
+	m.RemoveByPaths(others)
+
+	path, _ := m.Current()
+	if path != current {
+		t.Errorf("Expected current track %s to survive, got %s", current, path)
+	}
+}
@@ -0,0 +1,106 @@
+package queue
+
+import "log"
+
+// The RelocatePaths methods in this file rewrite stored track paths after
+// files have been moved. rename returns the new path for a track and false
+// if the track did not move.
+
+// relocateItems rewrites the paths of queue items in place
+func relocateItems(items []QueueItem, rename func(path string) (string, bool)) int {
+	moved := 0
+	for i := range items {
+		if newPath, ok := rename(items[i].Path); ok && newPath != items[i].Path {
+			items[i].Path = newPath
+			moved++
+		}
+	}
+	return moved
+}
+
+// RelocatePaths rewrites the paths of queued tracks, the recently played list
+// and the undo history. Returns the number of queue items that moved.
+func (m *Manager) RelocatePaths(rename func(path string) (string, bool)) int {
+	m.mu.Lock()
+	moved := relocateItems(m.items, rename)
+	for _, s := range m.undoStack {
+		relocateItems(s.items, rename)
+	}
+	for _, s := range m.redoStack {
+		relocateItems(s.items, rename)
+	}
+	for i, path := range m.recentlyPlayed {
+		if newPath, ok := rename(path); ok {
+			m.recentlyPlayed[i] = newPath
+		}
+	}
+	m.mu.Unlock()
+
+	if moved > 0 {
+		m.notifyChange()
+	}
+	return moved
+}
+
+// RelocatePaths rewrites the path of the saved resume position. It is
+// persisted with the next Save.
+func (s *Store) RelocatePaths(rename func(path string) (string, bool)) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.positionPath == "" {
+		return 0
+	}
+	newPath, ok := rename(s.positionPath)
+	if !ok || newPath == s.positionPath {
+		return 0
+	}
+	s.positionPath = newPath
+	return 1
+}
+
+// RelocatePaths moves saved positions to the new track paths
+func (s *PositionStore) RelocatePaths(rename func(path string) (string, bool)) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	moved := 0
+	positions := make(map[string]*SavedPosition, len(s.positions))
+	for path, saved := range s.positions {
+		if newPath, ok := rename(path); ok && newPath != path {
+			path = newPath
+			moved++
+		}
+		positions[path] = saved
+	}
+	s.positions = positions
+
+	if moved > 0 {
+		s.scheduleFlushLocked()
+	}
+	return moved
+}
+
+// RelocatePaths moves bookmarks to the new track paths
+func (s *BookmarkStore) RelocatePaths(rename func(path string) (string, bool)) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	moved := 0
+	bookmarks := make(map[string][]Bookmark, len(s.bookmarks))
+	for path, marks := range s.bookmarks {
+		if newPath, ok := rename(path); ok && newPath != path {
+			path = newPath
+			moved++
+		}
+		bookmarks[path] = append(bookmarks[path], marks...)
+	}
+	s.bookmarks = bookmarks
+
+	if moved > 0 {
+		if err := s.saveLocked(); err != nil {
+			log.Printf("[QUEUE] Failed to save relocated bookmarks: %v", err)
+		}
+	}
+	return moved
+}
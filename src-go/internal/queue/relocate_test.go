@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func renamePrefix(from, to string) func(string) (string, bool) {
+	return func(path string) (string, bool) {
+		if !strings.HasPrefix(path, from) {
+			return "", false
+		}
+		return to + strings.TrimPrefix(path, from), true
+	}
+}
+
+func TestManagerRelocatePaths(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/old/a.mp3", "/old/b.mp3", "/other/c.mp3"})
+	m.AddToRecentlyPlayed("/old/a.mp3")
+	m.Remove(2)
+
+	changes := 0
+	m.SetOnChange(func() { changes++ })
+
+	moved := m.RelocatePaths(renamePrefix("/old", "/new"))
+	if moved != 2 {
+		t.Errorf("Expected 2 moved items, got %d", moved)
+	}
+	if changes != 1 {
+		t.Errorf("Expected 1 onChange call, got %d", changes)
+	}
+
+	items := m.GetItems()
+	if items[0].Path != "/new/a.mp3" || items[1].Path != "/new/b.mp3" {
+		t.Errorf("Expected relocated queue, got %v", items)
+	}
+	if recent := m.GetRecentlyPlayed(); recent[0] != "/new/a.mp3" {
+		t.Errorf("Expected relocated recently played, got %v", recent)
+	}
+
+	// Undo restores the removed track with its new path
+	if !m.Undo() {
+		t.Fatal("Expected undo to succeed")
+	}
+	items = m.GetItems()
+	if len(items) != 3 || items[0].Path != "/new/a.mp3" || items[2].Path != "/other/c.mp3" {
+		t.Errorf("Expected undo snapshot to be relocated, got %v", items)
+	}
+}
+
+func TestPositionStoreRelocatePaths(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "queue_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	positions := NewPositionStore(tmpDir, 20*time.Minute)
+	positions.Set("/old/book.m4b", 25*60_000, 90*60_000)
+	if moved := positions.RelocatePaths(renamePrefix("/old", "/new")); moved != 1 {
+		t.Errorf("Expected 1 moved position, got %d", moved)
+	}
+	if pos := positions.Get("/new/book.m4b"); pos != 25*60_000 {
+		t.Errorf("Expected position at new path, got %d", pos)
+	}
+	if pos := positions.Get("/old/book.m4b"); pos != 0 {
+		t.Errorf("Expected no position at old path, got %d", pos)
+	}
+}
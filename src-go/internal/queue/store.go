@@ -4,18 +4,34 @@ package queue
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/atomicfile"
 )
 
+// queueSaveDelay debounces writes to the queue file, which would otherwise be
+// rewritten on every track change
+const queueSaveDelay = 2 * time.Second
+
 // PersistentState represents the queue state that gets persisted to disk
 type PersistentState struct {
 	Items        []QueueItem `json:"items"`
 	Index        int         `json:"index"`
 	Shuffle      bool        `json:"shuffle"`
 	ShuffleOrder []int       `json:"shuffleOrder,omitempty"`
-	Repeat       string      `json:"repeat"` // "off", "one", "all"
+	ShuffleMode  string      `json:"shuffleMode,omitempty"` // Kind of shuffle, kept while shuffle is off
+	Repeat       string      `json:"repeat"`                // "off", "one", "all"
+
+	// Last known playback position of the current track (for ResumeOnStart)
+	PositionPath string `json:"positionPath,omitempty"`
+	Position     int64  `json:"position,omitempty"` // milliseconds
+
+	// Whether the track was playing when saved (used for instance handoff)
+	Playing bool `json:"playing,omitempty"`
 }
 
 // Store handles queue persistence to disk
@@ -23,6 +39,12 @@ type Store struct {
 	mu       sync.Mutex
 	filePath string
 	manager  *Manager
+
+	positionPath string
+	position     int64
+	playing      bool
+
+	saveTimer *time.Timer
 }
 
 // NewStore creates a new queue store
@@ -33,6 +55,14 @@ func NewStore(configDir string, manager *Manager) *Store {
 	}
 }
 
+// NewStoreAt creates a queue store backed by an arbitrary file
+func NewStoreAt(filePath string, manager *Manager) *Store {
+	return &Store{
+		filePath: filePath,
+		manager:  manager,
+	}
+}
+
 // Load loads the queue state from disk
 func (s *Store) Load() error {
 	s.mu.Lock()
@@ -53,54 +83,126 @@ func (s *Store) Load() error {
 		return fmt.Errorf("failed to parse queue file: %w", err)
 	}
 
-	// Restore state to manager
-	s.manager.mu.Lock()
-	defer s.manager.mu.Unlock()
+	s.restoreLocked(state)
+	return nil
+}
+
+// Restore replaces the queue and the recorded playback position with a
+// saved state, as Load does with the file
+func (s *Store) Restore(state PersistentState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restoreLocked(state)
+}
+
+func (s *Store) restoreLocked(state PersistentState) {
+	s.positionPath = state.PositionPath
+	s.position = state.Position
+	s.playing = state.Playing
+	s.manager.Restore(state)
+}
 
-	s.manager.items = state.Items
-	s.manager.index = state.Index
-	s.manager.shuffle = state.Shuffle
-	s.manager.shuffleOrder = state.ShuffleOrder
+// Restore replaces the queue, its position and the shuffle and repeat
+// settings with a saved state. The playback fields are ignored. The state
+// may come from a file anyone wrote (--load-state), so a shuffle order that
+// isn't one of the items is made anew and the position is kept within the
+// queue.
+func (m *Manager) Restore(state PersistentState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items = state.Items
+	if m.items == nil {
+		m.items = make([]QueueItem, 0)
+	}
+	m.restoreIDs()
+	m.index = state.Index
+	m.shuffle = state.Shuffle
+	if mode, err := ParseShuffleMode(state.ShuffleMode); err == nil && mode != ShuffleOff {
+		m.shuffleKind = mode
+	}
+	m.shuffleOrder = state.ShuffleOrder
+	if !isPermutation(m.shuffleOrder, len(m.items)) {
+		if m.shuffle {
+			// The position was into an order that can't be trusted
+			log.Printf("[QUEUE] Warning: saved shuffle order doesn't match the queue, reshuffling")
+			m.generateShuffleOrder()
+			m.index = -1
+		} else {
+			m.shuffleOrder = make([]int, 0)
+		}
+	}
+	if m.index < -1 || m.index >= len(m.items) {
+		log.Printf("[QUEUE] Warning: saved position %d is outside the queue of %d", m.index, len(m.items))
+		m.index = -1
+	}
 
 	switch state.Repeat {
 	case "one":
-		s.manager.repeat = RepeatOne
+		m.repeat = RepeatOne
 	case "all":
-		s.manager.repeat = RepeatAll
+		m.repeat = RepeatAll
 	default:
-		s.manager.repeat = RepeatOff
+		m.repeat = RepeatOff
 	}
+}
 
-	return nil
+// isPermutation reports whether order holds each of 0 to n-1 once
+func isPermutation(order []int, n int) bool {
+	if len(order) != n {
+		return false
+	}
+	seen := make([]bool, n)
+	for _, i := range order {
+		if i < 0 || i >= n || seen[i] {
+			return false
+		}
+		seen[i] = true
+	}
+	return true
 }
 
 // Save saves the current queue state to disk
 func (s *Store) Save() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.saveLocked()
+}
 
-	// Get state from manager
-	s.manager.mu.RLock()
-	state := PersistentState{
-		Items:        make([]QueueItem, len(s.manager.items)),
-		Index:        s.manager.index,
-		Shuffle:      s.manager.shuffle,
-		ShuffleOrder: s.manager.shuffleOrder,
+// SaveSoon arranges for the queue to be saved shortly, so a burst of changes
+// is written once
+func (s *Store) SaveSoon() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.saveTimer != nil {
+		return
 	}
-	copy(state.Items, s.manager.items)
+	s.saveTimer = time.AfterFunc(queueSaveDelay, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.saveTimer = nil
+		if err := s.saveLocked(); err != nil {
+			log.Printf("[QUEUE] Warning: failed to save queue: %v", err)
+		}
+	})
+}
 
-	switch s.manager.repeat {
-	case RepeatOne:
-		state.Repeat = "one"
-	case RepeatAll:
-		state.Repeat = "all"
-	default:
-		state.Repeat = "off"
+// Flush cancels any pending save and saves the queue immediately
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
 	}
-	s.manager.mu.RUnlock()
+	return s.saveLocked()
+}
 
-	// Marshal to JSON
-	data, err := json.MarshalIndent(state, "", "  ")
+// saveLocked writes the queue state to disk (must be called with lock held)
+func (s *Store) saveLocked() error {
+	data, err := json.MarshalIndent(s.snapshot(), "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal queue state: %w", err)
 	}
@@ -111,19 +213,82 @@ func (s *Store) Save() error {
 		return fmt.Errorf("failed to create queue directory: %w", err)
 	}
 
-	// Write to file
-	if err := os.WriteFile(s.filePath, data, 0600); err != nil {
+	if err := atomicfile.Write(s.filePath, data); err != nil {
 		return fmt.Errorf("failed to write queue file: %w", err)
 	}
 
 	return nil
 }
 
-// AutoSave sets up the manager to automatically save on changes
-// Returns a function to stop auto-saving
-func (s *Store) AutoSave() {
-	// We'll use a simple approach: save after each mutation
-	// A more sophisticated approach would debounce saves
+// snapshot copies the manager's state along with the playback position
+func (s *Store) snapshot() PersistentState {
+	state := s.manager.State()
+	state.PositionPath = s.positionPath
+	state.Position = s.position
+	state.Playing = s.playing
+	return state
+}
+
+// State copies the queue, its position and the shuffle and repeat settings
+// in the form they are saved, holding the read lock only for as long as the
+// copy takes. The playback fields are left empty.
+func (m *Manager) State() PersistentState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state := PersistentState{
+		Items:        make([]QueueItem, len(m.items)),
+		Index:        m.index,
+		Shuffle:      m.shuffle,
+		ShuffleOrder: append([]int(nil), m.shuffleOrder...),
+		ShuffleMode:  m.shuffleKind.String(),
+	}
+	copy(state.Items, m.items)
+
+	switch m.repeat {
+	case RepeatOne:
+		state.Repeat = "one"
+	case RepeatAll:
+		state.Repeat = "all"
+	default:
+		state.Repeat = "off"
+	}
+	return state
+}
+
+// SetPosition records the playback position of a track. It is persisted
+// with the next Save.
+func (s *Store) SetPosition(path string, positionMs int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.positionPath = path
+	s.position = positionMs
+}
+
+// LastPosition returns the saved position for path, or 0 if the saved
+// position belongs to a different track
+func (s *Store) LastPosition(path string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if path == "" || path != s.positionPath {
+		return 0
+	}
+	return s.position
+}
+
+// SetPlaying records whether the current track is playing. It is persisted
+// with the next Save.
+func (s *Store) SetPlaying(playing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playing = playing
+}
+
+// WasPlaying reports whether the loaded state was saved mid-playback
+func (s *Store) WasPlaying() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.playing
 }
 
 // GetFilePath returns the path to the queue file
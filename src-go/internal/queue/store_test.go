@@ -172,3 +172,129 @@ func TestStoreSaveWithMetadata(t *testing.T) {
 		t.Error("Expected metadata to be preserved")
 	}
 }
+
+func TestStoreSavesLastPosition(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "queue_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3"})
+	m.Next()
+
+	store := NewStore(tmpDir, m)
+	store.SetPosition("/path/1.mp3", 42000)
+	if err := store.Save(); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	store2 := NewStore(tmpDir, NewManager())
+	if err := store2.Load(); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	if pos := store2.LastPosition("/path/1.mp3"); pos != 42000 {
+		t.Errorf("Expected position 42000, got %d", pos)
+	}
+	if pos := store2.LastPosition("/path/2.mp3"); pos != 0 {
+		t.Errorf("Expected no position for a different track, got %d", pos)
+	}
+}
+
+func TestStoreFlushWritesPendingSave(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3"})
+	store := NewStore(tmpDir, m)
+
+	store.SaveSoon()
+	m.Append([]string{"/path/2.mp3"})
+	store.SaveSoon()
+	if _, err := os.Stat(store.GetFilePath()); !os.IsNotExist(err) {
+		t.Fatalf("Expected the save to wait, got %v", err)
+	}
+
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	store2 := NewStore(tmpDir, NewManager())
+	if err := store2.Load(); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if _, size := store2.manager.Position(); size != 2 {
+		t.Errorf("Expected both tracks saved, got %d", size)
+	}
+
+	// Nothing but the queue file is left behind
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only queue.json, got %d files", len(entries))
+	}
+}
+
+func TestStoreRestoresState(t *testing.T) {
+	m := NewManager()
+	m.Set([]string{"/path/1.mp3", "/path/2.mp3"})
+	m.Next()
+	m.Next()
+	m.SetRepeat(RepeatOne)
+	state := m.State()
+	state.PositionPath = "/path/2.mp3"
+	state.Position = 4200
+
+	m2 := NewManager()
+	store := NewStoreAt(filepath.Join(t.TempDir(), "queue.json"), m2)
+	store.Restore(state)
+
+	if idx, size := m2.Position(); idx != 1 || size != 2 {
+		t.Errorf("Expected position 1 of 2, got %d of %d", idx, size)
+	}
+	if m2.GetRepeat() != RepeatOne {
+		t.Errorf("Expected repeat one, got %v", m2.GetRepeat())
+	}
+	if got := store.LastPosition("/path/2.mp3"); got != 4200 {
+		t.Errorf("Expected the position restored, got %d", got)
+	}
+}
+
+func TestRestoreRejectsPositionsOutsideQueue(t *testing.T) {
+	items := []QueueItem{{Path: "/path/1.mp3"}, {Path: "/path/2.mp3"}, {Path: "/path/3.mp3"}}
+	tests := []struct {
+		name      string
+		state     PersistentState
+		wantIndex int
+	}{
+		{"index past the end", PersistentState{Items: items, Index: 7}, -1},
+		{"negative index", PersistentState{Items: items, Index: -5}, -1},
+		{"index into an empty queue", PersistentState{Index: 2}, -1},
+		{"shuffle order too short", PersistentState{Items: items, Index: 2, Shuffle: true, ShuffleOrder: []int{0, 1}}, -1},
+		{"shuffle order out of range", PersistentState{Items: items, Index: 0, Shuffle: true, ShuffleOrder: []int{0, 9, 1}}, -1},
+		{"shuffle order repeats", PersistentState{Items: items, Index: 0, Shuffle: true, ShuffleOrder: []int{1, 1, 2}}, -1},
+		{"valid shuffle", PersistentState{Items: items, Index: 1, Shuffle: true, ShuffleOrder: []int{2, 0, 1}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			m.Restore(tt.state)
+			if idx, _ := m.Position(); idx != tt.wantIndex {
+				t.Errorf("Expected position %d, got %d", tt.wantIndex, idx)
+			}
+			// Moving through the queue must stay within it
+			m.Current()
+			for i := 0; i < 5; i++ {
+				m.Next()
+			}
+			m.Prev()
+			m.Current()
+			if tt.state.Shuffle && len(m.State().ShuffleOrder) != len(tt.state.Items) {
+				t.Errorf("Expected a shuffle order over the %d items, got %v", len(tt.state.Items), m.State().ShuffleOrder)
+			}
+		})
+	}
+}
@@ -0,0 +1,564 @@
+package render
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+)
+
+const (
+	castNamespaceConnection = "urn:x-cast:com.google.cast.tp.connection"
+	castNamespaceHeartbeat  = "urn:x-cast:com.google.cast.tp.heartbeat"
+	castNamespaceReceiver   = "urn:x-cast:com.google.cast.receiver"
+	castNamespaceMedia      = "urn:x-cast:com.google.cast.media"
+
+	castSenderID   = "sender-0"
+	castReceiverID = "receiver-0"
+
+	// The Default Media Receiver app, which plays a URL it is given
+	castMediaReceiverApp = "CC1AD845"
+
+	castHeartbeatInterval = 5 * time.Second
+	castDialTimeout       = 5 * time.Second
+	maxCastMessageSize    = 64 * 1024
+)
+
+var errCastClosed = errors.New("chromecast connection closed")
+
+// castMessage is the CastMessage protobuf every Cast V2 exchange is wrapped
+// in, limited to string payloads
+type castMessage struct {
+	source      string
+	destination string
+	namespace   string
+	payload     string
+}
+
+// marshal encodes the message as protobuf
+func (m castMessage) marshal() []byte {
+	b := []byte{0x08, 0x00} // protocol_version = CASTV2_1_0
+	b = appendProtoString(b, 2, m.source)
+	b = appendProtoString(b, 3, m.destination)
+	b = appendProtoString(b, 4, m.namespace)
+	b = append(b, 0x28, 0x00) // payload_type = STRING
+	return appendProtoString(b, 6, m.payload)
+}
+
+func appendProtoString(b []byte, field int, s string) []byte {
+	b = append(b, byte(field<<3|2))
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// unmarshalCastMessage decodes a CastMessage, skipping fields it doesn't use
+func unmarshalCastMessage(data []byte) (castMessage, error) {
+	var m castMessage
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return m, errors.New("bad field key")
+		}
+		data = data[n:]
+
+		switch key & 7 {
+		case 0: // varint
+			if _, n = binary.Uvarint(data); n <= 0 {
+				return m, errors.New("bad varint")
+			}
+			data = data[n:]
+		case 1: // 64-bit
+			if len(data) < 8 {
+				return m, io.ErrUnexpectedEOF
+			}
+			data = data[8:]
+		case 2: // length-delimited
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return m, io.ErrUnexpectedEOF
+			}
+			value := string(data[n : n+int(length)])
+			data = data[n+int(length):]
+			switch key >> 3 {
+			case 2:
+				m.source = value
+			case 3:
+				m.destination = value
+			case 4:
+				m.namespace = value
+			case 6:
+				m.payload = value
+			}
+		case 5: // 32-bit
+			if len(data) < 4 {
+				return m, io.ErrUnexpectedEOF
+			}
+			data = data[4:]
+		default:
+			return m, fmt.Errorf("unsupported wire type %d", key&7)
+		}
+	}
+	return m, nil
+}
+
+// castReply is the part of a Cast JSON message used to route it
+type castReply struct {
+	Type      string `json:"type"`
+	RequestID int    `json:"requestId"`
+}
+
+// castConn is a Cast V2 connection to a device
+type castConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan json.RawMessage
+	err     error
+	closed  chan struct{}
+}
+
+// dialCast connects to a Chromecast and opens a virtual connection to its
+// receiver
+func dialCast(ctx context.Context, host string, port int) (*castConn, error) {
+	// Cast devices present certificates from Google's device CA, which the
+	// system roots don't include
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: castDialTimeout},
+		Config:    &tls.Config{InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	c := &castConn{
+		conn:    conn,
+		pending: make(map[int]chan json.RawMessage),
+		closed:  make(chan struct{}),
+	}
+	go c.readLoop()
+	go c.heartbeat()
+
+	if err := c.send(castNamespaceConnection, castReceiverID, map[string]any{"type": "CONNECT"}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// send writes a JSON message without waiting for a reply
+func (c *castConn) send(namespace, destination string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	msg := castMessage{
+		source:      castSenderID,
+		destination: destination,
+		namespace:   namespace,
+		payload:     string(data),
+	}.marshal()
+
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(msg)))
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.conn.Write(append(frame, msg...)); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+// request sends a message with a new requestId and waits for the reply
+// carrying the same id
+func (c *castConn) request(ctx context.Context, namespace, destination string, payload map[string]any) (json.RawMessage, error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	reply := make(chan json.RawMessage, 1)
+	c.pending[id] = reply
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	payload["requestId"] = id
+	if err := c.send(namespace, destination, payload); err != nil {
+		return nil, err
+	}
+
+	select {
+	case data := <-reply:
+		return data, nil
+	case <-c.closed:
+		return nil, c.closeErr()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *castConn) readLoop() {
+	var err error
+	header := make([]byte, 4)
+	for {
+		if _, err = io.ReadFull(c.conn, header); err != nil {
+			break
+		}
+		size := binary.BigEndian.Uint32(header)
+		if size > maxCastMessageSize {
+			err = fmt.Errorf("message of %d bytes", size)
+			break
+		}
+		data := make([]byte, size)
+		if _, err = io.ReadFull(c.conn, data); err != nil {
+			break
+		}
+
+		msg, decodeErr := unmarshalCastMessage(data)
+		if decodeErr != nil {
+			continue
+		}
+		var reply castReply
+		if json.Unmarshal([]byte(msg.payload), &reply) != nil {
+			continue
+		}
+
+		switch {
+		case msg.namespace == castNamespaceHeartbeat && reply.Type == "PING":
+			c.send(castNamespaceHeartbeat, msg.source, map[string]any{"type": "PONG"})
+		case reply.RequestID != 0:
+			c.mu.Lock()
+			ch, ok := c.pending[reply.RequestID]
+			c.mu.Unlock()
+			if ok {
+				// A request takes the first reply; repeats are dropped
+				select {
+				case ch <- json.RawMessage(msg.payload):
+				default:
+				}
+			}
+		}
+	}
+	c.fail(err)
+}
+
+func (c *castConn) heartbeat() {
+	ticker := time.NewTicker(castHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			if err := c.send(castNamespaceHeartbeat, castReceiverID, map[string]any{"type": "PING"}); err != nil {
+				c.fail(err)
+				return
+			}
+		}
+	}
+}
+
+// fail closes the connection with err as the reason
+func (c *castConn) fail(err error) {
+	if err == nil || errors.Is(err, net.ErrClosed) {
+		err = errCastClosed
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.closed)
+	c.conn.Close()
+}
+
+func (c *castConn) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close ends the connection
+func (c *castConn) Close() error {
+	c.send(castNamespaceConnection, castReceiverID, map[string]any{"type": "CLOSE"})
+	c.fail(errCastClosed)
+	return nil
+}
+
+// castReceiverStatus is a RECEIVER_STATUS reply
+type castReceiverStatus struct {
+	Type   string `json:"type"`
+	Status struct {
+		Applications []struct {
+			AppID       string `json:"appId"`
+			SessionID   string `json:"sessionId"`
+			TransportID string `json:"transportId"`
+		} `json:"applications"`
+	} `json:"status"`
+}
+
+// castMediaStatus is a MEDIA_STATUS reply
+type castMediaStatus struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"` // Set on LOAD_FAILED and INVALID_REQUEST
+	Status []struct {
+		MediaSessionID int     `json:"mediaSessionId"`
+		PlayerState    string  `json:"playerState"`
+		IdleReason     string  `json:"idleReason"`
+		CurrentTime    float64 `json:"currentTime"`
+		Media          *struct {
+			Duration float64 `json:"duration"`
+		} `json:"media"`
+	} `json:"status"`
+}
+
+// castRenderer plays through the Default Media Receiver on a Chromecast
+type castRenderer struct {
+	device Device
+	server *MediaServer
+	conn   *castConn
+
+	mu             sync.Mutex
+	transportID    string // Virtual connection id of the running receiver app
+	mediaSessionID int
+}
+
+func openCast(ctx context.Context, d Device, server *MediaServer) (*castRenderer, error) {
+	conn, err := dialCast(ctx, d.Host, d.Port)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", d.Name, err)
+	}
+	return &castRenderer{device: d, server: server, conn: conn}, nil
+}
+
+// launch starts the Default Media Receiver unless it is already running, and
+// connects to it
+func (r *castRenderer) launch(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	transportID := r.transportID
+	r.mu.Unlock()
+	if transportID != "" {
+		return transportID, nil
+	}
+
+	data, err := r.conn.request(ctx, castNamespaceReceiver, castReceiverID, map[string]any{"type": "GET_STATUS"})
+	if err != nil {
+		return "", err
+	}
+	transportID = mediaReceiverTransport(data)
+	if transportID == "" {
+		data, err = r.conn.request(ctx, castNamespaceReceiver, castReceiverID, map[string]any{
+			"type":  "LAUNCH",
+			"appId": castMediaReceiverApp,
+		})
+		if err != nil {
+			return "", err
+		}
+		if transportID = mediaReceiverTransport(data); transportID == "" {
+			return "", errors.New("media receiver did not start")
+		}
+	}
+
+	if err := r.conn.send(castNamespaceConnection, transportID, map[string]any{"type": "CONNECT"}); err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.transportID = transportID
+	r.mu.Unlock()
+	return transportID, nil
+}
+
+// mediaReceiverTransport returns the transport id of the Default Media
+// Receiver in a RECEIVER_STATUS reply, or "" if it isn't running
+func mediaReceiverTransport(data json.RawMessage) string {
+	var status castReceiverStatus
+	if json.Unmarshal(data, &status) != nil {
+		return ""
+	}
+	for _, app := range status.Status.Applications {
+		if app.AppID == castMediaReceiverApp {
+			return app.TransportID
+		}
+	}
+	return ""
+}
+
+func (r *castRenderer) Load(ctx context.Context, path string, metadata *audio.TrackMetadata, startMs int64, paused bool) error {
+	transportID, err := r.launch(ctx)
+	if err != nil {
+		return err
+	}
+	mediaURL, contentType, err := r.server.Publish(path, r.device)
+	if err != nil {
+		return err
+	}
+
+	info := map[string]any{
+		"contentId":   mediaURL,
+		"contentType": contentType,
+		"streamType":  "BUFFERED",
+	}
+	if audio.IsStreamURL(path) && (metadata == nil || metadata.Duration <= 0) {
+		info["streamType"] = "LIVE"
+	}
+	if metadata != nil {
+		info["metadata"] = map[string]any{
+			"metadataType": 3, // MusicTrackMediaMetadata
+			"title":        metadata.Title,
+			"artist":       metadata.Artist,
+			"albumName":    metadata.Album,
+		}
+	}
+	data, err := r.conn.request(ctx, castNamespaceMedia, transportID, map[string]any{
+		"type":        "LOAD",
+		"media":       info,
+		"autoplay":    !paused,
+		"currentTime": float64(startMs) / 1000,
+	})
+	if err != nil {
+		r.forgetApp(err)
+		return err
+	}
+
+	status, err := parseMediaStatus(data)
+	if err != nil {
+		return err
+	}
+	if len(status.Status) == 0 {
+		return errors.New("no media session after load")
+	}
+	r.mu.Lock()
+	r.mediaSessionID = status.Status[0].MediaSessionID
+	r.mu.Unlock()
+	return nil
+}
+
+// mediaCommand sends a command for the loaded media and returns its status
+func (r *castRenderer) mediaCommand(ctx context.Context, command string) (*castMediaStatus, error) {
+	r.mu.Lock()
+	transportID, sessionID := r.transportID, r.mediaSessionID
+	r.mu.Unlock()
+	if transportID == "" || sessionID == 0 {
+		return &castMediaStatus{}, nil
+	}
+
+	data, err := r.conn.request(ctx, castNamespaceMedia, transportID, map[string]any{
+		"type":           command,
+		"mediaSessionId": sessionID,
+	})
+	if err != nil {
+		r.forgetApp(err)
+		return nil, err
+	}
+	return parseMediaStatus(data)
+}
+
+// forgetApp drops the receiver app's connection after a request to it timed
+// out, as the app may have been closed from another sender; the next load
+// looks it up again
+func (r *castRenderer) forgetApp(err error) {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	r.mu.Lock()
+	r.transportID = ""
+	r.mediaSessionID = 0
+	r.mu.Unlock()
+}
+
+func parseMediaStatus(data json.RawMessage) (*castMediaStatus, error) {
+	var status castMediaStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("bad media status: %w", err)
+	}
+	if status.Type != "MEDIA_STATUS" {
+		if status.Reason != "" {
+			return nil, fmt.Errorf("%s: %s", status.Type, status.Reason)
+		}
+		return nil, errors.New(status.Type)
+	}
+	return &status, nil
+}
+
+func (r *castRenderer) Play(ctx context.Context) error {
+	_, err := r.mediaCommand(ctx, "PLAY")
+	return err
+}
+
+func (r *castRenderer) Pause(ctx context.Context) error {
+	_, err := r.mediaCommand(ctx, "PAUSE")
+	return err
+}
+
+func (r *castRenderer) Stop(ctx context.Context) error {
+	_, err := r.mediaCommand(ctx, "STOP")
+	r.mu.Lock()
+	r.mediaSessionID = 0
+	r.mu.Unlock()
+	return err
+}
+
+func (r *castRenderer) SetVolume(ctx context.Context, volume float64) error {
+	_, err := r.conn.request(ctx, castNamespaceReceiver, castReceiverID, map[string]any{
+		"type":   "SET_VOLUME",
+		"volume": map[string]any{"level": volume},
+	})
+	return err
+}
+
+func (r *castRenderer) Status(ctx context.Context) (audio.RemoteStatus, error) {
+	status, err := r.mediaCommand(ctx, "GET_STATUS")
+	if err != nil {
+		return audio.RemoteStatus{}, err
+	}
+
+	// An empty status means the media session has ended
+	result := audio.RemoteStatus{State: audio.StateStopped}
+	if len(status.Status) == 0 {
+		return result, nil
+	}
+	s := status.Status[0]
+	result.Position = int64(math.Round(s.CurrentTime * 1000))
+	if s.Media != nil {
+		result.Duration = int64(math.Round(s.Media.Duration * 1000))
+	}
+	switch s.PlayerState {
+	case "PLAYING", "BUFFERING":
+		result.State = audio.StatePlaying
+	case "PAUSED":
+		result.State = audio.StatePaused
+	default:
+		if s.IdleReason == "ERROR" {
+			log.Printf("[RENDER] %s stopped with an error", r.device.Name)
+		}
+	}
+	return result, nil
+}
+
+// Close stops playback and disconnects
+func (r *castRenderer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	r.Stop(ctx)
+	return r.conn.Close()
+}
@@ -0,0 +1,27 @@
+package render
+
+import "testing"
+
+func TestCastMessageRoundTrip(t *testing.T) {
+	msg := castMessage{
+		source:      "sender-0",
+		destination: "receiver-0",
+		namespace:   "urn:x-cast:com.google.cast.tp.heartbeat",
+		payload:     `{"type":"PING"}`,
+	}
+
+	got, err := unmarshalCastMessage(msg.marshal())
+	if err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if got != msg {
+		t.Errorf("Expected %+v, got %+v", msg, got)
+	}
+}
+
+func TestUnmarshalCastMessageRejectsTruncated(t *testing.T) {
+	data := castMessage{namespace: "urn:x-cast:test", payload: "{}"}.marshal()
+	if _, err := unmarshalCastMessage(data[:len(data)-1]); err == nil {
+		t.Error("Expected an error for a truncated message")
+	}
+}
@@ -0,0 +1,258 @@
+package render
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	mdnsAddr = "224.0.0.251:5353"
+
+	castService = "_googlecast._tcp.local"
+
+	// Port Chromecasts listen on if the SRV record is missing
+	defaultCastPort = 8009
+
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsClassIN = 1
+
+	// Asks responders to answer by unicast (RFC 6762 section 5.4)
+	dnsUnicastResponse = 0x8000
+)
+
+var errBadDNSMessage = errors.New("malformed DNS message")
+
+// mdnsRecords gathers the records from every response to a query
+type mdnsRecords struct {
+	instances []string             // PTR targets, in the order first seen
+	srv       map[string]srvRecord // Instance -> SRV
+	txt       map[string]map[string]string
+	addrs     map[string]net.IP // Host name -> IPv4 address
+	sources   map[string]net.IP // Instance -> address the answer came from
+}
+
+type srvRecord struct {
+	target string
+	port   int
+}
+
+func newMDNSRecords() *mdnsRecords {
+	return &mdnsRecords{
+		srv:     make(map[string]srvRecord),
+		txt:     make(map[string]map[string]string),
+		addrs:   make(map[string]net.IP),
+		sources: make(map[string]net.IP),
+	}
+}
+
+// discoverCast asks for Chromecasts by mDNS and collects answers until ctx
+// is done
+func discoverCast(ctx context.Context) ([]Device, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	defer conn.Close()
+
+	dst, err := net.ResolveUDPAddr("udp4", mdnsAddr)
+	if err != nil {
+		return nil, err
+	}
+	query := buildMDNSQuery(castService, dnsTypePTR)
+	for i := 0; i < 2; i++ {
+		if _, err := conn.WriteToUDP(query, dst); err != nil {
+			return nil, fmt.Errorf("send query: %w", err)
+		}
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultDiscoveryTimeout)
+	}
+	conn.SetReadDeadline(deadline)
+
+	records := newMDNSRecords()
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		// Other services' traffic and garbled packets are ignored
+		records.parse(buf[:n], from.IP)
+	}
+	return records.castDevices(), nil
+}
+
+// buildMDNSQuery returns a query for one name and record type
+func buildMDNSQuery(name string, qtype uint16) []byte {
+	msg := make([]byte, 12, 64)
+	binary.BigEndian.PutUint16(msg[4:], 1) // One question
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	return binary.BigEndian.AppendUint16(msg, dnsClassIN|dnsUnicastResponse)
+}
+
+// parse adds the answers and additional records of a response
+func (r *mdnsRecords) parse(msg []byte, from net.IP) error {
+	if len(msg) < 12 {
+		return errBadDNSMessage
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	records := int(binary.BigEndian.Uint16(msg[6:])) +
+		int(binary.BigEndian.Uint16(msg[8:])) +
+		int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := readDNSName(msg, off)
+		if err != nil || next+4 > len(msg) {
+			return errBadDNSMessage
+		}
+		off = next + 4
+	}
+
+	for i := 0; i < records; i++ {
+		name, next, err := readDNSName(msg, off)
+		if err != nil || next+10 > len(msg) {
+			return errBadDNSMessage
+		}
+		rtype := binary.BigEndian.Uint16(msg[next:])
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		start := next + 10
+		end := start + length
+		if end > len(msg) {
+			return errBadDNSMessage
+		}
+		off = end
+		name = strings.ToLower(name)
+
+		switch rtype {
+		case dnsTypePTR:
+			if name != castService {
+				continue
+			}
+			instance, _, err := readDNSName(msg, start)
+			if err != nil {
+				return err
+			}
+			if _, ok := r.sources[instance]; !ok {
+				r.instances = append(r.instances, instance)
+			}
+			r.sources[instance] = from
+		case dnsTypeSRV:
+			if length < 7 {
+				return errBadDNSMessage
+			}
+			target, _, err := readDNSName(msg, start+6)
+			if err != nil {
+				return err
+			}
+			r.srv[name] = srvRecord{
+				target: strings.ToLower(target),
+				port:   int(binary.BigEndian.Uint16(msg[start+4:])),
+			}
+		case dnsTypeTXT:
+			r.txt[name] = parseTXT(msg[start:end])
+		case dnsTypeA:
+			if length == 4 {
+				r.addrs[name] = net.IPv4(msg[start], msg[start+1], msg[start+2], msg[start+3])
+			}
+		}
+	}
+	return nil
+}
+
+// castDevices turns the gathered records into devices
+func (r *mdnsRecords) castDevices() []Device {
+	var devices []Device
+	for _, instance := range r.instances {
+		key := strings.ToLower(instance)
+		txt := r.txt[key]
+		d := Device{
+			ID:    txt["id"],
+			Name:  txt["fn"],
+			Kind:  KindChromecast,
+			Host:  r.sources[instance].String(),
+			Port:  defaultCastPort,
+			Model: txt["md"],
+		}
+		if srv, ok := r.srv[key]; ok {
+			d.Port = srv.port
+			if ip, ok := r.addrs[srv.target]; ok {
+				d.Host = ip.String()
+			}
+		}
+		if d.ID == "" {
+			d.ID = instance
+		}
+		if d.Name == "" {
+			d.Name = strings.TrimSuffix(instance, "."+castService)
+		}
+		devices = append(devices, d)
+	}
+	return devices
+}
+
+// readDNSName reads a possibly compressed name at off and returns it with the
+// offset just past it
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errBadDNSMessage
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case length&0xC0 == 0xC0:
+			if off+1 >= len(msg) || jumps > 16 {
+				return "", 0, errBadDNSMessage
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+			jumps++
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, errBadDNSMessage
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+// parseTXT splits TXT record strings into key=value pairs
+func parseTXT(data []byte) map[string]string {
+	values := make(map[string]string)
+	for len(data) > 0 {
+		n := int(data[0])
+		if 1+n > len(data) {
+			break
+		}
+		if key, value, ok := strings.Cut(string(data[1:1+n]), "="); ok {
+			values[strings.ToLower(key)] = value
+		}
+		data = data[1+n:]
+	}
+	return values
+}
@@ -0,0 +1,80 @@
+package render
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// appendName appends an uncompressed DNS name
+func appendName(b []byte, name string) []byte {
+	q := buildMDNSQuery(name, 0)
+	return append(b, q[12:len(q)-4]...)
+}
+
+// appendRecord appends a resource record with the given data
+func appendRecord(b []byte, name string, rtype uint16, data []byte) []byte {
+	b = appendName(b, name)
+	b = binary.BigEndian.AppendUint16(b, rtype)
+	b = binary.BigEndian.AppendUint16(b, dnsClassIN)
+	b = binary.BigEndian.AppendUint32(b, 120)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+func TestMDNSRecordsCastDevices(t *testing.T) {
+	instance := "Chromecast-abc123." + castService
+
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[6:], 1)  // One answer
+	binary.BigEndian.PutUint16(msg[10:], 3) // Three additional records
+	msg = appendRecord(msg, castService, dnsTypePTR, appendName(nil, instance))
+
+	srv := []byte{0, 0, 0, 0, 0x1F, 0x4A} // Priority, weight, port 8010
+	msg = appendRecord(msg, instance, dnsTypeSRV, appendName(srv, "abc123.local"))
+
+	var txt []byte
+	for _, s := range []string{"id=abc123", "md=Chromecast Audio", "fn=Kitchen"} {
+		txt = append(txt, byte(len(s)))
+		txt = append(txt, s...)
+	}
+	msg = appendRecord(msg, instance, dnsTypeTXT, txt)
+	msg = appendRecord(msg, "abc123.local", dnsTypeA, []byte{192, 168, 1, 40})
+
+	records := newMDNSRecords()
+	if err := records.parse(msg, net.IPv4(192, 168, 1, 99)); err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	devices := records.castDevices()
+	if len(devices) != 1 {
+		t.Fatalf("Expected 1 device, got %d", len(devices))
+	}
+	want := Device{ID: "abc123", Name: "Kitchen", Kind: KindChromecast, Host: "192.168.1.40", Port: 8010, Model: "Chromecast Audio"}
+	if devices[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, devices[0])
+	}
+}
+
+func TestReadDNSNameFollowsPointers(t *testing.T) {
+	msg := appendName(make([]byte, 12), "tv.local")
+	msg = append(msg, 3, 'f', 'o', 'o', 0xC0, 12) // "foo" + pointer to offset 12
+
+	name, next, err := readDNSName(msg, len(msg)-6)
+	if err != nil {
+		t.Fatalf("readDNSName failed: %v", err)
+	}
+	if name != "foo.tv.local" {
+		t.Errorf("Expected foo.tv.local, got %q", name)
+	}
+	if next != len(msg) {
+		t.Errorf("Expected next offset %d, got %d", len(msg), next)
+	}
+}
+
+func TestReadDNSNameRejectsPointerLoop(t *testing.T) {
+	msg := append(make([]byte, 12), 0xC0, 12)
+	if _, _, err := readDNSName(msg, 12); err == nil {
+		t.Error("Expected an error for a pointer loop")
+	}
+}
@@ -0,0 +1,147 @@
+// Package render finds Chromecast and UPnP/DLNA MediaRenderer devices on the
+// LAN and plays tracks on them. The devices fetch tracks over HTTP from a
+// media server in the daemon.
+package render
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/transcode"
+)
+
+// Kinds of renderer
+const (
+	KindChromecast = "chromecast"
+	KindUPnP       = "upnp"
+)
+
+// DefaultDiscoveryTimeout is how long Discover listens for devices
+const DefaultDiscoveryTimeout = 3 * time.Second
+
+// ErrUnknownRenderer is returned by Open for a device that hasn't been
+// discovered
+var ErrUnknownRenderer = errors.New("unknown renderer")
+
+// Device is a renderer found on the LAN
+type Device struct {
+	ID    string // Stable across discoveries: the UPnP UDN or Chromecast id
+	Name  string // Friendly name shown by the device
+	Kind  string
+	Host  string // IP address
+	Port  int    // Chromecast control port
+	Model string
+	upnp  *upnpDevice
+}
+
+// Manager discovers renderers and opens them for playback
+type Manager struct {
+	server *MediaServer
+
+	mu      sync.Mutex
+	devices map[string]Device
+}
+
+// NewManager creates a renderer manager
+func NewManager() *Manager {
+	return &Manager{
+		server:  NewMediaServer(),
+		devices: make(map[string]Device),
+	}
+}
+
+// Discover searches the LAN for renderers for up to timeout and returns
+// everything found, sorted by name. Devices found earlier that didn't answer
+// this time are forgotten.
+func (m *Manager) Discover(ctx context.Context, timeout time.Duration) ([]Device, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var upnpDevices, castDevices []Device
+	var upnpErr, castErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		upnpDevices, upnpErr = discoverUPnP(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		castDevices, castErr = discoverCast(ctx)
+	}()
+	wg.Wait()
+
+	if upnpErr != nil {
+		log.Printf("[RENDER] UPnP discovery failed: %v", upnpErr)
+	}
+	if castErr != nil {
+		log.Printf("[RENDER] Chromecast discovery failed: %v", castErr)
+	}
+	if upnpErr != nil && castErr != nil {
+		return nil, errors.Join(upnpErr, castErr)
+	}
+
+	devices := append(upnpDevices, castDevices...)
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Name != devices[j].Name {
+			return devices[i].Name < devices[j].Name
+		}
+		return devices[i].ID < devices[j].ID
+	})
+
+	m.mu.Lock()
+	m.devices = make(map[string]Device, len(devices))
+	for _, d := range devices {
+		m.devices[d.ID] = d
+	}
+	m.mu.Unlock()
+
+	return devices, nil
+}
+
+// Devices returns the renderers found by the last Discover
+func (m *Manager) Devices() []Device {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	devices := make([]Device, 0, len(m.devices))
+	for _, d := range m.devices {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	return devices
+}
+
+// Open connects to a discovered renderer for playback
+func (m *Manager) Open(ctx context.Context, id string) (audio.Renderer, error) {
+	m.mu.Lock()
+	d, ok := m.devices[id]
+	m.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownRenderer
+	}
+
+	switch d.Kind {
+	case KindUPnP:
+		return newUPnPRenderer(d, m.server), nil
+	case KindChromecast:
+		return openCast(ctx, d, m.server)
+	}
+	return nil, ErrUnknownRenderer
+}
+
+// SetTranscoder has tracks converted before renderers fetch them, as
+// profileFor says for each renderer by ID
+func (m *Manager) SetTranscoder(t *transcode.Transcoder, profileFor func(rendererID string) transcode.Profile) {
+	m.server.SetTranscoder(t, profileFor)
+}
+
+// Close stops the media server
+func (m *Manager) Close() error {
+	return m.server.Close()
+}
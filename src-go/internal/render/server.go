@@ -0,0 +1,250 @@
+package render
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+	"github.com/austinkregel/local-media/musicd/internal/transcode"
+)
+
+// maxPublished is how many tracks stay reachable at once; older URLs stop
+// working so a renderer can't keep pulling files it was given long ago
+const maxPublished = 16
+
+// audioTypes covers extensions mime.TypeByExtension doesn't know on every
+// platform
+var audioTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".wma":  "audio/x-ms-wma",
+	".aiff": "audio/aiff",
+	".aif":  "audio/aiff",
+}
+
+// MediaServer serves tracks over HTTP to renderers on the LAN. Only tracks
+// that were published are reachable, each under a random token.
+type MediaServer struct {
+	mu        sync.Mutex
+	listener  net.Listener
+	server    *http.Server
+	published map[string]publishedTrack // Token -> track
+	order     []string                  // Tokens, oldest first
+
+	transcoder *transcode.Transcoder
+	profileFor func(rendererID string) transcode.Profile
+}
+
+// publishedTrack is a track a renderer may fetch
+type publishedTrack struct {
+	path      string
+	transcode *transcode.Profile // Set when the track is converted first
+}
+
+// NewMediaServer creates a media server. It starts listening when the first
+// track is published.
+func NewMediaServer() *MediaServer {
+	return &MediaServer{published: make(map[string]publishedTrack)}
+}
+
+// SetTranscoder has tracks converted before they are served, as profileFor
+// says for the renderer fetching them
+func (s *MediaServer) SetTranscoder(t *transcode.Transcoder, profileFor func(rendererID string) transcode.Profile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transcoder, s.profileFor = t, profileFor
+}
+
+// Publish makes path reachable by renderer d and returns its URL and content
+// type. The URL uses the local address that routes to the renderer.
+func (s *MediaServer) Publish(path string, d Device) (string, string, error) {
+	// Renderers fetch internet streams themselves
+	if audio.IsStreamURL(path) {
+		return path, MimeType(path), nil
+	}
+
+	host, err := localAddrFor(d.Host)
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.startLocked(); err != nil {
+		return "", "", err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", "", err
+	}
+	track := publishedTrack{path: path}
+	ext, contentType := strings.ToLower(filepath.Ext(path)), MimeType(path)
+	if s.transcoder != nil && s.profileFor != nil {
+		if profile := s.profileFor(d.ID); profile.Applies(path) {
+			track.transcode = &profile
+			ext, contentType = profile.Ext(), profile.ContentType()
+			// Start converting now so the track is ready sooner when the
+			// renderer asks for it
+			go func() {
+				if _, err := s.transcoder.Get(context.Background(), path, profile); err != nil {
+					log.Printf("[RENDER] Failed to convert %s: %v", path, err)
+				}
+			}()
+		}
+	}
+	s.published[token] = track
+	s.order = append(s.order, token)
+	for len(s.order) > maxPublished {
+		delete(s.published, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	port := s.listener.Addr().(*net.TCPAddr).Port
+	return fmt.Sprintf("http://%s/media/%s%s", net.JoinHostPort(host, strconv.Itoa(port)), token, ext), contentType, nil
+}
+
+// Close stops serving
+func (s *MediaServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server == nil {
+		return nil
+	}
+	err := s.server.Close()
+	s.server, s.listener = nil, nil
+	return err
+}
+
+// startLocked starts listening on all interfaces (must be called with lock
+// held)
+func (s *MediaServer) startLocked() error {
+	if s.server != nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/media/", s.handleMedia)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.listener, s.server = listener, server
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[RENDER] Media server stopped: %v", err)
+		}
+	}()
+	log.Printf("[RENDER] Serving media on port %d", listener.Addr().(*net.TCPAddr).Port)
+	return nil
+}
+
+func (s *MediaServer) handleMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The token is followed by the file's extension, which some renderers
+	// use to pick a decoder
+	name := strings.TrimPrefix(r.URL.Path, "/media/")
+	token := strings.TrimSuffix(name, filepath.Ext(name))
+	s.mu.Lock()
+	track, ok := s.published[token]
+	transcoder := s.transcoder
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	path, contentType := track.path, MimeType(track.path)
+	if track.transcode != nil && transcoder != nil {
+		converted, err := transcoder.Get(r.Context(), track.path, *track.transcode)
+		if err != nil {
+			log.Printf("[RENDER] Failed to convert %s: %v", track.path, err)
+			http.Error(w, "conversion failed", http.StatusInternalServerError)
+			return
+		}
+		path, contentType = converted, track.transcode.ContentType()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("[RENDER] Failed to open %s: %v", path, err)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "stat failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	// DLNA renderers expect these before they will stream and seek
+	w.Header().Set("transferMode.dlna.org", "Streaming")
+	w.Header().Set("contentFeatures.dlna.org", dlnaFeatures)
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// MimeType returns the content type for an audio file
+func MimeType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if t, ok := audioTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	// Most internet radio is MP3 behind an extensionless URL
+	if audio.IsStreamURL(path) {
+		return "audio/mpeg"
+	}
+	return "application/octet-stream"
+}
+
+// localAddrFor returns the local IP address used to reach host
+func localAddrFor(host string) (string, error) {
+	// A UDP "connection" only picks a route, nothing is sent
+	conn, err := net.Dial("udp", net.JoinHostPort(host, "9"))
+	if err != nil {
+		return "", fmt.Errorf("no route to %s: %w", host, err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
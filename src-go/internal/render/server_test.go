@@ -0,0 +1,111 @@
+package render
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/austinkregel/local-media/musicd/internal/transcode"
+)
+
+func TestMediaServerServesOnlyPublishedTracks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.flac")
+	if err := os.WriteFile(path, []byte("fLaC data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewMediaServer()
+	defer s.Close()
+	url, _, err := s.Publish(path, Device{Host: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "fLaC data" {
+		t.Errorf("Expected the track, got %d %q", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "audio/flac" {
+		t.Errorf("Expected audio/flac, got %q", ct)
+	}
+
+	unknown := url[:strings.Index(url, "/media/")] + "/media/" + strings.Repeat("0", 32) + ".flac"
+	resp, err = http.Get(unknown)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown token, got %d", resp.StatusCode)
+	}
+}
+
+func TestMediaServerTranscodes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg is a shell script")
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\nfor a; do out=\"$a\"; done\necho converted > \"$out\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	dir := t.TempDir()
+	flac := filepath.Join(dir, "track.flac")
+	mp3 := filepath.Join(dir, "track.mp3")
+	for _, path := range []string{flac, mp3} {
+		if err := os.WriteFile(path, []byte("original"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	transcoder, err := transcode.New(filepath.Join(dir, "cache"), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewMediaServer()
+	defer s.Close()
+	s.SetTranscoder(transcoder, func(rendererID string) transcode.Profile {
+		if rendererID == "slow" {
+			return transcode.Profile{Format: "opus", BitrateKbps: 96}
+		}
+		return transcode.Profile{}
+	})
+
+	cases := []struct {
+		path, renderer, ext, contentType, body string
+	}{
+		{flac, "slow", ".opus", "audio/ogg", "converted\n"},
+		{mp3, "slow", ".mp3", "audio/mpeg", "original"},
+		{flac, "fast", ".flac", "audio/flac", "original"},
+	}
+	for _, c := range cases {
+		url, contentType, err := s.Publish(c.path, Device{ID: c.renderer, Host: "127.0.0.1"})
+		if err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+		if !strings.HasSuffix(url, c.ext) || contentType != c.contentType {
+			t.Errorf("%s for %s: expected %s as %s, got %s as %s", filepath.Base(c.path), c.renderer, c.ext, c.contentType, url, contentType)
+		}
+
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != c.body || resp.Header.Get("Content-Type") != c.contentType {
+			t.Errorf("%s for %s: expected %q as %s, got %q as %s", filepath.Base(c.path), c.renderer, c.body, c.contentType, body, resp.Header.Get("Content-Type"))
+		}
+	}
+}
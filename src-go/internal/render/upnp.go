@@ -0,0 +1,486 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/austinkregel/local-media/musicd/internal/audio"
+)
+
+const (
+	ssdpAddr = "239.255.255.250:1900"
+
+	mediaRendererType    = "urn:schemas-upnp-org:device:MediaRenderer:1"
+	avTransportType      = "urn:schemas-upnp-org:service:AVTransport:1"
+	renderingControlType = "urn:schemas-upnp-org:service:RenderingControl:1"
+
+	// Streaming, seekable by byte range
+	dlnaFeatures = "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+
+	// Renderers answer an M-SEARCH within MX seconds
+	ssdpMX = 2
+
+	// Time kept back from the discovery timeout to fetch device descriptions
+	descriptionFetchTime = 500 * time.Millisecond
+
+	// How long to keep retrying a seek while the renderer is still loading
+	upnpSeekRetryTime = 3 * time.Second
+)
+
+// upnpDevice holds the control endpoints of a MediaRenderer
+type upnpDevice struct {
+	avTransportURL      string
+	renderingControlURL string // Empty if the device has no volume control
+}
+
+// deviceDescription is the part of a UPnP device description we use
+type deviceDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  descDevice `xml:"device"`
+}
+
+type descDevice struct {
+	DeviceType   string        `xml:"deviceType"`
+	FriendlyName string        `xml:"friendlyName"`
+	ModelName    string        `xml:"modelName"`
+	UDN          string        `xml:"UDN"`
+	Services     []descService `xml:"serviceList>service"`
+	Devices      []descDevice  `xml:"deviceList>device"`
+}
+
+type descService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+// discoverUPnP sends an SSDP search for MediaRenderers and reads their
+// descriptions until ctx is done
+func discoverUPnP(ctx context.Context) ([]Device, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	defer conn.Close()
+
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return nil, err
+	}
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: " + strconv.Itoa(ssdpMX) + "\r\n" +
+		"ST: " + mediaRendererType + "\r\n\r\n"
+	// Sent twice as UDP may be dropped
+	for i := 0; i < 2; i++ {
+		if _, err := conn.WriteToUDP([]byte(search), dst); err != nil {
+			return nil, fmt.Errorf("send search: %w", err)
+		}
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultDiscoveryTimeout)
+	}
+	conn.SetReadDeadline(deadline.Add(-descriptionFetchTime))
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		devices []Device
+		seen    = make(map[string]bool)
+	)
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		location, ok := parseSSDPResponse(buf[:n])
+		if !ok || seen[location] {
+			continue
+		}
+		seen[location] = true
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, err := fetchDescription(ctx, location)
+			if err != nil {
+				log.Printf("[RENDER] Skipping UPnP device at %s: %v", location, err)
+				return
+			}
+			mu.Lock()
+			devices = append(devices, d)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return devices, nil
+}
+
+// parseSSDPResponse returns the description URL from a search response
+func parseSSDPResponse(data []byte) (string, bool) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return "", false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false
+	}
+	location := resp.Header.Get("Location")
+	return location, location != ""
+}
+
+// fetchDescription downloads and parses a device description
+func fetchDescription(ctx context.Context, location string) (Device, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return Device{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Device{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Device{}, fmt.Errorf("description: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Device{}, err
+	}
+	return parseDescription(data, location)
+}
+
+// parseDescription finds the MediaRenderer in a device description, which
+// may be the root device or one embedded in it
+func parseDescription(data []byte, location string) (Device, error) {
+	var desc deviceDescription
+	if err := xml.Unmarshal(data, &desc); err != nil {
+		return Device{}, fmt.Errorf("parse description: %w", err)
+	}
+
+	base := location
+	if desc.URLBase != "" {
+		base = desc.URLBase
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return Device{}, fmt.Errorf("bad base URL: %w", err)
+	}
+
+	dev := findRenderer(desc.Device)
+	if dev == nil {
+		return Device{}, errors.New("no AVTransport service")
+	}
+
+	d := Device{
+		ID:    dev.UDN,
+		Name:  dev.FriendlyName,
+		Kind:  KindUPnP,
+		Host:  baseURL.Hostname(),
+		Model: dev.ModelName,
+		upnp:  &upnpDevice{},
+	}
+	if d.Name == "" {
+		d.Name = d.Host
+	}
+	for _, svc := range dev.Services {
+		control, err := baseURL.Parse(strings.TrimSpace(svc.ControlURL))
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(svc.ServiceType, "urn:schemas-upnp-org:service:AVTransport:"):
+			d.upnp.avTransportURL = control.String()
+		case strings.HasPrefix(svc.ServiceType, "urn:schemas-upnp-org:service:RenderingControl:"):
+			d.upnp.renderingControlURL = control.String()
+		}
+	}
+	if d.ID == "" {
+		d.ID = d.upnp.avTransportURL
+	}
+	return d, nil
+}
+
+// findRenderer returns the first device in the tree with an AVTransport
+// service
+func findRenderer(dev descDevice) *descDevice {
+	for _, svc := range dev.Services {
+		if strings.HasPrefix(svc.ServiceType, "urn:schemas-upnp-org:service:AVTransport:") {
+			return &dev
+		}
+	}
+	for _, child := range dev.Devices {
+		if found := findRenderer(child); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// upnpRenderer plays on a UPnP MediaRenderer through its AVTransport and
+// RenderingControl services
+type upnpRenderer struct {
+	device Device
+	server *MediaServer
+	client *http.Client
+}
+
+func newUPnPRenderer(d Device, server *MediaServer) *upnpRenderer {
+	return &upnpRenderer{
+		device: d,
+		server: server,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (r *upnpRenderer) Load(ctx context.Context, path string, metadata *audio.TrackMetadata, startMs int64, paused bool) error {
+	mediaURL, contentType, err := r.server.Publish(path, r.device)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.transport(ctx, "SetAVTransportURI", soapArgs{
+		{"InstanceID", "0"},
+		{"CurrentURI", mediaURL},
+		{"CurrentURIMetaData", didlMetadata(mediaURL, contentType, metadata)},
+	}); err != nil {
+		return err
+	}
+	if err := r.Play(ctx); err != nil {
+		return err
+	}
+
+	if startMs > 0 {
+		r.seek(ctx, startMs)
+	}
+	if paused {
+		return r.Pause(ctx)
+	}
+	return nil
+}
+
+// seek moves to startMs, retrying while the renderer is still loading the
+// track. A renderer that can't seek plays from the start.
+func (r *upnpRenderer) seek(ctx context.Context, startMs int64) {
+	args := soapArgs{{"InstanceID", "0"}, {"Unit", "REL_TIME"}, {"Target", formatDuration(startMs)}}
+	deadline := time.Now().Add(upnpSeekRetryTime)
+	for {
+		_, err := r.transport(ctx, "Seek", args)
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) || ctx.Err() != nil {
+			log.Printf("[RENDER] %s could not seek: %v", r.device.Name, err)
+			return
+		}
+		time.Sleep(300 * time.Millisecond)
+	}
+}
+
+func (r *upnpRenderer) Play(ctx context.Context) error {
+	_, err := r.transport(ctx, "Play", soapArgs{{"InstanceID", "0"}, {"Speed", "1"}})
+	return err
+}
+
+func (r *upnpRenderer) Pause(ctx context.Context) error {
+	_, err := r.transport(ctx, "Pause", soapArgs{{"InstanceID", "0"}})
+	return err
+}
+
+func (r *upnpRenderer) Stop(ctx context.Context) error {
+	_, err := r.transport(ctx, "Stop", soapArgs{{"InstanceID", "0"}})
+	return err
+}
+
+func (r *upnpRenderer) SetVolume(ctx context.Context, volume float64) error {
+	if r.device.upnp.renderingControlURL == "" {
+		return nil
+	}
+	_, err := soapCall(ctx, r.client, r.device.upnp.renderingControlURL, renderingControlType, "SetVolume", soapArgs{
+		{"InstanceID", "0"},
+		{"Channel", "Master"},
+		{"DesiredVolume", strconv.Itoa(int(math.Round(volume * 100)))},
+	})
+	return err
+}
+
+func (r *upnpRenderer) Status(ctx context.Context) (audio.RemoteStatus, error) {
+	info, err := r.transport(ctx, "GetTransportInfo", soapArgs{{"InstanceID", "0"}})
+	if err != nil {
+		return audio.RemoteStatus{}, err
+	}
+	pos, err := r.transport(ctx, "GetPositionInfo", soapArgs{{"InstanceID", "0"}})
+	if err != nil {
+		return audio.RemoteStatus{}, err
+	}
+
+	status := audio.RemoteStatus{
+		Position: parseDuration(pos["RelTime"]),
+		Duration: parseDuration(pos["TrackDuration"]),
+	}
+	switch info["CurrentTransportState"] {
+	case "PLAYING", "TRANSITIONING":
+		status.State = audio.StatePlaying
+	case "PAUSED_PLAYBACK", "PAUSED_RECORDING":
+		status.State = audio.StatePaused
+	default:
+		status.State = audio.StateStopped
+	}
+	return status, nil
+}
+
+// Close stops the renderer; it holds no connection
+func (r *upnpRenderer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return r.Stop(ctx)
+}
+
+func (r *upnpRenderer) transport(ctx context.Context, action string, args soapArgs) (map[string]string, error) {
+	return soapCall(ctx, r.client, r.device.upnp.avTransportURL, avTransportType, action, args)
+}
+
+// soapArgs are an action's arguments in the order the service defines them
+type soapArgs [][2]string
+
+// soapCall invokes a UPnP action and returns the values in its response
+func soapCall(ctx context.Context, client *http.Client, controlURL, serviceType, action string, args soapArgs) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	body.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, serviceType)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg[0])
+		xml.EscapeText(&body, []byte(arg[1]))
+		fmt.Fprintf(&body, "</%s>", arg[0])
+	}
+	fmt.Fprintf(&body, `</u:%s></s:Body></s:Envelope>`, action)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, controlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPACTION", fmt.Sprintf(`"%s#%s"`, serviceType, action))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", action, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", action, err)
+	}
+
+	values := parseSOAPValues(data)
+	if resp.StatusCode != http.StatusOK {
+		if code := values["errorCode"]; code != "" {
+			return nil, fmt.Errorf("%s: UPnP error %s: %s", action, code, values["errorDescription"])
+		}
+		return nil, fmt.Errorf("%s: %s", action, resp.Status)
+	}
+	return values, nil
+}
+
+// parseSOAPValues collects the text of every element without children
+func parseSOAPValues(data []byte) map[string]string {
+	values := make(map[string]string)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var name string
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return values
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name = t.Name.Local
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if name == t.Name.Local {
+				values[name] = strings.TrimSpace(text.String())
+			}
+			name = ""
+		}
+	}
+}
+
+// didlMetadata describes a track for SetAVTransportURI
+func didlMetadata(mediaURL, mimeType string, metadata *audio.TrackMetadata) string {
+	var title, artist, album string
+	var duration int64
+	if metadata != nil {
+		title, artist, album, duration = metadata.Title, metadata.Artist, metadata.Album, metadata.Duration
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`)
+	b.WriteString(`<item id="0" parentID="-1" restricted="1">`)
+	writeElement(&b, "dc:title", title)
+	if artist != "" {
+		writeElement(&b, "upnp:artist", artist)
+	}
+	if album != "" {
+		writeElement(&b, "upnp:album", album)
+	}
+	b.WriteString(`<upnp:class>object.item.audioItem.musicTrack</upnp:class>`)
+	b.WriteString(`<res protocolInfo="http-get:*:` + mimeType + `:` + dlnaFeatures + `"`)
+	if duration > 0 {
+		b.WriteString(` duration="` + formatDuration(duration) + `.000"`)
+	}
+	b.WriteString(`>`)
+	xml.EscapeText(&b, []byte(mediaURL))
+	b.WriteString(`</res></item></DIDL-Lite>`)
+	return b.String()
+}
+
+func writeElement(b *bytes.Buffer, name, text string) {
+	b.WriteString("<" + name + ">")
+	xml.EscapeText(b, []byte(text))
+	b.WriteString("</" + name + ">")
+}
+
+// formatDuration formats milliseconds as H:MM:SS
+func formatDuration(ms int64) string {
+	secs := ms / 1000
+	return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+}
+
+// parseDuration reads H:MM:SS with optional fractional seconds, returning
+// milliseconds or 0 for values such as NOT_IMPLEMENTED
+func parseDuration(s string) int64 {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	hours, err1 := strconv.Atoi(parts[0])
+	minutes, err2 := strconv.Atoi(parts[1])
+	seconds, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0
+	}
+	return int64(hours)*3600000 + int64(minutes)*60000 + int64(math.Round(seconds*1000))
+}
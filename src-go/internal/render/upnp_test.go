@@ -0,0 +1,86 @@
+package render
+
+import "testing"
+
+const testDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:Basic:1</deviceType>
+    <friendlyName>Living Room</friendlyName>
+    <UDN>uuid:root</UDN>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:MediaRenderer:1</deviceType>
+        <friendlyName>Living Room Speaker</friendlyName>
+        <modelName>Speaker One</modelName>
+        <UDN>uuid:renderer</UDN>
+        <serviceList>
+          <service>
+            <serviceType>urn:schemas-upnp-org:service:AVTransport:1</serviceType>
+            <controlURL>/AVTransport/control</controlURL>
+          </service>
+          <service>
+            <serviceType>urn:schemas-upnp-org:service:RenderingControl:1</serviceType>
+            <controlURL>RenderingControl/control</controlURL>
+          </service>
+        </serviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+func TestParseDescriptionFindsEmbeddedRenderer(t *testing.T) {
+	d, err := parseDescription([]byte(testDescription), "http://192.168.1.20:49152/desc/root.xml")
+	if err != nil {
+		t.Fatalf("parseDescription failed: %v", err)
+	}
+
+	if d.ID != "uuid:renderer" || d.Name != "Living Room Speaker" || d.Model != "Speaker One" {
+		t.Errorf("Unexpected device: %+v", d)
+	}
+	if d.Host != "192.168.1.20" {
+		t.Errorf("Expected host 192.168.1.20, got %q", d.Host)
+	}
+	if d.upnp.avTransportURL != "http://192.168.1.20:49152/AVTransport/control" {
+		t.Errorf("Unexpected AVTransport URL %q", d.upnp.avTransportURL)
+	}
+	if d.upnp.renderingControlURL != "http://192.168.1.20:49152/desc/RenderingControl/control" {
+		t.Errorf("Unexpected RenderingControl URL %q", d.upnp.renderingControlURL)
+	}
+}
+
+func TestParseSSDPResponse(t *testing.T) {
+	resp := "HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=1800\r\nLOCATION: http://192.168.1.20:49152/desc/root.xml\r\nST: urn:schemas-upnp-org:service:AVTransport:1\r\n\r\n"
+
+	location, ok := parseSSDPResponse([]byte(resp))
+	if !ok || location != "http://192.168.1.20:49152/desc/root.xml" {
+		t.Errorf("Expected description location, got %q (%v)", location, ok)
+	}
+	if _, ok := parseSSDPResponse([]byte("NOTIFY * HTTP/1.1\r\n\r\n")); ok {
+		t.Error("Expected a non-response to be ignored")
+	}
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+	if got := formatDuration(3723500); got != "1:02:03" {
+		t.Errorf("Expected 1:02:03, got %s", got)
+	}
+	if got := parseDuration("1:02:03.500"); got != 3723500 {
+		t.Errorf("Expected 3723500, got %d", got)
+	}
+	if got := parseDuration("NOT_IMPLEMENTED"); got != 0 {
+		t.Errorf("Expected 0 for NOT_IMPLEMENTED, got %d", got)
+	}
+}
+
+func TestParseSOAPValues(t *testing.T) {
+	body := `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>` +
+		`<u:GetTransportInfoResponse xmlns:u="urn:schemas-upnp-org:service:AVTransport:1">` +
+		`<CurrentTransportState>PLAYING</CurrentTransportState><CurrentSpeed>1</CurrentSpeed>` +
+		`</u:GetTransportInfoResponse></s:Body></s:Envelope>`
+
+	values := parseSOAPValues([]byte(body))
+	if values["CurrentTransportState"] != "PLAYING" || values["CurrentSpeed"] != "1" {
+		t.Errorf("Unexpected values: %v", values)
+	}
+}
@@ -0,0 +1,101 @@
+package scanner
+
+// BatchSize is how many scanned files are gathered before they are handed to
+// the batch callback
+const BatchSize = 100
+
+// ScanBatch is a group of files from an async scan, handed out while the scan
+// runs so clients can fill in the library before it finishes. The counters
+// cover the whole scan so far.
+type ScanBatch struct {
+	LibraryPath string
+	Files       []FileInfo // Files scanned since the last batch, in the order they finished
+	Discovered  int        // Audio files found in the library paths walked so far
+	Processed   int        // Files probed so far
+	Unreadable  int        // Files and folders that couldn't be read so far
+	Done        bool       // Set on a last, empty batch once the scan is complete
+}
+
+// SetOnBatch sets a callback run with each batch of files found by an async
+// scan
+func (s *Scanner) SetOnBatch(callback func(batch ScanBatch)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onBatch = callback
+}
+
+// batcher gathers the files of one scan into batches. It is used from a
+// single goroutine.
+type batcher struct {
+	callback    func(batch ScanBatch)
+	libraryPath string
+	files       []FileInfo
+	discovered  int
+	processed   int
+	unreadable  int
+}
+
+// newBatcher starts batching a scan for the current batch callback, if any
+func (s *Scanner) newBatcher() *batcher {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &batcher{callback: s.onBatch}
+}
+
+// startPath begins the files of a library path, once walking it has found
+// them
+func (b *batcher) startPath(libraryPath string, discovered, unreadable int) {
+	b.libraryPath = libraryPath
+	b.discovered += discovered
+	b.unreadable += unreadable
+}
+
+// add counts a probed file and batches the tracks read from it, leaving out
+// those too short to keep
+func (b *batcher) add(tracks []FileInfo, unreadable bool, opts Options) {
+	b.processed++
+	if unreadable {
+		b.unreadable++
+	}
+	if b.callback == nil {
+		return
+	}
+	for _, fi := range tracks {
+		if !opts.tooShort(fi.Metadata) {
+			b.files = append(b.files, fi)
+		}
+		if len(b.files) >= BatchSize {
+			b.flush()
+		}
+	}
+}
+
+// flush hands the files gathered so far to the callback
+func (b *batcher) flush() {
+	if b.callback == nil || len(b.files) == 0 {
+		return
+	}
+	b.callback(b.batch(b.files))
+	b.files = nil
+}
+
+// finish flushes what's left and reports the scan complete
+func (b *batcher) finish() {
+	b.flush()
+	if b.callback == nil {
+		return
+	}
+	batch := b.batch([]FileInfo{})
+	batch.Done = true
+	b.callback(batch)
+}
+
+func (b *batcher) batch(files []FileInfo) ScanBatch {
+	return ScanBatch{
+		LibraryPath: b.libraryPath,
+		Files:       files,
+		Discovered:  b.discovered,
+		Processed:   b.processed,
+		Unreadable:  b.unreadable,
+	}
+}
@@ -0,0 +1,51 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAsyncScanBatches(t *testing.T) {
+	root := t.TempDir()
+	for i := range 150 {
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("%03d.mp3", i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewScanner()
+	s.ffprobePath = "" // Scan without reading tags
+	batches := make(chan ScanBatch, 10)
+	s.SetOnBatch(func(batch ScanBatch) { batches <- batch })
+	if !s.ScanPathsAsync(context.Background(), []string{root}, false) {
+		t.Fatal("scan did not start")
+	}
+
+	var got []ScanBatch
+	for len(got) == 0 || !got[len(got)-1].Done {
+		select {
+		case batch := <-batches:
+			got = append(got, batch)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("scan did not finish, got %d batches", len(got))
+		}
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("expected 2 batches and a done batch, got %d", len(got))
+	}
+	for i, want := range []int{100, 50, 0} {
+		b := got[i]
+		if len(b.Files) != want || b.LibraryPath != root || b.Discovered != 150 {
+			t.Errorf("batch %d: expected %d files of 150 from %s, got %d of %d from %s",
+				i, want, root, len(b.Files), b.Discovered, b.LibraryPath)
+		}
+	}
+	if got[0].Processed != 100 || got[2].Processed != 150 {
+		t.Errorf("expected 100 then 150 processed, got %d then %d", got[0].Processed, got[2].Processed)
+	}
+}
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/austinkregel/local-media/musicd/internal/cue"
+)
+
+// cueExtension is the extension of CUE sheets, which are picked up alongside
+// audio files to split the album images they describe
+const cueExtension = ".cue"
+
+// CueTrack places a track of a CUE sheet within the image file it plays from
+type CueTrack struct {
+	Sheet string `json:"sheet"`
+	Image string `json:"image"`
+	Start int64  `json:"start"`         // milliseconds into Image
+	End   int64  `json:"end,omitempty"` // milliseconds into Image, 0 for the end of the file
+}
+
+// loadCueSheets takes the CUE sheets out of the files found by a walk and
+// loads them, returning the sheets by the image file each splits. Sheets
+// with a file per track are left out, as those files are scanned as they
+// are.
+func loadCueSheets(found []foundFile) ([]foundFile, map[string]*cue.Sheet, []UnreadableFile) {
+	files := found[:0]
+	images := make(map[string]*cue.Sheet)
+	var unreadable []UnreadableFile
+	for _, f := range found {
+		if !strings.EqualFold(filepath.Ext(f.path), cueExtension) {
+			files = append(files, f)
+			continue
+		}
+
+		sheet, err := cue.Load(f.path)
+		if err != nil {
+			log.Printf("[SCANNER] Failed to read CUE sheet %s: %v", f.path, err)
+			unreadable = append(unreadable, UnreadableFile{Path: f.path, Error: err.Error()})
+			continue
+		}
+		image, ok := sheet.Image()
+		if !ok {
+			continue
+		}
+		if _, claimed := images[image]; claimed {
+			log.Printf("[SCANNER] Ignoring CUE sheet %s, %s is already split by another", f.path, filepath.Base(image))
+			continue
+		}
+		images[image] = sheet
+	}
+	return files, images, unreadable
+}
+
+// cueTracks splits an album image into the tracks of its CUE sheet. Tags
+// come from the sheet where it has them and from the image otherwise, and
+// the image's size is shared out by track length.
+func cueTracks(image FileInfo, sheet *cue.Sheet) []FileInfo {
+	var imageMeta TrackMetadata
+	if image.Metadata != nil {
+		imageMeta = *image.Metadata
+	}
+
+	tracks := make([]FileInfo, 0, len(sheet.Tracks))
+	for _, t := range sheet.Tracks {
+		start, end := t.Start.Milliseconds(), t.End.Milliseconds()
+		length := end - start
+		if end == 0 {
+			length = max(imageMeta.Duration-start, 0) // 0 when the image's length isn't known
+		}
+
+		meta := imageMeta
+		meta.Title = firstNonEmpty(t.Title, fmt.Sprintf("Track %02d", t.Number))
+		meta.Artist = firstNonEmpty(t.Performer, sheet.Performer, imageMeta.Artist)
+		meta.Album = firstNonEmpty(sheet.Title, imageMeta.Album)
+		meta.AlbumArtist = firstNonEmpty(sheet.Performer, imageMeta.AlbumArtist)
+		meta.Genre = firstNonEmpty(sheet.Genre, imageMeta.Genre)
+		if sheet.Year > 0 {
+			meta.Year = sheet.Year
+		}
+		meta.TrackNumber = t.Number
+		meta.Duration = length
+
+		var size int64
+		if imageMeta.Duration > 0 {
+			size = image.Size * length / imageMeta.Duration
+		}
+
+		tracks = append(tracks, FileInfo{
+			Path:       cue.TrackPath(sheet.Path, t.Number),
+			Size:       size,
+			ModifiedAt: image.ModifiedAt,
+			Metadata:   &meta,
+			Cue:        &CueTrack{Sheet: sheet.Path, Image: image.Path, Start: start, End: end},
+		})
+	}
+	return tracks
+}
+
+// firstNonEmpty returns the first of values that isn't empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/austinkregel/local-media/musicd/internal/cue"
+)
+
+func TestScanSplitsCueImages(t *testing.T) {
+	root := t.TempDir()
+	sheet := `PERFORMER "Artist"
+TITLE "Album"
+FILE "Album.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "One"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Two"
+    INDEX 01 02:30:00
+`
+	files := map[string]string{
+		"Album/Album.cue":  sheet,
+		"Album/Album.flac": "", // Re-encoded after the sheet was written
+		"Album/bonus.mp3":  "",
+		"Broken/bad.cue":   "TRACK 01 AUDIO\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewScanner()
+	s.ffprobePath = "" // Scan without reading tags
+	results := s.ScanPaths(context.Background(), []string{root})
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	result := results[0]
+
+	sheetPath := filepath.Join(root, "Album/Album.cue")
+	image := filepath.Join(root, "Album/Album.flac")
+	want := []struct {
+		path       string
+		title      string
+		start, end int64
+	}{
+		{cue.TrackPath(sheetPath, 1), "One", 0, 150000},
+		{cue.TrackPath(sheetPath, 2), "Two", 150000, 0},
+		{filepath.Join(root, "Album/bonus.mp3"), "", 0, 0},
+	}
+	if len(result.Files) != len(want) {
+		t.Fatalf("expected %d files, got %+v", len(want), result.Files)
+	}
+	for i, w := range want {
+		f := result.Files[i]
+		if f.Path != w.path {
+			t.Errorf("file %d: expected %s, got %s", i, w.path, f.Path)
+			continue
+		}
+		if w.title == "" {
+			if f.Cue != nil {
+				t.Errorf("%s: expected an ordinary file, got %+v", f.Path, f.Cue)
+			}
+			continue
+		}
+		if f.Cue == nil || f.Cue.Image != image || f.Cue.Start != w.start || f.Cue.End != w.end {
+			t.Errorf("%s: expected %s from %d to %d, got %+v", f.Path, image, w.start, w.end, f.Cue)
+		}
+		if f.Metadata == nil || f.Metadata.Title != w.title || f.Metadata.Album != "Album" || f.Metadata.TrackNumber != i+1 {
+			t.Errorf("%s: expected tags from the sheet, got %+v", f.Path, f.Metadata)
+		}
+	}
+
+	if len(result.Unreadable) != 1 || result.Unreadable[0].Path != filepath.Join(root, "Broken/bad.cue") {
+		t.Errorf("expected the broken sheet to be unreadable, got %+v", result.Unreadable)
+	}
+}
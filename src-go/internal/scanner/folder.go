@@ -0,0 +1,35 @@
+package scanner
+
+import (
+	"context"
+
+	"github.com/austinkregel/local-media/musicd/internal/cue"
+)
+
+// FolderTracks lists the tracks in a folder, and in its subfolders when
+// recursive, in path order and without probing them. Album images split by
+// a CUE sheet are listed as the sheet's tracks.
+func FolderTracks(ctx context.Context, dir string, recursive bool) ([]string, error) {
+	opts := Options{}
+	if !recursive {
+		opts.MaxDepth = 1
+	}
+	found, _, err := walkLibrary(ctx, dir, opts, DefaultTuning.workerCount())
+	if err != nil {
+		return nil, err
+	}
+	files, images, _ := loadCueSheets(found)
+
+	var paths []string
+	for _, f := range files {
+		sheet, ok := images[f.path]
+		if !ok {
+			paths = append(paths, f.path)
+			continue
+		}
+		for _, t := range sheet.Tracks {
+			paths = append(paths, cue.TrackPath(sheet.Path, t.Number))
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,10 @@
+package scanner
+
+import "github.com/austinkregel/local-media/musicd/internal/metrics"
+
+var (
+	scanDuration = metrics.NewHistogram("musicd_scan_duration_seconds",
+		"Duration of completed library scans", metrics.DefaultBuckets)
+	scannedFiles = metrics.NewCounter("musicd_scan_files_total",
+		"Audio files found by library scans")
+)
@@ -0,0 +1,273 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options narrows what a scan of one library path picks up. The zero value
+// scans everything.
+type Options struct {
+	Exclude        []string      // Globs relative to the library path; "**" matches any number of folders
+	MinDuration    time.Duration // Tracks known to be shorter are left out
+	FollowSymlinks bool          // Descend into symlinked folders
+	MaxDepth       int           // Folder levels to scan, 1 for only the top level; 0 for no limit
+	Confined       bool          // Skip symlinks that lead out of the library path
+}
+
+// SetPathOptions sets the options used when scanning each library path.
+// Paths without options are scanned in full.
+func (s *Scanner) SetPathOptions(options map[string]Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pathOptions = options
+}
+
+// optionsFor returns the options for scanning a library path
+func (s *Scanner) optionsFor(libraryPath string) Options {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pathOptions[libraryPath]
+}
+
+// excluded reports whether a path relative to the library path, with "/"
+// separators, matches one of the exclude patterns
+func (o Options) excluded(rel string) bool {
+	for _, pattern := range o.Exclude {
+		if matchGlob(strings.Split(pattern, "/"), strings.Split(rel, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// tooShort reports whether a track is known to be shorter than MinDuration
+func (o Options) tooShort(meta *TrackMetadata) bool {
+	return o.MinDuration > 0 && meta != nil && meta.Duration > 0 &&
+		time.Duration(meta.Duration)*time.Millisecond < o.MinDuration
+}
+
+// matchGlob matches path segments against pattern segments, where a "**"
+// segment matches any number of path segments, including none
+func matchGlob(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlob(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// foundFile is an audio file found by walking a library path
+type foundFile struct {
+	path    string
+	size    int64
+	modTime int64 // Unix timestamp
+}
+
+// pendingDir is a folder waiting to be listed
+type pendingDir struct {
+	path  string
+	depth int // Levels below the library path of the folder's contents
+}
+
+// libraryWalk lists the folders under a library path with a pool of
+// workers, which matters most on network shares where each listing waits
+// on the server
+type libraryWalk struct {
+	ctx      context.Context
+	root     string
+	realRoot string // root with symlinks resolved, when confined
+	opts     Options
+
+	mu         sync.Mutex
+	wake       *sync.Cond // Signalled when folders are queued or a worker finishes one
+	pending    []pendingDir
+	listing    int // Folders being listed
+	files      []foundFile
+	unreadable []UnreadableFile
+	visited    map[string]bool // Real paths of folders entered, when following symlinks
+	err        error
+}
+
+// walkLibrary finds the audio files and CUE sheets under a library path,
+// skipping hidden folders and whatever the options leave out. Results are
+// sorted by path, as workers finish folders in no set order. Files and
+// folders that can't be read are collected rather than failing the walk.
+func walkLibrary(ctx context.Context, root string, opts Options, workers int) ([]foundFile, []UnreadableFile, error) {
+	w := &libraryWalk{ctx: ctx, root: root, opts: opts, pending: []pendingDir{{path: root, depth: 1}}}
+	w.wake = sync.NewCond(&w.mu)
+	if opts.Confined {
+		w.realRoot = realPath(root)
+	}
+	if opts.FollowSymlinks {
+		w.visited = make(map[string]bool)
+		w.enter(root)
+	}
+
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(w.files, func(i, j int) bool { return w.files[i].path < w.files[j].path })
+	sort.Slice(w.unreadable, func(i, j int) bool { return w.unreadable[i].Path < w.unreadable[j].Path })
+	return w.files, w.unreadable, w.err
+}
+
+// work lists queued folders until none are left and none are being listed
+func (w *libraryWalk) work() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for {
+		for len(w.pending) == 0 && w.listing > 0 {
+			w.wake.Wait()
+		}
+		if len(w.pending) == 0 {
+			w.wake.Broadcast() // Let the other idle workers see the walk is done
+			return
+		}
+		if err := w.ctx.Err(); err != nil {
+			w.err = err
+			w.pending = nil
+			continue
+		}
+
+		dir := w.pending[len(w.pending)-1]
+		w.pending = w.pending[:len(w.pending)-1]
+		w.listing++
+		w.mu.Unlock()
+
+		subdirs, files, unreadable := w.listDir(dir)
+
+		w.mu.Lock()
+		w.pending = append(w.pending, subdirs...)
+		w.files = append(w.files, files...)
+		w.unreadable = append(w.unreadable, unreadable...)
+		w.listing--
+		w.wake.Broadcast()
+	}
+}
+
+// listDir lists one folder, returning the subfolders to walk and the audio
+// files in it
+func (w *libraryWalk) listDir(dir pendingDir) ([]pendingDir, []foundFile, []UnreadableFile) {
+	var subdirs []pendingDir
+	var files []foundFile
+	var unreadable []UnreadableFile
+
+	entries, err := os.ReadDir(dir.path)
+	if err != nil {
+		// Skip folders we can't access, keeping any entries read before the error
+		unreadable = append(unreadable, UnreadableFile{Path: dir.path, Error: err.Error()})
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir.path, entry.Name())
+		rel, _ := filepath.Rel(w.root, path)
+		rel = filepath.ToSlash(rel)
+
+		// Links out of the library aren't read, nor reported as unreadable
+		if entry.Type()&os.ModeSymlink != 0 && w.opts.Confined && !w.inside(path) {
+			continue
+		}
+
+		isDir := entry.IsDir()
+		var info os.FileInfo
+		if entry.Type()&os.ModeSymlink != 0 && w.opts.FollowSymlinks {
+			if info, err = os.Stat(path); err != nil {
+				unreadable = append(unreadable, UnreadableFile{Path: path, Error: err.Error()})
+				continue
+			}
+			isDir = info.IsDir()
+		}
+
+		if isDir {
+			// Skip hidden directories
+			if strings.HasPrefix(entry.Name(), ".") || w.opts.excluded(rel) {
+				continue
+			}
+			if w.opts.MaxDepth > 0 && dir.depth >= w.opts.MaxDepth {
+				continue
+			}
+			if w.opts.FollowSymlinks && !w.enter(path) {
+				continue
+			}
+			subdirs = append(subdirs, pendingDir{path: path, depth: dir.depth + 1})
+			continue
+		}
+
+		// Check if it's an audio file or a CUE sheet
+		ext := strings.ToLower(filepath.Ext(path))
+		if !(SupportedExtensions[ext] || ext == cueExtension) || w.opts.excluded(rel) {
+			continue
+		}
+
+		if info == nil {
+			if info, err = entry.Info(); err != nil {
+				unreadable = append(unreadable, UnreadableFile{Path: path, Error: err.Error()})
+				continue // Skip files we can't stat
+			}
+		}
+		files = append(files, foundFile{path: path, size: info.Size(), modTime: info.ModTime().Unix()})
+	}
+	return subdirs, files, unreadable
+}
+
+// enter records a folder as walked and reports whether it wasn't already,
+// so symlinks back up the tree or to folders seen elsewhere aren't walked
+// twice
+func (w *libraryWalk) enter(dir string) bool {
+	real := realPath(dir)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.visited[real] {
+		return false
+	}
+	w.visited[real] = true
+	return true
+}
+
+// inside reports whether a symlink leads to somewhere under the library
+// path. Broken links lead nowhere, so they aren't.
+func (w *libraryWalk) inside(link string) bool {
+	real, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(w.realRoot, real)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// realPath returns path with symlinks resolved, or as it is if they can't be
+func realPath(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	return path
+}
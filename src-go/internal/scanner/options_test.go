@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"**/Audiobooks/**", "Audiobooks", true},
+		{"**/Audiobooks/**", "Spoken/Audiobooks/Dune/01.mp3", true},
+		{"**/Audiobooks/**", "Music/Audiobooks.mp3", false},
+		{"Samples/*.wav", "Samples/kick.wav", true},
+		{"Samples/*.wav", "Samples/Drums/kick.wav", false},
+		{"**/*.wav", "kick.wav", true},
+		{"*.wav", "Samples/kick.wav", false},
+	}
+	for _, c := range cases {
+		got := Options{Exclude: []string{c.pattern}}.excluded(c.rel)
+		if got != c.want {
+			t.Errorf("%q against %q: expected %v, got %v", c.pattern, c.rel, c.want, got)
+		}
+	}
+}
+
+func TestWalkLibraryOptions(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	for _, name := range []string{
+		"top.mp3",
+		"Album/01.flac",
+		"Album/Disc 2/01.flac",
+		"Audiobooks/Dune/01.mp3",
+		".hidden/01.mp3",
+	} {
+		writeTestFile(t, filepath.Join(root, name))
+	}
+	writeTestFile(t, filepath.Join(outside, "linked.mp3"))
+	if err := os.Symlink(outside, filepath.Join(root, "Linked")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	os.Symlink(root, filepath.Join(root, "Album", "Loop"))
+
+	walk := func(opts Options) []string {
+		found, _, err := walkLibrary(context.Background(), root, opts, 4)
+		if err != nil {
+			t.Fatalf("walkLibrary failed: %v", err)
+		}
+		var rels []string
+		for _, f := range found {
+			rel, _ := filepath.Rel(root, f.path)
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+		sort.Strings(rels)
+		return rels
+	}
+
+	cases := []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, "Album/01.flac Album/Disc 2/01.flac Audiobooks/Dune/01.mp3 top.mp3"},
+		{Options{Exclude: []string{"**/Audiobooks/**"}}, "Album/01.flac Album/Disc 2/01.flac top.mp3"},
+		{Options{MaxDepth: 1}, "top.mp3"},
+		{Options{MaxDepth: 2}, "Album/01.flac top.mp3"},
+		// The loop back to the library root is only walked once
+		{Options{FollowSymlinks: true, MaxDepth: 2}, "Album/01.flac Linked/linked.mp3 top.mp3"},
+		{Options{FollowSymlinks: true}, "Album/01.flac Album/Disc 2/01.flac Audiobooks/Dune/01.mp3 Linked/linked.mp3 top.mp3"},
+	}
+	for _, c := range cases {
+		if got := strings.Join(walk(c.opts), " "); got != c.want {
+			t.Errorf("%+v: expected %q, got %q", c.opts, c.want, got)
+		}
+	}
+}
+
+func TestWalkLibraryConfined(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(root, "Album", "01.flac"))
+	writeTestFile(t, filepath.Join(outside, "Other", "01.flac"))
+	if err := os.Symlink(filepath.Join(outside, "Other"), filepath.Join(root, "Other")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	os.Symlink(filepath.Join(outside, "Other", "01.flac"), filepath.Join(root, "02.flac"))
+	os.Symlink(filepath.Join(root, "Album", "01.flac"), filepath.Join(root, "03.flac"))
+	os.Symlink(filepath.Join(root, "Album"), filepath.Join(root, "Same Album"))
+
+	found, unreadable, err := walkLibrary(context.Background(), root, Options{FollowSymlinks: true, Confined: true}, 4)
+	if err != nil {
+		t.Fatalf("walkLibrary failed: %v", err)
+	}
+	var rels []string
+	for _, f := range found {
+		rel, _ := filepath.Rel(root, f.path)
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	// The link to a folder already walked is left out as usual
+	if got, want := strings.Join(rels, " "), "03.flac Album/01.flac"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if len(unreadable) != 0 {
+		t.Errorf("Expected links out of the library to be skipped quietly, got %+v", unreadable)
+	}
+}
+
+func TestTooShort(t *testing.T) {
+	opts := Options{MinDuration: 30 * time.Second}
+	if !opts.tooShort(&TrackMetadata{Duration: 4000}) {
+		t.Error("Expected a 4s memo to be too short")
+	}
+	if opts.tooShort(&TrackMetadata{Duration: 240000}) || opts.tooShort(nil) || opts.tooShort(&TrackMetadata{}) {
+		t.Error("Expected long tracks and tracks of unknown length to be kept")
+	}
+}
+
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFolderTracks(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"02.mp3", "01.mp3", "Disc 2/01.mp3", "cover.jpg"} {
+		writeTestFile(t, filepath.Join(root, name))
+	}
+	sheet := "FILE \"image.flac\" WAVE\n  TRACK 01 AUDIO\n    INDEX 01 00:00:00\n  TRACK 02 AUDIO\n    INDEX 01 03:00:00\n"
+	if err := os.WriteFile(filepath.Join(root, "image.cue"), []byte(sheet), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(root, "image.flac"))
+
+	list := func(recursive bool) string {
+		paths, err := FolderTracks(context.Background(), root, recursive)
+		if err != nil {
+			t.Fatalf("FolderTracks failed: %v", err)
+		}
+		var rels []string
+		for _, p := range paths {
+			rel, _ := filepath.Rel(root, p)
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+		return strings.Join(rels, " ")
+	}
+
+	if got, want := list(false), "01.mp3 02.mp3 image.cue#1 image.cue#2"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got, want := list(true), "01.mp3 02.mp3 Disc 2/01.mp3 image.cue#1 image.cue#2"; got != want {
+		t.Errorf("Expected %q recursively, got %q", want, got)
+	}
+}
@@ -5,6 +5,8 @@ package scanner
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
@@ -31,10 +33,74 @@ var SupportedExtensions = map[string]bool{
 
 // TrackMetadata contains extracted audio metadata
 type TrackMetadata struct {
-	Title    string `json:"title,omitempty"`
-	Artist   string `json:"artist,omitempty"`
-	Album    string `json:"album,omitempty"`
-	Duration int64  `json:"duration,omitempty"` // milliseconds
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	AlbumArtist string `json:"albumArtist,omitempty"`
+	Composer    string `json:"composer,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+	Year        int    `json:"year,omitempty"`
+	TrackNumber int    `json:"trackNumber,omitempty"`
+	DiscNumber  int    `json:"discNumber,omitempty"`
+	Duration    int64  `json:"duration,omitempty"` // milliseconds
+	Bitrate     int64  `json:"bitrate,omitempty"`  // bits per second
+
+	// Classical works, whose movements are tracks of their own
+	Work           string `json:"work,omitempty"`
+	Movement       string `json:"movement,omitempty"`       // Movement name
+	MovementNumber int    `json:"movementNumber,omitempty"` // Position in the work
+}
+
+// probedTags are the tags requested from ffprobe. ffprobe maps format
+// specific names (ALBUMARTIST, TRACKNUMBER, TPE2...) onto these, but passes
+// work and movement tags through under their own names: WORK, MOVEMENTNAME
+// and MOVEMENT in Vorbis comments and ID3 user text frames, and the TIT1,
+// MVNM and MVIN frames iTunes writes.
+const probedTags = "title,artist,album,album_artist,composer,genre,date,track,disc," +
+	"work,movementname,movement,TIT1,MVNM,MVIN"
+
+// ffprobeTags are the tags of interest in ffprobe's JSON output
+type ffprobeTags struct {
+	Title       string `json:"title"`
+	Artist      string `json:"artist"`
+	Album       string `json:"album"`
+	AlbumArtist string `json:"album_artist"`
+	Composer    string `json:"composer"`
+	Genre       string `json:"genre"`
+	Date        string `json:"date"`
+	Track       string `json:"track"` // "3" or "3/12"
+	Disc        string `json:"disc"`  // "1" or "1/2"
+
+	Work           string `json:"work"`
+	ID3Work        string `json:"TIT1"` // Content group, which iTunes uses for the work alongside MVNM/MVIN
+	Movement       string `json:"movementname"`
+	ID3Movement    string `json:"MVNM"`
+	MovementNumber string `json:"movement"` // "2" or "2/4"
+	ID3MovementNum string `json:"MVIN"`
+}
+
+// fillFrom copies tags that are missing from t
+func (t *ffprobeTags) fillFrom(other ffprobeTags) {
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&t.Title, other.Title)
+	fill(&t.Artist, other.Artist)
+	fill(&t.Album, other.Album)
+	fill(&t.AlbumArtist, other.AlbumArtist)
+	fill(&t.Composer, other.Composer)
+	fill(&t.Genre, other.Genre)
+	fill(&t.Date, other.Date)
+	fill(&t.Track, other.Track)
+	fill(&t.Disc, other.Disc)
+	fill(&t.Work, other.Work)
+	fill(&t.ID3Work, other.ID3Work)
+	fill(&t.Movement, other.Movement)
+	fill(&t.ID3Movement, other.ID3Movement)
+	fill(&t.MovementNumber, other.MovementNumber)
+	fill(&t.ID3MovementNum, other.ID3MovementNum)
 }
 
 // FileInfo represents basic info about an audio file
@@ -43,6 +109,7 @@ type FileInfo struct {
 	Size       int64          `json:"size"`
 	ModifiedAt int64          `json:"modifiedAt"` // Unix timestamp
 	Metadata   *TrackMetadata `json:"metadata,omitempty"`
+	Cue        *CueTrack      `json:"cue,omitempty"` // Set for tracks of a CUE sheet
 }
 
 // ScanResult is the result of a library scan
@@ -52,6 +119,16 @@ type ScanResult struct {
 	TotalFiles  int        `json:"totalFiles"`
 	ScanTimeMs  int64      `json:"scanTimeMs"`
 	Error       string     `json:"error,omitempty"`
+
+	// Files found but not read, such as ones without permission or that
+	// ffprobe could not parse. Files ffprobe failed on are still in Files.
+	Unreadable []UnreadableFile `json:"unreadable,omitempty"`
+}
+
+// UnreadableFile is a file a scan could not read and why
+type UnreadableFile struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
 }
 
 // ScanStatus represents the current scan state
@@ -71,6 +148,11 @@ type Scanner struct {
 	lastMetadata *LibraryMetadata
 	ffprobePath  string
 	nicePath     string // Path to 'nice' command for low-priority execution
+	onComplete   func(results []ScanResult, metadata *LibraryMetadata)
+	onBatch      func(batch ScanBatch)
+	pathOptions  map[string]Options // Library path -> scan options
+	tuning       Tuning
+	isPlaying    func() bool // Reports whether audio is playing, to throttle scans
 }
 
 // NewScanner creates a new scanner
@@ -85,30 +167,41 @@ func NewScanner() *Scanner {
 		status:      ScanStatus{Status: "idle"},
 		ffprobePath: ffprobePath,
 		nicePath:    nicePath,
+		tuning:      DefaultTuning,
 	}
 }
 
+// SetOnComplete sets a callback run with the results of every completed async
+// scan. Unlike GetLastResults, it sees results before a client clears them.
+func (s *Scanner) SetOnComplete(callback func(results []ScanResult, metadata *LibraryMetadata)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onComplete = callback
+}
+
 // extractMetadata uses ffprobe to extract track metadata
-// Runs at low priority using 'nice' when available to avoid hogging CPU
-func (s *Scanner) extractMetadata(path string) *TrackMetadata {
+// Runs at low priority using 'nice' when available to avoid hogging CPU.
+// Returns nil metadata and no error when ffprobe isn't installed.
+func (s *Scanner) extractMetadata(path string) (*TrackMetadata, error) {
 	if s.ffprobePath == "" {
-		return nil
+		return nil, nil
 	}
 
 	ffprobeArgs := []string{
 		"-v", "error",
-		"-show_entries", "format=duration:format_tags=title,artist,album:stream_tags=title,artist,album",
+		"-show_entries", "format=duration,bit_rate:format_tags="+probedTags+":stream_tags="+probedTags,
 		"-of", "json",
 		path,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	tuning := s.getTuning()
+	ctx, cancel := context.WithTimeout(context.Background(), tuning.ProbeTimeout)
 	defer cancel()
 
 	var cmd *exec.Cmd
-	if s.nicePath != "" {
+	if s.nicePath != "" && tuning.NiceLevel > 0 {
 		// Run ffprobe at low priority (nice level 19 = lowest priority)
-		args := append([]string{"-n", "19", s.ffprobePath}, ffprobeArgs...)
+		args := append([]string{"-n", strconv.Itoa(tuning.NiceLevel), s.ffprobePath}, ffprobeArgs...)
 		cmd = exec.CommandContext(ctx, s.nicePath, args...)
 	} else {
 		cmd = exec.CommandContext(ctx, s.ffprobePath, ffprobeArgs...)
@@ -116,55 +209,55 @@ func (s *Scanner) extractMetadata(path string) *TrackMetadata {
 	
 	output, err := cmd.Output()
 	if err != nil {
-		return nil
+		return nil, probeError(err)
 	}
 
 	var result struct {
 		Format struct {
-			Duration string `json:"duration"`
-			Tags     struct {
-				Title  string `json:"title"`
-				Artist string `json:"artist"`
-				Album  string `json:"album"`
-			} `json:"tags"`
+			Duration string      `json:"duration"`
+			Bitrate  string      `json:"bit_rate"`
+			Tags     ffprobeTags `json:"tags"`
 		} `json:"format"`
 		Streams []struct {
-			Tags struct {
-				Title  string `json:"title"`
-				Artist string `json:"artist"`
-				Album  string `json:"album"`
-			} `json:"tags"`
+			Tags ffprobeTags `json:"tags"`
 		} `json:"streams"`
 	}
 
 	if err := json.Unmarshal(output, &result); err != nil {
-		return nil
+		return nil, fmt.Errorf("unexpected ffprobe output: %w", err)
 	}
 
-	meta := &TrackMetadata{}
-
-	// Get from format tags first
-	if result.Format.Tags.Title != "" {
-		meta.Title = result.Format.Tags.Title
+	// Get from format tags first, then fill gaps from the first stream's tags
+	tags := result.Format.Tags
+	if len(result.Streams) > 0 {
+		tags.fillFrom(result.Streams[0].Tags)
 	}
-	if result.Format.Tags.Artist != "" {
-		meta.Artist = result.Format.Tags.Artist
+
+	// Other taggers use TIT1 for a free-form grouping, so it is only taken
+	// as the work when iTunes' movement frames are there too
+	work := tags.Work
+	if work == "" && (tags.ID3Movement != "" || tags.ID3MovementNum != "") {
+		work = tags.ID3Work
 	}
-	if result.Format.Tags.Album != "" {
-		meta.Album = result.Format.Tags.Album
+
+	meta := &TrackMetadata{
+		Title:       tags.Title,
+		Artist:      tags.Artist,
+		Album:       tags.Album,
+		AlbumArtist: tags.AlbumArtist,
+		Composer:    tags.Composer,
+		Genre:       tags.Genre,
+		Year:        parseYear(tags.Date),
+		TrackNumber: parseNumber(tags.Track),
+		DiscNumber:  parseNumber(tags.Disc),
+
+		Work:           work,
+		Movement:       firstNonEmpty(tags.Movement, tags.ID3Movement),
+		MovementNumber: parseNumber(firstNonEmpty(tags.MovementNumber, tags.ID3MovementNum)),
 	}
 
-	// Override with stream tags if available
-	if len(result.Streams) > 0 {
-		if result.Streams[0].Tags.Title != "" && meta.Title == "" {
-			meta.Title = result.Streams[0].Tags.Title
-		}
-		if result.Streams[0].Tags.Artist != "" && meta.Artist == "" {
-			meta.Artist = result.Streams[0].Tags.Artist
-		}
-		if result.Streams[0].Tags.Album != "" && meta.Album == "" {
-			meta.Album = result.Streams[0].Tags.Album
-		}
+	if bitrate, err := strconv.ParseInt(result.Format.Bitrate, 10, 64); err == nil {
+		meta.Bitrate = bitrate
 	}
 
 	// Parse duration
@@ -180,7 +273,47 @@ func (s *Scanner) extractMetadata(path string) *TrackMetadata {
 		meta.Title = strings.TrimSuffix(fileName, filepath.Ext(fileName))
 	}
 
-	return meta
+	return meta, nil
+}
+
+// probeError describes why ffprobe failed, using the first line it printed
+// to stderr when there is one
+func probeError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if msg, _, _ := strings.Cut(strings.TrimSpace(string(exitErr.Stderr)), "\n"); msg != "" {
+			return errors.New(msg)
+		}
+	}
+	return fmt.Errorf("ffprobe failed: %w", err)
+}
+
+// Probe reads a file's metadata with ffprobe the way a scan does. It returns
+// nil metadata and no error when ffprobe isn't installed.
+func (s *Scanner) Probe(path string) (*TrackMetadata, error) {
+	return s.extractMetadata(path)
+}
+
+// parseYear extracts the year from a date tag such as "1997" or "1997-05-21"
+func parseYear(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+// parseNumber extracts the number from a position tag such as "3" or "3/12"
+func parseNumber(tag string) int {
+	tag, _, _ = strings.Cut(tag, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(tag))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
 }
 
 // GetStatus returns the current scan status
@@ -247,6 +380,7 @@ func (s *Scanner) ScanPaths(ctx context.Context, paths []string) []ScanResult {
 
 	results := make([]ScanResult, 0, len(paths))
 	totalPaths := len(paths)
+	batches := &batcher{} // Only async scans stream batches
 
 	for i, path := range paths {
 		select {
@@ -264,7 +398,7 @@ func (s *Scanner) ScanPaths(ctx context.Context, paths []string) []ScanResult {
 		s.status = ScanStatus{Status: "scanning", Progress: progress, Message: "Scanning: " + path}
 		s.mu.Unlock()
 
-		result := s.scanPath(ctx, path)
+		result := s.scanPath(ctx, path, batches)
 		results = append(results, result)
 	}
 
@@ -294,9 +428,11 @@ func (s *Scanner) ScanPathsAsync(ctx context.Context, paths []string, metadataSc
 		}()
 
 		log.Printf("[SCANNER] Async scan starting for %d paths", len(paths))
+		scanStart := time.Now()
 		results := make([]ScanResult, 0, len(paths))
 		totalPaths := len(paths)
 		lastLoggedProgress := -5 // Track last logged progress for 5% intervals
+		batches := s.newBatcher()
 
 		for i, path := range paths {
 			select {
@@ -321,7 +457,7 @@ func (s *Scanner) ScanPathsAsync(ctx context.Context, paths []string, metadataSc
 				lastLoggedProgress = progress
 			}
 
-			result := s.scanPath(ctx, path)
+			result := s.scanPath(ctx, path, batches)
 			results = append(results, result)
 			log.Printf("[SCANNER] Found %d files in %s", result.TotalFiles, path)
 		}
@@ -381,8 +517,17 @@ func (s *Scanner) ScanPathsAsync(ctx context.Context, paths []string, metadataSc
 		s.lastResults = results
 		s.lastMetadata = metadata
 		s.status = ScanStatus{Status: "complete", Progress: 100, Message: "Scan complete"}
+		onComplete := s.onComplete
 		s.mu.Unlock()
 
+		if onComplete != nil {
+			onComplete(results, metadata)
+		}
+		batches.finish()
+
+		scanDuration.ObserveDuration(scanStart)
+		scannedFiles.Add(int64(totalFiles))
+
 		log.Printf("[SCANNER] Async scan complete: %d total files from %d library paths", totalFiles, len(paths))
 	}()
 
@@ -390,7 +535,7 @@ func (s *Scanner) ScanPathsAsync(ctx context.Context, paths []string, metadataSc
 }
 
 // scanPath scans a single library path
-func (s *Scanner) scanPath(ctx context.Context, libraryPath string) ScanResult {
+func (s *Scanner) scanPath(ctx context.Context, libraryPath string, batches *batcher) ScanResult {
 	start := time.Now()
 	result := ScanResult{
 		LibraryPath: libraryPath,
@@ -410,50 +555,20 @@ func (s *Scanner) scanPath(ctx context.Context, libraryPath string) ScanResult {
 	}
 
 	// Collect file paths first
-	var filePaths []string
-	var fileSizes []int64
-	var fileModTimes []int64
-
-	// Walk the directory tree
-	err = filepath.WalkDir(libraryPath, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return nil // Skip files we can't access
-		}
-
-		// Check for cancellation
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
-		// Skip directories
-		if d.IsDir() {
-			// Skip hidden directories
-			if strings.HasPrefix(d.Name(), ".") && path != libraryPath {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		// Check if it's an audio file
-		ext := strings.ToLower(filepath.Ext(path))
-		if !SupportedExtensions[ext] {
-			return nil
-		}
-
-		// Get file info
-		fileInfo, err := d.Info()
-		if err != nil {
-			return nil // Skip files we can't stat
-		}
-
-		filePaths = append(filePaths, path)
-		fileSizes = append(fileSizes, fileInfo.Size())
-		fileModTimes = append(fileModTimes, fileInfo.ModTime().Unix())
-
-		return nil
-	})
+	opts := s.optionsFor(libraryPath)
+	numWorkers := s.getTuning().workerCount()
+	found, unreadable, err := walkLibrary(ctx, libraryPath, opts, numWorkers)
+	found, images, badSheets := loadCueSheets(found)
+	unreadable = append(unreadable, badSheets...)
+	result.Unreadable = append(result.Unreadable, unreadable...)
+	batches.startPath(libraryPath, len(found), len(unreadable))
+
+	filePaths := make([]string, len(found))
+	fileSizes := make([]int64, len(found))
+	fileModTimes := make([]int64, len(found))
+	for i, f := range found {
+		filePaths[i], fileSizes[i], fileModTimes[i] = f.path, f.size, f.modTime
+	}
 
 	if err != nil && err != context.Canceled {
 		result.Error = err.Error()
@@ -465,11 +580,11 @@ func (s *Scanner) scanPath(ctx context.Context, libraryPath string) ScanResult {
 	type indexedFile struct {
 		index int
 		file  FileInfo
+		err   error // Why metadata couldn't be read
 	}
 
-	// Use 4 workers to avoid overwhelming the system
-	// Each worker also runs ffprobe at low priority via 'nice'
-	numWorkers := 4
+	// Each worker runs ffprobe at low priority via 'nice', and all but one
+	// wait while audio is playing
 	jobs := make(chan int, len(filePaths))
 	results := make(chan indexedFile, len(filePaths))
 
@@ -482,22 +597,38 @@ func (s *Scanner) scanPath(ctx context.Context, libraryPath string) ScanResult {
 	var wg sync.WaitGroup
 	for w := 0; w < numWorkers; w++ {
 		wg.Add(1)
-		go func() {
+		go func(id int) {
 			defer wg.Done()
-			for i := range jobs {
+			for {
 				select {
 				case <-ctx.Done():
 					return
 				default:
 				}
 
+				// Leave the CPU to playback
+				if id >= s.activeWorkers(numWorkers) {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(playbackCheckInterval):
+					}
+					continue
+				}
+
+				i, ok := <-jobs
+				if !ok {
+					return
+				}
+
+				meta, err := s.extractMetadata(filePaths[i])
 				fi := FileInfo{
 					Path:       filePaths[i],
 					Size:       fileSizes[i],
 					ModifiedAt: fileModTimes[i],
-					Metadata:   s.extractMetadata(filePaths[i]),
+					Metadata:   meta,
 				}
-				results <- indexedFile{index: i, file: fi}
+				results <- indexedFile{index: i, file: fi, err: err}
 
 				// Log progress every 5%
 				count := atomic.AddInt64(&processedCount, 1)
@@ -509,7 +640,7 @@ func (s *Scanner) scanPath(ctx context.Context, libraryPath string) ScanResult {
 					}
 				}
 			}
-		}()
+		}(w)
 	}
 
 	// Send jobs
@@ -524,10 +655,41 @@ func (s *Scanner) scanPath(ctx context.Context, libraryPath string) ScanResult {
 		close(results)
 	}()
 
-	// Build result array in order
-	fileInfos := make([]FileInfo, len(filePaths))
+	// Build result array in order, with CUE images split into their tracks
+	fileTracks := make([][]FileInfo, len(filePaths))
+	probeErrs := make([]error, len(filePaths))
 	for r := range results {
-		fileInfos[r.index] = r.file
+		tracks := []FileInfo{r.file}
+		if sheet := images[r.file.Path]; sheet != nil && r.err == nil {
+			tracks = cueTracks(r.file, sheet)
+		}
+		fileTracks[r.index] = tracks
+		probeErrs[r.index] = r.err
+		batches.add(tracks, r.err != nil, opts)
+	}
+	batches.flush()
+	fileInfos := make([]FileInfo, 0, len(filePaths))
+	for _, tracks := range fileTracks {
+		fileInfos = append(fileInfos, tracks...)
+	}
+	for i, err := range probeErrs {
+		if err != nil {
+			result.Unreadable = append(result.Unreadable, UnreadableFile{Path: filePaths[i], Error: err.Error()})
+		}
+	}
+
+	// Drop tracks too short to keep, such as samples and voice memos
+	if opts.MinDuration > 0 {
+		kept := fileInfos[:0]
+		for _, fi := range fileInfos {
+			if !opts.tooShort(fi.Metadata) {
+				kept = append(kept, fi)
+			}
+		}
+		if skipped := len(fileInfos) - len(kept); skipped > 0 {
+			log.Printf("[SCANNER] Skipped %d tracks shorter than %s in %s", skipped, opts.MinDuration, libraryPath)
+		}
+		fileInfos = kept
 	}
 
 	result.Files = fileInfos
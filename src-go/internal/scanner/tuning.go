@@ -0,0 +1,65 @@
+package scanner
+
+import (
+	"runtime"
+	"time"
+)
+
+// Tuning controls how hard a scan works the machine
+type Tuning struct {
+	Workers      int           // Folders listed and files probed at once; 0 for one per CPU
+	NiceLevel    int           // Priority ffprobe runs at, from 0 (normal) to 19 (lowest)
+	ProbeTimeout time.Duration // Time ffprobe may spend on one file
+}
+
+// DefaultTuning is how scans run until SetTuning is called
+var DefaultTuning = Tuning{NiceLevel: 19, ProbeTimeout: 5 * time.Second}
+
+// playbackCheckInterval is how often metadata workers held back during
+// playback look again
+const playbackCheckInterval = time.Second
+
+// SetTuning changes the worker count, ffprobe priority and ffprobe timeout
+// used from the next scan on
+func (s *Scanner) SetTuning(tuning Tuning) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tuning = tuning
+}
+
+// SetIsPlayingFunc sets the check scans use to drop to a single metadata
+// worker while audio plays
+func (s *Scanner) SetIsPlayingFunc(isPlaying func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.isPlaying = isPlaying
+}
+
+// getTuning returns the current tuning
+func (s *Scanner) getTuning() Tuning {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tuning
+}
+
+// workerCount returns the number of workers to start, scaling to the
+// machine when none is set
+func (t Tuning) workerCount() int {
+	if t.Workers > 0 {
+		return t.Workers
+	}
+	return max(runtime.NumCPU(), 2)
+}
+
+// activeWorkers returns how many of workers metadata workers may run right
+// now, leaving the CPU to playback when audio is playing
+func (s *Scanner) activeWorkers(workers int) int {
+	s.mu.Lock()
+	isPlaying := s.isPlaying
+	s.mu.Unlock()
+
+	if isPlaying != nil && isPlaying() {
+		return 1
+	}
+	return workers
+}
@@ -0,0 +1,17 @@
+// Package speech reads text aloud through the operating system's text to
+// speech engine.
+package speech
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// ErrUnavailable is returned when there is no text to speech engine to use
+var ErrUnavailable = errors.New("no text to speech engine is available")
+
+// Command returns the command that speaks text. It exits once it has
+// finished speaking.
+func Command(text string) (*exec.Cmd, error) {
+	return command(text)
+}
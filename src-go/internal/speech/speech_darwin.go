@@ -0,0 +1,15 @@
+//go:build darwin
+
+package speech
+
+import (
+	"os/exec"
+	"strings"
+)
+
+func command(text string) (*exec.Cmd, error) {
+	// say reads stdin when it isn't given any text
+	cmd := exec.Command("say")
+	cmd.Stdin = strings.NewReader(text)
+	return cmd, nil
+}
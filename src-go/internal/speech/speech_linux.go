@@ -0,0 +1,24 @@
+//go:build linux
+
+package speech
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// command speaks through Speech Dispatcher, which uses the voice the
+// desktop is set up with, falling back to eSpeak
+func command(text string) (*exec.Cmd, error) {
+	if path, err := exec.LookPath("spd-say"); err == nil {
+		return exec.Command(path, "--wait", "--", text), nil
+	}
+	for _, name := range []string{"espeak-ng", "espeak"} {
+		if path, err := exec.LookPath(name); err == nil {
+			cmd := exec.Command(path, "--stdin")
+			cmd.Stdin = strings.NewReader(text)
+			return cmd, nil
+		}
+	}
+	return nil, ErrUnavailable
+}
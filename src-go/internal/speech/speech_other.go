@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package speech
+
+import "os/exec"
+
+func command(text string) (*exec.Cmd, error) {
+	return nil, ErrUnavailable
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package speech
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// speakScript speaks stdin with the built-in System.Speech synthesizer
+const speakScript = `Add-Type -AssemblyName System.Speech
+$synth = New-Object System.Speech.Synthesis.SpeechSynthesizer
+$synth.Speak([Console]::In.ReadToEnd())`
+
+func command(text string) (*exec.Cmd, error) {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", speakScript)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd, nil
+}
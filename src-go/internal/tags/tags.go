@@ -0,0 +1,131 @@
+// Package tags writes metadata tags and cover art into audio files.
+package tags
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Edit is a change to a file's tags. Nil fields are left as they are; an
+// empty string or zero removes the tag.
+type Edit struct {
+	Title       *string
+	Artist      *string
+	Album       *string
+	AlbumArtist *string
+	Genre       *string
+	Year        *int
+	TrackNumber *int
+	DiscNumber  *int
+
+	// ArtPath is an image to embed as cover art, replacing any existing art
+	ArtPath string
+}
+
+// artExtensions are the cover art formats that can be embedded
+var artExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true}
+
+// IsEmpty reports whether the edit changes nothing
+func (e Edit) IsEmpty() bool {
+	return len(e.metadataArgs()) == 0 && e.ArtPath == ""
+}
+
+// Validate checks the edit can be written
+func (e Edit) Validate() error {
+	for name, n := range map[string]*int{"year": e.Year, "trackNumber": e.TrackNumber, "discNumber": e.DiscNumber} {
+		if n != nil && *n < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	if e.ArtPath != "" {
+		if !artExtensions[strings.ToLower(filepath.Ext(e.ArtPath))] {
+			return fmt.Errorf("cover art must be a JPEG or PNG image")
+		}
+		if _, err := os.Stat(e.ArtPath); err != nil {
+			return fmt.Errorf("cover art: %w", err)
+		}
+	}
+	return nil
+}
+
+// metadataArgs returns ffmpeg -metadata arguments for the edited tags
+func (e Edit) metadataArgs() []string {
+	var args []string
+	text := func(key string, value *string) {
+		if value != nil {
+			args = append(args, "-metadata", key+"="+*value)
+		}
+	}
+	number := func(key string, value *int) {
+		switch {
+		case value == nil:
+		case *value == 0:
+			args = append(args, "-metadata", key+"=")
+		default:
+			args = append(args, "-metadata", key+"="+strconv.Itoa(*value))
+		}
+	}
+	text("title", e.Title)
+	text("artist", e.Artist)
+	text("album", e.Album)
+	text("album_artist", e.AlbumArtist)
+	text("genre", e.Genre)
+	number("date", e.Year)
+	number("track", e.TrackNumber)
+	number("disc", e.DiscNumber)
+	return args
+}
+
+// Write applies the edit with ffmpeg. Audio streams are copied untouched
+// and tags not named in the edit are kept. The file is replaced only once
+// ffmpeg has succeeded.
+func Write(ctx context.Context, path string, e Edit) error {
+	if e.IsEmpty() {
+		return fmt.Errorf("no tags to write")
+	}
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	ffmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return fmt.Errorf("ffmpeg not found: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	// Same directory so the rename is atomic, same extension so ffmpeg
+	// picks the same container
+	tmp := filepath.Join(filepath.Dir(path), ".musicd-tags-"+strconv.FormatInt(time.Now().UnixNano(), 36)+filepath.Ext(path))
+	defer os.Remove(tmp)
+
+	args := []string{"-v", "error", "-y", "-i", path}
+	if e.ArtPath != "" {
+		// Replace any existing picture stream with the new one
+		args = append(args, "-i", e.ArtPath, "-map", "0", "-map", "-0:v", "-map", "1", "-disposition:v", "attached_pic")
+	} else {
+		args = append(args, "-map", "0")
+	}
+	args = append(args, "-c", "copy", "-map_metadata", "0")
+	args = append(args, e.metadataArgs()...)
+	args = append(args, tmp)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if output, err := exec.CommandContext(ctx, ffmpegPath, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,54 @@
+package tags
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataArgs(t *testing.T) {
+	title, genre := "Time", ""
+	year, track := 1973, 0
+	e := Edit{Title: &title, Genre: &genre, Year: &year, TrackNumber: &track}
+
+	want := []string{
+		"-metadata", "title=Time",
+		"-metadata", "genre=",
+		"-metadata", "date=1973",
+		"-metadata", "track=",
+	}
+	if got := e.metadataArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if e.IsEmpty() || !(Edit{}).IsEmpty() {
+		t.Error("IsEmpty is wrong")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tags_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cover := filepath.Join(tmpDir, "cover.jpg")
+	os.WriteFile(cover, []byte{0xff, 0xd8}, 0600)
+
+	negative := -1
+	tests := []struct {
+		edit  Edit
+		valid bool
+	}{
+		{Edit{ArtPath: cover}, true},
+		{Edit{ArtPath: filepath.Join(tmpDir, "missing.jpg")}, false},
+		{Edit{ArtPath: filepath.Join(tmpDir, "cover.gif")}, false},
+		{Edit{Year: &negative}, false},
+	}
+	for i, tt := range tests {
+		if err := tt.edit.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Case %d: expected valid=%v, got %v", i, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Package transcode converts tracks to compact formats for renderers on slow
+// links or without a decoder for the library's formats, and keeps the
+// results in a size-limited cache on disk that is kept across restarts.
+package transcode
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// format is an output format tracks can be converted to
+type format struct {
+	ext         string
+	contentType string
+	codec       string // FFmpeg encoder
+	muxer       string // FFmpeg output format
+}
+
+var formats = map[string]format{
+	"opus": {ext: ".opus", contentType: "audio/ogg", codec: "libopus", muxer: "ogg"},
+	"mp3":  {ext: ".mp3", contentType: "audio/mpeg", codec: "libmp3lame", muxer: "mp3"},
+	"aac":  {ext: ".aac", contentType: "audio/aac", codec: "aac", muxer: "adts"},
+}
+
+// DefaultExtensions are the source formats converted when a profile doesn't
+// list any: the lossless ones, which are the costly ones to stream
+var DefaultExtensions = []string{".flac", ".wav", ".aiff", ".aif", ".ape", ".wv"}
+
+// Profile says which tracks are converted and to what
+type Profile struct {
+	Format      string   // "opus", "mp3" or "aac"; empty converts nothing
+	BitrateKbps int      // Bitrate of converted tracks
+	Extensions  []string // Source formats to convert; empty means DefaultExtensions
+
+	// Start and Length cut a clip out of the track, faded in and out, such
+	// as a preview. A zero Length converts the whole track.
+	Start  time.Duration
+	Length time.Duration
+}
+
+// Applies reports whether path is converted under the profile
+func (p Profile) Applies(path string) bool {
+	if _, ok := formats[p.Format]; !ok {
+		return false
+	}
+	extensions := p.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+	ext := filepath.Ext(path)
+	for _, e := range extensions {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ext returns the extension of tracks converted under the profile
+func (p Profile) Ext() string {
+	return formats[p.Format].ext
+}
+
+// ContentType returns the MIME type of tracks converted under the profile
+func (p Profile) ContentType() string {
+	return formats[p.Format].contentType
+}
+
+// key identifies a conversion of a track as it was when converted, so an
+// edited track is converted again
+func (p Profile) key(path string, info os.FileInfo) string {
+	key := path + "\x00" + p.Format + "\x00" + strconv.Itoa(p.BitrateKbps)
+	if p.Length > 0 {
+		key += "\x00" + p.Start.String() + "\x00" + p.Length.String()
+	}
+	return key + "\x00" + strconv.FormatInt(info.Size(), 10) + "\x00" + strconv.FormatInt(info.ModTime().UnixNano(), 10)
+}
+
+// entry is a converted track
+type entry struct {
+	size     int64
+	lastUsed time.Time
+}
+
+// staleTempAge is how long a partial conversion is left before a new
+// transcoder takes it for one abandoned by a daemon that crashed
+const staleTempAge = time.Hour
+
+// Transcoder converts tracks with FFmpeg, keeping the most recently used
+// conversions up to a size limit. Conversions are named after the track,
+// its modification time and the profile, so they are kept across restarts
+// and shared by daemons using the same directory. It is safe for concurrent
+// use.
+type Transcoder struct {
+	dir string
+
+	mu         sync.Mutex
+	maxBytes   int64
+	entries    map[string]*entry // Conversion file -> its use
+	converting map[string]chan struct{}
+}
+
+// New creates a transcoder caching in dir, taking in the conversions already
+// there
+func New(dir string, maxBytes int64) (*Transcoder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create transcode dir: %w", err)
+	}
+	t := &Transcoder{
+		dir:        dir,
+		maxBytes:   maxBytes,
+		entries:    make(map[string]*entry),
+		converting: make(map[string]chan struct{}),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read transcode dir: %w", err)
+	}
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		file := filepath.Join(dir, f.Name())
+		if strings.HasPrefix(f.Name(), ".") {
+			if time.Since(info.ModTime()) > staleTempAge {
+				os.Remove(file)
+			}
+			continue
+		}
+		// A conversion's modification time is when it was last used
+		t.entries[file] = &entry{size: info.Size(), lastUsed: info.ModTime()}
+	}
+	t.evictLocked()
+	return t, nil
+}
+
+// DefaultDir returns the transcode cache directory in the user's cache
+// directory, or under the system temp directory in a folder of the user's
+// own
+func DefaultDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "musicd", "transcode")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("musicd-%d", os.Getuid()), "transcode")
+}
+
+// SetMaxBytes changes the size limit, evicting conversions that no longer
+// fit
+func (t *Transcoder) SetMaxBytes(maxBytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxBytes = maxBytes
+	t.evictLocked()
+}
+
+// Stats returns the number of cached conversions and their total size
+func (t *Transcoder) Stats() (int, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.entries), t.totalLocked()
+}
+
+// Get returns the path of path converted under profile, converting it first
+// unless a conversion of the current file is cached. A conversion already in
+// progress is waited for rather than started again.
+func (t *Transcoder) Get(ctx context.Context, path string, profile Profile) (string, error) {
+	f, ok := formats[profile.Format]
+	if !ok {
+		return "", fmt.Errorf("unknown transcode format %q", profile.Format)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(profile.key(path, info)))
+	file := filepath.Join(t.dir, hex.EncodeToString(sum[:])[:16]+f.ext)
+
+	for {
+		t.mu.Lock()
+		// The conversion may also have been made by another daemon
+		if stat, err := os.Stat(file); err == nil {
+			now := time.Now()
+			os.Chtimes(file, now, now)
+			t.entries[file] = &entry{size: stat.Size(), lastUsed: now}
+			t.mu.Unlock()
+			return file, nil
+		}
+		delete(t.entries, file)
+		wait, busy := t.converting[file]
+		if !busy {
+			break
+		}
+		t.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	done := make(chan struct{})
+	t.converting[file] = done
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		delete(t.converting, file)
+		t.mu.Unlock()
+		close(done)
+	}()
+
+	size, err := convert(ctx, path, file, f, profile)
+	if err != nil {
+		return "", err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[file] = &entry{size: size, lastUsed: time.Now()}
+	t.evictLocked()
+	return file, nil
+}
+
+func (t *Transcoder) totalLocked() int64 {
+	var total int64
+	for _, e := range t.entries {
+		total += e.size
+	}
+	return total
+}
+
+// evictLocked removes the least recently used conversions until the cache
+// fits its limit, always keeping the newest so it can be served (must be
+// called with lock held)
+func (t *Transcoder) evictLocked() {
+	total := t.totalLocked()
+	if total <= t.maxBytes {
+		return
+	}
+
+	files := make([]string, 0, len(t.entries))
+	for file := range t.entries {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return t.entries[files[i]].lastUsed.Before(t.entries[files[j]].lastUsed)
+	})
+
+	for _, file := range files[:len(files)-1] {
+		if total <= t.maxBytes {
+			break
+		}
+		os.Remove(file)
+		total -= t.entries[file].size
+		delete(t.entries, file)
+	}
+}
+
+// clipFade is how long a clip fades in, and out
+const clipFade = 500 * time.Millisecond
+
+// convert encodes src into dst through a temporary file so a cancelled or
+// failed conversion never leaves a partial track behind
+func convert(ctx context.Context, src, dst string, f format, profile Profile) (int64, error) {
+	ffmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return 0, fmt.Errorf("ffmpeg not found: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".convert-*"+f.ext)
+	if err != nil {
+		return 0, fmt.Errorf("create temp file: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	args := []string{"-v", "error", "-nostdin", "-y"}
+	if profile.Length > 0 {
+		args = append(args, "-ss", seconds(profile.Start), "-t", seconds(profile.Length))
+	}
+	args = append(args,
+		"-i", src,
+		"-map", "0:a:0",
+		"-c:a", f.codec,
+	)
+	if profile.Length > 0 {
+		fadeOut := max(profile.Length-clipFade, 0)
+		args = append(args, "-af", fmt.Sprintf("afade=t=in:d=%s,afade=t=out:st=%s:d=%s",
+			seconds(clipFade), seconds(fadeOut), seconds(clipFade)))
+	}
+	if profile.BitrateKbps > 0 {
+		args = append(args, "-b:a", strconv.Itoa(profile.BitrateKbps)+"k")
+	}
+	args = append(args, "-f", f.muxer, tmp.Name())
+	if output, err := exec.CommandContext(ctx, ffmpegPath, args...).CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("convert %s: %w: %s", filepath.Base(src), err, strings.TrimSpace(string(output)))
+	}
+
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return 0, fmt.Errorf("rename: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// seconds formats d for FFmpeg
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
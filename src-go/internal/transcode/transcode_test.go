@@ -0,0 +1,179 @@
+package transcode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFFmpeg puts an ffmpeg on PATH that writes its arguments to the output
+// file, and logs each run to the returned file
+func fakeFFmpeg(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg is a shell script")
+	}
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	script := "#!/bin/sh\necho run >> " + runs + "\nfor a; do out=\"$a\"; done\necho \"$@\" > \"$out\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	return runs
+}
+
+func countRuns(t *testing.T, runs string) int {
+	data, _ := os.ReadFile(runs)
+	return strings.Count(string(data), "run")
+}
+
+func TestGetConvertsOnceAndCaches(t *testing.T) {
+	runs := fakeFFmpeg(t)
+	dir := t.TempDir()
+	track := filepath.Join(dir, "song.flac")
+	if err := os.WriteFile(track, []byte("fLaC"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tc, err := New(filepath.Join(dir, "cache"), 1<<20)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	profile := Profile{Format: "opus", BitrateKbps: 96}
+
+	var wg sync.WaitGroup
+	files := make([]string, 3)
+	errs := make([]error, 3)
+	for i := range files {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			files[i], errs[i] = tc.Get(context.Background(), track, profile)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	if files[0] != files[1] || files[1] != files[2] || filepath.Ext(files[0]) != ".opus" {
+		t.Errorf("Expected one .opus conversion, got %v", files)
+	}
+	if n := countRuns(t, runs); n != 1 {
+		t.Errorf("Expected ffmpeg to run once, ran %d times", n)
+	}
+	args, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(args), "-c:a libopus -b:a 96k -f ogg") {
+		t.Errorf("Unexpected ffmpeg arguments: %s", args)
+	}
+
+	// Another bitrate is another conversion
+	if _, err := tc.Get(context.Background(), track, Profile{Format: "opus", BitrateKbps: 64}); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if n := countRuns(t, runs); n != 2 {
+		t.Errorf("Expected a second conversion, ffmpeg ran %d times", n)
+	}
+
+	// So is a clip, cut and faded
+	clip, err := tc.Get(context.Background(), track, Profile{Format: "opus", BitrateKbps: 96, Start: 30 * time.Second, Length: 15 * time.Second})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	args, _ = os.ReadFile(clip)
+	if clip == files[0] || !strings.Contains(string(args), "-ss 30.000 -t 15.000 -i") || !strings.Contains(string(args), "afade=t=out:st=14.500") {
+		t.Errorf("Unexpected clip ffmpeg arguments: %s", args)
+	}
+}
+
+func TestConversionsKeptAcrossRestarts(t *testing.T) {
+	runs := fakeFFmpeg(t)
+	dir := t.TempDir()
+	track := filepath.Join(dir, "song.flac")
+	if err := os.WriteFile(track, []byte("fLaC"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	profile := Profile{Format: "opus", BitrateKbps: 96}
+
+	tc, err := New(filepath.Join(dir, "cache"), 1<<20)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	first, err := tc.Get(context.Background(), track, profile)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	restarted, err := New(filepath.Join(dir, "cache"), 1<<20)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if files, _ := restarted.Stats(); files != 1 {
+		t.Errorf("Expected the conversion to be taken in, have %d", files)
+	}
+	again, err := restarted.Get(context.Background(), track, profile)
+	if err != nil || again != first {
+		t.Fatalf("Expected the earlier conversion, got %s (%v)", again, err)
+	}
+	if n := countRuns(t, runs); n != 1 {
+		t.Errorf("Expected no conversion after the restart, ffmpeg ran %d times", n)
+	}
+
+	// An edited track is converted again
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(track, later, later)
+	if edited, err := restarted.Get(context.Background(), track, profile); err != nil || edited == first {
+		t.Errorf("Expected a new conversion of the edited track, got %s (%v)", edited, err)
+	}
+}
+
+func TestEvictionKeepsNewest(t *testing.T) {
+	fakeFFmpeg(t)
+	dir := t.TempDir()
+	tc, err := New(filepath.Join(dir, "cache"), 1)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	var last string
+	for _, name := range []string{"a.flac", "b.flac"} {
+		track := filepath.Join(dir, name)
+		if err := os.WriteFile(track, []byte("fLaC"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if last, err = tc.Get(context.Background(), track, Profile{Format: "mp3"}); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	if files, _ := tc.Stats(); files != 1 {
+		t.Errorf("Expected only the newest conversion to be kept, have %d", files)
+	}
+	if _, err := os.Stat(last); err != nil {
+		t.Errorf("Expected the newest conversion to exist: %v", err)
+	}
+}
+
+func TestProfileApplies(t *testing.T) {
+	cases := []struct {
+		profile Profile
+		path    string
+		want    bool
+	}{
+		{Profile{Format: "opus"}, "/m/a.FLAC", true},
+		{Profile{Format: "opus"}, "/m/a.mp3", false},
+		{Profile{Format: "opus", Extensions: []string{".mp3"}}, "/m/a.mp3", true},
+		{Profile{}, "/m/a.flac", false},
+		{Profile{Format: "vorbis"}, "/m/a.flac", false},
+	}
+	for _, c := range cases {
+		if got := c.profile.Applies(c.path); got != c.want {
+			t.Errorf("%+v.Applies(%s): expected %v, got %v", c.profile, c.path, c.want, got)
+		}
+	}
+}